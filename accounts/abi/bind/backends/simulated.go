@@ -535,7 +535,8 @@ func (fb *filterBackend) UnsubscribePendingLogsEvent(ch chan<- core.PendingLogsE
 	fb.bc.UnsubscribePendingLogsEvent(ch)
 }
 
-func (fb *filterBackend) BloomStatus() (uint64, uint64) { return 4096, 0 }
+func (fb *filterBackend) BloomStatus() (uint64, uint64)    { return 4096, 0 }
+func (fb *filterBackend) LogIndexStatus() (uint64, uint64) { return 0, 0 }
 func (fb *filterBackend) ServiceFilter(ctx context.Context, ms *bloombits.MatcherSession) {
 	panic("not supported")
 }
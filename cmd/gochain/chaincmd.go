@@ -67,8 +67,14 @@ It expects the genesis file as argument.`,
 			utils.CacheFlag,
 			utils.LightModeFlag,
 			utils.GCModeFlag,
+			utils.SnapshotFlag,
+			utils.WitnessFlag,
+			utils.StateDiffsFlag,
+			utils.HistoryBlocksFlag,
 			utils.CacheDatabaseFlag,
+			utils.CacheTrieFlag,
 			utils.CacheGCFlag,
+			utils.CacheNoPrefetchFlag,
 		},
 		Category: "BLOCKCHAIN COMMANDS",
 		Description: `
@@ -94,6 +100,88 @@ Requires a first argument of the file to write to.
 Optional second and third arguments control the first and
 last block to write. In this mode, the file will be appended
 if already existing.`,
+	}
+	exportStateDiffsFromFlag = cli.Uint64Flag{
+		Name:  "from",
+		Usage: "First block to export the state diff of",
+	}
+	exportStateDiffsToFlag = cli.Uint64Flag{
+		Name:  "to",
+		Usage: "Last block to export the state diff of (default = head block)",
+	}
+	exportStateDiffsFormatFlag = cli.StringFlag{
+		Name:  "format",
+		Usage: `Output format ("json" lines or "rlp")`,
+		Value: "json",
+	}
+	exportStateDiffsCommand = cli.Command{
+		Action:    utils.MigrateFlags(exportStateDiffs),
+		Name:      "export-statediffs",
+		Usage:     "Export per-block state diffs into file",
+		ArgsUsage: "<filename>",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.CacheFlag,
+			exportStateDiffsFromFlag,
+			exportStateDiffsToFlag,
+			exportStateDiffsFormatFlag,
+		},
+		Category: "BLOCKCHAIN COMMANDS",
+		Description: `
+Writes every account balance, nonce, code and storage change made by each block
+in the range, one diff per block, as JSON lines or concatenated RLP. A ".gz"
+filename suffix compresses the output. Diffs recorded with --statediffs are read
+from the database, others are regenerated from the parent state, which must be
+available.`,
+	}
+	exportHistoryCommand = cli.Command{
+		Action:    utils.MigrateFlags(exportHistory),
+		Name:      "export-history",
+		Usage:     "Export blockchain history into archive files",
+		ArgsUsage: "<dir> [<blockNumFirst> <blockNumLast>]",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.CacheFlag,
+		},
+		Category: "BLOCKCHAIN COMMANDS",
+		Description: `
+Writes the headers, bodies, receipts and total difficulties of the chain into
+era1 archive files in the given directory, one file per 8192 block epoch, along
+with a checksums.txt listing the sha256 digest of each file. Each archive ends
+with an offset index and an accumulator root committing to its block hashes and
+total difficulties. Optional second and third arguments control the first and
+last block to write, by default the whole chain is exported.`,
+	}
+	importHistoryCommand = cli.Command{
+		Action:    utils.MigrateFlags(importHistory),
+		Name:      "import-history",
+		Usage:     "Import blockchain history from archive files",
+		ArgsUsage: "<dir>",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.CacheFlag,
+			utils.GCModeFlag,
+			utils.CacheDatabaseFlag,
+			utils.CacheTrieFlag,
+			utils.CacheGCFlag,
+		},
+		Category: "BLOCKCHAIN COMMANDS",
+		Description: `
+Imports the era1 archive files of the given directory in epoch order. Every
+file is checked against checksums.txt, if present, and against its accumulator
+before its blocks are imported, and the total difficulty of its last block is
+compared with the imported chain afterwards.`,
+	}
+	verifyHistoryCommand = cli.Command{
+		Action:    utils.MigrateFlags(verifyHistory),
+		Name:      "verify-history",
+		Usage:     "Verify blockchain history archive files",
+		ArgsUsage: "<dir>",
+		Category:  "BLOCKCHAIN COMMANDS",
+		Description: `
+Checks the era1 archive files of the given directory against checksums.txt, if
+present, recomputes their accumulators, transaction and receipt roots, and
+checks that consecutive files link up. No database is opened.`,
 	}
 	copydbCommand = cli.Command{
 		Action:    utils.MigrateFlags(copyDb),
@@ -294,6 +382,79 @@ func exportChain(ctx *cli.Context) error {
 	return nil
 }
 
+func exportStateDiffs(ctx *cli.Context) error {
+	if len(ctx.Args()) < 1 {
+		utils.Fatalf("This command requires an argument.")
+	}
+	stack := makeFullNode(ctx)
+	chain, _ := utils.MakeChain(ctx, stack)
+	start := time.Now()
+
+	last := chain.CurrentBlock().NumberU64()
+	if ctx.IsSet(exportStateDiffsToFlag.Name) {
+		last = ctx.Uint64(exportStateDiffsToFlag.Name)
+	}
+	first := ctx.Uint64(exportStateDiffsFromFlag.Name)
+	if err := utils.ExportStateDiffs(chain, ctx.Args().First(), first, last, ctx.String(exportStateDiffsFormatFlag.Name)); err != nil {
+		utils.Fatalf("Export error: %v\n", err)
+	}
+	fmt.Printf("Export done in %v", time.Since(start))
+	return nil
+}
+
+func exportHistory(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 && len(ctx.Args()) != 3 {
+		utils.Fatalf("This command requires one or three arguments.")
+	}
+	stack := makeFullNode(ctx)
+	chain, _ := utils.MakeChain(ctx, stack)
+	start := time.Now()
+
+	first, last := uint64(0), chain.CurrentBlock().NumberU64()
+	if len(ctx.Args()) == 3 {
+		var ferr, lerr error
+		first, ferr = strconv.ParseUint(ctx.Args().Get(1), 10, 64)
+		last, lerr = strconv.ParseUint(ctx.Args().Get(2), 10, 64)
+		if ferr != nil || lerr != nil {
+			utils.Fatalf("Export error in parsing parameters: block number not an integer\n")
+		}
+	}
+	if err := utils.ExportHistory(chain, ctx.Args().First(), first, last); err != nil {
+		utils.Fatalf("Export error: %v\n", err)
+	}
+	fmt.Printf("Export done in %v", time.Since(start))
+	return nil
+}
+
+func importHistory(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		utils.Fatalf("This command requires an argument.")
+	}
+	stack := makeFullNode(ctx)
+	chain, chainDb := utils.MakeChain(ctx, stack)
+	defer chainDb.Close()
+	start := time.Now()
+
+	if err := utils.ImportHistory(chain, ctx.Args().First()); err != nil {
+		log.Error("Import error", "err", err)
+	}
+	chain.Stop()
+	fmt.Printf("Import done in %v.\n\n", time.Since(start))
+	return nil
+}
+
+func verifyHistory(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		utils.Fatalf("This command requires an argument.")
+	}
+	start := time.Now()
+	if err := utils.VerifyHistory(ctx.Args().First()); err != nil {
+		utils.Fatalf("Verification error: %v\n", err)
+	}
+	fmt.Printf("Verification done in %v\n", time.Since(start))
+	return nil
+}
+
 func copyDb(ctx *cli.Context) error {
 	// Ensure we have a source chain directory to copy
 	if len(ctx.Args()) != 1 {
@@ -32,6 +32,7 @@ import (
 	"github.com/naoina/toml"
 	"github.com/zeus-fyi/gochain/v4/cmd/utils"
 	"github.com/zeus-fyi/gochain/v4/eth"
+	"github.com/zeus-fyi/gochain/v4/log"
 	"github.com/zeus-fyi/gochain/v4/netstats"
 	"github.com/zeus-fyi/gochain/v4/node"
 	"github.com/zeus-fyi/gochain/v4/params"
@@ -169,6 +170,14 @@ func makeFullNode(ctx *cli.Context) *node.Node {
 		utils.RegisterShhService(stack, &cfg.Shh)
 	}
 
+	// Serve GraphQL next to the HTTP RPC APIs if requested.
+	if ctx.GlobalBool(utils.GraphQLEnabledFlag.Name) {
+		if cfg.Node.HTTPHost == "" {
+			log.Warn("GraphQL requires the HTTP-RPC server, enable it with --rpc")
+		}
+		utils.RegisterGraphQLService(stack, cfg.Eth.Logs)
+	}
+
 	// Add the GoChain Stats daemon if requested.
 	if cfg.Netstats.URL != "" {
 		utils.RegisterNetStatsService(stack, cfg.Netstats)
@@ -38,6 +38,7 @@ import (
 	"github.com/zeus-fyi/gochain/v4/eth"
 	"github.com/zeus-fyi/gochain/v4/goclient"
 	"github.com/zeus-fyi/gochain/v4/internal/debug"
+	"github.com/zeus-fyi/gochain/v4/internal/otlp"
 	"github.com/zeus-fyi/gochain/v4/log"
 	"github.com/zeus-fyi/gochain/v4/metrics"
 	"github.com/zeus-fyi/gochain/v4/node"
@@ -75,17 +76,35 @@ var (
 		utils.TxPoolAccountQueueFlag,
 		utils.TxPoolGlobalQueueFlag,
 		utils.TxPoolLifetimeFlag,
+		utils.TxPoolSenderRateFlag,
+		utils.TxPoolSenderBurstFlag,
+		utils.TxPoolContractRateFlag,
+		utils.TxPoolContractBurstFlag,
+		utils.TxPoolRecipientPriceLimitsFlag,
+		utils.TxPoolDenyListFlag,
+		utils.TxPoolSnapshotFlag,
+		utils.TxPoolSnapshotIntervalFlag,
+		utils.TxPoolSnapshotLimitFlag,
+		utils.TxPoolSnapshotMaxAgeFlag,
+		utils.TxPoolPrivatePeersFlag,
 		utils.FastSyncFlag,
 		utils.LightModeFlag,
 		utils.SyncModeFlag,
 		utils.GCModeFlag,
+		utils.SnapshotFlag,
+		utils.WitnessFlag,
+		utils.StateDiffsFlag,
+		utils.HistoryBlocksFlag,
+		utils.LogIndexFlag,
 		utils.LightServFlag,
 		utils.LightPeersFlag,
 		utils.LightKDFFlag,
 		utils.CacheFlag,
 		utils.CacheDatabaseFlag,
+		utils.CacheTrieFlag,
 		utils.CacheGCFlag,
 		utils.TrieCacheGenFlag,
+		utils.CacheNoPrefetchFlag,
 		utils.ListenPortFlag,
 		utils.MaxPeersFlag,
 		utils.MaxPendingPeersFlag,
@@ -123,6 +142,7 @@ var (
 		utils.NetStatsURLFlag,
 		utils.MetricsEnabledFlag,
 		utils.TracingStackdriverFlag,
+		utils.TracingOTLPFlag,
 		utils.TracingSampleRateFlag,
 		utils.FakePoWFlag,
 		utils.NoCompactionFlag,
@@ -141,11 +161,24 @@ var (
 		utils.RPCListenAddrFlag,
 		utils.RPCPortFlag,
 		utils.RPCApiFlag,
+		utils.GraphQLEnabledFlag,
 		utils.WSEnabledFlag,
 		utils.WSListenAddrFlag,
 		utils.WSPortFlag,
 		utils.WSApiFlag,
 		utils.WSAllowedOriginsFlag,
+		utils.RPCAuthJWTSecretFlag,
+		utils.RPCAuthAPIKeysFlag,
+		utils.RPCAuthAnonymousFlag,
+		utils.RPCBatchLimitFlag,
+		utils.RPCResponseLimitFlag,
+		utils.RPCRateLimitFlag,
+		utils.RPCRateBurstFlag,
+		utils.RPCMethodRatesFlag,
+		utils.RPCMethodTimeoutsFlag,
+		utils.RPCSlowCallFlag,
+		utils.RPCLogsLimitFlag,
+		utils.RPCLogsRangeFlag,
 		utils.IPCDisabledFlag,
 		utils.IPCPathFlag,
 	}
@@ -167,9 +200,15 @@ func init() {
 		initCommand,
 		importCommand,
 		exportCommand,
+		exportStateDiffsCommand,
+		exportHistoryCommand,
+		importHistoryCommand,
+		verifyHistoryCommand,
 		copydbCommand,
 		removedbCommand,
 		dumpCommand,
+		// See snapshotcmd.go:
+		snapshotCommand,
 		// See monitorcmd.go:
 		monitorCommand,
 		// See accountcmd.go:
@@ -223,6 +262,27 @@ func main() {
 // It creates a default node based on the command line arguments and runs it in
 // blocking mode, waiting for it to be shut down.
 func gochain(ctx *cli.Context) error {
+	stopTracing, err := setupTracing(ctx)
+	if err != nil {
+		return err
+	}
+	defer stopTracing()
+
+	node := makeFullNode(ctx)
+	startNode(ctx, node)
+	node.Wait()
+	return nil
+}
+
+// setupTracing registers the trace exporters enabled on the command line and
+// returns a function flushing them. Without any, tracing is a no-op.
+func setupTracing(ctx *cli.Context) (func(), error) {
+	var stops []func()
+	stop := func() {
+		for _, fn := range stops {
+			fn()
+		}
+	}
 	if ctx.GlobalIsSet(utils.TracingStackdriverFlag.Name) {
 		gcpProjectID := ctx.GlobalString(utils.TracingStackdriverFlag.Name)
 		// Enable the Stackdriver Tracing exporter.
@@ -230,23 +290,28 @@ func gochain(ctx *cli.Context) error {
 			ProjectID: gcpProjectID,
 		})
 		if err != nil {
-			return fmt.Errorf("failed to create the Stackdriver exporter: %v", err)
+			return nil, fmt.Errorf("failed to create the Stackdriver exporter: %v", err)
 		}
-		defer sd.Flush()
+		stops = append(stops, sd.Flush)
 
 		// Register/enable the trace exporter.
 		trace.RegisterExporter(sd)
-
-		if ctx.GlobalIsSet(utils.TracingSampleRateFlag.Name) {
-			rate := ctx.GlobalFloat64(utils.TracingSampleRateFlag.Name)
-			trace.ApplyConfig(trace.Config{DefaultSampler: trace.ProbabilitySampler(rate)})
+	}
+	if ctx.GlobalIsSet(utils.TracingOTLPFlag.Name) {
+		exp, err := otlp.NewExporter(otlp.Options{Endpoint: ctx.GlobalString(utils.TracingOTLPFlag.Name)})
+		if err != nil {
+			stop()
+			return nil, fmt.Errorf("failed to create the OTLP exporter: %v", err)
 		}
+		stops = append(stops, exp.Stop)
+		trace.RegisterExporter(exp)
+		log.Info("Exporting traces over OTLP", "url", ctx.GlobalString(utils.TracingOTLPFlag.Name))
 	}
-
-	node := makeFullNode(ctx)
-	startNode(ctx, node)
-	node.Wait()
-	return nil
+	if len(stops) > 0 && ctx.GlobalIsSet(utils.TracingSampleRateFlag.Name) {
+		rate := ctx.GlobalFloat64(utils.TracingSampleRateFlag.Name)
+		trace.ApplyConfig(trace.Config{DefaultSampler: trace.ProbabilitySampler(rate)})
+	}
+	return stop, nil
 }
 
 // startNode boots up the system node and all registered protocols, after which
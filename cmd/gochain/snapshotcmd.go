@@ -0,0 +1,118 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"github.com/urfave/cli"
+	"github.com/zeus-fyi/gochain/v4/cmd/utils"
+	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/core/rawdb"
+	"github.com/zeus-fyi/gochain/v4/core/state/pruner"
+	"github.com/zeus-fyi/gochain/v4/log"
+)
+
+var (
+	pruneStateRetainFlag = cli.Uint64Flag{
+		Name:  "retain",
+		Value: 128,
+		Usage: "Number of most recent block states to retain",
+	}
+	pruneStateBloomSizeFlag = cli.Uint64Flag{
+		Name:  "bloomfilter.size",
+		Value: 2048,
+		Usage: "Megabytes of memory allocated to the bloom filter marking retained state",
+	}
+	snapshotCommand = cli.Command{
+		Name:     "snapshot",
+		Usage:    "Manage the state database",
+		Category: "BLOCKCHAIN COMMANDS",
+		Subcommands: []cli.Command{
+			{
+				Action:    utils.MigrateFlags(pruneState),
+				Name:      "prune-state",
+				Usage:     "Delete state data not reachable from recent blocks",
+				ArgsUsage: "[<root>]",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.CacheFlag,
+					utils.CacheDatabaseFlag,
+					pruneStateRetainFlag,
+					pruneStateBloomSizeFlag,
+				},
+				Description: `
+gochain snapshot prune-state [<root>]
+
+Deletes all trie and code nodes which are not reachable from the given state
+root, defaulting to the head block's, or from the states of the most recent
+blocks, reclaiming the space left behind by archive mode or unclean shutdowns.
+The node must be stopped.
+
+Retained nodes are marked in a bloom filter, which is persisted in the data
+directory before anything is deleted. If interrupted after that, running the
+command again, or starting the node, completes the pruning.`,
+			},
+		},
+	}
+)
+
+// pruneState deletes all state not reachable from the retained roots, or
+// completes an interrupted run.
+func pruneState(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	chainDb := utils.MakeChainDatabase(ctx, stack)
+	defer chainDb.Close()
+
+	bloomPath := stack.ResolvePath(pruner.BloomFileName)
+	if resumed, err := pruner.RecoverPruning(chainDb, bloomPath); err != nil {
+		utils.Fatalf("Failed to resume state pruning: %v", err)
+	} else if resumed {
+		log.Info("Completed interrupted state pruning")
+		return nil
+	}
+	if ctx.NArg() > 1 {
+		utils.Fatalf("Too many arguments given")
+	}
+	var root common.Hash
+	if ctx.NArg() == 1 {
+		if !hashish(ctx.Args().First()) {
+			utils.Fatalf("Invalid state root: %s", ctx.Args().First())
+		}
+		root = common.HexToHash(ctx.Args().First())
+	} else {
+		head := rawdb.ReadHeadBlockHash(chainDb.GlobalTable())
+		number := rawdb.ReadHeaderNumber(chainDb.GlobalTable(), head)
+		if number == nil {
+			utils.Fatalf("Head block missing")
+		}
+		header := rawdb.ReadHeader(chainDb.HeaderTable(), head, *number)
+		if header == nil {
+			utils.Fatalf("Head header %x missing", head)
+		}
+		root = header.Root
+	}
+	roots, err := pruner.RetainedRoots(chainDb, root, ctx.Uint64(pruneStateRetainFlag.Name))
+	if err != nil {
+		utils.Fatalf("Failed to select state roots: %v", err)
+	}
+	log.Info("Pruning state", "root", root, "retained", len(roots))
+
+	p := pruner.NewPruner(chainDb, bloomPath, ctx.Uint64(pruneStateBloomSizeFlag.Name)*1024*1024)
+	if err := p.Prune(roots); err != nil {
+		utils.Fatalf("Failed to prune state: %v", err)
+	}
+	return nil
+}
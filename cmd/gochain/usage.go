@@ -73,6 +73,11 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.TestnetFlag,
 			utils.SyncModeFlag,
 			utils.GCModeFlag,
+			utils.SnapshotFlag,
+			utils.WitnessFlag,
+			utils.StateDiffsFlag,
+			utils.HistoryBlocksFlag,
+			utils.LogIndexFlag,
 			utils.NetStatsURLFlag,
 			utils.IdentityFlag,
 			utils.LightServFlag,
@@ -116,6 +121,17 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.TxPoolAccountQueueFlag,
 			utils.TxPoolGlobalQueueFlag,
 			utils.TxPoolLifetimeFlag,
+			utils.TxPoolSenderRateFlag,
+			utils.TxPoolSenderBurstFlag,
+			utils.TxPoolContractRateFlag,
+			utils.TxPoolContractBurstFlag,
+			utils.TxPoolRecipientPriceLimitsFlag,
+			utils.TxPoolDenyListFlag,
+			utils.TxPoolSnapshotFlag,
+			utils.TxPoolSnapshotIntervalFlag,
+			utils.TxPoolSnapshotLimitFlag,
+			utils.TxPoolSnapshotMaxAgeFlag,
+			utils.TxPoolPrivatePeersFlag,
 		},
 	},
 	{
@@ -123,8 +139,10 @@ var AppHelpFlagGroups = []flagGroup{
 		Flags: []cli.Flag{
 			utils.CacheFlag,
 			utils.CacheDatabaseFlag,
+			utils.CacheTrieFlag,
 			utils.CacheGCFlag,
 			utils.TrieCacheGenFlag,
+			utils.CacheNoPrefetchFlag,
 		},
 	},
 	{
@@ -141,11 +159,24 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.RPCListenAddrFlag,
 			utils.RPCPortFlag,
 			utils.RPCApiFlag,
+			utils.GraphQLEnabledFlag,
 			utils.WSEnabledFlag,
 			utils.WSListenAddrFlag,
 			utils.WSPortFlag,
 			utils.WSApiFlag,
 			utils.WSAllowedOriginsFlag,
+			utils.RPCAuthJWTSecretFlag,
+			utils.RPCAuthAPIKeysFlag,
+			utils.RPCAuthAnonymousFlag,
+			utils.RPCBatchLimitFlag,
+			utils.RPCResponseLimitFlag,
+			utils.RPCRateLimitFlag,
+			utils.RPCRateBurstFlag,
+			utils.RPCMethodRatesFlag,
+			utils.RPCMethodTimeoutsFlag,
+			utils.RPCSlowCallFlag,
+			utils.RPCLogsLimitFlag,
+			utils.RPCLogsRangeFlag,
 			utils.IPCDisabledFlag,
 			utils.IPCPathFlag,
 			utils.RPCCORSDomainFlag,
@@ -205,6 +236,7 @@ var AppHelpFlagGroups = []flagGroup{
 		Flags: append([]cli.Flag{
 			utils.MetricsEnabledFlag,
 			utils.TracingStackdriverFlag,
+			utils.TracingOTLPFlag,
 			utils.TracingSampleRateFlag,
 			utils.FakePoWFlag,
 			utils.NoCompactionFlag,
@@ -20,17 +20,22 @@ package utils
 import (
 	"compress/gzip"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"syscall"
+	"time"
 
+	"github.com/zeus-fyi/gochain/v4/common"
 	"github.com/zeus-fyi/gochain/v4/core"
 	"github.com/zeus-fyi/gochain/v4/core/types"
 	"github.com/zeus-fyi/gochain/v4/internal/debug"
+	"github.com/zeus-fyi/gochain/v4/internal/era"
 	"github.com/zeus-fyi/gochain/v4/log"
 	"github.com/zeus-fyi/gochain/v4/node"
 	"github.com/zeus-fyi/gochain/v4/rlp"
@@ -82,14 +87,12 @@ func StartNode(stack *node.Node) {
 	}()
 }
 
-func ImportChain(ctx context.Context, chain *core.BlockChain, fn string) error {
-	// Watch for Ctrl-C while the import is running.
-	// If a signal is received, the import will stop at the next batch.
+// watchInterrupt watches for Ctrl-C while an import is running, returning a
+// check reporting whether one was received and a function to stop watching.
+func watchInterrupt() (func() bool, func()) {
 	interrupt := make(chan os.Signal, 1)
 	stop := make(chan struct{})
 	signal.Notify(interrupt, syscall.SIGINT, syscall.SIGTERM)
-	defer signal.Stop(interrupt)
-	defer close(interrupt)
 	go func() {
 		if _, ok := <-interrupt; ok {
 			log.Info("Interrupted during import, stopping at next batch")
@@ -104,6 +107,17 @@ func ImportChain(ctx context.Context, chain *core.BlockChain, fn string) error {
 			return false
 		}
 	}
+	return checkInterrupt, func() {
+		signal.Stop(interrupt)
+		close(interrupt)
+	}
+}
+
+func ImportChain(ctx context.Context, chain *core.BlockChain, fn string) error {
+	// Watch for Ctrl-C while the import is running.
+	// If a signal is received, the import will stop at the next batch.
+	checkInterrupt, unwatch := watchInterrupt()
+	defer unwatch()
 
 	log.Info("Importing blockchain", "file", fn)
 	fh, err := os.Open(fn)
@@ -224,3 +238,225 @@ func ExportAppendChain(blockchain *core.BlockChain, fn string, first uint64, las
 	log.Info("Exported blockchain to", "file", fn)
 	return nil
 }
+
+// ExportStateDiffs streams the state diffs of the given block range to a file,
+// as JSON lines or concatenated RLP depending on format. Diffs not stored in
+// the database are regenerated by re-executing their blocks.
+func ExportStateDiffs(blockchain *core.BlockChain, fn string, first, last uint64, format string) error {
+	if first > last {
+		return fmt.Errorf("export failed: first (%d) is greater than last (%d)", first, last)
+	}
+	var encode func(io.Writer, *types.StateDiff) error
+	switch format {
+	case "json":
+		encode = func(w io.Writer, diff *types.StateDiff) error { return json.NewEncoder(w).Encode(diff) }
+	case "rlp":
+		encode = func(w io.Writer, diff *types.StateDiff) error { return rlp.Encode(w, diff) }
+	default:
+		return fmt.Errorf("unknown state diff format %q", format)
+	}
+	log.Info("Exporting state diffs", "file", fn, "count", last-first+1)
+
+	fh, err := os.OpenFile(fn, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	var writer io.Writer = fh
+	if strings.HasSuffix(fn, ".gz") {
+		writer = gzip.NewWriter(writer)
+		defer writer.(*gzip.Writer).Close()
+	}
+	start, reported := time.Now(), time.Now()
+	for nr := first; nr <= last; nr++ {
+		block := blockchain.GetBlockByNumber(nr)
+		if block == nil {
+			return fmt.Errorf("export failed on #%d: not found", nr)
+		}
+		diff, err := blockchain.GetStateDiff(block)
+		if err != nil {
+			return fmt.Errorf("export failed on #%d: %v", nr, err)
+		}
+		if err := encode(writer, diff); err != nil {
+			return err
+		}
+		if time.Since(reported) >= 8*time.Second {
+			log.Info("Exporting state diffs", "exported", nr-first+1, "elapsed", common.PrettyDuration(time.Since(start)))
+			reported = time.Now()
+		}
+	}
+	log.Info("Exported state diffs to", "file", fn)
+	return nil
+}
+
+// ExportHistory writes the given block range of the chain into history
+// archives in dir, one per 8192 block epoch.
+func ExportHistory(blockchain *core.BlockChain, dir string, first, last uint64) error {
+	log.Info("Exporting history", "dir", dir, "first", first, "last", last)
+	paths, err := era.Export(blockchain, dir, era.NetworkName(blockchain.Config().ChainId), first, last)
+	if err != nil {
+		return err
+	}
+	log.Info("Exported history", "dir", dir, "files", len(paths))
+	return nil
+}
+
+// ImportHistory imports the history archives of dir into the chain. Every
+// archive is checked against the directory checksums and its accumulator
+// before any of its blocks are inserted.
+func ImportHistory(chain *core.BlockChain, dir string) error {
+	// Watch for Ctrl-C while the import is running.
+	// If a signal is received, the import will stop at the next batch.
+	checkInterrupt, unwatch := watchInterrupt()
+	defer unwatch()
+
+	files, err := era.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no history archives in %s", dir)
+	}
+	sums, err := era.ReadChecksums(dir)
+	if err != nil {
+		return err
+	}
+	log.Info("Importing history", "dir", dir, "files", len(files))
+	for _, path := range files {
+		if err := importHistoryFile(chain, path, sums, checkInterrupt); err != nil {
+			return fmt.Errorf("%s: %v", filepath.Base(path), err)
+		}
+	}
+	return nil
+}
+
+func importHistoryFile(chain *core.BlockChain, path string, sums map[string]string, checkInterrupt func() bool) error {
+	if err := era.VerifyChecksum(path, sums); err != nil {
+		return err
+	}
+	archive, err := era.Open(path)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	root, err := archive.Verify()
+	if err != nil {
+		return err
+	}
+	log.Info("Importing history archive", "file", filepath.Base(path), "first", archive.Start(), "count", archive.Count(), "accumulator", root)
+
+	var (
+		first = archive.Start()
+		end   = first + archive.Count()
+	)
+	for from := first; from < end; from += importBatchSize {
+		if checkInterrupt() {
+			return fmt.Errorf("interrupted")
+		}
+		to := from + importBatchSize
+		if to > end {
+			to = end
+		}
+		blocks := make([]*types.Block, 0, to-from)
+		for nr := from; nr < to; nr++ {
+			block, err := archive.GetBlockByNumber(nr)
+			if err != nil {
+				return err
+			}
+			// don't import the genesis block, but make sure it's ours
+			if nr == 0 {
+				if block.Hash() != chain.Genesis().Hash() {
+					return fmt.Errorf("genesis mismatch: have %x, want %x", block.Hash(), chain.Genesis().Hash())
+				}
+				continue
+			}
+			blocks = append(blocks, block)
+		}
+		missing := missingBlocks(chain, blocks)
+		if len(missing) == 0 {
+			continue
+		}
+		if n, err := chain.InsertChain(missing); err != nil {
+			return fmt.Errorf("invalid block %d: %v", missing[n].NumberU64(), err)
+		}
+	}
+	// Total difficulty depends on the blocks preceding the archive, so only
+	// now can the stored one be checked against the imported chain.
+	last := end - 1
+	header, err := archive.GetHeaderByNumber(last)
+	if err != nil {
+		return err
+	}
+	td, err := archive.GetTD(last)
+	if err != nil {
+		return err
+	}
+	if have := chain.GetTd(header.Hash(), last); have == nil || have.Cmp(td) != 0 {
+		return fmt.Errorf("total difficulty mismatch at #%d: have %v, want %v", last, have, td)
+	}
+	return nil
+}
+
+// VerifyHistory checks the history archives of dir against the directory
+// checksums and their accumulators, and checks that consecutive archives
+// link up.
+func VerifyHistory(dir string) error {
+	files, err := era.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no history archives in %s", dir)
+	}
+	sums, err := era.ReadChecksums(dir)
+	if err != nil {
+		return err
+	}
+	var prev *types.Header
+	for _, path := range files {
+		header, err := verifyHistoryFile(path, sums, prev)
+		if err != nil {
+			return fmt.Errorf("%s: %v", filepath.Base(path), err)
+		}
+		prev = header
+	}
+	return nil
+}
+
+// verifyHistoryFile verifies a single archive following the one ending with
+// prev, returning the header of its last block.
+func verifyHistoryFile(path string, sums map[string]string, prev *types.Header) (*types.Header, error) {
+	if err := era.VerifyChecksum(path, sums); err != nil {
+		return nil, err
+	}
+	archive, err := era.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	root, err := archive.Verify()
+	if err != nil {
+		return nil, err
+	}
+	first, err := archive.GetHeaderByNumber(archive.Start())
+	if err != nil {
+		return nil, err
+	}
+	if prev != nil {
+		if first.Number.Uint64() != prev.Number.Uint64()+1 {
+			return nil, fmt.Errorf("gap after block #%d, archive starts at #%d", prev.Number, first.Number)
+		}
+		if first.ParentHash != prev.Hash() {
+			return nil, fmt.Errorf("block #%d does not extend previous archive", first.Number)
+		}
+	}
+	last, err := archive.GetHeaderByNumber(archive.Start() + archive.Count() - 1)
+	if err != nil {
+		return nil, err
+	}
+	log.Info("Verified history archive", "file", filepath.Base(path), "first", archive.Start(), "count", archive.Count(), "accumulator", root)
+	return last, nil
+}
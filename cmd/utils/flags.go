@@ -21,6 +21,8 @@ import (
 	"bytes"
 	"context"
 	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"math/big"
@@ -28,6 +30,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/urfave/cli"
 	"github.com/zeus-fyi/gochain/v4/accounts"
@@ -43,8 +46,10 @@ import (
 	"github.com/zeus-fyi/gochain/v4/crypto"
 	"github.com/zeus-fyi/gochain/v4/eth"
 	"github.com/zeus-fyi/gochain/v4/eth/downloader"
+	"github.com/zeus-fyi/gochain/v4/eth/filters"
 	"github.com/zeus-fyi/gochain/v4/eth/gasprice"
 	"github.com/zeus-fyi/gochain/v4/ethdb"
+	"github.com/zeus-fyi/gochain/v4/graphql"
 	"github.com/zeus-fyi/gochain/v4/les"
 	"github.com/zeus-fyi/gochain/v4/log"
 	"github.com/zeus-fyi/gochain/v4/metrics"
@@ -175,7 +180,7 @@ var (
 	defaultSyncMode = eth.DefaultConfig.SyncMode
 	SyncModeFlag    = TextMarshalerFlag{
 		Name:  "syncmode",
-		Usage: `Blockchain sync mode ("fast", "full", or "light")`,
+		Usage: `Blockchain sync mode ("fast", "full", "light" or "snap")`,
 		Value: &defaultSyncMode,
 	}
 	GCModeFlag = cli.StringFlag{
@@ -183,6 +188,26 @@ var (
 		Usage: `Blockchain garbage collection mode ("full", "archive")`,
 		Value: "full",
 	}
+	SnapshotFlag = cli.BoolFlag{
+		Name:  "snapshot",
+		Usage: "Maintain a flat state snapshot for faster state reads (generated in the background)",
+	}
+	WitnessFlag = cli.BoolFlag{
+		Name:  "witness",
+		Usage: "Record and store the execution witness of every imported block",
+	}
+	StateDiffsFlag = cli.BoolFlag{
+		Name:  "statediffs",
+		Usage: "Record and store the account and storage changes of every imported block",
+	}
+	HistoryBlocksFlag = cli.Uint64Flag{
+		Name:  "history.blocks",
+		Usage: "Number of recent blocks whose state stays readable through stored reverse diffs (0 = disabled)",
+	}
+	LogIndexFlag = cli.BoolFlag{
+		Name:  "logindex",
+		Usage: "Build an exact index of log addresses and topics for fast eth_getLogs over long ranges",
+	}
 	LightServFlag = cli.IntFlag{
 		Name:  "lightserv",
 		Usage: "Maximum percentage of time allowed for serving LES requests (0-90)",
@@ -251,6 +276,61 @@ var (
 		Usage: "Maximum amount of time non-executable transaction are queued",
 		Value: eth.DefaultConfig.TxPool.Lifetime,
 	}
+	TxPoolSenderRateFlag = cli.Float64Flag{
+		Name:  "txpool.senderrate",
+		Usage: "Remote transactions admitted per second per sender (0 = unlimited)",
+		Value: eth.DefaultConfig.TxPool.SenderRate,
+	}
+	TxPoolSenderBurstFlag = cli.Uint64Flag{
+		Name:  "txpool.senderburst",
+		Usage: "Remote transactions a sender may submit in a burst",
+		Value: eth.DefaultConfig.TxPool.SenderBurst,
+	}
+	TxPoolContractRateFlag = cli.Float64Flag{
+		Name:  "txpool.contractrate",
+		Usage: "Remote transactions admitted per second per recipient contract (0 = unlimited)",
+		Value: eth.DefaultConfig.TxPool.ContractRate,
+	}
+	TxPoolContractBurstFlag = cli.Uint64Flag{
+		Name:  "txpool.contractburst",
+		Usage: "Remote transactions a recipient contract may receive in a burst",
+		Value: eth.DefaultConfig.TxPool.ContractBurst,
+	}
+	TxPoolRecipientPriceLimitsFlag = cli.StringFlag{
+		Name:  "txpool.recipientpricelimits",
+		Usage: "Comma separated address=price minimum gas prices of remote transactions per recipient",
+		Value: "",
+	}
+	TxPoolDenyListFlag = cli.StringFlag{
+		Name:  "txpool.denylist",
+		Usage: "File of addresses, one per line, whose transactions are rejected (reload with admin.reloadTxPoolDenyList)",
+		Value: eth.DefaultConfig.TxPool.DenyList,
+	}
+	TxPoolSnapshotFlag = cli.StringFlag{
+		Name:  "txpool.snapshot",
+		Usage: "Disk snapshot of remote transactions to survive node restarts (empty = disabled)",
+		Value: core.DefaultTxPoolConfig.Snapshot,
+	}
+	TxPoolSnapshotIntervalFlag = cli.DurationFlag{
+		Name:  "txpool.snapshotinterval",
+		Usage: "Time interval to regenerate the remote transaction snapshot",
+		Value: core.DefaultTxPoolConfig.SnapshotInterval,
+	}
+	TxPoolSnapshotLimitFlag = cli.Uint64Flag{
+		Name:  "txpool.snapshotlimit",
+		Usage: "Maximum number of remote transactions to snapshot",
+		Value: core.DefaultTxPoolConfig.SnapshotLimit,
+	}
+	TxPoolSnapshotMaxAgeFlag = cli.DurationFlag{
+		Name:  "txpool.snapshotmaxage",
+		Usage: "Maximum age of snapshotted remote transactions to reinject on startup",
+		Value: core.DefaultTxPoolConfig.SnapshotMaxAge,
+	}
+	TxPoolPrivatePeersFlag = cli.StringFlag{
+		Name:  "txpool.privatepeers",
+		Usage: "Comma separated enode URLs of trusted signer peers to exchange private transactions with",
+		Value: "",
+	}
 	// Performance tuning settings
 	CacheFlag = cli.IntFlag{
 		Name:  "cache",
@@ -262,6 +342,11 @@ var (
 		Usage: "Percentage of cache memory allowance to use for database io",
 		Value: 75,
 	}
+	CacheTrieFlag = cli.IntFlag{
+		Name:  "cache.trie",
+		Usage: "Percentage of cache memory allowance to use for trie caching (0 = disabled)",
+		Value: 0,
+	}
 	CacheGCFlag = cli.IntFlag{
 		Name:  "cache.gc",
 		Usage: "Percentage of cache memory allowance to use for trie pruning",
@@ -272,6 +357,10 @@ var (
 		Usage: "Number of trie node generations to keep in memory",
 		Value: int(state.MaxTrieCacheGen),
 	}
+	CacheNoPrefetchFlag = cli.BoolFlag{
+		Name:  "cache.noprefetch",
+		Usage: "Disable speculative execution of the next block to warm the caches during import",
+	}
 	// Miner settings
 	MiningEnabledFlag = cli.BoolFlag{
 		Name:  "mine",
@@ -372,6 +461,10 @@ var (
 		Name:  "tracing.stackdriver",
 		Usage: "GCP Project ID to enable stackdriver tracing",
 	}
+	TracingOTLPFlag = cli.StringFlag{
+		Name:  "tracing.otlp",
+		Usage: "URL of an OpenTelemetry collector to export traces to over OTLP/HTTP (e.g. http://localhost:4318)",
+	}
 	TracingSampleRateFlag = cli.Float64Flag{
 		Name:  "tracing.samplerate",
 		Usage: "Tracing sample rate",
@@ -414,6 +507,10 @@ var (
 		Usage: "API's offered over the HTTP-RPC interface",
 		Value: "",
 	}
+	GraphQLEnabledFlag = cli.BoolFlag{
+		Name:  "graphql",
+		Usage: "Enable GraphQL on the HTTP-RPC server, under /graphql (requires --rpc)",
+	}
 	IPCDisabledFlag = cli.BoolFlag{
 		Name:  "ipcdisable",
 		Usage: "Disable the IPC-RPC server",
@@ -446,6 +543,59 @@ var (
 		Usage: "Origins from which to accept websockets requests",
 		Value: "",
 	}
+	RPCAuthJWTSecretFlag = cli.StringFlag{
+		Name:  "rpcauth.jwtsecret",
+		Usage: "File holding the hex encoded secret of HS256 bearer tokens accepted by the HTTP-RPC and WS-RPC interfaces",
+	}
+	RPCAuthAPIKeysFlag = cli.StringFlag{
+		Name:  "rpcauth.apikeys",
+		Usage: `JSON file mapping API keys to the namespaces and methods they may call (e.g. {"key": ["eth", "admin_peers"]})`,
+	}
+	RPCAuthAnonymousFlag = cli.StringFlag{
+		Name:  "rpcauth.anonymous",
+		Usage: "Comma separated namespaces and methods callers without credentials may call when authentication is enabled (default: none)",
+	}
+	RPCBatchLimitFlag = cli.IntFlag{
+		Name:  "rpc.batchlimit",
+		Usage: "Maximum number of calls in an HTTP-RPC or WS-RPC batch request (0 = unlimited)",
+		Value: node.DefaultConfig.RPCLimits.BatchItems,
+	}
+	RPCResponseLimitFlag = cli.IntFlag{
+		Name:  "rpc.responselimit",
+		Usage: "Maximum size in bytes of the results of an HTTP-RPC or WS-RPC call or batch (0 = unlimited)",
+		Value: node.DefaultConfig.RPCLimits.ResponseBytes,
+	}
+	RPCRateLimitFlag = cli.Float64Flag{
+		Name:  "rpc.ratelimit",
+		Usage: "Calls per second a client IP may make of each HTTP-RPC or WS-RPC method (0 = unlimited)",
+	}
+	RPCRateBurstFlag = cli.IntFlag{
+		Name:  "rpc.rateburst",
+		Usage: "Calls a client IP may make of each HTTP-RPC or WS-RPC method at once",
+		Value: 10,
+	}
+	RPCMethodRatesFlag = cli.StringFlag{
+		Name:  "rpc.methodrates",
+		Usage: "Comma separated per-method overrides of --rpc.ratelimit (e.g. eth_getLogs=1,eth_call=50)",
+	}
+	RPCMethodTimeoutsFlag = cli.StringFlag{
+		Name:  "rpc.methodtimeouts",
+		Usage: "Comma separated per-method execution time limits (e.g. eth_getLogs=10s,eth_call=5s)",
+	}
+	RPCSlowCallFlag = cli.DurationFlag{
+		Name:  "rpc.slowcall",
+		Usage: "Log the method, parameters and duration of RPC calls taking longer than this (0 = disabled)",
+	}
+	RPCLogsLimitFlag = cli.IntFlag{
+		Name:  "rpc.logslimit",
+		Usage: "Maximum number of logs returned by eth_getLogs and eth_getFilterLogs (0 = unlimited)",
+		Value: eth.DefaultConfig.Logs.MaxResults,
+	}
+	RPCLogsRangeFlag = cli.Uint64Flag{
+		Name:  "rpc.logsrange",
+		Usage: "Maximum number of blocks searched by eth_getLogs and eth_getFilterLogs (0 = unlimited)",
+		Value: eth.DefaultConfig.Logs.MaxBlockRange,
+	}
 	ExecFlag = cli.StringFlag{
 		Name:  "exec",
 		Usage: "Execute JavaScript statement",
@@ -655,6 +805,24 @@ func setBootstrapNodes(ctx *cli.Context, cfg *p2p.Config) {
 	}
 }
 
+// setPrivateTxPeers retrieves the peers private transactions may be forwarded
+// to from the command line flags.
+func setPrivateTxPeers(ctx *cli.Context, cfg *eth.Config) {
+	if !ctx.GlobalIsSet(TxPoolPrivatePeersFlag.Name) {
+		return
+	}
+	for _, url := range strings.Split(ctx.GlobalString(TxPoolPrivatePeersFlag.Name), ",") {
+		if url = strings.TrimSpace(url); url == "" {
+			continue
+		}
+		node, err := discover.ParseNode(url)
+		if err != nil {
+			Fatalf("Invalid enode in --%s: %s: %v", TxPoolPrivatePeersFlag.Name, url, err)
+		}
+		cfg.PrivateTxPeers = append(cfg.PrivateTxPeers, node.ID)
+	}
+}
+
 // setListenAddress creates a TCP listening address string from set command
 // line flags.
 func setListenAddress(ctx *cli.Context, cfg *p2p.Config) {
@@ -707,7 +875,7 @@ func setHTTP(ctx *cli.Context, cfg *node.Config) {
 	}
 
 	cfg.HTTPVirtualHosts = splitAndTrim(ctx.GlobalString(RPCVirtualHostsFlag.Name))
-	cfg.HTTPTracing = ctx.GlobalIsSet(TracingStackdriverFlag.Name)
+	cfg.HTTPTracing = ctx.GlobalIsSet(TracingStackdriverFlag.Name) || ctx.GlobalIsSet(TracingOTLPFlag.Name)
 }
 
 // setWS creates the WebSocket RPC listener interface string from the set
@@ -735,6 +903,86 @@ func setWS(ctx *cli.Context, cfg *node.Config) {
 	}
 }
 
+// setRPCAuth configures the authentication of the HTTP and WebSocket RPC
+// endpoints from the set command line flags.
+func setRPCAuth(ctx *cli.Context, cfg *node.Config) {
+	if ctx.GlobalIsSet(RPCAuthJWTSecretFlag.Name) {
+		cfg.RPCAuth.JWTSecret = ctx.GlobalString(RPCAuthJWTSecretFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCAuthAPIKeysFlag.Name) {
+		file := ctx.GlobalString(RPCAuthAPIKeysFlag.Name)
+		blob, err := ioutil.ReadFile(file)
+		if err != nil {
+			Fatalf("Failed to read API keys file %s: %v", file, err)
+		}
+		keys := make(map[string][]string)
+		if err := json.Unmarshal(blob, &keys); err != nil {
+			Fatalf("Invalid API keys file %s: %v", file, err)
+		}
+		cfg.RPCAuth.APIKeys = keys
+	}
+	if ctx.GlobalIsSet(RPCAuthAnonymousFlag.Name) {
+		cfg.RPCAuth.Anonymous = splitAndTrim(ctx.GlobalString(RPCAuthAnonymousFlag.Name))
+	}
+}
+
+// setRPCLimits configures the limits and slow call logging of the RPC endpoints
+// from the set command line flags.
+func setRPCLimits(ctx *cli.Context, cfg *node.Config) {
+	if ctx.GlobalIsSet(RPCBatchLimitFlag.Name) {
+		cfg.RPCLimits.BatchItems = ctx.GlobalInt(RPCBatchLimitFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCResponseLimitFlag.Name) {
+		cfg.RPCLimits.ResponseBytes = ctx.GlobalInt(RPCResponseLimitFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCRateLimitFlag.Name) {
+		cfg.RPCLimits.RateLimit = ctx.GlobalFloat64(RPCRateLimitFlag.Name)
+		cfg.RPCLimits.RateBurst = ctx.GlobalInt(RPCRateBurstFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCMethodRatesFlag.Name) {
+		cfg.RPCLimits.MethodRates = make(map[string]float64)
+		for method, value := range splitMethodValues(RPCMethodRatesFlag.Name, ctx.GlobalString(RPCMethodRatesFlag.Name)) {
+			rate, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				Fatalf("Invalid rate for %s in --%s: %v", method, RPCMethodRatesFlag.Name, err)
+			}
+			cfg.RPCLimits.MethodRates[method] = rate
+		}
+		if !ctx.GlobalIsSet(RPCRateLimitFlag.Name) {
+			cfg.RPCLimits.RateBurst = ctx.GlobalInt(RPCRateBurstFlag.Name)
+		}
+	}
+	if ctx.GlobalIsSet(RPCMethodTimeoutsFlag.Name) {
+		cfg.RPCLimits.MethodTimeouts = make(map[string]time.Duration)
+		for method, value := range splitMethodValues(RPCMethodTimeoutsFlag.Name, ctx.GlobalString(RPCMethodTimeoutsFlag.Name)) {
+			timeout, err := time.ParseDuration(value)
+			if err != nil {
+				Fatalf("Invalid timeout for %s in --%s: %v", method, RPCMethodTimeoutsFlag.Name, err)
+			}
+			cfg.RPCLimits.MethodTimeouts[method] = timeout
+		}
+	}
+	if ctx.GlobalIsSet(RPCSlowCallFlag.Name) {
+		cfg.RPCSlowCallThreshold = ctx.GlobalDuration(RPCSlowCallFlag.Name)
+	}
+}
+
+// splitMethodValues parses a comma separated list of method=value pairs.
+func splitMethodValues(flag, input string) map[string]string {
+	values := make(map[string]string)
+	for _, entry := range splitAndTrim(input) {
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			Fatalf("Invalid entry %q in --%s, want method=value", entry, flag)
+		}
+		values[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return values
+}
+
 // setIPC creates an IPC path configuration from the set command line flags,
 // returning an empty string if IPC was explicitly disabled, or the set path.
 func setIPC(ctx *cli.Context, cfg *node.Config) {
@@ -898,6 +1146,8 @@ func SetNodeConfig(ctx *cli.Context, cfg *node.Config) {
 	setIPC(ctx, cfg)
 	setHTTP(ctx, cfg)
 	setWS(ctx, cfg)
+	setRPCAuth(ctx, cfg)
+	setRPCLimits(ctx, cfg)
 	setNodeUserIdent(ctx, cfg)
 	setEthdb(ctx, &cfg.Ethdb)
 
@@ -976,6 +1226,50 @@ func setTxPool(ctx *cli.Context, cfg *core.TxPoolConfig) {
 	if ctx.GlobalIsSet(TxPoolLifetimeFlag.Name) {
 		cfg.Lifetime = ctx.GlobalDuration(TxPoolLifetimeFlag.Name)
 	}
+	if ctx.GlobalIsSet(TxPoolSenderRateFlag.Name) {
+		cfg.SenderRate = ctx.GlobalFloat64(TxPoolSenderRateFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolSenderBurstFlag.Name) {
+		cfg.SenderBurst = ctx.GlobalUint64(TxPoolSenderBurstFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolContractRateFlag.Name) {
+		cfg.ContractRate = ctx.GlobalFloat64(TxPoolContractRateFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolContractBurstFlag.Name) {
+		cfg.ContractBurst = ctx.GlobalUint64(TxPoolContractBurstFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolRecipientPriceLimitsFlag.Name) {
+		cfg.RecipientPriceLimits = make(map[common.Address]uint64)
+		for _, limit := range strings.Split(ctx.GlobalString(TxPoolRecipientPriceLimitsFlag.Name), ",") {
+			if limit = strings.TrimSpace(limit); limit == "" {
+				continue
+			}
+			parts := strings.SplitN(limit, "=", 2)
+			if len(parts) != 2 || !common.IsHexAddress(parts[0]) {
+				Fatalf("Invalid limit in --%s: %s", TxPoolRecipientPriceLimitsFlag.Name, limit)
+			}
+			price, err := strconv.ParseUint(parts[1], 10, 64)
+			if err != nil {
+				Fatalf("Invalid price in --%s: %s: %v", TxPoolRecipientPriceLimitsFlag.Name, limit, err)
+			}
+			cfg.RecipientPriceLimits[common.HexToAddress(parts[0])] = price
+		}
+	}
+	if ctx.GlobalIsSet(TxPoolDenyListFlag.Name) {
+		cfg.DenyList = ctx.GlobalString(TxPoolDenyListFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolSnapshotFlag.Name) {
+		cfg.Snapshot = ctx.GlobalString(TxPoolSnapshotFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolSnapshotIntervalFlag.Name) {
+		cfg.SnapshotInterval = ctx.GlobalDuration(TxPoolSnapshotIntervalFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolSnapshotLimitFlag.Name) {
+		cfg.SnapshotLimit = ctx.GlobalUint64(TxPoolSnapshotLimitFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolSnapshotMaxAgeFlag.Name) {
+		cfg.SnapshotMaxAge = ctx.GlobalDuration(TxPoolSnapshotMaxAgeFlag.Name)
+	}
 }
 
 func setEthdb(ctx *cli.Context, cfg *ethdb.Config) {
@@ -1059,6 +1353,7 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 	setEtherbase(ctx, ks, cfg)
 	setGPO(ctx, &cfg.GPO)
 	setTxPool(ctx, &cfg.TxPool)
+	setPrivateTxPeers(ctx, cfg)
 
 	switch {
 	case ctx.GlobalIsSet(SyncModeFlag.Name):
@@ -1087,7 +1382,22 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 		Fatalf("--%s must be either 'full' or 'archive'", GCModeFlag.Name)
 	}
 	cfg.NoPruning = ctx.GlobalString(GCModeFlag.Name) == "archive"
+	cfg.Snapshot = ctx.GlobalBool(SnapshotFlag.Name)
+	cfg.Witnesses = ctx.GlobalBool(WitnessFlag.Name)
+	cfg.StateDiffs = ctx.GlobalBool(StateDiffsFlag.Name)
+	cfg.HistoryBlocks = ctx.GlobalUint64(HistoryBlocksFlag.Name)
+	cfg.LogIndex = ctx.GlobalBool(LogIndexFlag.Name)
+	if ctx.GlobalIsSet(RPCLogsLimitFlag.Name) {
+		cfg.Logs.MaxResults = ctx.GlobalInt(RPCLogsLimitFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCLogsRangeFlag.Name) {
+		cfg.Logs.MaxBlockRange = ctx.GlobalUint64(RPCLogsRangeFlag.Name)
+	}
+	cfg.NoPrefetch = ctx.GlobalBool(CacheNoPrefetchFlag.Name)
 
+	if ctx.GlobalIsSet(CacheFlag.Name) || ctx.GlobalIsSet(CacheTrieFlag.Name) {
+		cfg.TrieCleanCache = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheTrieFlag.Name) / 100
+	}
 	if ctx.GlobalIsSet(CacheFlag.Name) || ctx.GlobalIsSet(CacheGCFlag.Name) {
 		cfg.TrieCache = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheGCFlag.Name) / 100
 	}
@@ -1318,6 +1628,25 @@ func RegisterNetStatsService(stack *node.Node, cfg netstats.Config) {
 	}
 }
 
+// RegisterGraphQLService adds the GraphQL service to the given node, serving it
+// on the HTTP RPC endpoint.
+func RegisterGraphQLService(stack *node.Node, logs filters.Config) {
+	if err := stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
+		// Serve the data of either the full or the light client
+		var ethServ *eth.GoChain
+		if err := ctx.Service(&ethServ); err == nil {
+			return graphql.New(ethServ.ApiBackend, logs)
+		}
+		var lesServ *les.LightGoChain
+		if err := ctx.Service(&lesServ); err == nil {
+			return graphql.New(lesServ.ApiBackend, logs)
+		}
+		return nil, errors.New("no GoChain service to serve GraphQL from")
+	}); err != nil {
+		Fatalf("Failed to register the GraphQL service: %v", err)
+	}
+}
+
 // MakeChainDatabase open an LevelDB using the flags passed to the client and will hard crash if it fails.
 func MakeChainDatabase(ctx *cli.Context, stack *node.Node) common.Database {
 	var (
@@ -1369,9 +1698,18 @@ func MakeChain(ctx *cli.Context, stack *node.Node) (chain *core.BlockChain, chai
 		Fatalf("--%s must be either 'full' or 'archive'", GCModeFlag.Name)
 	}
 	cache := &core.CacheConfig{
-		Disabled:      ctx.GlobalString(GCModeFlag.Name) == "archive",
-		TrieNodeLimit: eth.DefaultConfig.TrieCache,
-		TrieTimeLimit: eth.DefaultConfig.TrieTimeout,
+		Disabled:       ctx.GlobalString(GCModeFlag.Name) == "archive",
+		TrieCleanLimit: eth.DefaultConfig.TrieCleanCache,
+		TrieNodeLimit:  eth.DefaultConfig.TrieCache,
+		TrieTimeLimit:  eth.DefaultConfig.TrieTimeout,
+		Snapshot:       ctx.GlobalBool(SnapshotFlag.Name),
+		Witnesses:      ctx.GlobalBool(WitnessFlag.Name),
+		StateDiffs:     ctx.GlobalBool(StateDiffsFlag.Name),
+		HistoryBlocks:  ctx.GlobalUint64(HistoryBlocksFlag.Name),
+		NoPrefetch:     ctx.GlobalBool(CacheNoPrefetchFlag.Name),
+	}
+	if ctx.GlobalIsSet(CacheFlag.Name) || ctx.GlobalIsSet(CacheTrieFlag.Name) {
+		cache.TrieCleanLimit = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheTrieFlag.Name) / 100
 	}
 	if ctx.GlobalIsSet(CacheFlag.Name) || ctx.GlobalIsSet(CacheGCFlag.Name) {
 		cache.TrieNodeLimit = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheGCFlag.Name) / 100
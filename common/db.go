@@ -30,6 +30,9 @@ type Database interface {
 	BodyTable() Table
 	HeaderTable() Table
 	ReceiptTable() Table
+	StateDiffTable() Table
+	HistoryTable() Table
+	LogIndexTable() Table
 }
 
 // Putter wraps the write operation supported by both batches and regular tables.
@@ -681,9 +681,10 @@ func (c *Clique) APIs(chain consensus.ChainReader) []rpc.API {
 }
 
 // ExtraEnsureVanity returns a slice of length 32, trimming extra or filling with 0s as necessary.
+// Filling copies extra, whose backing array may be shared.
 func ExtraEnsureVanity(extra []byte) []byte {
 	if len(extra) < extraVanity {
-		return append(extra, make([]byte, extraVanity-len(extra))...)
+		return append(extra[:len(extra):len(extra)], make([]byte, extraVanity-len(extra))...)
 	}
 	return extra[:extraVanity]
 }
@@ -18,6 +18,7 @@
 package core
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -29,6 +30,7 @@ import (
 	"time"
 
 	lru "github.com/hashicorp/golang-lru"
+	"go.opencensus.io/trace"
 
 	"github.com/zeus-fyi/gochain/v4/common"
 	"github.com/zeus-fyi/gochain/v4/common/mclock"
@@ -36,6 +38,7 @@ import (
 	"github.com/zeus-fyi/gochain/v4/consensus"
 	"github.com/zeus-fyi/gochain/v4/core/rawdb"
 	"github.com/zeus-fyi/gochain/v4/core/state"
+	"github.com/zeus-fyi/gochain/v4/core/state/snapshot"
 	"github.com/zeus-fyi/gochain/v4/core/types"
 	"github.com/zeus-fyi/gochain/v4/core/vm"
 	"github.com/zeus-fyi/gochain/v4/ethdb"
@@ -60,7 +63,9 @@ const (
 	maxFutureBlocks     = 256
 	maxTimeFutureBlocks = 30
 	badBlockLimit       = 10
+	historyCacheLimit   = 1024
 	triesInMemory       = 128
+	snapshotLayers      = 64 // Diff layers kept in memory on top of the snapshot disk layer
 
 	// BlockChainVersion ensures that an incompatible database forces a resync from scratch.
 	//
@@ -88,9 +93,15 @@ const (
 // CacheConfig contains the configuration values for the trie caching/pruning
 // that's resident in a blockchain.
 type CacheConfig struct {
-	Disabled      bool          // Whether to disable trie write caching (archive node)
-	TrieNodeLimit int           // Memory limit (MB) at which to flush the current in-memory trie to disk
-	TrieTimeLimit time.Duration // Time limit after which to flush the current in-memory trie to disk
+	Disabled       bool          // Whether to disable trie write caching (archive node)
+	TrieCleanLimit int           // Memory allowance (MB) to use for caching trie nodes in memory
+	TrieNodeLimit  int           // Memory limit (MB) at which to flush the current in-memory trie to disk
+	TrieTimeLimit  time.Duration // Time limit after which to flush the current in-memory trie to disk
+	Snapshot       bool          // Whether to maintain a flat state snapshot for faster state reads
+	Witnesses      bool          // Whether to record and store the execution witness of every processed block
+	StateDiffs     bool          // Whether to record and store the state diff of every imported block
+	HistoryBlocks  uint64        // Number of recent blocks whose state is kept readable through reverse diffs (0 = disabled)
+	NoPrefetch     bool          // Whether to disable speculative execution of the next block during import
 }
 
 // BlockChain represents the canonical chain given a database with a genesis
@@ -135,11 +146,13 @@ type BlockChain struct {
 	currentFastBlock atomic.Value // Current head of the fast-sync chain (may be above the block chain!)
 
 	stateCache    state.Database // State database to reuse between imports (contains state cache)
+	snaps         *snapshot.Tree // Flat state snapshot, nil if disabled
 	bodyCache     *lru.Cache     // Cache for the most recent block bodies
 	bodyRLPCache  *lru.Cache     // Cache for the most recent block bodies in RLP encoded format
 	receiptsCache *lru.Cache     // Cache for the most recent receipts per block
 	blockCache    *lru.Cache     // Cache for the most recent entire blocks
 	futureBlocks  *lru.Cache     // future blocks are blocks added for later processing
+	historyCache  *lru.Cache     // Cache for the most recently read reverse diffs
 
 	quit    chan struct{} // blockchain quit channel. Must hold write lock on wgQuitMu to close.
 	running int32         // running must be called atomically
@@ -149,8 +162,9 @@ type BlockChain struct {
 	wgQuitMu      sync.RWMutex   // Lock to ensure wg.Add is not called after quit is closed. Write locked when closing quit, read locked when checking quit and adding to wg.
 
 	engine     consensus.Engine
-	processor  Processor // block processor interface
-	validator  Validator // block and state validator interface
+	processor  Processor        // block processor interface
+	validator  Validator        // block and state validator interface
+	prefetcher *statePrefetcher // speculative executor warming the caches for the next block
 	vmConfig   vm.Config
 	parWorkers int // Number of workers to spawn for parallel tasks.
 
@@ -173,19 +187,21 @@ func NewBlockChain(db common.Database, cacheConfig *CacheConfig, chainConfig *pa
 	blockCache, _ := lru.New(blockCacheLimit)
 	futureBlocks, _ := lru.New(maxFutureBlocks)
 	badBlocks, _ := lru.New(badBlockLimit)
+	historyCache, _ := lru.New(historyCacheLimit)
 
 	bc := &BlockChain{
 		chainConfig:   chainConfig,
 		cacheConfig:   cacheConfig,
 		db:            db,
 		triegc:        prque.New(nil),
-		stateCache:    state.NewDatabase(db),
+		stateCache:    state.NewDatabaseWithCache(db, cacheConfig.TrieCleanLimit),
 		quit:          make(chan struct{}),
 		bodyCache:     bodyCache,
 		bodyRLPCache:  bodyRLPCache,
 		receiptsCache: receiptsCache,
 		blockCache:    blockCache,
 		futureBlocks:  futureBlocks,
+		historyCache:  historyCache,
 		engine:        engine,
 		vmConfig:      vmConfig,
 		parWorkers:    runtime.GOMAXPROCS(0),
@@ -193,6 +209,7 @@ func NewBlockChain(db common.Database, cacheConfig *CacheConfig, chainConfig *pa
 	}
 	bc.SetValidator(NewBlockValidator(chainConfig, bc, engine))
 	bc.SetProcessor(NewStateProcessor(chainConfig, bc, engine))
+	bc.prefetcher = newStatePrefetcher(chainConfig, bc, engine)
 
 	var err error
 	bc.hc, err = NewHeaderChain(db, chainConfig, engine, bc.getProcInterrupt)
@@ -221,6 +238,11 @@ func NewBlockChain(db common.Database, cacheConfig *CacheConfig, chainConfig *pa
 			}
 		}
 	}
+	// Load or start generating the flat state snapshot of the head state
+	if cacheConfig.Snapshot {
+		bc.snaps = snapshot.New(db.GlobalTable(), bc.stateCache.TrieDB(), bc.CurrentBlock().Root())
+		bc.stateCache = state.WithSnapshots(bc.stateCache, bc.snaps)
+	}
 	// Take ownership of this particular state
 	go bc.update()
 	return bc, nil
@@ -341,7 +363,13 @@ func (bc *BlockChain) SetHead(head uint64) error {
 	}
 	rawdb.WriteHeadBlockHash(bc.db.GlobalTable(), currentBlock.Hash())
 	rawdb.WriteHeadFastBlockHash(bc.db.GlobalTable(), currentFastBlock.Hash())
-	return bc.loadLastState()
+	if err := bc.loadLastState(); err != nil {
+		return err
+	}
+	if bc.snaps != nil {
+		bc.snaps.Rebuild(bc.CurrentBlock().Root())
+	}
+	return nil
 }
 
 // FastSyncCommitHead sets the current head block to the one defined by the hash
@@ -358,6 +386,9 @@ func (bc *BlockChain) FastSyncCommitHead(hash common.Hash) error {
 	// If all checks out, manually set the head block
 	bc.mu.Lock()
 	bc.currentBlock.Store(block)
+	if bc.snaps != nil {
+		bc.snaps.Rebuild(block.Root())
+	}
 	bc.mu.Unlock()
 
 	log.Info("Committed new head block", "number", block.Number(), "hash", hash)
@@ -414,6 +445,11 @@ func (bc *BlockChain) State() (*state.StateDB, error) {
 	return bc.StateAt(bc.CurrentBlock().Root())
 }
 
+// StateCache returns the caching database underpinning the blockchain instance.
+func (bc *BlockChain) StateCache() state.Database {
+	return bc.stateCache
+}
+
 // StateAt returns a new mutable state based on a particular point in time.
 func (bc *BlockChain) StateAt(root common.Hash) (*state.StateDB, error) {
 	return state.New(root, bc.stateCache)
@@ -644,6 +680,125 @@ func (bc *BlockChain) GetReceiptsByHash(hash common.Hash) types.Receipts {
 	return receipts
 }
 
+// GetWitness retrieves the execution witness of a block, either as stored
+// during import or by re-executing it on top of its parent state.
+func (bc *BlockChain) GetWitness(block *types.Block) (*types.Witness, error) {
+	if witness := rawdb.ReadWitness(bc.db.GlobalTable(), block.Hash(), block.NumberU64()); witness != nil {
+		return witness, nil
+	}
+	return NewStateProcessor(bc.chainConfig, bc, bc.engine).Witness(block)
+}
+
+// GetStateDiff retrieves the account and storage changes made by a block,
+// either as stored during import or by re-executing it on top of its parent
+// state.
+func (bc *BlockChain) GetStateDiff(block *types.Block) (*types.StateDiff, error) {
+	if diff := rawdb.ReadStateDiff(bc.db.StateDiffTable(), block.Hash(), block.NumberU64()); diff != nil {
+		return diff, nil
+	}
+	parent := bc.GetBlock(block.ParentHash(), block.NumberU64()-1)
+	if parent == nil {
+		return nil, consensus.ErrUnknownAncestor
+	}
+	statedb, err := state.New(parent.Root(), bc.stateCache)
+	if err != nil {
+		return nil, err
+	}
+	statedb.RecordStateDiff()
+	if _, _, _, err := NewStateProcessor(bc.chainConfig, bc, bc.engine).process(block, statedb, bc, vm.Config{}); err != nil {
+		return nil, err
+	}
+	root, err := statedb.Commit(bc.chainConfig.IsEIP158(block.Number()))
+	if err != nil {
+		return nil, err
+	}
+	if root != block.Root() {
+		return nil, fmt.Errorf("state root mismatch re-executing block %d: have %x, want %x", block.NumberU64(), root, block.Root())
+	}
+	diff := statedb.StateDiff()
+	diff.BlockHash, diff.BlockNumber = block.Hash(), block.NumberU64()
+	return diff, nil
+}
+
+// RecordState prepares a state for processing a block on top of it, so that
+// the changes the chain stores alongside blocks get recorded.
+func (bc *BlockChain) RecordState(statedb *state.StateDB) {
+	switch {
+	case bc.cacheConfig.HistoryBlocks > 0:
+		statedb.RecordReverseDiff()
+	case bc.cacheConfig.StateDiffs:
+		statedb.RecordStateDiff()
+	}
+}
+
+// HistoricState returns the state after the given canonical block, rebuilt
+// from the current state and the reverse diffs of the blocks since. It only
+// reaches back as far as the configured history window.
+func (bc *BlockChain) HistoricState(header *types.Header) (*state.StateDB, error) {
+	window := bc.cacheConfig.HistoryBlocks
+	if window == 0 {
+		return nil, errors.New("state history disabled")
+	}
+	var (
+		head   = bc.CurrentBlock()
+		number = header.Number.Uint64()
+	)
+	if number > head.NumberU64() || rawdb.ReadCanonicalHash(bc.db, number) != header.Hash() {
+		return nil, fmt.Errorf("block %d [%x…] is not canonical", number, header.Hash().Bytes()[:4])
+	}
+	if head.NumberU64()-number > window {
+		return nil, fmt.Errorf("block %d is beyond the state history of the last %d blocks", number, window)
+	}
+	// Pin the canonical blocks up to the head, so that a reorg can't mix the
+	// reverse diffs of another chain into the state.
+	hashes := make([]common.Hash, head.NumberU64()-number)
+	for i := range hashes {
+		hashes[i] = rawdb.ReadCanonicalHash(bc.db, number+1+uint64(i))
+	}
+	if len(hashes) > 0 && hashes[len(hashes)-1] != head.Hash() || rawdb.ReadCanonicalHash(bc.db, number) != header.Hash() {
+		return nil, fmt.Errorf("block %d [%x…] reorganised away", number, header.Hash().Bytes()[:4])
+	}
+	load := func(n uint64) (*types.ReverseDiff, error) {
+		hash := hashes[n-number-1]
+		if diff, ok := bc.historyCache.Get(hash); ok {
+			return diff.(*types.ReverseDiff), nil
+		}
+		diff := rawdb.ReadReverseDiff(bc.db.HistoryTable(), hash, n)
+		if diff == nil {
+			return nil, fmt.Errorf("missing reverse diff of block %d [%x…]", n, hash.Bytes()[:4])
+		}
+		bc.historyCache.Add(hash, diff)
+		return diff, nil
+	}
+	// Fail early if the history doesn't start right after the block.
+	if number < head.NumberU64() {
+		if _, err := load(number + 1); err != nil {
+			return nil, err
+		}
+	}
+	return state.NewHistoric(bc.stateCache, header.Root, number, head.Root(), head.NumberU64(), load)
+}
+
+// historyPruner is implemented by databases which drop old reverse diffs in
+// bulk, by segment.
+type historyPruner interface {
+	PruneHistory(number uint64) error
+}
+
+// pruneHistory drops the reverse diffs which fell out of the history window
+// of the given head, if the database supports it.
+func (bc *BlockChain) pruneHistory(head uint64) {
+	window := bc.cacheConfig.HistoryBlocks
+	if head <= window {
+		return
+	}
+	if db, ok := bc.db.(historyPruner); ok {
+		if err := db.PruneHistory(head - window + 1); err != nil {
+			log.Error("Failed to prune state history", "number", head-window+1, "err", err)
+		}
+	}
+}
+
 // GetBlocksFromHash returns the block corresponding to hash and up to n-1 ancestors.
 // [deprecated by eth/62]
 func (bc *BlockChain) GetBlocksFromHash(hash common.Hash, n int) (blocks []*types.Block) {
@@ -697,6 +852,14 @@ func (bc *BlockChain) Stop() {
 
 	bc.wg.Wait()
 
+	// Flatten the snapshot into its disk layer, so that it matches the head
+	// state on restart.
+	if bc.snaps != nil {
+		if err := bc.snaps.Cap(bc.CurrentBlock().Root(), 0); err != nil {
+			log.Error("Failed to flatten state snapshot", "err", err)
+		}
+		bc.snaps.Stop()
+	}
 	// Ensure the state of a recent block is also stored to disk before exiting.
 	// We're writing three different states to catch different restart scenarios:
 	//  - HEAD:     So we don't need to reprocess any blocks in the general case
@@ -936,6 +1099,14 @@ func (bc *BlockChain) WriteBlockWithState(block *types.Block, receipts []*types.
 	if err != nil {
 		return NonStatTy, err
 	}
+	if diff := state.StateDiff(); diff != nil && bc.cacheConfig.StateDiffs {
+		diff.BlockHash, diff.BlockNumber = hash, block.NumberU64()
+		rawdb.WriteStateDiff(bc.db.StateDiffTable(), hash, block.NumberU64(), diff)
+	}
+	if diff := state.ReverseDiff(); diff != nil && bc.cacheConfig.HistoryBlocks > 0 {
+		rawdb.WriteReverseDiff(bc.db.HistoryTable(), hash, block.NumberU64(), diff)
+		bc.pruneHistory(block.NumberU64())
+	}
 	triedb := bc.stateCache.TrieDB()
 
 	// If we're running an archive node, always flush
@@ -1010,6 +1181,15 @@ func (bc *BlockChain) WriteBlockWithState(block *types.Block, receipts []*types.
 	// Set new head.
 	if status == CanonStatTy {
 		bc.insert(block)
+
+		// Keep the snapshot following the head, regenerating it if the head
+		// layer is missing.
+		if bc.snaps != nil {
+			if err := bc.snaps.Cap(root, snapshotLayers); err != nil {
+				log.Warn("Failed to cap state snapshot", "number", block.Number(), "root", root, "err", err)
+				bc.snaps.Rebuild(root)
+			}
+		}
 	}
 	bc.futureBlocks.Remove(block.Hash())
 	return status, nil
@@ -1070,6 +1250,10 @@ func (bc *BlockChain) insertChain(chain types.Blocks) (int, []interface{}, []*ty
 	if len(chain) == 0 {
 		return 0, nil, nil, nil
 	}
+	_, span := trace.StartSpan(context.Background(), "BlockChain.insertChain")
+	defer span.End()
+	span.AddAttributes(trace.Int64Attribute("first", int64(chain[0].NumberU64())), trace.Int64Attribute("blocks", int64(len(chain))))
+
 	// Do a sanity check that the provided chain is actually ordered and linked.
 	for i := 1; i < len(chain); i++ {
 		if chain[i].NumberU64() != chain[i-1].NumberU64()+1 || chain[i].ParentHash() != chain[i-1].Hash() {
@@ -1150,7 +1334,15 @@ func (bc *BlockChain) insertChain(chain types.Blocks) (int, []interface{}, []*ty
 	defer bc.chainmu.Unlock()
 
 	// Iterate over the blocks and insert when the verifiers permit.
-	var noParentState bool
+	var (
+		noParentState bool
+		next          *prefetch // prefetch of the following block
+	)
+	defer func() {
+		if next != nil {
+			next.stop()
+		}
+	}()
 	for i, block := range chain {
 		// If the chain is terminating, stop processing blocks
 		if atomic.LoadInt32(&bc.procInterrupt) == 1 {
@@ -1245,12 +1437,31 @@ func (bc *BlockChain) insertChain(chain types.Blocks) (int, []interface{}, []*ty
 		if err != nil {
 			return i, events, coalescedLogs, err
 		}
+		bc.RecordState(state)
+		if bc.cacheConfig.Witnesses {
+			if err := state.RecordWitness(); err != nil {
+				return i, events, coalescedLogs, err
+			}
+		}
 		// Process block using the parent state as reference point.
 		receipts, logs, usedGas, err := bc.processor.Process(block, state, bc.vmConfig)
+		if next != nil {
+			next.stop()
+			if next.hash == block.Hash() {
+				next.report(state)
+			}
+			next = nil
+		}
 		if err != nil {
 			bc.reportBlock(block, receipts, err)
 			return i, events, coalescedLogs, err
 		}
+		// If we have a followup block, run it against a copy of the resulting
+		// state while this block is validated and written, to warm the caches
+		// with the accounts, storage and trie nodes it touches.
+		if !bc.cacheConfig.NoPrefetch && i+1 < len(chain) {
+			next = bc.prefetch(chain[i+1], state.Copy())
+		}
 		// Validate the state using the default validator
 		err = bc.Validator().ValidateState(block, parent, state, receipts, usedGas)
 		if err != nil {
@@ -1259,11 +1470,17 @@ func (bc *BlockChain) insertChain(chain types.Blocks) (int, []interface{}, []*ty
 		}
 		proctime := time.Since(bstart)
 
+		// Take the witness before the write, which may access more state.
+		witness := state.Witness()
+
 		// Write the block to the chain and get the status.
 		status, err := bc.WriteBlockWithState(block, receipts, state)
 		if err != nil {
 			return i, events, coalescedLogs, err
 		}
+		if witness != nil {
+			rawdb.WriteWitness(bc.db.GlobalTable(), block.Hash(), block.NumberU64(), witness)
+		}
 		noParentState = false
 		switch status {
 		case CanonStatTy:
@@ -1455,6 +1672,16 @@ func (bc *BlockChain) reorg(oldBlock, newBlock *types.Block) error {
 		rawdb.DeleteTxLookupEntry(batch, tx.Hash())
 	}
 	rawdb.Must("batch delete tx lookup entries", batch.Write)
+
+	// Move the snapshot onto the new chain, in case it forked off below the
+	// snapshot's diff layers
+	if bc.snaps != nil && len(newChain) > 0 {
+		root := newChain[0].Root()
+		if err := bc.snaps.Reorg(root); err != nil {
+			log.Warn("Failed to move state snapshot to new chain", "number", newChain[0].Number(), "root", root, "err", err)
+			bc.snaps.Rebuild(root)
+		}
+	}
 	if len(deletedLogs) > 0 {
 		bc.rmLogsFeed.Send(RemovedLogsEvent{deletedLogs})
 	}
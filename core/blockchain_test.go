@@ -17,6 +17,7 @@
 package core
 
 import (
+	"bytes"
 	"io/ioutil"
 	"math/big"
 	"math/rand"
@@ -36,6 +37,7 @@ import (
 	"github.com/zeus-fyi/gochain/v4/crypto"
 	"github.com/zeus-fyi/gochain/v4/ethdb"
 	"github.com/zeus-fyi/gochain/v4/params"
+	"github.com/zeus-fyi/gochain/v4/rlp"
 )
 
 // newTestBlockChain creates a blockchain without validation.
@@ -1430,3 +1432,336 @@ func TestLargeReorgTrieGC(t *testing.T) {
 		}
 	}
 }
+
+// Tests that the flat state snapshot follows the canonical chain through block
+// imports and reorgs, and is persisted at the head on shutdown.
+func TestSnapshotFollowsChain(t *testing.T) {
+	var (
+		key, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr   = crypto.PubkeyToAddress(key.PublicKey)
+		db     = ethdb.NewMemDatabase()
+		gspec  = &Genesis{
+			Config:   params.TestChainConfig,
+			GasLimit: 3141592,
+			Alloc:    GenesisAlloc{addr: {Balance: big.NewInt(1000000000)}},
+		}
+		genesis = gspec.MustCommit(db)
+		engine  = clique.NewFaker()
+		signer  = types.NewEIP155Signer(gspec.Config.ChainId)
+		cache   = &CacheConfig{TrieNodeLimit: 256 * 1024 * 1024, TrieTimeLimit: 5 * time.Minute, Snapshot: true}
+	)
+	transfer := func(i int, gen *BlockGen) {
+		tx, _ := types.SignTx(types.NewTransaction(gen.TxNonce(addr), common.Address{byte(i + 1)}, big.NewInt(int64(i+1)), params.TxGas, nil, nil), signer, key)
+		gen.AddTx(tx)
+	}
+	blocks, _ := GenerateChain(gspec.Config, genesis, engine, db, 2*snapshotLayers, transfer)
+	fork, _ := GenerateChain(gspec.Config, blocks[len(blocks)-3], engine, db, 4, func(i int, gen *BlockGen) {
+		gen.SetCoinbase(common.Address{0xff})
+		transfer(i+200, gen)
+	})
+	deep, _ := GenerateChain(gspec.Config, blocks[len(blocks)-snapshotLayers-10], engine, db, snapshotLayers+16, func(i int, gen *BlockGen) {
+		gen.SetCoinbase(common.Address{0xfe})
+		transfer(i+100, gen)
+	})
+
+	diskdb := ethdb.NewMemDatabase()
+	gspec.MustCommit(diskdb)
+	chain, err := NewBlockChain(diskdb, cache, gspec.Config, engine, vm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	check := func(head *types.Block, recipient common.Address, want int64) {
+		t.Helper()
+		if chain.CurrentBlock().Hash() != head.Hash() {
+			t.Fatalf("head mismatch: have %d, want %d", chain.CurrentBlock().NumberU64(), head.NumberU64())
+		}
+		if chain.snaps.Snapshot(head.Root()) == nil {
+			t.Fatalf("no snapshot layer for head %d", head.NumberU64())
+		}
+		state, err := chain.State()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have := state.GetBalance(recipient); have.Cmp(big.NewInt(want)) != 0 {
+			t.Errorf("balance of %x: have %v, want %d", recipient, have, want)
+		}
+	}
+	if n, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("block %d: failed to insert into chain: %v", n, err)
+	}
+	check(blocks[len(blocks)-1], common.Address{byte(len(blocks))}, int64(len(blocks)))
+
+	if n, err := chain.InsertChain(fork); err != nil {
+		t.Fatalf("fork %d: failed to insert into chain: %v", n, err)
+	}
+	check(fork[len(fork)-1], common.Address{204}, 204)
+
+	// A reorg below the diff layers moves the snapshot without regenerating it
+	epoch := rawdb.ReadSnapshotGenerator(diskdb.GlobalTable()).Epoch
+	if n, err := chain.InsertChain(deep); err != nil {
+		t.Fatalf("deep fork %d: failed to insert into chain: %v", n, err)
+	}
+	check(deep[len(deep)-1], common.Address{byte(100 + len(deep))}, int64(100+len(deep)))
+	if gen := rawdb.ReadSnapshotGenerator(diskdb.GlobalTable()); gen.Epoch != epoch {
+		t.Errorf("snapshot regenerated on deep reorg: epoch %d, want %d", gen.Epoch, epoch)
+	}
+	chain.Stop()
+
+	if root := rawdb.ReadSnapshotRoot(diskdb.GlobalTable()); root != deep[len(deep)-1].Root() {
+		t.Errorf("persisted snapshot root mismatch: have %x, want %x", root, deep[len(deep)-1].Root())
+	}
+}
+
+// Tests that state diffs recorded during import are persisted, and match the
+// ones regenerated by re-executing the blocks.
+func TestStateDiffsPersisted(t *testing.T) {
+	var (
+		key, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr   = crypto.PubkeyToAddress(key.PublicKey)
+		db     = ethdb.NewMemDatabase()
+		gspec  = &Genesis{
+			Config:   params.TestChainConfig,
+			GasLimit: 3141592,
+			Alloc:    GenesisAlloc{addr: {Balance: big.NewInt(1000000000)}},
+		}
+		genesis = gspec.MustCommit(db)
+		engine  = clique.NewFaker()
+		signer  = types.NewEIP155Signer(gspec.Config.ChainId)
+	)
+	blocks, _ := GenerateChain(gspec.Config, genesis, engine, db, 3, func(i int, gen *BlockGen) {
+		tx, _ := types.SignTx(types.NewTransaction(gen.TxNonce(addr), common.Address{byte(i + 1)}, big.NewInt(int64(i+1)), params.TxGas, nil, nil), signer, key)
+		gen.AddTx(tx)
+	})
+	newChain := func(diffs bool) (*BlockChain, common.Database) {
+		diskdb := ethdb.NewMemDatabase()
+		gspec.MustCommit(diskdb)
+		cache := &CacheConfig{TrieNodeLimit: 256 * 1024 * 1024, TrieTimeLimit: 5 * time.Minute, StateDiffs: diffs}
+		chain, err := NewBlockChain(diskdb, cache, gspec.Config, engine, vm.Config{})
+		if err != nil {
+			t.Fatalf("failed to create tester chain: %v", err)
+		}
+		if _, err := chain.InsertChain(blocks); err != nil {
+			t.Fatalf("failed to insert chain: %v", err)
+		}
+		return chain, diskdb
+	}
+	recorded, recordedDb := newChain(true)
+	defer recorded.Stop()
+	regenerated, regeneratedDb := newChain(false)
+	defer regenerated.Stop()
+
+	for i, block := range blocks {
+		stored := rawdb.ReadStateDiff(recordedDb.StateDiffTable(), block.Hash(), block.NumberU64())
+		if stored == nil {
+			t.Fatalf("block %d: state diff not stored", block.NumberU64())
+		}
+		if rawdb.ReadStateDiff(regeneratedDb.StateDiffTable(), block.Hash(), block.NumberU64()) != nil {
+			t.Fatalf("block %d: state diff stored without recording", block.NumberU64())
+		}
+		diff, err := regenerated.GetStateDiff(block)
+		if err != nil {
+			t.Fatalf("block %d: failed to regenerate state diff: %v", block.NumberU64(), err)
+		}
+		have, _ := rlp.EncodeToBytes(diff)
+		want, _ := rlp.EncodeToBytes(stored)
+		if !bytes.Equal(have, want) {
+			t.Fatalf("block %d: regenerated diff mismatch:\nhave %+v\nwant %+v", block.NumberU64(), diff.Accounts, stored.Accounts)
+		}
+		if stored.BlockHash != block.Hash() || stored.Root != block.Root() {
+			t.Fatalf("block %d: diff header mismatch", block.NumberU64())
+		}
+		var recipient *types.AccountDiff
+		for _, account := range stored.Accounts {
+			if account.Address == (common.Address{byte(i + 1)}) {
+				recipient = account
+			}
+		}
+		if recipient == nil || !recipient.Created || recipient.BalanceTo.Int64() != int64(i+1) {
+			t.Fatalf("block %d: recipient diff mismatch: %+v", block.NumberU64(), recipient)
+		}
+	}
+}
+
+// Tests that the state of blocks within the history window can be read back
+// from reverse diffs, including storage and code of destructed contracts.
+func TestHistoricState(t *testing.T) {
+	var (
+		key, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr   = crypto.PubkeyToAddress(key.PublicKey)
+		// sstore(number, number); sstore(number-1, 0)
+		storer = common.Address{0xaa}
+		// selfdestruct(caller)
+		destructed = common.Address{0xbb}
+		db         = ethdb.NewMemDatabase()
+		gspec      = &Genesis{
+			Config:   params.TestChainConfig,
+			GasLimit: 3141592,
+			Alloc: GenesisAlloc{
+				addr:       {Balance: big.NewInt(1000000000)},
+				storer:     {Balance: big.NewInt(0), Code: common.FromHex("0x4343556000600143035500")},
+				destructed: {Balance: big.NewInt(7), Code: common.FromHex("0x33ff"), Storage: map[common.Hash]common.Hash{{0x01}: {0x01}}},
+			},
+		}
+		genesis = gspec.MustCommit(db)
+		engine  = clique.NewFaker()
+		signer  = types.NewEIP155Signer(gspec.Config.ChainId)
+	)
+	blocks, _ := GenerateChain(gspec.Config, genesis, engine, db, 6, func(i int, gen *BlockGen) {
+		tx, _ := types.SignTx(types.NewTransaction(gen.TxNonce(addr), storer, big.NewInt(1), 100000, nil, nil), signer, key)
+		gen.AddTx(tx)
+		tx, _ = types.SignTx(types.NewTransaction(gen.TxNonce(addr), common.Address{byte(i + 1)}, big.NewInt(1), params.TxGas, nil, nil), signer, key)
+		gen.AddTx(tx)
+		if i == 2 {
+			tx, _ = types.SignTx(types.NewTransaction(gen.TxNonce(addr), destructed, big.NewInt(0), 100000, nil, nil), signer, key)
+			gen.AddTx(tx)
+		}
+	})
+	diskdb := ethdb.NewMemDatabase()
+	gspec.MustCommit(diskdb)
+	cache := &CacheConfig{TrieNodeLimit: 256 * 1024 * 1024, TrieTimeLimit: 5 * time.Minute, HistoryBlocks: 4}
+	chain, err := NewBlockChain(diskdb, cache, gspec.Config, engine, vm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	accounts := []common.Address{addr, storer, destructed, {0x01}, {0x03}, {0x06}}
+	for number := uint64(2); number <= 6; number++ {
+		header := chain.GetHeaderByNumber(number)
+		want, err := chain.StateAt(header.Root)
+		if err != nil {
+			t.Fatalf("block %d: failed to open state: %v", number, err)
+		}
+		have, err := chain.HistoricState(header)
+		if err != nil {
+			t.Fatalf("block %d: failed to open historic state: %v", number, err)
+		}
+		for _, account := range accounts {
+			if have.Exist(account) != want.Exist(account) {
+				t.Errorf("block %d, account %x: existence mismatch: have %v", number, account, have.Exist(account))
+			}
+			if have.GetBalance(account).Cmp(want.GetBalance(account)) != 0 {
+				t.Errorf("block %d, account %x: balance mismatch: have %v, want %v", number, account, have.GetBalance(account), want.GetBalance(account))
+			}
+			if have.GetNonce(account) != want.GetNonce(account) {
+				t.Errorf("block %d, account %x: nonce mismatch: have %d, want %d", number, account, have.GetNonce(account), want.GetNonce(account))
+			}
+			if !bytes.Equal(have.GetCode(account), want.GetCode(account)) {
+				t.Errorf("block %d, account %x: code mismatch: have %x, want %x", number, account, have.GetCode(account), want.GetCode(account))
+			}
+			for slot := byte(0); slot <= 7; slot++ {
+				key := common.BytesToHash([]byte{slot})
+				if have.GetState(account, key) != want.GetState(account, key) {
+					t.Errorf("block %d, account %x, slot %d: storage mismatch: have %x, want %x", number, account, slot, have.GetState(account, key), want.GetState(account, key))
+				}
+			}
+		}
+		if have.GetState(destructed, common.Hash{0x01}) != want.GetState(destructed, common.Hash{0x01}) {
+			t.Errorf("block %d: destructed storage mismatch", number)
+		}
+	}
+	// The contract destructed in block 3 must be served from the diffs before.
+	statedb, err := chain.HistoricState(chain.GetHeaderByNumber(2))
+	if err != nil {
+		t.Fatalf("failed to open historic state: %v", err)
+	}
+	if statedb.GetState(destructed, common.Hash{0x01}) != (common.Hash{0x01}) || len(statedb.GetCode(destructed)) == 0 {
+		t.Error("destructed contract not restored")
+	}
+	// Historic states have no trie, so they must not be proven.
+	if _, err := statedb.GetProof(destructed); err != state.ErrHistoricState {
+		t.Errorf("account proof error mismatch: have %v, want %v", err, state.ErrHistoricState)
+	}
+	if _, _, _, err := statedb.GetStorageRangeProof(destructed, common.Hash{}, 1); err != state.ErrHistoricState {
+		t.Errorf("storage range proof error mismatch: have %v, want %v", err, state.ErrHistoricState)
+	}
+	if _, err := chain.HistoricState(chain.GetHeaderByNumber(1)); err == nil {
+		t.Error("historic state available beyond the history window")
+	}
+	// Reads needing a missing reverse diff must fail rather than report an
+	// absent account.
+	statedb, err = chain.HistoricState(chain.GetHeaderByNumber(2))
+	if err != nil {
+		t.Fatalf("failed to open historic state: %v", err)
+	}
+	missing := chain.GetHeaderByNumber(4)
+	rawdb.DeleteReverseDiff(diskdb.HistoryTable(), missing.Hash(), 4)
+	chain.historyCache.Remove(missing.Hash())
+	if _, err := statedb.GetBalanceErr(common.Address{0x06}); err == nil {
+		t.Error("balance read without the reverse diffs succeeded")
+	}
+	if statedb.Error() == nil {
+		t.Error("failed read not recorded")
+	}
+}
+
+// Tests that prefetching the next block during import loads the state it
+// touches and leaves the imported chain unchanged.
+func TestPrefetchNextBlock(t *testing.T) {
+	var (
+		key, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr   = crypto.PubkeyToAddress(key.PublicKey)
+		db     = ethdb.NewMemDatabase()
+		gspec  = &Genesis{
+			Config:   params.TestChainConfig,
+			GasLimit: 3141592,
+			Alloc:    GenesisAlloc{addr: {Balance: big.NewInt(1000000000)}},
+		}
+		genesis = gspec.MustCommit(db)
+		engine  = clique.NewFaker()
+		signer  = types.NewEIP155Signer(gspec.Config.ChainId)
+	)
+	blocks, _ := GenerateChain(gspec.Config, genesis, engine, db, 8, func(i int, gen *BlockGen) {
+		for j := 0; j < 4; j++ {
+			tx, _ := types.SignTx(types.NewTransaction(gen.TxNonce(addr), common.Address{byte(i + 1), byte(j)}, big.NewInt(1), params.TxGas, nil, nil), signer, key)
+			gen.AddTx(tx)
+		}
+	})
+	newChain := func(noPrefetch bool) *BlockChain {
+		diskdb := ethdb.NewMemDatabase()
+		gspec.MustCommit(diskdb)
+		cache := &CacheConfig{TrieCleanLimit: 16, TrieNodeLimit: 256 * 1024 * 1024, TrieTimeLimit: 5 * time.Minute, NoPrefetch: noPrefetch}
+		chain, err := NewBlockChain(diskdb, cache, gspec.Config, engine, vm.Config{})
+		if err != nil {
+			t.Fatalf("failed to create tester chain: %v", err)
+		}
+		if _, err := chain.InsertChain(blocks); err != nil {
+			t.Fatalf("failed to insert chain: %v", err)
+		}
+		return chain
+	}
+	prefetched := newChain(false)
+	defer prefetched.Stop()
+	plain := newChain(true)
+	defer plain.Stop()
+
+	if have, want := prefetched.CurrentBlock().Root(), plain.CurrentBlock().Root(); have != want {
+		t.Fatalf("head root mismatch: have %x, want %x", have, want)
+	}
+	// Prefetching a block on its parent state loads all the accounts it touches.
+	statedb, err := prefetched.StateAt(blocks[0].Root())
+	if err != nil {
+		t.Fatalf("failed to open state: %v", err)
+	}
+	var interrupt uint32
+	prefetched.prefetcher.Prefetch(blocks[1], statedb, vm.Config{}, &interrupt)
+	loaded := statedb.Loaded()
+	for _, tx := range blocks[1].Transactions() {
+		if _, ok := loaded[*tx.To()]; !ok {
+			t.Errorf("recipient %x not loaded", *tx.To())
+		}
+	}
+	if _, ok := loaded[addr]; !ok {
+		t.Errorf("sender %x not loaded", addr)
+	}
+	// An interrupted prefetch stops before the first transaction.
+	statedb, _ = prefetched.StateAt(blocks[0].Root())
+	interrupt = 1
+	prefetched.prefetcher.Prefetch(blocks[1], statedb, vm.Config{}, &interrupt)
+	if loaded := statedb.Loaded(); len(loaded) != 0 {
+		t.Errorf("interrupted prefetch loaded %d accounts", len(loaded))
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package forkid
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/params"
+	"github.com/zeus-fyi/gochain/v4/rlp"
+)
+
+// TestCreation tests that different genesis and fork rule combinations result in
+// the correct fork ID.
+func TestCreation(t *testing.T) {
+	type testcase struct {
+		head uint64
+		want ID
+	}
+	tests := []struct {
+		config  *params.ChainConfig
+		genesis common.Hash
+		cases   []testcase
+	}{
+		// Mainnet test cases
+		{
+			params.MainnetChainConfig,
+			params.MainnetGenesisHash,
+			[]testcase{
+				{0, ID{Hash: checksumToBytes(0x5233dad0), Next: 5100000}},         // Unsynced
+				{5099999, ID{Hash: checksumToBytes(0x5233dad0), Next: 5100000}},   // Last block before Constantinople
+				{5100000, ID{Hash: checksumToBytes(0xecda1463), Next: 17900000}},  // First Constantinople block
+				{17899999, ID{Hash: checksumToBytes(0xecda1463), Next: 17900000}}, // Last Constantinople block
+				{17900000, ID{Hash: checksumToBytes(0x7f9b8cc2), Next: 23817200}}, // First Darvaza block
+				{23817199, ID{Hash: checksumToBytes(0x7f9b8cc2), Next: 23817200}}, // Last Darvaza block
+				{23817200, ID{Hash: checksumToBytes(0xd9be8def), Next: 0}},        // First Hafthor block
+				{30000000, ID{Hash: checksumToBytes(0xd9be8def), Next: 0}},        // Future Hafthor block
+			},
+		},
+		// Testnet test cases
+		{
+			params.TestnetChainConfig,
+			params.TestnetGenesisHash,
+			[]testcase{
+				{0, ID{Hash: checksumToBytes(0x5eb75de1), Next: 4081350}},         // Unsynced
+				{4081350, ID{Hash: checksumToBytes(0x1267671a), Next: 16811000}},  // First Constantinople block
+				{16811000, ID{Hash: checksumToBytes(0xd2edad22), Next: 22400000}}, // First Darvaza block
+				{22400000, ID{Hash: checksumToBytes(0x14663ff5), Next: 0}},        // First Hafthor block
+			},
+		},
+	}
+	for i, tt := range tests {
+		for j, ttt := range tt.cases {
+			if have := NewID(tt.config, tt.genesis, ttt.head); have != ttt.want {
+				t.Errorf("test %d, case %d: fork ID mismatch: have %x, want %x", i, j, have, ttt.want)
+			}
+		}
+	}
+}
+
+// TestValidation tests that a local peer correctly validates and accepts a remote
+// fork ID.
+func TestValidation(t *testing.T) {
+	tests := []struct {
+		head uint64
+		id   ID
+		err  error
+	}{
+		// Local is mainnet Darvaza, remote announces the same. No future fork is announced.
+		{17900000, ID{Hash: checksumToBytes(0x7f9b8cc2), Next: 0}, nil},
+
+		// Local is mainnet Darvaza, remote announces the same. Remote also announces
+		// Hafthor at the correct block.
+		{17900000, ID{Hash: checksumToBytes(0x7f9b8cc2), Next: 23817200}, nil},
+
+		// Local is mainnet Darvaza, remote announces the same. Remote also announces
+		// a future fork at block 0xffffffff, but that is uncertain.
+		{17900000, ID{Hash: checksumToBytes(0x7f9b8cc2), Next: math.MaxUint32}, nil},
+
+		// Local is mainnet currently in Constantinople only (so it's aware of Darvaza),
+		// remote announces also Constantinople, but it's not yet aware of Darvaza
+		// (e.g. non updated node before the fork). In this case we don't know if
+		// Darvaza passed yet or not.
+		{17899999, ID{Hash: checksumToBytes(0xecda1463), Next: 0}, nil},
+
+		// Local is mainnet currently in Constantinople only (so it's aware of Darvaza),
+		// remote announces Darvaza and a future fork. Local needs software update.
+		{17899999, ID{Hash: checksumToBytes(0x7f9b8cc2), Next: math.MaxUint32}, nil},
+
+		// Local is mainnet Hafthor, remote announces Constantinople + knowledge about
+		// Darvaza. Remote is simply out of sync, accept.
+		{23817200, ID{Hash: checksumToBytes(0xecda1463), Next: 17900000}, nil},
+
+		// Local is mainnet Hafthor, remote announces Constantinople without Darvaza.
+		// Remote is definitely out of date and needs an update, reject.
+		{23817200, ID{Hash: checksumToBytes(0xecda1463), Next: 0}, ErrRemoteStale},
+
+		// Local is mainnet Darvaza, remote announces Hafthor. Local is out of sync, accept.
+		{17900000, ID{Hash: checksumToBytes(0xd9be8def), Next: 0}, nil},
+
+		// Local is mainnet Constantinople, remote announces Hafthor. Local is out of
+		// sync, accept.
+		{5100000, ID{Hash: checksumToBytes(0xd9be8def), Next: 0}, nil},
+
+		// Local is mainnet Hafthor, remote announces Darvaza but with a next fork
+		// other than Hafthor. Remote is on a diverging chain and needs an update, reject.
+		{23817200, ID{Hash: checksumToBytes(0x7f9b8cc2), Next: 20000000}, ErrRemoteStale},
+
+		// Local is mainnet Hafthor, remote is the testnet. Incompatible chains, reject.
+		{23817200, ID{Hash: checksumToBytes(0x14663ff5), Next: 0}, ErrLocalIncompatibleOrStale},
+
+		// Local is mainnet Hafthor, far in the future. Remote announces Hafthor with
+		// a fork at a block we've already passed but don't know about, reject.
+		{88888888, ID{Hash: checksumToBytes(0xd9be8def), Next: 88888888}, ErrLocalIncompatibleOrStale},
+	}
+	for i, tt := range tests {
+		filter := newFilter(params.MainnetChainConfig, params.MainnetGenesisHash, func() uint64 { return tt.head })
+		if err := filter(tt.id); err != tt.err {
+			t.Errorf("test %d: validation error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+}
+
+// Tests that IDs are properly RLP encoded (specifically important because we
+// use uint32 to store the hash, but we need to encode it as [4]byte).
+func TestEncoding(t *testing.T) {
+	tests := []struct {
+		id   ID
+		want []byte
+	}{
+		{ID{Hash: checksumToBytes(0), Next: 0}, common.Hex2Bytes("c6840000000080")},
+		{ID{Hash: checksumToBytes(0xdeadbeef), Next: 0xBADDCAFE}, common.Hex2Bytes("ca84deadbeef84baddcafe")},
+		{ID{Hash: checksumToBytes(math.MaxUint32), Next: math.MaxUint64}, common.Hex2Bytes("ce84ffffffff88ffffffffffffffff")},
+	}
+	for i, tt := range tests {
+		have, err := rlp.EncodeToBytes(tt.id)
+		if err != nil {
+			t.Errorf("test %d: failed to encode forkid: %v", i, err)
+			continue
+		}
+		if !bytes.Equal(have, tt.want) {
+			t.Errorf("test %d: RLP mismatch: have %x, want %x", i, have, tt.want)
+		}
+	}
+}
+
+// Tests that the GoChain specific forks are part of the fork list.
+func TestGatherForks(t *testing.T) {
+	config := *params.TestChainConfig
+	config.DarvazaBlock = common.Big1
+	config.HafthorBlock = common.Big2
+
+	forks := gatherForks(&config)
+	if len(forks) != 2 || forks[0] != 1 || forks[1] != 2 {
+		t.Fatalf("fork list mismatch: have %v, want [1 2]", forks)
+	}
+}
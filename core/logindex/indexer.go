@@ -0,0 +1,122 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package logindex implements an exact index of the addresses and topics of the
+// logs in the canonical chain.
+//
+// The index is built in sections of consecutive blocks by a core.ChainIndexer.
+// For every address and every topic at each of the four topic positions seen
+// in a section, it stores the positions (block, transaction and log index) of
+// the matching logs in the block partitioned log index table. Entries are keyed
+// by the hash of the last block of their section, so sections built on a chain
+// that was reorganised away are never read; the chain indexer rebuilds them.
+package logindex
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/core"
+	"github.com/zeus-fyi/gochain/v4/core/rawdb"
+	"github.com/zeus-fyi/gochain/v4/core/types"
+)
+
+const (
+	// confirms is the number of confirmation blocks before a section is
+	// considered final and indexed.
+	confirms = 256
+
+	// throttling is the time to wait between processing two consecutive index
+	// sections, to prevent the initial indexing from hogging the disk.
+	throttling = 100 * time.Millisecond
+)
+
+// Indexer implements core.ChainIndexerBackend, building the log index of the
+// canonical chain section by section.
+type Indexer struct {
+	db   common.Database // database to read receipts from and write the index to
+	size uint64          // number of blocks per section
+
+	start   uint64                         // first block of the section being processed
+	head    common.Hash                    // hash of the last header processed
+	terms   map[string][]rawdb.LogPosition // positions of the logs by term
+	missing uint64                         // number of a block whose receipts are missing, if any
+}
+
+// NewIndexer returns a chain indexer building the log index of the canonical
+// chain in sections of the given size.
+func NewIndexer(db common.Database, size uint64) *core.ChainIndexer {
+	backend := &Indexer{db: db, size: size}
+	table := common.NewTablePrefixer(db.GlobalTable(), string(rawdb.LogIndexPrefix))
+
+	return core.NewChainIndexer(db, table, backend, size, confirms, throttling, "logindex")
+}
+
+// Reset implements core.ChainIndexerBackend, starting a new section.
+func (idx *Indexer) Reset(section uint64, prevHead common.Hash) error {
+	idx.start, idx.head, idx.missing = section*idx.size, common.Hash{}, 0
+	idx.terms = make(map[string][]rawdb.LogPosition)
+	return nil
+}
+
+// Process implements core.ChainIndexerBackend, adding the logs of a block to
+// the section.
+func (idx *Indexer) Process(header *types.Header) {
+	hash, number := header.Hash(), header.Number.Uint64()
+	idx.head = hash
+
+	if header.Bloom == (types.Bloom{}) {
+		return // No logs in the block
+	}
+	receipts := rawdb.ReadRawReceipts(idx.db.ReceiptTable(), hash, number)
+	if receipts == nil {
+		// Receipts might not be available yet after a fast sync, fail the
+		// section instead of indexing it incompletely.
+		if idx.missing == 0 {
+			idx.missing = number
+		}
+		return
+	}
+	for i, receipt := range receipts {
+		for j, l := range receipt.Logs {
+			pos := rawdb.LogPosition{Block: number, Tx: uint32(i), Log: uint32(j)}
+			term := string(rawdb.LogIndexAddressTerm(l.Address))
+			idx.terms[term] = append(idx.terms[term], pos)
+			for k, topic := range l.Topics {
+				if k >= maxTopics {
+					break
+				}
+				term := string(rawdb.LogIndexTopicTerm(k, topic))
+				idx.terms[term] = append(idx.terms[term], pos)
+			}
+		}
+	}
+}
+
+// Commit implements core.ChainIndexerBackend, writing out the section.
+func (idx *Indexer) Commit() error {
+	if idx.missing != 0 {
+		return fmt.Errorf("missing receipts of block #%d", idx.missing)
+	}
+	batch := idx.db.LogIndexTable().NewBatch()
+	for term, positions := range idx.terms {
+		rawdb.WriteLogIndex(batch, idx.start, idx.head, []byte(term), positions)
+	}
+	rawdb.WriteLogIndexSection(batch, idx.start, idx.head)
+	rawdb.Must("write log index batch", batch.Write)
+	return nil
+}
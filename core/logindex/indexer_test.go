@@ -0,0 +1,132 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package logindex
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/consensus/clique"
+	"github.com/zeus-fyi/gochain/v4/core"
+	"github.com/zeus-fyi/gochain/v4/core/rawdb"
+	"github.com/zeus-fyi/gochain/v4/core/types"
+	"github.com/zeus-fyi/gochain/v4/ethdb"
+	"github.com/zeus-fyi/gochain/v4/params"
+)
+
+// testChain is a static core.ChainIndexerChain.
+type testChain struct {
+	head *types.Header
+}
+
+func (c *testChain) CurrentHeader() *types.Header                                       { return c.head }
+func (c *testChain) SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent, name string) {}
+func (c *testChain) UnsubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent)            {}
+
+func TestIndexer(t *testing.T) {
+	const size = 16
+
+	var (
+		db    = ethdb.NewMemDatabase()
+		addr1 = common.BytesToAddress([]byte("addr1"))
+		addr2 = common.BytesToAddress([]byte("addr2"))
+		topic = common.BytesToHash([]byte("topic"))
+		other = common.BytesToHash([]byte("other"))
+	)
+	genesis := core.GenesisBlockForTesting(db, addr1, big.NewInt(1000000))
+	chain, receipts := core.GenerateChain(params.TestChainConfig, genesis, clique.NewFaker(), db, 2*size+confirms, func(i int, gen *core.BlockGen) {
+		var logs []*types.Log
+		switch i {
+		case 2:
+			logs = []*types.Log{{Address: addr1, Topics: []common.Hash{topic}}}
+		case 5:
+			logs = []*types.Log{{Address: addr2}, {Address: addr1, Topics: []common.Hash{other, topic}}}
+		case 20:
+			logs = []*types.Log{{Address: addr2, Topics: []common.Hash{topic}}}
+		default:
+			return
+		}
+		receipt := types.NewReceipt(nil, false, 0)
+		receipt.Logs = logs
+		receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+		gen.AddUncheckedReceipt(receipt)
+		gen.AddUncheckedTx(types.NewTransaction(uint64(i), common.Address{}, big.NewInt(1), 1, big.NewInt(1), nil))
+	})
+	for i, block := range chain {
+		rawdb.WriteBlock(db, block)
+		rawdb.WriteCanonicalHash(db, block.Hash(), block.NumberU64())
+		rawdb.WriteReceipts(db.ReceiptTable(), block.Hash(), block.NumberU64(), receipts[i])
+	}
+	indexer := NewIndexer(db, size)
+	indexer.Start(&testChain{head: chain[len(chain)-1].Header()})
+	defer indexer.Close()
+
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if sections, _, _ := indexer.Sections(); sections == 2 {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("indexing timed out")
+		}
+	}
+	tests := []struct {
+		section   uint64
+		addresses []common.Address
+		topics    [][]common.Hash
+		want      []rawdb.LogPosition
+	}{
+		{0, []common.Address{addr1}, nil, []rawdb.LogPosition{{Block: 3}, {Block: 6, Log: 1}}},
+		{0, []common.Address{addr1, addr2}, nil, []rawdb.LogPosition{{Block: 3}, {Block: 6}, {Block: 6, Log: 1}}},
+		{0, nil, [][]common.Hash{{topic}}, []rawdb.LogPosition{{Block: 3}}},
+		{0, nil, [][]common.Hash{nil, {topic}}, []rawdb.LogPosition{{Block: 6, Log: 1}}},
+		{0, []common.Address{addr1}, [][]common.Hash{{topic, other}}, []rawdb.LogPosition{{Block: 3}, {Block: 6, Log: 1}}},
+		{0, []common.Address{addr2}, [][]common.Hash{{topic}}, nil},
+		{1, []common.Address{addr2}, [][]common.Hash{{topic}}, []rawdb.LogPosition{{Block: 21}}},
+		{1, []common.Address{addr1}, nil, nil},
+	}
+	for i, tt := range tests {
+		have, err := Lookup(db, size, tt.section, tt.addresses, tt.topics)
+		if err != nil {
+			t.Fatalf("test %d: lookup failed: %v", i, err)
+		}
+		if len(have) != 0 || len(tt.want) != 0 {
+			if !reflect.DeepEqual(have, tt.want) {
+				t.Errorf("test %d: positions mismatch: have %v, want %v", i, have, tt.want)
+			}
+		}
+	}
+	// Sections of a reorganised chain must not be served.
+	rawdb.WriteCanonicalHash(db, common.Hash{1}, size-1)
+	if _, err := Lookup(db, size, 0, []common.Address{addr1}, nil); err != ErrSectionMissing {
+		t.Errorf("reorged section: have error %v, want %v", err, ErrSectionMissing)
+	}
+	if _, err := Lookup(db, size, 2, []common.Address{addr1}, nil); err != ErrSectionMissing {
+		t.Errorf("unindexed section: have error %v, want %v", err, ErrSectionMissing)
+	}
+}
+
+func TestIndexable(t *testing.T) {
+	if Indexable(nil, nil) || Indexable(nil, [][]common.Hash{nil, {}}) {
+		t.Error("wildcard filter reported indexable")
+	}
+	if !Indexable([]common.Address{{}}, nil) || !Indexable(nil, [][]common.Hash{nil, {{}}}) {
+		t.Error("filter with criteria reported not indexable")
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package logindex
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/core/rawdb"
+)
+
+// maxTopics is the number of topic positions indexed, the most a log can have.
+const maxTopics = 4
+
+// ErrSectionMissing is returned by Lookup if the section isn't indexed for the
+// current canonical chain, e.g. because it is being rebuilt after a reorg.
+var ErrSectionMissing = errors.New("log index section missing")
+
+// Indexable reports whether the index can answer a filter, which requires at
+// least one address or topic to match.
+func Indexable(addresses []common.Address, topics [][]common.Hash) bool {
+	if len(addresses) > 0 {
+		return true
+	}
+	for i, sub := range topics {
+		if i < maxTopics && len(sub) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Lookup returns the positions, in chain order, of the logs in the given
+// section of the canonical chain matching any of the addresses and, at every
+// topic position, any of the topics. Empty lists match anything.
+func Lookup(db common.Database, size, section uint64, addresses []common.Address, topics [][]common.Hash) ([]rawdb.LogPosition, error) {
+	start := section * size
+	head := rawdb.ReadCanonicalHash(db, start+size-1)
+	if head == (common.Hash{}) || !rawdb.HasLogIndexSection(db.LogIndexTable(), start, head) {
+		return nil, ErrSectionMissing
+	}
+	// Gather the terms of every criterion, any of which may match.
+	var criteria [][][]byte
+	if len(addresses) > 0 {
+		terms := make([][]byte, len(addresses))
+		for i, address := range addresses {
+			terms[i] = rawdb.LogIndexAddressTerm(address)
+		}
+		criteria = append(criteria, terms)
+	}
+	for i, sub := range topics {
+		if i >= maxTopics || len(sub) == 0 {
+			continue
+		}
+		terms := make([][]byte, len(sub))
+		for j, topic := range sub {
+			terms[j] = rawdb.LogIndexTopicTerm(i, topic)
+		}
+		criteria = append(criteria, terms)
+	}
+	// Intersect the positions matching each criterion, starting with the
+	// first one and narrowing down with the others.
+	var matches map[rawdb.LogPosition]struct{}
+	for _, terms := range criteria {
+		found := make(map[rawdb.LogPosition]struct{})
+		for _, term := range terms {
+			for _, pos := range rawdb.ReadLogIndex(db.LogIndexTable(), start, head, term) {
+				if _, ok := matches[pos]; matches == nil || ok {
+					found[pos] = struct{}{}
+				}
+			}
+		}
+		matches = found
+		if len(matches) == 0 {
+			return nil, nil
+		}
+	}
+	positions := make([]rawdb.LogPosition, 0, len(matches))
+	for pos := range matches {
+		positions = append(positions, pos)
+	}
+	sort.Slice(positions, func(i, j int) bool {
+		a, b := positions[i], positions[j]
+		if a.Block != b.Block {
+			return a.Block < b.Block
+		}
+		if a.Tx != b.Tx {
+			return a.Tx < b.Tx
+		}
+		return a.Log < b.Log
+	})
+	return positions, nil
+}
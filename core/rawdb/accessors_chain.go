@@ -435,6 +435,141 @@ func DeleteReceipts(db DatabaseDeleter, hash common.Hash, number uint64) {
 	})
 }
 
+// ReadWitnessRLP retrieves the execution witness of a block in RLP encoding.
+func ReadWitnessRLP(db DatabaseReader, hash common.Hash, number uint64) rlp.RawValue {
+	var data []byte
+	Must("get witness", func() (err error) {
+		data, err = db.Get(numHashKey(witnessPrefix, number, hash))
+		if err == common.ErrNotFound {
+			err = nil
+		}
+		return
+	})
+	return data
+}
+
+// ReadWitness retrieves the execution witness of a block.
+func ReadWitness(db DatabaseReader, hash common.Hash, number uint64) *types.Witness {
+	data := ReadWitnessRLP(db, hash, number)
+	if len(data) == 0 {
+		return nil
+	}
+	witness := new(types.Witness)
+	if err := rlp.Decode(bytes.NewReader(data), witness); err != nil {
+		log.Error("Invalid block witness RLP", "hash", hash, "err", err)
+		return nil
+	}
+	return witness
+}
+
+// WriteWitness stores the execution witness of a block.
+func WriteWitness(db DatabaseWriter, hash common.Hash, number uint64, witness *types.Witness) {
+	data, err := rlp.EncodeToBytes(witness)
+	if err != nil {
+		log.Crit("Failed to RLP encode block witness", "err", err)
+	}
+	Must("put witness", func() error {
+		return db.Put(numHashKey(witnessPrefix, number, hash), data)
+	})
+}
+
+// DeleteWitness removes the execution witness of a block.
+func DeleteWitness(db DatabaseDeleter, hash common.Hash, number uint64) {
+	Must("delete witness", func() error {
+		return db.Delete(numHashKey(witnessPrefix, number, hash))
+	})
+}
+
+// ReadStateDiffRLP retrieves the state diff of a block in RLP encoding.
+func ReadStateDiffRLP(db DatabaseReader, hash common.Hash, number uint64) rlp.RawValue {
+	var data []byte
+	Must("get state diff", func() (err error) {
+		data, err = db.Get(numHashKey(stateDiffPrefix, number, hash))
+		if err == common.ErrNotFound {
+			err = nil
+		}
+		return
+	})
+	return data
+}
+
+// ReadStateDiff retrieves the state diff of a block.
+func ReadStateDiff(db DatabaseReader, hash common.Hash, number uint64) *types.StateDiff {
+	data := ReadStateDiffRLP(db, hash, number)
+	if len(data) == 0 {
+		return nil
+	}
+	diff := new(types.StateDiff)
+	if err := rlp.Decode(bytes.NewReader(data), diff); err != nil {
+		log.Error("Invalid state diff RLP", "hash", hash, "err", err)
+		return nil
+	}
+	return diff
+}
+
+// WriteStateDiff stores the state diff of a block.
+func WriteStateDiff(db DatabaseWriter, hash common.Hash, number uint64, diff *types.StateDiff) {
+	data, err := rlp.EncodeToBytes(diff)
+	if err != nil {
+		log.Crit("Failed to RLP encode state diff", "err", err)
+	}
+	Must("put state diff", func() error {
+		return db.Put(numHashKey(stateDiffPrefix, number, hash), data)
+	})
+}
+
+// DeleteStateDiff removes the state diff of a block.
+func DeleteStateDiff(db DatabaseDeleter, hash common.Hash, number uint64) {
+	Must("delete state diff", func() error {
+		return db.Delete(numHashKey(stateDiffPrefix, number, hash))
+	})
+}
+
+// ReadReverseDiffRLP retrieves the reverse state diff of a block in RLP encoding.
+func ReadReverseDiffRLP(db DatabaseReader, hash common.Hash, number uint64) rlp.RawValue {
+	var data []byte
+	Must("get reverse diff", func() (err error) {
+		data, err = db.Get(numHashKey(reverseDiffPrefix, number, hash))
+		if err == common.ErrNotFound {
+			err = nil
+		}
+		return
+	})
+	return data
+}
+
+// ReadReverseDiff retrieves the reverse state diff of a block.
+func ReadReverseDiff(db DatabaseReader, hash common.Hash, number uint64) *types.ReverseDiff {
+	data := ReadReverseDiffRLP(db, hash, number)
+	if len(data) == 0 {
+		return nil
+	}
+	diff := new(types.ReverseDiff)
+	if err := rlp.Decode(bytes.NewReader(data), diff); err != nil {
+		log.Error("Invalid reverse diff RLP", "hash", hash, "err", err)
+		return nil
+	}
+	return diff
+}
+
+// WriteReverseDiff stores the reverse state diff of a block.
+func WriteReverseDiff(db DatabaseWriter, hash common.Hash, number uint64, diff *types.ReverseDiff) {
+	data, err := rlp.EncodeToBytes(diff)
+	if err != nil {
+		log.Crit("Failed to RLP encode reverse diff", "err", err)
+	}
+	Must("put reverse diff", func() error {
+		return db.Put(numHashKey(reverseDiffPrefix, number, hash), data)
+	})
+}
+
+// DeleteReverseDiff removes the reverse state diff of a block.
+func DeleteReverseDiff(db DatabaseDeleter, hash common.Hash, number uint64) {
+	Must("delete reverse diff", func() error {
+		return db.Delete(numHashKey(reverseDiffPrefix, number, hash))
+	})
+}
+
 // ReadBlock retrieves an entire block corresponding to the hash, assembling it
 // back from the stored header and body. If either the header or body could not
 // be retrieved nil is returned.
@@ -465,6 +600,9 @@ func DeleteBlock(db common.Database, hash common.Hash, number uint64) {
 	DeleteHeader(db.GlobalTable(), db.HeaderTable(), hash, number)
 	DeleteBody(db.BodyTable(), hash, number)
 	DeleteTd(db.GlobalTable(), hash, number)
+	DeleteWitness(db.GlobalTable(), hash, number)
+	DeleteStateDiff(db.StateDiffTable(), hash, number)
+	DeleteReverseDiff(db.HistoryTable(), hash, number)
 }
 
 // FindCommonAncestor returns the last common ancestor of two block headers
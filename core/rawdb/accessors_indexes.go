@@ -18,6 +18,7 @@ package rawdb
 
 import (
 	"encoding/binary"
+	"errors"
 	"math/big"
 
 	"github.com/zeus-fyi/gochain/v4/params"
@@ -156,3 +157,124 @@ func WriteBloomBits(db DatabaseWriter, bit uint, section uint64, head common.Has
 		return db.Put(key[:], bits)
 	})
 }
+
+// LogPosition locates a log in the chain: the number of its block, the index
+// of its transaction in the block and its index in the transaction's receipt.
+type LogPosition struct {
+	Block uint64
+	Tx    uint32
+	Log   uint32
+}
+
+// Log index terms are an address, or a topic prefixed with its position.
+const (
+	logIndexAddressTerm byte = 'a'
+	logIndexTopicTerm   byte = 't'
+)
+
+// LogIndexAddressTerm returns the log index term matching logs of address.
+func LogIndexAddressTerm(address common.Address) []byte {
+	return append([]byte{logIndexAddressTerm}, address[:]...)
+}
+
+// LogIndexTopicTerm returns the log index term matching logs with topic at the
+// given position.
+func LogIndexTopicTerm(position int, topic common.Hash) []byte {
+	return append([]byte{logIndexTopicTerm, byte(position)}, topic[:]...)
+}
+
+// logIndexKey = logIndexPrefix + section start (uint64 big endian) + section head hash + term
+func logIndexKey(start uint64, head common.Hash, term []byte) []byte {
+	key := make([]byte, 1+8+common.HashLength+len(term))
+	key[0] = logIndexPrefix
+	binary.BigEndian.PutUint64(key[1:], start)
+	copy(key[9:], head[:])
+	copy(key[9+common.HashLength:], term)
+	return key
+}
+
+// ReadLogIndex retrieves the positions of the logs matching term in the log
+// index section starting at block start, which was built on the canonical
+// chain ending with head.
+func ReadLogIndex(db DatabaseReader, start uint64, head common.Hash, term []byte) []LogPosition {
+	var data []byte
+	Must("get log index", func() (err error) {
+		data, err = db.Get(logIndexKey(start, head, term))
+		if err == common.ErrNotFound {
+			err = nil
+		}
+		return
+	})
+	if len(data) == 0 {
+		return nil
+	}
+	positions, err := decodeLogPositions(start, data)
+	if err != nil {
+		log.Error("Invalid log index entry", "start", start, "head", head, "err", err)
+		return nil
+	}
+	return positions
+}
+
+// WriteLogIndex stores the positions of the logs matching term in the log
+// index section starting at block start. Positions must be in chain order.
+func WriteLogIndex(db DatabaseWriter, start uint64, head common.Hash, term []byte, positions []LogPosition) {
+	Must("put log index", func() error {
+		return db.Put(logIndexKey(start, head, term), encodeLogPositions(start, positions))
+	})
+}
+
+// HasLogIndexSection reports whether the log index section starting at block
+// start was completely built on the canonical chain ending with head.
+func HasLogIndexSection(db DatabaseReader, start uint64, head common.Hash) bool {
+	var ok bool
+	Must("has log index section", func() (err error) {
+		ok, err = db.Has(logIndexKey(start, head, nil))
+		return
+	})
+	return ok
+}
+
+// WriteLogIndexSection marks the log index section starting at block start as
+// completely built on the canonical chain ending with head.
+func WriteLogIndexSection(db DatabaseWriter, start uint64, head common.Hash) {
+	Must("put log index section", func() error {
+		return db.Put(logIndexKey(start, head, nil), []byte{1})
+	})
+}
+
+// encodeLogPositions packs positions as uvarint triplets, with block numbers
+// delta encoded starting from the section start.
+func encodeLogPositions(start uint64, positions []LogPosition) []byte {
+	buf := make([]byte, 0, len(positions)*3)
+	var tmp [binary.MaxVarintLen64]byte
+	prev := start
+	for _, p := range positions {
+		buf = append(buf, tmp[:binary.PutUvarint(tmp[:], p.Block-prev)]...)
+		buf = append(buf, tmp[:binary.PutUvarint(tmp[:], uint64(p.Tx))]...)
+		buf = append(buf, tmp[:binary.PutUvarint(tmp[:], uint64(p.Log))]...)
+		prev = p.Block
+	}
+	return buf
+}
+
+// decodeLogPositions unpacks positions encoded by encodeLogPositions.
+func decodeLogPositions(start uint64, data []byte) ([]LogPosition, error) {
+	var (
+		positions []LogPosition
+		fields    [3]uint64
+		prev      = start
+	)
+	for len(data) > 0 {
+		for i := range fields {
+			v, n := binary.Uvarint(data)
+			if n <= 0 {
+				return nil, errors.New("truncated log position")
+			}
+			fields[i], data = v, data[n:]
+		}
+		prev += fields[0]
+		positions = append(positions, LogPosition{Block: prev, Tx: uint32(fields[1]), Log: uint32(fields[2])})
+	}
+	return positions, nil
+}
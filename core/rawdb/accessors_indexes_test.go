@@ -18,6 +18,7 @@ package rawdb
 
 import (
 	"math/big"
+	"reflect"
 	"testing"
 
 	"github.com/zeus-fyi/gochain/v4/common"
@@ -106,3 +107,28 @@ func TestLookupStorage(t *testing.T) {
 		})
 	}
 }
+
+// Tests that log index entries can be stored and retrieved, and that entries
+// of a section built on another chain are not returned.
+func TestLogIndexStorage(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+
+	head := common.HexToHash("0x01")
+	term := LogIndexTopicTerm(0, common.HexToHash("0xdd"))
+	positions := []LogPosition{{1024, 0, 0}, {1024, 0, 3}, {1030, 7, 1}, {2047, 300, 2}}
+
+	if entries := ReadLogIndex(db.LogIndexTable(), 1024, head, term); entries != nil {
+		t.Fatalf("non existent entries returned: %v", entries)
+	}
+	WriteLogIndex(db.LogIndexTable(), 1024, head, term, positions)
+	entries := ReadLogIndex(db.LogIndexTable(), 1024, head, term)
+	if !reflect.DeepEqual(entries, positions) {
+		t.Fatalf("entries mismatch: have %v, want %v", entries, positions)
+	}
+	if entries := ReadLogIndex(db.LogIndexTable(), 1024, common.HexToHash("0x02"), term); entries != nil {
+		t.Fatalf("entries of reorged section returned: %v", entries)
+	}
+	if entries := ReadLogIndex(db.LogIndexTable(), 1024, head, LogIndexTopicTerm(1, common.HexToHash("0xdd"))); entries != nil {
+		t.Fatalf("entries of other topic position returned: %v", entries)
+	}
+}
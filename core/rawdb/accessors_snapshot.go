@@ -0,0 +1,198 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"encoding/binary"
+
+	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/log"
+	"github.com/zeus-fyi/gochain/v4/rlp"
+)
+
+// SnapshotGenerator is the persisted progress of the flat state snapshot. All
+// snapshot entries are keyed by epoch, so that starting a new generation simply
+// orphans the entries of the previous one.
+type SnapshotGenerator struct {
+	Epoch  uint64 // Epoch of the snapshot entries
+	Done   bool   // Whether the snapshot has been fully generated
+	Marker []byte // Hash of the last account generated, empty if none yet
+}
+
+// ReadSnapshotRoot retrieves the root of the flat state snapshot on disk.
+func ReadSnapshotRoot(db DatabaseReader) common.Hash {
+	var data []byte
+	Must("get snapshot root", func() (err error) {
+		data, err = db.Get(snapshotRootKey)
+		if err == common.ErrNotFound {
+			err = nil
+		}
+		return
+	})
+	if len(data) != common.HashLength {
+		return common.Hash{}
+	}
+	return common.BytesToHash(data)
+}
+
+// WriteSnapshotRoot stores the root of the flat state snapshot on disk.
+func WriteSnapshotRoot(db DatabaseWriter, root common.Hash) {
+	Must("put snapshot root", func() error {
+		return db.Put(snapshotRootKey, root[:])
+	})
+}
+
+// ReadSnapshotGenerator retrieves the generation progress of the flat state
+// snapshot, or nil if there is none.
+func ReadSnapshotGenerator(db DatabaseReader) *SnapshotGenerator {
+	var data []byte
+	Must("get snapshot generator", func() (err error) {
+		data, err = db.Get(snapshotGeneratorKey)
+		if err == common.ErrNotFound {
+			err = nil
+		}
+		return
+	})
+	if len(data) == 0 {
+		return nil
+	}
+	gen := new(SnapshotGenerator)
+	if err := rlp.DecodeBytes(data, gen); err != nil {
+		log.Error("Invalid snapshot generator RLP", "err", err)
+		return nil
+	}
+	return gen
+}
+
+// WriteSnapshotGenerator stores the generation progress of the flat state snapshot.
+func WriteSnapshotGenerator(db DatabaseWriter, gen *SnapshotGenerator) {
+	data, err := rlp.EncodeToBytes(gen)
+	if err != nil {
+		log.Crit("Failed to RLP encode snapshot generator", "err", err)
+	}
+	Must("put snapshot generator", func() error {
+		return db.Put(snapshotGeneratorKey, data)
+	})
+}
+
+// ReadAccountSnapshot retrieves the RLP encoded account of the given epoch from
+// the flat state snapshot, or nil if not found.
+func ReadAccountSnapshot(db DatabaseReader, epoch uint64, accountHash common.Hash) []byte {
+	var data []byte
+	Must("get account snapshot", func() (err error) {
+		data, err = db.Get(snapshotAccountKey(epoch, accountHash))
+		if err == common.ErrNotFound {
+			err = nil
+		}
+		return
+	})
+	return data
+}
+
+// WriteAccountSnapshot stores an RLP encoded account in the flat state snapshot.
+func WriteAccountSnapshot(db DatabaseWriter, epoch uint64, accountHash common.Hash, entry []byte) {
+	Must("put account snapshot", func() error {
+		return db.Put(snapshotAccountKey(epoch, accountHash), entry)
+	})
+}
+
+// DeleteAccountSnapshot removes an account from the flat state snapshot.
+func DeleteAccountSnapshot(db DatabaseDeleter, epoch uint64, accountHash common.Hash) {
+	Must("delete account snapshot", func() error {
+		return db.Delete(snapshotAccountKey(epoch, accountHash))
+	})
+}
+
+// ReadStorageSnapshot retrieves the RLP encoded storage slot of an account
+// incarnation from the flat state snapshot, or nil if not found.
+func ReadStorageSnapshot(db DatabaseReader, epoch uint64, accountHash common.Hash, incarnation uint64, storageHash common.Hash) []byte {
+	var data []byte
+	Must("get storage snapshot", func() (err error) {
+		data, err = db.Get(snapshotStorageKey(epoch, accountHash, incarnation, storageHash))
+		if err == common.ErrNotFound {
+			err = nil
+		}
+		return
+	})
+	return data
+}
+
+// WriteStorageSnapshot stores an RLP encoded storage slot of an account
+// incarnation in the flat state snapshot.
+func WriteStorageSnapshot(db DatabaseWriter, epoch uint64, accountHash common.Hash, incarnation uint64, storageHash common.Hash, entry []byte) {
+	Must("put storage snapshot", func() error {
+		return db.Put(snapshotStorageKey(epoch, accountHash, incarnation, storageHash), entry)
+	})
+}
+
+// DeleteStorageSnapshot removes a storage slot of an account incarnation from
+// the flat state snapshot.
+func DeleteStorageSnapshot(db DatabaseDeleter, epoch uint64, accountHash common.Hash, incarnation uint64, storageHash common.Hash) {
+	Must("delete storage snapshot", func() error {
+		return db.Delete(snapshotStorageKey(epoch, accountHash, incarnation, storageHash))
+	})
+}
+
+// ReadSnapshotIncarnation retrieves the number of times an account's storage
+// has been wiped in the given snapshot epoch.
+func ReadSnapshotIncarnation(db DatabaseReader, epoch uint64, accountHash common.Hash) uint64 {
+	var data []byte
+	Must("get snapshot incarnation", func() (err error) {
+		data, err = db.Get(snapshotIncarnationKey(epoch, accountHash))
+		if err == common.ErrNotFound {
+			err = nil
+		}
+		return
+	})
+	if len(data) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(data)
+}
+
+// WriteSnapshotIncarnation stores the number of times an account's storage has
+// been wiped in the given snapshot epoch.
+func WriteSnapshotIncarnation(db DatabaseWriter, epoch uint64, accountHash common.Hash, incarnation uint64) {
+	Must("put snapshot incarnation", func() error {
+		return db.Put(snapshotIncarnationKey(epoch, accountHash), encodeBlockNumber(incarnation))
+	})
+}
+
+// SnapshotEpochPrefixes returns the key prefixes of all flat state snapshot
+// entries of the given epoch.
+func SnapshotEpochPrefixes(epoch uint64) [][]byte {
+	prefixes := make([][]byte, 0, 3)
+	for _, prefix := range []byte{snapshotAccountPrefix, snapshotStoragePrefix, snapshotIncarnationPrefix} {
+		k := make([]byte, 9)
+		k[0] = prefix
+		binary.BigEndian.PutUint64(k[1:], epoch)
+		prefixes = append(prefixes, k)
+	}
+	return prefixes
+}
+
+// SnapshotStoragePrefix returns the key prefix of the storage slots of all
+// incarnations of an account in the given epoch.
+func SnapshotStoragePrefix(epoch uint64, accountHash common.Hash) []byte {
+	return snapshotStorageKey(epoch, accountHash, 0, common.Hash{})[:41]
+}
+
+// SnapshotStorageKeyIncarnation returns the account incarnation a storage
+// snapshot key belongs to.
+func SnapshotStorageKeyIncarnation(key []byte) uint64 {
+	return binary.BigEndian.Uint64(key[41:49])
+}
@@ -33,6 +33,14 @@ const (
 	blockReceiptsPrefix byte = 'r' // blockReceiptsPrefix + num (uint64 big endian) + hash -> block receipts
 	lookupPrefix        byte = 'l' // lookupPrefix + hash -> transaction/receipt lookup metadata
 	bloomBitsPrefix     byte = 'B' // bloomBitsPrefix + bit (uint16 big endian) + section (uint64 big endian) + hash -> bloom bits
+	witnessPrefix       byte = 'w' // witnessPrefix + num (uint64 big endian) + hash -> block execution witness
+	stateDiffPrefix     byte = 'D' // stateDiffPrefix + num (uint64 big endian) + hash -> block state diff
+	reverseDiffPrefix   byte = 'R' // reverseDiffPrefix + num (uint64 big endian) + hash -> block reverse state diff
+	logIndexPrefix      byte = 'g' // logIndexPrefix + section start (uint64 big endian) + section head hash + term -> log positions
+
+	snapshotAccountPrefix     byte = 'a' // snapshotAccountPrefix + epoch (uint64 big endian) + account hash -> account RLP
+	snapshotStoragePrefix     byte = 'o' // snapshotStoragePrefix + epoch (uint64 big endian) + account hash + incarnation (uint64 big endian) + storage hash -> slot RLP
+	snapshotIncarnationPrefix byte = 'd' // snapshotIncarnationPrefix + epoch (uint64 big endian) + account hash -> incarnation (uint64 big endian)
 )
 
 // The fields below define the low level database schema prefixing.
@@ -52,11 +60,18 @@ var (
 	// fastTrieProgressKey tracks the number of trie entries imported during fast sync.
 	fastTrieProgressKey = []byte("TrieSync")
 
+	// snapshotRootKey tracks the state root of the flat state snapshot on disk.
+	snapshotRootKey = []byte("SnapshotRoot")
+
+	// snapshotGeneratorKey tracks the epoch and generation progress of the flat state snapshot.
+	snapshotGeneratorKey = []byte("SnapshotGenerator")
+
 	preimagePrefix = "secure-key-"              // preimagePrefix + hash -> preimage
 	configPrefix   = []byte("ethereum-config-") // config prefix for the db
 
 	// Chain index prefixes (use `i` + single byte to avoid mixing data types).
 	BloomBitsIndexPrefix = []byte("iB") // BloomBitsIndexPrefix is the data table of a chain indexer to track its progress
+	LogIndexPrefix       = []byte("iL") // LogIndexPrefix is the data table of the log indexer to track its progress
 )
 
 // LegacyTxLookupEntry is the legacy TxLookupEntry definition with some unnecessary
@@ -106,6 +121,35 @@ func hashKey(prefix byte, hash common.Hash) []byte {
 	return k[:]
 }
 
+// snapshotAccountKey = snapshotAccountPrefix + epoch (uint64 big endian) + account hash
+func snapshotAccountKey(epoch uint64, accountHash common.Hash) []byte {
+	var k [41]byte
+	k[0] = snapshotAccountPrefix
+	binary.BigEndian.PutUint64(k[1:], epoch)
+	copy(k[9:], accountHash[:])
+	return k[:]
+}
+
+// snapshotStorageKey = snapshotStoragePrefix + epoch (uint64 big endian) + account hash + incarnation (uint64 big endian) + storage hash
+func snapshotStorageKey(epoch uint64, accountHash common.Hash, incarnation uint64, storageHash common.Hash) []byte {
+	var k [81]byte
+	k[0] = snapshotStoragePrefix
+	binary.BigEndian.PutUint64(k[1:], epoch)
+	copy(k[9:], accountHash[:])
+	binary.BigEndian.PutUint64(k[41:], incarnation)
+	copy(k[49:], storageHash[:])
+	return k[:]
+}
+
+// snapshotIncarnationKey = snapshotIncarnationPrefix + epoch (uint64 big endian) + account hash
+func snapshotIncarnationKey(epoch uint64, accountHash common.Hash) []byte {
+	var k [41]byte
+	k[0] = snapshotIncarnationPrefix
+	binary.BigEndian.PutUint64(k[1:], epoch)
+	copy(k[9:], accountHash[:])
+	return k[:]
+}
+
 // preimageKey = preimagePrefix + hash
 func preimageKey(hash common.Hash) []byte {
 	return append([]byte(preimagePrefix), hash.Bytes()...)
@@ -22,6 +22,7 @@ import (
 
 	lru "github.com/hashicorp/golang-lru"
 	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/core/state/snapshot"
 	"github.com/zeus-fyi/gochain/v4/trie"
 )
 
@@ -56,6 +57,10 @@ type Database interface {
 
 	// TrieDB retrieves the low level trie database used for data storage.
 	TrieDB() *trie.Database
+
+	// Snapshots retrieves the flat state snapshot consulted before the tries,
+	// or nil if none is maintained.
+	Snapshots() *snapshot.Tree
 }
 
 // Trie is a Ethereum Merkle Trie.
@@ -164,6 +169,28 @@ func (db *cachingDB) TrieDB() *trie.Database {
 	return db.db
 }
 
+// Snapshots returns nil, as a plain caching database maintains no snapshot.
+func (db *cachingDB) Snapshots() *snapshot.Tree {
+	return nil
+}
+
+// snapshotDB is a Database which also maintains a flat state snapshot.
+type snapshotDB struct {
+	Database
+	snaps *snapshot.Tree
+}
+
+// WithSnapshots returns a Database sharing the tries and caches of db, whose
+// states also read from and update the given snapshot tree.
+func WithSnapshots(db Database, snaps *snapshot.Tree) Database {
+	return &snapshotDB{Database: db, snaps: snaps}
+}
+
+// Snapshots retrieves the flat state snapshot.
+func (db *snapshotDB) Snapshots() *snapshot.Tree {
+	return db.snaps
+}
+
 // cachedTrie inserts its trie into a cachingDB on commit.
 type cachedTrie struct {
 	*trie.SecureTrie
@@ -0,0 +1,240 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"sync"
+
+	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/core/state/snapshot"
+	"github.com/zeus-fyi/gochain/v4/core/types"
+	"github.com/zeus-fyi/gochain/v4/crypto"
+	"github.com/zeus-fyi/gochain/v4/log"
+	"github.com/zeus-fyi/gochain/v4/rlp"
+	"github.com/zeus-fyi/gochain/v4/trie"
+)
+
+// ReverseDiffLoader retrieves the reverse diff of the canonical block with the
+// given number.
+type ReverseDiffLoader func(number uint64) (*types.ReverseDiff, error)
+
+// NewHistoric returns the state after block number, whose state root is root,
+// reconstructed from the available state of the later block head by undoing
+// the reverse diffs of the blocks in between.
+//
+// Each read walks the reverse diffs upwards from number+1 until the first one
+// touching the entry, falling back to the state of head: its snapshot layer if
+// available and able to serve the read, its tries otherwise. Reads that fail,
+// for a missing reverse diff say, are reported through the Error method of
+// the returned state rather than treated as absent entries. The returned
+// state is meant for reads; its trie is empty, so proving or committing it
+// fails with ErrHistoricState and its intermediate root is the zero hash.
+func NewHistoric(db Database, root common.Hash, number uint64, headRoot common.Hash, head uint64, load ReverseDiffLoader) (*StateDB, error) {
+	tries, err := newTrieReader(db, headRoot)
+	if err != nil {
+		return nil, err
+	}
+	var base snapshot.Snapshot = tries
+	if snaps := db.Snapshots(); snaps != nil {
+		if layer := snaps.Snapshot(headRoot); layer != nil {
+			base = &fallbackReader{primary: layer, fallback: tries}
+		}
+	}
+	snap := &historySnapshot{
+		root:   root,
+		number: number,
+		head:   head,
+		load:   load,
+		base:   base,
+		codes:  make(map[common.Hash][]byte),
+	}
+	sdb, err := New(types.EmptyRootHash, &historyDatabase{Database: db, snap: snap})
+	if err != nil {
+		return nil, err
+	}
+	sdb.snap, sdb.historic = snap, true
+	sdb.snapDestructs = make(map[common.Hash]struct{})
+	sdb.snapAccounts = make(map[common.Hash][]byte)
+	sdb.snapStorage = make(map[common.Hash]map[common.Hash][]byte)
+	return sdb, nil
+}
+
+// historySnapshot serves the entries of a past state from reverse diffs.
+type historySnapshot struct {
+	root   common.Hash
+	number uint64
+	head   uint64
+	load   ReverseDiffLoader
+	base   snapshot.Snapshot
+
+	lock  sync.Mutex
+	codes map[common.Hash][]byte // Code of destructed contracts seen so far
+}
+
+func (s *historySnapshot) Root() common.Hash { return s.root }
+
+// lookup returns the entry of the account in the first reverse diff after the
+// snapshot's block which changed it, or nil if none did.
+func (s *historySnapshot) lookup(hash common.Hash, fn func(*types.ReverseAccount) bool) (*types.ReverseAccount, error) {
+	for n := s.number + 1; n <= s.head; n++ {
+		diff, err := s.load(n)
+		if err != nil {
+			log.Error("Failed to load reverse diff", "number", n, "err", err)
+			return nil, err
+		}
+		if account := diff.Account(hash); account != nil && fn(account) {
+			s.lock.Lock()
+			for _, code := range diff.Codes {
+				s.codes[crypto.Keccak256Hash(code)] = code
+			}
+			s.lock.Unlock()
+			return account, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *historySnapshot) Account(hash common.Hash) ([]byte, error) {
+	account, err := s.lookup(hash, func(*types.ReverseAccount) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+	if account == nil {
+		return s.base.Account(hash)
+	}
+	return account.Account, nil
+}
+
+func (s *historySnapshot) Storage(accountHash, storageHash common.Hash) ([]byte, error) {
+	account, err := s.lookup(accountHash, func(account *types.ReverseAccount) bool {
+		return len(account.Account) == 0 || account.Wiped || account.Slot(storageHash) != nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if account == nil {
+		return s.base.Storage(accountHash, storageHash)
+	}
+	if slot := account.Slot(storageHash); slot != nil {
+		return slot.Value, nil
+	}
+	return nil, nil
+}
+
+func (s *historySnapshot) code(hash common.Hash) []byte {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.codes[hash]
+}
+
+// historyDatabase serves the code of contracts destructed since the historic
+// block, which may be gone from the wrapped database.
+type historyDatabase struct {
+	Database
+	snap *historySnapshot
+}
+
+func (db *historyDatabase) ContractCode(addrHash, codeHash common.Hash) ([]byte, error) {
+	if code := db.snap.code(codeHash); code != nil {
+		return code, nil
+	}
+	return db.Database.ContractCode(addrHash, codeHash)
+}
+
+func (db *historyDatabase) ContractCodeSize(addrHash, codeHash common.Hash) (int, error) {
+	code, err := db.ContractCode(addrHash, codeHash)
+	return len(code), err
+}
+
+// Snapshots returns nil, the historic snapshot is installed explicitly.
+func (db *historyDatabase) Snapshots() *snapshot.Tree {
+	return nil
+}
+
+// fallbackReader serves snapshot reads from a snapshot layer, turning to the
+// tries of the same state whenever the layer can't serve a read, because it is
+// still being generated or went stale.
+type fallbackReader struct {
+	primary  snapshot.Snapshot
+	fallback snapshot.Snapshot
+}
+
+func (r *fallbackReader) Root() common.Hash { return r.primary.Root() }
+
+func (r *fallbackReader) Account(hash common.Hash) ([]byte, error) {
+	enc, err := r.primary.Account(hash)
+	if err != nil {
+		return r.fallback.Account(hash)
+	}
+	return enc, nil
+}
+
+func (r *fallbackReader) Storage(accountHash, storageHash common.Hash) ([]byte, error) {
+	enc, err := r.primary.Storage(accountHash, storageHash)
+	if err != nil {
+		return r.fallback.Storage(accountHash, storageHash)
+	}
+	return enc, nil
+}
+
+// trieReader serves snapshot reads from the tries of a state.
+type trieReader struct {
+	db       Database
+	root     common.Hash
+	accounts *trie.Trie
+
+	lock    sync.Mutex
+	storage map[common.Hash]*trie.Trie
+}
+
+func newTrieReader(db Database, root common.Hash) (*trieReader, error) {
+	tr, err := trie.New(root, db.TrieDB())
+	if err != nil {
+		return nil, err
+	}
+	return &trieReader{db: db, root: root, accounts: tr, storage: make(map[common.Hash]*trie.Trie)}, nil
+}
+
+func (r *trieReader) Root() common.Hash { return r.root }
+
+func (r *trieReader) Account(hash common.Hash) ([]byte, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.accounts.TryGet(hash[:])
+}
+
+func (r *trieReader) Storage(accountHash, storageHash common.Hash) ([]byte, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	tr := r.storage[accountHash]
+	if tr == nil {
+		enc, err := r.accounts.TryGet(accountHash[:])
+		if err != nil || len(enc) == 0 {
+			return nil, err
+		}
+		var account Account
+		if err := rlp.DecodeBytes(enc, &account); err != nil {
+			return nil, err
+		}
+		if tr, err = trie.New(account.Root, r.db.TrieDB()); err != nil {
+			return nil, err
+		}
+		r.storage[accountHash] = tr
+	}
+	return tr.TryGet(storageHash[:])
+}
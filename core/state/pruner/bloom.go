@@ -0,0 +1,145 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package pruner
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/zeus-fyi/gochain/v4/common"
+)
+
+// bloomHashes is the number of bit positions set per key.
+const bloomHashes = 4
+
+var errInvalidBloom = errors.New("invalid state bloom")
+
+// stateBloom is a bloom filter over the hashes of trie and code nodes. The keys
+// are uniformly distributed already, so the bit positions are taken directly
+// from them.
+type stateBloom struct {
+	bits []uint64
+}
+
+// newStateBloom creates a bloom filter of the given size in bytes.
+func newStateBloom(size uint64) *stateBloom {
+	if size < 8 {
+		size = 8
+	}
+	return &stateBloom{bits: make([]uint64, size/8)}
+}
+
+// positions returns the bit positions of a 32 byte key.
+func (b *stateBloom) positions(key []byte) [bloomHashes]uint64 {
+	var pos [bloomHashes]uint64
+	n := uint64(len(b.bits)) * 64
+	for i := range pos {
+		pos[i] = binary.BigEndian.Uint64(key[i*8:]) % n
+	}
+	return pos
+}
+
+// add inserts a node hash into the filter.
+func (b *stateBloom) add(hash common.Hash) {
+	for _, p := range b.positions(hash[:]) {
+		b.bits[p/64] |= 1 << (p % 64)
+	}
+}
+
+// contains reports whether the key may have been added. Keys which are not
+// hashes are reported as present, so that they are never pruned.
+func (b *stateBloom) contains(key []byte) bool {
+	if len(key) != common.HashLength {
+		return true
+	}
+	for _, p := range b.positions(key) {
+		if b.bits[p/64]&(1<<(p%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// write persists the filter into a gzipped file, atomically replacing any
+// previous one.
+func (b *stateBloom) write(path string) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(f)
+	bw := bufio.NewWriter(zw)
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(len(b.bits)))
+	bw.Write(buf)
+	for _, word := range b.bits {
+		binary.BigEndian.PutUint64(buf, word)
+		bw.Write(buf)
+	}
+	if err := bw.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// loadStateBloom reads back a filter persisted by write.
+func loadStateBloom(path string) (*stateBloom, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(zr)
+	buf := make([]byte, 8)
+	if _, err := io.ReadFull(br, buf); err != nil {
+		return nil, err
+	}
+	words := binary.BigEndian.Uint64(buf)
+	if words == 0 {
+		return nil, errInvalidBloom
+	}
+	b := &stateBloom{bits: make([]uint64, words)}
+	for i := range b.bits {
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return nil, err
+		}
+		b.bits[i] = binary.BigEndian.Uint64(buf)
+	}
+	return b, nil
+}
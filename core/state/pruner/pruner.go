@@ -0,0 +1,296 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package pruner implements offline pruning of the state database, deleting
+// all trie and code nodes which are not reachable from a set of state roots.
+//
+// Pruning runs in two phases. First the nodes of the retained states are
+// marked in a bloom filter, which is then persisted. Second, every node of the
+// global table missing from the filter is deleted. Once the filter is persisted
+// the sweep is resumed from it if interrupted, and nothing may write to the
+// database until it completes, as new nodes would be missing from the filter.
+package pruner
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/core/rawdb"
+	"github.com/zeus-fyi/gochain/v4/core/state"
+	"github.com/zeus-fyi/gochain/v4/core/types"
+	"github.com/zeus-fyi/gochain/v4/crypto"
+	"github.com/zeus-fyi/gochain/v4/ethdb"
+	"github.com/zeus-fyi/gochain/v4/log"
+	"github.com/zeus-fyi/gochain/v4/rlp"
+	"github.com/zeus-fyi/gochain/v4/trie"
+)
+
+var (
+	// errNotIterable is returned if the global table can't enumerate its contents.
+	errNotIterable = errors.New("database does not support iteration")
+
+	// errNoHead is returned if the database has no head block.
+	errNoHead = errors.New("head block missing")
+)
+
+// BloomFileName is the name of the persisted bloom filter within the instance
+// directory.
+const BloomFileName = "statebloom.bf.gz"
+
+var emptyCode = crypto.Keccak256Hash(nil)
+
+// Pruner deletes the trie and code nodes which are not reachable from a set of
+// retained state roots from an offline database.
+type Pruner struct {
+	db        common.Database
+	bloomPath string // File persisting the filter of retained nodes while sweeping
+	bloomSize uint64 // Size of the filter in bytes
+}
+
+// NewPruner creates a pruner for the database, using a bloom filter of the
+// given size in bytes persisted at bloomPath.
+func NewPruner(db common.Database, bloomPath string, bloomSize uint64) *Pruner {
+	return &Pruner{
+		db:        db,
+		bloomPath: bloomPath,
+		bloomSize: bloomSize,
+	}
+}
+
+// Prune retains the states of the given roots, deleting all other trie and code
+// nodes. The first root must be present in full; others which are missing or
+// incomplete are only retained partially.
+func (p *Pruner) Prune(roots []common.Hash) error {
+	if len(roots) == 0 {
+		return errors.New("no state roots to retain")
+	}
+	if _, ok := p.db.GlobalTable().(ethdb.Iteratee); !ok {
+		return errNotIterable
+	}
+	var (
+		start  = time.Now()
+		triedb = trie.NewDatabase(p.db.GlobalTable())
+		bloom  = newStateBloom(p.bloomSize)
+		parent common.Hash
+	)
+	// Mark each state, only visiting the nodes it doesn't share with the last
+	// one marked in full.
+	for i, root := range roots {
+		nodes, err := markState(triedb, bloom, root, parent)
+		if err != nil {
+			if i == 0 {
+				return fmt.Errorf("state %x: %v", root, err)
+			}
+			log.Warn("Skipping incomplete state", "root", root, "err", err)
+			continue
+		}
+		log.Info("Marked state to retain", "root", root, "nodes", nodes, "elapsed", common.PrettyDuration(time.Since(start)))
+		parent = root
+	}
+	if err := bloom.write(p.bloomPath); err != nil {
+		return err
+	}
+	return sweep(p.db.GlobalTable(), bloom, p.bloomPath)
+}
+
+// RecoverPruning completes a pruning run interrupted after its bloom filter was
+// persisted, reporting whether there was one. It must be called before the
+// database is written to.
+func RecoverPruning(db common.Database, bloomPath string) (bool, error) {
+	if !common.FileExist(bloomPath) {
+		return false, nil
+	}
+	bloom, err := loadStateBloom(bloomPath)
+	if err != nil {
+		return true, fmt.Errorf("state bloom %s: %v", bloomPath, err)
+	}
+	log.Info("Resuming interrupted state pruning", "bloom", bloomPath)
+	return true, sweep(db.GlobalTable(), bloom, bloomPath)
+}
+
+// RetainedRoots returns the state roots to retain when pruning: the target root
+// followed by those of up to the given number of most recent canonical blocks
+// and of the genesis block, skipping the ones whose root node is missing.
+func RetainedRoots(db common.Database, target common.Hash, recent uint64) ([]common.Hash, error) {
+	head := rawdb.ReadHeadBlockHash(db.GlobalTable())
+	number := rawdb.ReadHeaderNumber(db.GlobalTable(), head)
+	if number == nil {
+		return nil, errNoHead
+	}
+	var (
+		roots = []common.Hash{target}
+		seen  = map[common.Hash]bool{target: true}
+	)
+	add := func(n uint64) {
+		header := rawdb.ReadHeader(db.HeaderTable(), rawdb.ReadCanonicalHash(db, n), n)
+		if header == nil || seen[header.Root] {
+			return
+		}
+		if ok, _ := db.GlobalTable().Has(header.Root[:]); ok {
+			roots = append(roots, header.Root)
+			seen[header.Root] = true
+		}
+	}
+	for i := uint64(0); i < recent && i <= *number; i++ {
+		add(*number - i)
+	}
+	add(0)
+	return roots, nil
+}
+
+// markState adds the nodes of the state trie of root, with its storage tries and
+// contract code, to the bloom. If a parent state is given, which must have been
+// marked in full, only the nodes not shared with it are visited.
+func markState(triedb *trie.Database, bloom *stateBloom, root, parent common.Hash) (int, error) {
+	accTrie, err := trie.New(root, triedb)
+	if err != nil {
+		return 0, err
+	}
+	var (
+		it         = accTrie.NodeIterator(nil)
+		parentTrie *trie.Trie
+		nodes      int
+	)
+	if parent != (common.Hash{}) {
+		if parentTrie, err = trie.New(parent, triedb); err != nil {
+			return 0, err
+		}
+		it, _ = trie.NewDifferenceIterator(parentTrie.NodeIterator(nil), it)
+	}
+	for it.Next(true) {
+		if hash := it.Hash(); hash != (common.Hash{}) {
+			bloom.add(hash)
+			nodes++
+		}
+		if !it.Leaf() {
+			continue
+		}
+		var acc state.Account
+		if err := rlp.DecodeBytes(it.LeafBlob(), &acc); err != nil {
+			return nodes, err
+		}
+		if acc.CodeHash != emptyCode {
+			bloom.add(acc.CodeHash)
+		}
+		if acc.Root == types.EmptyRootHash {
+			continue
+		}
+		var parentRoot common.Hash
+		if parentTrie != nil {
+			if enc, _ := parentTrie.TryGet(it.LeafKey()); len(enc) > 0 {
+				var prev state.Account
+				if err := rlp.DecodeBytes(enc, &prev); err == nil {
+					parentRoot = prev.Root
+				}
+			}
+		}
+		n, err := markStorage(triedb, bloom, acc.Root, parentRoot)
+		if err != nil {
+			return nodes, err
+		}
+		nodes += n
+	}
+	return nodes, it.Error()
+}
+
+// markStorage adds the nodes of a storage trie to the bloom, skipping the ones
+// shared with the parent trie if given.
+func markStorage(triedb *trie.Database, bloom *stateBloom, root, parent common.Hash) (int, error) {
+	if root == parent {
+		return 0, nil
+	}
+	storeTrie, err := trie.New(root, triedb)
+	if err != nil {
+		return 0, err
+	}
+	it := storeTrie.NodeIterator(nil)
+	if parent != (common.Hash{}) {
+		parentTrie, err := trie.New(parent, triedb)
+		if err != nil {
+			return 0, err
+		}
+		it, _ = trie.NewDifferenceIterator(parentTrie.NodeIterator(nil), it)
+	}
+	var nodes int
+	for it.Next(true) {
+		if hash := it.Hash(); hash != (common.Hash{}) {
+			bloom.add(hash)
+			nodes++
+		}
+	}
+	return nodes, it.Error()
+}
+
+// sweep deletes all trie and code nodes missing from the bloom from the table,
+// compacts it, and finally removes the persisted bloom.
+func sweep(table common.Table, bloom *stateBloom, bloomPath string) error {
+	iter, ok := table.(ethdb.Iteratee)
+	if !ok {
+		return errNotIterable
+	}
+	var (
+		start   = time.Now()
+		logged  = time.Now()
+		batch   = table.NewBatch()
+		pending int
+		count   int
+		size    common.StorageSize
+	)
+	err := iter.Iterate(func(key, value []byte) error {
+		if bloom.contains(key) || bytes.Equal(key, emptyCode[:]) {
+			return nil
+		}
+		if err := batch.Delete(common.CopyBytes(key)); err != nil {
+			return err
+		}
+		pending += len(key)
+		count++
+		size += common.StorageSize(len(key) + len(value))
+
+		if pending >= ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch.Reset()
+			pending = 0
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Pruning state data", "nodes", count, "size", size, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	log.Info("Pruned state data", "nodes", count, "size", size, "elapsed", common.PrettyDuration(time.Since(start)))
+
+	if compacter, ok := table.(ethdb.Compacter); ok {
+		cstart := time.Now()
+		if err := compacter.CompactStorage(); err != nil {
+			return err
+		}
+		log.Info("Compacted database", "elapsed", common.PrettyDuration(time.Since(cstart)))
+	}
+	return os.Remove(bloomPath)
+}
@@ -0,0 +1,168 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package pruner
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/core/state"
+	"github.com/zeus-fyi/gochain/v4/crypto"
+	"github.com/zeus-fyi/gochain/v4/ethdb"
+)
+
+// commitState applies the changes on top of the state of root and persists the
+// result, returning its root.
+func commitState(t *testing.T, sdb state.Database, root common.Hash, change func(*state.StateDB)) common.Hash {
+	statedb, err := state.New(root, sdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	change(statedb)
+	if root, err = statedb.Commit(false); err != nil {
+		t.Fatal(err)
+	}
+	if err := sdb.TrieDB().Commit(root, false); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+// checkState verifies that all nodes of the state of root are present.
+func checkState(t *testing.T, db *ethdb.MemDatabase, root common.Hash) {
+	t.Helper()
+	if _, err := markState(state.NewDatabase(db).TrieDB(), newStateBloom(1024), root, common.Hash{}); err != nil {
+		t.Fatalf("state %x incomplete: %v", root, err)
+	}
+}
+
+// hashKeys returns the number of trie and code nodes in the database.
+func hashKeys(db *ethdb.MemDatabase) int {
+	var n int
+	for _, key := range db.Keys() {
+		if len(key) == common.HashLength {
+			n++
+		}
+	}
+	return n
+}
+
+func TestPrune(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pruner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		db        = ethdb.NewMemDatabase()
+		sdb       = state.NewDatabase(db)
+		contract  = common.BytesToAddress([]byte{0x01})
+		code      = []byte{0x60, 0x00}
+		bloomPath = filepath.Join(dir, BloomFileName)
+	)
+	// An old state, superseded in full, and two recent states sharing nodes
+	old := commitState(t, sdb, common.Hash{}, func(s *state.StateDB) {
+		s.SetCode(contract, []byte{0x60, 0x01})
+		for i := byte(0); i < 16; i++ {
+			s.SetState(contract, common.Hash{i}, common.Hash{0xff, i})
+		}
+	})
+	root1 := commitState(t, sdb, common.Hash{}, func(s *state.StateDB) {
+		s.SetCode(contract, code)
+		for i := byte(0); i < 16; i++ {
+			s.SetState(contract, common.Hash{i}, common.Hash{i + 1})
+			s.SetBalance(common.BytesToAddress([]byte{0x10 + i}), big.NewInt(int64(i)+1))
+		}
+	})
+	root2 := commitState(t, sdb, root1, func(s *state.StateDB) {
+		s.SetState(contract, common.Hash{0}, common.Hash{0xaa})
+		s.SetBalance(common.BytesToAddress([]byte{0x10}), big.NewInt(100))
+	})
+	db.Put([]byte("LastBlock"), []byte{0x01})
+	before := hashKeys(db)
+
+	if err := NewPruner(db, bloomPath, 1024*1024).Prune([]common.Hash{root2, root1}); err != nil {
+		t.Fatal(err)
+	}
+	checkState(t, db, root1)
+	checkState(t, db, root2)
+	if ok, _ := db.Has(crypto.Keccak256(code)); !ok {
+		t.Error("retained code pruned")
+	}
+	if ok, _ := db.Has(crypto.Keccak256([]byte{0x60, 0x01})); ok {
+		t.Error("unreachable code retained")
+	}
+	if ok, _ := db.Has(old[:]); ok {
+		t.Error("unreachable state root retained")
+	}
+	if ok, _ := db.Has([]byte("LastBlock")); !ok {
+		t.Error("non-state entry pruned")
+	}
+	if after := hashKeys(db); after >= before {
+		t.Errorf("nothing pruned: %d nodes before, %d after", before, after)
+	}
+	if common.FileExist(bloomPath) {
+		t.Error("bloom filter left behind")
+	}
+}
+
+// Tests that a sweep interrupted after persisting the bloom is completed.
+func TestRecoverPruning(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pruner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		db        = ethdb.NewMemDatabase()
+		sdb       = state.NewDatabase(db)
+		bloomPath = filepath.Join(dir, BloomFileName)
+	)
+	if resumed, err := RecoverPruning(db, bloomPath); err != nil || resumed {
+		t.Fatalf("recovered without bloom: resumed %v, err %v", resumed, err)
+	}
+	old := commitState(t, sdb, common.Hash{}, func(s *state.StateDB) {
+		s.SetBalance(common.Address{1}, big.NewInt(1))
+	})
+	root := commitState(t, sdb, common.Hash{}, func(s *state.StateDB) {
+		s.SetBalance(common.Address{2}, big.NewInt(2))
+	})
+	// Persist the bloom of the retained state, as the marking phase would
+	bloom := newStateBloom(1024 * 1024)
+	if _, err := markState(sdb.TrieDB(), bloom, root, common.Hash{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := bloom.write(bloomPath); err != nil {
+		t.Fatal(err)
+	}
+	if resumed, err := RecoverPruning(db, bloomPath); err != nil || !resumed {
+		t.Fatalf("failed to recover: resumed %v, err %v", resumed, err)
+	}
+	checkState(t, db, root)
+	if ok, _ := db.Has(old[:]); ok {
+		t.Error("unreachable state root retained")
+	}
+	if common.FileExist(bloomPath) {
+		t.Error("bloom filter left behind")
+	}
+}
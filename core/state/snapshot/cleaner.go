@@ -0,0 +1,225 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/core/rawdb"
+	"github.com/zeus-fyi/gochain/v4/ethdb"
+	"github.com/zeus-fyi/gochain/v4/log"
+	"github.com/zeus-fyi/gochain/v4/metrics"
+)
+
+var snapshotCleanedMeter = metrics.NewRegisteredMeter("state/snapshot/cleaned", nil)
+
+// errCleanerStopped is returned internally if the cleaner is stopped midway.
+var errCleanerStopped = errors.New("cleaner stopped")
+
+// wipe is the storage of an account in an epoch, of all incarnations below the
+// given one.
+type wipe struct {
+	epoch       uint64
+	account     common.Hash
+	incarnation uint64
+}
+
+// cleaner deletes orphaned snapshot entries in the background: those of the
+// epochs before the current one, left behind by rebuilds, and the storage of
+// account incarnations superseded by destructions. Orphans pending when the
+// node stops are only reclaimed with their epoch.
+type cleaner struct {
+	diskdb common.Table
+	iter   ethdb.PrefixIteratee // Nil if the table can't be iterated
+
+	epoch uint64 // Epochs below this one are to be deleted
+	swept uint64 // Epochs below this one are deleted already
+	wipes []wipe // Superseded incarnations to delete
+	lock  sync.Mutex
+
+	wake chan struct{}
+	quit chan struct{}
+	done chan struct{}
+}
+
+// newCleaner starts a cleaner deleting the entries of the epochs below the
+// given one from the table. Nothing is deleted if the table can't enumerate
+// its keys by prefix.
+func newCleaner(diskdb common.Table, epoch uint64) *cleaner {
+	c := &cleaner{
+		diskdb: diskdb,
+		epoch:  epoch,
+		wake:   make(chan struct{}, 1),
+		quit:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	iter, ok := diskdb.(ethdb.PrefixIteratee)
+	if !ok {
+		log.Warn("State snapshot table not iterable, orphaned entries will not be deleted")
+		close(c.done)
+		return c
+	}
+	c.iter = iter
+	go c.loop()
+	c.signal()
+	return c
+}
+
+// dropEpochs schedules the deletion of all epochs below the given one.
+func (c *cleaner) dropEpochs(epoch uint64) {
+	c.lock.Lock()
+	if epoch > c.epoch {
+		c.epoch = epoch
+	}
+	c.lock.Unlock()
+	c.signal()
+}
+
+// dropIncarnations schedules the deletion of superseded account incarnations.
+func (c *cleaner) dropIncarnations(wipes []wipe) {
+	if len(wipes) == 0 {
+		return
+	}
+	c.lock.Lock()
+	c.wipes = append(c.wipes, wipes...)
+	c.lock.Unlock()
+	c.signal()
+}
+
+// signal wakes the cleaner up, unless it has work pending already.
+func (c *cleaner) signal() {
+	if c.iter == nil {
+		return
+	}
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// stop aborts the cleaner and waits for it to return.
+func (c *cleaner) stop() {
+	select {
+	case <-c.quit:
+	default:
+		close(c.quit)
+	}
+	<-c.done
+}
+
+// loop deletes the scheduled entries whenever woken up, until stopped.
+func (c *cleaner) loop() {
+	defer close(c.done)
+
+	for {
+		select {
+		case <-c.wake:
+			if err := c.clean(); err != nil {
+				if err != errCleanerStopped {
+					log.Error("Failed to delete orphaned snapshot entries", "err", err)
+				}
+				return
+			}
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+// clean deletes the stale epochs and then the superseded incarnations which
+// are scheduled.
+func (c *cleaner) clean() error {
+	c.lock.Lock()
+	epoch, swept, wipes := c.epoch, c.swept, c.wipes
+	c.wipes = nil
+	c.lock.Unlock()
+
+	var (
+		start   = time.Now()
+		deleted int
+	)
+	for e := swept; e < epoch; e++ {
+		for _, prefix := range rawdb.SnapshotEpochPrefixes(e) {
+			n, err := c.delete(prefix, nil)
+			if err != nil {
+				return err
+			}
+			deleted += n
+		}
+		c.lock.Lock()
+		c.swept = e + 1
+		c.lock.Unlock()
+	}
+	for _, w := range wipes {
+		if w.epoch < epoch {
+			continue // Gone with its epoch
+		}
+		n, err := c.delete(rawdb.SnapshotStoragePrefix(w.epoch, w.account), func(key []byte) bool {
+			return rawdb.SnapshotStorageKeyIncarnation(key) < w.incarnation
+		})
+		if err != nil {
+			return err
+		}
+		deleted += n
+	}
+	if deleted > 0 {
+		log.Debug("Deleted orphaned snapshot entries", "epochs", epoch-swept, "incarnations", len(wipes), "entries", deleted, "elapsed", common.PrettyDuration(time.Since(start)))
+	}
+	return nil
+}
+
+// delete removes the entries under the prefix which match the filter, or all
+// of them if the filter is nil, returning their number.
+func (c *cleaner) delete(prefix []byte, filter func(key []byte) bool) (int, error) {
+	var (
+		batch   = c.diskdb.NewBatch()
+		pending int
+		deleted int
+	)
+	err := c.iter.IteratePrefix(prefix, func(key, value []byte) error {
+		select {
+		case <-c.quit:
+			return errCleanerStopped
+		default:
+		}
+		if filter != nil && !filter(key) {
+			return nil
+		}
+		if err := batch.Delete(common.CopyBytes(key)); err != nil {
+			return err
+		}
+		pending += len(key)
+		deleted++
+
+		if pending >= ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch.Reset()
+			pending = 0
+		}
+		return nil
+	})
+	if err != nil {
+		return deleted, err
+	}
+	snapshotCleanedMeter.Mark(int64(deleted))
+	return deleted, batch.Write()
+}
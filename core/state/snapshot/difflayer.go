@@ -0,0 +1,119 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"sync"
+
+	"github.com/zeus-fyi/gochain/v4/common"
+)
+
+// diffLayer is an in-memory snapshot layer holding the state changes of a single
+// block on top of its parent layer. Its contents are immutable; only the parent
+// is swapped when the layers below are flattened.
+type diffLayer struct {
+	root      common.Hash
+	destructs map[common.Hash]struct{}               // Accounts deleted, along with their storage
+	accounts  map[common.Hash][]byte                 // RLP encoded accounts created or updated
+	storage   map[common.Hash]map[common.Hash][]byte // RLP encoded storage slots changed, nil if deleted
+
+	parent layer
+	stale  bool
+	lock   sync.RWMutex
+}
+
+// newDiffLayer creates a new diff layer on top of parent.
+func newDiffLayer(parent layer, root common.Hash, destructs map[common.Hash]struct{}, accounts map[common.Hash][]byte, storage map[common.Hash]map[common.Hash][]byte) *diffLayer {
+	return &diffLayer{
+		root:      root,
+		destructs: destructs,
+		accounts:  accounts,
+		storage:   storage,
+		parent:    parent,
+	}
+}
+
+// Root returns the state root of the layer.
+func (dl *diffLayer) Root() common.Hash {
+	return dl.root
+}
+
+// Account retrieves the RLP encoded account with the given address hash.
+func (dl *diffLayer) Account(hash common.Hash) ([]byte, error) {
+	dl.lock.RLock()
+	if dl.stale {
+		dl.lock.RUnlock()
+		return nil, ErrSnapshotStale
+	}
+	if data, ok := dl.accounts[hash]; ok {
+		dl.lock.RUnlock()
+		return data, nil
+	}
+	if _, ok := dl.destructs[hash]; ok {
+		dl.lock.RUnlock()
+		return nil, nil
+	}
+	parent := dl.parent
+	dl.lock.RUnlock()
+
+	return parent.Account(hash)
+}
+
+// Storage retrieves the RLP encoded storage slot of an account.
+func (dl *diffLayer) Storage(accountHash, storageHash common.Hash) ([]byte, error) {
+	dl.lock.RLock()
+	if dl.stale {
+		dl.lock.RUnlock()
+		return nil, ErrSnapshotStale
+	}
+	if slots, ok := dl.storage[accountHash]; ok {
+		if data, ok := slots[storageHash]; ok {
+			dl.lock.RUnlock()
+			return data, nil
+		}
+	}
+	if _, ok := dl.destructs[accountHash]; ok {
+		dl.lock.RUnlock()
+		return nil, nil
+	}
+	parent := dl.parent
+	dl.lock.RUnlock()
+
+	return parent.Storage(accountHash, storageHash)
+}
+
+// parentLayer returns the layer the diff is applied on top of.
+func (dl *diffLayer) parentLayer() layer {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	return dl.parent
+}
+
+// setParent replaces the layer the diff is applied on top of.
+func (dl *diffLayer) setParent(parent layer) {
+	dl.lock.Lock()
+	dl.parent = parent
+	dl.lock.Unlock()
+}
+
+// markStale flags the layer as no longer usable.
+func (dl *diffLayer) markStale() {
+	dl.lock.Lock()
+	dl.stale = true
+	dl.lock.Unlock()
+}
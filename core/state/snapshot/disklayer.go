@@ -0,0 +1,432 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"sync"
+	"time"
+
+	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/core/rawdb"
+	"github.com/zeus-fyi/gochain/v4/core/types"
+	"github.com/zeus-fyi/gochain/v4/ethdb"
+	"github.com/zeus-fyi/gochain/v4/log"
+	"github.com/zeus-fyi/gochain/v4/rlp"
+	"github.com/zeus-fyi/gochain/v4/trie"
+)
+
+// diskLayer is the persisted base layer of the snapshot. Entries are keyed by
+// the layer's epoch, and storage slots additionally by the incarnation of their
+// account, which is bumped whenever the account is destructed. This allows
+// wiping all of an account's storage, or the whole snapshot, with a single
+// write, leaving the orphaned entries to be deleted in the background.
+type diskLayer struct {
+	diskdb  common.Table
+	triedb  *trie.Database
+	cleaner *cleaner
+	root    common.Hash
+	epoch   uint64
+
+	genMarker []byte             // Hash of the last account generated, nil if complete
+	genAbort  chan chan struct{} // Channel to abort the running generator, nil if none
+
+	rewriting  bool          // Whether the layer is being rewritten from a previous root, covering nothing meanwhile
+	rewriteErr error         // Error the rewrite failed with, leaving the layer to be rebuilt
+	rewritten  chan struct{} // Closed once the rewrite ends, nil if there is none
+
+	stale bool
+	lock  sync.RWMutex
+}
+
+// Root returns the state root of the layer.
+func (dl *diskLayer) Root() common.Hash {
+	return dl.root
+}
+
+// covers reports whether the account has already been generated, and isn't
+// being rewritten. The caller must hold dl.lock.
+func (dl *diskLayer) covers(hash common.Hash) bool {
+	if dl.rewriting {
+		return false
+	}
+	return dl.genMarker == nil || bytes.Compare(hash[:], dl.genMarker) <= 0
+}
+
+// Account retrieves the RLP encoded account with the given address hash.
+func (dl *diskLayer) Account(hash common.Hash) ([]byte, error) {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	if dl.stale {
+		return nil, ErrSnapshotStale
+	}
+	if !dl.covers(hash) {
+		return nil, ErrNotCoveredYet
+	}
+	return rawdb.ReadAccountSnapshot(dl.diskdb, dl.epoch, hash), nil
+}
+
+// Storage retrieves the RLP encoded storage slot of an account.
+func (dl *diskLayer) Storage(accountHash, storageHash common.Hash) ([]byte, error) {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	if dl.stale {
+		return nil, ErrSnapshotStale
+	}
+	if !dl.covers(accountHash) {
+		return nil, ErrNotCoveredYet
+	}
+	incarnation := rawdb.ReadSnapshotIncarnation(dl.diskdb, dl.epoch, accountHash)
+	return rawdb.ReadStorageSnapshot(dl.diskdb, dl.epoch, accountHash, incarnation, storageHash), nil
+}
+
+// markStale flags the layer as no longer usable.
+func (dl *diskLayer) markStale() {
+	dl.lock.Lock()
+	dl.stale = true
+	dl.lock.Unlock()
+}
+
+// flatten writes the given diff layers, oldest first, into the disk and returns
+// a new disk layer for the state root of the last one. The receiver is marked
+// stale. Changes to accounts not generated yet are skipped, as the generator
+// will pick them up from the new root.
+func (dl *diskLayer) flatten(diffs []*diffLayer) *diskLayer {
+	dl.stopGeneration()
+
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+
+	// Invalidate the persisted root until all changes are written, lest a crash
+	// leave the previous root pointing at mixed contents.
+	rawdb.WriteSnapshotRoot(dl.diskdb, common.Hash{})
+
+	var (
+		batch        = dl.diskdb.NewBatch()
+		incarnations = make(map[common.Hash]uint64)
+		wiped        = make(map[common.Hash]struct{})
+	)
+	incarnation := func(hash common.Hash) uint64 {
+		inc, ok := incarnations[hash]
+		if !ok {
+			inc = rawdb.ReadSnapshotIncarnation(dl.diskdb, dl.epoch, hash)
+			incarnations[hash] = inc
+		}
+		return inc
+	}
+	flush := func() {
+		if err := batch.Write(); err != nil {
+			log.Crit("Failed to write state snapshot", "err", err)
+		}
+		batch.Reset()
+	}
+	for _, diff := range diffs {
+		for hash := range diff.destructs {
+			if !dl.covers(hash) {
+				continue
+			}
+			rawdb.DeleteAccountSnapshot(batch, dl.epoch, hash)
+			inc := incarnation(hash) + 1
+			incarnations[hash] = inc
+			wiped[hash] = struct{}{}
+			rawdb.WriteSnapshotIncarnation(batch, dl.epoch, hash, inc)
+		}
+		for hash, data := range diff.accounts {
+			if !dl.covers(hash) {
+				continue
+			}
+			rawdb.WriteAccountSnapshot(batch, dl.epoch, hash, data)
+		}
+		for hash, slots := range diff.storage {
+			if !dl.covers(hash) {
+				continue
+			}
+			inc := incarnation(hash)
+			for slot, data := range slots {
+				if data == nil {
+					rawdb.DeleteStorageSnapshot(batch, dl.epoch, hash, inc, slot)
+				} else {
+					rawdb.WriteStorageSnapshot(batch, dl.epoch, hash, inc, slot, data)
+				}
+			}
+			if batch.ValueSize() > ethdb.IdealBatchSize {
+				flush()
+			}
+		}
+	}
+	base := &diskLayer{
+		diskdb:  dl.diskdb,
+		triedb:  dl.triedb,
+		cleaner: dl.cleaner,
+		root:    diffs[len(diffs)-1].root,
+		epoch:   dl.epoch,
+	}
+	if dl.genMarker != nil {
+		base.genMarker = append([]byte{}, dl.genMarker...)
+	}
+	rawdb.WriteSnapshotGenerator(batch, &rawdb.SnapshotGenerator{Epoch: base.epoch, Done: base.genMarker == nil, Marker: base.genMarker})
+	rawdb.WriteSnapshotRoot(batch, base.root)
+	flush()
+
+	wipes := make([]wipe, 0, len(wiped))
+	for hash := range wiped {
+		wipes = append(wipes, wipe{epoch: dl.epoch, account: hash, incarnation: incarnations[hash]})
+	}
+	dl.cleaner.dropIncarnations(wipes)
+
+	dl.stale = true
+	if base.genMarker != nil {
+		base.startGeneration()
+	}
+	return base
+}
+
+// rewrite moves the disk layer to the state of another root, such as the head
+// of a chain forking off below it. It returns a new disk layer for the root and
+// marks the receiver stale. The differences between the two state tries are
+// written in place in the background, during which the new layer covers no
+// entries; any unfinished generation resumes afterwards. If the rewrite fails
+// or is aborted, the persisted snapshot is left invalid and has to be rebuilt.
+func (dl *diskLayer) rewrite(root common.Hash) (*diskLayer, error) {
+	oldTrie, err := trie.New(dl.root, dl.triedb)
+	if err != nil {
+		return nil, err
+	}
+	newTrie, err := trie.New(root, dl.triedb)
+	if err != nil {
+		return nil, err
+	}
+	dl.stopGeneration()
+
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+
+	// Invalidate the persisted root until all changes are written, lest a crash
+	// leave the previous root pointing at mixed contents.
+	rawdb.WriteSnapshotRoot(dl.diskdb, common.Hash{})
+	dl.stale = true
+
+	base := &diskLayer{
+		diskdb:    dl.diskdb,
+		triedb:    dl.triedb,
+		cleaner:   dl.cleaner,
+		root:      root,
+		epoch:     dl.epoch,
+		rewriting: true,
+		rewritten: make(chan struct{}),
+	}
+	if dl.genMarker != nil {
+		base.genMarker = append([]byte{}, dl.genMarker...)
+	}
+	base.genAbort = make(chan chan struct{})
+	go base.rewriteFrom(oldTrie, newTrie, base.genAbort)
+	return base, nil
+}
+
+// rewriteFrom writes the differences between the state trie of a previous root
+// and the layer's own into the disk, then resumes generation if unfinished. It
+// runs as the layer's generator, until aborted.
+func (dl *diskLayer) rewriteFrom(oldTrie, newTrie *trie.Trie, abort chan chan struct{}) {
+	start := time.Now()
+	accounts, err := dl.writeDiff(oldTrie, newTrie, abort)
+
+	dl.lock.Lock()
+	if err == nil {
+		dl.rewriting = false
+	} else {
+		dl.rewriteErr = err
+	}
+	generated := dl.genMarker == nil
+	dl.lock.Unlock()
+	close(dl.rewritten)
+
+	switch {
+	case err == errRewriteAborted:
+		log.Warn("Aborted state snapshot rewrite", "root", dl.root, "accounts", accounts, "elapsed", common.PrettyDuration(time.Since(start)))
+		return
+	case err != nil:
+		log.Error("State snapshot rewrite failed", "root", dl.root, "err", err)
+		done := <-abort
+		close(done)
+		return
+	}
+	log.Info("Rewrote state snapshot", "root", dl.root, "accounts", accounts, "elapsed", common.PrettyDuration(time.Since(start)))
+	if !generated {
+		dl.generate(abort)
+		return
+	}
+	done := <-abort
+	close(done)
+}
+
+// rewriteState reports whether the layer is still being rewritten, or the error
+// its rewrite failed with. If wait is set, a running rewrite is waited for.
+func (dl *diskLayer) rewriteState(wait bool) (bool, error) {
+	dl.lock.RLock()
+	rewritten := dl.rewritten
+	dl.lock.RUnlock()
+
+	if wait && rewritten != nil {
+		<-rewritten
+	}
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	return dl.rewriting && dl.rewriteErr == nil, dl.rewriteErr
+}
+
+// writeDiff writes the accounts which differ between the old and new state
+// tries into the disk, along with their storage differences, returning their
+// number. If aborted midway, errRewriteAborted is returned once the abort is
+// acknowledged.
+func (dl *diskLayer) writeDiff(oldTrie, newTrie *trie.Trie, abort chan chan struct{}) (int, error) {
+	var (
+		batch    = dl.diskdb.NewBatch()
+		wipes    []wipe
+		accounts int
+	)
+	dl.lock.RLock()
+	marker := dl.genMarker
+	dl.lock.RUnlock()
+
+	generated := func(hash common.Hash) bool {
+		return marker == nil || bytes.Compare(hash[:], marker) <= 0
+	}
+	flush := func() {
+		if err := batch.Write(); err != nil {
+			log.Crit("Failed to write state snapshot", "err", err)
+		}
+		batch.Reset()
+	}
+	aborted := func() bool {
+		select {
+		case done := <-abort:
+			close(done)
+			return true
+		default:
+			return false
+		}
+	}
+	// Write the accounts which were created or changed, along with the slots
+	// which differ between their storage tries
+	it := leafDiff(oldTrie, newTrie)
+	for it.Next() {
+		hash := common.BytesToHash(it.Key)
+		if !generated(hash) {
+			continue
+		}
+		rawdb.WriteAccountSnapshot(batch, dl.epoch, hash, common.CopyBytes(it.Value))
+		accounts++
+
+		var acc, prev Account
+		if err := rlp.DecodeBytes(it.Value, &acc); err != nil {
+			return accounts, err
+		}
+		prev.Root = types.EmptyRootHash
+		if enc, err := oldTrie.TryGet(it.Key); err != nil {
+			return accounts, err
+		} else if len(enc) > 0 {
+			if err := rlp.DecodeBytes(enc, &prev); err != nil {
+				return accounts, err
+			}
+		}
+		if acc.Root != prev.Root {
+			inc := rawdb.ReadSnapshotIncarnation(dl.diskdb, dl.epoch, hash)
+			if err := dl.rewriteStorage(batch, hash, inc, prev.Root, acc.Root); err != nil {
+				return accounts, err
+			}
+		}
+		if batch.ValueSize() > ethdb.IdealBatchSize {
+			flush()
+		}
+		if aborted() {
+			return accounts, errRewriteAborted
+		}
+	}
+	if it.Err != nil {
+		return accounts, it.Err
+	}
+	// Delete the accounts which are gone, wiping their storage
+	it = leafDiff(newTrie, oldTrie)
+	for it.Next() {
+		hash := common.BytesToHash(it.Key)
+		if !generated(hash) {
+			continue
+		}
+		if enc, err := newTrie.TryGet(it.Key); err != nil {
+			return accounts, err
+		} else if len(enc) > 0 {
+			continue // Changed, not deleted
+		}
+		rawdb.DeleteAccountSnapshot(batch, dl.epoch, hash)
+		inc := rawdb.ReadSnapshotIncarnation(dl.diskdb, dl.epoch, hash) + 1
+		rawdb.WriteSnapshotIncarnation(batch, dl.epoch, hash, inc)
+		wipes = append(wipes, wipe{epoch: dl.epoch, account: hash, incarnation: inc})
+		accounts++
+
+		if aborted() {
+			return accounts, errRewriteAborted
+		}
+	}
+	if it.Err != nil {
+		return accounts, it.Err
+	}
+	rawdb.WriteSnapshotGenerator(batch, &rawdb.SnapshotGenerator{Epoch: dl.epoch, Done: marker == nil, Marker: marker})
+	rawdb.WriteSnapshotRoot(batch, dl.root)
+	flush()
+
+	dl.cleaner.dropIncarnations(wipes)
+	return accounts, nil
+}
+
+// rewriteStorage writes the differences between two storage tries of an
+// account incarnation into the batch.
+func (dl *diskLayer) rewriteStorage(batch common.Batch, hash common.Hash, inc uint64, oldRoot, newRoot common.Hash) error {
+	oldTrie, err := trie.New(oldRoot, dl.triedb)
+	if err != nil {
+		return err
+	}
+	newTrie, err := trie.New(newRoot, dl.triedb)
+	if err != nil {
+		return err
+	}
+	it := leafDiff(oldTrie, newTrie)
+	for it.Next() {
+		rawdb.WriteStorageSnapshot(batch, dl.epoch, hash, inc, common.BytesToHash(it.Key), common.CopyBytes(it.Value))
+	}
+	if it.Err != nil {
+		return it.Err
+	}
+	it = leafDiff(newTrie, oldTrie)
+	for it.Next() {
+		if enc, err := newTrie.TryGet(it.Key); err != nil {
+			return err
+		} else if len(enc) == 0 {
+			rawdb.DeleteStorageSnapshot(batch, dl.epoch, hash, inc, common.BytesToHash(it.Key))
+		}
+	}
+	return it.Err
+}
+
+// leafDiff iterates the leaves of trie b which are missing from, or differ in,
+// trie a.
+func leafDiff(a, b *trie.Trie) *trie.Iterator {
+	it, _ := trie.NewDifferenceIterator(a.NodeIterator(nil), b.NodeIterator(nil))
+	return trie.NewIterator(it)
+}
@@ -0,0 +1,172 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/core/rawdb"
+	"github.com/zeus-fyi/gochain/v4/core/types"
+	"github.com/zeus-fyi/gochain/v4/ethdb"
+	"github.com/zeus-fyi/gochain/v4/log"
+	"github.com/zeus-fyi/gochain/v4/rlp"
+	"github.com/zeus-fyi/gochain/v4/trie"
+)
+
+// generateSnapshot starts generating a new snapshot epoch from the state trie
+// of the given root in the background, returning its disk layer.
+func generateSnapshot(diskdb common.Table, triedb *trie.Database, cleaner *cleaner, root common.Hash, epoch uint64) *diskLayer {
+	rawdb.WriteSnapshotGenerator(diskdb, &rawdb.SnapshotGenerator{Epoch: epoch, Marker: []byte{}})
+	rawdb.WriteSnapshotRoot(diskdb, root)
+
+	dl := &diskLayer{
+		diskdb:    diskdb,
+		triedb:    triedb,
+		cleaner:   cleaner,
+		root:      root,
+		epoch:     epoch,
+		genMarker: []byte{},
+	}
+	log.Info("Started state snapshot generation", "root", root, "epoch", epoch)
+	dl.startGeneration()
+	return dl
+}
+
+// startGeneration spawns the generator, continuing after the current marker.
+func (dl *diskLayer) startGeneration() {
+	dl.genAbort = make(chan chan struct{})
+	go dl.generate(dl.genAbort)
+}
+
+// stopGeneration aborts the running generator, if any, and waits for it to
+// persist its progress.
+func (dl *diskLayer) stopGeneration() {
+	if dl.genAbort == nil {
+		return
+	}
+	done := make(chan struct{})
+	dl.genAbort <- done
+	<-done
+	dl.genAbort = nil
+}
+
+// generate iterates the account trie of the layer's root after the marker,
+// writing every account with all of its storage into the snapshot. Progress is
+// persisted with each batch, and made visible to readers by advancing the marker.
+// Once done, or on failure, it waits for the abort signal before returning.
+func (dl *diskLayer) generate(abort chan chan struct{}) {
+	var (
+		start    = time.Now()
+		batch    = dl.diskdb.NewBatch()
+		accounts int
+		slots    int
+	)
+	dl.lock.RLock()
+	marker := append([]byte{}, dl.genMarker...)
+	dl.lock.RUnlock()
+
+	flush := func(marker []byte) {
+		rawdb.WriteSnapshotGenerator(batch, &rawdb.SnapshotGenerator{Epoch: dl.epoch, Done: marker == nil, Marker: marker})
+		if err := batch.Write(); err != nil {
+			log.Crit("Failed to write state snapshot", "err", err)
+		}
+		batch.Reset()
+
+		dl.lock.Lock()
+		dl.genMarker = marker
+		dl.lock.Unlock()
+	}
+	fail := func(err error) {
+		log.Error("State snapshot generation failed", "root", dl.root, "err", err)
+		done := <-abort
+		close(done)
+	}
+	accTrie, err := trie.New(dl.root, dl.triedb)
+	if err != nil {
+		fail(err)
+		return
+	}
+	it := trie.NewIterator(accTrie.NodeIterator(marker))
+	for it.Next() {
+		// The marker account itself was already generated
+		if len(marker) > 0 && bytes.Equal(it.Key, marker) {
+			continue
+		}
+		hash := common.BytesToHash(it.Key)
+		rawdb.WriteAccountSnapshot(batch, dl.epoch, hash, common.CopyBytes(it.Value))
+		accounts++
+
+		var acc Account
+		if err := rlp.DecodeBytes(it.Value, &acc); err != nil {
+			fail(err)
+			return
+		}
+		if acc.Root != types.EmptyRootHash {
+			// Start a fresh incarnation, orphaning any slots of an interrupted run
+			inc := rawdb.ReadSnapshotIncarnation(dl.diskdb, dl.epoch, hash) + 1
+			rawdb.WriteSnapshotIncarnation(batch, dl.epoch, hash, inc)
+			if inc > 1 {
+				dl.cleaner.dropIncarnations([]wipe{{epoch: dl.epoch, account: hash, incarnation: inc}})
+			}
+
+			storeTrie, err := trie.New(acc.Root, dl.triedb)
+			if err != nil {
+				fail(err)
+				return
+			}
+			storeIt := trie.NewIterator(storeTrie.NodeIterator(nil))
+			for storeIt.Next() {
+				rawdb.WriteStorageSnapshot(batch, dl.epoch, hash, inc, common.BytesToHash(storeIt.Key), common.CopyBytes(storeIt.Value))
+				slots++
+
+				// Flush large storage early, without moving the marker
+				if batch.ValueSize() > ethdb.IdealBatchSize {
+					if err := batch.Write(); err != nil {
+						log.Crit("Failed to write state snapshot", "err", err)
+					}
+					batch.Reset()
+				}
+			}
+			if storeIt.Err != nil {
+				fail(storeIt.Err)
+				return
+			}
+		}
+		select {
+		case done := <-abort:
+			flush(hash[:])
+			log.Info("Paused state snapshot generation", "root", dl.root, "accounts", accounts, "slots", slots, "elapsed", common.PrettyDuration(time.Since(start)))
+			close(done)
+			return
+		default:
+		}
+		if batch.ValueSize() > ethdb.IdealBatchSize {
+			flush(hash[:])
+		}
+	}
+	if it.Err != nil {
+		fail(it.Err)
+		return
+	}
+	flush(nil)
+	log.Info("Generated state snapshot", "root", dl.root, "accounts", accounts, "slots", slots, "elapsed", common.PrettyDuration(time.Since(start)))
+
+	done := <-abort
+	close(done)
+}
@@ -0,0 +1,334 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package snapshot implements a flat, key/value snapshot of the account and
+// storage state, allowing reads without walking the Merkle tries.
+//
+// The snapshot is a tree of layers: a single disk layer persisted in the global
+// table, topped by in-memory diff layers holding the changes of each recent
+// block. Diff layers are flattened into the disk layer once they fall deep
+// enough below the chain head.
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/core/rawdb"
+	"github.com/zeus-fyi/gochain/v4/log"
+	"github.com/zeus-fyi/gochain/v4/metrics"
+	"github.com/zeus-fyi/gochain/v4/trie"
+)
+
+var (
+	// ErrSnapshotStale is returned from data accessors if the underlying layer
+	// was flattened or dropped and its contents are no longer valid.
+	ErrSnapshotStale = errors.New("snapshot stale")
+
+	// ErrNotCoveredYet is returned from data accessors if the requested entry
+	// has not been generated yet. Callers should fall back to the trie.
+	ErrNotCoveredYet = errors.New("not covered yet")
+
+	// errSnapshotMissing is returned if a layer is requested for an unknown root.
+	errSnapshotMissing = errors.New("snapshot missing")
+
+	// errSnapshotRewriting is returned if the disk layer is requested to move to
+	// another chain while still being rewritten after a previous reorg.
+	errSnapshotRewriting = errors.New("snapshot rewrite in progress")
+
+	// errRewriteAborted is returned internally if a rewrite is aborted midway.
+	errRewriteAborted = errors.New("snapshot rewrite aborted")
+)
+
+var (
+	snapshotFlattenCounter = metrics.NewRegisteredCounter("state/snapshot/flatten", nil)
+	snapshotRebuildCounter = metrics.NewRegisteredCounter("state/snapshot/rebuild", nil)
+	snapshotReorgCounter   = metrics.NewRegisteredCounter("state/snapshot/reorg", nil)
+)
+
+// Account is the consensus representation of accounts, as stored in the
+// snapshot and in the account trie. It mirrors state.Account.
+type Account struct {
+	Nonce    uint64
+	Balance  *big.Int
+	Root     common.Hash
+	CodeHash []byte
+}
+
+// Snapshot represents the state at a specific block, as seen through the flat
+// snapshot. Values are returned in the same RLP encoding as in the tries. A nil
+// value with a nil error means the entry does not exist.
+type Snapshot interface {
+	// Root returns the state root the snapshot represents.
+	Root() common.Hash
+
+	// Account retrieves the RLP encoded account with the given address hash.
+	Account(hash common.Hash) ([]byte, error)
+
+	// Storage retrieves the RLP encoded storage slot with the given hash of the
+	// account with the given address hash.
+	Storage(accountHash, storageHash common.Hash) ([]byte, error)
+}
+
+// layer is a Snapshot which is part of a Tree.
+type layer interface {
+	Snapshot
+
+	// markStale flags the layer as no longer usable.
+	markStale()
+}
+
+// Tree is the collection of snapshot layers, a disk layer with diff layers
+// on top of it, keyed by state root. Diff layers of side chains are retained
+// until they no longer build on the disk layer. Entries orphaned on disk are
+// deleted in the background. All methods are safe for concurrent use.
+type Tree struct {
+	diskdb  common.Table
+	triedb  *trie.Database
+	cleaner *cleaner
+
+	layers map[common.Hash]layer
+	lock   sync.RWMutex
+}
+
+// New loads the snapshot persisted in the table if it represents the given
+// head root, resuming its generation if unfinished. Otherwise it starts
+// generating a new snapshot from the head state trie in the background.
+func New(diskdb common.Table, triedb *trie.Database, root common.Hash) *Tree {
+	t := &Tree{
+		diskdb: diskdb,
+		triedb: triedb,
+		layers: make(map[common.Hash]layer),
+	}
+	gen := rawdb.ReadSnapshotGenerator(diskdb)
+	if gen == nil || rawdb.ReadSnapshotRoot(diskdb) != root {
+		var epoch uint64
+		if gen != nil {
+			epoch = gen.Epoch + 1
+		}
+		t.cleaner = newCleaner(diskdb, epoch)
+		t.layers[root] = generateSnapshot(diskdb, triedb, t.cleaner, root, epoch)
+		return t
+	}
+	t.cleaner = newCleaner(diskdb, gen.Epoch)
+	dl := &diskLayer{
+		diskdb:  diskdb,
+		triedb:  triedb,
+		cleaner: t.cleaner,
+		root:    root,
+		epoch:   gen.Epoch,
+	}
+	if !gen.Done {
+		dl.genMarker = append([]byte{}, gen.Marker...)
+		dl.startGeneration()
+	}
+	log.Info("Loaded state snapshot", "root", root, "epoch", gen.Epoch, "complete", gen.Done)
+	t.layers[root] = dl
+	return t
+}
+
+// Snapshot retrieves the snapshot layer of the given state root, or nil if
+// there is none.
+func (t *Tree) Snapshot(root common.Hash) Snapshot {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	if l, ok := t.layers[root]; ok {
+		return l
+	}
+	return nil
+}
+
+// Update adds a diff layer for the state root on top of the parent root's
+// layer. Destructed accounts have their storage wiped before the account and
+// storage changes are applied; a nil storage value is a deleted slot.
+func (t *Tree) Update(root, parent common.Hash, destructs map[common.Hash]struct{}, accounts map[common.Hash][]byte, storage map[common.Hash]map[common.Hash][]byte) error {
+	if root == parent {
+		return nil
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if _, ok := t.layers[root]; ok {
+		return nil
+	}
+	p, ok := t.layers[parent]
+	if !ok {
+		return fmt.Errorf("parent %x: %v", parent[:4], errSnapshotMissing)
+	}
+	t.layers[root] = newDiffLayer(p, root, destructs, accounts, storage)
+	return nil
+}
+
+// Cap flattens the diff layers below the given root into the disk layer, so
+// that at most the given number of diff layers remain on top of it. Layers
+// which don't build on the new disk layer, such as side chains forking off
+// below it, are dropped. Nothing is flattened while the disk layer is being
+// rewritten after a reorg, unless all diff layers are to be flattened, which
+// waits for the rewrite; an error is returned if the rewrite failed.
+func (t *Tree) Cap(root common.Hash, layers int) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	top, ok := t.layers[root]
+	if !ok {
+		return fmt.Errorf("root %x: %v", root[:4], errSnapshotMissing)
+	}
+	// Collect the diff layers from the top down to the disk layer
+	var (
+		chain []*diffLayer
+		disk  *diskLayer
+	)
+	for cur := top; disk == nil; {
+		switch l := cur.(type) {
+		case *diffLayer:
+			chain = append(chain, l)
+			cur = l.parentLayer()
+		case *diskLayer:
+			disk = l
+		}
+	}
+	if len(chain) <= layers {
+		return nil
+	}
+	rewriting, err := disk.rewriteState(layers == 0)
+	if err != nil {
+		return fmt.Errorf("rewrite: %v", err)
+	}
+	if rewriting {
+		return nil
+	}
+	// Flatten the surplus layers, oldest first, and hook all children of the
+	// newest one, including side chains, on the result
+	flatten := make([]*diffLayer, 0, len(chain)-layers)
+	for i := len(chain) - 1; i >= layers; i-- {
+		flatten = append(flatten, chain[i])
+	}
+	base := disk.flatten(flatten)
+	newest := flatten[len(flatten)-1]
+	for _, l := range t.layers {
+		if diff, ok := l.(*diffLayer); ok && diff.parentLayer() == layer(newest) {
+			diff.setParent(base)
+		}
+	}
+	for _, diff := range flatten {
+		diff.markStale()
+	}
+	snapshotFlattenCounter.Inc(int64(len(flatten)))
+
+	// Drop everything which doesn't build on the new disk layer
+	for root, l := range t.layers {
+		if !descends(l, base) {
+			l.markStale()
+			delete(t.layers, root)
+		}
+	}
+	t.layers[base.root] = base
+	return nil
+}
+
+// descends reports whether the layer is, or is built on top of, base.
+func descends(l layer, base *diskLayer) bool {
+	for {
+		switch cur := l.(type) {
+		case *diffLayer:
+			l = cur.parentLayer()
+		case *diskLayer:
+			return cur == base
+		}
+	}
+}
+
+// Reorg moves the snapshot onto the chain of the given head root after a chain
+// reorganisation. Nothing needs to be done if the head has a layer already.
+// Otherwise the chains forked below the diff layers, so all diff layers are
+// dropped and the disk layer is rewritten to the head state from the
+// differences between the two state tries, in the background. An error means
+// the snapshot could not follow the chain and has to be rebuilt.
+func (t *Tree) Reorg(root common.Hash) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if _, ok := t.layers[root]; ok {
+		return nil
+	}
+	var disk *diskLayer
+	for _, l := range t.layers {
+		if dl, ok := l.(*diskLayer); ok {
+			disk = dl
+			break
+		}
+	}
+	if disk == nil {
+		return errSnapshotMissing
+	}
+	if rewriting, err := disk.rewriteState(false); err != nil {
+		return fmt.Errorf("rewrite: %v", err)
+	} else if rewriting {
+		return errSnapshotRewriting
+	}
+	base, err := disk.rewrite(root)
+	if err != nil {
+		return err
+	}
+	for _, l := range t.layers {
+		l.markStale()
+	}
+	log.Info("Moving state snapshot to new chain", "from", disk.root, "to", root)
+	snapshotReorgCounter.Inc(1)
+
+	t.layers = map[common.Hash]layer{root: base}
+	return nil
+}
+
+// Rebuild drops all layers and starts generating a new snapshot from the state
+// trie of the given root in the background. It is used when the layers can no
+// longer follow the chain, such as after rewinding the head or a failed reorg.
+func (t *Tree) Rebuild(root common.Hash) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	var epoch uint64
+	for _, l := range t.layers {
+		if dl, ok := l.(*diskLayer); ok {
+			dl.stopGeneration()
+			epoch = dl.epoch + 1
+		}
+		l.markStale()
+	}
+	log.Warn("Rebuilding state snapshot", "root", root, "epoch", epoch)
+	snapshotRebuildCounter.Inc(1)
+
+	t.cleaner.dropEpochs(epoch)
+	t.layers = map[common.Hash]layer{root: generateSnapshot(t.diskdb, t.triedb, t.cleaner, root, epoch)}
+}
+
+// Stop aborts any background generation, persisting its progress, and the
+// deletion of orphaned entries.
+func (t *Tree) Stop() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for _, l := range t.layers {
+		if dl, ok := l.(*diskLayer); ok {
+			dl.stopGeneration()
+		}
+	}
+	t.cleaner.stop()
+}
@@ -0,0 +1,421 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/core/rawdb"
+	"github.com/zeus-fyi/gochain/v4/core/types"
+	"github.com/zeus-fyi/gochain/v4/crypto"
+	"github.com/zeus-fyi/gochain/v4/ethdb"
+	"github.com/zeus-fyi/gochain/v4/rlp"
+	"github.com/zeus-fyi/gochain/v4/trie"
+)
+
+// makeState commits a state with the given accounts, each with its storage
+// slots, into the trie database and returns its root and account encodings.
+func makeState(t *testing.T, triedb *trie.Database, state map[common.Hash]map[common.Hash][]byte) (common.Hash, map[common.Hash][]byte) {
+	accTrie, _ := trie.New(common.Hash{}, triedb)
+	accounts := make(map[common.Hash][]byte)
+	for hash, slots := range state {
+		storeTrie, _ := trie.New(common.Hash{}, triedb)
+		for slot, data := range slots {
+			storeTrie.Update(slot[:], data)
+		}
+		storeRoot, err := storeTrie.Commit(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		enc, _ := rlp.EncodeToBytes(&Account{Nonce: 1, Balance: big.NewInt(int64(len(slots))), Root: storeRoot, CodeHash: crypto.Keccak256(nil)})
+		accTrie.Update(hash[:], enc)
+		accounts[hash] = enc
+	}
+	root, err := accTrie.Commit(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return root, accounts
+}
+
+// waitGeneration blocks until the disk layer of the tree is fully generated,
+// and rewritten if moved to another chain.
+func waitGeneration(t *testing.T, tree *Tree, root common.Hash) {
+	dl, ok := tree.Snapshot(root).(*diskLayer)
+	if !ok {
+		t.Fatalf("no disk layer for %x", root)
+	}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		dl.lock.RLock()
+		done := dl.genMarker == nil && !dl.rewriting
+		dl.lock.RUnlock()
+		if done {
+			return
+		}
+	}
+	t.Fatal("snapshot generation timed out")
+}
+
+func checkAccount(t *testing.T, snap Snapshot, hash common.Hash, want []byte) {
+	t.Helper()
+	have, err := snap.Account(hash)
+	if err != nil {
+		t.Fatalf("account %x: %v", hash[:4], err)
+	}
+	if !bytes.Equal(have, want) {
+		t.Errorf("account %x: have %x, want %x", hash[:4], have, want)
+	}
+}
+
+func checkStorage(t *testing.T, snap Snapshot, hash, slot common.Hash, want []byte) {
+	t.Helper()
+	have, err := snap.Storage(hash, slot)
+	if err != nil {
+		t.Fatalf("storage %x/%x: %v", hash[:4], slot[:4], err)
+	}
+	if !bytes.Equal(have, want) {
+		t.Errorf("storage %x/%x: have %x, want %x", hash[:4], slot[:4], have, want)
+	}
+}
+
+// Tests that a snapshot is generated from the state trie, and reloaded rather
+// than regenerated on restart.
+func TestGenerate(t *testing.T) {
+	var (
+		db     = ethdb.NewMemDatabase()
+		triedb = trie.NewDatabase(db)
+		acc1   = common.HexToHash("0x01")
+		acc2   = common.HexToHash("0x02")
+		acc3   = common.HexToHash("0x03")
+		slot1  = common.HexToHash("0x11")
+		slot2  = common.HexToHash("0x12")
+	)
+	root, accounts := makeState(t, triedb, map[common.Hash]map[common.Hash][]byte{
+		acc1: nil,
+		acc2: {slot1: []byte{0x01}, slot2: []byte{0x02}},
+		acc3: {slot1: []byte{0x03}},
+	})
+	tree := New(db, triedb, root)
+	waitGeneration(t, tree, root)
+
+	snap := tree.Snapshot(root)
+	for hash, enc := range accounts {
+		checkAccount(t, snap, hash, enc)
+	}
+	checkAccount(t, snap, common.HexToHash("0x04"), nil)
+	checkStorage(t, snap, acc2, slot1, []byte{0x01})
+	checkStorage(t, snap, acc2, slot2, []byte{0x02})
+	checkStorage(t, snap, acc3, slot1, []byte{0x03})
+	checkStorage(t, snap, acc3, slot2, nil)
+	tree.Stop()
+
+	gen := rawdb.ReadSnapshotGenerator(db)
+	if gen == nil || !gen.Done {
+		t.Fatalf("generator not persisted as done: %+v", gen)
+	}
+	// Reloading must reuse the persisted epoch
+	tree = New(db, triedb, root)
+	if epoch := tree.Snapshot(root).(*diskLayer).epoch; epoch != gen.Epoch {
+		t.Errorf("epoch mismatch after reload: have %d, want %d", epoch, gen.Epoch)
+	}
+	checkStorage(t, tree.Snapshot(root), acc2, slot1, []byte{0x01})
+	tree.Stop()
+
+	// A different head root must start a new epoch
+	tree = New(db, triedb, types.EmptyRootHash)
+	if epoch := tree.Snapshot(types.EmptyRootHash).(*diskLayer).epoch; epoch != gen.Epoch+1 {
+		t.Errorf("epoch mismatch after root change: have %d, want %d", epoch, gen.Epoch+1)
+	}
+	waitGeneration(t, tree, types.EmptyRootHash)
+	checkAccount(t, tree.Snapshot(types.EmptyRootHash), acc1, nil)
+	tree.Stop()
+}
+
+// Tests that diff layers shadow their parents, that destructs wipe storage, and
+// that capping flattens them into the disk layer, dropping side chains.
+func TestDiffLayers(t *testing.T) {
+	var (
+		db     = ethdb.NewMemDatabase()
+		triedb = trie.NewDatabase(db)
+		acc1   = common.HexToHash("0x01")
+		acc2   = common.HexToHash("0x02")
+		slot1  = common.HexToHash("0x11")
+		slot2  = common.HexToHash("0x12")
+	)
+	root, accounts := makeState(t, triedb, map[common.Hash]map[common.Hash][]byte{
+		acc1: {slot1: []byte{0x01}},
+		acc2: {slot1: []byte{0x02}, slot2: []byte{0x03}},
+	})
+	tree := New(db, triedb, root)
+	defer tree.Stop()
+	waitGeneration(t, tree, root)
+
+	// Block 1 updates a slot of acc1 and deletes one of acc2
+	root1 := common.HexToHash("0xa1")
+	err := tree.Update(root1, root, nil, map[common.Hash][]byte{acc1: {0xaa}}, map[common.Hash]map[common.Hash][]byte{
+		acc1: {slot1: []byte{0x04}},
+		acc2: {slot2: nil},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Block 2 destructs and recreates acc2 with fresh storage
+	root2 := common.HexToHash("0xa2")
+	err = tree.Update(root2, root1, map[common.Hash]struct{}{acc2: {}}, map[common.Hash][]byte{acc2: {0xbb}}, map[common.Hash]map[common.Hash][]byte{
+		acc2: {slot2: []byte{0x05}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A side chain off block 1
+	side := common.HexToHash("0xb2")
+	if err := tree.Update(side, root1, nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.Update(common.HexToHash("0xc1"), common.HexToHash("0xdead"), nil, nil, nil); err == nil {
+		t.Error("update on missing parent succeeded")
+	}
+	check := func(snap1, snap2 Snapshot) {
+		t.Helper()
+		if snap1 != nil {
+			checkAccount(t, snap1, acc1, []byte{0xaa})
+			checkAccount(t, snap1, acc2, accounts[acc2])
+			checkStorage(t, snap1, acc1, slot1, []byte{0x04})
+			checkStorage(t, snap1, acc2, slot1, []byte{0x02})
+			checkStorage(t, snap1, acc2, slot2, nil)
+		}
+		checkAccount(t, snap2, acc1, []byte{0xaa})
+		checkAccount(t, snap2, acc2, []byte{0xbb})
+		checkStorage(t, snap2, acc1, slot1, []byte{0x04})
+		checkStorage(t, snap2, acc2, slot1, nil)
+		checkStorage(t, snap2, acc2, slot2, []byte{0x05})
+	}
+	checkStorage(t, tree.Snapshot(root), acc2, slot2, []byte{0x03})
+	check(tree.Snapshot(root1), tree.Snapshot(root2))
+
+	// Capping to one layer flattens block 1, keeping the side chain
+	if err := tree.Cap(root2, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tree.Snapshot(root1).(*diskLayer); !ok {
+		t.Fatal("block 1 not flattened into the disk layer")
+	}
+	if tree.Snapshot(side) == nil {
+		t.Error("side chain on the disk layer dropped")
+	}
+	check(tree.Snapshot(root1), tree.Snapshot(root2))
+
+	// Capping all layers drops the side chain
+	sideSnap := tree.Snapshot(side)
+	if err := tree.Cap(root2, 0); err != nil {
+		t.Fatal(err)
+	}
+	if tree.Snapshot(side) != nil || tree.Snapshot(root1) != nil {
+		t.Error("stale layers retained")
+	}
+	if _, err := sideSnap.Account(acc1); err != ErrSnapshotStale {
+		t.Errorf("stale side chain read: have %v, want %v", err, ErrSnapshotStale)
+	}
+	check(nil, tree.Snapshot(root2))
+	if have := rawdb.ReadSnapshotRoot(db); have != root2 {
+		t.Errorf("persisted root mismatch: have %x, want %x", have, root2)
+	}
+}
+
+// Tests that rebuilding drops all layers and regenerates from the trie.
+func TestRebuild(t *testing.T) {
+	var (
+		db     = ethdb.NewMemDatabase()
+		triedb = trie.NewDatabase(db)
+		acc1   = common.HexToHash("0x01")
+	)
+	root, accounts := makeState(t, triedb, map[common.Hash]map[common.Hash][]byte{acc1: nil})
+	tree := New(db, triedb, types.EmptyRootHash)
+	defer tree.Stop()
+	waitGeneration(t, tree, types.EmptyRootHash)
+
+	diff := common.HexToHash("0xa1")
+	if err := tree.Update(diff, types.EmptyRootHash, nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	old := tree.Snapshot(diff)
+	tree.Rebuild(root)
+	if tree.Snapshot(diff) != nil || tree.Snapshot(types.EmptyRootHash) != nil {
+		t.Error("layers retained after rebuild")
+	}
+	if _, err := old.Account(acc1); err != ErrSnapshotStale {
+		t.Errorf("stale read: have %v, want %v", err, ErrSnapshotStale)
+	}
+	waitGeneration(t, tree, root)
+	checkAccount(t, tree.Snapshot(root), acc1, accounts[acc1])
+}
+
+// Tests that a reorg below the diff layers rewrites the disk layer in place
+// from the trie differences instead of regenerating the snapshot.
+func TestReorg(t *testing.T) {
+	var (
+		db     = ethdb.NewMemDatabase()
+		triedb = trie.NewDatabase(db)
+		acc1   = common.HexToHash("0x01")
+		acc2   = common.HexToHash("0x02")
+		acc3   = common.HexToHash("0x03")
+		acc4   = common.HexToHash("0x04")
+		slot1  = common.HexToHash("0x11")
+		slot2  = common.HexToHash("0x12")
+	)
+	root, _ := makeState(t, triedb, map[common.Hash]map[common.Hash][]byte{
+		acc1: {slot1: []byte{0x01}},
+		acc2: {slot1: []byte{0x02}, slot2: []byte{0x03}},
+		acc3: nil,
+	})
+	fork, accounts := makeState(t, triedb, map[common.Hash]map[common.Hash][]byte{
+		acc1: {slot1: []byte{0x04}, slot2: []byte{0x05}},
+		acc3: nil,
+		acc4: {slot1: []byte{0x06}},
+	})
+	tree := New(db, triedb, root)
+	defer tree.Stop()
+	waitGeneration(t, tree, root)
+	epoch := tree.Snapshot(root).(*diskLayer).epoch
+
+	diff := common.HexToHash("0xa1")
+	if err := tree.Update(diff, root, nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	old := tree.Snapshot(diff)
+	if err := tree.Reorg(fork); err != nil {
+		t.Fatal(err)
+	}
+	dl, ok := tree.Snapshot(fork).(*diskLayer)
+	if !ok {
+		t.Fatal("fork not moved into the disk layer")
+	}
+	if dl.epoch != epoch {
+		t.Errorf("epoch changed: have %d, want %d", dl.epoch, epoch)
+	}
+	waitGeneration(t, tree, fork)
+	if tree.Snapshot(root) != nil || tree.Snapshot(diff) != nil {
+		t.Error("old chain layers retained")
+	}
+	if _, err := old.Account(acc1); err != ErrSnapshotStale {
+		t.Errorf("stale read: have %v, want %v", err, ErrSnapshotStale)
+	}
+	for hash, enc := range accounts {
+		checkAccount(t, dl, hash, enc)
+	}
+	checkAccount(t, dl, acc2, nil)
+	checkStorage(t, dl, acc1, slot1, []byte{0x04})
+	checkStorage(t, dl, acc1, slot2, []byte{0x05})
+	checkStorage(t, dl, acc2, slot1, nil)
+	checkStorage(t, dl, acc2, slot2, nil)
+	checkStorage(t, dl, acc4, slot1, []byte{0x06})
+
+	if have := rawdb.ReadSnapshotRoot(db); have != fork {
+		t.Errorf("persisted root mismatch: have %x, want %x", have, fork)
+	}
+	// Reorging onto a known layer is a no-op, onto a missing state an error
+	if err := tree.Reorg(fork); err != nil {
+		t.Errorf("reorg onto known layer failed: %v", err)
+	}
+	if err := tree.Reorg(common.HexToHash("0xdead")); err == nil {
+		t.Error("reorg onto missing state succeeded")
+	}
+	// Flattening everything right after a reorg waits for the rewrite
+	if err := tree.Reorg(root); err != nil {
+		t.Fatal(err)
+	}
+	head := common.HexToHash("0xa2")
+	if err := tree.Update(head, root, nil, map[common.Hash][]byte{acc3: accounts[acc4]}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.Cap(head, 0); err != nil {
+		t.Fatal(err)
+	}
+	dl, ok = tree.Snapshot(head).(*diskLayer)
+	if !ok {
+		t.Fatal("head not flattened into the disk layer")
+	}
+	checkAccount(t, dl, acc3, accounts[acc4])
+	checkStorage(t, dl, acc2, slot2, []byte{0x03})
+	if have := rawdb.ReadSnapshotRoot(db); have != head {
+		t.Errorf("persisted root mismatch: have %x, want %x", have, head)
+	}
+}
+
+// Tests that the entries of old epochs and superseded incarnations are deleted
+// in the background.
+func TestCleaner(t *testing.T) {
+	var (
+		db     = ethdb.NewMemDatabase()
+		triedb = trie.NewDatabase(db)
+		acc1   = common.HexToHash("0x01")
+		slot1  = common.HexToHash("0x11")
+		slot2  = common.HexToHash("0x12")
+	)
+	root, _ := makeState(t, triedb, map[common.Hash]map[common.Hash][]byte{
+		acc1: {slot1: []byte{0x01}, slot2: []byte{0x02}},
+	})
+	tree := New(db, triedb, root)
+	defer tree.Stop()
+	waitGeneration(t, tree, root)
+
+	count := func(prefix []byte) (n int) {
+		db.IteratePrefix(prefix, func(key, value []byte) error {
+			n++
+			return nil
+		})
+		return n
+	}
+	wait := func(prefix []byte, want int) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if count(prefix) == want {
+				return
+			}
+		}
+		t.Fatalf("entries under %x: have %d, want %d", prefix, count(prefix), want)
+	}
+	storage := rawdb.SnapshotStoragePrefix(0, acc1)
+	if n := count(storage); n != 2 {
+		t.Fatalf("generated slots: have %d, want 2", n)
+	}
+	// Destructing the account orphans its slots, recreating it adds one
+	diff := common.HexToHash("0xa1")
+	err := tree.Update(diff, root, map[common.Hash]struct{}{acc1: {}}, map[common.Hash][]byte{acc1: {0xaa}}, map[common.Hash]map[common.Hash][]byte{
+		acc1: {slot1: []byte{0x03}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.Cap(diff, 0); err != nil {
+		t.Fatal(err)
+	}
+	wait(storage, 1)
+	checkStorage(t, tree.Snapshot(diff), acc1, slot1, []byte{0x03})
+
+	// Rebuilding orphans the whole epoch
+	tree.Rebuild(root)
+	waitGeneration(t, tree, root)
+	for _, prefix := range rawdb.SnapshotEpochPrefixes(0) {
+		wait(prefix, 0)
+	}
+	checkStorage(t, tree.Snapshot(root), acc1, slot2, []byte{0x02})
+}
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"io"
 	"math/big"
+	"sort"
 
 	"github.com/zeus-fyi/gochain/v4/common"
 	"github.com/zeus-fyi/gochain/v4/crypto"
@@ -177,11 +178,15 @@ func (so *stateObject) MarshalRLP() ([]byte, error) {
 	return so.data.MarshalRLP()
 }
 
-// setError remembers the first non-nil error it is called with.
+// setError remembers the first non-nil error it is called with. Errors of
+// historic states are surfaced through the StateDB as well.
 func (so *stateObject) setError(err error) {
 	if so.dbErr == nil {
 		so.dbErr = err
 	}
+	if so.db != nil && so.db.historic {
+		so.db.setError(err)
+	}
 }
 
 func (so *stateObject) markSuicided() {
@@ -199,10 +204,23 @@ func (so *stateObject) touch() {
 	}
 }
 
+// recorder returns the witness recorder of the owning state, if any. Objects
+// created for dumping the state have no owner.
+func (so *stateObject) recorder() *witnessRecorder {
+	if so.db == nil {
+		return nil
+	}
+	return so.db.witness
+}
+
 func (so *stateObject) getTrie(db Database) Trie {
 	if so.trie == nil {
 		var err error
-		so.trie, err = db.OpenStorageTrie(so.addrHash, so.data.Root)
+		if w := so.recorder(); w != nil {
+			so.trie, err = w.openTrie(db.TrieDB(), so.data.Root)
+		} else {
+			so.trie, err = db.OpenStorageTrie(so.addrHash, so.data.Root)
+		}
 		if err != nil {
 			so.trie, _ = db.OpenStorageTrie(so.addrHash, common.Hash{})
 			so.setError(fmt.Errorf("can't create storage trie: %v", err))
@@ -229,11 +247,29 @@ func (so *stateObject) GetCommittedState(db Database, key common.Hash) common.Ha
 	if cached {
 		return value
 	}
-	// Otherwise load the value from the database
-	enc, err := so.getTrie(db).TryGet(key[:])
-	if err != nil {
-		so.setError(err)
-		return common.Hash{}
+	// Otherwise load the value from the snapshot if possible, or the trie. The
+	// storage of accounts destructed since the snapshot is gone, and historic
+	// states have no trie to fall back to.
+	var (
+		enc []byte
+		err error
+	)
+	if so.db.snap != nil && so.db.witness == nil {
+		if _, destructed := so.db.snapDestructs[so.addrHash]; destructed {
+			so.originStorage[key] = common.Hash{}
+			return common.Hash{}
+		}
+		enc, err = so.db.snap.Storage(so.addrHash, crypto.Keccak256Hash(key[:]))
+		if err != nil && so.db.historic {
+			so.setError(err)
+			return common.Hash{}
+		}
+	}
+	if so.db.snap == nil || so.db.witness != nil || err != nil {
+		if enc, err = so.getTrie(db).TryGet(key[:]); err != nil {
+			so.setError(err)
+			return common.Hash{}
+		}
 	}
 	if len(enc) > 0 {
 		_, content, _, err := rlp.Split(enc)
@@ -267,28 +303,53 @@ func (so *stateObject) setState(key, value common.Hash) {
 }
 
 // updateTrie writes cached storage modifications into the object's storage trie.
+// Slots are written in key order, since the trie nodes resolved by deletions
+// depend on it and execution witnesses must be reproducible.
 func (so *stateObject) updateTrie(db Database) Trie {
 	tr := so.getTrie(db)
-	for key, value := range so.dirtyStorage {
+	keys := make([]common.Hash, 0, len(so.dirtyStorage))
+	for key := range so.dirtyStorage {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i][:], keys[j][:]) < 0 })
+	for _, key := range keys {
+		value := so.dirtyStorage[key]
 		delete(so.dirtyStorage, key)
 
 		// Skip noop changes, persist actual changes
 		if value == so.originStorage[key] {
 			continue
 		}
+		so.db.recordOriginStorage(so.address, key, so.originStorage[key])
 		so.originStorage[key] = value
 
 		if (value == common.Hash{}) {
 			so.setError(tr.TryDelete(key[:]))
+			so.recordSnapStorage(key, nil)
 			continue
 		}
 		// Encoding []byte cannot fail, ok to ignore the error.
 		v, _ := rlp.EncodeToBytes(bytes.TrimLeft(value[:], "\x00"))
 		so.setError(tr.TryUpdate(key[:], v))
+		so.recordSnapStorage(key, v)
 	}
 	return tr
 }
 
+// recordSnapStorage tracks a storage change for the snapshot, if any. A nil
+// value marks a deleted slot.
+func (so *stateObject) recordSnapStorage(key common.Hash, value []byte) {
+	if so.db.snap == nil {
+		return
+	}
+	storage, ok := so.db.snapStorage[so.addrHash]
+	if !ok {
+		storage = make(map[common.Hash][]byte)
+		so.db.snapStorage[so.addrHash] = storage
+	}
+	storage[crypto.Keccak256Hash(key[:])] = value
+}
+
 // UpdateRoot sets the trie root to the current root hash of
 func (so *stateObject) updateRoot(db Database) {
 	so.updateTrie(db)
@@ -382,6 +443,8 @@ func (so *stateObject) Code(db Database) []byte {
 	code, err := db.ContractCode(so.addrHash, so.data.CodeHash)
 	if err != nil {
 		so.setError(fmt.Errorf("can't load code hash %x: %v", so.data.CodeHash, err))
+	} else if w := so.recorder(); w != nil {
+		w.recordCode(so.data.CodeHash, code)
 	}
 	so.code = code
 	return code
@@ -18,6 +18,7 @@
 package state
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"math/big"
@@ -25,6 +26,7 @@ import (
 	"sync"
 
 	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/core/state/snapshot"
 	"github.com/zeus-fyi/gochain/v4/core/types"
 	"github.com/zeus-fyi/gochain/v4/crypto"
 	"github.com/zeus-fyi/gochain/v4/log"
@@ -45,6 +47,10 @@ var (
 	emptyCode = crypto.Keccak256Hash(nil)
 )
 
+// ErrHistoricState is returned when proving or committing a state which was
+// reconstructed from reverse diffs, as it has no trie to prove against.
+var ErrHistoricState = errors.New("historic state has no trie")
+
 type proofList [][]byte
 
 func (n *proofList) Put(key []byte, value []byte) error {
@@ -61,6 +67,32 @@ type StateDB struct {
 	db   Database
 	trie Trie
 
+	// Flat snapshot of the state the StateDB was opened at, consulted before
+	// the trie, along with the changes to feed the snapshot tree on commit.
+	snaps         *snapshot.Tree
+	snap          snapshot.Snapshot
+	snapDestructs map[common.Hash]struct{}
+	snapAccounts  map[common.Hash][]byte
+	snapStorage   map[common.Hash]map[common.Hash][]byte
+
+	// Recorder of the execution witness, if any.
+	witness *witnessRecorder
+
+	// Whether the state was reconstructed from reverse diffs, leaving its trie
+	// empty, and the first error a read of it ran into.
+	historic bool
+	dbErr    error
+
+	// Values of changed accounts and slots before the first change since the
+	// last commit, if recording a state diff, and the diff built by it. With
+	// diffReverse set, the reverse diff undoing the commit is built as well.
+	diffOrigins map[common.Address]*Account
+	diffStorage map[common.Address]map[common.Hash]common.Hash
+	diffWiped   map[common.Address]struct{}
+	diff        *types.StateDiff
+	diffReverse bool
+	reverse     *types.ReverseDiff
+
 	// This map holds 'live' objects, which will get modified while processing a state transition.
 	stateObjects      map[common.Address]*stateObject
 	stateObjectsDirty map[common.Address]struct{}
@@ -90,7 +122,7 @@ func New(root common.Hash, db Database) (*StateDB, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &StateDB{
+	sdb := &StateDB{
 		db:                db,
 		trie:              tr,
 		stateObjects:      make(map[common.Address]*stateObject),
@@ -98,17 +130,35 @@ func New(root common.Hash, db Database) (*StateDB, error) {
 		logs:              make(map[common.Hash][]*types.Log),
 		preimages:         make(map[common.Hash][]byte),
 		journal:           newJournal(),
-	}, nil
+	}
+	sdb.openSnapshot(root)
+	return sdb, nil
+}
+
+// openSnapshot looks up the snapshot layer of the given root, if the database
+// maintains snapshots, and resets the tracked snapshot changes.
+func (db *StateDB) openSnapshot(root common.Hash) {
+	db.snap, db.snapDestructs, db.snapAccounts, db.snapStorage = nil, nil, nil, nil
+	if db.snaps = db.db.Snapshots(); db.snaps == nil {
+		return
+	}
+	if db.snap = db.snaps.Snapshot(root); db.snap != nil {
+		db.snapDestructs = make(map[common.Hash]struct{})
+		db.snapAccounts = make(map[common.Hash][]byte)
+		db.snapStorage = make(map[common.Hash]map[common.Hash][]byte)
+	}
 }
 
 // Reset clears out all ephemeral state objects from the state db, but keeps
 // the underlying state trie to avoid reloading data for the next operations.
+// Any witness recording stops.
 func (db *StateDB) Reset(root common.Hash) error {
 	tr, err := db.db.OpenTrie(root)
 	if err != nil {
 		return err
 	}
 	db.trie = tr
+	db.witness = nil
 	db.stateObjects = make(map[common.Address]*stateObject)
 	db.stateObjectsDirty = make(map[common.Address]struct{})
 	db.thash = common.Hash{}
@@ -117,10 +167,28 @@ func (db *StateDB) Reset(root common.Hash) error {
 	db.logs = make(map[common.Hash][]*types.Log)
 	db.logSize = 0
 	db.preimages = make(map[common.Hash][]byte)
+	db.openSnapshot(root)
+	if db.diff, db.reverse = nil, nil; db.diffOrigins != nil {
+		db.RecordStateDiff()
+	}
 	db.clearJournalAndRefund()
 	return nil
 }
 
+// setError remembers the first non-nil error a read ran into.
+func (db *StateDB) setError(err error) {
+	if db.dbErr == nil {
+		db.dbErr = err
+	}
+}
+
+// Error returns the first error a read of a historic state ran into. Reads
+// failing that way return zero values, so callers executing on a historic
+// state must check it before trusting the outcome.
+func (db *StateDB) Error() error {
+	return db.dbErr
+}
+
 func (db *StateDB) AddLog(log *types.Log) {
 	db.journal.append(addLogChange{txhash: db.thash})
 
@@ -262,10 +330,14 @@ func (db *StateDB) GetCodeErr(addr common.Address) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	if stateObject != nil {
-		return stateObject.Code(db.db), nil
+	if stateObject == nil {
+		return nil, nil
+	}
+	code := stateObject.Code(db.db)
+	if db.historic && db.dbErr != nil {
+		return nil, db.dbErr
 	}
-	return nil, nil
+	return code, nil
 }
 
 func (db *StateDB) GetCodeSize(addr common.Address) int {
@@ -280,6 +352,10 @@ func (db *StateDB) GetCodeSize(addr common.Address) int {
 	if stateObject.code != nil {
 		return len(stateObject.code)
 	}
+	if db.witness != nil {
+		// Stateless execution can only derive the size from the code
+		return len(stateObject.Code(db.db))
+	}
 	size, err := db.db.ContractCodeSize(stateObject.addrHash, stateObject.data.CodeHash)
 	if err != nil {
 		log.Error("Failed to get code size", "err", err)
@@ -313,14 +389,21 @@ func (db *StateDB) GetStateErr(addr common.Address, hash common.Hash) (common.Ha
 	if err != nil {
 		return common.Hash{}, err
 	}
-	if stateObject != nil {
-		return stateObject.GetState(db.db, hash), nil
+	if stateObject == nil {
+		return common.Hash{}, nil
 	}
-	return common.Hash{}, nil
+	value := stateObject.GetState(db.db, hash)
+	if db.historic && db.dbErr != nil {
+		return common.Hash{}, db.dbErr
+	}
+	return value, nil
 }
 
 // GetProof returns the MerkleProof for a given Account
 func (self *StateDB) GetProof(a common.Address) ([][]byte, error) {
+	if self.historic {
+		return nil, ErrHistoricState
+	}
 	var proof proofList
 	err := self.trie.Prove(crypto.Keccak256(a.Bytes()), 0, &proof)
 	return [][]byte(proof), err
@@ -328,6 +411,9 @@ func (self *StateDB) GetProof(a common.Address) ([][]byte, error) {
 
 // GetProof returns the StorageProof for given key
 func (self *StateDB) GetStorageProof(a common.Address, key common.Hash) ([][]byte, error) {
+	if self.historic {
+		return nil, ErrHistoricState
+	}
 	var proof proofList
 	trie := self.StorageTrie(a)
 	if trie == nil {
@@ -337,6 +423,37 @@ func (self *StateDB) GetStorageProof(a common.Address, key common.Hash) ([][]byt
 	return [][]byte(proof), err
 }
 
+// GetStorageRangeProof returns up to max consecutive storage slots of the given
+// account from origin onwards, as the hashed keys and raw values of its storage
+// trie, along with the proof of both edges of the range.
+func (self *StateDB) GetStorageRangeProof(a common.Address, origin common.Hash, max int) (keys [][]byte, values [][]byte, proof [][]byte, err error) {
+	if self.historic {
+		return nil, nil, nil, ErrHistoricState
+	}
+	tr := self.StorageTrie(a)
+	if tr == nil {
+		return nil, nil, nil, errors.New("storage trie for requested address does not exist")
+	}
+	it := trie.NewIterator(tr.NodeIterator(origin[:]))
+	for len(keys) < max && it.Next() {
+		keys = append(keys, common.CopyBytes(it.Key))
+		values = append(values, common.CopyBytes(it.Value))
+	}
+	if it.Err != nil {
+		return nil, nil, nil, it.Err
+	}
+	var list proofList
+	if err := tr.Prove(origin[:], 0, &list); err != nil {
+		return nil, nil, nil, err
+	}
+	if len(keys) > 0 {
+		if err := tr.Prove(keys[len(keys)-1], 0, &list); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	return keys, values, [][]byte(list), nil
+}
+
 // GetCommittedState retrieves a value from the given account's committed storage trie.
 func (db *StateDB) GetCommittedState(addr common.Address, hash common.Hash) common.Hash {
 	stateObject, err := db.getStateObject(addr)
@@ -459,16 +576,38 @@ func (db *StateDB) updateStateObject(stateObject *stateObject) error {
 	if err != nil {
 		panic(fmt.Errorf("can't encode object at %x: %v", addr[:], err))
 	}
+	if db.snap != nil {
+		db.snapAccounts[stateObject.addrHash] = buf
+	}
 	return db.trie.TryUpdate(addr[:], buf)
 }
 
 // deleteStateObject removes the given object from the state trie.
 func (db *StateDB) deleteStateObject(stateObject *stateObject) error {
 	stateObject.deleted = true
+	if db.snap != nil {
+		db.snapDestructs[stateObject.addrHash] = struct{}{}
+		delete(db.snapAccounts, stateObject.addrHash)
+		delete(db.snapStorage, stateObject.addrHash)
+	}
 	addr := stateObject.Address()
 	return db.trie.TryDelete(addr[:])
 }
 
+// Loaded returns the accounts loaded into the state so far, each with the set
+// of its storage slots loaded.
+func (db *StateDB) Loaded() map[common.Address]map[common.Hash]struct{} {
+	loaded := make(map[common.Address]map[common.Hash]struct{}, len(db.stateObjects))
+	for addr, obj := range db.stateObjects {
+		slots := make(map[common.Hash]struct{}, len(obj.originStorage))
+		for key := range obj.originStorage {
+			slots[key] = struct{}{}
+		}
+		loaded[addr] = slots
+	}
+	return loaded
+}
+
 // Retrieve a state object given by the address. Returns nil if not found.
 func (db *StateDB) getStateObject(addr common.Address) (stateObject *stateObject, err error) {
 	// Prefer 'live' objects.
@@ -479,9 +618,23 @@ func (db *StateDB) getStateObject(addr common.Address) (stateObject *stateObject
 		return obj, nil
 	}
 
-	// Load the object from the database.
-	enc, err := db.trie.TryGet(addr[:])
+	// Load the object from the snapshot if possible, otherwise from the trie.
+	// Historic states have nothing to fall back to.
+	var enc []byte
+	if db.snap != nil && db.witness == nil {
+		enc, err = db.snap.Account(crypto.Keccak256Hash(addr[:]))
+		if err != nil && db.historic {
+			db.setError(err)
+			return nil, err
+		}
+	}
+	if db.snap == nil || db.witness != nil || err != nil {
+		enc, err = db.trie.TryGet(addr[:])
+	}
 	if len(enc) == 0 {
+		if err == nil {
+			db.recordOrigin(addr, nil)
+		}
 		return nil, err
 	}
 	var data Account
@@ -492,6 +645,7 @@ func (db *StateDB) getStateObject(addr common.Address) (stateObject *stateObject
 	// Insert into the live set.
 	obj := newObject(db, addr, data)
 	db.setStateObject(obj)
+	db.recordOrigin(addr, &obj.data)
 	return obj, nil
 }
 
@@ -518,12 +672,22 @@ func (db *StateDB) createObject(addr common.Address) (*stateObject, *stateObject
 	if err != nil {
 		log.Error("Failed to get state object", "err", err)
 	}
+	// An overwritten account loses its storage, which the snapshot must forget
+	var prevdestruct bool
+	if db.snap != nil && prev != nil {
+		if _, prevdestruct = db.snapDestructs[prev.addrHash]; !prevdestruct {
+			db.snapDestructs[prev.addrHash] = struct{}{}
+		}
+	}
+	if prev != nil {
+		db.recordWipe(addr)
+	}
 	newobj := newObject(db, addr, Account{})
 	newobj.setNonce(0) // sets the object to dirty
 	if prev == nil {
 		db.journal.append(createObjectChange{account: &addr})
 	} else {
-		db.journal.append(resetObjectChange{prev: prev})
+		db.journal.append(resetObjectChange{prev: prev, prevdestruct: prevdestruct})
 	}
 	db.setStateObject(newobj)
 	return newobj, prev
@@ -611,6 +775,44 @@ func (db *StateDB) Copy() *StateDB {
 	for hash, preimage := range db.preimages {
 		state.preimages[hash] = preimage
 	}
+	if db.diffOrigins != nil {
+		state.diffOrigins = make(map[common.Address]*Account, len(db.diffOrigins))
+		for addr, origin := range db.diffOrigins {
+			state.diffOrigins[addr] = origin
+		}
+		state.diffStorage = make(map[common.Address]map[common.Hash]common.Hash, len(db.diffStorage))
+		for addr, slots := range db.diffStorage {
+			cpy := make(map[common.Hash]common.Hash, len(slots))
+			for key, value := range slots {
+				cpy[key] = value
+			}
+			state.diffStorage[addr] = cpy
+		}
+		state.diffWiped = make(map[common.Address]struct{}, len(db.diffWiped))
+		for addr := range db.diffWiped {
+			state.diffWiped[addr] = struct{}{}
+		}
+		state.diffReverse = db.diffReverse
+	}
+	state.snaps, state.snap, state.historic, state.dbErr = db.snaps, db.snap, db.historic, db.dbErr
+	if db.snap != nil {
+		state.snapDestructs = make(map[common.Hash]struct{}, len(db.snapDestructs))
+		for hash := range db.snapDestructs {
+			state.snapDestructs[hash] = struct{}{}
+		}
+		state.snapAccounts = make(map[common.Hash][]byte, len(db.snapAccounts))
+		for hash, data := range db.snapAccounts {
+			state.snapAccounts[hash] = data
+		}
+		state.snapStorage = make(map[common.Hash]map[common.Hash][]byte, len(db.snapStorage))
+		for hash, slots := range db.snapStorage {
+			cpy := make(map[common.Hash][]byte, len(slots))
+			for slot, data := range slots {
+				cpy[slot] = data
+			}
+			state.snapStorage[hash] = cpy
+		}
+	}
 	return state
 }
 
@@ -646,7 +848,13 @@ func (db *StateDB) GetRefund() uint64 {
 // Finalise finalises the state by removing the self destructed objects
 // and clears the journal as well as the refunds.
 func (db *StateDB) Finalise(deleteEmptyObjects bool) {
+	// Update the account trie in address order, like storage tries.
+	addrs := make([]common.Address, 0, len(db.journal.dirties))
 	for addr := range db.journal.dirties {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return bytes.Compare(addrs[i][:], addrs[j][:]) < 0 })
+	for _, addr := range addrs {
 		stateObject, exist := db.stateObjects[addr]
 		if !exist {
 			// ripeMD is 'touched' at block 1714175, in tx 0x1237f737031e40bcde4a8b7e717b2d15e3ecadfe49bb1bbc71ee9deb09c6fcf2
@@ -672,9 +880,13 @@ func (db *StateDB) Finalise(deleteEmptyObjects bool) {
 
 // IntermediateRoot computes the current root hash of the state trie.
 // It is called in between transactions to get the root hash that
-// goes into transaction receipts.
+// goes into transaction receipts. The root of a historic state is unknown, so
+// the zero hash is returned for it.
 func (db *StateDB) IntermediateRoot(deleteEmptyObjects bool) common.Hash {
 	db.Finalise(deleteEmptyObjects)
+	if db.historic {
+		return common.Hash{}
+	}
 	return db.trie.Hash()
 }
 
@@ -694,6 +906,9 @@ func (db *StateDB) clearJournalAndRefund() {
 
 // Commit writes the state to the underlying in-memory trie database.
 func (db *StateDB) Commit(deleteEmptyObjects bool) (root common.Hash, err error) {
+	if db.historic {
+		return common.Hash{}, ErrHistoricState
+	}
 	defer db.clearJournalAndRefund()
 
 	for addr := range db.journal.dirties {
@@ -738,5 +953,25 @@ func (db *StateDB) Commit(deleteEmptyObjects bool) (root common.Hash, err error)
 		return nil
 	})
 	log.Debug("Trie cache stats after commit", "misses", trie.CacheMisses(), "unloads", trie.CacheUnloads())
+
+	if db.diffOrigins != nil && err == nil {
+		if db.diffReverse {
+			err = db.buildReverseDiff()
+		}
+		if err == nil {
+			err = db.buildStateDiff(root)
+		}
+	}
+
+	// Feed the changes into the snapshot tree as a new layer. The snapshot no
+	// longer matches the committed state, so stop consulting it.
+	if db.snap != nil && db.snaps != nil {
+		if parent := db.snap.Root(); err == nil && parent != root {
+			if err := db.snaps.Update(root, parent, db.snapDestructs, db.snapAccounts, db.snapStorage); err != nil {
+				log.Warn("Failed to update state snapshot", "parent", parent, "root", root, "err", err)
+			}
+		}
+		db.snap, db.snapDestructs, db.snapAccounts, db.snapStorage = nil, nil, nil, nil
+	}
 	return root, err
 }
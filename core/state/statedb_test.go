@@ -19,6 +19,7 @@ package state
 import (
 	"bytes"
 	"encoding/binary"
+	"encoding/json"
 	"fmt"
 	"math"
 	"math/big"
@@ -31,8 +32,11 @@ import (
 	"gopkg.in/check.v1"
 
 	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/core/state/snapshot"
 	"github.com/zeus-fyi/gochain/v4/core/types"
+	"github.com/zeus-fyi/gochain/v4/crypto"
 	"github.com/zeus-fyi/gochain/v4/ethdb"
+	"github.com/zeus-fyi/gochain/v4/trie"
 )
 
 // Tests that updating a state trie does not leak any database writes prior to
@@ -438,3 +442,240 @@ func TestCopyOfCopy(t *testing.T) {
 		t.Fatalf("2nd copy fail, expected 42, got %v", got)
 	}
 }
+
+// Tests that state read through a flat snapshot matches the trie, and that
+// committing feeds the changes, including wiped storage, into the snapshot.
+func TestFlatSnapshot(t *testing.T) {
+	var (
+		db    = ethdb.NewMemDatabase()
+		sdb   = NewDatabase(db)
+		addr1 = common.BytesToAddress([]byte{0x01})
+		addr2 = common.BytesToAddress([]byte{0x02})
+		key1  = common.BytesToHash([]byte{0x11})
+		key2  = common.BytesToHash([]byte{0x12})
+	)
+	state, _ := New(common.Hash{}, sdb)
+	state.SetBalance(addr1, big.NewInt(1))
+	state.SetState(addr1, key1, common.BytesToHash([]byte{0x01}))
+	state.SetState(addr2, key1, common.BytesToHash([]byte{0x02}))
+	state.SetState(addr2, key2, common.BytesToHash([]byte{0x03}))
+	root, err := state.Commit(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snaps := snapshot.New(db, sdb.TrieDB(), root)
+	defer snaps.Stop()
+	for {
+		if _, err := snaps.Snapshot(root).Account(crypto.Keccak256Hash(addr1[:])); err != snapshot.ErrNotCoveredYet {
+			break
+		}
+	}
+	// Update a slot of addr1 and overwrite addr2, whose storage must be wiped
+	state, _ = New(root, WithSnapshots(sdb, snaps))
+	if have := state.GetState(addr2, key2); have != common.BytesToHash([]byte{0x03}) {
+		t.Fatalf("snapshot storage mismatch: have %x", have)
+	}
+	state.SetState(addr1, key1, common.BytesToHash([]byte{0x04}))
+	state.CreateAccount(addr2)
+	state.SetState(addr2, key2, common.BytesToHash([]byte{0x05}))
+
+	// A reverted overwrite must not wipe storage
+	addr3 := common.BytesToAddress([]byte{0x03})
+	state.SetBalance(addr3, big.NewInt(3))
+	state.Finalise(false)
+	id := state.Snapshot()
+	state.CreateAccount(addr3)
+	state.RevertToSnapshot(id)
+	if _, destructed := state.snapDestructs[crypto.Keccak256Hash(addr3[:])]; destructed {
+		t.Error("reverted overwrite recorded as destruct")
+	}
+	next, err := state.Commit(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snaps.Snapshot(next) == nil {
+		t.Fatal("no snapshot layer for committed state")
+	}
+	state, _ = New(next, WithSnapshots(sdb, snaps))
+	if state.snap == nil {
+		t.Fatal("state not opened on the snapshot")
+	}
+	for _, tt := range []struct {
+		addr      common.Address
+		key, want common.Hash
+	}{
+		{addr1, key1, common.BytesToHash([]byte{0x04})},
+		{addr2, key1, common.Hash{}},
+		{addr2, key2, common.BytesToHash([]byte{0x05})},
+	} {
+		if have := state.GetState(tt.addr, tt.key); have != tt.want {
+			t.Errorf("%x/%x: have %x, want %x", tt.addr, tt.key, have, tt.want)
+		}
+	}
+	if have := state.GetBalance(addr3); have.Cmp(big.NewInt(3)) != 0 {
+		t.Errorf("balance mismatch: have %v, want 3", have)
+	}
+}
+
+// Tests that storage ranges are proven against the storage root, walking all
+// the slots of an account range by range.
+func TestStorageRangeProof(t *testing.T) {
+	state, _ := New(common.Hash{}, NewDatabase(ethdb.NewMemDatabase()))
+	addr := common.BytesToAddress([]byte{0x01})
+	for i := int64(1); i <= 100; i++ {
+		state.SetState(addr, common.BigToHash(big.NewInt(i)), common.BigToHash(big.NewInt(i*i)))
+	}
+	state.Commit(false)
+	root := state.StorageTrie(addr).Hash()
+
+	var (
+		origin common.Hash
+		slots  int
+	)
+	for {
+		keys, values, proof, err := state.GetStorageRangeProof(addr, origin, 30)
+		if err != nil {
+			t.Fatalf("failed to prove range from %x: %v", origin, err)
+		}
+		proofDb := ethdb.NewMemDatabase()
+		for _, node := range proof {
+			proofDb.Put(crypto.Keccak256(node), node)
+		}
+		last := origin[:]
+		if len(keys) > 0 {
+			last = keys[len(keys)-1]
+		}
+		more, err := trie.VerifyRangeProof(root, origin[:], last, keys, values, proofDb)
+		if err != nil {
+			t.Fatalf("invalid range from %x: %v", origin, err)
+		}
+		slots += len(keys)
+		if !more {
+			break
+		}
+		origin = common.BigToHash(new(big.Int).Add(new(big.Int).SetBytes(last), common.Big1))
+	}
+	if slots != 100 {
+		t.Fatalf("proven slot count mismatch: have %d, want 100", slots)
+	}
+}
+
+// Tests that the state diff built on commit holds the before and after values
+// of every changed account and slot, and that recording restarts after it.
+func TestStateDiff(t *testing.T) {
+	var (
+		db    = NewDatabase(ethdb.NewMemDatabase())
+		addr1 = common.BytesToAddress([]byte{0x01})
+		addr2 = common.BytesToAddress([]byte{0x02})
+		addr3 = common.BytesToAddress([]byte{0x03})
+		addr4 = common.BytesToAddress([]byte{0x04})
+		key1  = common.Hash{0x01}
+		key2  = common.Hash{0x02}
+	)
+	state, _ := New(common.Hash{}, db)
+	state.SetBalance(addr1, big.NewInt(10))
+	state.SetState(addr1, key1, common.Hash{0x11})
+	state.SetState(addr1, key2, common.Hash{0x12})
+	state.SetBalance(addr2, big.NewInt(20))
+	state.SetBalance(addr4, big.NewInt(40))
+	root, _ := state.Commit(false)
+
+	state, _ = New(root, db)
+	state.RecordStateDiff()
+	state.SetState(addr1, key1, common.Hash{0x21})
+	state.SetState(addr1, key2, common.Hash{})
+	state.SetNonce(addr1, 5)
+	state.Suicide(addr2)
+	state.SetCode(addr3, []byte{0x60, 0x00})
+	state.Finalise(true)
+	state.SetBalance(addr3, big.NewInt(30))
+	state.GetBalance(addr4) // reads are not changes
+	root, _ = state.Commit(true)
+
+	want := []*types.AccountDiff{
+		{
+			Address: addr1, BalanceFrom: big.NewInt(10), BalanceTo: big.NewInt(10), NonceTo: 5,
+			CodeHashFrom: emptyCode, CodeHashTo: emptyCode,
+			Storage: []types.StorageDiff{
+				{Key: key1, From: common.Hash{0x11}, To: common.Hash{0x21}},
+				{Key: key2, From: common.Hash{0x12}},
+			},
+		},
+		{
+			Address: addr2, Deleted: true, BalanceFrom: big.NewInt(20), BalanceTo: new(big.Int),
+			CodeHashFrom: emptyCode, Storage: []types.StorageDiff{},
+		},
+		{
+			Address: addr3, Created: true, BalanceFrom: new(big.Int), BalanceTo: big.NewInt(30),
+			CodeHashTo: crypto.Keccak256Hash([]byte{0x60, 0x00}), Code: []byte{0x60, 0x00},
+			Storage: []types.StorageDiff{},
+		},
+	}
+	diff := state.StateDiff()
+	if diff == nil || diff.Root != root {
+		t.Fatalf("diff root mismatch: have %v, want %x", diff, root)
+	}
+	if !reflect.DeepEqual(diff.Accounts, want) {
+		t.Fatalf("diff mismatch:\nhave %s\nwant %s", diffJSON(diff.Accounts), diffJSON(want))
+	}
+	// Live objects must diff against their committed values afterwards.
+	state.AddBalance(addr3, big.NewInt(1))
+	state.Commit(true)
+	if diff := state.StateDiff(); len(diff.Accounts) != 1 || diff.Accounts[0].BalanceFrom.Int64() != 30 || diff.Accounts[0].Created {
+		t.Fatalf("second diff mismatch: %s", diffJSON(diff.Accounts))
+	}
+}
+
+func diffJSON(v interface{}) string {
+	enc, _ := json.Marshal(v)
+	return string(enc)
+}
+
+// Tests that the storage of destructed and overwritten accounts is listed in
+// full in the state diff, with zero values for the slots gone afterwards.
+func TestStateDiffWipedStorage(t *testing.T) {
+	var (
+		db        = NewDatabase(ethdb.NewMemDatabase())
+		destroyed = common.BytesToAddress([]byte{0x01})
+		recreated = common.BytesToAddress([]byte{0x02})
+		key1      = common.Hash{0x01}
+		key2      = common.Hash{0x02}
+	)
+	state, _ := New(common.Hash{}, db)
+	for _, addr := range []common.Address{destroyed, recreated} {
+		state.SetBalance(addr, big.NewInt(1))
+		state.SetState(addr, key1, common.Hash{0x11})
+		state.SetState(addr, key2, common.Hash{0x12})
+	}
+	root, _ := state.Commit(false)
+
+	state, _ = New(root, db)
+	state.RecordStateDiff()
+	state.Suicide(destroyed)
+	state.CreateAccount(recreated)
+	state.SetState(recreated, key2, common.Hash{0x22})
+	state.Commit(true)
+
+	want := map[common.Address][]types.StorageDiff{
+		destroyed: {
+			{Key: key1, From: common.Hash{0x11}},
+			{Key: key2, From: common.Hash{0x12}},
+		},
+		recreated: {
+			{Key: key1, From: common.Hash{0x11}},
+			{Key: key2, From: common.Hash{0x12}, To: common.Hash{0x22}},
+		},
+	}
+	diff := state.StateDiff()
+	if len(diff.Accounts) != len(want) {
+		t.Fatalf("diffed accounts mismatch: have %s", diffJSON(diff.Accounts))
+	}
+	for _, account := range diff.Accounts {
+		if !reflect.DeepEqual(account.Storage, want[account.Address]) {
+			t.Errorf("storage diff of %x mismatch:\nhave %s\nwant %s", account.Address, diffJSON(account.Storage), diffJSON(want[account.Address]))
+		}
+	}
+	if !diff.Accounts[0].Deleted || diff.Accounts[1].Deleted {
+		t.Errorf("deletion flags mismatch: %s", diffJSON(diff.Accounts))
+	}
+}
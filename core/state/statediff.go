@@ -0,0 +1,284 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"bytes"
+	"math/big"
+	"sort"
+
+	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/core/types"
+	"github.com/zeus-fyi/gochain/v4/crypto"
+	"github.com/zeus-fyi/gochain/v4/rlp"
+	"github.com/zeus-fyi/gochain/v4/trie"
+)
+
+// RecordStateDiff starts recording the account and storage changes made to
+// the state, which are assembled into a diff by the next Commit.
+func (db *StateDB) RecordStateDiff() {
+	db.diffOrigins = make(map[common.Address]*Account)
+	db.diffStorage = make(map[common.Address]map[common.Hash]common.Hash)
+	db.diffWiped = make(map[common.Address]struct{})
+}
+
+// RecordReverseDiff starts recording like RecordStateDiff, additionally
+// building the reverse diff of the changes on the next Commit.
+func (db *StateDB) RecordReverseDiff() {
+	db.RecordStateDiff()
+	db.diffReverse = true
+}
+
+// StateDiff returns the changes made between the last two commits, or nil if
+// they weren't recorded.
+func (db *StateDB) StateDiff() *types.StateDiff {
+	return db.diff
+}
+
+// ReverseDiff returns the values overwritten between the last two commits, or
+// nil if they weren't recorded.
+func (db *StateDB) ReverseDiff() *types.ReverseDiff {
+	return db.reverse
+}
+
+// recordOrigin remembers the value of an account before any change, which is
+// nil if it did not exist.
+func (db *StateDB) recordOrigin(addr common.Address, data *Account) {
+	if db.diffOrigins == nil {
+		return
+	}
+	if _, ok := db.diffOrigins[addr]; ok {
+		return
+	}
+	if data != nil {
+		cpy := *data
+		cpy.Balance = new(big.Int).Set(data.Balance)
+		data = &cpy
+	}
+	db.diffOrigins[addr] = data
+}
+
+// recordWipe remembers that the storage of an account was dropped by
+// overwriting it with a new one.
+func (db *StateDB) recordWipe(addr common.Address) {
+	if db.diffWiped != nil {
+		db.diffWiped[addr] = struct{}{}
+	}
+}
+
+// recordOriginStorage remembers the value of a storage slot before any change.
+func (db *StateDB) recordOriginStorage(addr common.Address, key, value common.Hash) {
+	if db.diffStorage == nil {
+		return
+	}
+	slots := db.diffStorage[addr]
+	if slots == nil {
+		slots = make(map[common.Hash]common.Hash)
+		db.diffStorage[addr] = slots
+	}
+	if _, ok := slots[key]; !ok {
+		slots[key] = value
+	}
+}
+
+// buildStateDiff compares the recorded origins with the committed state and
+// restarts recording on top of it. All prior storage of destructed and
+// overwritten accounts is listed, read from the committed parent trie.
+func (db *StateDB) buildStateDiff(root common.Hash) error {
+	diff := &types.StateDiff{Root: root, Accounts: []*types.AccountDiff{}}
+	for addr, origin := range db.diffOrigins {
+		var post *stateObject
+		if obj := db.stateObjects[addr]; obj != nil && !obj.deleted {
+			post = obj
+		}
+		if origin == nil && post == nil {
+			continue
+		}
+		account := &types.AccountDiff{
+			Address:     addr,
+			Created:     origin == nil,
+			Deleted:     post == nil,
+			BalanceFrom: new(big.Int),
+			BalanceTo:   new(big.Int),
+			Storage:     []types.StorageDiff{},
+		}
+		if origin != nil {
+			account.BalanceFrom.Set(origin.Balance)
+			account.NonceFrom = origin.Nonce
+			account.CodeHashFrom = origin.CodeHash
+		}
+		if post != nil {
+			account.BalanceTo.Set(post.data.Balance)
+			account.NonceTo = post.data.Nonce
+			account.CodeHashTo = post.data.CodeHash
+			if account.CodeHashTo != account.CodeHashFrom {
+				account.Code = post.Code(db.db)
+			}
+		}
+		origins := db.diffStorage[addr]
+		if _, wiped := db.diffWiped[addr]; origin != nil && (wiped || post == nil) {
+			// Slots only written after the wipe were recorded with zero origins
+			prior, err := db.storageAt(addr, origin.Root)
+			if err != nil {
+				return err
+			}
+			for key, from := range origins {
+				if _, ok := prior[key]; !ok {
+					prior[key] = from
+				}
+			}
+			origins = prior
+		}
+		for key, from := range origins {
+			var to common.Hash
+			if post != nil {
+				to = post.originStorage[key]
+			}
+			if from != to {
+				account.Storage = append(account.Storage, types.StorageDiff{Key: key, From: from, To: to})
+			}
+		}
+		sort.Slice(account.Storage, func(i, j int) bool {
+			return bytes.Compare(account.Storage[i].Key[:], account.Storage[j].Key[:]) < 0
+		})
+		if !account.Created && !account.Deleted && len(account.Storage) == 0 &&
+			account.BalanceFrom.Cmp(account.BalanceTo) == 0 && account.NonceFrom == account.NonceTo && account.CodeHashFrom == account.CodeHashTo {
+			continue
+		}
+		diff.Accounts = append(diff.Accounts, account)
+	}
+	sort.Slice(diff.Accounts, func(i, j int) bool {
+		return bytes.Compare(diff.Accounts[i].Address[:], diff.Accounts[j].Address[:]) < 0
+	})
+	db.diff = diff
+
+	// Live objects won't be loaded again, so their committed values are the
+	// origins of the next diff.
+	db.RecordStateDiff()
+	for addr, obj := range db.stateObjects {
+		if obj.deleted {
+			db.recordOrigin(addr, nil)
+		} else {
+			db.recordOrigin(addr, &obj.data)
+		}
+	}
+	return nil
+}
+
+// storageAt reads the storage of an account from its trie of the given root,
+// keyed by slot. Slots whose key preimage is unknown can't be listed.
+func (db *StateDB) storageAt(addr common.Address, root common.Hash) (map[common.Hash]common.Hash, error) {
+	storage := make(map[common.Hash]common.Hash)
+	if root == types.EmptyRootHash {
+		return storage, nil
+	}
+	tr, err := db.db.OpenStorageTrie(crypto.Keccak256Hash(addr[:]), root)
+	if err != nil {
+		return nil, err
+	}
+	it := trie.NewIterator(tr.NodeIterator(nil))
+	for it.Next() {
+		key := tr.GetKey(it.Key)
+		if key == nil {
+			continue
+		}
+		_, content, _, err := rlp.Split(it.Value)
+		if err != nil {
+			return nil, err
+		}
+		storage[common.BytesToHash(key)] = common.BytesToHash(content)
+	}
+	return storage, it.Err
+}
+
+// buildReverseDiff collects the values overwritten since recording started.
+// Accounts which were destructed or overwritten have all their prior storage
+// listed, which is read from the committed parent trie.
+func (db *StateDB) buildReverseDiff() error {
+	diff := &types.ReverseDiff{Accounts: []*types.ReverseAccount{}, Codes: [][]byte{}}
+	for addr, origin := range db.diffOrigins {
+		var post *stateObject
+		if obj := db.stateObjects[addr]; obj != nil && !obj.deleted {
+			post = obj
+		}
+		account := &types.ReverseAccount{Hash: crypto.Keccak256Hash(addr[:]), Storage: []types.ReverseSlot{}}
+		if origin != nil {
+			enc, err := rlp.EncodeToBytes(origin)
+			if err != nil {
+				return err
+			}
+			account.Account = enc
+		}
+		_, wiped := db.diffWiped[addr]
+		switch {
+		case origin == nil:
+			// No storage before the account existed.
+		case wiped || post == nil:
+			account.Wiped = true
+			if origin.Root != types.EmptyRootHash {
+				tr, err := db.db.OpenStorageTrie(account.Hash, origin.Root)
+				if err != nil {
+					return err
+				}
+				it := trie.NewIterator(tr.NodeIterator(nil))
+				for it.Next() {
+					account.Storage = append(account.Storage, types.ReverseSlot{Hash: common.BytesToHash(it.Key), Value: common.CopyBytes(it.Value)})
+				}
+				if it.Err != nil {
+					return it.Err
+				}
+			}
+		default:
+			for key, value := range db.diffStorage[addr] {
+				if value == post.originStorage[key] {
+					continue
+				}
+				slot := types.ReverseSlot{Hash: crypto.Keccak256Hash(key[:])}
+				if (value != common.Hash{}) {
+					slot.Value, _ = rlp.EncodeToBytes(bytes.TrimLeft(value[:], "\x00"))
+				}
+				account.Storage = append(account.Storage, slot)
+			}
+		}
+		if !account.Wiped && len(account.Storage) == 0 {
+			if post == nil && origin == nil {
+				continue
+			}
+			if post != nil {
+				if enc, _ := rlp.EncodeToBytes(&post.data); bytes.Equal(enc, account.Account) {
+					continue
+				}
+			}
+		}
+		if origin != nil && origin.CodeHash != emptyCode && (post == nil || post.data.CodeHash != origin.CodeHash) {
+			code, err := db.db.ContractCode(account.Hash, origin.CodeHash)
+			if err != nil {
+				return err
+			}
+			diff.Codes = append(diff.Codes, code)
+		}
+		sort.Slice(account.Storage, func(i, j int) bool {
+			return bytes.Compare(account.Storage[i].Hash[:], account.Storage[j].Hash[:]) < 0
+		})
+		diff.Accounts = append(diff.Accounts, account)
+	}
+	sort.Slice(diff.Accounts, func(i, j int) bool {
+		return bytes.Compare(diff.Accounts[i].Hash[:], diff.Accounts[j].Hash[:]) < 0
+	})
+	db.reverse = diff
+	return nil
+}
@@ -0,0 +1,153 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+
+	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/core/types"
+	"github.com/zeus-fyi/gochain/v4/crypto"
+	"github.com/zeus-fyi/gochain/v4/ethdb"
+	"github.com/zeus-fyi/gochain/v4/trie"
+)
+
+// witnessRecorder collects the trie nodes, contract codes and headers
+// accessed by a StateDB recording its execution witness.
+type witnessRecorder struct {
+	lock    sync.Mutex
+	nodes   map[common.Hash][]byte
+	codes   map[common.Hash][]byte
+	headers []*types.Header
+}
+
+func newWitnessRecorder() *witnessRecorder {
+	return &witnessRecorder{
+		nodes: make(map[common.Hash][]byte),
+		codes: make(map[common.Hash][]byte),
+	}
+}
+
+func (w *witnessRecorder) recordNode(hash common.Hash, blob []byte) {
+	w.lock.Lock()
+	w.nodes[hash] = blob
+	w.lock.Unlock()
+}
+
+func (w *witnessRecorder) recordCode(hash common.Hash, code []byte) {
+	w.lock.Lock()
+	w.codes[hash] = code
+	w.lock.Unlock()
+}
+
+// openTrie opens a trie of root on triedb which reports every node it loads,
+// including the root, to the recorder. The trie is opened afresh rather than
+// through the state database, as cached tries have their nodes loaded already.
+func (w *witnessRecorder) openTrie(triedb *trie.Database, root common.Hash) (*trie.SecureTrie, error) {
+	tr, err := trie.NewSecure(root, triedb, 0)
+	if err != nil {
+		return nil, err
+	}
+	if root != (common.Hash{}) && root != types.EmptyRootHash {
+		if blob, err := triedb.Node(root); err == nil {
+			w.recordNode(root, blob)
+		}
+	}
+	tr.SetRecorder(w.recordNode)
+	return tr, nil
+}
+
+// RecordWitness starts recording the execution witness of the state: every
+// trie node and contract code accessed from now on. It must be called before
+// any state is accessed. Snapshot reads are bypassed while recording, as they
+// would skip the trie nodes. Copies of the state don't record.
+func (db *StateDB) RecordWitness() error {
+	w := newWitnessRecorder()
+	tr, err := w.openTrie(db.db.TrieDB(), db.trie.Hash())
+	if err != nil {
+		return err
+	}
+	db.trie, db.witness = tr, w
+	return nil
+}
+
+// RecordingWitness reports whether the state records its execution witness.
+func (db *StateDB) RecordingWitness() bool {
+	return db.witness != nil
+}
+
+// RecordWitnessHeaders adds the ancestor headers accessed while executing on
+// top of the state to its witness, if recording.
+func (db *StateDB) RecordWitnessHeaders(headers []*types.Header) {
+	if db.witness == nil {
+		return
+	}
+	db.witness.lock.Lock()
+	db.witness.headers = append(db.witness.headers, headers...)
+	db.witness.lock.Unlock()
+}
+
+// Witness returns the execution witness recorded so far, or nil if the state
+// isn't recording one.
+func (db *StateDB) Witness() *types.Witness {
+	if db.witness == nil {
+		return nil
+	}
+	return db.witness.witness()
+}
+
+// witness returns the recorded state sorted by hash, and the headers.
+func (w *witnessRecorder) witness() *types.Witness {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return &types.Witness{
+		Headers: append([]*types.Header{}, w.headers...),
+		Codes:   sortedBlobs(w.codes),
+		Nodes:   sortedBlobs(w.nodes),
+	}
+}
+
+func sortedBlobs(blobs map[common.Hash][]byte) [][]byte {
+	hashes := make([]common.Hash, 0, len(blobs))
+	for hash := range blobs {
+		hashes = append(hashes, hash)
+	}
+	sort.Slice(hashes, func(i, j int) bool { return bytes.Compare(hashes[i][:], hashes[j][:]) < 0 })
+
+	list := make([][]byte, len(hashes))
+	for i, hash := range hashes {
+		list[i] = blobs[hash]
+	}
+	return list
+}
+
+// NewStatelessDatabase returns a state database serving only the contents of
+// the given witness. Accessing anything not covered by it fails with a missing
+// trie node error.
+func NewStatelessDatabase(witness *types.Witness) Database {
+	db := ethdb.NewMemDatabase()
+	for _, node := range witness.Nodes {
+		db.Put(crypto.Keccak256(node), node)
+	}
+	for _, code := range witness.Codes {
+		db.Put(crypto.Keccak256(code), code)
+	}
+	return NewDatabase(db)
+}
@@ -0,0 +1,135 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/consensus"
+	"github.com/zeus-fyi/gochain/v4/core/state"
+	"github.com/zeus-fyi/gochain/v4/core/types"
+	"github.com/zeus-fyi/gochain/v4/core/vm"
+	"github.com/zeus-fyi/gochain/v4/metrics"
+	"github.com/zeus-fyi/gochain/v4/params"
+)
+
+var (
+	blockPrefetchExecuteTimer   = metrics.NewRegisteredTimer("chain/prefetch/executes", nil)
+	blockPrefetchInterruptMeter = metrics.NewRegisteredMeter("chain/prefetch/interrupts", nil)
+	blockPrefetchHitMeter       = metrics.NewRegisteredMeter("chain/prefetch/hits", nil)
+	blockPrefetchMissMeter      = metrics.NewRegisteredMeter("chain/prefetch/misses", nil)
+)
+
+// statePrefetcher is a basic Prefetcher, which blindly executes a block on top
+// of an arbitrary state with the goal of loading the accounts, storage slots
+// and trie nodes it touches into the caches, before the main block processor
+// starts executing it.
+type statePrefetcher struct {
+	config *params.ChainConfig // Chain configuration options
+	bc     *BlockChain         // Canonical block chain
+	engine consensus.Engine    // Consensus engine used for block rewards
+}
+
+// newStatePrefetcher initialises a new statePrefetcher.
+func newStatePrefetcher(config *params.ChainConfig, bc *BlockChain, engine consensus.Engine) *statePrefetcher {
+	return &statePrefetcher{
+		config: config,
+		bc:     bc,
+		engine: engine,
+	}
+}
+
+// Prefetch processes the transactions of block using the statedb, but any
+// changes are discarded. Execution stops at the first failing transaction,
+// since the state is only a guess, or once interrupt is set.
+func (p *statePrefetcher) Prefetch(block *types.Block, statedb *state.StateDB, cfg vm.Config, interrupt *uint32) {
+	var (
+		header  = block.Header()
+		usedGas = new(uint64)
+		gp      = new(GasPool).AddGas(block.GasLimit())
+		signer  = types.MakeSigner(p.config, header.Number)
+	)
+	vmenv := vm.NewEVM(NewEVMContextLite(header, p.bc, nil), statedb, p.config, cfg)
+	for i, tx := range block.Transactions() {
+		if atomic.LoadUint32(interrupt) == 1 {
+			blockPrefetchInterruptMeter.Mark(1)
+			return
+		}
+		statedb.Prepare(tx.Hash(), block.Hash(), i)
+		if _, _, err := ApplyTransaction(vmenv, p.config, gp, statedb, header, tx, usedGas, signer); err != nil {
+			return
+		}
+	}
+}
+
+// prefetch is a block prefetch running in the background.
+type prefetch struct {
+	hash      common.Hash
+	state     *state.StateDB
+	interrupt uint32
+	done      chan struct{}
+}
+
+// prefetch starts executing block on statedb in the background, until stopped.
+func (bc *BlockChain) prefetch(block *types.Block, statedb *state.StateDB) *prefetch {
+	pf := &prefetch{hash: block.Hash(), state: statedb, done: make(chan struct{})}
+	go func(start time.Time) {
+		defer close(pf.done)
+		bc.prefetcher.Prefetch(block, statedb, bc.vmConfig, &pf.interrupt)
+		blockPrefetchExecuteTimer.UpdateSince(start)
+	}(time.Now())
+	return pf
+}
+
+// stop interrupts the prefetch before its next transaction.
+func (pf *prefetch) stop() {
+	atomic.StoreUint32(&pf.interrupt, 1)
+}
+
+// report marks the accounts and storage slots loaded while processing the
+// prefetched block as hits if the prefetch loaded them too, or misses
+// otherwise. Prefetches which are still running are skipped.
+func (pf *prefetch) report(processed *state.StateDB) {
+	select {
+	case <-pf.done:
+	default:
+		return
+	}
+	var (
+		prefetched   = pf.state.Loaded()
+		hits, misses int64
+	)
+	for addr, keys := range processed.Loaded() {
+		slots, ok := prefetched[addr]
+		if !ok {
+			misses += int64(1 + len(keys))
+			continue
+		}
+		hits++
+		for key := range keys {
+			if _, ok := slots[key]; ok {
+				hits++
+			} else {
+				misses++
+			}
+		}
+	}
+	blockPrefetchHitMeter.Mark(hits)
+	blockPrefetchMissMeter.Mark(misses)
+}
@@ -17,6 +17,11 @@
 package core
 
 import (
+	"context"
+
+	"go.opencensus.io/trace"
+
+	"github.com/zeus-fyi/gochain/v4/common"
 	"github.com/zeus-fyi/gochain/v4/consensus"
 	"github.com/zeus-fyi/gochain/v4/core/state"
 	"github.com/zeus-fyi/gochain/v4/core/types"
@@ -52,7 +57,34 @@ func NewStateProcessor(config *params.ChainConfig, bc *BlockChain, engine consen
 // Process returns the receipts and logs accumulated during the process and
 // returns the amount of gas that was used in the process. If any of the
 // transactions failed to execute due to insufficient gas it will return an error.
+//
+// If the state records its execution witness, the ancestor headers accessed
+// are added to it.
 func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB, cfg vm.Config) (types.Receipts, []*types.Log, uint64, error) {
+	_, span := trace.StartSpan(context.Background(), "StateProcessor.Process")
+	defer span.End()
+	span.AddAttributes(trace.Int64Attribute("number", int64(block.NumberU64())), trace.Int64Attribute("txs", int64(len(block.Transactions()))))
+
+	if !statedb.RecordingWitness() {
+		return p.process(block, statedb, p.bc, cfg)
+	}
+	chain := &witnessChain{processChain: p.bc, headers: make(map[common.Hash]*types.Header)}
+	receipts, allLogs, usedGas, err := p.process(block, statedb, chain, cfg)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	statedb.RecordWitnessHeaders(chain.accessed())
+	return receipts, allLogs, usedGas, nil
+}
+
+// processChain is the chain access needed to process a block: headers for the
+// BLOCKHASH opcode and the consensus engine's finalization.
+type processChain interface {
+	ChainContext
+	consensus.ChainReader
+}
+
+func (p *StateProcessor) process(block *types.Block, statedb *state.StateDB, chain processChain, cfg vm.Config) (types.Receipts, []*types.Log, uint64, error) {
 	txs := block.Transactions()
 	header := block.Header()
 
@@ -64,7 +96,7 @@ func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB, cfg
 	)
 
 	// Create a new emv context and environment.
-	evmContext := NewEVMContextLite(header, p.bc, nil)
+	evmContext := NewEVMContextLite(header, chain, nil)
 	vmenv := vm.NewEVM(evmContext, statedb, p.config, cfg)
 	signer := types.MakeSigner(p.config, header.Number)
 
@@ -81,7 +113,7 @@ func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB, cfg
 		allLogs = append(allLogs, receipt.Logs...)
 	}
 	// Finalize the block, applying any consensus engine specific extras (e.g. block rewards)
-	_ = p.engine.Finalize(p.bc, header, statedb, block.Transactions(), receipts, false)
+	_ = p.engine.Finalize(chain, header, statedb, block.Transactions(), receipts, false)
 	log.Debug("Processed Block", "number", header.Number, "hash", header.Hash(), "count", len(txs), "diff", header.Difficulty, "coinbase", header.Coinbase, "parent", header.ParentHash)
 
 	return receipts, allLogs, *usedGas, nil
@@ -352,21 +352,29 @@ func (l *txList) Overlaps(tx *types.Transaction) bool {
 // thresholds are also potentially updated.
 func (l *txList) Add(tx *types.Transaction, priceBump uint64) (bool, *types.Transaction) {
 	// If there's an older better transaction, abort
-	old := l.txs.Get(tx.Nonce())
-	if old != nil {
-		threshold := new(big.Int).Div(new(big.Int).Mul(old.GasPrice(), big.NewInt(100+int64(priceBump))), big.NewInt(100))
-		// Have to ensure that the new gas price is higher than the old gas
-		// price as well as checking the percentage threshold to ensure that
-		// this is accurate for low (Wei-level) gas price replacements
-		if old.CmpGasPriceTx(tx) >= 0 || tx.CmpGasPrice(threshold) < 0 {
-			return false, nil
-		}
+	if !l.Accepts(tx, priceBump) {
+		return false, nil
 	}
 	// Otherwise overwrite the old transaction with the current one
+	old := l.txs.Get(tx.Nonce())
 	l.add(tx)
 	return true, old
 }
 
+// Accepts reports whether Add would insert the transaction, either because its
+// nonce is free or because it pays enough to replace the transaction holding it.
+func (l *txList) Accepts(tx *types.Transaction, priceBump uint64) bool {
+	old := l.txs.Get(tx.Nonce())
+	if old == nil {
+		return true
+	}
+	threshold := new(big.Int).Div(new(big.Int).Mul(old.GasPrice(), big.NewInt(100+int64(priceBump))), big.NewInt(100))
+	// Have to ensure that the new gas price is higher than the old gas
+	// price as well as checking the percentage threshold to ensure that
+	// this is accurate for low (Wei-level) gas price replacements
+	return old.CmpGasPriceTx(tx) < 0 && tx.CmpGasPrice(threshold) >= 0
+}
+
 func (l *txList) add(tx *types.Transaction) {
 	l.txs.Put(tx)
 	if cost := tx.Cost(); l.costcap.Cmp(cost) < 0 {
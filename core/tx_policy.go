@@ -0,0 +1,271 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/core/types"
+	"github.com/zeus-fyi/gochain/v4/log"
+	"github.com/zeus-fyi/gochain/v4/metrics"
+)
+
+var (
+	// ErrDenied is returned if the sender or the recipient of a transaction is
+	// on the pool's deny list.
+	ErrDenied = errors.New("address denied")
+
+	// ErrSenderRateLimited is returned if the sender of a transaction exceeded
+	// its admission rate.
+	ErrSenderRateLimited = errors.New("sender rate limited")
+
+	// ErrContractRateLimited is returned if the recipient contract of a
+	// transaction exceeded its admission rate.
+	ErrContractRateLimited = errors.New("contract rate limited")
+
+	// ErrRecipientUnderpriced is returned if a transaction's gas price is below
+	// the minimum configured for its recipient.
+	ErrRecipientUnderpriced = errors.New("transaction underpriced for recipient")
+)
+
+var (
+	// Admission policy rejection metrics, by policy name
+	policyDenyCounter     = metrics.NewRegisteredCounter("txpool/policy/deny", nil)
+	policySenderCounter   = metrics.NewRegisteredCounter("txpool/policy/sender", nil)
+	policyContractCounter = metrics.NewRegisteredCounter("txpool/policy/contract", nil)
+	policyPriceCounter    = metrics.NewRegisteredCounter("txpool/policy/price", nil)
+)
+
+// tokenBucket is a rate limiter holding up to burst tokens, refilled at a
+// constant rate per second.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take refills the bucket for the time elapsed since its last use and tries to
+// consume a single token from it.
+func (b *tokenBucket) take(now time.Time, rate float64, burst uint64) bool {
+	b.tokens += now.Sub(b.last).Seconds() * rate
+	if b.tokens > float64(burst) {
+		b.tokens = float64(burst)
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// available reports whether a token could be taken from the bucket at the given
+// time, without taking it.
+func (b *tokenBucket) available(now time.Time, rate float64, burst uint64) bool {
+	tokens := b.tokens + now.Sub(b.last).Seconds()*rate
+	if tokens > float64(burst) {
+		tokens = float64(burst)
+	}
+	return tokens >= 1
+}
+
+// full reports whether the bucket would be full at the given time, in which
+// case it carries no information and may be dropped.
+func (b *tokenBucket) full(now time.Time, rate float64, burst uint64) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*rate >= float64(burst)
+}
+
+// txPolicy enforces the pool's admission policies: a deny list, per-sender and
+// per-recipient-contract rate limits and per-recipient minimum gas prices.
+type txPolicy struct {
+	senderRate    float64
+	senderBurst   uint64
+	contractRate  float64
+	contractBurst uint64
+	minPrices     map[common.Address]*big.Int
+	denyFile      string
+
+	mu        sync.Mutex
+	deny      map[common.Address]struct{}
+	senders   map[common.Address]*tokenBucket
+	contracts map[common.Address]*tokenBucket
+}
+
+// newTxPolicy creates the admission policies from the pool configuration,
+// loading the deny list if one is configured.
+func newTxPolicy(config *TxPoolConfig) *txPolicy {
+	p := &txPolicy{
+		senderRate:    config.SenderRate,
+		senderBurst:   config.SenderBurst,
+		contractRate:  config.ContractRate,
+		contractBurst: config.ContractBurst,
+		minPrices:     make(map[common.Address]*big.Int),
+		denyFile:      config.DenyList,
+		deny:          make(map[common.Address]struct{}),
+		senders:       make(map[common.Address]*tokenBucket),
+		contracts:     make(map[common.Address]*tokenBucket),
+	}
+	for addr, price := range config.RecipientPriceLimits {
+		p.minPrices[addr] = new(big.Int).SetUint64(price)
+	}
+	if p.denyFile != "" {
+		if _, err := p.reload(); err != nil {
+			log.Warn("Failed to load transaction deny list", "file", p.denyFile, "err", err)
+		}
+	}
+	return p
+}
+
+// reload replaces the deny list with the contents of the configured file,
+// returning the number of denied addresses.
+func (p *txPolicy) reload() (int, error) {
+	if p.denyFile == "" {
+		return 0, errors.New("no deny list configured")
+	}
+	deny, err := loadDenyList(p.denyFile)
+	if err != nil {
+		return 0, err
+	}
+	p.mu.Lock()
+	p.deny = deny
+	p.mu.Unlock()
+
+	log.Info("Loaded transaction deny list", "file", p.denyFile, "addresses", len(deny))
+	return len(deny), nil
+}
+
+// loadDenyList parses a file holding one hex address per line. Blank lines and
+// anything following a '#' are ignored.
+func loadDenyList(file string) (map[common.Address]struct{}, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	deny := make(map[common.Address]struct{})
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+		if text = strings.TrimSpace(text); text == "" {
+			continue
+		}
+		if !common.IsHexAddress(text) {
+			return nil, fmt.Errorf("line %d: invalid address %q", line, text)
+		}
+		deny[common.HexToAddress(text)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return deny, nil
+}
+
+// check applies the admission policies to a transaction from the given sender.
+// Local transactions are only subject to the deny list. The contract flag
+// reports whether the recipient is a contract. When dry is set, the rate limits
+// are checked without consuming any tokens and no rejections are counted.
+func (p *txPolicy) check(tx *types.Transaction, from common.Address, contract, local, dry bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	reject := func(counter metrics.Counter, err error) error {
+		if !dry {
+			counter.Inc(1)
+		}
+		return err
+	}
+	to := tx.To()
+	if _, ok := p.deny[from]; ok {
+		return reject(policyDenyCounter, ErrDenied)
+	}
+	if to != nil {
+		if _, ok := p.deny[*to]; ok {
+			return reject(policyDenyCounter, ErrDenied)
+		}
+	}
+	if local {
+		return nil
+	}
+	if to != nil {
+		if min := p.minPrices[*to]; min != nil && tx.CmpGasPrice(min) < 0 {
+			return reject(policyPriceCounter, ErrRecipientUnderpriced)
+		}
+	}
+	now := time.Now()
+	var sender, recipient *tokenBucket
+	if p.senderRate > 0 {
+		if sender = p.bucket(p.senders, from, now, p.senderBurst); !sender.available(now, p.senderRate, p.senderBurst) {
+			return reject(policySenderCounter, ErrSenderRateLimited)
+		}
+	}
+	if p.contractRate > 0 && contract {
+		if recipient = p.bucket(p.contracts, *to, now, p.contractBurst); !recipient.available(now, p.contractRate, p.contractBurst) {
+			return reject(policyContractCounter, ErrContractRateLimited)
+		}
+	}
+	if dry {
+		return nil
+	}
+	// Only consume the tokens once all policies passed
+	if sender != nil {
+		sender.take(now, p.senderRate, p.senderBurst)
+	}
+	if recipient != nil {
+		recipient.take(now, p.contractRate, p.contractBurst)
+	}
+	return nil
+}
+
+// bucket returns the token bucket of addr, creating a full one if needed.
+// The caller must hold p.mu.
+func (p *txPolicy) bucket(buckets map[common.Address]*tokenBucket, addr common.Address, now time.Time, burst uint64) *tokenBucket {
+	b := buckets[addr]
+	if b == nil {
+		b = &tokenBucket{tokens: float64(burst), last: now}
+		buckets[addr] = b
+	}
+	return b
+}
+
+// prune drops the token buckets which have refilled completely.
+func (p *txPolicy) prune() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	for addr, b := range p.senders {
+		if b.full(now, p.senderRate, p.senderBurst) {
+			delete(p.senders, addr)
+		}
+	}
+	for addr, b := range p.contracts {
+		if b.full(now, p.contractRate, p.contractBurst) {
+			delete(p.contracts, addr)
+		}
+	}
+}
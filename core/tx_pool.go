@@ -79,8 +79,17 @@ var (
 	// than some meaningful limit a user might use. This is not a consensus error
 	// making the transaction invalid, rather a DOS protection.
 	ErrOversizedData = errors.New("oversized data")
+
+	// ErrPrivateTxExpired is returned if a private transaction is submitted with
+	// a maximum inclusion block which has already been reached.
+	ErrPrivateTxExpired = errors.New("private transaction max block already reached")
 )
 
+// privateRetention is the number of blocks private transactions stay marked as
+// such after leaving the pool, so that reorgs undoing their inclusion reinject
+// them as private.
+const privateRetention = 64
+
 var (
 	evictionInterval    = time.Minute      // Time interval to check for evictable transactions
 	statsReportInterval = 10 * time.Second // Time interval to report transaction pool stats
@@ -102,14 +111,15 @@ var (
 	queuedNofundsCounter   = metrics.NewRegisteredCounter("txpool/queued/nofunds", nil)   // Dropped due to out-of-funds
 
 	// General tx metrics
-	invalidTxCounter     = metrics.NewRegisteredCounter("txpool/invalid", nil)
-	underpricedTxCounter = metrics.NewRegisteredCounter("txpool/underpriced", nil)
-	globalSlotsGauge     = metrics.NewRegisteredGauge("txpool/slots", nil)
-	globalQueueGauge     = metrics.NewRegisteredGauge("txpool/queue", nil)
-	poolAddTimer         = metrics.NewRegisteredTimer("txpool/add", nil)
-	journalInsertTimer   = metrics.NewRegisteredTimer("txpool/journal/insert", nil)
-	chainHeadGauge       = metrics.NewRegisteredGauge("txpool/chain/head", nil)
-	chainHeadTxsGauge    = metrics.NewRegisteredGauge("txpool/chain/head/txs", nil)
+	invalidTxCounter      = metrics.NewRegisteredCounter("txpool/invalid", nil)
+	privateExpiredCounter = metrics.NewRegisteredCounter("txpool/private/expired", nil)
+	underpricedTxCounter  = metrics.NewRegisteredCounter("txpool/underpriced", nil)
+	globalSlotsGauge      = metrics.NewRegisteredGauge("txpool/slots", nil)
+	globalQueueGauge      = metrics.NewRegisteredGauge("txpool/queue", nil)
+	poolAddTimer          = metrics.NewRegisteredTimer("txpool/add", nil)
+	journalInsertTimer    = metrics.NewRegisteredTimer("txpool/journal/insert", nil)
+	chainHeadGauge        = metrics.NewRegisteredGauge("txpool/chain/head", nil)
+	chainHeadTxsGauge     = metrics.NewRegisteredGauge("txpool/chain/head/txs", nil)
 )
 
 // TxStatus is the current status of a transaction as seen by the pool.
@@ -122,6 +132,25 @@ const (
 	TxStatusIncluded
 )
 
+// TxSimulation is the outcome of dry-running a transaction against the pool,
+// describing why (or whether) it would be accepted and where it would end up.
+type TxSimulation struct {
+	From       common.Address // Sender of the simulated transaction
+	Err        error          // Reason the pool would reject the transaction, nil if accepted
+	Known      bool           // Whether the exact transaction is already pooled
+	Executable bool           // Whether the transaction would be promoted to pending
+
+	PendingNonce uint64 // Next nonce the pool expects from the sender
+	NonceGap     uint64 // Number of missing nonces before the transaction becomes executable
+
+	Replaces     *types.Transaction // Pooled transaction with the same sender and nonce, if any
+	ReplacePrice *big.Int           // Minimum gas price required to replace it under PriceBump
+
+	Position  int    // Estimated position in the next block, -1 if not executable
+	GasAhead  uint64 // Gas used by pending transactions estimated to be ordered first
+	NextBlock bool   // Whether the transaction is estimated to fit into the next block
+}
+
 // blockChain provides the state of blockchain and current gas limit to do
 // some pre checks in tx pool and event subscribers.
 type blockChain interface {
@@ -149,6 +178,18 @@ type TxPoolConfig struct {
 	GlobalQueue  uint64 `toml:",omitempty"` // Maximum number of non-executable transaction slots for all accounts
 
 	Lifetime time.Duration `toml:",omitempty"` // Maximum amount of time non-executable transaction are queued
+
+	SenderRate           float64                   `toml:",omitempty"` // Remote transactions admitted per second per sender (0 = unlimited)
+	SenderBurst          uint64                    `toml:",omitempty"` // Remote transactions a sender may submit in a burst
+	ContractRate         float64                   `toml:",omitempty"` // Remote transactions admitted per second per recipient contract (0 = unlimited)
+	ContractBurst        uint64                    `toml:",omitempty"` // Remote transactions a recipient contract may receive in a burst
+	RecipientPriceLimits map[common.Address]uint64 `toml:",omitempty"` // Minimum gas price of remote transactions per recipient
+	DenyList             string                    `toml:",omitempty"` // File of addresses whose transactions are rejected
+
+	Snapshot         string        `toml:",omitempty"` // Snapshot of remote transactions to survive node restarts ("" = disabled)
+	SnapshotInterval time.Duration `toml:",omitempty"` // Time interval to regenerate the remote transaction snapshot
+	SnapshotLimit    uint64        `toml:",omitempty"` // Maximum number of remote transactions to snapshot
+	SnapshotMaxAge   time.Duration `toml:",omitempty"` // Maximum age of snapshotted remote transactions to reinject
 }
 
 // DefaultTxPoolConfig contains the default configurations for the transaction
@@ -166,6 +207,10 @@ var DefaultTxPoolConfig = TxPoolConfig{
 	GlobalQueue:  32768,
 
 	Lifetime: 3 * time.Hour,
+
+	SnapshotInterval: 10 * time.Minute,
+	SnapshotLimit:    32768,
+	SnapshotMaxAge:   time.Hour,
 }
 
 // sanitize checks the provided user configurations and changes anything that's
@@ -200,6 +245,26 @@ func (config *TxPoolConfig) sanitize() TxPoolConfig {
 		log.Warn("Sanitizing invalid txpool lifetime", "provided", conf.Lifetime, "updated", DefaultTxPoolConfig.Lifetime)
 		conf.Lifetime = DefaultTxPoolConfig.Lifetime
 	}
+	if conf.SnapshotInterval < time.Second {
+		log.Warn("Sanitizing invalid txpool snapshot interval", "provided", conf.SnapshotInterval, "updated", DefaultTxPoolConfig.SnapshotInterval)
+		conf.SnapshotInterval = DefaultTxPoolConfig.SnapshotInterval
+	}
+	if conf.SnapshotLimit <= 0 {
+		log.Warn("Sanitizing invalid txpool snapshot limit", "provided", conf.SnapshotLimit, "updated", DefaultTxPoolConfig.SnapshotLimit)
+		conf.SnapshotLimit = DefaultTxPoolConfig.SnapshotLimit
+	}
+	if conf.SnapshotMaxAge <= 0 {
+		log.Warn("Sanitizing invalid txpool snapshot max age", "provided", conf.SnapshotMaxAge, "updated", DefaultTxPoolConfig.SnapshotMaxAge)
+		conf.SnapshotMaxAge = DefaultTxPoolConfig.SnapshotMaxAge
+	}
+	if conf.SenderRate > 0 && conf.SenderBurst < 1 {
+		log.Warn("Sanitizing invalid txpool sender burst", "provided", conf.SenderBurst, "updated", 1)
+		conf.SenderBurst = 1
+	}
+	if conf.ContractRate > 0 && conf.ContractBurst < 1 {
+		log.Warn("Sanitizing invalid txpool contract burst", "provided", conf.ContractBurst, "updated", 1)
+		conf.ContractBurst = 1
+	}
 	return conf
 }
 
@@ -231,8 +296,11 @@ type TxPool struct {
 	pendingState  *state.ManagedState // Pending state tracking virtual nonces
 	currentMaxGas uint64              // Current gas limit for transaction caps
 
-	locals  *accountSet // Set of local transaction to exempt from eviction rules
-	journal *txJournal  // Journal of local transaction to back up to disk
+	locals   *accountSet // Set of local transaction to exempt from eviction rules
+	journal  *txJournal  // Journal of local transaction to back up to disk
+	snapshot *txSnapshot // Snapshot of remote transactions to back up to disk
+	private  *privateTxs // Set of local transactions which must not be propagated
+	policy   *txPolicy   // Admission policies applied to incoming transactions
 
 	pending map[common.Address]*txList   // All currently processable transactions
 	queue   map[common.Address]*txList   // Queued but non-processable transactions
@@ -262,11 +330,13 @@ func NewTxPool(config TxPoolConfig, chainconfig *params.ChainConfig, chain block
 		queue:       make(map[common.Address]*txList),
 		beats:       make(map[common.Address]time.Time),
 		all:         newTxLookup(int(config.GlobalSlots / 2)),
+		private:     newPrivateTxs(),
 		chainHeadCh: make(chan ChainHeadEvent, chainHeadChanSize),
 		gasPrice:    new(big.Int).SetUint64(config.PriceLimit),
 		txFeedBuf:   make(chan *types.Transaction, config.GlobalSlots/4),
 	}
 	pool.locals = newAccountSet(pool.signer)
+	pool.policy = newTxPolicy(&config)
 	pool.reset(nil, chain.CurrentBlock())
 
 	// If local transactions and journaling is enabled, load from disk
@@ -274,7 +344,7 @@ func NewTxPool(config TxPoolConfig, chainconfig *params.ChainConfig, chain block
 		pool.journal = newTxJournal(config.Journal)
 		if err := pool.journal.load(func(txs types.Transactions) []error {
 			// No need to lock since we're still setting up.
-			return pool.addTxsLocked(txs, !pool.config.NoLocals)
+			return pool.addTxsLocked(txs, !pool.config.NoLocals, false)
 		}); err != nil {
 			log.Warn("Failed to load transaction journal", "err", err)
 		}
@@ -282,6 +352,13 @@ func NewTxPool(config TxPoolConfig, chainconfig *params.ChainConfig, chain block
 			log.Warn("Failed to rotate transaction journal", "err", err)
 		}
 	}
+	// If remote transaction snapshotting is enabled, reinject the last snapshot
+	if config.Snapshot != "" {
+		pool.snapshot = newTxSnapshot(config.Snapshot, int(config.SnapshotLimit), config.SnapshotMaxAge)
+		if err := pool.snapshot.load(pool.addSnapshotted); err != nil {
+			log.Warn("Failed to load remote transaction snapshot", "err", err)
+		}
+	}
 
 	// Subscribe events from blockchain.
 	pool.chain.SubscribeChainHeadEvent(pool.chainHeadCh, "core.TxPool")
@@ -312,6 +389,13 @@ func (pool *TxPool) loop() {
 	journal := time.NewTicker(pool.config.Rejournal)
 	defer journal.Stop()
 
+	var snapshot <-chan time.Time
+	if pool.snapshot != nil {
+		ticker := time.NewTicker(pool.config.SnapshotInterval)
+		defer ticker.Stop()
+		snapshot = ticker.C
+	}
+
 	globalSlotsGauge.Update(int64(pool.config.GlobalSlots))
 	globalQueueGauge.Update(int64(pool.config.GlobalQueue))
 
@@ -371,6 +455,7 @@ func (pool *TxPool) loop() {
 				}
 			}
 			pool.mu.Unlock()
+			pool.policy.prune()
 		// Handle local transaction journal rotation
 		case <-journal.C:
 			if pool.journal != nil {
@@ -380,6 +465,9 @@ func (pool *TxPool) loop() {
 				}
 				pool.mu.Unlock()
 			}
+		// Handle remote transaction snapshot regeneration
+		case <-snapshot:
+			pool.writeSnapshot()
 		}
 	}
 }
@@ -565,6 +653,9 @@ func (pool *TxPool) reset(oldBlock, newBlock *types.Block) {
 	// higher gas price)
 	pool.demoteUnexecutables()
 
+	// Drop any private transactions which weren't included in time
+	pool.dropPrivate(pool.currentNum.Uint64())
+
 	// Update all accounts to the latest known pending nonce
 	for addr, list := range pool.pending {
 		pool.pendingState.SetNonce(addr, list.Last().Nonce()+1)
@@ -587,6 +678,9 @@ func (pool *TxPool) Stop() {
 	pool.chain.UnsubscribeChainHeadEvent(pool.chainHeadCh)
 	pool.wg.Wait()
 
+	if pool.snapshot != nil {
+		pool.writeSnapshot()
+	}
 	if pool.journal != nil {
 		if err := pool.journal.close(); err != nil {
 			log.Error("Cannot close tx pool journal", "err", err)
@@ -618,11 +712,15 @@ func (pool *TxPool) SetGasPrice(price *big.Int) {
 		pool.config.PriceLimit = price.Uint64()
 		pool.gasPrice = price
 	}
+	var drop []*types.Transaction
 	pool.all.ForEach(func(tx *types.Transaction) {
 		if tx.CmpGasPrice(pool.gasPrice) < 0 && !pool.locals.containsTx(tx) {
-			pool.removeTx(tx)
+			drop = append(drop, tx)
 		}
 	})
+	for _, tx := range drop {
+		pool.removeTx(tx)
+	}
 	log.Info("Transaction pool price threshold updated", "price", pool.gasPrice)
 }
 
@@ -674,6 +772,22 @@ func (pool *TxPool) Content() (map[common.Address]types.Transactions, map[common
 	return pending, queued
 }
 
+// ContentFrom retrieves the data content of the transaction pool for a single
+// account, returning its pending as well as queued transactions sorted by nonce.
+func (pool *TxPool) ContentFrom(addr common.Address) (types.Transactions, types.Transactions) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	var pending, queued types.Transactions
+	if list, ok := pool.pending[addr]; ok {
+		pending = list.Flatten()
+	}
+	if list, ok := pool.queue[addr]; ok {
+		queued = list.Flatten()
+	}
+	return pending, queued
+}
+
 // Pending retrieves all currently processable transactions, groupped by origin
 // account and sorted by nonce. The returned transaction set is a copy and can be
 // freely modified by calling code.
@@ -730,9 +844,66 @@ func (pool *TxPool) local() (int, types.Transactions) {
 			acts++
 		}
 	}
+	// Private transactions are never persisted, lest they leak after a restart
+	if pool.private.len() > 0 {
+		public := txs[:0:0]
+		for _, tx := range txs {
+			if !pool.private.contains(tx.Hash()) {
+				public = append(public, tx)
+			}
+		}
+		txs = public
+	}
 	return acts, txs
 }
 
+// remote retrieves all currently known remote transactions, pending ones of all
+// accounts first, followed by the queued ones. The caller must hold pool.mu.
+func (pool *TxPool) remote() types.Transactions {
+	var txs types.Transactions
+	for _, lists := range []map[common.Address]*txList{pool.pending, pool.queue} {
+		for addr, list := range lists {
+			if pool.locals.contains(addr) {
+				continue
+			}
+			list.txs.ensureCache()
+			txs = append(txs, list.txs.cache...)
+		}
+	}
+	return txs
+}
+
+// writeSnapshot regenerates the remote transaction snapshot from the current
+// contents of the pool.
+func (pool *TxPool) writeSnapshot() {
+	pool.mu.RLock()
+	txs := pool.remote()
+	pool.mu.RUnlock()
+
+	if err := pool.snapshot.write(txs, func(tx *types.Transaction) time.Time {
+		return pool.all.Arrival(tx.Hash())
+	}); err != nil {
+		log.Warn("Failed to write remote transaction snapshot", "err", err)
+	}
+}
+
+// addSnapshotted reinjects snapshotted remote transactions like any other remote
+// ones, re-validating them against the current head and the admission policies,
+// and restores the original arrival times of the ones newly added.
+func (pool *TxPool) addSnapshotted(txs types.Transactions, arrived []time.Time) []error {
+	known := make([]bool, len(txs))
+	for i, tx := range txs {
+		known[i] = pool.all.Get(tx.Hash()) != nil
+	}
+	errs := pool.AddRemotes(txs)
+	for i, tx := range txs {
+		if !known[i] {
+			pool.all.SetArrival(tx.Hash(), arrived[i])
+		}
+	}
+	return errs
+}
+
 // preValidateTx does preliminary transaction validation (a subset of validateTx), without requiring pool.mu to be held.
 func (pool *TxPool) preValidateTx(tx *types.Transaction, local bool) error {
 	// Heuristic limit, reject transactions over 32KB to prevent DOS attacks
@@ -798,45 +969,104 @@ func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
 	return nil
 }
 
-// add validates a transaction and inserts it into the non-executable queue for
-// later pending promotion and execution. If the transaction is a replacement for
-// an already pending or queued one, it overwrites the previous and returns this
-// so outer code doesn't uselessly call promote.
-//
-// If a newly added transaction is marked as local, its sending account will be
-// whitelisted, preventing any associated transaction from being dropped out of
-// the pool due to pricing constraints.
-func (pool *TxPool) add(tx *types.Transaction, local bool) (bool, error) {
-	t := time.Now()
+// checkPolicy applies the admission policies to an already validated transaction.
+// When dry is set no rate limit tokens are consumed. The caller must hold pool.mu.
+func (pool *TxPool) checkPolicy(tx *types.Transaction, local, dry bool) error {
+	from, _ := types.Sender(pool.signer, tx) // already validated
+	local = local || pool.locals.contains(from)
+
+	contract := false
+	if to := tx.To(); to != nil && pool.policy.contractRate > 0 && !local {
+		contract = pool.currentState.GetCodeSize(*to) > 0
+	}
+	return pool.policy.check(tx, from, contract, local, dry)
+}
+
+// ReloadDenyList reloads the deny list from its configured file, returning the
+// number of denied addresses.
+func (pool *TxPool) ReloadDenyList() (int, error) {
+	return pool.policy.reload()
+}
+
+// checkAdd runs the checks add applies before inserting a transaction, in the
+// same order, returning the reason the transaction is rejected. The admission
+// policies are left to the caller. When dry is set the metrics are not touched,
+// so Simulate gets the exact reason a submission would. The caller must hold
+// pool.mu.
+func (pool *TxPool) checkAdd(tx *types.Transaction, local, dry bool) error {
 	// If the transaction is already known, discard it.
 	hash := tx.Hash()
 	if pool.all.Get(hash) != nil {
-		if log.Tracing() {
+		if log.Tracing() && !dry {
 			log.Trace("Discarding already known transaction", "hash", hash)
 		}
-		return false, fmt.Errorf("known transaction: %x", hash)
+		return fmt.Errorf("known transaction: %x", hash)
 	}
 	// If the transaction fails basic validation, discard it.
 	if err := pool.validateTx(tx, local); err != nil {
-		if log.Tracing() {
-			log.Trace("Discarding invalid transaction", "hash", hash, "err", err)
+		if !dry {
+			if log.Tracing() {
+				log.Trace("Discarding invalid transaction", "hash", hash, "err", err)
+			}
+			invalidTxCounter.Inc(1)
 		}
-		invalidTxCounter.Inc(1)
-		return false, err
+		return err
 	}
 	// If the transaction pool is full, reject.
 	if uint64(pool.all.Count()) >= pool.config.GlobalSlots+pool.config.GlobalQueue {
-		return false, ErrPoolLimit
+		return ErrPoolLimit
 	}
-	// If the transaction is replacing an already pending one, do directly
+	// If the transaction replaces a pooled one, the required price bump must be met
 	from, _ := types.Sender(pool.signer, tx) // already validated
 	if pending := pool.pending[from]; pending != nil && pending.Overlaps(tx) {
-		// Nonce already pending, check if required price bump is met
-		inserted, old := pending.Add(tx, pool.config.PriceBump)
-		if !inserted {
-			pendingDiscardCounter.Inc(1)
-			return false, ErrReplaceUnderpriced
+		if !pending.Accepts(tx, pool.config.PriceBump) {
+			if !dry {
+				pendingDiscardCounter.Inc(1)
+			}
+			return ErrReplaceUnderpriced
+		}
+	} else if queued := pool.queue[from]; queued != nil && !queued.Accepts(tx, pool.config.PriceBump) {
+		if !dry {
+			queuedDiscardCounter.Inc(1)
+		}
+		return ErrReplaceUnderpriced
+	}
+	return nil
+}
+
+// add validates a transaction and inserts it into the non-executable queue for
+// later pending promotion and execution. If the transaction is a replacement for
+// an already pending or queued one, it overwrites the previous and returns this
+// so outer code doesn't uselessly call promote.
+//
+// If a newly added transaction is marked as local, its sending account will be
+// whitelisted, preventing any associated transaction from being dropped out of
+// the pool due to pricing constraints.
+//
+// External transactions, submitted to the pool rather than reinjected by it
+// after a reorg, are subject to the admission policies once all the
+// other checks passed, so rejected transactions consume no rate limit tokens.
+func (pool *TxPool) add(tx *types.Transaction, local, external bool) (bool, error) {
+	t := time.Now()
+	hash := tx.Hash()
+	if err := pool.checkAdd(tx, local, false); err != nil {
+		return false, err
+	}
+	// If the transaction violates an admission policy, discard it.
+	if external {
+		if err := pool.checkPolicy(tx, local, false); err != nil {
+			if log.Tracing() {
+				log.Trace("Discarding transaction rejected by policy", "hash", hash, "err", err)
+			}
+			return false, err
 		}
+	}
+	// If the transaction is replacing an already pending one, do directly
+	from, _ := types.Sender(pool.signer, tx) // already validated
+	if pending := pool.pending[from]; pending != nil && pending.Overlaps(tx) {
+		// Nonce already pending, the required price bump was checked
+		_, old := pending.Add(tx, pool.config.PriceBump)
+
 		// New transaction is better, replace old one
 		if old != nil {
 			pool.all.Remove(old.Hash())
@@ -901,8 +1131,8 @@ func (pool *TxPool) enqueueTx(tx *types.Transaction) (bool, error) {
 // journalTx adds the specified transaction to the local disk journal if it is
 // deemed to have been sent from a local account.
 func (pool *TxPool) journalTx(from common.Address, tx *types.Transaction) {
-	// Only journal if it's enabled and the transaction is local
-	if pool.journal == nil || !pool.locals.contains(from) {
+	// Only journal if it's enabled and the transaction is local and public
+	if pool.journal == nil || !pool.locals.contains(from) || pool.private.contains(tx.Hash()) {
 		return
 	}
 
@@ -955,6 +1185,105 @@ func (pool *TxPool) AddLocal(tx *types.Transaction) error {
 	return pool.addTx(tx, !pool.config.NoLocals)
 }
 
+// AddPrivate enqueues a single transaction into the pool as a local one, but
+// marks it private so that it's neither journaled nor meant to be propagated to
+// the network. If the transaction is still not included once the chain passes
+// maxBlock it's dropped from the pool; a zero maxBlock keeps it indefinitely.
+func (pool *TxPool) AddPrivate(tx *types.Transaction, maxBlock uint64) error {
+	return pool.addPrivate(tx, maxBlock, !pool.config.NoLocals)
+}
+
+// AddPrivateRemote enqueues a single private transaction forwarded by a remote
+// peer. Like AddPrivate, it is never propagated to the network, but the full
+// pricing constraints apply to it as to any remote transaction.
+func (pool *TxPool) AddPrivateRemote(tx *types.Transaction, maxBlock uint64) error {
+	return pool.addPrivate(tx, maxBlock, false)
+}
+
+// addPrivate enqueues a single transaction into the pool, marked private until
+// maxBlock.
+func (pool *TxPool) addPrivate(tx *types.Transaction, maxBlock uint64, local bool) error {
+	hash := tx.Hash()
+	// Check if the transaction is already known, before locking the whole pool.
+	if pool.all.Get(hash) != nil {
+		return fmt.Errorf("known tx: %x", hash)
+	}
+	// If the transaction fails basic validation, discard it.
+	if err := pool.preValidateTx(tx, local); err != nil {
+		if log.Tracing() {
+			log.Trace("Discarding invalid private transaction", "hash", hash, "err", err)
+		}
+		invalidTxCounter.Inc(1)
+		return err
+	}
+
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	if maxBlock != 0 && pool.currentNum.Uint64() >= maxBlock {
+		return ErrPrivateTxExpired
+	}
+	// Mark the transaction private before insertion so it's never journaled
+	pool.private.add(hash, maxBlock)
+
+	replace, err := pool.add(tx, local, true)
+	if err != nil {
+		pool.private.remove(hash)
+		return err
+	}
+	if !replace {
+		from, _ := types.Sender(pool.signer, tx) // already validated
+		pool.promoteExecutables(from)
+	}
+	return nil
+}
+
+// IsPrivate reports whether the transaction with the given hash was submitted
+// privately and must not be propagated to the network.
+func (pool *TxPool) IsPrivate(hash common.Hash) bool {
+	return pool.private.contains(hash)
+}
+
+// PrivateMaxBlock returns the block after which the private transaction with
+// the given hash is dropped if still not included, and whether it's private.
+func (pool *TxPool) PrivateMaxBlock(hash common.Hash) (uint64, bool) {
+	return pool.private.maxBlock(hash)
+}
+
+// dropPrivate forgets private transactions which left the pool long enough ago
+// for a reorg not to bring them back, and removes the ones which were not
+// included before their maximum block. Transactions which left the pool more
+// recently, included in a block typically, stay marked private, so that they
+// are reinjected as such if the block is reorged out.
+//
+// The caller must hold pool.mu.
+func (pool *TxPool) dropPrivate(number uint64) {
+	var expired []*types.Transaction
+	for hash, maxBlock := range pool.private.all() {
+		tx := pool.all.Get(hash)
+		if tx == nil {
+			if left := pool.private.leave(hash, number); number >= left+privateRetention {
+				pool.private.remove(hash)
+			}
+			continue
+		}
+		pool.private.stay(hash)
+		if maxBlock != 0 && number >= maxBlock {
+			expired = append(expired, tx)
+		}
+	}
+	if len(expired) == 0 {
+		return
+	}
+	for _, tx := range expired {
+		pool.removeTx(tx)
+		pool.private.remove(tx.Hash())
+	}
+
+	privateExpiredCounter.Inc(int64(len(expired)))
+	log.Debug("Dropped expired private transactions", "count", len(expired), "number", number)
+}
+
 // AddRemote enqueues a single transaction into the pool if it is valid. If the
 // sender is not among the locally tracked ones, full pricing constraints will
 // apply.
@@ -966,14 +1295,14 @@ func (pool *TxPool) AddRemote(tx *types.Transaction) error {
 // marking the senders as a local ones in the mean time, ensuring they go around
 // the local pricing constraints.
 func (pool *TxPool) AddLocals(txs []*types.Transaction) []error {
-	return pool.addTxs(txs, !pool.config.NoLocals)
+	return pool.addTxs(txs, !pool.config.NoLocals, true)
 }
 
 // AddRemotes enqueues a batch of transactions into the pool if they are valid.
 // If the senders are not among the locally tracked ones, full pricing constraints
 // will apply.
 func (pool *TxPool) AddRemotes(txs []*types.Transaction) []error {
-	return pool.addTxs(txs, false)
+	return pool.addTxs(txs, false, true)
 }
 
 // addTx enqueues a single transaction into the pool if it is valid.
@@ -995,7 +1324,7 @@ func (pool *TxPool) addTx(tx *types.Transaction, local bool) error {
 	defer pool.mu.Unlock()
 
 	// Try to inject the transaction and update any state
-	replace, err := pool.add(tx, local)
+	replace, err := pool.add(tx, local, true)
 	if err != nil {
 		return err
 	}
@@ -1008,7 +1337,7 @@ func (pool *TxPool) addTx(tx *types.Transaction, local bool) error {
 }
 
 // addTxs attempts to queue a batch of transactions if they are valid.
-func (pool *TxPool) addTxs(txs []*types.Transaction, local bool) []error {
+func (pool *TxPool) addTxs(txs []*types.Transaction, local, external bool) []error {
 	var add []*types.Transaction
 	// Filter out known, and pre-compute/cache signer before locking.
 	for _, tx := range txs {
@@ -1033,18 +1362,18 @@ func (pool *TxPool) addTxs(txs []*types.Transaction, local bool) []error {
 	pool.mu.Lock()
 	defer pool.mu.Unlock()
 
-	return pool.addTxsLocked(add, local)
+	return pool.addTxsLocked(add, local, external)
 }
 
 // addTxsLocked attempts to queue a batch of transactions if they are valid,
 // whilst assuming the transaction pool lock is already held.
-func (pool *TxPool) addTxsLocked(txs []*types.Transaction, local bool) []error {
+func (pool *TxPool) addTxsLocked(txs []*types.Transaction, local, external bool) []error {
 	// Add the batch of transaction, tracking the accepted ones
 	dirty := make(map[common.Address]struct{})
 	var errs []error
 
 	for _, tx := range txs {
-		replace, err := pool.add(tx, local)
+		replace, err := pool.add(tx, local, external)
 		if err != nil {
 			errs = append(errs, err)
 			continue
@@ -1072,7 +1401,7 @@ func (pool *TxPool) reinject(txs map[common.Hash]*types.Transaction) []error {
 	var errs []error
 
 	for _, tx := range txs {
-		replace, err := pool.add(tx, false)
+		replace, err := pool.add(tx, false, false)
 		if err != nil {
 			errs = append(errs, err)
 			continue
@@ -1113,6 +1442,80 @@ func (pool *TxPool) Status(hashes []common.Hash) []TxStatus {
 	return status
 }
 
+// Simulate runs the pool's admission checks against tx without inserting it,
+// reporting the rejection reason, nonce gap, replacement price and estimated
+// position in the next block.
+func (pool *TxPool) Simulate(tx *types.Transaction) *TxSimulation {
+	sim := &TxSimulation{Position: -1}
+	if err := pool.preValidateTx(tx, false); err != nil {
+		sim.Err = err
+		return sim
+	}
+	from, _ := types.Sender(pool.signer, tx) // already validated
+	sim.From = from
+
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	sim.Known = pool.all.Get(tx.Hash()) != nil
+	sim.PendingNonce = pool.pendingState.GetNonce(from)
+
+	// Look up any transaction this one would replace, and the price needed to do so
+	for _, list := range []*txList{pool.pending[from], pool.queue[from]} {
+		if list == nil {
+			continue
+		}
+		if old := list.txs.Get(tx.Nonce()); old != nil {
+			sim.Replaces = old
+			sim.ReplacePrice = new(big.Int).Div(new(big.Int).Mul(old.GasPrice(), big.NewInt(100+int64(pool.config.PriceBump))), big.NewInt(100))
+			break
+		}
+	}
+	// Count the nonces missing between the pending nonce and this transaction
+	if tx.Nonce() > sim.PendingNonce {
+		sim.NonceGap = tx.Nonce() - sim.PendingNonce
+		if queued := pool.queue[from]; queued != nil {
+			for nonce := range queued.txs.items {
+				if nonce >= sim.PendingNonce && nonce < tx.Nonce() {
+					sim.NonceGap--
+				}
+			}
+		}
+	}
+	if sim.Err = pool.checkAdd(tx, false, true); sim.Err == nil {
+		sim.Err = pool.checkPolicy(tx, false, true)
+	}
+	if sim.Err != nil && !sim.Known {
+		return sim
+	}
+	// Estimate the block position by the pending transactions the miner would
+	// pick first: pricier ones from other accounts and lower nonces from ours.
+	sim.Executable = sim.NonceGap == 0
+	if !sim.Executable {
+		return sim
+	}
+	var ahead int
+	for addr, list := range pool.pending {
+		for _, ptx := range list.txs.items {
+			if ptx.Hash() == tx.Hash() {
+				continue
+			}
+			if addr == from {
+				if ptx.Nonce() >= tx.Nonce() {
+					continue
+				}
+			} else if ptx.CmpGasPriceTx(tx) < 0 {
+				continue
+			}
+			ahead++
+			sim.GasAhead += ptx.Gas()
+		}
+	}
+	sim.Position = ahead
+	sim.NextBlock = sim.GasAhead+tx.Gas() <= pool.currentMaxGas
+	return sim
+}
+
 // Get returns a transaction if it is contained in the pool
 // and nil otherwise.
 func (pool *TxPool) Get(hash common.Hash) *types.Transaction {
@@ -1121,9 +1524,9 @@ func (pool *TxPool) Get(hash common.Hash) *types.Transaction {
 
 // removeTx removes a single transaction from pending or queue, moving all subsequent
 // transactions back to the future queue.
-// The caller must hold pool.mu and pool.all.mu.
+// The caller must hold pool.mu.
 func (pool *TxPool) removeTx(tx *types.Transaction) {
-	delete(pool.all.all, tx.Hash())
+	pool.all.Remove(tx.Hash())
 
 	addr, _ := types.Sender(pool.signer, tx) // already validated during insertion
 
@@ -1515,14 +1918,16 @@ func (as *accountSet) flatten() []common.Address {
 // peeking into the pool in TxPool.Get without having to acquire the widely scoped
 // TxPool.mu mutex.
 type txLookup struct {
-	all map[common.Hash]*types.Transaction
-	mu  sync.RWMutex
+	all     map[common.Hash]*types.Transaction
+	arrived map[common.Hash]time.Time // Time each transaction was first added
+	mu      sync.RWMutex
 }
 
 // newTxLookup returns a new txLookup structure.
 func newTxLookup(cap int) *txLookup {
 	return &txLookup{
-		all: make(map[common.Hash]*types.Transaction, cap),
+		all:     make(map[common.Hash]*types.Transaction, cap),
+		arrived: make(map[common.Hash]time.Time, cap),
 	}
 }
 
@@ -1552,10 +1957,32 @@ func (t *txLookup) Count() int {
 	return l
 }
 
+// Arrival returns the time a transaction was added to the lookup, or the zero
+// time if not found.
+func (t *txLookup) Arrival(hash common.Hash) time.Time {
+	t.mu.RLock()
+	arrived := t.arrived[hash]
+	t.mu.RUnlock()
+	return arrived
+}
+
+// SetArrival overrides the arrival time of a transaction in the lookup.
+func (t *txLookup) SetArrival(hash common.Hash, arrived time.Time) {
+	t.mu.Lock()
+	if _, ok := t.all[hash]; ok {
+		t.arrived[hash] = arrived
+	}
+	t.mu.Unlock()
+}
+
 // Add adds a transaction to the lookup.
 func (t *txLookup) Add(tx *types.Transaction) {
+	hash := tx.Hash()
 	t.mu.Lock()
-	t.all[tx.Hash()] = tx
+	t.all[hash] = tx
+	if _, ok := t.arrived[hash]; !ok {
+		t.arrived[hash] = time.Now()
+	}
 	t.mu.Unlock()
 }
 
@@ -1563,5 +1990,100 @@ func (t *txLookup) Add(tx *types.Transaction) {
 func (t *txLookup) Remove(hash common.Hash) {
 	t.mu.Lock()
 	delete(t.all, hash)
+	delete(t.arrived, hash)
 	t.mu.Unlock()
 }
+
+// privateTxs tracks the transactions submitted privately to the pool along with
+// the block after which they are dropped if still not included (0 for never),
+// and the head at which those no longer in the pool left it. Like txLookup, it
+// is protected by its own lock so that the protocol handler can filter
+// broadcasts without contending on TxPool.mu.
+type privateTxs struct {
+	txs  map[common.Hash]uint64
+	left map[common.Hash]uint64
+	mu   sync.RWMutex
+}
+
+// newPrivateTxs returns a new, empty privateTxs set.
+func newPrivateTxs() *privateTxs {
+	return &privateTxs{
+		txs:  make(map[common.Hash]uint64),
+		left: make(map[common.Hash]uint64),
+	}
+}
+
+// add marks a transaction as private, to be dropped after maxBlock.
+func (p *privateTxs) add(hash common.Hash, maxBlock uint64) {
+	p.mu.Lock()
+	p.txs[hash] = maxBlock
+	delete(p.left, hash)
+	p.mu.Unlock()
+}
+
+// remove forgets a private transaction.
+func (p *privateTxs) remove(hash common.Hash) {
+	p.mu.Lock()
+	delete(p.txs, hash)
+	delete(p.left, hash)
+	p.mu.Unlock()
+}
+
+// leave records that a private transaction left the pool at the given head,
+// unless it did so earlier, and returns the head it left the pool at.
+func (p *privateTxs) leave(hash common.Hash, number uint64) uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	left, ok := p.left[hash]
+	if !ok {
+		left = number
+		p.left[hash] = left
+	}
+	return left
+}
+
+// stay records that a private transaction is in the pool, reinjected after a
+// reorg possibly.
+func (p *privateTxs) stay(hash common.Hash) {
+	p.mu.Lock()
+	delete(p.left, hash)
+	p.mu.Unlock()
+}
+
+// contains checks whether a transaction is marked as private.
+func (p *privateTxs) contains(hash common.Hash) bool {
+	p.mu.RLock()
+	_, ok := p.txs[hash]
+	p.mu.RUnlock()
+	return ok
+}
+
+// maxBlock returns the max block of a private transaction, and whether it's
+// marked as private at all.
+func (p *privateTxs) maxBlock(hash common.Hash) (uint64, bool) {
+	p.mu.RLock()
+	maxBlock, ok := p.txs[hash]
+	p.mu.RUnlock()
+	return maxBlock, ok
+}
+
+// len returns the number of tracked private transactions.
+func (p *privateTxs) len() int {
+	p.mu.RLock()
+	l := len(p.txs)
+	p.mu.RUnlock()
+	return l
+}
+
+// all returns a copy of the tracked private transactions and their max blocks.
+func (p *privateTxs) all() map[common.Hash]uint64 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	txs := make(map[common.Hash]uint64, len(p.txs))
+	for hash, maxBlock := range p.txs {
+		txs[hash] = maxBlock
+	}
+	return txs
+}
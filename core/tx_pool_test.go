@@ -141,6 +141,13 @@ func validateTxPoolInternals(pool *TxPool) error {
 	if total := pool.all.Count(); total != pending+queued {
 		return fmt.Errorf("total transaction count %d != %d pending + %d queued", total, pending, queued)
 	}
+	// Ensure arrival times are tracked for exactly the pooled transactions
+	pool.all.mu.RLock()
+	arrived := len(pool.all.arrived)
+	pool.all.mu.RUnlock()
+	if total := pool.all.Count(); arrived != total {
+		return fmt.Errorf("arrival count %d != %d pooled transactions", arrived, total)
+	}
 	// Ensure the next nonce to assign is the correct one
 	for addr, txs := range pool.pending {
 		// Find the last transaction
@@ -484,19 +491,17 @@ func TestTransactionChainFork(t *testing.T) {
 
 	tx := transaction(0, 100000, key)
 	pool.mu.Lock()
-	if _, err := pool.add(tx, false); err != nil {
+	if _, err := pool.add(tx, false, true); err != nil {
 		t.Error("didn't expect error", err)
 	}
-	pool.all.mu.Lock()
 	pool.removeTx(tx)
-	pool.all.mu.Unlock()
 	pool.mu.Unlock()
 
 	pool.reset(nil, nil)
 
 	pool.mu.Lock()
 	defer pool.mu.Unlock()
-	if _, err := pool.add(tx, false); err != nil {
+	if _, err := pool.add(tx, false, true); err != nil {
 		t.Error("didn't expect error", err)
 	}
 }
@@ -521,10 +526,10 @@ func TestTransactionDoubleNonce(t *testing.T) {
 	tx3, _ := types.SignTx(types.NewTransaction(0, common.Address{}, big.NewInt(100), 1000000, big.NewInt(1), nil), signer, key)
 
 	// Add the first two transaction, ensure higher priced stays only
-	if replace, err := pool.add(tx1, false); err != nil || replace {
+	if replace, err := pool.add(tx1, false, true); err != nil || replace {
 		t.Errorf("first transaction insert failed (%v) or reported replacement (%v)", err, replace)
 	}
-	if replace, err := pool.add(tx2, false); err != nil || !replace {
+	if replace, err := pool.add(tx2, false, true); err != nil || !replace {
 		t.Errorf("second transaction insert failed (%v) or not reported replacement (%v)", err, replace)
 	}
 	pool.promoteExecutables(addr)
@@ -537,7 +542,7 @@ func TestTransactionDoubleNonce(t *testing.T) {
 	}
 
 	// Add the third transaction and ensure it's not saved (smaller price)
-	pool.add(tx3, false)
+	pool.add(tx3, false, true)
 	pool.promoteExecutables(addr)
 
 	if pool.pending[addr].Len() != 1 {
@@ -563,7 +568,7 @@ func TestTransactionMissingNonce(t *testing.T) {
 	defer pool.mu.Unlock()
 	pool.currentState.AddBalance(addr, big.NewInt(100000000000000))
 	tx := transaction(1, 100000, key)
-	if _, err := pool.add(tx, false); err != nil {
+	if _, err := pool.add(tx, false, true); err != nil {
 		t.Error("didn't expect error", err)
 	}
 	if len(pool.pending) != 0 {
@@ -1898,6 +1903,358 @@ func TestTransactionStatusCheck(t *testing.T) {
 	}
 }
 
+// Tests that simulating transactions reports rejection reasons, nonce gaps and
+// replacement prices without modifying the pool.
+func TestTransactionSimulate(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	pool.currentState.AddBalance(from, big.NewInt(1000000000))
+
+	if err := pool.AddRemote(pricedTransaction(0, 100000, big.NewInt(10), key)); err != nil {
+		t.Fatalf("failed to add pending transaction: %v", err)
+	}
+	if err := pool.AddRemote(pricedTransaction(3, 100000, big.NewInt(10), key)); err != nil {
+		t.Fatalf("failed to add queued transaction: %v", err)
+	}
+	// An executable transaction should be accepted and placed after the pending one
+	sim := pool.Simulate(pricedTransaction(1, 100000, big.NewInt(10), key))
+	if sim.Err != nil || !sim.Executable || sim.Position != 1 || !sim.NextBlock {
+		t.Errorf("executable simulation mismatch: have %+v", sim)
+	}
+	// A gapped transaction should report the missing nonces, skipping queued ones
+	sim = pool.Simulate(pricedTransaction(5, 100000, big.NewInt(10), key))
+	if sim.Err != nil || sim.Executable || sim.NonceGap != 3 || sim.Position != -1 {
+		t.Errorf("gapped simulation mismatch: have %+v", sim)
+	}
+	// An underpriced replacement should report the required price
+	sim = pool.Simulate(pricedTransaction(0, 90000, big.NewInt(10), key))
+	if sim.Err != ErrReplaceUnderpriced || sim.ReplacePrice.Cmp(big.NewInt(11)) != 0 {
+		t.Errorf("replacement simulation mismatch: have %+v", sim)
+	}
+	sim = pool.Simulate(pricedTransaction(0, 100000, big.NewInt(11), key))
+	if sim.Err != nil || sim.Replaces == nil {
+		t.Errorf("priced replacement simulation mismatch: have %+v", sim)
+	}
+	// Invalid transactions should carry the exact validation error
+	if sim = pool.Simulate(pricedTransaction(1, 2000000, big.NewInt(10), key)); sim.Err != ErrGasLimit {
+		t.Errorf("gas limit simulation error mismatch: have %v, want %v", sim.Err, ErrGasLimit)
+	}
+	if pending, queued := pool.Stats(); pending != 1 || queued != 1 {
+		t.Fatalf("pool modified by simulation: pending %d, queued %d", pending, queued)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+	// A full pool should reject replacements just like a submission would
+	pool.mu.Lock()
+	pool.config.GlobalSlots, pool.config.GlobalQueue = 1, 1
+	pool.mu.Unlock()
+
+	replacement := pricedTransaction(0, 100000, big.NewInt(11), key)
+	if sim = pool.Simulate(replacement); sim.Err != ErrPoolLimit {
+		t.Errorf("full pool simulation error mismatch: have %v, want %v", sim.Err, ErrPoolLimit)
+	}
+	if err := pool.AddRemote(replacement); err != sim.Err {
+		t.Errorf("full pool submission error mismatch: have %v, simulated %v", err, sim.Err)
+	}
+}
+
+// Tests that private transactions are tracked until they leave the pool, and
+// dropped once their maximum inclusion block is passed.
+func TestTransactionPrivate(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	pool.currentState.AddBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000000))
+
+	public, private, unlimited := transaction(0, 100000, key), transaction(1, 100000, key), transaction(2, 100000, key)
+	if err := pool.AddLocal(public); err != nil {
+		t.Fatalf("failed to add public transaction: %v", err)
+	}
+	if err := pool.AddPrivate(private, 3); err != nil {
+		t.Fatalf("failed to add private transaction: %v", err)
+	}
+	if err := pool.AddPrivate(unlimited, 0); err != nil {
+		t.Fatalf("failed to add unlimited private transaction: %v", err)
+	}
+	if pool.IsPrivate(public.Hash()) || !pool.IsPrivate(private.Hash()) || !pool.IsPrivate(unlimited.Hash()) {
+		t.Fatalf("private flags mismatch")
+	}
+	if maxBlock, ok := pool.PrivateMaxBlock(private.Hash()); !ok || maxBlock != 3 {
+		t.Fatalf("private max block mismatch: have %d, %v, want 3, true", maxBlock, ok)
+	}
+	if _, txs := pool.local(); len(txs) != 1 || txs[0].Hash() != public.Hash() {
+		t.Fatalf("private transactions leaked into the local journal set: %v", txs)
+	}
+	if err := pool.AddPrivate(transaction(3, 100000, key), 0); err != nil {
+		t.Fatalf("failed to add private transaction: %v", err)
+	}
+	// Passing the max block should drop the expiring transaction, demoting later ones
+	pool.mu.Lock()
+	pool.dropPrivate(3)
+	pool.mu.Unlock()
+
+	if pool.Get(private.Hash()) != nil || pool.IsPrivate(private.Hash()) {
+		t.Fatalf("expired private transaction not dropped")
+	}
+	if pool.Get(unlimited.Hash()) == nil || !pool.IsPrivate(unlimited.Hash()) {
+		t.Fatalf("unlimited private transaction dropped")
+	}
+	if pending, queued := pool.Stats(); pending != 1 || queued != 2 {
+		t.Fatalf("pool stats mismatch: pending %d, queued %d", pending, queued)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
+// Tests that private transactions included in a block stay private if a reorg
+// reinjects them, keeping their maximum inclusion block.
+func TestTransactionPrivateReinject(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	pool.currentState.AddBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000000))
+
+	tx := transaction(0, 100000, key)
+	if err := pool.AddPrivate(tx, 10); err != nil {
+		t.Fatalf("failed to add private transaction: %v", err)
+	}
+	// Include the transaction, then reorg it out again
+	pool.mu.Lock()
+	pool.removeTx(tx)
+	pool.dropPrivate(1)
+	errs := pool.reinject(map[common.Hash]*types.Transaction{tx.Hash(): tx})
+	pool.dropPrivate(2)
+	pool.mu.Unlock()
+
+	if len(errs) > 0 {
+		t.Fatalf("failed to reinject transaction: %v", errs)
+	}
+	if maxBlock, ok := pool.PrivateMaxBlock(tx.Hash()); !ok || maxBlock != 10 {
+		t.Fatalf("reinjected private transaction mismatch: have %d, %v, want 10, true", maxBlock, ok)
+	}
+	// Once included for good, the transaction is eventually forgotten
+	pool.mu.Lock()
+	pool.removeTx(tx)
+	pool.dropPrivate(3)
+	pool.dropPrivate(3 + privateRetention)
+	pool.mu.Unlock()
+
+	if pool.IsPrivate(tx.Hash()) {
+		t.Fatalf("included private transaction not forgotten")
+	}
+}
+
+// Tests that the admission policies reject denied, underpriced and rate limited
+// transactions, and that the deny list can be reloaded.
+func TestTransactionPolicy(t *testing.T) {
+	t.Parallel()
+
+	file, err := ioutil.TempFile("", "denylist")
+	if err != nil {
+		t.Fatalf("failed to create deny list: %v", err)
+	}
+	defer os.Remove(file.Name())
+	file.Close()
+
+	denied, _ := crypto.GenerateKey()
+	if err := ioutil.WriteFile(file.Name(), []byte("# spammers\n"+crypto.PubkeyToAddress(denied.PublicKey).Hex()+"\n"), 0644); err != nil {
+		t.Fatalf("failed to write deny list: %v", err)
+	}
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(ethdb.NewMemDatabase()))
+	blockchain := newTestBlockChain(statedb, 1000000)
+
+	config := testTxPoolConfig
+	config.SenderRate = 0.001
+	config.SenderBurst = 2
+	config.RecipientPriceLimits = map[common.Address]uint64{{}: 2}
+	config.DenyList = file.Name()
+
+	pool := NewTxPool(config, params.TestChainConfig, blockchain)
+	defer pool.Stop()
+
+	key, _ := crypto.GenerateKey()
+	pool.currentState.AddBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000000))
+	pool.currentState.AddBalance(crypto.PubkeyToAddress(denied.PublicKey), big.NewInt(1000000000))
+
+	if err := pool.AddRemote(pricedTransaction(0, 100000, big.NewInt(2), denied)); err != ErrDenied {
+		t.Fatalf("denied sender error mismatch: have %v, want %v", err, ErrDenied)
+	}
+	if err := pool.AddRemote(pricedTransaction(0, 100000, big.NewInt(1), key)); err != ErrRecipientUnderpriced {
+		t.Fatalf("underpriced recipient error mismatch: have %v, want %v", err, ErrRecipientUnderpriced)
+	}
+	for i := uint64(0); i < 2; i++ {
+		if err := pool.AddRemote(pricedTransaction(i, 100000, big.NewInt(2), key)); err != nil {
+			t.Fatalf("failed to add transaction %d: %v", i, err)
+		}
+	}
+	if err := pool.AddRemote(pricedTransaction(2, 100000, big.NewInt(2), key)); err != ErrSenderRateLimited {
+		t.Fatalf("rate limited sender error mismatch: have %v, want %v", err, ErrSenderRateLimited)
+	}
+	// Locals are exempt from rate limits, but not from the deny list
+	if err := pool.AddLocal(pricedTransaction(2, 100000, big.NewInt(1), key)); err != nil {
+		t.Fatalf("failed to add local transaction: %v", err)
+	}
+	if err := pool.AddLocal(pricedTransaction(0, 100000, big.NewInt(2), denied)); err != ErrDenied {
+		t.Fatalf("denied local error mismatch: have %v, want %v", err, ErrDenied)
+	}
+	// Emptying the deny list should admit the sender again
+	if err := ioutil.WriteFile(file.Name(), nil, 0644); err != nil {
+		t.Fatalf("failed to write deny list: %v", err)
+	}
+	if n, err := pool.ReloadDenyList(); err != nil || n != 0 {
+		t.Fatalf("failed to reload deny list: %d, %v", n, err)
+	}
+	if err := pool.AddRemote(pricedTransaction(0, 100000, big.NewInt(2), denied)); err != nil {
+		t.Fatalf("failed to add previously denied transaction: %v", err)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
+// Tests that rate limits only consume tokens for transactions passing all other
+// checks, and don't apply to transactions reinjected by the pool itself.
+func TestTransactionPolicyTokens(t *testing.T) {
+	t.Parallel()
+
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(ethdb.NewMemDatabase()))
+	blockchain := newTestBlockChain(statedb, 1000000)
+
+	config := testTxPoolConfig
+	config.SenderRate = 0.001
+	config.SenderBurst = 1
+
+	pool := NewTxPool(config, params.TestChainConfig, blockchain)
+	defer pool.Stop()
+
+	key, _ := crypto.GenerateKey()
+	pool.currentState.AddBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000000))
+
+	// A transaction rejected by a full pool must not consume the only token
+	pool.mu.Lock()
+	slots, queue := pool.config.GlobalSlots, pool.config.GlobalQueue
+	pool.config.GlobalSlots, pool.config.GlobalQueue = 0, 0
+	pool.mu.Unlock()
+
+	if err := pool.AddRemote(transaction(0, 100000, key)); err != ErrPoolLimit {
+		t.Fatalf("full pool error mismatch: have %v, want %v", err, ErrPoolLimit)
+	}
+	pool.mu.Lock()
+	pool.config.GlobalSlots, pool.config.GlobalQueue = slots, queue
+	pool.mu.Unlock()
+
+	if err := pool.AddRemote(transaction(0, 100000, key)); err != nil {
+		t.Fatalf("failed to add transaction: %v", err)
+	}
+	if err := pool.AddRemote(transaction(1, 100000, key)); err != ErrSenderRateLimited {
+		t.Fatalf("rate limited sender error mismatch: have %v, want %v", err, ErrSenderRateLimited)
+	}
+	// Reinjected transactions bypass the rate limits, snapshotted ones don't
+	pool.mu.Lock()
+	errs := pool.reinject(map[common.Hash]*types.Transaction{common.Hash{1}: transaction(1, 100000, key)})
+	pool.mu.Unlock()
+	if len(errs) != 0 {
+		t.Fatalf("failed to reinject transaction: %v", errs)
+	}
+	if errs := pool.addSnapshotted(types.Transactions{transaction(2, 100000, key)}, []time.Time{time.Now()}); len(errs) != 1 || errs[0] != ErrSenderRateLimited {
+		t.Fatalf("snapshotted transaction errors mismatch: have %v, want [%v]", errs, ErrSenderRateLimited)
+	}
+	if pending, _ := pool.Stats(); pending != 2 {
+		t.Fatalf("pending transactions mismatch: have %d, want %d", pending, 2)
+	}
+}
+
+// Tests that remote transactions are snapshotted on shutdown and reinjected on
+// startup, re-validated against the new head and dropping stale ones.
+func TestTransactionSnapshot(t *testing.T) {
+	t.Parallel()
+
+	file, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary snapshot: %v", err)
+	}
+	snapshot := file.Name()
+	defer os.Remove(snapshot)
+
+	file.Close()
+	os.Remove(snapshot)
+
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(ethdb.NewMemDatabase()))
+	blockchain := newTestBlockChain(statedb, 1000000)
+
+	config := testTxPoolConfig
+	config.Snapshot = snapshot
+
+	pool := NewTxPool(config, params.TestChainConfig, blockchain)
+
+	local, _ := crypto.GenerateKey()
+	remote, _ := crypto.GenerateKey()
+	stale, _ := crypto.GenerateKey()
+
+	pool.mu.Lock()
+	for _, key := range []*ecdsa.PrivateKey{local, remote, stale} {
+		pool.currentState.AddBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000000))
+	}
+	pool.mu.Unlock()
+
+	if err := pool.AddLocal(transaction(0, 100000, local)); err != nil {
+		t.Fatalf("failed to add local transaction: %v", err)
+	}
+	remotes := types.Transactions{transaction(0, 100000, remote), transaction(1, 100000, remote), transaction(3, 100000, remote)}
+	for _, tx := range remotes {
+		if err := pool.AddRemote(tx); err != nil {
+			t.Fatalf("failed to add remote transaction: %v", err)
+		}
+	}
+	old := transaction(0, 100000, stale)
+	if err := pool.AddRemote(old); err != nil {
+		t.Fatalf("failed to add remote transaction: %v", err)
+	}
+	pool.all.SetArrival(old.Hash(), time.Now().Add(-2*config.SnapshotMaxAge))
+	arrived := time.Now().Add(-time.Minute).Truncate(time.Second)
+	pool.all.SetArrival(remotes[1].Hash(), arrived)
+
+	// Terminate the old pool, bump the remote nonce, create a new pool and ensure
+	// only the still valid, recent remote transactions survive
+	pool.Stop()
+	statedb.SetNonce(crypto.PubkeyToAddress(remote.PublicKey), 1)
+	blockchain = newTestBlockChain(statedb, 1000000)
+
+	pool = NewTxPool(config, params.TestChainConfig, blockchain)
+	defer pool.Stop()
+
+	if pending, queued := pool.Stats(); pending != 1 || queued != 1 {
+		t.Fatalf("pool stats mismatch: pending %d, queued %d", pending, queued)
+	}
+	if pool.Get(remotes[1].Hash()) == nil || pool.Get(remotes[2].Hash()) == nil {
+		t.Fatalf("remote transactions not reinjected")
+	}
+	if pool.Get(old.Hash()) != nil {
+		t.Fatalf("stale remote transaction reinjected")
+	}
+	if have := pool.all.Arrival(remotes[1].Hash()); !have.Equal(arrived) {
+		t.Fatalf("arrival time mismatch: have %v, want %v", have, arrived)
+	}
+	// Snapshotting an already pooled transaction again must keep its arrival time
+	pool.addSnapshotted(types.Transactions{remotes[1]}, []time.Time{time.Now()})
+	if have := pool.all.Arrival(remotes[1].Hash()); !have.Equal(arrived) {
+		t.Fatalf("arrival time of known transaction overwritten: have %v, want %v", have, arrived)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
 // Benchmarks the speed of validating the contents of the pending queue of the
 // transaction pool.
 func BenchmarkTxPool_promoteTx(b *testing.B) {
@@ -0,0 +1,152 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"time"
+
+	"github.com/zeus-fyi/gochain/v4/core/types"
+	"github.com/zeus-fyi/gochain/v4/log"
+	"github.com/zeus-fyi/gochain/v4/rlp"
+)
+
+// snapshotTx is a remote transaction persisted in a pool snapshot, along with
+// the time it first arrived in the pool.
+type snapshotTx struct {
+	Tx      *types.Transaction
+	Arrived uint64 // Unix time in seconds
+}
+
+// txSnapshot is a point-in-time dump of the remote transactions in the pool,
+// allowing a restarted node to resume with a populated pool. Unlike the local
+// journal it is rewritten in full every time, never appended to.
+type txSnapshot struct {
+	path   string        // Filesystem path to store the transactions at
+	limit  int           // Maximum number of transactions to store or load
+	maxAge time.Duration // Maximum age of transactions to store or load
+}
+
+// newTxSnapshot creates a new remote transaction snapshot.
+func newTxSnapshot(path string, limit int, maxAge time.Duration) *txSnapshot {
+	return &txSnapshot{
+		path:   path,
+		limit:  limit,
+		maxAge: maxAge,
+	}
+}
+
+// load parses a snapshot from disk, skipping transactions which are too old,
+// and passes the remaining ones, in order, to add in batches along with their
+// arrival times.
+func (snap *txSnapshot) load(add func(types.Transactions, []time.Time) []error) error {
+	const batchSize = 1000
+	// Skip the parsing if the snapshot file doesn't exist at all
+	if _, err := os.Stat(snap.path); os.IsNotExist(err) {
+		return nil
+	}
+	input, err := os.Open(snap.path)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	stream := rlp.NewStream(bufio.NewReader(input), 0)
+	total, stale, dropped := 0, 0, 0
+
+	var (
+		failure error
+		batch   types.Transactions
+		times   []time.Time
+		cutoff  = time.Now().Add(-snap.maxAge)
+	)
+	addBatch := func() {
+		if errs := add(batch, times); len(errs) > 0 {
+			dropped += len(errs)
+			log.Debug("Failed to add snapshotted transactions", "errs", len(errs))
+		}
+		batch, times = batch[:0], times[:0]
+	}
+	for total < snap.limit {
+		entry := new(snapshotTx)
+		if err := stream.Decode(entry); err != nil {
+			if err != io.EOF {
+				failure = err
+			}
+			break
+		}
+		total++
+		arrived := time.Unix(int64(entry.Arrived), 0)
+		if arrived.Before(cutoff) {
+			stale++
+			continue
+		}
+		batch = append(batch, entry.Tx)
+		times = append(times, arrived)
+		if len(batch) >= batchSize {
+			addBatch()
+		}
+	}
+	if len(batch) > 0 {
+		addBatch()
+	}
+	log.Info("Loaded remote transaction snapshot", "transactions", total, "stale", stale, "dropped", dropped)
+
+	return failure
+}
+
+// write replaces the snapshot on disk with the given transactions, skipping
+// those which are too old and stopping at the size cap.
+func (snap *txSnapshot) write(txs types.Transactions, arrival func(*types.Transaction) time.Time) error {
+	output, err := os.OpenFile(snap.path+".new", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	var (
+		writer  = bufio.NewWriter(output)
+		cutoff  = time.Now().Add(-snap.maxAge)
+		written int
+	)
+	for _, tx := range txs {
+		if written >= snap.limit {
+			break
+		}
+		arrived := arrival(tx)
+		if arrived.Before(cutoff) {
+			continue
+		}
+		if err = rlp.Encode(writer, &snapshotTx{Tx: tx, Arrived: uint64(arrived.Unix())}); err != nil {
+			_ = output.Close()
+			return err
+		}
+		written++
+	}
+	if err := writer.Flush(); err != nil {
+		_ = output.Close()
+		return err
+	}
+	if err := output.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(snap.path+".new", snap.path); err != nil {
+		return err
+	}
+	log.Info("Wrote remote transaction snapshot", "transactions", written)
+	return nil
+}
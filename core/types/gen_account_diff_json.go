@@ -0,0 +1,102 @@
+// Code generated by github.com/fjl/gencodec. DO NOT EDIT.
+
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+
+	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/common/hexutil"
+)
+
+var _ = (*accountDiffMarshaling)(nil)
+
+// MarshalJSON marshals as JSON.
+func (a AccountDiff) MarshalJSON() ([]byte, error) {
+	type AccountDiff struct {
+		Address      common.Address `json:"address" gencodec:"required"`
+		Created      bool           `json:"created"`
+		Deleted      bool           `json:"deleted"`
+		BalanceFrom  *hexutil.Big   `json:"balanceFrom" gencodec:"required"`
+		BalanceTo    *hexutil.Big   `json:"balanceTo" gencodec:"required"`
+		NonceFrom    hexutil.Uint64 `json:"nonceFrom"`
+		NonceTo      hexutil.Uint64 `json:"nonceTo"`
+		CodeHashFrom common.Hash    `json:"codeHashFrom"`
+		CodeHashTo   common.Hash    `json:"codeHashTo"`
+		Code         hexutil.Bytes  `json:"code,omitempty"`
+		Storage      []StorageDiff  `json:"storage"`
+	}
+	var enc AccountDiff
+	enc.Address = a.Address
+	enc.Created = a.Created
+	enc.Deleted = a.Deleted
+	enc.BalanceFrom = (*hexutil.Big)(a.BalanceFrom)
+	enc.BalanceTo = (*hexutil.Big)(a.BalanceTo)
+	enc.NonceFrom = hexutil.Uint64(a.NonceFrom)
+	enc.NonceTo = hexutil.Uint64(a.NonceTo)
+	enc.CodeHashFrom = a.CodeHashFrom
+	enc.CodeHashTo = a.CodeHashTo
+	enc.Code = a.Code
+	enc.Storage = a.Storage
+	return json.Marshal(&enc)
+}
+
+// UnmarshalJSON unmarshals from JSON.
+func (a *AccountDiff) UnmarshalJSON(input []byte) error {
+	type AccountDiff struct {
+		Address      *common.Address `json:"address" gencodec:"required"`
+		Created      *bool           `json:"created"`
+		Deleted      *bool           `json:"deleted"`
+		BalanceFrom  *hexutil.Big    `json:"balanceFrom" gencodec:"required"`
+		BalanceTo    *hexutil.Big    `json:"balanceTo" gencodec:"required"`
+		NonceFrom    *hexutil.Uint64 `json:"nonceFrom"`
+		NonceTo      *hexutil.Uint64 `json:"nonceTo"`
+		CodeHashFrom *common.Hash    `json:"codeHashFrom"`
+		CodeHashTo   *common.Hash    `json:"codeHashTo"`
+		Code         *hexutil.Bytes  `json:"code,omitempty"`
+		Storage      []StorageDiff   `json:"storage"`
+	}
+	var dec AccountDiff
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+	if dec.Address == nil {
+		return errors.New("missing required field 'address' for AccountDiff")
+	}
+	a.Address = *dec.Address
+	if dec.Created != nil {
+		a.Created = *dec.Created
+	}
+	if dec.Deleted != nil {
+		a.Deleted = *dec.Deleted
+	}
+	if dec.BalanceFrom == nil {
+		return errors.New("missing required field 'balanceFrom' for AccountDiff")
+	}
+	a.BalanceFrom = (*big.Int)(dec.BalanceFrom)
+	if dec.BalanceTo == nil {
+		return errors.New("missing required field 'balanceTo' for AccountDiff")
+	}
+	a.BalanceTo = (*big.Int)(dec.BalanceTo)
+	if dec.NonceFrom != nil {
+		a.NonceFrom = uint64(*dec.NonceFrom)
+	}
+	if dec.NonceTo != nil {
+		a.NonceTo = uint64(*dec.NonceTo)
+	}
+	if dec.CodeHashFrom != nil {
+		a.CodeHashFrom = *dec.CodeHashFrom
+	}
+	if dec.CodeHashTo != nil {
+		a.CodeHashTo = *dec.CodeHashTo
+	}
+	if dec.Code != nil {
+		a.Code = *dec.Code
+	}
+	if dec.Storage != nil {
+		a.Storage = dec.Storage
+	}
+	return nil
+}
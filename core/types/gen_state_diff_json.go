@@ -0,0 +1,58 @@
+// Code generated by github.com/fjl/gencodec. DO NOT EDIT.
+
+package types
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/common/hexutil"
+)
+
+var _ = (*stateDiffMarshaling)(nil)
+
+// MarshalJSON marshals as JSON.
+func (s StateDiff) MarshalJSON() ([]byte, error) {
+	type StateDiff struct {
+		BlockHash   common.Hash    `json:"blockHash"`
+		BlockNumber hexutil.Uint64 `json:"blockNumber"`
+		Root        common.Hash    `json:"stateRoot" gencodec:"required"`
+		Accounts    []*AccountDiff `json:"accounts" gencodec:"required"`
+	}
+	var enc StateDiff
+	enc.BlockHash = s.BlockHash
+	enc.BlockNumber = hexutil.Uint64(s.BlockNumber)
+	enc.Root = s.Root
+	enc.Accounts = s.Accounts
+	return json.Marshal(&enc)
+}
+
+// UnmarshalJSON unmarshals from JSON.
+func (s *StateDiff) UnmarshalJSON(input []byte) error {
+	type StateDiff struct {
+		BlockHash   *common.Hash    `json:"blockHash"`
+		BlockNumber *hexutil.Uint64 `json:"blockNumber"`
+		Root        *common.Hash    `json:"stateRoot" gencodec:"required"`
+		Accounts    []*AccountDiff  `json:"accounts" gencodec:"required"`
+	}
+	var dec StateDiff
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+	if dec.BlockHash != nil {
+		s.BlockHash = *dec.BlockHash
+	}
+	if dec.BlockNumber != nil {
+		s.BlockNumber = uint64(*dec.BlockNumber)
+	}
+	if dec.Root == nil {
+		return errors.New("missing required field 'stateRoot' for StateDiff")
+	}
+	s.Root = *dec.Root
+	if dec.Accounts == nil {
+		return errors.New("missing required field 'accounts' for StateDiff")
+	}
+	s.Accounts = dec.Accounts
+	return nil
+}
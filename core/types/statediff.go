@@ -0,0 +1,121 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"bytes"
+	"math/big"
+	"sort"
+
+	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/common/hexutil"
+)
+
+//go:generate gencodec -type StateDiff -field-override stateDiffMarshaling -out gen_state_diff_json.go
+//go:generate gencodec -type AccountDiff -field-override accountDiffMarshaling -out gen_account_diff_json.go
+
+// StateDiff is the set of account and storage changes made by a block.
+type StateDiff struct {
+	BlockHash   common.Hash    `json:"blockHash"`
+	BlockNumber uint64         `json:"blockNumber"`
+	Root        common.Hash    `json:"stateRoot" gencodec:"required"`
+	Accounts    []*AccountDiff `json:"accounts" gencodec:"required"` // Sorted by address
+}
+
+type stateDiffMarshaling struct {
+	BlockNumber hexutil.Uint64
+}
+
+// AccountDiff is the change of a single account. The From fields hold its
+// values before the block and the To fields those after; the side on which
+// the account does not exist holds zero values. Storage wiped by destructing
+// or overwriting the account is listed in full, with zero To values for the
+// slots not set again.
+type AccountDiff struct {
+	Address      common.Address `json:"address" gencodec:"required"`
+	Created      bool           `json:"created"` // Account did not exist before the block
+	Deleted      bool           `json:"deleted"` // Account does not exist after the block
+	BalanceFrom  *big.Int       `json:"balanceFrom" gencodec:"required"`
+	BalanceTo    *big.Int       `json:"balanceTo" gencodec:"required"`
+	NonceFrom    uint64         `json:"nonceFrom"`
+	NonceTo      uint64         `json:"nonceTo"`
+	CodeHashFrom common.Hash    `json:"codeHashFrom"`
+	CodeHashTo   common.Hash    `json:"codeHashTo"`
+	Code         []byte         `json:"code,omitempty"` // New code, if it changed
+	Storage      []StorageDiff  `json:"storage"`        // Changed slots, sorted by key
+}
+
+type accountDiffMarshaling struct {
+	BalanceFrom *hexutil.Big
+	BalanceTo   *hexutil.Big
+	NonceFrom   hexutil.Uint64
+	NonceTo     hexutil.Uint64
+	Code        hexutil.Bytes
+}
+
+// StorageDiff is the change of a single storage slot.
+type StorageDiff struct {
+	Key  common.Hash `json:"key"`
+	From common.Hash `json:"from"`
+	To   common.Hash `json:"to"`
+}
+
+// ReverseDiff holds the account and storage values overwritten by a block, so
+// that the state before it can be read back from the state after it. Entries
+// are keyed by hash and hold RLP encoded values, as in the state tries.
+type ReverseDiff struct {
+	Accounts []*ReverseAccount // Sorted by address hash
+	Codes    [][]byte          // Code of the contracts destructed by the block
+}
+
+// ReverseAccount is the value of a single account before a block.
+type ReverseAccount struct {
+	Hash    common.Hash   // Hash of the address
+	Account []byte        // RLP encoded account, empty if it did not exist
+	Wiped   bool          // Storage was destructed, so Storage lists every slot
+	Storage []ReverseSlot // Overwritten slots, sorted by hash
+}
+
+// ReverseSlot is the value of a single storage slot before a block.
+type ReverseSlot struct {
+	Hash  common.Hash // Hash of the slot key
+	Value []byte      // RLP encoded value, empty if it was unset
+}
+
+// Account returns the entry of the account with the given address hash, or
+// nil if the block did not change it.
+func (d *ReverseDiff) Account(hash common.Hash) *ReverseAccount {
+	i := sort.Search(len(d.Accounts), func(i int) bool {
+		return bytes.Compare(d.Accounts[i].Hash[:], hash[:]) >= 0
+	})
+	if i < len(d.Accounts) && d.Accounts[i].Hash == hash {
+		return d.Accounts[i]
+	}
+	return nil
+}
+
+// Slot returns the entry of the slot with the given hash, or nil if the block
+// did not change it.
+func (a *ReverseAccount) Slot(hash common.Hash) *ReverseSlot {
+	i := sort.Search(len(a.Storage), func(i int) bool {
+		return bytes.Compare(a.Storage[i].Hash[:], hash[:]) >= 0
+	})
+	if i < len(a.Storage) && a.Storage[i].Hash == hash {
+		return &a.Storage[i]
+	}
+	return nil
+}
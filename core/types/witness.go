@@ -0,0 +1,41 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+// Witness is the execution witness of a block: every ancestor header, trie
+// node and contract code blob touched while processing it on top of its
+// parent state. Nodes and codes are keyed implicitly by their hash.
+type Witness struct {
+	Headers []*Header // Ancestor headers accessed via BLOCKHASH, ascending by number
+	Codes   [][]byte  // Contract code blobs, sorted by hash
+	Nodes   [][]byte  // RLP encoded trie nodes, sorted by hash
+}
+
+// Size returns the approximate byte size of the witness contents.
+func (w *Witness) Size() int {
+	var size int
+	for _, h := range w.Headers {
+		size += int(h.Size())
+	}
+	for _, c := range w.Codes {
+		size += len(c)
+	}
+	for _, n := range w.Nodes {
+		size += len(n)
+	}
+	return size
+}
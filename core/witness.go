@@ -0,0 +1,164 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/consensus"
+	"github.com/zeus-fyi/gochain/v4/core/state"
+	"github.com/zeus-fyi/gochain/v4/core/types"
+	"github.com/zeus-fyi/gochain/v4/core/vm"
+	"github.com/zeus-fyi/gochain/v4/params"
+)
+
+// Witness re-executes block on top of its parent state and returns its
+// execution witness: every ancestor header, trie node and contract code
+// accessed while processing and finalizing it.
+func (p *StateProcessor) Witness(block *types.Block) (*types.Witness, error) {
+	parent := p.bc.GetHeader(block.ParentHash(), block.NumberU64()-1)
+	if parent == nil {
+		return nil, consensus.ErrUnknownAncestor
+	}
+	statedb, err := state.New(parent.Root, p.bc.stateCache)
+	if err != nil {
+		return nil, err
+	}
+	if err := statedb.RecordWitness(); err != nil {
+		return nil, err
+	}
+	if _, _, _, err := p.Process(block, statedb, vm.Config{}); err != nil {
+		return nil, err
+	}
+	return statedb.Witness(), nil
+}
+
+// witnessChain records the headers retrieved through GetHeader.
+type witnessChain struct {
+	processChain
+	headers map[common.Hash]*types.Header
+}
+
+func (c *witnessChain) GetHeader(hash common.Hash, number uint64) *types.Header {
+	header := c.processChain.GetHeader(hash, number)
+	if header != nil {
+		c.headers[hash] = header
+	}
+	return header
+}
+
+// accessed returns the recorded headers in ascending number order.
+func (c *witnessChain) accessed() []*types.Header {
+	headers := make([]*types.Header, 0, len(c.headers))
+	for _, header := range c.headers {
+		headers = append(headers, header)
+	}
+	sort.Slice(headers, func(i, j int) bool { return headers[i].Number.Cmp(headers[j].Number) < 0 })
+	return headers
+}
+
+// StatelessProcessor re-executes blocks using only their execution witness and
+// parent header, without access to a state database or the rest of the chain.
+type StatelessProcessor struct {
+	processor *StateProcessor
+	validator *BlockValidator
+}
+
+// NewStatelessProcessor initialises a new StatelessProcessor.
+func NewStatelessProcessor(config *params.ChainConfig, engine consensus.Engine) *StatelessProcessor {
+	return &StatelessProcessor{
+		processor: NewStateProcessor(config, nil, engine),
+		validator: NewBlockValidator(config, nil, engine),
+	}
+}
+
+// Process executes block on top of parent, serving all state and ancestor
+// headers from witness, and validates the gas used, bloom, receipt root and
+// state root of the result against the block's header. Any state missing
+// from the witness surfaces as a missing trie node error.
+func (p *StatelessProcessor) Process(block *types.Block, parent *types.Header, witness *types.Witness, cfg vm.Config) (types.Receipts, []*types.Log, uint64, error) {
+	if block.ParentHash() != parent.Hash() || block.NumberU64() != parent.Number.Uint64()+1 {
+		return nil, nil, 0, fmt.Errorf("block %d [%x…] is not a child of %d [%x…]", block.NumberU64(), block.Hash().Bytes()[:4], parent.Number, parent.Hash().Bytes()[:4])
+	}
+	statedb, err := state.New(parent.Root, state.NewStatelessDatabase(witness))
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	chain := newStatelessChain(p.processor.config, p.processor.engine, parent, witness.Headers)
+	receipts, logs, usedGas, err := p.processor.process(block, statedb, chain, cfg)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if err := p.validator.ValidateState(block, nil, statedb, receipts, usedGas); err != nil {
+		return nil, nil, 0, err
+	}
+	return receipts, logs, usedGas, nil
+}
+
+// statelessChain serves the headers of a witness. Headers are looked up by
+// their own hash, so only those linked from the parent are ever reachable.
+type statelessChain struct {
+	config  *params.ChainConfig
+	engine  consensus.Engine
+	parent  *types.Header
+	headers map[common.Hash]*types.Header
+}
+
+func newStatelessChain(config *params.ChainConfig, engine consensus.Engine, parent *types.Header, headers []*types.Header) *statelessChain {
+	c := &statelessChain{
+		config:  config,
+		engine:  engine,
+		parent:  parent,
+		headers: map[common.Hash]*types.Header{parent.Hash(): parent},
+	}
+	for _, header := range headers {
+		c.headers[header.Hash()] = header
+	}
+	return c
+}
+
+func (c *statelessChain) Config() *params.ChainConfig  { return c.config }
+func (c *statelessChain) Engine() consensus.Engine     { return c.engine }
+func (c *statelessChain) CurrentHeader() *types.Header { return c.parent }
+
+func (c *statelessChain) GetHeader(hash common.Hash, number uint64) *types.Header {
+	if header := c.headers[hash]; header != nil && header.Number.Uint64() == number {
+		return header
+	}
+	return nil
+}
+
+func (c *statelessChain) GetHeaderByHash(hash common.Hash) *types.Header {
+	return c.headers[hash]
+}
+
+func (c *statelessChain) GetHeaderByNumber(number uint64) *types.Header {
+	for header := c.parent; header != nil; header = c.GetHeader(header.ParentHash, header.Number.Uint64()-1) {
+		if n := header.Number.Uint64(); n == number {
+			return header
+		} else if n == 0 {
+			break
+		}
+	}
+	return nil
+}
+
+func (c *statelessChain) GetBlock(hash common.Hash, number uint64) *types.Block {
+	return nil
+}
@@ -0,0 +1,122 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/consensus/clique"
+	"github.com/zeus-fyi/gochain/v4/core/rawdb"
+	"github.com/zeus-fyi/gochain/v4/core/types"
+	"github.com/zeus-fyi/gochain/v4/core/vm"
+	"github.com/zeus-fyi/gochain/v4/crypto"
+	"github.com/zeus-fyi/gochain/v4/ethdb"
+	"github.com/zeus-fyi/gochain/v4/params"
+)
+
+// Tests that witnesses recorded during import are sufficient to re-execute
+// each block statelessly, that incomplete witnesses are rejected, and that
+// only validated blocks get their witness stored.
+func TestStatelessProcessWitness(t *testing.T) {
+	var (
+		key, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr   = crypto.PubkeyToAddress(key.PublicKey)
+		// sstore(number, blockhash(number-1)); sstore(number-1, 0)
+		contract = common.Address{0xcc}
+		code     = common.FromHex("0x4360019003404355600043600190035500")
+		db       = ethdb.NewMemDatabase()
+		gspec    = &Genesis{
+			Config:   params.TestChainConfig,
+			GasLimit: 3141592,
+			Alloc: GenesisAlloc{
+				addr:     {Balance: big.NewInt(1000000000)},
+				contract: {Balance: big.NewInt(0), Code: code, Storage: map[common.Hash]common.Hash{{0x01}: {0x01}}},
+			},
+		}
+		genesis = gspec.MustCommit(db)
+		engine  = clique.NewFaker()
+		signer  = types.NewEIP155Signer(gspec.Config.ChainId)
+		cache   = &CacheConfig{TrieNodeLimit: 256 * 1024 * 1024, TrieTimeLimit: 5 * time.Minute, Witnesses: true}
+	)
+	blocks, _ := GenerateChain(gspec.Config, genesis, engine, db, 4, func(i int, gen *BlockGen) {
+		tx, _ := types.SignTx(types.NewTransaction(gen.TxNonce(addr), contract, big.NewInt(1), 100000, nil, nil), signer, key)
+		gen.AddTx(tx)
+		tx, _ = types.SignTx(types.NewTransaction(gen.TxNonce(addr), common.Address{byte(i + 1)}, big.NewInt(1), params.TxGas, nil, nil), signer, key)
+		gen.AddTx(tx)
+	})
+	diskdb := ethdb.NewMemDatabase()
+	gspec.MustCommit(diskdb)
+	chain, err := NewBlockChain(diskdb, cache, gspec.Config, engine, vm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	// Blocks failing validation must not have their witness stored.
+	header := blocks[0].Header()
+	header.Root = common.Hash{0x01}
+	bad := types.NewBlockWithHeader(header).WithBody(blocks[0].Transactions(), nil)
+	if _, err := chain.InsertChain(types.Blocks{bad}); err == nil {
+		t.Fatal("block with invalid state root imported")
+	}
+	if witness := rawdb.ReadWitness(diskdb.GlobalTable(), bad.Hash(), bad.NumberU64()); witness != nil {
+		t.Fatal("witness stored for invalid block")
+	}
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	processor := NewStatelessProcessor(gspec.Config, engine)
+	for _, block := range blocks {
+		witness := rawdb.ReadWitness(diskdb.GlobalTable(), block.Hash(), block.NumberU64())
+		if witness == nil {
+			t.Fatalf("block %d: no witness stored", block.NumberU64())
+		}
+		if len(witness.Codes) != 1 || len(witness.Nodes) == 0 {
+			t.Fatalf("block %d: incomplete witness: %d codes, %d nodes", block.NumberU64(), len(witness.Codes), len(witness.Nodes))
+		}
+		regenerated, err := chain.processor.(*StateProcessor).Witness(block)
+		if err != nil {
+			t.Fatalf("block %d: failed to regenerate witness: %v", block.NumberU64(), err)
+		}
+		if len(regenerated.Nodes) != len(witness.Nodes) {
+			t.Errorf("block %d: regenerated witness has %d nodes, want %d", block.NumberU64(), len(regenerated.Nodes), len(witness.Nodes))
+		}
+		parent := chain.GetHeaderByHash(block.ParentHash())
+		if _, _, _, err := processor.Process(block, parent, witness, vm.Config{}); err != nil {
+			t.Fatalf("block %d: stateless processing failed: %v", block.NumberU64(), err)
+		}
+		// Dropping any state from the witness must fail re-execution.
+		pruned := *witness
+		pruned.Nodes = witness.Nodes[1:]
+		if _, _, _, err := processor.Process(block, parent, &pruned, vm.Config{}); err == nil {
+			t.Fatalf("block %d: stateless processing succeeded with missing node", block.NumberU64())
+		}
+		pruned = *witness
+		pruned.Codes = nil
+		if _, _, _, err := processor.Process(block, parent, &pruned, vm.Config{}); err == nil {
+			t.Fatalf("block %d: stateless processing succeeded with missing code", block.NumberU64())
+		}
+	}
+	// A witness must not be accepted for a block on top of the wrong parent.
+	witness, _ := chain.GetWitness(blocks[2])
+	if _, _, _, err := processor.Process(blocks[2], blocks[0].Header(), witness, vm.Config{}); err == nil {
+		t.Fatal("stateless processing succeeded on top of the wrong parent")
+	}
+}
@@ -34,7 +34,9 @@ import (
 	"github.com/zeus-fyi/gochain/v4/core/rawdb"
 	"github.com/zeus-fyi/gochain/v4/core/state"
 	"github.com/zeus-fyi/gochain/v4/core/types"
+	"github.com/zeus-fyi/gochain/v4/internal/era"
 	"github.com/zeus-fyi/gochain/v4/internal/ethapi"
+	"github.com/zeus-fyi/gochain/v4/miner"
 	"github.com/zeus-fyi/gochain/v4/params"
 	"github.com/zeus-fyi/gochain/v4/rlp"
 	"github.com/zeus-fyi/gochain/v4/rpc"
@@ -145,6 +147,103 @@ func (api *PrivateMinerAPI) SetRecommitInterval(interval int) {
 	api.e.Miner().SetRecommitInterval(time.Duration(interval) * time.Millisecond)
 }
 
+// PublicBundleAPI provides an API to submit and simulate bundles of transactions
+// for atomic inclusion by the local miner.
+type PublicBundleAPI struct {
+	e *GoChain
+}
+
+// NewPublicBundleAPI creates a new PublicBundleAPI instance.
+func NewPublicBundleAPI(e *GoChain) *PublicBundleAPI {
+	return &PublicBundleAPI{e}
+}
+
+// decodeBundleTxs decodes a list of RLP encoded signed transactions.
+func decodeBundleTxs(encodedTxs []hexutil.Bytes) (types.Transactions, error) {
+	txs := make(types.Transactions, 0, len(encodedTxs))
+	for i, encodedTx := range encodedTxs {
+		tx := new(types.Transaction)
+		if err := rlp.DecodeBytes(encodedTx, tx); err != nil {
+			return nil, fmt.Errorf("invalid transaction %d: %v", i, err)
+		}
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
+
+// SendBundle queues the signed transactions to be included atomically, in order,
+// at the top of the given block, optionally restricted to a timestamp range. The
+// bundle is discarded if any of its transactions fails. It returns the bundle hash.
+func (api *PublicBundleAPI) SendBundle(ctx context.Context, encodedTxs []hexutil.Bytes, blockNumber hexutil.Uint64, minTimestamp, maxTimestamp *hexutil.Uint64) (common.Hash, error) {
+	txs, err := decodeBundleTxs(encodedTxs)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	bundle := &miner.Bundle{Txs: txs, BlockNumber: uint64(blockNumber)}
+	if minTimestamp != nil {
+		bundle.MinTimestamp = uint64(*minTimestamp)
+	}
+	if maxTimestamp != nil {
+		bundle.MaxTimestamp = uint64(*maxTimestamp)
+	}
+	if err := api.e.Miner().SendBundle(bundle); err != nil {
+		return common.Hash{}, err
+	}
+	return bundle.Hash(), nil
+}
+
+// CallBundleResult is the outcome of simulating a bundle.
+type CallBundleResult struct {
+	BundleHash common.Hash          `json:"bundleHash"`
+	Success    bool                 `json:"success"`
+	Error      string               `json:"error,omitempty"`
+	GasUsed    hexutil.Uint64       `json:"gasUsed"`
+	Results    []CallBundleTxResult `json:"results"`
+}
+
+// CallBundleTxResult is the outcome of a single transaction in a simulated bundle.
+type CallBundleTxResult struct {
+	TxHash  common.Hash    `json:"txHash"`
+	GasUsed hexutil.Uint64 `json:"gasUsed"`
+	Status  hexutil.Uint64 `json:"status"`
+	Logs    []*types.Log   `json:"logs"`
+}
+
+// CallBundle simulates the signed transactions as a bundle at the top of the
+// block following the current head, without queueing it for inclusion.
+func (api *PublicBundleAPI) CallBundle(ctx context.Context, encodedTxs []hexutil.Bytes) (*CallBundleResult, error) {
+	txs, err := decodeBundleTxs(encodedTxs)
+	if err != nil {
+		return nil, err
+	}
+	res, err := api.e.Miner().CallBundle(&miner.Bundle{Txs: txs})
+	if err != nil {
+		return nil, err
+	}
+	result := &CallBundleResult{
+		BundleHash: res.Hash,
+		Success:    res.Err == nil,
+		GasUsed:    hexutil.Uint64(res.GasUsed),
+		Results:    make([]CallBundleTxResult, 0, len(res.Receipts)),
+	}
+	if res.Err != nil {
+		result.Error = res.Err.Error()
+	}
+	for _, receipt := range res.Receipts {
+		logs := receipt.Logs
+		if logs == nil {
+			logs = []*types.Log{}
+		}
+		result.Results = append(result.Results, CallBundleTxResult{
+			TxHash:  receipt.TxHash,
+			GasUsed: hexutil.Uint64(receipt.GasUsed),
+			Status:  hexutil.Uint64(receipt.Status),
+			Logs:    logs,
+		})
+	}
+	return result, nil
+}
+
 // PrivateAdminAPI is the collection of GoChain full node-related APIs
 // exposed over the private admin endpoint.
 type PrivateAdminAPI struct {
@@ -179,6 +278,18 @@ func (api *PrivateAdminAPI) ExportChain(file string) (bool, error) {
 	return true, nil
 }
 
+// ExportHistory exports the given block range of the current blockchain into
+// history archive files in a local directory, returning their paths. A nil
+// last block exports up to the current head.
+func (api *PrivateAdminAPI) ExportHistory(dir string, first uint64, last *uint64) ([]string, error) {
+	chain := api.eth.BlockChain()
+	end := chain.CurrentBlock().NumberU64()
+	if last != nil {
+		end = *last
+	}
+	return era.Export(chain, dir, era.NetworkName(chain.Config().ChainId), first, end)
+}
+
 func hasAllBlocks(chain *core.BlockChain, bs []*types.Block) bool {
 	for _, b := range bs {
 		if !chain.HasBlock(b.Hash(), b.NumberU64()) {
@@ -239,6 +350,12 @@ func (api *PrivateAdminAPI) ImportChain(ctx context.Context, file string) (bool,
 	return true, nil
 }
 
+// ReloadTxPoolDenyList reloads the transaction pool's deny list from its file,
+// returning the number of denied addresses.
+func (api *PrivateAdminAPI) ReloadTxPoolDenyList() (int, error) {
+	return api.eth.TxPool().ReloadDenyList()
+}
+
 // PublicDebugAPI is the collection of GoChain full node APIs exposed
 // over the public debugging endpoint.
 type PublicDebugAPI struct {
@@ -297,6 +414,40 @@ func (api *PrivateDebugAPI) Preimage(ctx context.Context, hash common.Hash) (hex
 	return nil, errors.New("unknown preimage")
 }
 
+// ExecutionWitness returns the RLP encoded execution witness of a block: every
+// ancestor header, trie node and contract code touched while processing it.
+func (api *PrivateDebugAPI) ExecutionWitness(ctx context.Context, blockNr rpc.BlockNumber) (hexutil.Bytes, error) {
+	var block *types.Block
+	if blockNr == rpc.LatestBlockNumber {
+		block = api.eth.blockchain.CurrentBlock()
+	} else {
+		block = api.eth.blockchain.GetBlockByNumber(uint64(blockNr))
+	}
+	if block == nil {
+		return nil, fmt.Errorf("block #%d not found", blockNr)
+	}
+	witness, err := api.eth.blockchain.GetWitness(block)
+	if err != nil {
+		return nil, err
+	}
+	return rlp.EncodeToBytes(witness)
+}
+
+// StateDiff returns every account balance, nonce, code and storage change made
+// by a block, with the values before and after it.
+func (api *PrivateDebugAPI) StateDiff(ctx context.Context, blockNr rpc.BlockNumber) (*types.StateDiff, error) {
+	var block *types.Block
+	if blockNr == rpc.LatestBlockNumber {
+		block = api.eth.blockchain.CurrentBlock()
+	} else {
+		block = api.eth.blockchain.GetBlockByNumber(uint64(blockNr))
+	}
+	if block == nil {
+		return nil, fmt.Errorf("block #%d not found", blockNr)
+	}
+	return api.eth.blockchain.GetStateDiff(block)
+}
+
 // BadBlockArgs represents the entries in the list returned when bad blocks are queried.
 type BadBlockArgs struct {
 	Hash  common.Hash            `json:"hash"`
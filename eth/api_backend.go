@@ -117,6 +117,12 @@ func (b *EthApiBackend) StateAndHeaderByNumber(ctx context.Context, blockNr rpc.
 		return nil, nil, err
 	}
 	stateDb, err := b.eth.BlockChain().StateAt(header.Root)
+	if err != nil {
+		// Fall back to the reverse diffs if the state is no longer in the trie.
+		if historic, herr := b.eth.BlockChain().HistoricState(header); herr == nil {
+			return historic, header, nil
+		}
+	}
 	return stateDb, header, err
 }
 
@@ -203,6 +209,10 @@ func (b *EthApiBackend) SendTx(ctx context.Context, signedTx *types.Transaction)
 	return b.eth.txPool.AddLocal(signedTx)
 }
 
+func (b *EthApiBackend) SendPrivateTx(ctx context.Context, signedTx *types.Transaction, maxBlock uint64) error {
+	return b.eth.txPool.AddPrivate(signedTx, maxBlock)
+}
+
 func (b *EthApiBackend) GetPoolTransactions() types.Transactions {
 	return b.eth.txPool.PendingList()
 }
@@ -223,6 +233,14 @@ func (b *EthApiBackend) TxPoolContent(ctx context.Context) (map[common.Address]t
 	return b.eth.TxPool().Content()
 }
 
+func (b *EthApiBackend) TxPoolContentFrom(ctx context.Context, addr common.Address) (types.Transactions, types.Transactions) {
+	return b.eth.TxPool().ContentFrom(addr)
+}
+
+func (b *EthApiBackend) TxPoolSimulate(ctx context.Context, tx *types.Transaction) (*core.TxSimulation, error) {
+	return b.eth.TxPool().Simulate(tx), nil
+}
+
 func (b *EthApiBackend) SubscribeNewTxsEvent(ch chan<- core.NewTxsEvent, name string) {
 	b.eth.TxPool().SubscribeNewTxsEvent(ch, name)
 }
@@ -256,6 +274,14 @@ func (b *EthApiBackend) BloomStatus() (uint64, uint64) {
 	return params.BloomBitsBlocks, sections
 }
 
+func (b *EthApiBackend) LogIndexStatus() (uint64, uint64) {
+	if b.eth.logIndexer == nil {
+		return 0, 0
+	}
+	sections, _, _ := b.eth.logIndexer.Sections()
+	return params.LogIndexBlocks, sections
+}
+
 func (b *EthApiBackend) ServiceFilter(ctx context.Context, session *bloombits.MatcherSession) {
 	for i := 0; i < bloomFilterThreads; i++ {
 		go session.Multiplex(bloomRetrievalBatch, bloomRetrievalWait, b.eth.bloomRequests)
@@ -32,7 +32,9 @@ import (
 	"github.com/zeus-fyi/gochain/v4/consensus/clique"
 	"github.com/zeus-fyi/gochain/v4/core"
 	"github.com/zeus-fyi/gochain/v4/core/bloombits"
+	"github.com/zeus-fyi/gochain/v4/core/logindex"
 	"github.com/zeus-fyi/gochain/v4/core/rawdb"
+	"github.com/zeus-fyi/gochain/v4/core/state/pruner"
 	"github.com/zeus-fyi/gochain/v4/core/types"
 	"github.com/zeus-fyi/gochain/v4/core/vm"
 	"github.com/zeus-fyi/gochain/v4/eth/downloader"
@@ -78,6 +80,7 @@ type GoChain struct {
 
 	bloomRequests chan chan *bloombits.Retrieval // Channel receiving bloom data retrieval requests
 	bloomIndexer  *core.ChainIndexer             // Bloom indexer operating during block imports
+	logIndexer    *core.ChainIndexer             // Exact log indexer operating during block imports, nil if disabled
 
 	ApiBackend *EthApiBackend
 
@@ -109,6 +112,10 @@ func New(sctx *node.ServiceContext, config *Config) (*GoChain, error) {
 	if err != nil {
 		return nil, err
 	}
+	// Finish an interrupted state pruning before anything is written
+	if _, err := pruner.RecoverPruning(chainDb, sctx.ResolvePath(pruner.BloomFileName)); err != nil {
+		return nil, err
+	}
 
 	stopDbUpgrade := func() error { return nil } // upgradeDeduplicateData(chainDb)
 
@@ -141,6 +148,9 @@ func New(sctx *node.ServiceContext, config *Config) (*GoChain, error) {
 		bloomRequests:  make(chan chan *bloombits.Retrieval),
 		bloomIndexer:   NewBloomIndexer(chainDb, params.BloomBitsBlocks),
 	}
+	if config.LogIndex {
+		eth.logIndexer = logindex.NewIndexer(chainDb, params.LogIndexBlocks)
+	}
 
 	bcVersion := rawdb.ReadDatabaseVersion(chainDb.GlobalTable())
 	var dbVer = "<nil>"
@@ -160,7 +170,7 @@ func New(sctx *node.ServiceContext, config *Config) (*GoChain, error) {
 	}
 	var (
 		vmConfig    = vm.Config{EnablePreimageRecording: config.EnablePreimageRecording}
-		cacheConfig = &core.CacheConfig{Disabled: config.NoPruning, TrieNodeLimit: config.TrieCache, TrieTimeLimit: config.TrieTimeout}
+		cacheConfig = &core.CacheConfig{Disabled: config.NoPruning, TrieCleanLimit: config.TrieCleanCache, TrieNodeLimit: config.TrieCache, TrieTimeLimit: config.TrieTimeout, Snapshot: config.Snapshot, Witnesses: config.Witnesses, StateDiffs: config.StateDiffs, HistoryBlocks: config.HistoryBlocks, NoPrefetch: config.NoPrefetch}
 	)
 	eth.blockchain, err = core.NewBlockChain(chainDb, cacheConfig, eth.chainConfig, eth.engine, vmConfig)
 	if err != nil {
@@ -175,15 +185,22 @@ func New(sctx *node.ServiceContext, config *Config) (*GoChain, error) {
 		rawdb.WriteChainConfig(chainDb.GlobalTable(), genesisHash, chainConfig)
 	}
 	eth.bloomIndexer.Start(eth.blockchain)
+	if eth.logIndexer != nil {
+		eth.logIndexer.Start(eth.blockchain)
+	}
 
 	if config.TxPool.Journal != "" {
 		config.TxPool.Journal = sctx.ResolvePath(config.TxPool.Journal)
 	}
+	if config.TxPool.Snapshot != "" {
+		config.TxPool.Snapshot = sctx.ResolvePath(config.TxPool.Snapshot)
+	}
 	eth.txPool = core.NewTxPool(config.TxPool, eth.chainConfig, eth.blockchain)
 
 	if eth.protocolManager, err = NewProtocolManager(eth.chainConfig, config.SyncMode, config.NetworkId, eth.eventMux, eth.txPool, eth.engine, eth.blockchain, chainDb); err != nil {
 		return nil, err
 	}
+	eth.protocolManager.SetPrivatePeers(config.PrivateTxPeers)
 	eth.miner = miner.New(eth, eth.chainConfig, eth.EventMux(), eth.engine, config.MinerRecommit, config.MinerGasFloor, config.MinerGasCeil, eth.isLocalBlock)
 	if err := eth.miner.SetExtra(makeExtraData(config.MinerExtraData)); err != nil {
 		log.Error("Cannot set extra chain data", "err", err)
@@ -252,6 +269,11 @@ func (gc *GoChain) APIs() []rpc.API {
 			Version:   "1.0",
 			Service:   NewPublicMinerAPI(gc),
 			Public:    true,
+		}, {
+			Namespace: "eth",
+			Version:   "1.0",
+			Service:   NewPublicBundleAPI(gc),
+			Public:    true,
 		}, {
 			Namespace: "eth",
 			Version:   "1.0",
@@ -265,7 +287,7 @@ func (gc *GoChain) APIs() []rpc.API {
 		}, {
 			Namespace: "eth",
 			Version:   "1.0",
-			Service:   filters.NewPublicFilterAPI(gc.ApiBackend, false),
+			Service:   filters.NewPublicFilterAPI(gc.ApiBackend, false, gc.config.Logs),
 			Public:    true,
 		}, {
 			Namespace: "admin",
@@ -468,6 +490,9 @@ func (gc *GoChain) Start(srvr *p2p.Server) error {
 // GoChain protocol.
 func (gc *GoChain) Stop() error {
 	gc.bloomIndexer.Close()
+	if gc.logIndexer != nil {
+		gc.logIndexer.Close()
+	}
 	gc.blockchain.Stop()
 	gc.protocolManager.Stop()
 	if gc.lesServer != nil {
@@ -24,7 +24,9 @@ import (
 	"github.com/zeus-fyi/gochain/v4/common/hexutil"
 	"github.com/zeus-fyi/gochain/v4/core"
 	"github.com/zeus-fyi/gochain/v4/eth/downloader"
+	"github.com/zeus-fyi/gochain/v4/eth/filters"
 	"github.com/zeus-fyi/gochain/v4/eth/gasprice"
+	"github.com/zeus-fyi/gochain/v4/p2p/discover"
 	"github.com/zeus-fyi/gochain/v4/params"
 )
 
@@ -47,6 +49,7 @@ var DefaultConfig = Config{
 		Percentile: 60,
 		MaxPrice:   gasprice.DefaultMaxPrice,
 	},
+	Logs: filters.DefaultConfig,
 }
 
 //go:generate gencodec -type Config -field-override configMarshaling -formats toml -out gen_config.go
@@ -57,9 +60,17 @@ type Config struct {
 	Genesis *core.Genesis `toml:",omitempty"`
 
 	// Protocol options
-	NetworkId uint64 // Network ID to use for selecting peers to connect to
-	SyncMode  downloader.SyncMode
-	NoPruning bool
+	NetworkId  uint64 // Network ID to use for selecting peers to connect to
+	SyncMode   downloader.SyncMode
+	NoPruning  bool
+	Snapshot   bool // Whether to maintain a flat state snapshot
+	Witnesses  bool // Whether to record the execution witness of every imported block
+	StateDiffs bool // Whether to record the state diff of every imported block
+	LogIndex   bool // Whether to build an exact log index for eth_getLogs
+
+	// Number of recent blocks whose state is kept readable through reverse
+	// diffs, without keeping their tries (0 = disabled)
+	HistoryBlocks uint64
 
 	// Light client options
 	LightServ  int `toml:",omitempty"` // Maximum percentage of time allowed for serving LES requests
@@ -69,8 +80,10 @@ type Config struct {
 	SkipBcVersionCheck bool `toml:"-"`
 	DatabaseHandles    int  `toml:"-"`
 	DatabaseCache      int
+	TrieCleanCache     int
 	TrieCache          int
 	TrieTimeout        time.Duration
+	NoPrefetch         bool // Whether to disable speculative execution of the next block during import
 
 	// Mining-related options
 	Etherbase      common.Address `toml:",omitempty"`
@@ -83,11 +96,15 @@ type Config struct {
 	MinerNoverify  bool
 
 	// Transaction pool options
-	TxPool core.TxPoolConfig
+	TxPool         core.TxPoolConfig
+	PrivateTxPeers []discover.NodeID `toml:",omitempty"` // Peers private transactions are forwarded to
 
 	// Gas Price Oracle options
 	GPO gasprice.Config
 
+	// Log query limits of the filter API
+	Logs filters.Config
+
 	// Enables tracking of SHA3 preimages in the VM
 	EnablePreimageRecording bool
 
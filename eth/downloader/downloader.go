@@ -30,6 +30,7 @@ import (
 	"github.com/zeus-fyi/gochain/v4/core"
 	"github.com/zeus-fyi/gochain/v4/core/rawdb"
 	"github.com/zeus-fyi/gochain/v4/core/types"
+	"github.com/zeus-fyi/gochain/v4/eth/snap"
 	"github.com/zeus-fyi/gochain/v4/log"
 	"github.com/zeus-fyi/gochain/v4/metrics"
 	"github.com/zeus-fyi/gochain/v4/params"
@@ -95,14 +96,18 @@ var (
 )
 
 type Downloader struct {
-	mode SyncMode            // Synchronisation mode defining the strategy used (per sync cycle)
-	mux  *core.InterfaceFeed // Event multiplexer to announce sync operation events
+	mode     SyncMode // Synchronisation mode defining the strategy used (per sync cycle)
+	snapSync bool     // Whether the state of a fast sync is downloaded by ranges first (per sync cycle)
+
+	mux *core.InterfaceFeed // Event multiplexer to announce sync operation events
 
 	genesis uint64   // Genesis block number to limit sync to (e.g. light client CHT)
 	queue   *queue   // Scheduler for selecting the hashes to download
 	peers   *peerSet // Set of active peers from which download can proceed
 	stateDB common.Database
 
+	SnapSyncer *snap.Syncer // Range based state downloader used in snap sync
+
 	rttEstimate   uint64 // Round trip time to target for download requests
 	rttConfidence uint64 // Confidence in the estimated RTT (unit: millionths to allow atomic ops)
 
@@ -209,6 +214,7 @@ func New(mode SyncMode, stateDb common.Database, mux *core.InterfaceFeed, chain
 	dl := &Downloader{
 		mode:           mode,
 		stateDB:        stateDb,
+		SnapSyncer:     snap.NewSyncer(stateDb),
 		mux:            mux,
 		queue:          newQueue(),
 		peers:          newPeerSet(),
@@ -391,7 +397,12 @@ func (d *Downloader) synchronise(id string, hash common.Hash, td *big.Int, mode
 
 	defer d.Cancel() // No matter what, we can't leave the cancel channel open
 
-	// Set the requested sync mode, unless it's forbidden
+	// Set the requested sync mode, unless it's forbidden. Snap sync is a fast
+	// sync with a different state download.
+	d.snapSync = mode == SnapSync
+	if d.snapSync {
+		mode = FastSync
+	}
 	d.mode = mode
 
 	// Retrieve the origin peer and initiate the downloading process
@@ -551,7 +562,7 @@ func (d *Downloader) fetchHeight(p *peerConnection) (*types.Header, error) {
 
 	// Request the advertised remote head block and wait for the response
 	head, _ := p.peer.Head()
-	go p.peer.RequestHeadersByHash(head, 1, 0, false)
+	go p.request(headerKind).RequestHeadersByHash(head, 1, 0, false)
 
 	ttl := d.requestTTL()
 	timeout := time.After(ttl)
@@ -621,7 +632,7 @@ func (d *Downloader) findAncestor(p *peerConnection, height uint64) (uint64, err
 	if count > limit {
 		count = limit
 	}
-	go p.peer.RequestHeadersByNumber(uint64(from), count, 15, false)
+	go p.request(headerKind).RequestHeadersByNumber(uint64(from), count, 15, false)
 
 	// Wait for the remote response to the head fetch
 	number, hash := uint64(0), common.Hash{}
@@ -705,7 +716,7 @@ func (d *Downloader) findAncestor(p *peerConnection, height uint64) (uint64, err
 		ttl := d.requestTTL()
 		timeout := time.After(ttl)
 
-		go p.peer.RequestHeadersByNumber(check, 1, 0, false)
+		go p.request(headerKind).RequestHeadersByNumber(check, 1, 0, false)
 
 		// Wait until a reply arrives to this request
 		for arrived := false; !arrived; {
@@ -788,10 +799,10 @@ func (d *Downloader) fetchHeaders(p *peerConnection, from uint64, pivot uint64)
 
 		if skeleton {
 			p.log.Info("Fetching skeleton headers", "count", MaxHeaderFetch, "from", from)
-			go p.peer.RequestHeadersByNumber(from+uint64(MaxHeaderFetch)-1, MaxSkeletonSize, MaxHeaderFetch-1, false)
+			go p.request(headerKind).RequestHeadersByNumber(from+uint64(MaxHeaderFetch)-1, MaxSkeletonSize, MaxHeaderFetch-1, false)
 		} else {
 			p.log.Info("Fetching full headers", "count", MaxHeaderFetch, "from", from)
-			go p.peer.RequestHeadersByNumber(from, MaxHeaderFetch, 0, false)
+			go p.request(headerKind).RequestHeadersByNumber(from, MaxHeaderFetch, 0, false)
 		}
 	}
 	// Start pulling the header chain skeleton until all is done
@@ -1566,28 +1577,30 @@ func (d *Downloader) commitPivotBlock(result *fetchResult) error {
 }
 
 // DeliverHeaders injects a new batch of block headers received from a remote
-// node into the download schedule.
-func (d *Downloader) DeliverHeaders(id string, headers []*types.Header) (err error) {
-	return d.deliver(id, d.headerCh, &headerPack{id, headers}, headerInMeter, headerDropMeter)
+// node into the download schedule. The request id is the one echoed by the
+// response if the peer tags its requests, and is ignored otherwise.
+func (d *Downloader) DeliverHeaders(id string, reqID uint64, headers []*types.Header) (err error) {
+	return d.deliver(id, headerKind, reqID, d.headerCh, &headerPack{id, headers}, headerInMeter, headerDropMeter)
 }
 
 // DeliverBodies injects a new batch of block bodies received from a remote node.
-func (d *Downloader) DeliverBodies(id string, transactions [][]*types.Transaction) (err error) {
-	return d.deliver(id, d.bodyCh, &bodyPack{id, transactions}, bodyInMeter, bodyDropMeter)
+func (d *Downloader) DeliverBodies(id string, reqID uint64, transactions [][]*types.Transaction) (err error) {
+	return d.deliver(id, bodyKind, reqID, d.bodyCh, &bodyPack{id, transactions}, bodyInMeter, bodyDropMeter)
 }
 
 // DeliverReceipts injects a new batch of receipts received from a remote node.
-func (d *Downloader) DeliverReceipts(id string, receipts [][]*types.Receipt) (err error) {
-	return d.deliver(id, d.receiptCh, &receiptPack{id, receipts}, receiptInMeter, receiptDropMeter)
+func (d *Downloader) DeliverReceipts(id string, reqID uint64, receipts [][]*types.Receipt) (err error) {
+	return d.deliver(id, receiptKind, reqID, d.receiptCh, &receiptPack{id, receipts}, receiptInMeter, receiptDropMeter)
 }
 
 // DeliverNodeData injects a new batch of node state data received from a remote node.
-func (d *Downloader) DeliverNodeData(id string, data [][]byte) (err error) {
-	return d.deliver(id, d.stateCh, &statePack{id, data}, stateInMeter, stateDropMeter)
+func (d *Downloader) DeliverNodeData(id string, reqID uint64, data [][]byte) (err error) {
+	return d.deliver(id, stateKind, reqID, d.stateCh, &statePack{id, data}, stateInMeter, stateDropMeter)
 }
 
-// deliver injects a new batch of data received from a remote node.
-func (d *Downloader) deliver(id string, destCh chan dataPack, packet dataPack, inMeter, dropMeter metrics.Meter) (err error) {
+// deliver injects a new batch of data received from a remote node, in response
+// to the request of the given kind and id.
+func (d *Downloader) deliver(id string, kind int, reqID uint64, destCh chan dataPack, packet dataPack, inMeter, dropMeter metrics.Meter) (err error) {
 	// Update the delivery metrics for both good and failed deliveries
 	inMeter.Mark(int64(packet.Items()))
 	defer func() {
@@ -1595,6 +1608,10 @@ func (d *Downloader) deliver(id string, destCh chan dataPack, packet dataPack, i
 			dropMeter.Mark(int64(packet.Items()))
 		}
 	}()
+	// Drop responses to requests superseded since, such as after a timeout
+	if p := d.peers.Peer(id); p != nil && !p.awaits(kind, reqID) {
+		return errStaleDelivery
+	}
 	// Deliver or abort if the sync is canceled while queuing
 	d.cancelLock.RLock()
 	cancel := d.cancelCh
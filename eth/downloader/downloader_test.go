@@ -501,7 +501,7 @@ func (dlp *downloadTesterPeer) RequestHeadersByNumber(origin uint64, amount int,
 	// Delay delivery a bit to allow attacks to unfold
 	go func() {
 		time.Sleep(time.Millisecond)
-		dlp.dl.downloader.DeliverHeaders(dlp.id, result)
+		dlp.dl.downloader.DeliverHeaders(dlp.id, 0, result)
 	}()
 	return nil
 }
@@ -522,7 +522,7 @@ func (dlp *downloadTesterPeer) RequestBodies(hashes []common.Hash) error {
 			transactions = append(transactions, block.Transactions())
 		}
 	}
-	go dlp.dl.downloader.DeliverBodies(dlp.id, transactions)
+	go dlp.dl.downloader.DeliverBodies(dlp.id, 0, transactions)
 
 	return nil
 }
@@ -542,7 +542,7 @@ func (dlp *downloadTesterPeer) RequestReceipts(hashes []common.Hash) error {
 			results = append(results, receipt)
 		}
 	}
-	go dlp.dl.downloader.DeliverReceipts(dlp.id, results)
+	go dlp.dl.downloader.DeliverReceipts(dlp.id, 0, results)
 
 	return nil
 }
@@ -562,7 +562,7 @@ func (dlp *downloadTesterPeer) RequestNodeData(hashes []common.Hash) error {
 			}
 		}
 	}
-	go dlp.dl.downloader.DeliverNodeData(dlp.id, results)
+	go dlp.dl.downloader.DeliverNodeData(dlp.id, 0, results)
 
 	return nil
 }
@@ -631,6 +631,8 @@ func TestCanonicalSynchronisation64Fast(t *testing.T) { testCanonicalSynchronisa
 func TestCanonicalSynchronisation64Light(t *testing.T) {
 	testCanonicalSynchronisation(t, 64, LightSync)
 }
+func TestCanonicalSynchronisation66Full(t *testing.T) { testCanonicalSynchronisation(t, 66, FullSync) }
+func TestCanonicalSynchronisation66Fast(t *testing.T) { testCanonicalSynchronisation(t, 66, FastSync) }
 
 func testCanonicalSynchronisation(t *testing.T, protocol int, mode SyncMode) {
 	t.Parallel()
@@ -883,10 +885,10 @@ func TestInactiveDownloader62(t *testing.T) {
 	defer tester.terminate()
 
 	// Check that neither block headers nor bodies are accepted
-	if err := tester.downloader.DeliverHeaders("bad peer", []*types.Header{}); err != errNoSyncActive {
+	if err := tester.downloader.DeliverHeaders("bad peer", 0, []*types.Header{}); err != errNoSyncActive {
 		t.Errorf("error mismatch: have %v, want %v", err, errNoSyncActive)
 	}
-	if err := tester.downloader.DeliverBodies("bad peer", [][]*types.Transaction{}); err != errNoSyncActive {
+	if err := tester.downloader.DeliverBodies("bad peer", 0, [][]*types.Transaction{}); err != errNoSyncActive {
 		t.Errorf("error mismatch: have %v, want %v", err, errNoSyncActive)
 	}
 }
@@ -900,13 +902,13 @@ func TestInactiveDownloader63(t *testing.T) {
 	defer tester.terminate()
 
 	// Check that neither block headers nor bodies are accepted
-	if err := tester.downloader.DeliverHeaders("bad peer", []*types.Header{}); err != errNoSyncActive {
+	if err := tester.downloader.DeliverHeaders("bad peer", 0, []*types.Header{}); err != errNoSyncActive {
 		t.Errorf("error mismatch: have %v, want %v", err, errNoSyncActive)
 	}
-	if err := tester.downloader.DeliverBodies("bad peer", [][]*types.Transaction{}); err != errNoSyncActive {
+	if err := tester.downloader.DeliverBodies("bad peer", 0, [][]*types.Transaction{}); err != errNoSyncActive {
 		t.Errorf("error mismatch: have %v, want %v", err, errNoSyncActive)
 	}
-	if err := tester.downloader.DeliverReceipts("bad peer", [][]*types.Receipt{}); err != errNoSyncActive {
+	if err := tester.downloader.DeliverReceipts("bad peer", 0, [][]*types.Receipt{}); err != errNoSyncActive {
 		t.Errorf("error mismatch: have %v, want %v", err, errNoSyncActive)
 	}
 }
@@ -1667,7 +1669,7 @@ func (ftp *floodingTestPeer) RequestHeadersByNumber(from uint64, count, skip int
 		peer := fmt.Sprintf("fake-peer%d", i)
 		go func() {
 			defer ftp.pend.Done()
-			ftp.tester.downloader.DeliverHeaders(peer, []*types.Header{{}, {}, {}, {}})
+			ftp.tester.downloader.DeliverHeaders(peer, 0, []*types.Header{{}, {}, {}, {}})
 			deliveriesDone <- struct{}{}
 		}()
 	}
@@ -1713,3 +1715,47 @@ func testDeliverHeadersHang(t *testing.T, protocol int, mode SyncMode) {
 		testPeer.pend.Wait()
 	}
 }
+
+// taggedTesterPeer is a peer tagging its requests with increasing ids, without
+// ever answering them.
+type taggedTesterPeer struct {
+	id uint64
+}
+
+func (p *taggedTesterPeer) Head() (common.Hash, *big.Int)                          { return common.Hash{}, new(big.Int) }
+func (p *taggedTesterPeer) RequestHeadersByHash(common.Hash, int, int, bool) error { return nil }
+func (p *taggedTesterPeer) RequestHeadersByNumber(uint64, int, int, bool) error    { return nil }
+func (p *taggedTesterPeer) RequestBodies([]common.Hash) error                      { return nil }
+func (p *taggedTesterPeer) RequestReceipts([]common.Hash) error                    { return nil }
+func (p *taggedTesterPeer) RequestNodeData([]common.Hash) error                    { return nil }
+func (p *taggedTesterPeer) Tag() (Peer, uint64)                                    { return p, atomic.AddUint64(&p.id, 1) }
+
+// Tests that deliveries from peers tagging their requests are only accepted in
+// response to the last request of their kind.
+func TestTaggedDeliveries(t *testing.T) {
+	t.Parallel()
+
+	tester := newTester()
+	defer tester.terminate()
+
+	if err := tester.downloader.RegisterPeer("tagged", 63, new(taggedTesterPeer)); err != nil {
+		t.Fatalf("failed to register peer: %v", err)
+	}
+	p := tester.downloader.peers.Peer("tagged")
+	for i := 0; i < 2; i++ {
+		if err := p.FetchBodies(&fetchRequest{}); err != nil {
+			t.Fatalf("body request %d failed: %v", i, err)
+		}
+		p.SetBodiesIdle(0)
+	}
+	// Only the response to the second body request is awaited, and sync is off
+	if err := tester.downloader.DeliverBodies("tagged", 1, nil); err != errStaleDelivery {
+		t.Errorf("superseded response: have %v, want %v", err, errStaleDelivery)
+	}
+	if err := tester.downloader.DeliverBodies("tagged", 2, nil); err != errNoSyncActive {
+		t.Errorf("awaited response: have %v, want %v", err, errNoSyncActive)
+	}
+	if err := tester.downloader.DeliverReceipts("tagged", 2, nil); err != errStaleDelivery {
+		t.Errorf("response of another kind: have %v, want %v", err, errStaleDelivery)
+	}
+}
@@ -87,7 +87,7 @@ func (p *FakePeer) RequestHeadersByHash(hash common.Hash, amount int, skip int,
 			}
 		}
 	}
-	p.dl.DeliverHeaders(p.id, headers)
+	p.dl.DeliverHeaders(p.id, 0, headers)
 	return nil
 }
 
@@ -114,7 +114,7 @@ func (p *FakePeer) RequestHeadersByNumber(number uint64, amount int, skip int, r
 		}
 		headers = append(headers, origin)
 	}
-	p.dl.DeliverHeaders(p.id, headers)
+	p.dl.DeliverHeaders(p.id, 0, headers)
 	return nil
 }
 
@@ -127,7 +127,7 @@ func (p *FakePeer) RequestBodies(hashes []common.Hash) error {
 
 		txs = append(txs, block.Transactions())
 	}
-	p.dl.DeliverBodies(p.id, txs)
+	p.dl.DeliverBodies(p.id, 0, txs)
 	return nil
 }
 
@@ -138,7 +138,7 @@ func (p *FakePeer) RequestReceipts(hashes []common.Hash) error {
 	for _, hash := range hashes {
 		receipts = append(receipts, rawdb.ReadRawReceipts(p.db.ReceiptTable(), hash, *p.hc.GetBlockNumber(hash)))
 	}
-	p.dl.DeliverReceipts(p.id, receipts)
+	p.dl.DeliverReceipts(p.id, 0, receipts)
 	return nil
 }
 
@@ -151,6 +151,6 @@ func (p *FakePeer) RequestNodeData(hashes []common.Hash) error {
 			data = append(data, entry)
 		}
 	}
-	p.dl.DeliverNodeData(p.id, data)
+	p.dl.DeliverNodeData(p.id, 0, data)
 	return nil
 }
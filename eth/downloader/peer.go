@@ -67,6 +67,8 @@ type peerConnection struct {
 
 	lacking map[common.Hash]struct{} // Set of hashes not to request (didn't have previously)
 
+	awaited [reqKinds]uint64 // Ids of the last requests of each kind sent to a tagging peer
+
 	peer Peer
 
 	version int        // Eth protocol version number to switch strategies
@@ -89,6 +91,25 @@ type Peer interface {
 	RequestNodeData([]common.Hash) error
 }
 
+// TaggedPeer is implemented by peers whose requests carry an id which their
+// responses echo, such as over eth/66. Of such a peer, the downloader only
+// accepts the response to the last request of each kind it sent.
+type TaggedPeer interface {
+	Peer
+
+	// Tag returns the peer sending its requests under a fresh id, and the id.
+	Tag() (Peer, uint64)
+}
+
+// Kinds of requests whose ids are awaited separately.
+const (
+	headerKind = iota
+	bodyKind
+	receiptKind
+	stateKind
+	reqKinds
+)
+
 // lightPeerWrapper wraps a LightPeer struct, stubbing out the Peer-only methods.
 type lightPeerWrapper struct {
 	peer LightPeer
@@ -142,6 +163,27 @@ func (p *peerConnection) Reset() {
 	p.lacking = make(map[common.Hash]struct{})
 }
 
+// request returns the peer to send a request of the given kind through. If the
+// peer tags its requests, the id of the request is recorded as awaited.
+func (p *peerConnection) request(kind int) Peer {
+	tagged, ok := p.peer.(TaggedPeer)
+	if !ok {
+		return p.peer
+	}
+	peer, id := tagged.Tag()
+	atomic.StoreUint64(&p.awaited[kind], id)
+	return peer
+}
+
+// awaits reports whether a response of the given kind and request id answers
+// the last request of its kind, which always holds if the peer doesn't tag.
+func (p *peerConnection) awaits(kind int, id uint64) bool {
+	if _, ok := p.peer.(TaggedPeer); !ok {
+		return true
+	}
+	return atomic.LoadUint64(&p.awaited[kind]) == id
+}
+
 // FetchHeaders sends a header retrieval request to the remote peer.
 func (p *peerConnection) FetchHeaders(from uint64, count int) error {
 	// Sanity check the protocol version
@@ -155,7 +197,7 @@ func (p *peerConnection) FetchHeaders(from uint64, count int) error {
 	p.headerStarted = time.Now()
 
 	// Issue the header retrieval request (absolut upwards without gaps)
-	go p.peer.RequestHeadersByNumber(from, count, 0, false)
+	go p.request(headerKind).RequestHeadersByNumber(from, count, 0, false)
 
 	return nil
 }
@@ -177,7 +219,7 @@ func (p *peerConnection) FetchBodies(request *fetchRequest) error {
 	for _, header := range request.Headers {
 		hashes = append(hashes, header.Hash())
 	}
-	go p.peer.RequestBodies(hashes)
+	go p.request(bodyKind).RequestBodies(hashes)
 
 	return nil
 }
@@ -199,7 +241,7 @@ func (p *peerConnection) FetchReceipts(request *fetchRequest) error {
 	for _, header := range request.Headers {
 		hashes = append(hashes, header.Hash())
 	}
-	go p.peer.RequestReceipts(hashes)
+	go p.request(receiptKind).RequestReceipts(hashes)
 
 	return nil
 }
@@ -216,7 +258,7 @@ func (p *peerConnection) FetchNodeData(hashes []common.Hash) error {
 	}
 	p.stateStarted = time.Now()
 
-	go p.peer.RequestNodeData(hashes)
+	go p.request(stateKind).RequestNodeData(hashes)
 
 	return nil
 }
@@ -484,7 +526,7 @@ func (ps *peerSet) HeaderIdlePeers() ([]*peerConnection, int) {
 		defer p.lock.RUnlock()
 		return p.headerThroughput
 	}
-	return ps.idlePeers(62, 64, idle, throughput)
+	return ps.idlePeers(62, 66, idle, throughput)
 }
 
 // BodyIdlePeers retrieves a flat list of all the currently body-idle peers within
@@ -498,7 +540,7 @@ func (ps *peerSet) BodyIdlePeers() ([]*peerConnection, int) {
 		defer p.lock.RUnlock()
 		return p.blockThroughput
 	}
-	return ps.idlePeers(62, 64, idle, throughput)
+	return ps.idlePeers(62, 66, idle, throughput)
 }
 
 // ReceiptIdlePeers retrieves a flat list of all the currently receipt-idle peers
@@ -512,7 +554,7 @@ func (ps *peerSet) ReceiptIdlePeers() ([]*peerConnection, int) {
 		defer p.lock.RUnlock()
 		return p.receiptThroughput
 	}
-	return ps.idlePeers(63, 64, idle, throughput)
+	return ps.idlePeers(63, 66, idle, throughput)
 }
 
 // NodeDataIdlePeers retrieves a flat list of all the currently node-data-idle
@@ -526,7 +568,7 @@ func (ps *peerSet) NodeDataIdlePeers() ([]*peerConnection, int) {
 		defer p.lock.RUnlock()
 		return p.stateThroughput
 	}
-	return ps.idlePeers(63, 64, idle, throughput)
+	return ps.idlePeers(63, 66, idle, throughput)
 }
 
 // idlePeers retrieves a flat list of all currently idle peers satisfying the
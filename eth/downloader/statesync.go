@@ -27,6 +27,7 @@ import (
 	"github.com/zeus-fyi/gochain/v4/common"
 	"github.com/zeus-fyi/gochain/v4/core/rawdb"
 	"github.com/zeus-fyi/gochain/v4/core/state"
+	"github.com/zeus-fyi/gochain/v4/eth/snap"
 	"github.com/zeus-fyi/gochain/v4/ethdb"
 	"github.com/zeus-fyi/gochain/v4/log"
 	"github.com/zeus-fyi/gochain/v4/trie"
@@ -213,7 +214,8 @@ func (d *Downloader) runStateSync(s *stateSync) *stateSync {
 // stateSync schedules requests for downloading a particular state trie defined
 // by a given state root.
 type stateSync struct {
-	d *Downloader // Downloader instance to access and manage current peerset
+	d    *Downloader // Downloader instance to access and manage current peerset
+	root common.Hash // State root being synced
 
 	sched  *trie.Sync                 // State trie sync scheduler defining the tasks
 	keccak hash.Hash                  // Keccak256 hasher to verify deliveries with
@@ -240,6 +242,7 @@ type stateTask struct {
 func newStateSync(d *Downloader, root common.Hash) *stateSync {
 	return &stateSync{
 		d:       d,
+		root:    root,
 		sched:   state.NewStateSync(root, d.stateDB.GlobalTable()),
 		keccak:  sha3.NewLegacyKeccak256(),
 		tasks:   make(map[common.Hash]*stateTask),
@@ -253,10 +256,47 @@ func newStateSync(d *Downloader, root common.Hash) *stateSync {
 // it finishes, and finally notifying any goroutines waiting for the loop to
 // finish.
 func (s *stateSync) run() {
+	if s.d.snapSync {
+		if err := s.snapSync(); err == snap.ErrCancelled {
+			s.err = errCancelStateFetch
+			close(s.done)
+			return
+		} else if err != nil {
+			log.Warn("Snap state sync failed, falling back to trie sync", "err", err)
+		}
+		// Reschedule the trie sync to only heal the nodes still missing
+		s.sched = state.NewStateSync(s.root, s.d.stateDB.GlobalTable())
+	}
 	s.err = s.loop()
 	close(s.done)
 }
 
+// snapSync downloads the state by ranges from snap peers until done, failed or
+// canceled. The trie sync then heals the state.
+func (s *stateSync) snapSync() error {
+	var (
+		abort = make(chan struct{})
+		done  = make(chan struct{})
+	)
+	defer close(done)
+
+	s.d.cancelLock.RLock()
+	cancel := s.d.cancelCh
+	s.d.cancelLock.RUnlock()
+
+	go func() {
+		select {
+		case <-s.cancel:
+		case <-cancel:
+		case <-s.d.quitCh:
+		case <-done:
+			return
+		}
+		close(abort)
+	}()
+	return s.d.SnapSyncer.Sync(s.root, abort)
+}
+
 // Wait blocks until the sync is done or canceled.
 func (s *stateSync) Wait() error {
 	<-s.done
@@ -0,0 +1,43 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"github.com/zeus-fyi/gochain/v4/core/forkid"
+	"github.com/zeus-fyi/gochain/v4/p2p/enr"
+	"github.com/zeus-fyi/gochain/v4/rlp"
+)
+
+// enrEntry is the ENR entry which advertises the eth protocol on the discovery
+// network.
+type enrEntry struct {
+	ForkID forkid.ID // Fork identifier per EIP-2124
+
+	// Ignore additional fields (for forward compatibility).
+	Rest []rlp.RawValue `rlp:"tail"`
+}
+
+// ENRKey implements enr.Entry.
+func (e enrEntry) ENRKey() string {
+	return "eth"
+}
+
+// enrEntries returns the entries of the node record advertising the eth
+// protocol, based on the current state of the chain.
+func (pm *ProtocolManager) enrEntries() []enr.Entry {
+	return []enr.Entry{&enrEntry{ForkID: forkid.NewIDWithChain(pm.blockchain)}}
+}
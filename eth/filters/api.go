@@ -51,6 +51,7 @@ type filter struct {
 // information related to the Ethereum protocol such als blocks, transactions and logs.
 type PublicFilterAPI struct {
 	backend   Backend
+	config    Config
 	quit      chan struct{}
 	chainDb   common.Database
 	events    *EventSystem
@@ -58,10 +59,12 @@ type PublicFilterAPI struct {
 	filters   map[rpc.ID]*filter
 }
 
-// NewPublicFilterAPI returns a new PublicFilterAPI instance.
-func NewPublicFilterAPI(backend Backend, lightMode bool) *PublicFilterAPI {
+// NewPublicFilterAPI returns a new PublicFilterAPI instance, bounding log
+// queries by the given config.
+func NewPublicFilterAPI(backend Backend, lightMode bool, config Config) *PublicFilterAPI {
 	api := &PublicFilterAPI{
 		backend: backend,
+		config:  config,
 		chainDb: backend.ChainDb(),
 		events:  NewEventSystem(backend, lightMode),
 		filters: make(map[rpc.ID]*filter),
@@ -320,29 +323,175 @@ func (api *PublicFilterAPI) NewFilter(crit FilterCriteria) (rpc.ID, error) {
 //
 // https://github.com/ethereum/wiki/wiki/JSON-RPC#eth_getlogs
 func (api *PublicFilterAPI) GetLogs(ctx context.Context, crit FilterCriteria) ([]*types.Log, error) {
-	var filter *Filter
+	return GetLogs(ctx, api.backend, api.config, crit)
+}
+
+// GetLogs returns the logs matching the given criteria, failing queries that
+// exceed the limits of the config.
+func GetLogs(ctx context.Context, backend Backend, config Config, crit FilterCriteria) ([]*types.Log, error) {
+	filter, err := newLogFilter(ctx, backend, config, crit)
+	if err != nil {
+		return nil, err
+	}
+	// Run the filter and return all the logs
+	logs, err := filter.Logs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResults(config, crit, logs); err != nil {
+		return nil, err
+	}
+	return returnLogs(logs), err
+}
+
+// GetLogsPaginated returns a page of at most limit logs matching the given
+// criteria, starting at the cursor returned with the previous page. The cursor
+// of the page is nil once all logs were returned.
+func (api *PublicFilterAPI) GetLogsPaginated(ctx context.Context, crit FilterCriteria, cursor *LogCursor, limit *hexutil.Uint) (*LogsPage, error) {
+	size := defaultPageSize
+	if limit != nil && *limit > 0 {
+		size = int(*limit)
+	}
+	if max := api.config.MaxResults; max > 0 && size > max {
+		size = max
+	}
+	filter, err := newLogFilter(ctx, api.backend, api.config, crit)
+	if err != nil {
+		return nil, err
+	}
+	if crit.BlockHash != nil {
+		logs, err := filter.Logs(ctx)
+		if err != nil {
+			return nil, err
+		}
+		var rest []*types.Log
+		for _, log := range logs {
+			if cursor == nil || !cursor.precedes(log) {
+				rest = append(rest, log)
+			}
+		}
+		return paginate(rest, size), nil
+	}
+	var logs []*types.Log
+	if cursor != nil {
+		if filter.begin >= 0 && int64(cursor.Block) < filter.begin {
+			return nil, errors.New("log cursor outside of the block range")
+		}
+		// Finish the block of the cursor, then carry on after it
+		first, err := NewRangeFilter(api.backend, int64(cursor.Block), int64(cursor.Block), crit.Addresses, crit.Topics).Logs(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, log := range first {
+			if !cursor.precedes(log) {
+				logs = append(logs, log)
+			}
+		}
+		if len(logs) > size {
+			return paginate(logs, size), nil
+		}
+		filter.begin = int64(cursor.Block) + 1
+	}
+	// One log beyond the page is enough to position the next cursor
+	filter.SetLimit(size - len(logs) + 1)
+	rest, err := filter.Logs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return paginate(append(logs, rest...), size), nil
+}
+
+// newLogFilter constructs the filter of a log query, checking its block range
+// against the configured limit.
+func newLogFilter(ctx context.Context, backend Backend, config Config, crit FilterCriteria) (*Filter, error) {
 	if crit.BlockHash != nil {
 		// Block filter requested, construct a single-shot filter
-		filter = NewBlockFilter(api.backend, *crit.BlockHash, crit.Addresses, crit.Topics)
-	} else {
-		// Convert the RPC block numbers into internal representations
-		begin := rpc.LatestBlockNumber.Int64()
-		if crit.FromBlock != nil {
-			begin = crit.FromBlock.Int64()
+		return NewBlockFilter(backend, *crit.BlockHash, crit.Addresses, crit.Topics), nil
+	}
+	// Convert the RPC block numbers into internal representations
+	begin := rpc.LatestBlockNumber.Int64()
+	if crit.FromBlock != nil {
+		begin = crit.FromBlock.Int64()
+	}
+	end := rpc.LatestBlockNumber.Int64()
+	if crit.ToBlock != nil {
+		end = crit.ToBlock.Int64()
+	}
+	if max := config.MaxBlockRange; max > 0 {
+		from, to := begin, end
+		if from == rpc.LatestBlockNumber.Int64() || to == rpc.LatestBlockNumber.Int64() {
+			header, err := backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
+			if err != nil {
+				return nil, err
+			}
+			if header != nil {
+				if from == rpc.LatestBlockNumber.Int64() {
+					from = header.Number.Int64()
+				}
+				if to == rpc.LatestBlockNumber.Int64() {
+					to = header.Number.Int64()
+				}
+			}
 		}
-		end := rpc.LatestBlockNumber.Int64()
-		if crit.ToBlock != nil {
-			end = crit.ToBlock.Int64()
+		if from >= 0 && to >= from && uint64(to-from) >= max {
+			return nil, &logLimitError{
+				message: fmt.Sprintf("query spans %d blocks, more than the limit of %d", to-from+1, max),
+				from:    uint64(from),
+				to:      uint64(from) + max - 1,
+				suggest: true,
+			}
 		}
-		// Construct the range filter
-		filter = NewRangeFilter(api.backend, begin, end, crit.Addresses, crit.Topics)
 	}
-	// Run the filter and return all the logs
-	logs, err := filter.Logs(ctx)
+	// Construct the range filter
+	filter := NewRangeFilter(backend, begin, end, crit.Addresses, crit.Topics)
+	filter.SetLimit(config.MaxResults)
+	return filter, nil
+}
+
+// checkResults checks the logs found by a query against the configured limit,
+// suggesting the block range of the logs within the limit.
+func checkResults(config Config, crit FilterCriteria, logs []*types.Log) error {
+	max := config.MaxResults
+	if max <= 0 || len(logs) <= max {
+		return nil
+	}
+	err := &logLimitError{
+		message: fmt.Sprintf("query returned more than %d results, narrow down the block range or use eth_getLogsPaginated", max),
+	}
+	// Suggest the blocks whose logs all fit, unless the first block has too many
+	if crit.BlockHash == nil && logs[max].BlockNumber > logs[0].BlockNumber {
+		err.from, err.to, err.suggest = logs[0].BlockNumber, logs[max].BlockNumber-1, true
+	}
+	return err
+}
+
+// LogIndexStatus is the progress of the exact log index.
+type LogIndexStatus struct {
+	Enabled       bool           `json:"enabled"`
+	SectionSize   hexutil.Uint64 `json:"sectionSize"`
+	Sections      hexutil.Uint64 `json:"sections"`
+	IndexedBlocks hexutil.Uint64 `json:"indexedBlocks"`
+	Head          hexutil.Uint64 `json:"head"`
+}
+
+// LogIndexStatus returns the progress of the exact log index, which serves
+// eth_getLogs over the indexed blocks without scanning bloom bits.
+func (api *PublicFilterAPI) LogIndexStatus(ctx context.Context) (*LogIndexStatus, error) {
+	size, sections := api.backend.LogIndexStatus()
+	status := &LogIndexStatus{
+		Enabled:       size > 0,
+		SectionSize:   hexutil.Uint64(size),
+		Sections:      hexutil.Uint64(sections),
+		IndexedBlocks: hexutil.Uint64(size * sections),
+	}
+	header, err := api.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
 	if err != nil {
 		return nil, err
 	}
-	return returnLogs(logs), err
+	if header != nil {
+		status.Head = hexutil.Uint64(header.Number.Uint64())
+	}
+	return status, nil
 }
 
 // UninstallFilter removes the filter with the given filter id.
@@ -375,28 +524,18 @@ func (api *PublicFilterAPI) GetFilterLogs(ctx context.Context, id rpc.ID) ([]*ty
 		return nil, fmt.Errorf("filter not found")
 	}
 
-	var filter *Filter
-	if f.crit.BlockHash != nil {
-		// Block filter requested, construct a single-shot filter
-		filter = NewBlockFilter(api.backend, *f.crit.BlockHash, f.crit.Addresses, f.crit.Topics)
-	} else {
-		// Convert the RPC block numbers into internal representations
-		begin := rpc.LatestBlockNumber.Int64()
-		if f.crit.FromBlock != nil {
-			begin = f.crit.FromBlock.Int64()
-		}
-		end := rpc.LatestBlockNumber.Int64()
-		if f.crit.ToBlock != nil {
-			end = f.crit.ToBlock.Int64()
-		}
-		// Construct the range filter
-		filter = NewRangeFilter(api.backend, begin, end, f.crit.Addresses, f.crit.Topics)
+	filter, err := newLogFilter(ctx, api.backend, api.config, f.crit)
+	if err != nil {
+		return nil, err
 	}
 	// Run the filter and return all the logs
 	logs, err := filter.Logs(ctx)
 	if err != nil {
 		return nil, err
 	}
+	if err := checkResults(api.config, f.crit, logs); err != nil {
+		return nil, err
+	}
 	return returnLogs(logs), nil
 }
 
@@ -24,6 +24,8 @@ import (
 	"github.com/zeus-fyi/gochain/v4/common"
 	"github.com/zeus-fyi/gochain/v4/core"
 	"github.com/zeus-fyi/gochain/v4/core/bloombits"
+	"github.com/zeus-fyi/gochain/v4/core/logindex"
+	"github.com/zeus-fyi/gochain/v4/core/rawdb"
 	"github.com/zeus-fyi/gochain/v4/core/types"
 	"github.com/zeus-fyi/gochain/v4/rpc"
 )
@@ -47,6 +49,7 @@ type Backend interface {
 	UnsubscribePendingLogsEvent(ch chan<- core.PendingLogsEvent)
 
 	BloomStatus() (uint64, uint64)
+	LogIndexStatus() (uint64, uint64)
 	ServiceFilter(ctx context.Context, session *bloombits.MatcherSession)
 }
 
@@ -60,6 +63,7 @@ type Filter struct {
 
 	block      common.Hash // Block hash if filtering a single block
 	begin, end int64       // Range interval if filtering multiple blocks
+	limit      int         // Number of logs after which to stop searching (0 = unlimited)
 
 	matcher *bloombits.Matcher
 }
@@ -106,6 +110,18 @@ func NewBlockFilter(backend Backend, block common.Hash, addresses []common.Addre
 	return filter
 }
 
+// SetLimit makes the filter stop searching once more than limit logs were found.
+// The logs of the last block searched are always returned in full, so the
+// start of the filter is left at the first block not searched.
+func (f *Filter) SetLimit(limit int) {
+	f.limit = limit
+}
+
+// full reports whether the limit of the filter is exceeded by the logs found.
+func (f *Filter) full(logs []*types.Log) bool {
+	return f.limit > 0 && len(logs) > f.limit
+}
+
 // newFilter creates a generic filter that can either filter based on a block hash,
 // or based on range queries. The search criteria needs to be explicitly set.
 func newFilter(backend Backend, addresses []common.Address, topics [][]common.Hash) *Filter {
@@ -150,39 +166,111 @@ func (f *Filter) Logs(ctx context.Context) ([]*types.Log, error) {
 		logs []*types.Log
 		err  error
 	)
+	if logindex.Indexable(f.addresses, f.topics) {
+		if logs, err = f.exactLogs(ctx, end, logs); err != nil || f.full(logs) {
+			return logs, err
+		}
+	}
 	size, sections := f.backend.BloomStatus()
-	if indexed := sections * size; indexed > uint64(f.begin) {
+	if indexed := sections * size; indexed > uint64(f.begin) && uint64(f.begin) <= end {
 		if indexed > end {
-			logs, err = f.indexedLogs(ctx, end)
+			logs, err = f.indexedLogs(ctx, end, logs)
 		} else {
-			logs, err = f.indexedLogs(ctx, indexed-1)
+			logs, err = f.indexedLogs(ctx, indexed-1, logs)
 		}
-		if err != nil {
+		if err != nil || f.full(logs) {
+			return logs, err
+		}
+	}
+	return f.unindexedLogs(ctx, end, logs)
+}
+
+// exactLogs appends the logs matching the filter criteria based on the exact
+// log index, as far as it covers the range from the start of the filter. The
+// start is advanced past the sections looked up, leaving the rest of the range
+// to the bloom bits.
+func (f *Filter) exactLogs(ctx context.Context, end uint64, logs []*types.Log) ([]*types.Log, error) {
+	size, sections := f.backend.LogIndexStatus()
+	if size == 0 {
+		return logs, nil
+	}
+	for section := uint64(f.begin) / size; section < sections && uint64(f.begin) <= end; section++ {
+		if err := ctx.Err(); err != nil {
+			return logs, err
+		}
+		positions, err := logindex.Lookup(f.db, size, section, f.addresses, f.topics)
+		if err == logindex.ErrSectionMissing {
+			return logs, nil // Being reindexed, fall back to the bloom bits
+		} else if err != nil {
 			return logs, err
 		}
+		last := (section+1)*size - 1
+		if last > end {
+			last = end
+		}
+		if logs, err = f.positionLogs(ctx, positions, last, logs); err != nil || f.full(logs) {
+			return logs, err
+		}
+		f.begin = int64(last) + 1
+	}
+	return logs, nil
+}
+
+// positionLogs appends the logs at the given positions from the start of the
+// filter up to end. If the limit of the filter is exceeded, the start is moved
+// past the last block retrieved.
+func (f *Filter) positionLogs(ctx context.Context, positions []rawdb.LogPosition, end uint64, logs []*types.Log) ([]*types.Log, error) {
+	var (
+		number    uint64
+		blockLogs [][]*types.Log
+		fetched   bool
+	)
+	for _, pos := range positions {
+		if pos.Block < uint64(f.begin) || pos.Block > end {
+			continue
+		}
+		if !fetched || pos.Block != number {
+			if f.full(logs) {
+				f.begin = int64(number) + 1
+				return logs, nil
+			}
+			header, err := f.backend.HeaderByNumber(ctx, rpc.BlockNumber(pos.Block))
+			if header == nil || err != nil {
+				return logs, err
+			}
+			if blockLogs, err = f.backend.GetLogs(ctx, header.Hash()); err != nil {
+				return logs, err
+			}
+			number, fetched = pos.Block, true
+		}
+		// Double check the log, the chain might have been reorganised since
+		// the section was looked up.
+		if int(pos.Tx) >= len(blockLogs) || int(pos.Log) >= len(blockLogs[pos.Tx]) {
+			continue
+		}
+		logs = append(logs, filterLogs(blockLogs[pos.Tx][pos.Log:pos.Log+1], nil, nil, f.addresses, f.topics)...)
+	}
+	if fetched && f.full(logs) {
+		f.begin = int64(number) + 1
 	}
-	rest, err := f.unindexedLogs(ctx, end)
-	logs = append(logs, rest...)
-	return logs, err
+	return logs, nil
 }
 
-// indexedLogs returns the logs matching the filter criteria based on the bloom
+// indexedLogs appends the logs matching the filter criteria based on the bloom
 // bits indexed available locally or via the network.
-func (f *Filter) indexedLogs(ctx context.Context, end uint64) ([]*types.Log, error) {
+func (f *Filter) indexedLogs(ctx context.Context, end uint64, logs []*types.Log) ([]*types.Log, error) {
 	// Create a matcher session and request servicing from the backend
 	matches := make(chan uint64, 64)
 
 	session, err := f.matcher.Start(ctx, uint64(f.begin), end, matches)
 	if err != nil {
-		return nil, err
+		return logs, err
 	}
 	defer session.Close()
 
 	f.backend.ServiceFilter(ctx, session)
 
-	// Iterate over the matches until exhausted or context closed
-	var logs []*types.Log
-
+	// Iterate over the matches until exhausted, the limit is hit or context closed
 	for {
 		select {
 		case number, ok := <-matches:
@@ -206,6 +294,9 @@ func (f *Filter) indexedLogs(ctx context.Context, end uint64) ([]*types.Log, err
 				return logs, err
 			}
 			logs = append(logs, found...)
+			if f.full(logs) {
+				return logs, nil
+			}
 
 		case <-ctx.Done():
 			return logs, ctx.Err()
@@ -213,11 +304,9 @@ func (f *Filter) indexedLogs(ctx context.Context, end uint64) ([]*types.Log, err
 	}
 }
 
-// indexedLogs returns the logs matching the filter criteria based on raw block
-// iteration and bloom matching.
-func (f *Filter) unindexedLogs(ctx context.Context, end uint64) ([]*types.Log, error) {
-	var logs []*types.Log
-
+// unindexedLogs appends the logs matching the filter criteria based on raw
+// block iteration and bloom matching.
+func (f *Filter) unindexedLogs(ctx context.Context, end uint64, logs []*types.Log) ([]*types.Log, error) {
 	for ; f.begin <= int64(end); f.begin++ {
 		header, err := f.backend.HeaderByNumber(ctx, rpc.BlockNumber(f.begin))
 		if header == nil || err != nil {
@@ -228,6 +317,10 @@ func (f *Filter) unindexedLogs(ctx context.Context, end uint64) ([]*types.Log, e
 			return logs, err
 		}
 		logs = append(logs, found...)
+		if f.full(logs) {
+			f.begin++
+			return logs, nil
+		}
 	}
 	return logs, nil
 }
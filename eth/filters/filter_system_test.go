@@ -40,6 +40,8 @@ import (
 type testBackend struct {
 	db              common.Database
 	sections        uint64
+	logSize         uint64
+	logSections     uint64
 	txFeed          core.NewTxsFeed
 	rmLogsFeed      core.RemovedLogsFeed
 	pendingLogsFeed core.PendingLogsFeed
@@ -141,6 +143,10 @@ func (b *testBackend) BloomStatus() (uint64, uint64) {
 	return params.BloomBitsBlocks, b.sections
 }
 
+func (b *testBackend) LogIndexStatus() (uint64, uint64) {
+	return b.logSize, b.logSections
+}
+
 func (b *testBackend) ServiceFilter(ctx context.Context, session *bloombits.MatcherSession) {
 	requests := make(chan chan *bloombits.Retrieval)
 
@@ -179,7 +185,7 @@ func TestBlockSubscription(t *testing.T) {
 	var (
 		db          = ethdb.NewMemDatabase()
 		backend     = &testBackend{db: db}
-		api         = NewPublicFilterAPI(backend, false)
+		api         = NewPublicFilterAPI(backend, false, Config{})
 		genesis     = core.GenesisBlockForTesting(db, common.Address{1}, common.Big256)
 		chain, _    = core.GenerateChain(params.TestChainConfig, genesis, clique.NewFaker(), db, 10, nil)
 		chainEvents = []core.ChainEvent{}
@@ -231,7 +237,7 @@ func TestPendingTxFilter(t *testing.T) {
 	var (
 		db      = ethdb.NewMemDatabase()
 		backend = &testBackend{db: db}
-		api     = NewPublicFilterAPI(backend, false)
+		api     = NewPublicFilterAPI(backend, false, Config{})
 
 		transactions = []*types.Transaction{
 			types.NewTransaction(0, common.HexToAddress("0xb794f5ea0ba39494ce83a213fffba74279579268"), new(big.Int), 0, new(big.Int), nil),
@@ -286,7 +292,7 @@ func TestLogFilterCreation(t *testing.T) {
 	var (
 		db      = ethdb.NewMemDatabase()
 		backend = &testBackend{db: db}
-		api     = NewPublicFilterAPI(backend, false)
+		api     = NewPublicFilterAPI(backend, false, Config{})
 
 		testCases = []struct {
 			crit    FilterCriteria
@@ -330,7 +336,7 @@ func TestInvalidLogFilterCreation(t *testing.T) {
 	var (
 		db      = ethdb.NewMemDatabase()
 		backend = &testBackend{db: db}
-		api     = NewPublicFilterAPI(backend, false)
+		api     = NewPublicFilterAPI(backend, false, Config{})
 	)
 
 	// different situations where log filter creation should fail.
@@ -352,7 +358,7 @@ func TestInvalidGetLogsRequest(t *testing.T) {
 	var (
 		db        = ethdb.NewMemDatabase()
 		backend   = &testBackend{db: db}
-		api       = NewPublicFilterAPI(backend, false)
+		api       = NewPublicFilterAPI(backend, false, Config{})
 		blockHash = common.HexToHash("0x1111111111111111111111111111111111111111111111111111111111111111")
 	)
 
@@ -377,7 +383,7 @@ func TestLogFilter(t *testing.T) {
 	var (
 		db      = ethdb.NewMemDatabase()
 		backend = &testBackend{db: db}
-		api     = NewPublicFilterAPI(backend, false)
+		api     = NewPublicFilterAPI(backend, false, Config{})
 
 		firstAddr      = common.HexToAddress("0x1111111111111111111111111111111111111111")
 		secondAddr     = common.HexToAddress("0x2222222222222222222222222222222222222222")
@@ -490,7 +496,7 @@ func TestPendingLogsSubscription(t *testing.T) {
 	var (
 		db      = ethdb.NewMemDatabase()
 		backend = &testBackend{db: db}
-		api     = NewPublicFilterAPI(backend, false)
+		api     = NewPublicFilterAPI(backend, false, Config{})
 
 		firstAddr      = common.HexToAddress("0x1111111111111111111111111111111111111111")
 		secondAddr     = common.HexToAddress("0x2222222222222222222222222222222222222222")
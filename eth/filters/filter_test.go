@@ -21,11 +21,14 @@ import (
 	"io/ioutil"
 	"math/big"
 	"os"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/zeus-fyi/gochain/v4/common"
 	"github.com/zeus-fyi/gochain/v4/consensus/clique"
 	"github.com/zeus-fyi/gochain/v4/core"
+	"github.com/zeus-fyi/gochain/v4/core/logindex"
 	"github.com/zeus-fyi/gochain/v4/core/rawdb"
 	"github.com/zeus-fyi/gochain/v4/core/types"
 	"github.com/zeus-fyi/gochain/v4/crypto"
@@ -229,3 +232,93 @@ func TestFilters(t *testing.T) {
 		t.Error("expected 0 log, got", len(logs))
 	}
 }
+
+// indexerChain is a static core.ChainIndexerChain.
+type indexerChain struct {
+	head *types.Header
+}
+
+func (c *indexerChain) CurrentHeader() *types.Header                                       { return c.head }
+func (c *indexerChain) SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent, name string) {}
+func (c *indexerChain) UnsubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent)            {}
+
+func TestExactLogs(t *testing.T) {
+	var (
+		db      = ethdb.NewMemDatabase()
+		backend = &testBackend{db: db}
+		addr1   = common.BytesToAddress([]byte("addr1"))
+		addr2   = common.BytesToAddress([]byte("addr2"))
+		topic1  = common.BytesToHash([]byte("topic1"))
+		topic2  = common.BytesToHash([]byte("topic2"))
+		size    = uint64(16)
+		blocks  = 300
+	)
+	genesis := core.GenesisBlockForTesting(db, addr1, big.NewInt(1000000))
+	chain, receipts := core.GenerateChain(params.TestChainConfig, genesis, clique.NewFaker(), db, blocks, func(i int, gen *core.BlockGen) {
+		var logs []*types.Log
+		switch i {
+		case 10, 20, blocks - 10:
+			logs = []*types.Log{{Address: addr1, Topics: []common.Hash{topic1}}, {Address: addr2, Topics: []common.Hash{topic2}}}
+		case 200:
+			logs = []*types.Log{{Address: addr2, Topics: []common.Hash{topic1, topic2}}}
+		default:
+			return
+		}
+		receipt := types.NewReceipt(nil, false, 0)
+		receipt.Logs = logs
+		receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+		gen.AddUncheckedReceipt(receipt)
+		gen.AddUncheckedTx(types.NewTransaction(uint64(i), common.Address{}, big.NewInt(1), 1, big.NewInt(1), nil))
+	})
+	for i, block := range chain {
+		rawdb.WriteBlock(db, block)
+		rawdb.WriteCanonicalHash(db, block.Hash(), block.NumberU64())
+		rawdb.WriteHeadBlockHash(db.GlobalTable(), block.Hash())
+		rawdb.WriteReceipts(db.ReceiptTable(), block.Hash(), block.NumberU64(), receipts[i])
+	}
+	indexer := logindex.NewIndexer(db, size)
+	indexer.Start(&indexerChain{head: chain[len(chain)-1].Header()})
+	defer indexer.Close()
+
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if sections, _, _ := indexer.Sections(); sections == 2 {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("indexing timed out")
+		}
+	}
+	tests := []struct {
+		begin, end int64
+		addresses  []common.Address
+		topics     [][]common.Hash
+		want       int
+	}{
+		{0, -1, []common.Address{addr1}, nil, 3},
+		{0, -1, []common.Address{addr2}, nil, 4},
+		{0, -1, nil, [][]common.Hash{{topic1}}, 4},
+		{0, -1, nil, [][]common.Hash{nil, {topic2}}, 1},
+		{0, -1, []common.Address{addr2}, [][]common.Hash{{topic2}}, 3},
+		{15, 250, []common.Address{addr1, addr2}, nil, 3},
+		{12, 22, []common.Address{addr1}, [][]common.Hash{{topic1}}, 1},
+		{0, -1, []common.Address{common.BytesToAddress([]byte("none"))}, nil, 0},
+	}
+	for i, tt := range tests {
+		backend.logSize, backend.logSections = 0, 0
+		want, err := NewRangeFilter(backend, tt.begin, tt.end, tt.addresses, tt.topics).Logs(context.Background())
+		if err != nil {
+			t.Fatalf("test %d: unindexed filter failed: %v", i, err)
+		}
+		if len(want) != tt.want {
+			t.Fatalf("test %d: unindexed log count mismatch: have %d, want %d", i, len(want), tt.want)
+		}
+		backend.logSize, backend.logSections = size, 2
+		have, err := NewRangeFilter(backend, tt.begin, tt.end, tt.addresses, tt.topics).Logs(context.Background())
+		if err != nil {
+			t.Fatalf("test %d: indexed filter failed: %v", i, err)
+		}
+		if !reflect.DeepEqual(have, want) {
+			t.Errorf("test %d: logs mismatch: have %v, want %v", i, have, want)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package filters
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/zeus-fyi/gochain/v4/common/hexutil"
+	"github.com/zeus-fyi/gochain/v4/core/types"
+)
+
+// defaultPageSize is the number of logs in a page of a paginated log query if
+// the caller doesn't ask for a size.
+const defaultPageSize = 1000
+
+// Config bounds the work done by the log queries of the filter API.
+type Config struct {
+	MaxResults    int    // Maximum number of logs returned by a query (0 = unlimited)
+	MaxBlockRange uint64 // Maximum number of blocks searched by a query (0 = unlimited)
+}
+
+// DefaultConfig limits the results of log queries to what nodes and clients
+// handle comfortably in a single response.
+var DefaultConfig = Config{
+	MaxResults: 10000,
+}
+
+// logLimitError is returned by log queries exceeding the configured limits. Its
+// data suggests a narrower block range within the limits, if there is one.
+type logLimitError struct {
+	message  string
+	from, to uint64
+	suggest  bool
+}
+
+func (e *logLimitError) Error() string  { return e.message }
+func (e *logLimitError) ErrorCode() int { return -32005 }
+
+func (e *logLimitError) ErrorData() interface{} {
+	if !e.suggest {
+		return nil
+	}
+	return map[string]hexutil.Uint64{
+		"fromBlock": hexutil.Uint64(e.from),
+		"toBlock":   hexutil.Uint64(e.to),
+	}
+}
+
+// LogCursor is the position of a log, from which a paginated log query resumes.
+// Clients should treat it as opaque and pass it back as received.
+type LogCursor struct {
+	Block   uint64
+	TxIndex uint
+	Index   uint
+}
+
+// cursorOf returns the cursor resuming a query at the given log.
+func cursorOf(log *types.Log) *LogCursor {
+	return &LogCursor{Block: log.BlockNumber, TxIndex: log.TxIndex, Index: log.Index}
+}
+
+// precedes reports whether the log comes before the cursor.
+func (c *LogCursor) precedes(log *types.Log) bool {
+	if log.BlockNumber != c.Block {
+		return log.BlockNumber < c.Block
+	}
+	if log.TxIndex != c.TxIndex {
+		return log.TxIndex < c.TxIndex
+	}
+	return log.Index < c.Index
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (c LogCursor) MarshalText() ([]byte, error) {
+	var enc [16]byte
+	binary.BigEndian.PutUint64(enc[:8], c.Block)
+	binary.BigEndian.PutUint32(enc[8:12], uint32(c.TxIndex))
+	binary.BigEndian.PutUint32(enc[12:], uint32(c.Index))
+	return hexutil.Bytes(enc[:]).MarshalText()
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (c *LogCursor) UnmarshalText(input []byte) error {
+	var enc hexutil.Bytes
+	if err := enc.UnmarshalText(input); err != nil {
+		return err
+	}
+	if len(enc) != 16 {
+		return errors.New("invalid log cursor")
+	}
+	c.Block = binary.BigEndian.Uint64(enc[:8])
+	c.TxIndex = uint(binary.BigEndian.Uint32(enc[8:12]))
+	c.Index = uint(binary.BigEndian.Uint32(enc[12:]))
+	return nil
+}
+
+// LogsPage is a page of the results of a paginated log query.
+type LogsPage struct {
+	Logs   []*types.Log `json:"logs"`
+	Cursor *LogCursor   `json:"cursor"` // Position to resume from, nil on the last page
+}
+
+// paginate cuts a page of at most size logs from the logs, returning the
+// cursor of the first log left out.
+func paginate(logs []*types.Log, size int) *LogsPage {
+	page := &LogsPage{Logs: returnLogs(logs)}
+	if len(logs) > size {
+		page.Logs, page.Cursor = logs[:size], cursorOf(logs[size])
+	}
+	return page
+}
@@ -0,0 +1,161 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package filters
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/common/hexutil"
+	"github.com/zeus-fyi/gochain/v4/consensus/clique"
+	"github.com/zeus-fyi/gochain/v4/core"
+	"github.com/zeus-fyi/gochain/v4/core/rawdb"
+	"github.com/zeus-fyi/gochain/v4/core/types"
+	"github.com/zeus-fyi/gochain/v4/ethdb"
+	"github.com/zeus-fyi/gochain/v4/params"
+	"github.com/zeus-fyi/gochain/v4/rpc"
+)
+
+// newLimitsBackend returns a backend with a chain of 30 blocks, every third of
+// which holds two logs of addr, starting with block 1.
+func newLimitsBackend(addr common.Address) (*testBackend, []*types.Block) {
+	db := ethdb.NewMemDatabase()
+	genesis := core.GenesisBlockForTesting(db, addr, big.NewInt(1000000))
+	chain, receipts := core.GenerateChain(params.TestChainConfig, genesis, clique.NewFaker(), db, 30, func(i int, gen *core.BlockGen) {
+		if i%3 != 0 {
+			return
+		}
+		receipt := types.NewReceipt(nil, false, 0)
+		receipt.Logs = []*types.Log{{Address: addr}, {Address: addr}}
+		receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+		gen.AddUncheckedReceipt(receipt)
+		gen.AddUncheckedTx(types.NewTransaction(uint64(i), common.Address{}, big.NewInt(1), 1, big.NewInt(1), nil))
+	})
+	for i, block := range chain {
+		rawdb.WriteBlock(db, block)
+		rawdb.WriteCanonicalHash(db, block.Hash(), block.NumberU64())
+		rawdb.WriteHeadBlockHash(db.GlobalTable(), block.Hash())
+		rawdb.WriteReceipts(db.ReceiptTable(), block.Hash(), block.NumberU64(), receipts[i])
+	}
+	return &testBackend{db: db}, chain
+}
+
+func TestGetLogsLimits(t *testing.T) {
+	var (
+		addr       = common.BytesToAddress([]byte("addr"))
+		ctx        = context.Background()
+		backend, _ = newLimitsBackend(addr)
+	)
+	crit := func(from, to int64) FilterCriteria {
+		return FilterCriteria{FromBlock: big.NewInt(from), ToBlock: big.NewInt(to), Addresses: []common.Address{addr}}
+	}
+	// Block ranges beyond the limit are refused, suggesting one within.
+	api := NewPublicFilterAPI(backend, false, Config{MaxBlockRange: 10})
+	_, err := api.GetLogs(ctx, crit(5, 20))
+	checkLimitError(t, "range", err, 5, 14)
+	if _, err := api.GetLogs(ctx, crit(5, 14)); err != nil {
+		t.Errorf("range: query within limit failed: %v", err)
+	}
+	// Results beyond the limit are refused, suggesting the blocks that fit.
+	api = NewPublicFilterAPI(backend, false, Config{MaxResults: 5})
+	_, err = api.GetLogs(ctx, crit(0, -1))
+	checkLimitError(t, "results", err, 1, 6)
+	logs, err := api.GetLogs(ctx, crit(1, 6))
+	if err != nil || len(logs) != 4 {
+		t.Errorf("results: query within limit returned %d logs, error %v", len(logs), err)
+	}
+	// A single block exceeding the limit can't be narrowed down.
+	api = NewPublicFilterAPI(backend, false, Config{MaxResults: 1})
+	_, err = api.GetLogs(ctx, crit(0, -1))
+	if lerr, ok := err.(*logLimitError); !ok || lerr.ErrorData() != nil {
+		t.Errorf("single block: have error %v, want limit error without suggestion", err)
+	}
+}
+
+func checkLimitError(t *testing.T, name string, err error, from, to uint64) {
+	t.Helper()
+
+	lerr, ok := err.(*logLimitError)
+	if !ok {
+		t.Fatalf("%s: have error %v, want limit error", name, err)
+	}
+	if _, ok := err.(rpc.Error); !ok || lerr.ErrorCode() != -32005 {
+		t.Errorf("%s: error code mismatch", name)
+	}
+	want := map[string]hexutil.Uint64{"fromBlock": hexutil.Uint64(from), "toBlock": hexutil.Uint64(to)}
+	if have := lerr.ErrorData(); !reflect.DeepEqual(have, want) {
+		t.Errorf("%s: suggestion mismatch: have %v, want %v", name, have, want)
+	}
+}
+
+func TestGetLogsPaginated(t *testing.T) {
+	var (
+		addr           = common.BytesToAddress([]byte("addr"))
+		ctx            = context.Background()
+		backend, chain = newLimitsBackend(addr)
+		api            = NewPublicFilterAPI(backend, false, Config{MaxResults: 5})
+	)
+	all, err := NewPublicFilterAPI(backend, false, Config{}).GetLogs(ctx, FilterCriteria{FromBlock: big.NewInt(0), Addresses: []common.Address{addr}})
+	if err != nil || len(all) != 20 {
+		t.Fatalf("unlimited query returned %d logs, error %v", len(all), err)
+	}
+	walk := func(crit FilterCriteria, limit *hexutil.Uint) (logs []*types.Log, pages int) {
+		var cursor *LogCursor
+		for {
+			page, err := api.GetLogsPaginated(ctx, crit, cursor, limit)
+			if err != nil {
+				t.Fatalf("page %d: %v", pages, err)
+			}
+			if len(page.Logs) > api.config.MaxResults {
+				t.Fatalf("page %d: have %d logs, more than the limit", pages, len(page.Logs))
+			}
+			logs, pages = append(logs, page.Logs...), pages+1
+			if page.Cursor == nil {
+				return logs, pages
+			}
+			// Pass the cursor the way clients do
+			enc, _ := json.Marshal(page.Cursor)
+			cursor = new(LogCursor)
+			if err := json.Unmarshal(enc, cursor); err != nil {
+				t.Fatalf("page %d: invalid cursor %s: %v", pages, enc, err)
+			}
+		}
+	}
+	crit := FilterCriteria{FromBlock: big.NewInt(0), Addresses: []common.Address{addr}}
+	for _, size := range []uint{1, 3, 4, 0, 100} {
+		limit := hexutil.Uint(size)
+		logs, pages := walk(crit, &limit)
+		if !reflect.DeepEqual(logs, all) {
+			t.Errorf("limit %d: logs mismatch after %d pages", size, pages)
+		}
+	}
+	// Single block queries are paginated as well.
+	hash := chain[3].Hash()
+	limit := hexutil.Uint(1)
+	logs, pages := walk(FilterCriteria{BlockHash: &hash, Addresses: []common.Address{addr}}, &limit)
+	if len(logs) != 2 || pages != 2 || logs[0].BlockNumber != 4 {
+		t.Errorf("block query: have %d logs in %d pages", len(logs), pages)
+	}
+	// Cursors before the queried range are refused.
+	if _, err := api.GetLogsPaginated(ctx, FilterCriteria{FromBlock: big.NewInt(10)}, &LogCursor{Block: 5}, nil); err == nil {
+		t.Error("cursor outside of the range accepted")
+	}
+}
@@ -0,0 +1,273 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package filters
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/common/hexutil"
+	"github.com/zeus-fyi/gochain/v4/core"
+	"github.com/zeus-fyi/gochain/v4/core/types"
+	"github.com/zeus-fyi/gochain/v4/log"
+	"github.com/zeus-fyi/gochain/v4/rpc"
+)
+
+// StreamCursor is the position of a durable stream: the last block it added to
+// the chain, or the parent of the last block it removed.
+type StreamCursor struct {
+	Number hexutil.Uint64 `json:"number"`
+	Hash   common.Hash    `json:"hash"`
+}
+
+// StreamStart is where a durable stream starts, either a block number to replay
+// from or the cursor of the last event delivered by a previous stream.
+type StreamStart struct {
+	Block  rpc.BlockNumber
+	Cursor *StreamCursor
+}
+
+// UnmarshalJSON accepts a block number or a cursor object.
+func (s *StreamStart) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '{' {
+		s.Cursor = new(StreamCursor)
+		return json.Unmarshal(data, s.Cursor)
+	}
+	return s.Block.UnmarshalJSON(data)
+}
+
+// StreamEvent is a notification of a durable stream, reporting a block added to
+// or, if Removed, dropped from the canonical chain along with its logs matching
+// the filter. Logs of removed blocks are flagged as removed too.
+type StreamEvent struct {
+	Number     hexutil.Uint64 `json:"number"`
+	Hash       common.Hash    `json:"hash"`
+	ParentHash common.Hash    `json:"parentHash"`
+	Removed    bool           `json:"removed"`
+	Logs       []*types.Log   `json:"logs"`
+	Cursor     StreamCursor   `json:"cursor"`
+}
+
+// SubscribeFrom creates a durable stream of the canonical blocks and their logs
+// matching the given criteria, starting at a block or resuming after a cursor.
+// Historical blocks are replayed from storage before following the chain head.
+// Every block is reported, so consumers see an unbroken chain, and blocks are
+// reported as removed when reorganised away, also those delivered before a
+// resumption. Consumers persisting the cursor of the last event they processed
+// get every event at least once.
+//
+// The block range of the criteria is ignored.
+func (api *PublicFilterAPI) SubscribeFrom(ctx context.Context, start StreamStart, crit FilterCriteria) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	s := &stream{backend: api.backend, addresses: crit.Addresses, topics: crit.Topics}
+	if err := s.init(ctx, start); err != nil {
+		return nil, err
+	}
+	rpcSub := notifier.CreateSubscription()
+	s.notify = func(ev *StreamEvent) error {
+		return notifier.Notify(rpcSub.ID, ev)
+	}
+	go func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		// Coalesce chain events into wake ups, the stream might be busy
+		// replaying history for a long time and must not hold up the chain.
+		var (
+			events = make(chan core.ChainEvent, 16)
+			wake   = make(chan struct{}, 1)
+		)
+		api.backend.SubscribeChainEvent(events, "filters.stream")
+		defer api.backend.UnsubscribeChainEvent(events)
+		go func() {
+			for range events {
+				select {
+				case wake <- struct{}{}:
+				default:
+				}
+			}
+		}()
+		go func() {
+			select {
+			case <-rpcSub.Err(): // client send an unsubscribe request
+			case <-notifier.Closed(): // connection dropped
+			}
+			cancel()
+		}()
+		for {
+			if err := s.sync(ctx); err != nil {
+				if ctx.Err() == nil {
+					log.Debug("Durable log stream failed", "id", rpcSub.ID, "err", err)
+				}
+				return
+			}
+			select {
+			case <-wake:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return rpcSub, nil
+}
+
+// stream tracks the position of a durable stream in the chain.
+type stream struct {
+	backend   Backend
+	addresses []common.Address
+	topics    [][]common.Hash
+	notify    func(*StreamEvent) error
+
+	last *StreamCursor // Last block delivered, nil if none
+	next uint64        // Number of the next block to deliver
+}
+
+// init positions the stream before its start.
+func (s *stream) init(ctx context.Context, start StreamStart) error {
+	if start.Cursor != nil {
+		header, err := s.backend.HeaderByHash(ctx, start.Cursor.Hash)
+		if err != nil {
+			return err
+		}
+		if header == nil || header.Number.Uint64() != uint64(start.Cursor.Number) {
+			return errors.New("unknown stream cursor")
+		}
+		s.last, s.next = start.Cursor, uint64(start.Cursor.Number)+1
+		return nil
+	}
+	switch start.Block {
+	case rpc.PendingBlockNumber:
+		return errors.New("streams can't start at the pending block")
+	case rpc.LatestBlockNumber:
+		header, err := s.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
+		if err != nil {
+			return err
+		}
+		if header == nil {
+			return errors.New("unknown chain head")
+		}
+		s.next = header.Number.Uint64()
+	default:
+		s.next = uint64(start.Block)
+	}
+	if s.next > 0 {
+		parent, err := s.backend.HeaderByNumber(ctx, rpc.BlockNumber(s.next-1))
+		if err != nil {
+			return err
+		}
+		if parent != nil {
+			s.last = &StreamCursor{Number: hexutil.Uint64(s.next - 1), Hash: parent.Hash()}
+		}
+	}
+	return nil
+}
+
+// sync brings the stream up to the canonical chain head, first removing the
+// blocks delivered that were reorganised away.
+func (s *stream) sync(ctx context.Context) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		header, err := s.backend.HeaderByNumber(ctx, rpc.BlockNumber(s.next))
+		if err != nil {
+			return err
+		}
+		if header == nil || (s.last != nil && header.ParentHash != s.last.Hash) {
+			// Caught up with the head or the chain diverged, unwind the last
+			// block if it isn't canonical any more.
+			if s.last == nil {
+				return nil
+			}
+			canon, err := s.backend.HeaderByNumber(ctx, rpc.BlockNumber(s.last.Number))
+			if err != nil {
+				return err
+			}
+			if canon != nil && canon.Hash() == s.last.Hash {
+				return nil // Caught up, or raced with a reorg whose chain event is pending
+			}
+			if err := s.unwind(ctx); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := s.deliver(ctx, header, false); err != nil {
+			return err
+		}
+		s.last = &StreamCursor{Number: hexutil.Uint64(header.Number.Uint64()), Hash: header.Hash()}
+		s.next = header.Number.Uint64() + 1
+	}
+}
+
+// unwind reports the last block delivered as removed, moving the stream back
+// to its parent.
+func (s *stream) unwind(ctx context.Context) error {
+	header, err := s.backend.HeaderByHash(ctx, s.last.Hash)
+	if err != nil {
+		return err
+	}
+	if header == nil {
+		return fmt.Errorf("unknown stream block #%d [%x…]", s.last.Number, s.last.Hash.Bytes()[:4])
+	}
+	if err := s.deliver(ctx, header, true); err != nil {
+		return err
+	}
+	number := header.Number.Uint64()
+	if number == 0 {
+		s.last = nil
+	} else {
+		s.last = &StreamCursor{Number: hexutil.Uint64(number - 1), Hash: header.ParentHash}
+	}
+	s.next = number
+	return nil
+}
+
+// deliver notifies the addition or removal of a block with its matching logs.
+func (s *stream) deliver(ctx context.Context, header *types.Header, removed bool) error {
+	hash, number := header.Hash(), header.Number.Uint64()
+	logs, err := NewBlockFilter(s.backend, hash, s.addresses, s.topics).blockLogs(ctx, header)
+	if err != nil {
+		return err
+	}
+	ev := &StreamEvent{
+		Number:     hexutil.Uint64(number),
+		Hash:       hash,
+		ParentHash: header.ParentHash,
+		Removed:    removed,
+		Logs:       returnLogs(logs),
+		Cursor:     StreamCursor{Number: hexutil.Uint64(number), Hash: hash},
+	}
+	if removed {
+		// Flag copies, the logs might be cached
+		for i, log := range ev.Logs {
+			cpy := *log
+			cpy.Removed = true
+			ev.Logs[i] = &cpy
+		}
+		ev.Cursor = StreamCursor{Number: hexutil.Uint64(number - 1), Hash: header.ParentHash}
+		if number == 0 {
+			ev.Cursor = StreamCursor{}
+		}
+	}
+	return s.notify(ev)
+}
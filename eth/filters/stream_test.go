@@ -0,0 +1,163 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package filters
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/consensus/clique"
+	"github.com/zeus-fyi/gochain/v4/core"
+	"github.com/zeus-fyi/gochain/v4/core/rawdb"
+	"github.com/zeus-fyi/gochain/v4/core/types"
+	"github.com/zeus-fyi/gochain/v4/ethdb"
+	"github.com/zeus-fyi/gochain/v4/params"
+	"github.com/zeus-fyi/gochain/v4/rpc"
+)
+
+// streamChain generates n blocks on top of parent, each holding a log of addr
+// with the given topic, and writes them as the canonical chain.
+func streamChain(db common.Database, parent *types.Block, n int, addr common.Address, topic common.Hash) []*types.Block {
+	chain, receipts := core.GenerateChain(params.TestChainConfig, parent, clique.NewFaker(), db, n, func(i int, gen *core.BlockGen) {
+		receipt := types.NewReceipt(nil, false, 0)
+		receipt.Logs = []*types.Log{{Address: addr, Topics: []common.Hash{topic}}}
+		receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+		gen.AddUncheckedReceipt(receipt)
+		gen.AddUncheckedTx(types.NewTransaction(uint64(i), common.Address{}, big.NewInt(1), 1, big.NewInt(1), nil))
+	})
+	for i, block := range chain {
+		rawdb.WriteBlock(db, block)
+		rawdb.WriteCanonicalHash(db, block.Hash(), block.NumberU64())
+		rawdb.WriteHeadBlockHash(db.GlobalTable(), block.Hash())
+		rawdb.WriteReceipts(db.ReceiptTable(), block.Hash(), block.NumberU64(), receipts[i])
+	}
+	return chain
+}
+
+// expectStream checks the next events of a stream against the expected blocks,
+// the removed ones being reported in reverse order, and the topics of their logs.
+func expectStream(t *testing.T, events chan StreamEvent, added []*types.Block, addedTopic common.Hash, removed []*types.Block, removedTopic common.Hash) {
+	t.Helper()
+
+	type want struct {
+		block   *types.Block
+		topic   common.Hash
+		removed bool
+	}
+	var wants []want
+	for i := len(removed) - 1; i >= 0; i-- {
+		wants = append(wants, want{removed[i], removedTopic, true})
+	}
+	for _, block := range added {
+		wants = append(wants, want{block, addedTopic, false})
+	}
+	for i, w := range wants {
+		select {
+		case ev := <-events:
+			if ev.Hash != w.block.Hash() || uint64(ev.Number) != w.block.NumberU64() || ev.Removed != w.removed {
+				t.Fatalf("event %d: have block #%d %x removed %v, want #%d %x removed %v", i, ev.Number, ev.Hash, ev.Removed, w.block.NumberU64(), w.block.Hash(), w.removed)
+			}
+			if len(ev.Logs) != 1 || ev.Logs[0].Topics[0] != w.topic || ev.Logs[0].Removed != w.removed {
+				t.Fatalf("event %d: logs mismatch: %v", i, ev.Logs)
+			}
+			cursor := StreamCursor{Number: ev.Number, Hash: ev.Hash}
+			if w.removed {
+				cursor = StreamCursor{Number: ev.Number - 1, Hash: ev.ParentHash}
+			}
+			if ev.Cursor != cursor {
+				t.Fatalf("event %d: cursor mismatch: have %v, want %v", i, ev.Cursor, cursor)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("event %d: timeout", i)
+		}
+	}
+	select {
+	case ev := <-events:
+		t.Fatalf("unexpected event for block #%d removed %v", ev.Number, ev.Removed)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestSubscribeFrom(t *testing.T) {
+	var (
+		db      = ethdb.NewMemDatabase()
+		backend = &testBackend{db: db}
+		addr    = common.BytesToAddress([]byte("addr"))
+		other   = common.BytesToAddress([]byte("other"))
+		topicA  = common.BytesToHash([]byte("A"))
+		topicB  = common.BytesToHash([]byte("B"))
+		genesis = core.GenesisBlockForTesting(db, addr, big.NewInt(1000000))
+		crit    = map[string]interface{}{"address": addr}
+	)
+	chainA := streamChain(db, genesis, 10, addr, topicA)
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", NewPublicFilterAPI(backend, false, Config{})); err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(server)
+	defer client.Close()
+
+	// Replay history from block 3 on, then switch to following the chain.
+	events := make(chan StreamEvent)
+	sub, err := client.EthSubscribe(context.Background(), events, "subscribeFrom", "0x3", crit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectStream(t, events, chainA[2:], topicA, nil, common.Hash{})
+
+	// Reorganise the last three blocks away, with two blocks more.
+	chainB := streamChain(db, chainA[6], 5, addr, topicB)
+	backend.chainFeed.Send(core.ChainEvent{Block: chainB[4], Hash: chainB[4].Hash()})
+	expectStream(t, events, chainB, topicB, chainA[7:], topicA)
+	sub.Unsubscribe()
+
+	// Resuming from a reorganised block removes it and its ancestors first.
+	events = make(chan StreamEvent)
+	cursor := StreamCursor{Number: 9, Hash: chainA[8].Hash()}
+	sub, err = client.EthSubscribe(context.Background(), events, "subscribeFrom", cursor, crit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectStream(t, events, chainB, topicB, chainA[7:9], topicA)
+	sub.Unsubscribe()
+
+	// Blocks without matching logs are reported without logs.
+	events = make(chan StreamEvent)
+	sub, err = client.EthSubscribe(context.Background(), events, "subscribeFrom", "latest", map[string]interface{}{"address": other})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ev := <-events:
+		if ev.Hash != chainB[4].Hash() || len(ev.Logs) != 0 {
+			t.Errorf("head event mismatch: have block #%d with %d logs", ev.Number, len(ev.Logs))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("head event timeout")
+	}
+	sub.Unsubscribe()
+
+	// Unknown cursors are refused.
+	cursor = StreamCursor{Number: 1, Hash: common.Hash{1}}
+	if _, err := client.EthSubscribe(context.Background(), make(chan StreamEvent), "subscribeFrom", cursor, crit); err == nil {
+		t.Error("unknown cursor accepted")
+	}
+}
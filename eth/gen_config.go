@@ -10,7 +10,9 @@ import (
 	"github.com/zeus-fyi/gochain/v4/common/hexutil"
 	"github.com/zeus-fyi/gochain/v4/core"
 	"github.com/zeus-fyi/gochain/v4/eth/downloader"
+	"github.com/zeus-fyi/gochain/v4/eth/filters"
 	"github.com/zeus-fyi/gochain/v4/eth/gasprice"
+	"github.com/zeus-fyi/gochain/v4/p2p/discover"
 )
 
 var _ = (*configMarshaling)(nil)
@@ -22,41 +24,74 @@ func (c Config) MarshalTOML() (interface{}, error) {
 		NetworkId               uint64
 		SyncMode                downloader.SyncMode
 		NoPruning               bool
+		Snapshot                bool
+		Witnesses               bool
+		StateDiffs              bool
+		LogIndex                bool
+		HistoryBlocks           uint64
 		LightServ               int  `toml:",omitempty"`
 		LightPeers              int  `toml:",omitempty"`
 		SkipBcVersionCheck      bool `toml:"-"`
 		DatabaseHandles         int  `toml:"-"`
 		DatabaseCache           int
+		TrieCleanCache          int
 		TrieCache               int
 		TrieTimeout             time.Duration
+		NoPrefetch              bool
 		Etherbase               common.Address `toml:",omitempty"`
+		MinerNotify             []string       `toml:",omitempty"`
 		MinerExtraData          hexutil.Bytes  `toml:",omitempty"`
+		MinerGasFloor           uint64
+		MinerGasCeil            uint64
 		MinerGasPrice           *big.Int
+		MinerRecommit           time.Duration
+		MinerNoverify           bool
 		TxPool                  core.TxPoolConfig
+		PrivateTxPeers          []discover.NodeID `toml:",omitempty"`
 		GPO                     gasprice.Config
+		Logs                    filters.Config
 		EnablePreimageRecording bool
 		DocRoot                 string `toml:"-"`
+		EWASMInterpreter        string
+		EVMInterpreter          string
+		ConstantinopleOverride  *big.Int
 	}
 	var enc Config
 	enc.Genesis = c.Genesis
 	enc.NetworkId = c.NetworkId
 	enc.SyncMode = c.SyncMode
 	enc.NoPruning = c.NoPruning
+	enc.Snapshot = c.Snapshot
+	enc.Witnesses = c.Witnesses
+	enc.StateDiffs = c.StateDiffs
+	enc.LogIndex = c.LogIndex
+	enc.HistoryBlocks = c.HistoryBlocks
 	enc.LightServ = c.LightServ
 	enc.LightPeers = c.LightPeers
 	enc.SkipBcVersionCheck = c.SkipBcVersionCheck
 	enc.DatabaseHandles = c.DatabaseHandles
 	enc.DatabaseCache = c.DatabaseCache
+	enc.TrieCleanCache = c.TrieCleanCache
 	enc.TrieCache = c.TrieCache
 	enc.TrieTimeout = c.TrieTimeout
+	enc.NoPrefetch = c.NoPrefetch
 	enc.Etherbase = c.Etherbase
+	enc.MinerNotify = c.MinerNotify
 	enc.MinerExtraData = c.MinerExtraData
+	enc.MinerGasFloor = c.MinerGasFloor
+	enc.MinerGasCeil = c.MinerGasCeil
 	enc.MinerGasPrice = c.MinerGasPrice
+	enc.MinerRecommit = c.MinerRecommit
+	enc.MinerNoverify = c.MinerNoverify
 	enc.TxPool = c.TxPool
+	enc.PrivateTxPeers = c.PrivateTxPeers
 	enc.GPO = c.GPO
+	enc.Logs = c.Logs
 	enc.EnablePreimageRecording = c.EnablePreimageRecording
 	enc.DocRoot = c.DocRoot
-	// enc.Archive = c.Archive
+	enc.EWASMInterpreter = c.EWASMInterpreter
+	enc.EVMInterpreter = c.EVMInterpreter
+	enc.ConstantinopleOverride = c.ConstantinopleOverride
 	return &enc, nil
 }
 
@@ -67,21 +102,37 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 		NetworkId               *uint64
 		SyncMode                *downloader.SyncMode
 		NoPruning               *bool
+		Snapshot                *bool
+		Witnesses               *bool
+		StateDiffs              *bool
+		LogIndex                *bool
+		HistoryBlocks           *uint64
 		LightServ               *int  `toml:",omitempty"`
 		LightPeers              *int  `toml:",omitempty"`
 		SkipBcVersionCheck      *bool `toml:"-"`
 		DatabaseHandles         *int  `toml:"-"`
 		DatabaseCache           *int
+		TrieCleanCache          *int
 		TrieCache               *int
 		TrieTimeout             *time.Duration
+		NoPrefetch              *bool
 		Etherbase               *common.Address `toml:",omitempty"`
+		MinerNotify             []string        `toml:",omitempty"`
 		MinerExtraData          *hexutil.Bytes  `toml:",omitempty"`
+		MinerGasFloor           *uint64
+		MinerGasCeil            *uint64
 		MinerGasPrice           *big.Int
+		MinerRecommit           *time.Duration
+		MinerNoverify           *bool
 		TxPool                  *core.TxPoolConfig
+		PrivateTxPeers          []discover.NodeID `toml:",omitempty"`
 		GPO                     *gasprice.Config
+		Logs                    *filters.Config
 		EnablePreimageRecording *bool
 		DocRoot                 *string `toml:"-"`
-		// Archive                 *archive.Config `toml:",omitempty"`
+		EWASMInterpreter        *string
+		EVMInterpreter          *string
+		ConstantinopleOverride  *big.Int
 	}
 	var dec Config
 	if err := unmarshal(&dec); err != nil {
@@ -99,6 +150,21 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.NoPruning != nil {
 		c.NoPruning = *dec.NoPruning
 	}
+	if dec.Snapshot != nil {
+		c.Snapshot = *dec.Snapshot
+	}
+	if dec.Witnesses != nil {
+		c.Witnesses = *dec.Witnesses
+	}
+	if dec.StateDiffs != nil {
+		c.StateDiffs = *dec.StateDiffs
+	}
+	if dec.LogIndex != nil {
+		c.LogIndex = *dec.LogIndex
+	}
+	if dec.HistoryBlocks != nil {
+		c.HistoryBlocks = *dec.HistoryBlocks
+	}
 	if dec.LightServ != nil {
 		c.LightServ = *dec.LightServ
 	}
@@ -114,35 +180,68 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.DatabaseCache != nil {
 		c.DatabaseCache = *dec.DatabaseCache
 	}
+	if dec.TrieCleanCache != nil {
+		c.TrieCleanCache = *dec.TrieCleanCache
+	}
 	if dec.TrieCache != nil {
 		c.TrieCache = *dec.TrieCache
 	}
 	if dec.TrieTimeout != nil {
 		c.TrieTimeout = *dec.TrieTimeout
 	}
+	if dec.NoPrefetch != nil {
+		c.NoPrefetch = *dec.NoPrefetch
+	}
 	if dec.Etherbase != nil {
 		c.Etherbase = *dec.Etherbase
 	}
+	if dec.MinerNotify != nil {
+		c.MinerNotify = dec.MinerNotify
+	}
 	if dec.MinerExtraData != nil {
 		c.MinerExtraData = *dec.MinerExtraData
 	}
+	if dec.MinerGasFloor != nil {
+		c.MinerGasFloor = *dec.MinerGasFloor
+	}
+	if dec.MinerGasCeil != nil {
+		c.MinerGasCeil = *dec.MinerGasCeil
+	}
 	if dec.MinerGasPrice != nil {
 		c.MinerGasPrice = dec.MinerGasPrice
 	}
+	if dec.MinerRecommit != nil {
+		c.MinerRecommit = *dec.MinerRecommit
+	}
+	if dec.MinerNoverify != nil {
+		c.MinerNoverify = *dec.MinerNoverify
+	}
 	if dec.TxPool != nil {
 		c.TxPool = *dec.TxPool
 	}
+	if dec.PrivateTxPeers != nil {
+		c.PrivateTxPeers = dec.PrivateTxPeers
+	}
 	if dec.GPO != nil {
 		c.GPO = *dec.GPO
 	}
+	if dec.Logs != nil {
+		c.Logs = *dec.Logs
+	}
 	if dec.EnablePreimageRecording != nil {
 		c.EnablePreimageRecording = *dec.EnablePreimageRecording
 	}
 	if dec.DocRoot != nil {
 		c.DocRoot = *dec.DocRoot
 	}
-	// if dec.Archive != nil {
-	// 	c.Archive = *dec.Archive
-	// }
+	if dec.EWASMInterpreter != nil {
+		c.EWASMInterpreter = *dec.EWASMInterpreter
+	}
+	if dec.EVMInterpreter != nil {
+		c.EVMInterpreter = *dec.EVMInterpreter
+	}
+	if dec.ConstantinopleOverride != nil {
+		c.ConstantinopleOverride = dec.ConstantinopleOverride
+	}
 	return nil
 }
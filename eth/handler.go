@@ -28,9 +28,11 @@ import (
 	"github.com/zeus-fyi/gochain/v4/common"
 	"github.com/zeus-fyi/gochain/v4/consensus"
 	"github.com/zeus-fyi/gochain/v4/core"
+	"github.com/zeus-fyi/gochain/v4/core/forkid"
 	"github.com/zeus-fyi/gochain/v4/core/types"
 	"github.com/zeus-fyi/gochain/v4/eth/downloader"
 	"github.com/zeus-fyi/gochain/v4/eth/fetcher"
+	"github.com/zeus-fyi/gochain/v4/eth/snap"
 	"github.com/zeus-fyi/gochain/v4/log"
 	"github.com/zeus-fyi/gochain/v4/p2p"
 	"github.com/zeus-fyi/gochain/v4/p2p/discover"
@@ -48,6 +50,10 @@ const (
 
 	// The smallest subset of peers to broadcast to.
 	minBroadcastPeers = 4
+
+	// maxTxRetrievals is the maximum number of announced transactions requested
+	// from, or served to, a peer at once.
+	maxTxRetrievals = 256
 )
 
 // errIncompatibleConfig is returned if the requested protocols and configs are
@@ -62,17 +68,21 @@ type ProtocolManager struct {
 	networkId uint64
 
 	fastSync  uint32 // Flag whether fast sync is enabled (gets disabled if we already have blocks)
+	snapSync  uint32 // Flag whether fast sync downloads the state by ranges first
 	acceptTxs uint32 // Flag whether we're considered synchronised (enables transaction processing)
 
 	txpool      txPool
 	blockchain  *core.BlockChain
 	chainconfig *params.ChainConfig
+	forkFilter  forkid.Filter // Fork ID filter, constant across the lifetime of the node
 	maxPeers    int
 
 	downloader *downloader.Downloader
 	fetcher    *fetcher.Fetcher
 	peers      *peerSet
 
+	privatePeers map[discover.NodeID]struct{} // Peers private transactions are forwarded to
+
 	SubProtocols []p2p.Protocol
 
 	eventMux     *core.InterfaceFeed
@@ -100,6 +110,7 @@ func NewProtocolManager(config *params.ChainConfig, mode downloader.SyncMode, ne
 		txpool:       txpool,
 		blockchain:   blockchain,
 		chainconfig:  config,
+		forkFilter:   forkid.NewFilter(blockchain),
 		peers:        newPeerSet(),
 		newPeerCh:    make(chan *peer),
 		noMorePeers:  make(chan struct{}),
@@ -108,10 +119,14 @@ func NewProtocolManager(config *params.ChainConfig, mode downloader.SyncMode, ne
 		minedBlockCh: make(chan interface{}, 32),
 	}
 	// Figure out whether to allow fast sync or not
-	if mode == downloader.FastSync && blockchain.CurrentBlock().NumberU64() > 0 {
+	if (mode == downloader.FastSync || mode == downloader.SnapSync) && blockchain.CurrentBlock().NumberU64() > 0 {
 		log.Warn("Blockchain not empty, fast sync disabled")
 		mode = downloader.FullSync
 	}
+	if mode == downloader.SnapSync {
+		manager.snapSync = uint32(1)
+		mode = downloader.FastSync
+	}
 	if mode == downloader.FastSync {
 		manager.fastSync = uint32(1)
 	}
@@ -148,6 +163,7 @@ func NewProtocolManager(config *params.ChainConfig, mode downloader.SyncMode, ne
 				}
 				return nil
 			},
+			Attributes: manager.enrEntries,
 		})
 	}
 	if len(manager.SubProtocols) == 0 {
@@ -156,6 +172,21 @@ func NewProtocolManager(config *params.ChainConfig, mode downloader.SyncMode, ne
 	// Construct the different synchronisation mechanisms
 	manager.downloader = downloader.New(mode, chaindb, manager.eventMux, blockchain, nil, manager.removePeer)
 
+	// Serve state ranges to snap syncing peers, and download from them
+	manager.SubProtocols = append(manager.SubProtocols, p2p.Protocol{
+		Name:    snap.ProtocolName,
+		Version: snap.ProtocolVersion,
+		Length:  snap.ProtocolLength,
+		Run: func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+			select {
+			case <-manager.quitSync:
+				return p2p.DiscQuitting
+			default:
+			}
+			return snap.Handle(blockchain.StateCache().TrieDB(), manager.downloader.SnapSyncer, snap.NewPeer(snap.ProtocolVersion, p, rw))
+		},
+	})
+
 	verifyHeader := func(header *types.Header) error {
 		return engine.VerifyHeader(blockchain, header)
 	}
@@ -176,6 +207,23 @@ func NewProtocolManager(config *params.ChainConfig, mode downloader.SyncMode, ne
 	return manager, nil
 }
 
+// SetPrivatePeers configures the peers, typically the known signers, which
+// private transactions are forwarded to and accepted from. Without any, private
+// transactions are only ever included by the local node. It must be called
+// before Start.
+func (pm *ProtocolManager) SetPrivatePeers(ids []discover.NodeID) {
+	pm.privatePeers = make(map[discover.NodeID]struct{}, len(ids))
+	for _, id := range ids {
+		pm.privatePeers[id] = struct{}{}
+	}
+}
+
+// isPrivatePeer reports whether private transactions may be exchanged with p.
+func (pm *ProtocolManager) isPrivatePeer(p *peer) bool {
+	_, ok := pm.privatePeers[p.ID()]
+	return ok
+}
+
 func (pm *ProtocolManager) removePeer(id string) {
 	// Short circuit if the peer was already removed
 	peer := pm.peers.Peer(id)
@@ -261,7 +309,8 @@ func (pm *ProtocolManager) handle(p *peer) error {
 		number  = head.Number.Uint64()
 		td      = pm.blockchain.GetTd(hash, number)
 	)
-	if err := p.Handshake(pm.networkId, td, hash, genesis.Hash()); err != nil {
+	forkID := forkid.NewID(pm.blockchain.Config(), genesis.Hash(), number)
+	if err := p.Handshake(pm.networkId, td, hash, genesis.Hash(), forkID, pm.forkFilter); err != nil {
 		p.Log().Debug("GoChain handshake failed", "err", err)
 		return err
 	}
@@ -315,7 +364,8 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 	case msg.Code == GetBlockHeadersMsg:
 		// Decode the complex header query
 		var query getBlockHeadersData
-		if err := msg.Decode(&query); err != nil {
+		id, err := decodeMsg(p, msg, &query)
+		if err != nil {
 			return errResp(ErrDecode, "%v: %v", msg, err)
 		}
 		hashMode := query.Origin.Hash != (common.Hash{})
@@ -397,13 +447,14 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 				query.Origin.Number += query.Skip + 1
 			}
 		}
-		return p.SendBlockHeaders(headers)
+		return p.ReplyBlockHeaders(id, headers)
 
 	case msg.Code == BlockHeadersMsg:
 		// A batch of headers arrived to one of our previous requests
 		var headers []*types.Header
-		if err := msg.Decode(&headers); err != nil {
-			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		id, ok, err := decodeResponse(p, msg, &headers)
+		if !ok {
+			return err
 		}
 		// Filter out any explicitly requested headers, deliver the rest to the downloader
 		filter := len(headers) == 1
@@ -412,7 +463,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			headers = pm.fetcher.FilterHeaders(p.id, headers, time.Now())
 		}
 		if len(headers) > 0 || !filter {
-			err := pm.downloader.DeliverHeaders(p.id, headers)
+			err := pm.downloader.DeliverHeaders(p.id, id, headers)
 			if err != nil {
 				log.Debug("Failed to deliver headers", "err", err)
 			}
@@ -420,9 +471,9 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 
 	case msg.Code == GetBlockBodiesMsg:
 		// Decode the retrieval message
-		msgStream := rlp.NewStream(msg.Payload, uint64(msg.Size))
+		msgStream, id, err := requestStream(p, msg)
 		defer rlp.Discard(msgStream)
-		if _, err := msgStream.List(); err != nil {
+		if err != nil {
 			return err
 		}
 		// Gather blocks until the fetch or network limits is reached
@@ -444,13 +495,14 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 				bytes += len(data)
 			}
 		}
-		return p.SendBlockBodiesRLP(bodies)
+		return p.ReplyBlockBodiesRLP(id, bodies)
 
 	case msg.Code == BlockBodiesMsg:
 		// A batch of block bodies arrived to one of our previous requests
 		var request blockBodiesData
-		if err := msg.Decode(&request); err != nil {
-			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		id, ok, err := decodeResponse(p, msg, &request)
+		if !ok {
+			return err
 		}
 		// Deliver them all to the downloader for queuing
 		trasactions := make([][]*types.Transaction, len(request))
@@ -463,7 +515,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			trasactions = pm.fetcher.FilterBodies(p.id, trasactions, time.Now())
 		}
 		if len(trasactions) > 0 {
-			err := pm.downloader.DeliverBodies(p.id, trasactions)
+			err := pm.downloader.DeliverBodies(p.id, id, trasactions)
 			if err != nil {
 				log.Debug("Failed to deliver bodies", "err", err)
 			}
@@ -471,9 +523,9 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 
 	case p.version >= eth63 && msg.Code == GetNodeDataMsg:
 		// Decode the retrieval message
-		msgStream := rlp.NewStream(msg.Payload, uint64(msg.Size))
+		msgStream, id, err := requestStream(p, msg)
 		defer rlp.Discard(msgStream)
-		if _, err := msgStream.List(); err != nil {
+		if err != nil {
 			return err
 		}
 		// Gather state data until the fetch or network limits is reached
@@ -495,24 +547,25 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 				bytes += len(entry)
 			}
 		}
-		return p.SendNodeData(data)
+		return p.ReplyNodeData(id, data)
 
 	case p.version >= eth63 && msg.Code == NodeDataMsg:
 		// A batch of node state data arrived to one of our previous requests
 		var data [][]byte
-		if err := msg.Decode(&data); err != nil {
-			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		id, ok, err := decodeResponse(p, msg, &data)
+		if !ok {
+			return err
 		}
 		// Deliver all to the downloader
-		if err := pm.downloader.DeliverNodeData(p.id, data); err != nil {
+		if err := pm.downloader.DeliverNodeData(p.id, id, data); err != nil {
 			log.Debug("Failed to deliver node state data", "err", err)
 		}
 
 	case p.version >= eth63 && msg.Code == GetReceiptsMsg:
 		// Decode the retrieval message
-		msgStream := rlp.NewStream(msg.Payload, uint64(msg.Size))
+		msgStream, id, err := requestStream(p, msg)
 		defer rlp.Discard(msgStream)
-		if _, err := msgStream.List(); err != nil {
+		if err != nil {
 			return err
 		}
 		// Gather state data until the fetch or network limits is reached
@@ -543,16 +596,17 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 				bytes += len(encoded)
 			}
 		}
-		return p.SendReceiptsRLP(receipts)
+		return p.ReplyReceiptsRLP(id, receipts)
 
 	case p.version >= eth63 && msg.Code == ReceiptsMsg:
 		// A batch of receipts arrived to one of our previous requests
 		var receipts [][]*types.Receipt
-		if err := msg.Decode(&receipts); err != nil {
-			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		id, ok, err := decodeResponse(p, msg, &receipts)
+		if !ok {
+			return err
 		}
 		// Deliver all to the downloader
-		if err := pm.downloader.DeliverReceipts(p.id, receipts); err != nil {
+		if err := pm.downloader.DeliverReceipts(p.id, id, receipts); err != nil {
 			log.Debug("Failed to deliver receipts", "err", err)
 		}
 
@@ -636,12 +690,160 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		}
 		pm.txpool.AddRemotes(txs)
 
+	case p.version >= eth66 && msg.Code == PrivateTxMsg:
+		// Private transactions were forwarded, add them as private so they are
+		// never gossiped any further. Only the configured private peers may
+		// forward them, others could make any transaction skip gossip.
+		if atomic.LoadUint32(&pm.acceptTxs) == 0 {
+			break
+		}
+		if !pm.isPrivatePeer(p) {
+			p.Log().Debug("Ignoring private transactions from non-private peer")
+			break
+		}
+		var txs privateTxData
+		if err := msg.Decode(&txs); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		for i, entry := range txs {
+			if entry.Tx == nil {
+				return errResp(ErrDecode, "transaction %d is nil", i)
+			}
+			p.MarkTransaction(entry.Tx.Hash())
+			if err := pm.txpool.AddPrivateRemote(entry.Tx, entry.MaxBlock); err != nil {
+				p.Log().Trace("Failed to add private transaction", "hash", entry.Tx.Hash(), "err", err)
+			}
+		}
+
+	case p.version >= eth65 && msg.Code == NewPooledTransactionHashesMsg:
+		// Transactions were announced, retrieve the ones we miss if synchronised
+		var hashes newPooledTransactionHashesData
+		if err := msg.Decode(&hashes); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		if atomic.LoadUint32(&pm.acceptTxs) == 0 {
+			break
+		}
+		var unknown []common.Hash
+		for _, hash := range hashes {
+			p.MarkTransaction(hash)
+			if len(unknown) < maxTxRetrievals && pm.txpool.Get(hash) == nil {
+				unknown = append(unknown, hash)
+			}
+		}
+		if len(unknown) > 0 {
+			return p.RequestTxs(unknown)
+		}
+
+	case p.version >= eth65 && msg.Code == GetPooledTransactionsMsg:
+		// Decode the retrieval message
+		msgStream, id, err := requestStream(p, msg)
+		defer rlp.Discard(msgStream)
+		if err != nil {
+			return err
+		}
+		// Gather transactions until the fetch or network limits is reached
+		var (
+			hash  common.Hash
+			bytes int
+			txs   []rlp.RawValue
+		)
+		for bytes < softResponseLimit && len(txs) < maxTxRetrievals {
+			// Retrieve the hash of the next transaction
+			if err := msgStream.Decode(&hash); err == rlp.EOL {
+				break
+			} else if err != nil {
+				return errResp(ErrDecode, "msg %v: %v", msg, err)
+			}
+			// Retrieve the requested transaction, never leaking private ones
+			tx := pm.txpool.Get(hash)
+			if tx == nil || (pm.txpool.IsPrivate(hash) && !pm.isPrivatePeer(p)) {
+				continue
+			}
+			if encoded, err := rlp.EncodeToBytes(tx); err != nil {
+				log.Error("Failed to encode transaction", "err", err)
+			} else {
+				txs = append(txs, encoded)
+				bytes += len(encoded)
+			}
+		}
+		return p.ReplyPooledTransactionsRLP(id, txs)
+
+	case p.version >= eth65 && msg.Code == PooledTransactionsMsg:
+		// A batch of transactions arrived to one of our previous requests
+		var txs []*types.Transaction
+		if _, ok, err := decodeResponse(p, msg, &txs); !ok {
+			return err
+		}
+		if atomic.LoadUint32(&pm.acceptTxs) == 0 {
+			break
+		}
+		for i, tx := range txs {
+			// Validate and mark the remote transaction
+			if tx == nil {
+				return errResp(ErrDecode, "transaction %d is nil", i)
+			}
+			p.MarkTransaction(tx.Hash())
+		}
+		pm.txpool.AddRemotes(txs)
+
 	default:
 		return errResp(ErrInvalidMsgCode, "%v", msg.Code)
 	}
 	return nil
 }
 
+// decodeMsg decodes the payload of msg into val, unwrapping the eth/66
+// envelope and returning the request id it carries, if the peer speaks it.
+func decodeMsg(p *peer, msg p2p.Msg, val interface{}) (uint64, error) {
+	if p.version < eth66 {
+		return 0, msg.Decode(val)
+	}
+	var packet packet66
+	if err := msg.Decode(&packet); err != nil {
+		return 0, err
+	}
+	return packet.RequestId, rlp.DecodeBytes(packet.Data, val)
+}
+
+// decodeResponse decodes the payload of a response into val, returning the
+// request id it carries. Over eth/66 the response is also matched against the
+// requests sent to the peer; false and no error is returned for an unsolicited
+// one, which must be dropped.
+func decodeResponse(p *peer, msg p2p.Msg, val interface{}) (uint64, bool, error) {
+	id, err := decodeMsg(p, msg, val)
+	if err != nil {
+		return 0, false, errResp(ErrDecode, "msg %v: %v", msg, err)
+	}
+	if p.version >= eth66 && !p.resolve(id, msg.Code) {
+		p.Log().Debug("Dropping unsolicited response", "msg", p2p.MsgCodeString(msg.Code), "reqid", id)
+		return 0, false, nil
+	}
+	return id, true, nil
+}
+
+// requestStream opens the list of hashes requested by msg for streamed
+// decoding, unwrapping the eth/66 envelope and returning the request id it
+// carries, if the peer speaks it.
+func requestStream(p *peer, msg p2p.Msg) (*rlp.Stream, uint64, error) {
+	var (
+		stream = rlp.NewStream(msg.Payload, uint64(msg.Size))
+		id     uint64
+	)
+	if p.version >= eth66 {
+		if _, err := stream.List(); err != nil {
+			return stream, 0, err
+		}
+		if err := stream.Decode(&id); err != nil {
+			return stream, 0, errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+	}
+	if _, err := stream.List(); err != nil {
+		return stream, 0, err
+	}
+	return stream, id, nil
+}
+
 // BroadcastBlock will either propagate a block to a subset of it's peers, or
 // will only announce it's availability (depending what's requested).
 func (pm *ProtocolManager) BroadcastBlock(block *types.Block, propagate bool) {
@@ -672,11 +874,56 @@ func (pm *ProtocolManager) BroadcastBlock(block *types.Block, propagate bool) {
 }
 
 // BroadcastTxs propagates a batch of transactions to a subset of peers which are not known to already have them.
+// Private transactions are only forwarded to the configured private peers, as private, so they don't gossip them
+// either. Private peers below eth/66, which can't tell private transactions apart, don't receive them at all.
 // Returns without blocking after launching each peer send in separate concurrent goroutines.
 func (pm *ProtocolManager) BroadcastTxs(txs types.Transactions) {
+	txs, private := pm.splitPrivate(txs)
 	for p, txs := range pm.peers.PeersWithoutTxs(txs) {
 		p.SendTransactionsAsync(txs)
 	}
+	if len(private) == 0 || len(pm.privatePeers) == 0 {
+		return
+	}
+	for p, txs := range pm.peers.PeersWithoutTxs(private) {
+		if !pm.isPrivatePeer(p) || p.version < eth66 {
+			continue
+		}
+		data := make(privateTxData, 0, len(txs))
+		for _, tx := range txs {
+			maxBlock, ok := pm.txpool.PrivateMaxBlock(tx.Hash())
+			if !ok {
+				continue // Dropped since
+			}
+			data = append(data, privateTx{Tx: tx, MaxBlock: maxBlock})
+		}
+		go func(p *peer) {
+			if err := p.SendPrivateTransactions(data); err != nil {
+				p.Log().Debug("Failed to forward private txs", "len", len(data), "err", err)
+			}
+		}(p)
+	}
+}
+
+// splitPrivate separates the transactions which may be gossiped from the ones
+// submitted privately. The original slice is returned if none are private.
+func (pm *ProtocolManager) splitPrivate(txs types.Transactions) (types.Transactions, types.Transactions) {
+	for i, tx := range txs {
+		if !pm.txpool.IsPrivate(tx.Hash()) {
+			continue
+		}
+		public := append(make(types.Transactions, 0, len(txs)), txs[:i]...)
+		private := types.Transactions{tx}
+		for _, tx := range txs[i+1:] {
+			if pm.txpool.IsPrivate(tx.Hash()) {
+				private = append(private, tx)
+			} else {
+				public = append(public, tx)
+			}
+		}
+		return public, private
+	}
+	return txs, nil
 }
 
 // Mined broadcast loop
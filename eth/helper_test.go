@@ -31,6 +31,7 @@ import (
 	"github.com/zeus-fyi/gochain/v4/common/hexutil"
 	"github.com/zeus-fyi/gochain/v4/consensus/clique"
 	"github.com/zeus-fyi/gochain/v4/core"
+	"github.com/zeus-fyi/gochain/v4/core/forkid"
 	"github.com/zeus-fyi/gochain/v4/core/types"
 	"github.com/zeus-fyi/gochain/v4/core/vm"
 	"github.com/zeus-fyi/gochain/v4/crypto"
@@ -89,9 +90,10 @@ func newTestProtocolManagerMust(t *testing.T, mode downloader.SyncMode, blocks i
 
 // testTxPool is a fake, helper transaction pool for testing purposes
 type testTxPool struct {
-	txFeed core.NewTxsFeed
-	pool   []*types.Transaction        // Collection of all transactions
-	added  chan<- []*types.Transaction // Notification channel for new transactions
+	txFeed  core.NewTxsFeed
+	pool    []*types.Transaction        // Collection of all transactions
+	private map[common.Hash]uint64      // Max blocks of the private transactions
+	added   chan<- []*types.Transaction // Notification channel for new transactions
 
 	lock sync.RWMutex // Protects the transaction pool
 }
@@ -133,6 +135,49 @@ func (p *testTxPool) PendingList() types.Transactions {
 	return pending
 }
 
+// AddPrivateRemote appends a private transaction to the pool, and notifies any
+// listeners if the addition channel is non nil
+func (p *testTxPool) AddPrivateRemote(tx *types.Transaction, maxBlock uint64) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.pool = append(p.pool, tx)
+	if p.private == nil {
+		p.private = make(map[common.Hash]uint64)
+	}
+	p.private[tx.Hash()] = maxBlock
+	if p.added != nil {
+		p.added <- []*types.Transaction{tx}
+	}
+	return nil
+}
+
+func (p *testTxPool) IsPrivate(hash common.Hash) bool {
+	_, ok := p.PrivateMaxBlock(hash)
+	return ok
+}
+
+func (p *testTxPool) PrivateMaxBlock(hash common.Hash) (uint64, bool) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	maxBlock, ok := p.private[hash]
+	return maxBlock, ok
+}
+
+// Get returns the transaction with the given hash from the pool, or nil.
+func (p *testTxPool) Get(hash common.Hash) *types.Transaction {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	for _, tx := range p.pool {
+		if tx.Hash() == hash {
+			return tx
+		}
+	}
+	return nil
+}
+
 func (p *testTxPool) SubscribeNewTxsEvent(ch chan<- core.NewTxsEvent, name string) {
 	p.txFeed.Subscribe(ch, name)
 }
@@ -184,21 +229,31 @@ func newTestPeer(name string, version int, pm *ProtocolManager, shake bool) (*te
 			head    = pm.blockchain.CurrentHeader()
 			td      = pm.blockchain.GetTd(head.Hash(), head.Number.Uint64())
 		)
-		tp.handshake(nil, td, head.Hash(), genesis.Hash())
+		tp.handshake(nil, td, head.Hash(), genesis.Hash(), forkid.NewID(pm.blockchain.Config(), genesis.Hash(), head.Number.Uint64()))
 	}
 	return tp, errc
 }
 
 // handshake simulates a trivial handshake that expects the same state from the
 // remote side as we are simulating locally.
-func (p *testPeer) handshake(t *testing.T, td *big.Int, head common.Hash, genesis common.Hash) {
-	msg := &statusData{
+func (p *testPeer) handshake(t *testing.T, td *big.Int, head common.Hash, genesis common.Hash, forkID forkid.ID) {
+	var msg interface{} = &statusData{
 		ProtocolVersion: uint32(p.version),
 		NetworkId:       DefaultConfig.NetworkId,
 		TD:              td,
 		CurrentBlock:    head,
 		GenesisBlock:    genesis,
 	}
+	if p.version >= eth64 {
+		msg = &statusData64{
+			ProtocolVersion: uint32(p.version),
+			NetworkId:       DefaultConfig.NetworkId,
+			TD:              td,
+			CurrentBlock:    head,
+			GenesisBlock:    genesis,
+			ForkID:          forkID,
+		}
+	}
 	if err := p2p.ExpectMsg(p.app, StatusMsg, msg); err != nil {
 		t.Fatalf("status recv: %v", err)
 	}
@@ -25,7 +25,9 @@ import (
 	"time"
 
 	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/core/forkid"
 	"github.com/zeus-fyi/gochain/v4/core/types"
+	"github.com/zeus-fyi/gochain/v4/eth/downloader"
 	"github.com/zeus-fyi/gochain/v4/log"
 	"github.com/zeus-fyi/gochain/v4/p2p"
 	"github.com/zeus-fyi/gochain/v4/rlp"
@@ -55,6 +57,14 @@ const (
 	// maxQueuedAnns is the maximum number of block announcements to queue up before
 	// dropping broadcasts.
 	maxQueuedAnns = 32
+
+	// maxPendingRequests is the number of eth/66 requests awaiting a response
+	// above which expired ones are forgotten.
+	maxPendingRequests = 256
+
+	// requestExpiry is the time after which an unanswered eth/66 request is
+	// considered lost, its late response being dropped.
+	requestExpiry = time.Minute
 )
 
 // PeerInfo represents a short summary of the GoChain sub-protocol metadata known
@@ -132,6 +142,12 @@ func (s *knownHashes) Has(h common.Hash) bool {
 	return ok
 }
 
+// pendingRequest is an eth/66 request awaiting its response.
+type pendingRequest struct {
+	code uint64    // Message code of the expected response
+	sent time.Time // Time the request was sent, to expire it
+}
+
 // propEvent is a block propagation, waiting for its turn in the broadcast queue.
 type propEvent struct {
 	block *types.Block
@@ -151,6 +167,10 @@ type peer struct {
 	td   *big.Int
 	lock sync.RWMutex
 
+	reqID       uint64                    // Last request id issued over eth/66
+	pending     map[uint64]pendingRequest // Requests awaiting a response over eth/66
+	pendingLock sync.Mutex
+
 	knownTxs    knownHashes // Set of transaction hashes known to be known by this peer
 	knownBlocks knownHashes // Set of block hashes known to be known by this peer
 
@@ -166,6 +186,7 @@ func newPeer(version int, p *p2p.Peer, rw p2p.MsgReadWriter) *peer {
 		rw:          rw,
 		version:     version,
 		id:          fmt.Sprintf("%x", p.ID().Bytes()[:8]),
+		pending:     make(map[uint64]pendingRequest),
 		knownTxs:    knownHashes{cap: maxKnownTxs, forgetInterval: forgetTxsInterval},
 		knownBlocks: knownHashes{cap: maxKnownBlocks},
 		queuedTxs:   make(chan types.Transactions, maxQueuedTxs),
@@ -192,7 +213,7 @@ func (p *peer) broadcast() {
 					break batchLoop
 				}
 			}
-			if err := p.SendTransactions(txs); err != nil {
+			if err := p.broadcastTransactions(txs); err != nil {
 				if err != p2p.ErrShuttingDown {
 					p.Log().Error("Failed to broadcast txs", "len", len(txs), "err", err)
 				}
@@ -220,6 +241,30 @@ func (p *peer) broadcast() {
 	}
 }
 
+// broadcastTransactions sends txs to the peer in full over protocols before
+// eth/65, and otherwise only announces them, in batches the remote peer can
+// retrieve at once.
+func (p *peer) broadcastTransactions(txs types.Transactions) error {
+	if p.version < eth65 {
+		return p.SendTransactions(txs)
+	}
+	hashes := make([]common.Hash, len(txs))
+	for i, tx := range txs {
+		hashes[i] = tx.Hash()
+	}
+	for len(hashes) > 0 {
+		n := len(hashes)
+		if n > maxTxRetrievals {
+			n = maxTxRetrievals
+		}
+		if err := p.SendPooledTransactionHashes(hashes[:n]); err != nil {
+			return err
+		}
+		hashes = hashes[n:]
+	}
+	return nil
+}
+
 // Close signals the broadcast goroutine to terminate.
 func (p *peer) Close() {
 	close(p.term)
@@ -277,6 +322,18 @@ func (p *peer) SendTransactions(txs types.Transactions) error {
 	return nil
 }
 
+// SendPrivateTransactions forwards private transactions to the peer, which is
+// expected not to propagate them any further, and marks them as known.
+func (p *peer) SendPrivateTransactions(txs privateTxData) error {
+	if err := p2p.Send(p.rw, PrivateTxMsg, txs); err != nil {
+		return err
+	}
+	for _, entry := range txs {
+		p.knownTxs.Add(entry.Tx.Hash())
+	}
+	return nil
+}
+
 // SendTransactionsAsync queues txs for broadcast, or drops them if the queue is full.
 func (p *peer) SendTransactionsAsync(txs types.Transactions) {
 	select {
@@ -334,81 +391,230 @@ func (p *peer) SendNewBlock(block *types.Block, td *big.Int) error {
 	return nil
 }
 
-// SendBlockHeaders sends a batch of block headers to the remote peer.
-func (p *peer) SendBlockHeaders(headers []*types.Header) error {
-	return p2p.Send(p.rw, BlockHeadersMsg, headers)
+// SendPooledTransactionHashes announces the availability of a batch of
+// transactions over eth/65 and later, leaving the retrieval to the remote peer.
+func (p *peer) SendPooledTransactionHashes(hashes []common.Hash) error {
+	if err := p2p.Send(p.rw, NewPooledTransactionHashesMsg, hashes); err != nil {
+		return err
+	}
+	for _, hash := range hashes {
+		p.knownTxs.Add(hash)
+	}
+	return nil
+}
+
+// ReplyBlockHeaders sends a batch of block headers to the remote peer, in
+// response to the request with the given id.
+func (p *peer) ReplyBlockHeaders(id uint64, headers []*types.Header) error {
+	return p.reply(BlockHeadersMsg, id, headers)
+}
+
+// ReplyBlockBodiesRLP sends a batch of block contents to the remote peer from
+// an already RLP encoded format, in response to the request with the given id.
+func (p *peer) ReplyBlockBodiesRLP(id uint64, bodies []rlp.RawValue) error {
+	return p.reply(BlockBodiesMsg, id, bodies)
 }
 
-// SendBlockBodiesRLP sends a batch of block contents to the remote peer from
-// an already RLP encoded format.
-func (p *peer) SendBlockBodiesRLP(bodies []rlp.RawValue) error {
-	return p2p.Send(p.rw, BlockBodiesMsg, bodies)
+// ReplyNodeData sends a batch of arbitrary internal data, corresponding to the
+// hashes requested by the request with the given id.
+func (p *peer) ReplyNodeData(id uint64, data [][]byte) error {
+	return p.reply(NodeDataMsg, id, data)
 }
 
-// SendNodeDataRLP sends a batch of arbitrary internal data, corresponding to the
-// hashes requested.
-func (p *peer) SendNodeData(data [][]byte) error {
-	return p2p.Send(p.rw, NodeDataMsg, data)
+// ReplyReceiptsRLP sends a batch of transaction receipts, corresponding to the
+// ones requested from an already RLP encoded format, in response to the
+// request with the given id.
+func (p *peer) ReplyReceiptsRLP(id uint64, receipts []rlp.RawValue) error {
+	return p.reply(ReceiptsMsg, id, receipts)
 }
 
-// SendReceiptsRLP sends a batch of transaction receipts, corresponding to the
-// ones requested from an already RLP encoded format.
-func (p *peer) SendReceiptsRLP(receipts []rlp.RawValue) error {
-	return p2p.Send(p.rw, ReceiptsMsg, receipts)
+// ReplyPooledTransactionsRLP sends a batch of pooled transactions from an
+// already RLP encoded format, in response to the request with the given id.
+func (p *peer) ReplyPooledTransactionsRLP(id uint64, txs []rlp.RawValue) error {
+	return p.reply(PooledTransactionsMsg, id, txs)
 }
 
 // RequestOneHeader is a wrapper around the header query functions to fetch a
 // single header. It is used solely by the fetcher.
 func (p *peer) RequestOneHeader(hash common.Hash) error {
 	p.Log().Debug("Fetching single header", "hash", hash)
-	return p2p.Send(p.rw, GetBlockHeadersMsg,
+	return p.request(GetBlockHeadersMsg, BlockHeadersMsg,
 		&getBlockHeadersData{Origin: hashOrNumber{Hash: hash}, Amount: uint64(1), Skip: uint64(0), Reverse: false})
 }
 
 // RequestHeadersByHash fetches a batch of blocks' headers corresponding to the
 // specified header query, based on the hash of an origin block.
 func (p *peer) RequestHeadersByHash(origin common.Hash, amount int, skip int, reverse bool) error {
-	p.Log().Debug("Fetching batch of headers", "count", amount, "fromhash", origin, "skip", skip, "reverse", reverse)
-	return p2p.Send(p.rw, GetBlockHeadersMsg,
-		&getBlockHeadersData{Origin: hashOrNumber{Hash: origin}, Amount: uint64(amount), Skip: uint64(skip), Reverse: reverse})
+	return p.tagged().RequestHeadersByHash(origin, amount, skip, reverse)
 }
 
 // RequestHeadersByNumber fetches a batch of blocks' headers corresponding to the
 // specified header query, based on the number of an origin block.
 func (p *peer) RequestHeadersByNumber(origin uint64, amount int, skip int, reverse bool) error {
-	p.Log().Debug("Fetching batch of headers", "count", amount, "fromnum", origin, "skip", skip, "reverse", reverse)
-	return p2p.Send(p.rw, GetBlockHeadersMsg,
-		&getBlockHeadersData{Origin: hashOrNumber{Number: origin}, Amount: uint64(amount), Skip: uint64(skip), Reverse: reverse})
+	return p.tagged().RequestHeadersByNumber(origin, amount, skip, reverse)
 }
 
 // RequestBodies fetches a batch of blocks' bodies corresponding to the hashes
 // specified.
 func (p *peer) RequestBodies(hashes []common.Hash) error {
-	p.Log().Debug("Fetching batch of block bodies", "count", len(hashes))
-	return p2p.Send(p.rw, GetBlockBodiesMsg, hashes)
+	return p.tagged().RequestBodies(hashes)
 }
 
 // RequestNodeData fetches a batch of arbitrary data from a node's known state
 // data, corresponding to the specified hashes.
 func (p *peer) RequestNodeData(hashes []common.Hash) error {
-	p.Log().Debug("Fetching batch of state data", "count", len(hashes))
-	return p2p.Send(p.rw, GetNodeDataMsg, hashes)
+	return p.tagged().RequestNodeData(hashes)
 }
 
 // RequestReceipts fetches a batch of transaction receipts from a remote node.
 func (p *peer) RequestReceipts(hashes []common.Hash) error {
-	p.Log().Debug("Fetching batch of receipts", "count", len(hashes))
-	return p2p.Send(p.rw, GetReceiptsMsg, hashes)
+	return p.tagged().RequestReceipts(hashes)
+}
+
+// Tag returns the peer sending the downloader's requests under a fresh eth/66
+// request id, along with the id, so that the responses can be matched to them.
+// Responses over older protocols carry no id, matching zero.
+func (p *peer) Tag() (downloader.Peer, uint64) {
+	if p.version < eth66 {
+		return p, 0
+	}
+	t := p.tagged()
+	return t, t.id
+}
+
+// tagged returns the peer sending requests under a fresh request id.
+func (p *peer) tagged() *taggedPeer {
+	return &taggedPeer{peer: p, id: p.nextRequestID()}
+}
+
+// taggedPeer sends the requests of the downloader to a peer under a fixed
+// request id over eth/66.
+type taggedPeer struct {
+	*peer
+	id uint64
+}
+
+func (t *taggedPeer) RequestHeadersByHash(origin common.Hash, amount int, skip int, reverse bool) error {
+	t.Log().Debug("Fetching batch of headers", "count", amount, "fromhash", origin, "skip", skip, "reverse", reverse)
+	return t.requestAs(t.id, GetBlockHeadersMsg, BlockHeadersMsg,
+		&getBlockHeadersData{Origin: hashOrNumber{Hash: origin}, Amount: uint64(amount), Skip: uint64(skip), Reverse: reverse})
+}
+
+func (t *taggedPeer) RequestHeadersByNumber(origin uint64, amount int, skip int, reverse bool) error {
+	t.Log().Debug("Fetching batch of headers", "count", amount, "fromnum", origin, "skip", skip, "reverse", reverse)
+	return t.requestAs(t.id, GetBlockHeadersMsg, BlockHeadersMsg,
+		&getBlockHeadersData{Origin: hashOrNumber{Number: origin}, Amount: uint64(amount), Skip: uint64(skip), Reverse: reverse})
+}
+
+func (t *taggedPeer) RequestBodies(hashes []common.Hash) error {
+	t.Log().Debug("Fetching batch of block bodies", "count", len(hashes))
+	return t.requestAs(t.id, GetBlockBodiesMsg, BlockBodiesMsg, hashes)
+}
+
+func (t *taggedPeer) RequestNodeData(hashes []common.Hash) error {
+	t.Log().Debug("Fetching batch of state data", "count", len(hashes))
+	return t.requestAs(t.id, GetNodeDataMsg, NodeDataMsg, hashes)
+}
+
+func (t *taggedPeer) RequestReceipts(hashes []common.Hash) error {
+	t.Log().Debug("Fetching batch of receipts", "count", len(hashes))
+	return t.requestAs(t.id, GetReceiptsMsg, ReceiptsMsg, hashes)
+}
+
+// RequestTxs fetches a batch of announced transactions from the remote pool.
+func (p *peer) RequestTxs(hashes []common.Hash) error {
+	p.Log().Debug("Fetching batch of transactions", "count", len(hashes))
+	return p.request(GetPooledTransactionsMsg, PooledTransactionsMsg, hashes)
+}
+
+// nextRequestID allocates a fresh eth/66 request id.
+func (p *peer) nextRequestID() uint64 {
+	p.pendingLock.Lock()
+	defer p.pendingLock.Unlock()
+
+	p.reqID++
+	return p.reqID
+}
+
+// request sends a request message under a fresh request id.
+func (p *peer) request(code, resCode uint64, data interface{}) error {
+	return p.requestAs(p.nextRequestID(), code, resCode, data)
+}
+
+// requestAs sends a request message, wrapped with the given request id over
+// eth/66 so that its response can be matched by resolve.
+func (p *peer) requestAs(id, code, resCode uint64, data interface{}) error {
+	if p.version < eth66 {
+		return p2p.Send(p.rw, code, data)
+	}
+	now := time.Now()
+
+	p.pendingLock.Lock()
+	if len(p.pending) >= maxPendingRequests {
+		for old, req := range p.pending {
+			if now.Sub(req.sent) > requestExpiry {
+				delete(p.pending, old)
+			}
+		}
+	}
+	p.pending[id] = pendingRequest{code: resCode, sent: now}
+	p.pendingLock.Unlock()
+
+	return p.send66(code, id, data)
+}
+
+// resolve marks the eth/66 request with the given id as answered by a response
+// of the given code, reporting whether such a request was awaiting one.
+func (p *peer) resolve(id, code uint64) bool {
+	p.pendingLock.Lock()
+	defer p.pendingLock.Unlock()
+
+	req, ok := p.pending[id]
+	if !ok || req.code != code {
+		return false
+	}
+	delete(p.pending, id)
+	return true
+}
+
+// reply sends a response message, wrapped with the id of the request it
+// answers over eth/66.
+func (p *peer) reply(code, id uint64, data interface{}) error {
+	if p.version < eth66 {
+		return p2p.Send(p.rw, code, data)
+	}
+	return p.send66(code, id, data)
+}
+
+// send66 sends a message wrapped in the eth/66 request id envelope.
+func (p *peer) send66(code, id uint64, data interface{}) error {
+	enc, err := rlp.EncodeToBytes(data)
+	if err != nil {
+		return err
+	}
+	return p2p.Send(p.rw, code, &packet66{RequestId: id, Data: enc})
 }
 
 // Handshake executes the eth protocol handshake, negotiating version number,
-// network IDs, difficulties, head and genesis blocks.
-func (p *peer) Handshake(network uint64, td *big.Int, head common.Hash, genesis common.Hash) error {
+// network IDs, difficulties, head and genesis blocks. From eth/64 on, the fork
+// IDs are exchanged too, the remote one being validated by forkFilter.
+func (p *peer) Handshake(network uint64, td *big.Int, head common.Hash, genesis common.Hash, forkID forkid.ID, forkFilter forkid.Filter) error {
 	// Send out own handshake in a new thread
 	errc := make(chan error, 2)
 	var status statusData // safe to read after two values have been received from errc
 
 	go func() {
+		if p.version >= eth64 {
+			errc <- p2p.Send(p.rw, StatusMsg, &statusData64{
+				ProtocolVersion: uint32(p.version),
+				NetworkId:       network,
+				TD:              td,
+				CurrentBlock:    head,
+				GenesisBlock:    genesis,
+				ForkID:          forkID,
+			})
+			return
+		}
 		errc <- p2p.Send(p.rw, StatusMsg, &statusData{
 			ProtocolVersion: uint32(p.version),
 			NetworkId:       network,
@@ -418,7 +624,7 @@ func (p *peer) Handshake(network uint64, td *big.Int, head common.Hash, genesis
 		})
 	}()
 	go func() {
-		errc <- p.readStatus(network, &status, genesis)
+		errc <- p.readStatus(network, &status, genesis, forkFilter)
 	}()
 	timeout := time.NewTimer(handshakeTimeout)
 	defer timeout.Stop()
@@ -436,7 +642,7 @@ func (p *peer) Handshake(network uint64, td *big.Int, head common.Hash, genesis
 	return nil
 }
 
-func (p *peer) readStatus(network uint64, status *statusData, genesis common.Hash) (err error) {
+func (p *peer) readStatus(network uint64, status *statusData, genesis common.Hash, forkFilter forkid.Filter) (err error) {
 	msg, err := p.rw.ReadMsg()
 	if err != nil {
 		return err
@@ -448,7 +654,24 @@ func (p *peer) readStatus(network uint64, status *statusData, genesis common.Has
 		return errResp(ErrMsgTooLarge, "%v > %v", msg.Size, ProtocolMaxMsgSize)
 	}
 	// Decode the handshake and make sure everything matches
-	if err := msg.Decode(&status); err != nil {
+	if p.version >= eth64 {
+		var status64 statusData64
+		if err := msg.Decode(&status64); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		if status64.GenesisBlock == genesis {
+			if err := forkFilter(status64.ForkID); err != nil {
+				return errResp(ErrForkIDRejected, "%v", err)
+			}
+		}
+		*status = statusData{
+			ProtocolVersion: status64.ProtocolVersion,
+			NetworkId:       status64.NetworkId,
+			TD:              status64.TD,
+			CurrentBlock:    status64.CurrentBlock,
+			GenesisBlock:    status64.GenesisBlock,
+		}
+	} else if err := msg.Decode(&status); err != nil {
 		return errResp(ErrDecode, "msg %v: %v", msg, err)
 	}
 	if status.GenesisBlock != genesis {
@@ -25,6 +25,7 @@ import (
 
 	"github.com/zeus-fyi/gochain/v4/common"
 	"github.com/zeus-fyi/gochain/v4/core"
+	"github.com/zeus-fyi/gochain/v4/core/forkid"
 	"github.com/zeus-fyi/gochain/v4/core/types"
 	"github.com/zeus-fyi/gochain/v4/rlp"
 )
@@ -33,16 +34,19 @@ import (
 const (
 	eth62 = 62
 	eth63 = 63
+	eth64 = 64
+	eth65 = 65
+	eth66 = 66
 )
 
 // Official short name of the protocol used during capability negotiation.
 var ProtocolName = "eth"
 
 // Supported versions of the eth protocol (first is primary).
-var ProtocolVersions = []uint{eth63, eth62}
+var ProtocolVersions = []uint{eth66, eth65, eth64, eth63, eth62}
 
 // Number of implemented message corresponding to different protocol versions.
-var ProtocolLengths = []uint64{17, 8}
+var ProtocolLengths = []uint64{17, 17, 17, 17, 8}
 
 const ProtocolMaxMsgSize = 10 * 1024 * 1024 // Maximum cap on the size of a protocol message
 
@@ -63,6 +67,14 @@ const (
 	NodeDataMsg    = p2p.NodeDataMsg
 	GetReceiptsMsg = p2p.GetReceiptsMsg
 	ReceiptsMsg    = p2p.ReceiptsMsg
+
+	// Protocol messages belonging to eth/65
+	NewPooledTransactionHashesMsg = p2p.NewPooledTransactionHashesMsg
+	GetPooledTransactionsMsg      = p2p.GetPooledTransactionsMsg
+	PooledTransactionsMsg         = p2p.PooledTransactionsMsg
+
+	// GoChain extension belonging to eth/66, forwarding private transactions
+	PrivateTxMsg = p2p.PrivateTxMsg
 )
 
 type errCode int
@@ -77,6 +89,7 @@ const (
 	ErrNoStatusMsg
 	ErrExtraStatusMsg
 	ErrSuspendedPeer
+	ErrForkIDRejected
 )
 
 func (e errCode) String() string {
@@ -94,6 +107,7 @@ var errorToString = map[int]string{
 	ErrNoStatusMsg:             "No status message",
 	ErrExtraStatusMsg:          "Extra status message",
 	ErrSuspendedPeer:           "Suspended peer",
+	ErrForkIDRejected:          "Fork ID rejected",
 }
 
 type txPool interface {
@@ -107,6 +121,20 @@ type txPool interface {
 	// PendingList is like Pending, but only txs.
 	PendingList() types.Transactions
 
+	// AddPrivateRemote should add a private transaction forwarded by a peer,
+	// dropping it once the chain passes maxBlock unless zero.
+	AddPrivateRemote(tx *types.Transaction, maxBlock uint64) error
+
+	// IsPrivate should report whether a transaction must not be gossiped.
+	IsPrivate(hash common.Hash) bool
+
+	// PrivateMaxBlock should return the max block of a private transaction, and
+	// whether it's private.
+	PrivateMaxBlock(hash common.Hash) (uint64, bool)
+
+	// Get should return the pooled transaction with the given hash, or nil.
+	Get(hash common.Hash) *types.Transaction
+
 	// SubscribeNewTxsEvent should return an event subscription of
 	// NewTxsEvent and send events to the given channel.
 	SubscribeNewTxsEvent(chan<- core.NewTxsEvent, string)
@@ -122,6 +150,17 @@ type statusData struct {
 	GenesisBlock    common.Hash
 }
 
+// statusData64 is the network packet for the status message for eth/64 and
+// later, advertising the fork ID of the chain.
+type statusData64 struct {
+	ProtocolVersion uint32
+	NetworkId       uint64
+	TD              *big.Int
+	CurrentBlock    common.Hash
+	GenesisBlock    common.Hash
+	ForkID          forkid.ID
+}
+
 // newBlockHashesData is the network packet for the block announcements.
 type newBlockHashesData []struct {
 	Hash   common.Hash // Hash of one particular block being announced
@@ -186,3 +225,24 @@ type blockBody struct {
 
 // blockBodiesData is the network packet for block content distribution.
 type blockBodiesData []*blockBody
+
+// privateTxData is the network packet for forwarding private transactions to
+// the private peers, which must not gossip them any further.
+type privateTxData []privateTx
+
+// privateTx is a private transaction along with its inclusion deadline.
+type privateTx struct {
+	Tx       *types.Transaction // Private transaction being forwarded
+	MaxBlock uint64             // Block after which the transaction is dropped (0 = never)
+}
+
+// packet66 is the eth/66 envelope of request and response messages, pairing
+// the original packet with the id of the request it belongs to.
+type packet66 struct {
+	RequestId uint64
+	Data      rlp.RawValue
+}
+
+// newPooledTransactionHashesData is the network packet for the eth/65 pooled
+// transaction announcements.
+type newPooledTransactionHashesData []common.Hash
@@ -18,15 +18,18 @@ package eth
 
 import (
 	"fmt"
+	"math/big"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/core/forkid"
 	"github.com/zeus-fyi/gochain/v4/core/types"
 	"github.com/zeus-fyi/gochain/v4/crypto"
 	"github.com/zeus-fyi/gochain/v4/eth/downloader"
 	"github.com/zeus-fyi/gochain/v4/p2p"
+	"github.com/zeus-fyi/gochain/v4/p2p/discover"
 	"github.com/zeus-fyi/gochain/v4/rlp"
 )
 
@@ -39,6 +42,8 @@ var testAccount, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6
 // Tests that handshake failures are detected and reported correctly.
 func TestStatusMsgErrors62(t *testing.T) { testStatusMsgErrors(t, 62) }
 func TestStatusMsgErrors63(t *testing.T) { testStatusMsgErrors(t, 63) }
+func TestStatusMsgErrors64(t *testing.T) { testStatusMsgErrors(t, 64) }
+func TestStatusMsgErrors66(t *testing.T) { testStatusMsgErrors(t, 66) }
 
 func testStatusMsgErrors(t *testing.T, protocol int) {
 	pm, _ := newTestProtocolManagerMust(t, downloader.FullSync, 0, nil, nil)
@@ -46,9 +51,18 @@ func testStatusMsgErrors(t *testing.T, protocol int) {
 		genesis = pm.blockchain.Genesis()
 		head    = pm.blockchain.CurrentHeader()
 		td      = pm.blockchain.GetTd(head.Hash(), head.Number.Uint64())
+		forkID  = forkid.NewID(pm.blockchain.Config(), genesis.Hash(), head.Number.Uint64())
 	)
 	defer pm.Stop()
 
+	// Advertise the fork ID from eth/64 on
+	status := func(version uint32, network uint64, td *big.Int, head, genesis common.Hash) interface{} {
+		if protocol >= eth64 {
+			return statusData64{version, network, td, head, genesis, forkID}
+		}
+		return statusData{version, network, td, head, genesis}
+	}
+
 	tests := []struct {
 		code      uint64
 		data      interface{}
@@ -59,18 +73,28 @@ func testStatusMsgErrors(t *testing.T, protocol int) {
 			wantError: errResp(ErrNoStatusMsg, "first msg has code 2 (!= 0)"),
 		},
 		{
-			code: StatusMsg, data: statusData{10, DefaultConfig.NetworkId, td, head.Hash(), genesis.Hash()},
+			code: StatusMsg, data: status(10, DefaultConfig.NetworkId, td, head.Hash(), genesis.Hash()),
 			wantError: errResp(ErrProtocolVersionMismatch, "10 (!= %d)", protocol),
 		},
 		{
-			code: StatusMsg, data: statusData{uint32(protocol), 999, td, head.Hash(), genesis.Hash()},
+			code: StatusMsg, data: status(uint32(protocol), 999, td, head.Hash(), genesis.Hash()),
 			wantError: errResp(ErrNetworkIdMismatch, "999 (!= %d)", DefaultConfig.NetworkId),
 		},
 		{
-			code: StatusMsg, data: statusData{uint32(protocol), DefaultConfig.NetworkId, td, head.Hash(), common.Hash{3}},
+			code: StatusMsg, data: status(uint32(protocol), DefaultConfig.NetworkId, td, head.Hash(), common.Hash{3}),
 			wantError: errResp(ErrGenesisBlockMismatch, "0300000000000000 (!= %x)", genesis.Hash().Bytes()[:8]),
 		},
 	}
+	if protocol >= eth64 {
+		tests = append(tests, struct {
+			code      uint64
+			data      interface{}
+			wantError error
+		}{
+			code: StatusMsg, data: statusData64{uint32(protocol), DefaultConfig.NetworkId, td, head.Hash(), genesis.Hash(), forkid.ID{Hash: [4]byte{0xde, 0xad, 0xbe, 0xef}}},
+			wantError: errResp(ErrForkIDRejected, "%v", forkid.ErrLocalIncompatibleOrStale),
+		})
+	}
 
 	for i, test := range tests {
 		p, errc := newTestPeer("peer", protocol, pm, false)
@@ -95,6 +119,7 @@ func testStatusMsgErrors(t *testing.T, protocol int) {
 // This test checks that received transactions are added to the local pool.
 func TestRecvTransactions62(t *testing.T) { testRecvTransactions(t, 62) }
 func TestRecvTransactions63(t *testing.T) { testRecvTransactions(t, 63) }
+func TestRecvTransactions66(t *testing.T) { testRecvTransactions(t, 66) }
 
 func testRecvTransactions(t *testing.T, protocol int) {
 	txAdded := make(chan []*types.Transaction)
@@ -123,6 +148,7 @@ func testRecvTransactions(t *testing.T, protocol int) {
 // This test checks that pending transactions are sent.
 func TestSendTransactions62(t *testing.T) { testSendTransactions(t, 62) }
 func TestSendTransactions63(t *testing.T) { testSendTransactions(t, 63) }
+func TestSendTransactions66(t *testing.T) { testSendTransactions(t, 66) }
 
 func testSendTransactions(t *testing.T, protocol int) {
 	pm, _ := newTestProtocolManagerMust(t, downloader.FullSync, 0, nil, nil)
@@ -178,6 +204,189 @@ func testSendTransactions(t *testing.T, protocol int) {
 	wg.Wait()
 }
 
+// This test checks that broadcast transactions are announced to eth/65+ peers
+// and sent in full to older ones.
+func TestBroadcastTransactions63(t *testing.T) { testBroadcastTransactions(t, 63) }
+func TestBroadcastTransactions65(t *testing.T) { testBroadcastTransactions(t, 65) }
+func TestBroadcastTransactions66(t *testing.T) { testBroadcastTransactions(t, 66) }
+
+func testBroadcastTransactions(t *testing.T, protocol int) {
+	pm, _ := newTestProtocolManagerMust(t, downloader.FullSync, 0, nil, nil)
+	p, _ := newTestPeer("peer", protocol, pm, true)
+	defer pm.Stop()
+	defer p.close()
+
+	// Wait for the peer to be registered before broadcasting
+	for deadline := time.Now().Add(time.Second); pm.peers.Len() == 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	tx := newTestTransaction(testAccount, 0, 0)
+	pm.BroadcastTxs(types.Transactions{tx})
+
+	var err error
+	if protocol >= eth65 {
+		err = p2p.ExpectMsg(p.app, NewPooledTransactionHashesMsg, []common.Hash{tx.Hash()})
+	} else {
+		err = p2p.ExpectMsg(p.app, TxMsg, []*types.Transaction{tx})
+	}
+	if err != nil {
+		t.Errorf("broadcast mismatch: %v", err)
+	}
+}
+
+// This test checks that private transactions forwarded by a private peer are kept
+// private: they are only forwarded on to the private peers, never gossiped to the
+// others. Private transactions from other peers are ignored.
+func TestRecvPrivateTransactions66(t *testing.T) {
+	txAdded := make(chan []*types.Transaction)
+	pm, _ := newTestProtocolManagerMust(t, downloader.FullSync, 0, nil, txAdded)
+	pm.acceptTxs = 1 // mark synced to accept transactions
+	source, _ := newTestPeer("source", eth66, pm, true)
+	signer, _ := newTestPeer("signer", eth66, pm, true)
+	bystander, _ := newTestPeer("bystander", eth66, pm, true)
+	defer pm.Stop()
+	defer source.close()
+	defer signer.close()
+	defer bystander.close()
+
+	pm.SetPrivatePeers([]discover.NodeID{source.ID(), signer.ID()})
+
+	tx := newTestTransaction(testAccount, 0, 0)
+	forwarded := privateTxData{{Tx: tx, MaxBlock: 5}}
+	if err := p2p.Send(bystander.app, PrivateTxMsg, forwarded); err != nil {
+		t.Fatalf("send error: %v", err)
+	}
+	select {
+	case <-txAdded:
+		t.Fatalf("private transaction of non-private peer added")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if err := p2p.Send(source.app, PrivateTxMsg, forwarded); err != nil {
+		t.Fatalf("send error: %v", err)
+	}
+	select {
+	case <-txAdded:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("private transaction not added within 2 seconds")
+	}
+	if maxBlock, ok := pm.txpool.PrivateMaxBlock(tx.Hash()); !ok || maxBlock != 5 {
+		t.Fatalf("private transaction mismatch: have %d, %v, want 5, true", maxBlock, ok)
+	}
+	// Broadcast the private transaction as the pool would, then a public one: the
+	// first message of the public peer must be the announcement of the latter
+	for deadline := time.Now().Add(time.Second); pm.peers.Len() < 3 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	pm.BroadcastTxs(types.Transactions{tx})
+	if err := p2p.ExpectMsg(signer.app, PrivateTxMsg, forwarded); err != nil {
+		t.Errorf("private peer: %v", err)
+	}
+	public := newTestTransaction(testAccount, 1, 0)
+	pm.BroadcastTxs(types.Transactions{public})
+	if err := p2p.ExpectMsg(bystander.app, NewPooledTransactionHashesMsg, []common.Hash{public.Hash()}); err != nil {
+		t.Errorf("public peer: %v", err)
+	}
+}
+
+// This test checks that announced transactions are retrieved from the peer.
+func TestRecvPooledTransactions65(t *testing.T) { testRecvPooledTransactions(t, 65) }
+func TestRecvPooledTransactions66(t *testing.T) { testRecvPooledTransactions(t, 66) }
+
+func testRecvPooledTransactions(t *testing.T, protocol int) {
+	txAdded := make(chan []*types.Transaction)
+	pm, _ := newTestProtocolManagerMust(t, downloader.FullSync, 0, nil, txAdded)
+	pm.acceptTxs = 1 // mark synced to accept transactions
+	p, _ := newTestPeer("peer", protocol, pm, true)
+	defer pm.Stop()
+	defer p.close()
+
+	tx := newTestTransaction(testAccount, 0, 0)
+	if err := p2p.Send(p.app, NewPooledTransactionHashesMsg, []common.Hash{tx.Hash()}); err != nil {
+		t.Fatalf("send error: %v", err)
+	}
+	// The announced transaction must be requested and accepted once delivered
+	msg, err := p.app.ReadMsg()
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	if msg.Code != GetPooledTransactionsMsg {
+		t.Fatalf("got code %d, want GetPooledTransactionsMsg", msg.Code)
+	}
+	var hashes []common.Hash
+	id, err := decodeMsg(p.peer, msg, &hashes)
+	if err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if len(hashes) != 1 || hashes[0] != tx.Hash() {
+		t.Fatalf("requested hashes mismatch: have %x, want [%x]", hashes, tx.Hash())
+	}
+	var reply interface{} = []*types.Transaction{tx}
+	if protocol >= eth66 {
+		enc, _ := rlp.EncodeToBytes(reply)
+		reply = &packet66{RequestId: id, Data: enc}
+	}
+	if err := p2p.Send(p.app, PooledTransactionsMsg, reply); err != nil {
+		t.Fatalf("send error: %v", err)
+	}
+	select {
+	case added := <-txAdded:
+		if len(added) != 1 || added[0].Hash() != tx.Hash() {
+			t.Errorf("added transactions mismatch: got %v, want [%x]", added, tx.Hash())
+		}
+	case <-time.After(2 * time.Second):
+		t.Errorf("no NewTxsEvent received within 2 seconds")
+	}
+}
+
+// Tests that eth/66 requests are answered with the id they were sent with.
+func TestRequestID66(t *testing.T) {
+	pm, _ := newTestProtocolManagerMust(t, downloader.FullSync, 4, nil, nil)
+	p, _ := newTestPeer("peer", eth66, pm, true)
+	defer pm.Stop()
+	defer p.close()
+
+	query, _ := rlp.EncodeToBytes(&getBlockHeadersData{Origin: hashOrNumber{Number: 1}, Amount: 2})
+	if err := p2p.Send(p.app, GetBlockHeadersMsg, &packet66{RequestId: 42, Data: query}); err != nil {
+		t.Fatalf("send error: %v", err)
+	}
+	headers, _ := rlp.EncodeToBytes([]*types.Header{pm.blockchain.GetHeaderByNumber(1), pm.blockchain.GetHeaderByNumber(2)})
+	if err := p2p.ExpectMsg(p.app, BlockHeadersMsg, &packet66{RequestId: 42, Data: headers}); err != nil {
+		t.Errorf("headers mismatch: %v", err)
+	}
+}
+
+// Tests that eth/66 responses are only accepted once, for requests actually
+// sent and of the matching kind.
+func TestPendingRequests66(t *testing.T) {
+	app, net := p2p.MsgPipe()
+	defer app.Close()
+
+	p := newPeer(eth66, p2p.NewPeer(discover.NodeID{}, "peer", nil), net)
+	go p.RequestBodies([]common.Hash{{0x01}})
+
+	msg, err := app.ReadMsg()
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	var hashes []common.Hash
+	id, err := decodeMsg(p, msg, &hashes)
+	if err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if p.resolve(id+1, BlockBodiesMsg) {
+		t.Error("response to an unknown request accepted")
+	}
+	if p.resolve(id, ReceiptsMsg) {
+		t.Error("response of the wrong kind accepted")
+	}
+	if !p.resolve(id, BlockBodiesMsg) {
+		t.Error("response to the request rejected")
+	}
+	if p.resolve(id, BlockBodiesMsg) {
+		t.Error("second response to the request accepted")
+	}
+}
+
 // Tests that the custom union field encoder and decoder works correctly.
 func TestGetBlockHeadersDataEncodeDecode(t *testing.T) {
 	// Create a "random" hash for testing
@@ -0,0 +1,267 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snap
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/core/state"
+	"github.com/zeus-fyi/gochain/v4/p2p"
+	"github.com/zeus-fyi/gochain/v4/rlp"
+	"github.com/zeus-fyi/gochain/v4/trie"
+)
+
+const (
+	// softResponseLimit is the maximum size of a response served, regardless
+	// of the size requested.
+	softResponseLimit = 2 * 1024 * 1024
+
+	// maxCodeLookups is the maximum number of codes served per request.
+	maxCodeLookups = 1024
+
+	// maxStorageAccounts is the maximum number of accounts whose storage is
+	// served per request, bounding the trie lookups of accounts without any.
+	maxStorageAccounts = 1024
+)
+
+// Handle registers the peer with the syncer, if any, and serves it the snap
+// protocol from the state in triedb until the connection fails.
+func Handle(triedb *trie.Database, syncer *Syncer, peer *Peer) error {
+	if syncer != nil {
+		syncer.Register(peer)
+		defer syncer.Unregister(peer.ID())
+	}
+	for {
+		if err := handleMessage(triedb, syncer, peer); err != nil {
+			peer.Log().Debug("Message handling failed in snap", "err", err)
+			return err
+		}
+	}
+}
+
+// handleMessage serves or delivers the next message of the peer.
+func handleMessage(triedb *trie.Database, syncer *Syncer, peer *Peer) error {
+	msg, err := peer.rw.ReadMsg()
+	if err != nil {
+		return err
+	}
+	if msg.Size > ProtocolMaxMsgSize {
+		return fmt.Errorf("message too large: %v > %v", msg.Size, ProtocolMaxMsgSize)
+	}
+	defer msg.Discard()
+
+	switch msg.Code {
+	case GetAccountRangeMsg:
+		var req GetAccountRangePacket
+		if err := msg.Decode(&req); err != nil {
+			return fmt.Errorf("msg %v: %v", msg, err)
+		}
+		return p2p.Send(peer.rw, AccountRangeMsg, ServiceGetAccountRange(triedb, &req))
+
+	case AccountRangeMsg:
+		res := new(AccountRangePacket)
+		if err := msg.Decode(res); err != nil {
+			return fmt.Errorf("msg %v: %v", msg, err)
+		}
+		if syncer != nil {
+			syncer.deliver(peer.ID(), res.ID, res)
+		}
+
+	case GetStorageRangesMsg:
+		var req GetStorageRangesPacket
+		if err := msg.Decode(&req); err != nil {
+			return fmt.Errorf("msg %v: %v", msg, err)
+		}
+		return p2p.Send(peer.rw, StorageRangesMsg, ServiceGetStorageRanges(triedb, &req))
+
+	case StorageRangesMsg:
+		res := new(StorageRangesPacket)
+		if err := msg.Decode(res); err != nil {
+			return fmt.Errorf("msg %v: %v", msg, err)
+		}
+		if syncer != nil {
+			syncer.deliver(peer.ID(), res.ID, res)
+		}
+
+	case GetByteCodesMsg:
+		var req GetByteCodesPacket
+		if err := msg.Decode(&req); err != nil {
+			return fmt.Errorf("msg %v: %v", msg, err)
+		}
+		return p2p.Send(peer.rw, ByteCodesMsg, ServiceGetByteCodes(triedb, &req))
+
+	case ByteCodesMsg:
+		res := new(ByteCodesPacket)
+		if err := msg.Decode(res); err != nil {
+			return fmt.Errorf("msg %v: %v", msg, err)
+		}
+		if syncer != nil {
+			syncer.deliver(peer.ID(), res.ID, res)
+		}
+
+	default:
+		return fmt.Errorf("invalid message code %d", msg.Code)
+	}
+	return nil
+}
+
+// responseLimit caps the requested response size.
+func responseLimit(size uint64) uint64 {
+	if size > softResponseLimit {
+		return softResponseLimit
+	}
+	return size
+}
+
+// ServiceGetAccountRange assembles the response to an account range request.
+// If the state is unavailable, the response is empty.
+func ServiceGetAccountRange(triedb *trie.Database, req *GetAccountRangePacket) *AccountRangePacket {
+	res := &AccountRangePacket{ID: req.ID}
+
+	tr, err := trie.New(req.Root, triedb)
+	if err != nil {
+		return res
+	}
+	var (
+		limit    = responseLimit(req.Bytes)
+		size     uint64
+		accounts []*AccountData
+		it       = trie.NewIterator(tr.NodeIterator(req.Origin[:]))
+	)
+	for it.Next() {
+		hash := common.BytesToHash(it.Key)
+		accounts = append(accounts, &AccountData{Hash: hash, Body: common.CopyBytes(it.Value)})
+		size += common.HashLength + uint64(len(it.Value))
+
+		// The first account beyond the limit is included, proving none between
+		if bytes.Compare(hash[:], req.Limit[:]) >= 0 || size >= limit {
+			break
+		}
+	}
+	if it.Err != nil {
+		return res
+	}
+	var proof proofList
+	if err := tr.Prove(req.Origin[:], 0, &proof); err != nil {
+		return res
+	}
+	if len(accounts) > 0 {
+		if err := tr.Prove(accounts[len(accounts)-1].Hash[:], 0, &proof); err != nil {
+			return res
+		}
+	}
+	res.Accounts, res.Proof = accounts, proof
+	return res
+}
+
+// ServiceGetStorageRanges assembles the response to a storage ranges request.
+// Accounts are served in full until the size or account limit is reached, only
+// the last one possibly partially and proven; serving stops at the first
+// account whose storage is unavailable.
+func ServiceGetStorageRanges(triedb *trie.Database, req *GetStorageRangesPacket) *StorageRangesPacket {
+	res := &StorageRangesPacket{ID: req.ID}
+
+	accTrie, err := trie.New(req.Root, triedb)
+	if err != nil {
+		return res
+	}
+	var (
+		limit = responseLimit(req.Bytes)
+		size  uint64
+	)
+	for i, account := range req.Accounts {
+		if i >= maxStorageAccounts || size >= limit {
+			break
+		}
+		enc, err := accTrie.TryGet(account[:])
+		if err != nil || len(enc) == 0 {
+			break
+		}
+		var acc state.Account
+		if err := rlp.DecodeBytes(enc, &acc); err != nil {
+			break
+		}
+		storeTrie, err := trie.New(acc.Root, triedb)
+		if err != nil {
+			break
+		}
+		var origin common.Hash
+		if i == 0 {
+			origin = req.Origin
+		}
+		var (
+			slots   []*StorageData
+			partial = origin != (common.Hash{})
+			it      = trie.NewIterator(storeTrie.NodeIterator(origin[:]))
+		)
+		for it.Next() {
+			slots = append(slots, &StorageData{Hash: common.BytesToHash(it.Key), Body: common.CopyBytes(it.Value)})
+			size += common.HashLength + uint64(len(it.Value))
+			if size >= limit {
+				partial = true
+				break
+			}
+		}
+		if it.Err != nil {
+			break
+		}
+		res.Slots = append(res.Slots, slots)
+
+		// A partial range ends the response, proven by its edges
+		if partial {
+			var proof proofList
+			if err := storeTrie.Prove(origin[:], 0, &proof); err != nil {
+				res.Slots = res.Slots[:len(res.Slots)-1]
+				break
+			}
+			if len(slots) > 0 {
+				if err := storeTrie.Prove(slots[len(slots)-1].Hash[:], 0, &proof); err != nil {
+					res.Slots = res.Slots[:len(res.Slots)-1]
+					break
+				}
+			}
+			res.Proof = proof
+			break
+		}
+	}
+	return res
+}
+
+// ServiceGetByteCodes assembles the response to a code request, stopping at the
+// first code which is unavailable.
+func ServiceGetByteCodes(triedb *trie.Database, req *GetByteCodesPacket) *ByteCodesPacket {
+	res := &ByteCodesPacket{ID: req.ID}
+
+	var (
+		limit = responseLimit(req.Bytes)
+		size  uint64
+	)
+	for i, hash := range req.Hashes {
+		if i >= maxCodeLookups || size >= limit {
+			break
+		}
+		code, err := triedb.Node(hash)
+		if err != nil || len(code) == 0 {
+			break
+		}
+		res.Codes = append(res.Codes, code)
+		size += uint64(len(code))
+	}
+	return res
+}
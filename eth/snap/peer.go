@@ -0,0 +1,94 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snap
+
+import (
+	"fmt"
+
+	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/log"
+	"github.com/zeus-fyi/gochain/v4/p2p"
+)
+
+// Peer is a remote peer speaking the snap protocol.
+type Peer struct {
+	id string
+
+	*p2p.Peer
+	rw      p2p.MsgReadWriter
+	version uint
+
+	logger log.Logger
+}
+
+// NewPeer wraps a p2p peer running the snap protocol.
+func NewPeer(version uint, p *p2p.Peer, rw p2p.MsgReadWriter) *Peer {
+	id := p.ID()
+	return &Peer{
+		id:      fmt.Sprintf("%x", id[:8]),
+		Peer:    p,
+		rw:      rw,
+		version: version,
+		logger:  log.New("peer", fmt.Sprintf("%x", id[:8])),
+	}
+}
+
+// ID returns the identifier of the peer, matching the one used by the eth
+// protocol.
+func (p *Peer) ID() string {
+	return p.id
+}
+
+// Log overrides the p2p logger with the shortened identifier.
+func (p *Peer) Log() log.Logger {
+	return p.logger
+}
+
+// RequestAccountRange fetches a range of accounts of the state of root.
+func (p *Peer) RequestAccountRange(id uint64, root, origin, limit common.Hash, bytes uint64) error {
+	p.logger.Trace("Fetching range of accounts", "reqid", id, "root", root, "origin", origin, "limit", limit, "bytes", bytes)
+	return p2p.Send(p.rw, GetAccountRangeMsg, &GetAccountRangePacket{
+		ID:     id,
+		Root:   root,
+		Origin: origin,
+		Limit:  limit,
+		Bytes:  bytes,
+	})
+}
+
+// RequestStorageRanges fetches the storage slots of a list of accounts of the
+// state of root, the first one's from origin onwards.
+func (p *Peer) RequestStorageRanges(id uint64, root common.Hash, accounts []common.Hash, origin common.Hash, bytes uint64) error {
+	p.logger.Trace("Fetching ranges of storage slots", "reqid", id, "root", root, "accounts", len(accounts), "origin", origin, "bytes", bytes)
+	return p2p.Send(p.rw, GetStorageRangesMsg, &GetStorageRangesPacket{
+		ID:       id,
+		Root:     root,
+		Accounts: accounts,
+		Origin:   origin,
+		Bytes:    bytes,
+	})
+}
+
+// RequestByteCodes fetches a batch of contract codes by hash.
+func (p *Peer) RequestByteCodes(id uint64, hashes []common.Hash, bytes uint64) error {
+	p.logger.Trace("Fetching contract codes", "reqid", id, "hashes", len(hashes), "bytes", bytes)
+	return p2p.Send(p.rw, GetByteCodesMsg, &GetByteCodesPacket{
+		ID:     id,
+		Hashes: hashes,
+		Bytes:  bytes,
+	})
+}
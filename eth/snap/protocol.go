@@ -0,0 +1,126 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package snap implements a state synchronisation protocol downloading the
+// accounts and storage slots of a state in contiguous ranges of their trie,
+// each proven against the state root by the Merkle proofs of its edges,
+// rather than node by node.
+package snap
+
+import (
+	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/rlp"
+)
+
+// Official short name of the protocol used during capability negotiation.
+const ProtocolName = "snap"
+
+// ProtocolVersion is the only supported version of the protocol.
+const ProtocolVersion = 1
+
+// ProtocolLength is the number of implemented message codes.
+const ProtocolLength = 6
+
+// ProtocolMaxMsgSize is the maximum cap on the size of a protocol message.
+const ProtocolMaxMsgSize = 10 * 1024 * 1024
+
+// snap protocol message codes
+const (
+	GetAccountRangeMsg  = 0x00
+	AccountRangeMsg     = 0x01
+	GetStorageRangesMsg = 0x02
+	StorageRangesMsg    = 0x03
+	GetByteCodesMsg     = 0x04
+	ByteCodesMsg        = 0x05
+)
+
+// GetAccountRangePacket requests the accounts of the state trie of Root from
+// Origin onwards, up to Limit, or until the response reaches Bytes.
+type GetAccountRangePacket struct {
+	ID     uint64      // Request ID to match up the response
+	Root   common.Hash // Root of the state trie to serve
+	Origin common.Hash // Hash of the first account to retrieve
+	Limit  common.Hash // Hash of the last account to retrieve
+	Bytes  uint64      // Soft limit on the response size
+}
+
+// AccountRangePacket is the response to GetAccountRangePacket. The accounts
+// are sorted by hash, the first one following the requested origin and the
+// last one possibly beyond the requested limit. The proof contains the nodes
+// on the paths to the origin and the last account.
+type AccountRangePacket struct {
+	ID       uint64
+	Accounts []*AccountData
+	Proof    [][]byte
+}
+
+// AccountData is an account of a range, keyed by the hash of its address and
+// encoded as in the state trie.
+type AccountData struct {
+	Hash common.Hash
+	Body rlp.RawValue
+}
+
+// GetStorageRangesPacket requests the storage slots of a list of accounts of
+// the state of Root. The slots of the first account are retrieved from Origin
+// onwards, all others in full, until the response reaches Bytes.
+type GetStorageRangesPacket struct {
+	ID       uint64
+	Root     common.Hash
+	Accounts []common.Hash
+	Origin   common.Hash
+	Bytes    uint64
+}
+
+// StorageRangesPacket is the response to GetStorageRangesPacket, holding the
+// slots of a prefix of the requested accounts. All but the last account are
+// served in full; if the slots of the last one are incomplete, the proof
+// contains the nodes on the paths to its origin and last slot.
+type StorageRangesPacket struct {
+	ID    uint64
+	Slots [][]*StorageData
+	Proof [][]byte
+}
+
+// StorageData is a storage slot of a range, keyed by the hash of its key and
+// encoded as in the storage trie.
+type StorageData struct {
+	Hash common.Hash
+	Body []byte
+}
+
+// GetByteCodesPacket requests contract codes by hash.
+type GetByteCodesPacket struct {
+	ID     uint64
+	Hashes []common.Hash
+	Bytes  uint64
+}
+
+// ByteCodesPacket is the response to GetByteCodesPacket, holding the codes of
+// a prefix of the requested hashes which the peer has, in order.
+type ByteCodesPacket struct {
+	ID    uint64
+	Codes [][]byte
+}
+
+// proofList collects the nodes of Merkle proofs in order.
+type proofList [][]byte
+
+// Put implements common.Putter.
+func (l *proofList) Put(key []byte, value []byte) error {
+	*l = append(*l, common.CopyBytes(value))
+	return nil
+}
@@ -0,0 +1,691 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snap
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/core/state"
+	"github.com/zeus-fyi/gochain/v4/core/types"
+	"github.com/zeus-fyi/gochain/v4/crypto"
+	"github.com/zeus-fyi/gochain/v4/ethdb"
+	"github.com/zeus-fyi/gochain/v4/log"
+	"github.com/zeus-fyi/gochain/v4/rlp"
+	"github.com/zeus-fyi/gochain/v4/trie"
+)
+
+const (
+	// accountConcurrency is the number of segments of the account hash space
+	// synced concurrently.
+	accountConcurrency = 16
+
+	// requestSize is the response size requested from peers.
+	requestSize = 512 * 1024
+
+	// maxStorageRequestCount is the maximum number of accounts whose storage
+	// is requested at once.
+	maxStorageRequestCount = 128
+
+	// maxCodeRequestCount is the maximum number of codes requested at once.
+	maxCodeRequestCount = 64
+
+	// requestTimeout is the time allowed for a peer to respond.
+	requestTimeout = 10 * time.Second
+
+	// peerWaitTimeout is the time to wait for a peer able to serve the state
+	// before giving up.
+	peerWaitTimeout = 30 * time.Second
+)
+
+var (
+	// ErrCancelled is returned if the sync is cancelled.
+	ErrCancelled = errors.New("sync cancelled")
+
+	// errNoPeers is returned if no peer is able to serve the state.
+	errNoPeers = errors.New("no peers to sync state from")
+
+	errTimeout     = errors.New("request timed out")
+	errPeerDropped = errors.New("peer dropped")
+)
+
+var emptyCode = crypto.Keccak256Hash(nil)
+
+// accountTask is a segment of the account hash space to sync.
+type accountTask struct {
+	next common.Hash // Next account hash to sync
+	last common.Hash // Last account hash of the segment
+	root common.Hash // Root of the trie of the accounts synced so far
+	done bool
+}
+
+// storageTask is the storage trie of an account to sync.
+type storageTask struct {
+	account common.Hash // Hash of the account owning the storage
+	root    common.Hash // Storage root to sync
+	next    common.Hash // Next slot hash to sync
+	partial common.Hash // Root of the trie of the slots synced so far
+}
+
+// request is an in-flight request to a peer.
+type request struct {
+	peer string
+	res  chan interface{} // Response, or nil if the peer dropped
+}
+
+// Syncer downloads the state of a root from snap peers by ranges of accounts
+// and storage slots, verifying each range against the root with the proofs of
+// its edges.
+//
+// The trie nodes of each range are rebuilt locally and only written after the
+// storage and code of its accounts, so every node present in the database has
+// its full subtree present too. This allows a regular trie sync of the root to
+// heal the nodes on the edges of the ranges and those of states which changed
+// meanwhile, visiting just the missing ones. The progress is kept across sync
+// runs, so the root may be moved without starting over.
+type Syncer struct {
+	db     common.Table
+	triedb *trie.Database
+
+	root  common.Hash    // Root of the current sync
+	tasks []*accountTask // Progress of the account segments
+
+	peers     map[string]*Peer    // Connected peers
+	idle      map[string]struct{} // Peers free to serve requests, only tracked while syncing
+	stateless map[string]struct{} // Peers unable to serve the current root
+	running   bool                // Whether a sync is in progress
+	wake      chan struct{}       // Closed when a peer becomes available
+	pending   map[uint64]*request // In-flight requests by ID
+	nextID    uint64              // ID of the next request
+	lock      sync.Mutex          // Protects the peer and request sets
+
+	accounts, slots, codes, size uint64 // Statistics of the data synced
+}
+
+// NewSyncer creates a syncer writing into the global table of db.
+func NewSyncer(db common.Database) *Syncer {
+	return &Syncer{
+		db:        db.GlobalTable(),
+		triedb:    trie.NewDatabase(db.GlobalTable()),
+		peers:     make(map[string]*Peer),
+		idle:      make(map[string]struct{}),
+		stateless: make(map[string]struct{}),
+		wake:      make(chan struct{}),
+		pending:   make(map[uint64]*request),
+	}
+}
+
+// Register adds a peer to download from. Outside of a sync, the peer is only
+// tracked as connected until the next sync starts.
+func (s *Syncer) Register(p *Peer) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.peers[p.ID()] = p
+	if s.running {
+		s.idle[p.ID()] = struct{}{}
+		s.notify()
+	}
+}
+
+// Unregister removes a peer, failing its in-flight requests.
+func (s *Syncer) Unregister(id string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.peers, id)
+	delete(s.idle, id)
+	for reqID, req := range s.pending {
+		if req.peer == id {
+			req.res <- nil
+			delete(s.pending, reqID)
+		}
+	}
+}
+
+// notify wakes up the tasks waiting for a peer. The lock must be held.
+func (s *Syncer) notify() {
+	close(s.wake)
+	s.wake = make(chan struct{})
+}
+
+// Sync downloads the state of root until all accounts are synced, the sync is
+// cancelled, or no peer is able to serve it. Accounts synced by previous runs,
+// even for other roots, are not downloaded again.
+func (s *Syncer) Sync(root common.Hash, cancel chan struct{}) error {
+	s.lock.Lock()
+	if s.tasks == nil {
+		s.tasks = newAccountTasks()
+	}
+	if s.root != root {
+		s.root = root
+		s.stateless = make(map[string]struct{})
+	}
+	// Take the connected peers into use until the sync ends
+	s.running = true
+	for id := range s.peers {
+		s.idle[id] = struct{}{}
+	}
+	s.lock.Unlock()
+
+	defer func() {
+		s.lock.Lock()
+		s.running = false
+		s.idle = make(map[string]struct{})
+		s.lock.Unlock()
+	}()
+
+	var (
+		abort     = make(chan struct{})
+		abortOnce sync.Once
+		errc      = make(chan error, len(s.tasks))
+		running   int
+		start     = time.Now()
+	)
+	closeAbort := func() { abortOnce.Do(func() { close(abort) }) }
+	defer closeAbort()
+
+	for _, task := range s.tasks {
+		if !task.done {
+			running++
+			go func(task *accountTask) { errc <- s.syncAccounts(task, root, abort) }(task)
+		}
+	}
+	if running == 0 {
+		return nil
+	}
+	log.Info("Starting snap state sync", "root", root, "segments", running)
+
+	ticker := time.NewTicker(8 * time.Second)
+	defer ticker.Stop()
+
+	var err error
+	for running > 0 {
+		select {
+		case terr := <-errc:
+			running--
+			if terr != nil && err == nil {
+				err = terr
+				closeAbort()
+			}
+		case <-cancel:
+			if err == nil {
+				err = ErrCancelled
+			}
+			closeAbort()
+			cancel = nil
+		case <-ticker.C:
+			s.report(start, running)
+		}
+	}
+	s.report(start, running)
+	return err
+}
+
+// report logs the progress of the sync.
+func (s *Syncer) report(start time.Time, running int) {
+	log.Info("Snap syncing state", "segments", fmt.Sprintf("%d/%d", len(s.tasks)-running, len(s.tasks)),
+		"accounts", atomic.LoadUint64(&s.accounts), "slots", atomic.LoadUint64(&s.slots),
+		"codes", atomic.LoadUint64(&s.codes), "size", common.StorageSize(atomic.LoadUint64(&s.size)),
+		"elapsed", common.PrettyDuration(time.Since(start)))
+}
+
+// newAccountTasks splits the account hash space into equal segments.
+func newAccountTasks() []*accountTask {
+	var (
+		tasks []*accountTask
+		next  = new(big.Int)
+		step  = new(big.Int).Div(new(big.Int).Lsh(common.Big1, 256), big.NewInt(accountConcurrency))
+	)
+	for i := 0; i < accountConcurrency; i++ {
+		last := new(big.Int).Sub(new(big.Int).Add(next, step), common.Big1)
+		if i == accountConcurrency-1 {
+			last = new(big.Int).Sub(new(big.Int).Lsh(common.Big1, 256), common.Big1)
+		}
+		tasks = append(tasks, &accountTask{
+			next: common.BigToHash(next),
+			last: common.BigToHash(last),
+			root: types.EmptyRootHash,
+		})
+		next = new(big.Int).Add(last, common.Big1)
+	}
+	return tasks
+}
+
+// incHash returns the hash following h, reporting false on overflow.
+func incHash(h common.Hash) (common.Hash, bool) {
+	for i := len(h) - 1; i >= 0; i-- {
+		h[i]++
+		if h[i] != 0 {
+			return h, true
+		}
+	}
+	return h, false
+}
+
+// proofDB collects proof nodes into a database keyed by their hashes.
+func proofDB(proof [][]byte) *ethdb.MemDatabase {
+	db := ethdb.NewMemDatabase()
+	for _, node := range proof {
+		db.Put(crypto.Keccak256(node), node)
+	}
+	return db
+}
+
+// acquire waits for an idle peer able to serve the current root and reserves
+// it, giving up if there has been none for a while.
+func (s *Syncer) acquire(abort chan struct{}) (*Peer, error) {
+	deadline := time.Now().Add(peerWaitTimeout)
+	for {
+		s.lock.Lock()
+		usable := false
+		for id, p := range s.peers {
+			if _, ok := s.stateless[id]; ok {
+				continue
+			}
+			usable = true
+			if _, ok := s.idle[id]; ok {
+				delete(s.idle, id)
+				s.lock.Unlock()
+				return p, nil
+			}
+		}
+		wake := s.wake
+		s.lock.Unlock()
+
+		if usable {
+			deadline = time.Now().Add(peerWaitTimeout)
+		}
+		timer := time.NewTimer(time.Until(deadline))
+		select {
+		case <-wake:
+			timer.Stop()
+		case <-abort:
+			timer.Stop()
+			return nil, ErrCancelled
+		case <-timer.C:
+			if !usable {
+				return nil, errNoPeers
+			}
+		}
+	}
+}
+
+// release returns a reserved peer to the idle set, marking it unable to serve
+// the current root if it failed.
+func (s *Syncer) release(p *Peer, failed bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if failed {
+		s.stateless[p.ID()] = struct{}{}
+	}
+	if _, ok := s.peers[p.ID()]; ok && s.running {
+		s.idle[p.ID()] = struct{}{}
+		s.notify()
+	}
+}
+
+// request sends a request to the peer and waits for its response.
+func (s *Syncer) request(p *Peer, send func(id uint64) error, abort chan struct{}) (interface{}, error) {
+	s.lock.Lock()
+	s.nextID++
+	id := s.nextID
+	req := &request{peer: p.ID(), res: make(chan interface{}, 1)}
+	s.pending[id] = req
+	s.lock.Unlock()
+
+	defer func() {
+		s.lock.Lock()
+		delete(s.pending, id)
+		s.lock.Unlock()
+	}()
+	if err := send(id); err != nil {
+		return nil, err
+	}
+	timer := time.NewTimer(requestTimeout)
+	defer timer.Stop()
+
+	select {
+	case res := <-req.res:
+		if res == nil {
+			return nil, errPeerDropped
+		}
+		return res, nil
+	case <-timer.C:
+		return nil, errTimeout
+	case <-abort:
+		return nil, ErrCancelled
+	}
+}
+
+// deliver hands a response over to the request waiting for it.
+func (s *Syncer) deliver(peer string, id uint64, res interface{}) {
+	s.lock.Lock()
+	req := s.pending[id]
+	if req == nil || req.peer != peer {
+		s.lock.Unlock()
+		log.Debug("Unrequested snap response", "peer", peer, "reqid", id)
+		return
+	}
+	delete(s.pending, id)
+	s.lock.Unlock()
+
+	req.res <- res
+}
+
+// fetch reserves a peer, sends it a request and validates the response with
+// process, retrying with other peers until it succeeds.
+func (s *Syncer) fetch(send func(p *Peer, id uint64) error, process func(res interface{}) error, abort chan struct{}) error {
+	for {
+		p, err := s.acquire(abort)
+		if err != nil {
+			return err
+		}
+		res, err := s.request(p, func(id uint64) error { return send(p, id) }, abort)
+		if err == ErrCancelled {
+			s.release(p, false)
+			return err
+		}
+		if err == nil {
+			err = process(res)
+		}
+		if err != nil {
+			p.Log().Debug("Snap request failed", "err", err)
+			s.release(p, true)
+			continue
+		}
+		s.release(p, false)
+		return nil
+	}
+}
+
+// syncAccounts downloads the accounts of a segment, with their storage and
+// code, until the segment is complete.
+func (s *Syncer) syncAccounts(task *accountTask, root common.Hash, abort chan struct{}) error {
+	for !task.done {
+		var (
+			keys, values [][]byte
+			more         bool
+		)
+		send := func(p *Peer, id uint64) error {
+			return p.RequestAccountRange(id, root, task.next, task.last, requestSize)
+		}
+		process := func(res interface{}) error {
+			packet, ok := res.(*AccountRangePacket)
+			if !ok {
+				return fmt.Errorf("unexpected response %T", res)
+			}
+			keys, values = make([][]byte, len(packet.Accounts)), make([][]byte, len(packet.Accounts))
+			for i, acc := range packet.Accounts {
+				keys[i], values[i] = common.CopyBytes(acc.Hash[:]), acc.Body
+			}
+			last := task.next[:]
+			if len(keys) > 0 {
+				last = keys[len(keys)-1]
+			}
+			var err error
+			more, err = trie.VerifyRangeProof(root, task.next[:], last, keys, values, proofDB(packet.Proof))
+			return err
+		}
+		if err := s.fetch(send, process, abort); err != nil {
+			return err
+		}
+		// Drop the accounts beyond the segment, which only prove its end
+		for len(keys) > 0 && bytes.Compare(keys[len(keys)-1], task.last[:]) > 0 {
+			keys, values = keys[:len(keys)-1], values[:len(values)-1]
+			more = false
+		}
+		if err := s.processAccounts(task, root, keys, values, abort); err != nil {
+			return err
+		}
+		if !more || len(keys) == 0 {
+			task.done = true
+			continue
+		}
+		next, ok := incHash(common.BytesToHash(keys[len(keys)-1]))
+		if !ok || bytes.Compare(next[:], task.last[:]) > 0 {
+			task.done = true
+			continue
+		}
+		task.next = next
+	}
+	return nil
+}
+
+// processAccounts downloads the missing storage and code of a verified range
+// of accounts, then adds the accounts to the trie of the segment.
+func (s *Syncer) processAccounts(task *accountTask, root common.Hash, keys, values [][]byte, abort chan struct{}) error {
+	var (
+		storages []*storageTask
+		codes    []common.Hash
+		seen     = make(map[common.Hash]struct{})
+	)
+	for i, value := range values {
+		var acc state.Account
+		if err := rlp.DecodeBytes(value, &acc); err != nil {
+			return fmt.Errorf("invalid account %x: %v", keys[i], err)
+		}
+		if acc.Root != types.EmptyRootHash {
+			if ok, _ := s.db.Has(acc.Root[:]); !ok {
+				storages = append(storages, &storageTask{
+					account: common.BytesToHash(keys[i]),
+					root:    acc.Root,
+					partial: types.EmptyRootHash,
+				})
+			}
+		}
+		if acc.CodeHash != emptyCode {
+			if _, ok := seen[acc.CodeHash]; !ok {
+				seen[acc.CodeHash] = struct{}{}
+				if ok, _ := s.db.Has(acc.CodeHash[:]); !ok {
+					codes = append(codes, acc.CodeHash)
+				}
+			}
+		}
+	}
+	if err := s.syncCodes(codes, abort); err != nil {
+		return err
+	}
+	if err := s.syncStorage(storages, root, abort); err != nil {
+		return err
+	}
+	// All storage and code is present, the account nodes may be written
+	tr, err := trie.New(task.root, s.triedb)
+	if err != nil {
+		return err
+	}
+	for i, key := range keys {
+		if err := tr.TryUpdate(key, values[i]); err != nil {
+			return err
+		}
+	}
+	if task.root, err = s.commit(tr); err != nil {
+		return err
+	}
+	atomic.AddUint64(&s.accounts, uint64(len(keys)))
+	return nil
+}
+
+// commit writes the nodes of a trie to the database.
+func (s *Syncer) commit(tr *trie.Trie) (common.Hash, error) {
+	root, err := tr.Commit(nil)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if err := s.triedb.Commit(root, false); err != nil {
+		return common.Hash{}, err
+	}
+	return root, nil
+}
+
+// syncCodes downloads and writes the given contract codes.
+func (s *Syncer) syncCodes(hashes []common.Hash, abort chan struct{}) error {
+	for len(hashes) > 0 {
+		batch := hashes
+		if len(batch) > maxCodeRequestCount {
+			batch = batch[:maxCodeRequestCount]
+		}
+		var served int
+		send := func(p *Peer, id uint64) error {
+			return p.RequestByteCodes(id, batch, requestSize)
+		}
+		process := func(res interface{}) error {
+			packet, ok := res.(*ByteCodesPacket)
+			if !ok {
+				return fmt.Errorf("unexpected response %T", res)
+			}
+			if len(packet.Codes) == 0 || len(packet.Codes) > len(batch) {
+				return fmt.Errorf("invalid code count %d", len(packet.Codes))
+			}
+			for i, code := range packet.Codes {
+				if crypto.Keccak256Hash(code) != batch[i] {
+					return fmt.Errorf("code %x mismatch", batch[i])
+				}
+			}
+			for i, code := range packet.Codes {
+				if err := s.db.Put(batch[i][:], code); err != nil {
+					return err
+				}
+				atomic.AddUint64(&s.size, uint64(len(code)))
+			}
+			served = len(packet.Codes)
+			return nil
+		}
+		if err := s.fetch(send, process, abort); err != nil {
+			return err
+		}
+		atomic.AddUint64(&s.codes, uint64(served))
+		hashes = hashes[served:]
+	}
+	return nil
+}
+
+// syncStorage downloads and writes the storage tries of the given accounts.
+func (s *Syncer) syncStorage(tasks []*storageTask, root common.Hash, abort chan struct{}) error {
+	for len(tasks) > 0 {
+		batch := tasks
+		if len(batch) > maxStorageRequestCount {
+			batch = batch[:maxStorageRequestCount]
+		}
+		var done int
+		send := func(p *Peer, id uint64) error {
+			accounts := make([]common.Hash, len(batch))
+			for i, task := range batch {
+				accounts[i] = task.account
+			}
+			return p.RequestStorageRanges(id, root, accounts, batch[0].next, requestSize)
+		}
+		process := func(res interface{}) error {
+			packet, ok := res.(*StorageRangesPacket)
+			if !ok {
+				return fmt.Errorf("unexpected response %T", res)
+			}
+			if len(packet.Slots) == 0 || len(packet.Slots) > len(batch) {
+				return fmt.Errorf("invalid storage count %d", len(packet.Slots))
+			}
+			var err error
+			done, err = s.processStorage(batch, packet)
+			return err
+		}
+		if err := s.fetch(send, process, abort); err != nil {
+			return err
+		}
+		tasks = tasks[done:]
+	}
+	return nil
+}
+
+// processStorage verifies the storage ranges of a response, writing the tries
+// of the completed accounts and the progress of a partial one. It returns the
+// number of completed accounts.
+func (s *Syncer) processStorage(batch []*storageTask, packet *StorageRangesPacket) (int, error) {
+	type verified struct {
+		keys, values [][]byte
+		more         bool
+	}
+	// Verify all ranges before writing anything
+	ranges := make([]verified, len(packet.Slots))
+	for i, slots := range packet.Slots {
+		var (
+			task   = batch[i]
+			keys   = make([][]byte, len(slots))
+			values = make([][]byte, len(slots))
+		)
+		for j, slot := range slots {
+			keys[j], values[j] = common.CopyBytes(slot.Hash[:]), slot.Body
+		}
+		proven := i == len(packet.Slots)-1 && len(packet.Proof) > 0
+		if !proven && task.next != (common.Hash{}) {
+			return 0, errors.New("unproven partial storage")
+		}
+		var (
+			more bool
+			err  error
+		)
+		if proven {
+			last := task.next[:]
+			if len(keys) > 0 {
+				last = keys[len(keys)-1]
+			}
+			more, err = trie.VerifyRangeProof(task.root, task.next[:], last, keys, values, proofDB(packet.Proof))
+		} else {
+			more, err = trie.VerifyRangeProof(task.root, nil, nil, keys, values, nil)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("storage of %x: %v", task.account, err)
+		}
+		ranges[i] = verified{keys, values, more}
+	}
+	var done int
+	for i, r := range ranges {
+		task := batch[i]
+		tr, err := trie.New(task.partial, s.triedb)
+		if err != nil {
+			return done, err
+		}
+		for j, key := range r.keys {
+			if err := tr.TryUpdate(key, r.values[j]); err != nil {
+				return done, err
+			}
+			atomic.AddUint64(&s.size, uint64(common.HashLength+len(r.values[j])))
+		}
+		atomic.AddUint64(&s.slots, uint64(len(r.keys)))
+
+		if task.partial, err = s.commit(tr); err != nil {
+			return done, err
+		}
+		if r.more {
+			next, ok := incHash(common.BytesToHash(r.keys[len(r.keys)-1]))
+			if ok {
+				task.next = next
+				break
+			}
+		}
+		if task.partial != task.root {
+			return done, fmt.Errorf("storage of %x: root mismatch: have %x, want %x", task.account, task.partial, task.root)
+		}
+		done++
+	}
+	return done, nil
+}
@@ -0,0 +1,219 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snap
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/core/state"
+	"github.com/zeus-fyi/gochain/v4/crypto"
+	"github.com/zeus-fyi/gochain/v4/ethdb"
+	"github.com/zeus-fyi/gochain/v4/p2p"
+	"github.com/zeus-fyi/gochain/v4/p2p/discover"
+	"github.com/zeus-fyi/gochain/v4/rlp"
+	"github.com/zeus-fyi/gochain/v4/trie"
+)
+
+// makeState commits a state of many accounts, some with code and one with
+// enough storage to need several requests, on top of root.
+func makeState(t *testing.T, db *ethdb.MemDatabase, root common.Hash, salt byte) common.Hash {
+	sdb := state.NewDatabase(db)
+	statedb, err := state.New(root, sdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2000; i++ {
+		addr := common.BigToAddress(big.NewInt(int64(i)))
+		statedb.SetBalance(addr, big.NewInt(int64(i)+int64(salt)))
+		if i%100 == 0 {
+			statedb.SetCode(addr, []byte{0x60, byte(i / 100), salt})
+		}
+		if i%50 == 0 {
+			statedb.SetState(addr, common.Hash{salt}, common.BigToHash(big.NewInt(int64(i)+1)))
+		}
+	}
+	large := common.BigToAddress(big.NewInt(1))
+	for i := 0; i < 20000; i++ {
+		statedb.SetState(large, common.BigToHash(big.NewInt(int64(i))), common.Hash{0xff, salt, byte(i)})
+	}
+	root, err = statedb.Commit(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sdb.TrieDB().Commit(root, false); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+// connect links the syncer to a peer serving the state in db.
+func connect(syncer *Syncer, db *ethdb.MemDatabase, id byte) {
+	local, remote := p2p.MsgPipe()
+	var nodeID discover.NodeID
+	nodeID[0] = id
+
+	server := NewPeer(ProtocolVersion, p2p.NewPeer(nodeID, "server", nil), remote)
+	client := NewPeer(ProtocolVersion, p2p.NewPeer(nodeID, "client", nil), local)
+	go Handle(trie.NewDatabase(db), nil, server)
+	go Handle(trie.NewDatabase(ethdb.NewMemDatabase()), syncer, client)
+}
+
+// heal completes the state of root in dst from src with a trie sync, returning
+// the number of nodes fetched.
+func heal(t *testing.T, dst, src *ethdb.MemDatabase, root common.Hash) int {
+	var (
+		sched   = state.NewStateSync(root, dst)
+		fetched int
+	)
+	for queue := sched.Missing(0); len(queue) > 0; queue = sched.Missing(0) {
+		results := make([]trie.SyncResult, len(queue))
+		for i, hash := range queue {
+			data, err := src.Get(hash[:])
+			if err != nil {
+				t.Fatalf("failed to retrieve node %x: %v", hash, err)
+			}
+			results[i] = trie.SyncResult{Hash: hash, Data: data}
+		}
+		if _, index, err := sched.Process(results); err != nil {
+			t.Fatalf("failed to process result #%d: %v", index, err)
+		}
+		if index, err := sched.Commit(dst); err != nil {
+			t.Fatalf("failed to commit data #%d: %v", index, err)
+		}
+		fetched += len(queue)
+	}
+	return fetched
+}
+
+// checkState verifies that the state of root in dst matches the one in src.
+func checkState(t *testing.T, dst, src *ethdb.MemDatabase, root common.Hash) {
+	t.Helper()
+	want, err := state.New(root, state.NewDatabase(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	have, err := state.New(root, state.NewDatabase(dst))
+	if err != nil {
+		t.Fatalf("state missing: %v", err)
+	}
+	for i := 0; i < 2000; i++ {
+		addr := common.BigToAddress(big.NewInt(int64(i)))
+		if have.GetBalance(addr).Cmp(want.GetBalance(addr)) != 0 {
+			t.Fatalf("account %d balance mismatch", i)
+		}
+		if string(have.GetCode(addr)) != string(want.GetCode(addr)) {
+			t.Fatalf("account %d code mismatch", i)
+		}
+	}
+	// Walk all nodes to ensure none is missing
+	triedb := trie.NewDatabase(dst)
+	accTrie, _ := trie.New(root, triedb)
+	it := accTrie.NodeIterator(nil)
+	for it.Next(true) {
+		if !it.Leaf() {
+			continue
+		}
+		var acc state.Account
+		if err := rlp.DecodeBytes(it.LeafBlob(), &acc); err != nil {
+			t.Fatal(err)
+		}
+		storeTrie, err := trie.New(acc.Root, triedb)
+		if err != nil {
+			t.Fatalf("storage of %x missing: %v", it.LeafKey(), err)
+		}
+		sit := storeTrie.NodeIterator(nil)
+		for sit.Next(true) {
+		}
+		if sit.Error() != nil {
+			t.Fatalf("storage of %x incomplete: %v", it.LeafKey(), sit.Error())
+		}
+	}
+	if it.Error() != nil {
+		t.Fatalf("state incomplete: %v", it.Error())
+	}
+}
+
+func TestSync(t *testing.T) {
+	var (
+		src    = ethdb.NewMemDatabase()
+		dst    = ethdb.NewMemDatabase()
+		root   = makeState(t, src, common.Hash{}, 1)
+		syncer = NewSyncer(dst)
+	)
+	// A peer without the state must not stall the sync
+	connect(syncer, ethdb.NewMemDatabase(), 1)
+	connect(syncer, src, 2)
+
+	if err := syncer.Sync(root, make(chan struct{})); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	// Connected peers are only taken into use while syncing
+	syncer.lock.Lock()
+	peers, idle := len(syncer.peers), len(syncer.idle)
+	syncer.lock.Unlock()
+	if peers == 0 || idle != 0 {
+		t.Errorf("peer tracking after sync: have %d peers, %d idle, want some, 0", peers, idle)
+	}
+	// Only the nodes joining the segments are left to heal
+	if n := heal(t, dst, src, root); n > accountConcurrency+1 {
+		t.Errorf("healed %d nodes of a synced state", n)
+	}
+	checkState(t, dst, src, root)
+
+	// Moving to a new root reuses the synced ranges, healing just the changes
+	next := makeState(t, src, root, 2)
+	if err := syncer.Sync(next, make(chan struct{})); err != nil {
+		t.Fatalf("sync of new root failed: %v", err)
+	}
+	if n := heal(t, dst, src, next); n == 0 {
+		t.Error("nothing healed after root change")
+	}
+	checkState(t, dst, src, next)
+}
+
+// Tests that a sync without usable peers is cancelled.
+func TestSyncCancel(t *testing.T) {
+	var (
+		src    = ethdb.NewMemDatabase()
+		root   = makeState(t, src, common.Hash{}, 1)
+		syncer = NewSyncer(ethdb.NewMemDatabase())
+		cancel = make(chan struct{})
+	)
+	connect(syncer, ethdb.NewMemDatabase(), 1)
+	close(cancel)
+	if err := syncer.Sync(root, cancel); err != ErrCancelled {
+		t.Fatalf("error mismatch: have %v, want %v", err, ErrCancelled)
+	}
+}
+
+// Tests that storage requests are served for a bounded number of accounts.
+func TestStorageRangesLimit(t *testing.T) {
+	var (
+		db       = ethdb.NewMemDatabase()
+		root     = makeState(t, db, common.Hash{}, 1)
+		accounts []common.Hash
+	)
+	for i := 0; i < 2000; i++ {
+		accounts = append(accounts, crypto.Keccak256Hash(common.BigToAddress(big.NewInt(int64(i))).Bytes()))
+	}
+	res := ServiceGetStorageRanges(trie.NewDatabase(db), &GetStorageRangesPacket{Root: root, Accounts: accounts, Bytes: softResponseLimit})
+	if len(res.Slots) != maxStorageAccounts {
+		t.Errorf("served accounts: have %d, want %d", len(res.Slots), maxStorageAccounts)
+	}
+}
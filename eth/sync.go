@@ -44,8 +44,12 @@ type txsync struct {
 }
 
 // syncTransactions starts sending all currently pending transactions to the given peer.
+// Private transactions are only included for private peers.
 func (pm *ProtocolManager) syncTransactions(p *peer) {
 	txs := pm.txpool.PendingList()
+	if !pm.isPrivatePeer(p) {
+		txs, _ = pm.splitPrivate(txs)
+	}
 	if len(txs) == 0 {
 		return
 	}
@@ -55,9 +59,9 @@ func (pm *ProtocolManager) syncTransactions(p *peer) {
 	}
 }
 
-// syncTransactionsAllPeers syncs pending txs to all peers.
+// syncTransactionsAllPeers syncs pending public txs to all peers.
 func (pm *ProtocolManager) syncTransactionsAllPeers() {
-	txs := pm.txpool.PendingList()
+	txs, _ := pm.splitPrivate(pm.txpool.PendingList())
 	if len(txs) == 0 {
 		return
 	}
@@ -212,6 +216,9 @@ func (pm *ProtocolManager) synchronise(peer *peer) {
 	if atomic.LoadUint32(&pm.fastSync) == 1 {
 		// Fast sync was explicitly requested, and explicitly granted
 		mode = downloader.FastSync
+		if atomic.LoadUint32(&pm.snapSync) == 1 {
+			mode = downloader.SnapSync
+		}
 	} else if currentBlock.NumberU64() == 0 && pm.blockchain.CurrentFastBlock().NumberU64() > 0 {
 		// The database seems empty as the current block is the genesis. Yet the fast
 		// block is ahead, so fast sync was enabled for this node at a certain point.
@@ -222,7 +229,7 @@ func (pm *ProtocolManager) synchronise(peer *peer) {
 		mode = downloader.FastSync
 	}
 
-	if mode == downloader.FastSync {
+	if mode == downloader.FastSync || mode == downloader.SnapSync {
 		// Make sure the peer's total difficulty we are synchronizing is higher.
 		if pm.blockchain.GetTdByHash(pm.blockchain.CurrentFastBlock().Hash()).Cmp(pTd) >= 0 {
 			return
@@ -2,6 +2,8 @@ package ethdb
 
 import (
 	"bytes"
+	"context"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
@@ -19,6 +21,7 @@ import (
 // Database errors.
 var (
 	ErrInvalidSegmentType = errors.New("ethdb: Invalid segment type")
+	ErrActiveSegment      = errors.New("ethdb: active segment")
 )
 
 // Prefix used for each table type.
@@ -50,6 +53,9 @@ type DB struct {
 	body    *Table
 	header  *Table
 	receipt *Table
+	diff    *Table
+	history *Table
+	logs    *Table
 
 	// Filename of the root of the database.
 	Path string
@@ -95,6 +101,9 @@ func (db *DB) Open() error {
 	db.body = NewTable("body", db.TablePath("body"), NewBlockNumberPartitioner(db.PartitionSize))
 	db.header = NewTable("header", db.TablePath("header"), NewBlockNumberPartitioner(db.PartitionSize))
 	db.receipt = NewTable("receipt", db.TablePath("receipt"), NewBlockNumberPartitioner(db.PartitionSize))
+	db.diff = NewTable("statediff", db.TablePath("statediff"), NewBlockNumberPartitioner(db.PartitionSize))
+	db.history = NewTable("history", db.TablePath("history"), NewBlockNumberPartitioner(db.PartitionSize))
+	db.logs = NewTable("logindex", db.TablePath("logindex"), NewBlockNumberPartitioner(db.PartitionSize))
 
 	for _, tbl := range db.Tables() {
 		// Allow 100x header files since they are small.
@@ -143,9 +152,38 @@ func (db *DB) HeaderTable() common.Table { return db.header }
 // ReceiptTable returns the table which holds receipt data.
 func (db *DB) ReceiptTable() common.Table { return db.receipt }
 
+// StateDiffTable returns the table which holds per-block state diffs.
+func (db *DB) StateDiffTable() common.Table { return db.diff }
+
+// HistoryTable returns the table which holds per-block reverse state diffs.
+func (db *DB) HistoryTable() common.Table { return db.history }
+
+// LogIndexTable returns the table which holds the log index sections.
+func (db *DB) LogIndexTable() common.Table { return db.logs }
+
+// PruneHistory drops the segments of the history table which only hold blocks
+// before the given number.
+func (db *DB) PruneHistory(number uint64) error {
+	var key [9]byte
+	key[0] = 'R'
+	binary.BigEndian.PutUint64(key[1:], number)
+
+	limit := db.history.Partitioner.Partition(key[:])
+	for _, name := range db.history.SegmentNames() {
+		if name >= limit {
+			break
+		}
+		if err := db.history.DropSegment(context.Background(), name); err != nil {
+			return err
+		}
+		log.Info("Dropped history segment", "name", name)
+	}
+	return nil
+}
+
 // Tables returns a sorted list of all tables.
 func (db *DB) Tables() []*Table {
-	return []*Table{db.global, db.body, db.header, db.receipt}
+	return []*Table{db.global, db.body, db.header, db.receipt, db.diff, db.history, db.logs}
 }
 
 // Table returns a table by name.
@@ -159,6 +197,12 @@ func (db *DB) Table(name string) *Table {
 		return db.header
 	case "receipt":
 		return db.receipt
+	case "statediff":
+		return db.diff
+	case "history":
+		return db.history
+	case "logindex":
+		return db.logs
 	default:
 		return nil
 	}
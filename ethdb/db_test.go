@@ -1,6 +1,7 @@
 package ethdb_test
 
 import (
+	"os"
 	"testing"
 
 	"github.com/zeus-fyi/gochain/v4/common"
@@ -22,3 +23,28 @@ func TestBlockNumberPartitioner_Partition(t *testing.T) {
 		t.Fatalf("unexpected partition: %v", v)
 	}
 }
+
+func TestDB_PruneHistory(t *testing.T) {
+	db := ethdb.NewDB(MustTempDir())
+	db.PartitionSize = 10
+	defer os.RemoveAll(db.Path)
+	if err := db.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, number := range []uint64{5, 15, 25} {
+		if err := db.HistoryTable().Put(numHashKey('R', number, common.Hash{}), []byte("diff")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.PruneHistory(21); err != nil {
+		t.Fatal(err)
+	}
+	if names := db.Table("history").SegmentNames(); len(names) != 1 || names[0] != `0000000000000014` {
+		t.Fatalf("unexpected segments: %v", names)
+	}
+	if v, err := db.HistoryTable().Get(numHashKey('R', 25, common.Hash{})); err != nil || string(v) != `diff` {
+		t.Fatalf("unexpected value %q, err %v", v, err)
+	}
+}
@@ -102,7 +102,7 @@ func KeyBlockNumber(key []byte) (num uint64, ok bool) {
 		return 0, false
 	}
 	switch key[0] {
-	case 'h', 't', 'n', 'b', 'r': // copied from core/database_util.go
+	case 'h', 't', 'n', 'b', 'r', 'D', 'R', 'g': // copied from core/rawdb/schema.go
 		return binary.BigEndian.Uint64(key[1:9]), true
 	default:
 		return 0, false
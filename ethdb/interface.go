@@ -19,3 +19,25 @@ package ethdb
 // Code using batches should try to add this much data to the batch.
 // The value was determined empirically.
 const IdealBatchSize = 100 * 1024
+
+// Iteratee is implemented by tables which can enumerate their contents.
+type Iteratee interface {
+	// Iterate calls fn with every key/value pair, stopping at the first error.
+	// The arguments are only valid for the duration of the call.
+	Iterate(fn func(key, value []byte) error) error
+}
+
+// PrefixIteratee is implemented by tables which can enumerate the entries
+// under a key prefix without visiting the rest of their contents.
+type PrefixIteratee interface {
+	// IteratePrefix calls fn with every key/value pair whose key starts with
+	// prefix, stopping at the first error. The arguments are only valid for
+	// the duration of the call.
+	IteratePrefix(prefix []byte, fn func(key, value []byte) error) error
+}
+
+// Compacter is implemented by tables which can reclaim the space of deleted entries.
+type Compacter interface {
+	// CompactStorage compacts the underlying storage of the table.
+	CompactStorage() error
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/syndtr/goleveldb/leveldb/filter"
 	"github.com/syndtr/goleveldb/leveldb/iterator"
 	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
 	"github.com/zeus-fyi/gochain/v4/common"
 )
 
@@ -86,6 +87,12 @@ func (s *LDBSegment) Iterator() SegmentIterator {
 	return &ldbSegmentIterator{s.db.NewIterator(nil, nil)}
 }
 
+// PrefixIterator returns a sequential iterator over the keys of the segment
+// starting with prefix.
+func (s *LDBSegment) PrefixIterator(prefix []byte) SegmentIterator {
+	return &ldbSegmentIterator{s.db.NewIterator(util.BytesPrefix(prefix), nil)}
+}
+
 // CompactTo writes the segment to disk as a file segment.
 func (s *LDBSegment) CompactTo(path string) error {
 	enc := NewFileSegmentEncoder(path)
@@ -17,6 +17,7 @@
 package ethdb
 
 import (
+	"bytes"
 	"sync"
 
 	"github.com/zeus-fyi/gochain/v4/common"
@@ -42,10 +43,13 @@ func NewMemDatabaseWithCap(size int) (*MemDatabase, error) {
 	}, nil
 }
 
-func (db *MemDatabase) GlobalTable() common.Table  { return db }
-func (db *MemDatabase) BodyTable() common.Table    { return db }
-func (db *MemDatabase) HeaderTable() common.Table  { return db }
-func (db *MemDatabase) ReceiptTable() common.Table { return db }
+func (db *MemDatabase) GlobalTable() common.Table    { return db }
+func (db *MemDatabase) BodyTable() common.Table      { return db }
+func (db *MemDatabase) HeaderTable() common.Table    { return db }
+func (db *MemDatabase) ReceiptTable() common.Table   { return db }
+func (db *MemDatabase) StateDiffTable() common.Table { return db }
+func (db *MemDatabase) HistoryTable() common.Table   { return db }
+func (db *MemDatabase) LogIndexTable() common.Table  { return db }
 
 func (db *MemDatabase) Put(key []byte, value []byte) error {
 	db.lock.Lock()
@@ -92,6 +96,33 @@ func (db *MemDatabase) Delete(key []byte) error {
 	return nil
 }
 
+// Iterate calls fn with every key/value pair present when called.
+func (db *MemDatabase) Iterate(fn func(key, value []byte) error) error {
+	for _, key := range db.Keys() {
+		value, err := db.Get(key)
+		if err == common.ErrNotFound {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if err := fn(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IteratePrefix calls fn with every key/value pair present when called whose
+// key starts with prefix.
+func (db *MemDatabase) IteratePrefix(prefix []byte, fn func(key, value []byte) error) error {
+	return db.Iterate(func(key, value []byte) error {
+		if !bytes.HasPrefix(key, prefix) {
+			return nil
+		}
+		return fn(key, value)
+	})
+}
+
 func (db *MemDatabase) Close() error { return nil }
 
 func (db *MemDatabase) NewBatch() common.Batch {
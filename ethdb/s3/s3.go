@@ -15,6 +15,7 @@ import (
 	"github.com/zeus-fyi/gochain/v4/ethdb"
 	"github.com/zeus-fyi/gochain/v4/log"
 	"github.com/zeus-fyi/gochain/v4/metrics"
+	"go.opencensus.io/trace"
 )
 
 var (
@@ -117,6 +118,15 @@ func (c *Client) FGetObject(ctx context.Context, key, path string) (err error) {
 }
 
 func (c *Client) tryFGetObject(ctx context.Context, key, path string) (err error) {
+	ctx, span := trace.StartSpan(ctx, "s3.Client.FGetObject")
+	defer span.End()
+	span.AddAttributes(trace.StringAttribute("key", key))
+	defer func() {
+		if err != nil {
+			span.SetStatus(trace.Status{Code: trace.StatusCodeUnknown, Message: err.Error()})
+		}
+	}()
+
 	tmpPath := path + ".tmp"
 	if err := c.client.FGetObjectWithContext(ctx, c.Bucket, key, tmpPath, minio.GetObjectOptions{}); err != nil {
 		return err
@@ -10,6 +10,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/syndtr/goleveldb/leveldb/util"
 	"github.com/zeus-fyi/gochain/v4/common"
 	"github.com/zeus-fyi/gochain/v4/log"
 )
@@ -199,6 +200,13 @@ func (t *Table) segmentSlice() []Segment {
 	return a
 }
 
+// LDBSegmentSlice returns a sorted slice of all mutable segments.
+func (t *Table) LDBSegmentSlice() []*LDBSegment {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.ldbSegmentSlice()
+}
+
 func (t *Table) ldbSegmentSlice() []*LDBSegment {
 	a := make([]*LDBSegment, 0, len(t.ldbSegments))
 	for _, s := range t.ldbSegments {
@@ -316,6 +324,94 @@ func (t *Table) Delete(key []byte) error {
 	}
 }
 
+// Iterate calls fn with every key/value pair in the table, segment by segment.
+func (t *Table) Iterate(fn func(key, value []byte) error) error {
+	for _, s := range t.SegmentSlice() {
+		itr := s.Iterator()
+		for itr.Next() {
+			if err := fn(itr.Key(), itr.Value()); err != nil {
+				itr.Close()
+				return err
+			}
+		}
+		if err := itr.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IteratePrefix calls fn with every key/value pair in the table whose key
+// starts with prefix. LDB segments seek straight to the prefix, others are
+// scanned in full.
+func (t *Table) IteratePrefix(prefix []byte, fn func(key, value []byte) error) error {
+	for _, s := range t.SegmentSlice() {
+		var itr SegmentIterator
+		if ldb, ok := s.(*LDBSegment); ok {
+			itr = ldb.PrefixIterator(prefix)
+		} else {
+			itr = s.Iterator()
+		}
+		for itr.Next() {
+			if !bytes.HasPrefix(itr.Key(), prefix) {
+				continue
+			}
+			if err := fn(itr.Key(), itr.Value()); err != nil {
+				itr.Close()
+				return err
+			}
+		}
+		if err := itr.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DropSegment closes the named segment and removes its data. The active
+// segment cannot be dropped.
+func (t *Table) DropSegment(ctx context.Context, name string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if name == t.active {
+		return ErrActiveSegment
+	}
+	if s := t.ldbSegments[name]; s != nil {
+		delete(t.ldbSegments, name)
+		if err := s.Close(); err != nil {
+			return err
+		}
+		return os.RemoveAll(s.Path())
+	}
+	if !t.segments.Contains(name) {
+		return nil
+	}
+	s, err := t.segments.Acquire(name)
+	if err != nil {
+		return err
+	}
+	t.segments.Release()
+	t.segments.Remove(ctx, name)
+	if err := s.Close(); err != nil {
+		return err
+	}
+	return os.RemoveAll(t.SegmentPath(name))
+}
+
+// CompactStorage compacts the LevelDB storage of all mutable segments,
+// reclaiming the space of deleted entries.
+func (t *Table) CompactStorage() error {
+	for _, s := range t.LDBSegmentSlice() {
+		startTime := time.Now()
+		if err := s.LDB().CompactRange(util.Range{}); err != nil {
+			return err
+		}
+		log.Info("Compacted segment storage", "table", t.Name, "name", s.Name(), "elapsed", time.Since(startTime))
+	}
+	return nil
+}
+
 func (t *Table) NewBatch() common.Batch {
 	return &tableBatch{table: t, batches: make(map[string]*ldbSegmentBatch)}
 }
@@ -195,3 +195,117 @@ func TestTable_Compact(t *testing.T) {
 		}
 	})
 }
+
+func TestTable_DropSegment(t *testing.T) {
+	dir := MustTempDir()
+	defer os.RemoveAll(dir)
+
+	tbl := ethdb.NewTable("test", dir, ethdb.NewBlockNumberPartitioner(1000))
+	tbl.MinCompactionAge = 0 // compact immediately
+	tbl.MinMutableSegmentCount = 2
+	if err := tbl.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer tbl.Close()
+
+	for _, number := range []uint64{200, 1500, 2100} {
+		if err := tbl.Put(numHashKey('b', number, common.Hash{}), []byte("foo")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tbl.Compact(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Drop both the compacted file segment and a mutable one.
+	for _, name := range []string{`0000000000000000`, `00000000000003e8`} {
+		if err := tbl.DropSegment(context.Background(), name); err != nil {
+			t.Fatal(err)
+		} else if _, err := os.Stat(tbl.SegmentPath(name)); !os.IsNotExist(err) {
+			t.Fatalf("segment %s not removed: %v", name, err)
+		}
+	}
+	if err := tbl.DropSegment(context.Background(), tbl.ActiveSegmentName()); err != ethdb.ErrActiveSegment {
+		t.Fatalf("unexpected error dropping active segment: %v", err)
+	}
+	if names := tbl.SegmentNames(); len(names) != 1 || names[0] != `00000000000007d0` {
+		t.Fatalf("unexpected segments: %v", names)
+	}
+	for _, number := range []uint64{200, 1500} {
+		if v, err := tbl.Get(numHashKey('b', number, common.Hash{})); v != nil || (err != nil && err != common.ErrNotFound) {
+			t.Fatalf("block %d: unexpected value %q, err %v", number, v, err)
+		}
+	}
+	if v, err := tbl.Get(numHashKey('b', 2100, common.Hash{})); err != nil || string(v) != `foo` {
+		t.Fatalf("unexpected value %q, err %v", v, err)
+	}
+}
+
+func TestTable_Iterate(t *testing.T) {
+	dir := MustTempDir()
+	tbl := ethdb.NewTable("test", dir, &ethdb.StaticPartitioner{Name: "data"})
+	defer os.RemoveAll(tbl.Path)
+
+	if err := tbl.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer tbl.Close()
+
+	for i := uint64(0); i < 3; i++ {
+		if err := tbl.Put(numHashKey('b', i, common.Hash{}), []byte("BLOCKDATA")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Delete entries while iterating, then reclaim their space.
+	var n int
+	if err := tbl.Iterate(func(key, value []byte) error {
+		if string(value) != "BLOCKDATA" {
+			t.Fatalf("unexpected value: %q", value)
+		}
+		n++
+		return tbl.Delete(key)
+	}); err != nil {
+		t.Fatal(err)
+	} else if n != 3 {
+		t.Fatalf("unexpected iteration count: %d", n)
+	}
+	if err := tbl.CompactStorage(); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := tbl.Has(numHashKey('b', 1, common.Hash{})); err != nil {
+		t.Fatal(err)
+	} else if exists {
+		t.Fatal("expected value to not exist")
+	}
+}
+
+func TestTable_IteratePrefix(t *testing.T) {
+	dir := MustTempDir()
+	tbl := ethdb.NewTable("test", dir, &ethdb.StaticPartitioner{Name: "data"})
+	defer os.RemoveAll(tbl.Path)
+
+	if err := tbl.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer tbl.Close()
+
+	for i := uint64(0); i < 3; i++ {
+		for _, prefix := range []byte{'a', 'b', 'c'} {
+			if err := tbl.Put(numHashKey(prefix, i, common.Hash{}), []byte{prefix}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	var n int
+	if err := tbl.IteratePrefix([]byte{'b'}, func(key, value []byte) error {
+		if key[0] != 'b' || string(value) != "b" {
+			t.Fatalf("unexpected entry: %x => %q", key, value)
+		}
+		n++
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	} else if n != 3 {
+		t.Fatalf("unexpected iteration count: %d", n)
+	}
+}
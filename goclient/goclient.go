@@ -23,16 +23,22 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"sync"
+	"time"
 
 	"github.com/zeus-fyi/gochain/v4"
 	"github.com/zeus-fyi/gochain/v4/common"
 	"github.com/zeus-fyi/gochain/v4/common/hexutil"
 	"github.com/zeus-fyi/gochain/v4/consensus/clique"
 	"github.com/zeus-fyi/gochain/v4/core/types"
+	"github.com/zeus-fyi/gochain/v4/event"
 	"github.com/zeus-fyi/gochain/v4/rlp"
 	"github.com/zeus-fyi/gochain/v4/rpc"
 )
 
+// streamBackoff is the longest StreamLogs waits before resubscribing.
+const streamBackoff = 30 * time.Second
+
 // Client defines typed wrappers for the Ethereum RPC API.
 type Client struct {
 	c *rpc.Client
@@ -152,7 +158,7 @@ func (ec *Client) getBlock(ctx context.Context, method string, args ...interface
 // HeaderByHash returns the block header with the given hash.
 func (ec *Client) HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error) {
 	var head *types.Header
-	err := ec.c.CallContext(ctx, &head, "eth_getBlockByHash", hash, false)
+	err := ec.c.CallContext(ctx, &head, "eth_getHeaderByHash", hash)
 	if err == nil && head == nil {
 		err = gochain.NotFound
 	}
@@ -163,13 +169,73 @@ func (ec *Client) HeaderByHash(ctx context.Context, hash common.Hash) (*types.He
 // nil, the latest known header is returned.
 func (ec *Client) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
 	var head *types.Header
-	err := ec.c.CallContext(ctx, &head, "eth_getBlockByNumber", toBlockNumArg(number), false)
+	err := ec.c.CallContext(ctx, &head, "eth_getHeaderByNumber", toBlockNumArg(number))
 	if err == nil && head == nil {
 		err = gochain.NotFound
 	}
 	return head, err
 }
 
+// BlockFieldsByNumber decodes only the given fields of a block from the current
+// canonical chain into result, with transaction hashes if "transactions" is one
+// of them. If number is nil, the latest known block is returned.
+func (ec *Client) BlockFieldsByNumber(ctx context.Context, number *big.Int, fields []string, result interface{}) error {
+	var raw json.RawMessage
+	err := ec.c.CallContext(ctx, &raw, "eth_getBlockByNumber", toBlockNumArg(number), false, fields)
+	if err != nil {
+		return err
+	} else if len(raw) == 0 || string(raw) == "null" {
+		return gochain.NotFound
+	}
+	return json.Unmarshal(raw, result)
+}
+
+// RawHeaderByNumber returns a block header from the current canonical chain,
+// transferred RLP encoded. If number is nil, the latest known header is returned.
+func (ec *Client) RawHeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	var raw hexutil.Bytes
+	if err := ec.c.CallContext(ctx, &raw, "debug_getRawHeader", toBlockNumArg(number)); err != nil {
+		return nil, err
+	}
+	head := new(types.Header)
+	if err := rlp.DecodeBytes(raw, head); err != nil {
+		return nil, err
+	}
+	return head, nil
+}
+
+// RawBlockByNumber returns a block from the current canonical chain, transferred
+// RLP encoded. If number is nil, the latest known block is returned.
+func (ec *Client) RawBlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error) {
+	var raw hexutil.Bytes
+	if err := ec.c.CallContext(ctx, &raw, "debug_getRawBlock", toBlockNumArg(number)); err != nil {
+		return nil, err
+	}
+	block := new(types.Block)
+	if err := rlp.DecodeBytes(raw, block); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// RawReceiptsByNumber returns the consensus fields of the receipts of a block
+// from the current canonical chain, transferred RLP encoded. If number is nil,
+// the receipts of the latest known block are returned.
+func (ec *Client) RawReceiptsByNumber(ctx context.Context, number *big.Int) (types.Receipts, error) {
+	var raw []hexutil.Bytes
+	if err := ec.c.CallContext(ctx, &raw, "debug_getRawReceipts", toBlockNumArg(number)); err != nil {
+		return nil, err
+	}
+	receipts := make(types.Receipts, len(raw))
+	for i, enc := range raw {
+		receipts[i] = new(types.Receipt)
+		if err := rlp.DecodeBytes(enc, receipts[i]); err != nil {
+			return nil, err
+		}
+	}
+	return receipts, nil
+}
+
 type rpcTransaction struct {
 	tx *types.Transaction
 	txExtraInfo
@@ -403,6 +469,67 @@ func (ec *Client) FilterLogs(ctx context.Context, q gochain.FilterQuery) ([]type
 	return result, err
 }
 
+// FilterLogsIter executes a filter query page by page, fetching at most
+// pageSize logs at a time (0 lets the node decide). Unlike FilterLogs it isn't
+// bound by the result limit of the node.
+func (ec *Client) FilterLogsIter(ctx context.Context, q gochain.FilterQuery, pageSize uint) (*LogsIterator, error) {
+	arg, err := toFilterArg(q)
+	if err != nil {
+		return nil, err
+	}
+	return &LogsIterator{ec: ec, ctx: ctx, arg: arg, size: pageSize}, nil
+}
+
+// LogsIterator is returned from FilterLogsIter and is used to iterate over the
+// logs matching a filter query.
+type LogsIterator struct {
+	ec   *Client
+	ctx  context.Context
+	arg  interface{}
+	size uint
+
+	logs   []types.Log // Logs of the current page not yet iterated over
+	cursor *string     // Cursor of the next page, nil on the last page
+	log    types.Log   // Log the iterator is positioned at
+	done   bool        // Whether the last page was fetched
+	fail   error       // Occurred error to stop iteration
+}
+
+// Next advances the iterator to the subsequent log, fetching the next page when
+// needed. It returns false after the last log or on failure, which Error reports.
+func (it *LogsIterator) Next() bool {
+	for len(it.logs) == 0 {
+		if it.done || it.fail != nil {
+			return false
+		}
+		var page struct {
+			Logs   []types.Log `json:"logs"`
+			Cursor *string     `json:"cursor"`
+		}
+		var limit *hexutil.Uint
+		if it.size > 0 {
+			limit = (*hexutil.Uint)(&it.size)
+		}
+		if err := it.ec.c.CallContext(it.ctx, &page, "eth_getLogsPaginated", it.arg, it.cursor, limit); err != nil {
+			it.fail = err
+			return false
+		}
+		it.logs, it.cursor, it.done = page.Logs, page.Cursor, page.Cursor == nil
+	}
+	it.log, it.logs = it.logs[0], it.logs[1:]
+	return true
+}
+
+// Log returns the log the iterator is positioned at.
+func (it *LogsIterator) Log() types.Log {
+	return it.log
+}
+
+// Error returns any retrieval error occurred during iteration.
+func (it *LogsIterator) Error() error {
+	return it.fail
+}
+
 // SubscribeFilterLogs subscribes to the results of a streaming filter query.
 func (ec *Client) SubscribeFilterLogs(ctx context.Context, q gochain.FilterQuery, ch chan<- types.Log) (gochain.Subscription, error) {
 	arg, err := toFilterArg(q)
@@ -412,6 +539,98 @@ func (ec *Client) SubscribeFilterLogs(ctx context.Context, q gochain.FilterQuery
 	return ec.c.EthSubscribe(ctx, ch, "logs", arg)
 }
 
+// StreamCursor is the position of a durable log stream, see StreamLogs.
+type StreamCursor struct {
+	Number hexutil.Uint64 `json:"number"`
+	Hash   common.Hash    `json:"hash"`
+}
+
+// StreamEvent is an event of a durable log stream, reporting a block added to
+// or, if Removed, dropped from the canonical chain along with its logs matching
+// the query.
+type StreamEvent struct {
+	Number     hexutil.Uint64 `json:"number"`
+	Hash       common.Hash    `json:"hash"`
+	ParentHash common.Hash    `json:"parentHash"`
+	Removed    bool           `json:"removed"`
+	Logs       []types.Log    `json:"logs"`
+	Cursor     StreamCursor   `json:"cursor"`
+}
+
+// StreamLogs follows the durable stream of the canonical blocks and their logs
+// matching the query, from block q.FromBlock on or, if not nil, resuming after
+// the given cursor. Whenever the subscription fails, e.g. because the
+// connection dropped, it is re-established from the cursor of the last event
+// delivered on ch, retrying with backoff. The block range of the query
+// doesn't limit the stream.
+//
+// Persisting the cursor of each event once processed and resuming from it after
+// a restart makes sure every event is seen at least once.
+func (ec *Client) StreamLogs(ctx context.Context, q gochain.FilterQuery, cursor *StreamCursor, ch chan<- StreamEvent) (gochain.Subscription, error) {
+	if q.BlockHash != nil {
+		return nil, errors.New("cannot stream the logs of a single block")
+	}
+	arg, err := toFilterArg(q)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		mu    sync.Mutex
+		start = arg.(map[string]interface{})["fromBlock"]
+	)
+	if cursor != nil {
+		start = cursor
+	}
+	subscribe := func(ctx context.Context) (*rpc.ClientSubscription, chan StreamEvent, error) {
+		mu.Lock()
+		from := start
+		mu.Unlock()
+
+		events := make(chan StreamEvent)
+		sub, err := ec.c.EthSubscribe(ctx, events, "subscribeFrom", from, arg)
+		return sub, events, err
+	}
+	// Subscribe once up front to report invalid queries and cursors
+	first, firstEvents, err := subscribe(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return event.Resubscribe(streamBackoff, func(ctx context.Context) (event.Subscription, error) {
+		sub, events := first, firstEvents
+		if sub == nil {
+			var err error
+			if sub, events, err = subscribe(ctx); err != nil {
+				return nil, err
+			}
+		}
+		first = nil
+
+		return event.NewSubscription(func(quit <-chan struct{}) error {
+			defer sub.Unsubscribe()
+			for {
+				select {
+				case ev := <-events:
+					select {
+					case ch <- ev:
+						mu.Lock()
+						start = &ev.Cursor
+						mu.Unlock()
+					case <-quit:
+						return nil
+					}
+				case err := <-sub.Err():
+					if err == nil {
+						err = errors.New("stream subscription ended")
+					}
+					return err
+				case <-quit:
+					return nil
+				}
+			}
+		}), nil
+	}), nil
+}
+
 func toFilterArg(q gochain.FilterQuery) (interface{}, error) {
 	arg := map[string]interface{}{
 		"address": q.Addresses,
@@ -17,13 +17,25 @@
 package goclient
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/zeus-fyi/gochain/v4"
 	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/common/hexutil"
+	"github.com/zeus-fyi/gochain/v4/core/types"
+	"github.com/zeus-fyi/gochain/v4/rlp"
+	"github.com/zeus-fyi/gochain/v4/rpc"
 )
 
 // Verify that Client implements the gochain interfaces.
@@ -150,3 +162,254 @@ func TestToFilterArg(t *testing.T) {
 		})
 	}
 }
+
+// pagedLogsService serves eth_getLogsPaginated over a fixed set of logs, using
+// their index as cursor.
+type pagedLogsService struct {
+	logs  []*types.Log
+	calls int
+}
+
+type pagedLogs struct {
+	Logs   []*types.Log `json:"logs"`
+	Cursor *string      `json:"cursor"`
+}
+
+func (s *pagedLogsService) GetLogsPaginated(crit map[string]interface{}, cursor *string, limit *hexutil.Uint) (*pagedLogs, error) {
+	s.calls++
+	start := 0
+	if cursor != nil {
+		var err error
+		if start, err = strconv.Atoi(*cursor); err != nil {
+			return nil, err
+		}
+	}
+	size := 2
+	if limit != nil {
+		size = int(*limit)
+	}
+	page := &pagedLogs{Logs: s.logs[start:]}
+	if len(page.Logs) > size {
+		next := strconv.Itoa(start + size)
+		page.Logs, page.Cursor = page.Logs[:size], &next
+	}
+	return page, nil
+}
+
+func TestFilterLogsIter(t *testing.T) {
+	service := new(pagedLogsService)
+	for i := 0; i < 7; i++ {
+		service.logs = append(service.logs, &types.Log{BlockNumber: uint64(i), Index: uint(i), Topics: []common.Hash{}})
+	}
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", service); err != nil {
+		t.Fatal(err)
+	}
+	rpcClient := rpc.DialInProc(server)
+	defer rpcClient.Close()
+	client := NewClient(rpcClient)
+
+	for _, size := range []uint{0, 3, 10} {
+		service.calls = 0
+		it, err := client.FilterLogsIter(context.Background(), gochain.FilterQuery{}, size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var blocks []uint64
+		for it.Next() {
+			blocks = append(blocks, it.Log().BlockNumber)
+		}
+		if err := it.Error(); err != nil {
+			t.Fatalf("page size %d: iteration failed: %v", size, err)
+		}
+		if want := []uint64{0, 1, 2, 3, 4, 5, 6}; !reflect.DeepEqual(blocks, want) {
+			t.Errorf("page size %d: blocks mismatch: have %v, want %v", size, blocks, want)
+		}
+		pageSize := int(size)
+		if pageSize == 0 {
+			pageSize = 2
+		}
+		if want := (len(service.logs) + pageSize - 1) / pageSize; service.calls != want {
+			t.Errorf("page size %d: have %d calls, want %d", size, service.calls, want)
+		}
+	}
+}
+
+// streamService serves a durable stream of blocks numbered from the start, three
+// per subscription, recording where each subscription started.
+type streamService struct {
+	mu     sync.Mutex
+	starts []string
+}
+
+func (s *streamService) SubscribeFrom(ctx context.Context, start json.RawMessage, crit map[string]interface{}) (*rpc.Subscription, error) {
+	notifier, _ := rpc.NotifierFromContext(ctx)
+
+	var next uint64
+	if len(start) > 0 && start[0] == '{' {
+		var cursor StreamCursor
+		if err := json.Unmarshal(start, &cursor); err != nil {
+			return nil, err
+		}
+		next = uint64(cursor.Number) + 1
+	} else {
+		var number hexutil.Uint64
+		if err := json.Unmarshal(start, &number); err != nil {
+			return nil, err
+		}
+		next = uint64(number)
+	}
+	s.mu.Lock()
+	s.starts = append(s.starts, string(start))
+	s.mu.Unlock()
+
+	sub := notifier.CreateSubscription()
+	go func() {
+		for n := next; n < next+3; n++ {
+			hash := common.BigToHash(new(big.Int).SetUint64(n))
+			notifier.Notify(sub.ID, &StreamEvent{
+				Number: hexutil.Uint64(n),
+				Hash:   hash,
+				Logs:   []types.Log{},
+				Cursor: StreamCursor{Number: hexutil.Uint64(n), Hash: hash},
+			})
+		}
+	}()
+	return sub, nil
+}
+
+func TestStreamLogsResume(t *testing.T) {
+	service := new(streamService)
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", service); err != nil {
+		t.Fatal(err)
+	}
+	var (
+		connsMu sync.Mutex
+		conns   []net.Conn
+	)
+	httpsrv := httptest.NewUnstartedServer(server.WebsocketHandler([]string{"*"}))
+	httpsrv.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			connsMu.Lock()
+			conns = append(conns, conn)
+			connsMu.Unlock()
+		}
+	}
+	httpsrv.Start()
+	defer httpsrv.Close()
+
+	rpcClient, err := rpc.Dial("ws://" + httpsrv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rpcClient.Close()
+	client := NewClient(rpcClient)
+
+	events := make(chan StreamEvent)
+	sub, err := client.StreamLogs(context.Background(), gochain.FilterQuery{FromBlock: big.NewInt(0)}, nil, events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+
+	for n := uint64(0); n < 6; n++ {
+		select {
+		case ev := <-events:
+			if uint64(ev.Number) != n {
+				t.Fatalf("event number mismatch: have %d, want %d", ev.Number, n)
+			}
+		case err := <-sub.Err():
+			t.Fatalf("stream failed: %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("event %d timeout", n)
+		}
+		if n == 2 {
+			// Drop the connection, the stream resumes after block 2
+			connsMu.Lock()
+			for _, conn := range conns {
+				conn.Close()
+			}
+			connsMu.Unlock()
+		}
+	}
+	service.mu.Lock()
+	defer service.mu.Unlock()
+	cursor, _ := json.Marshal(StreamCursor{Number: 2, Hash: common.BigToHash(big.NewInt(2))})
+	if want := []string{`"0x0"`, string(cursor)}; !reflect.DeepEqual(service.starts, want) {
+		t.Errorf("subscription starts mismatch: have %v, want %v", service.starts, want)
+	}
+}
+
+// rawService serves the RLP encodings of a single block and its receipts.
+type rawService struct {
+	block    *types.Block
+	receipts types.Receipts
+}
+
+func (s *rawService) GetRawHeader(number string) (hexutil.Bytes, error) {
+	return rlp.EncodeToBytes(s.block.Header())
+}
+
+func (s *rawService) GetRawBlock(number string) (hexutil.Bytes, error) {
+	return rlp.EncodeToBytes(s.block)
+}
+
+func (s *rawService) GetRawReceipts(number string) ([]hexutil.Bytes, error) {
+	result := make([]hexutil.Bytes, len(s.receipts))
+	for i, receipt := range s.receipts {
+		var err error
+		if result[i], err = rlp.EncodeToBytes(receipt); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func TestRawBlockQueries(t *testing.T) {
+	var (
+		tx      = types.NewTransaction(1, common.HexToAddress("0x01"), big.NewInt(2), 21000, big.NewInt(3), nil)
+		receipt = &types.Receipt{Status: types.ReceiptStatusSuccessful, CumulativeGasUsed: 21000, Logs: []*types.Log{}}
+		header  = &types.Header{
+			Number:     big.NewInt(7),
+			Difficulty: big.NewInt(1),
+			Time:       big.NewInt(10),
+			GasLimit:   8000000,
+			Signers:    []common.Address{common.HexToAddress("0x02")},
+			Extra:      []byte("extra"),
+		}
+		service = &rawService{
+			block:    types.NewBlock(header, []*types.Transaction{tx}, nil, []*types.Receipt{receipt}),
+			receipts: types.Receipts{receipt},
+		}
+	)
+	server := rpc.NewServer()
+	if err := server.RegisterName("debug", service); err != nil {
+		t.Fatal(err)
+	}
+	rpcClient := rpc.DialInProc(server)
+	defer rpcClient.Close()
+	client := NewClient(rpcClient)
+
+	head, err := client.RawHeaderByNumber(context.Background(), big.NewInt(7))
+	if err != nil {
+		t.Fatalf("failed to fetch raw header: %v", err)
+	}
+	if head.Hash() != service.block.Hash() {
+		t.Errorf("header hash mismatch: have %x, want %x", head.Hash(), service.block.Hash())
+	}
+	block, err := client.RawBlockByNumber(context.Background(), big.NewInt(7))
+	if err != nil {
+		t.Fatalf("failed to fetch raw block: %v", err)
+	}
+	if block.Hash() != service.block.Hash() || len(block.Transactions()) != 1 || block.Transactions()[0].Hash() != tx.Hash() {
+		t.Errorf("block mismatch: have %x with %d txs, want %x with 1", block.Hash(), len(block.Transactions()), service.block.Hash())
+	}
+	receipts, err := client.RawReceiptsByNumber(context.Background(), big.NewInt(7))
+	if err != nil {
+		t.Fatalf("failed to fetch raw receipts: %v", err)
+	}
+	if len(receipts) != 1 || types.DeriveSha(receipts) != service.block.ReceiptHash() {
+		t.Errorf("receipts mismatch: have %d with root %x, want root %x", len(receipts), types.DeriveSha(receipts), service.block.ReceiptHash())
+	}
+}
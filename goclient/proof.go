@@ -0,0 +1,131 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package goclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/zeus-fyi/gochain/v4"
+	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/common/hexutil"
+	"github.com/zeus-fyi/gochain/v4/core/types"
+	"github.com/zeus-fyi/gochain/v4/crypto"
+	"github.com/zeus-fyi/gochain/v4/ethdb"
+	"github.com/zeus-fyi/gochain/v4/rlp"
+	"github.com/zeus-fyi/gochain/v4/trie"
+)
+
+// StorageRangeProof is a range of consecutive storage slots of an account,
+// ordered by the hash of their keys, with the proofs needed to verify it.
+type StorageRangeProof struct {
+	Address      common.Address     `json:"address"`
+	AccountProof []hexutil.Bytes    `json:"accountProof"`
+	StorageHash  common.Hash        `json:"storageHash"`
+	Start        common.Hash        `json:"start"`
+	Slots        []StorageRangeSlot `json:"slots"`
+	StorageProof []hexutil.Bytes    `json:"storageProof"`
+}
+
+// StorageRangeSlot is a slot of a storage range.
+type StorageRangeSlot struct {
+	Hash  common.Hash  `json:"hash"` // Hash of the key, ordering the range
+	Key   *common.Hash `json:"key"`  // Key of the slot, if known by the node
+	Value common.Hash  `json:"value"`
+}
+
+// StorageRangeProofAt returns up to limit consecutive storage slots of the given
+// account, from the slot whose key hash is start onwards, with their proofs.
+// The block number can be nil, in which case the range is taken from the latest
+// known block.
+func (ec *Client) StorageRangeProofAt(ctx context.Context, account common.Address, start common.Hash, limit int, blockNumber *big.Int) (*StorageRangeProof, error) {
+	var result *StorageRangeProof
+	err := ec.c.CallContext(ctx, &result, "eth_getStorageRangeProof", account, start, limit, toBlockNumArg(blockNumber))
+	if err == nil && result == nil {
+		return nil, gochain.NotFound
+	}
+	return result, err
+}
+
+// VerifyAccount checks that the account proof holds against the given state
+// root, typically the one of a trusted header, and commits to StorageHash.
+func (p *StorageRangeProof) VerifyAccount(stateRoot common.Hash) error {
+	value, _, err := trie.VerifyProof(stateRoot, crypto.Keccak256(p.Address[:]), proofDatabase(p.AccountProof))
+	if err != nil {
+		return err
+	}
+	if value == nil {
+		if p.StorageHash != types.EmptyRootHash {
+			return errors.New("storage hash of missing account")
+		}
+		return nil
+	}
+	var account struct {
+		Nonce    uint64
+		Balance  *big.Int
+		Root     common.Hash
+		CodeHash []byte
+	}
+	if err := rlp.DecodeBytes(value, &account); err != nil {
+		return err
+	}
+	if account.Root != p.StorageHash {
+		return fmt.Errorf("storage hash mismatch: proven %x, have %x", account.Root, p.StorageHash)
+	}
+	return nil
+}
+
+// Verify checks that the slots are exactly the ones of the storage trie from
+// Start up to the last slot, reporting whether more slots follow. The storage
+// hash itself is checked by VerifyAccount.
+func (p *StorageRangeProof) Verify() (bool, error) {
+	if p.StorageHash == types.EmptyRootHash {
+		if len(p.Slots) > 0 {
+			return false, errors.New("slots in empty storage")
+		}
+		return false, nil
+	}
+	keys := make([][]byte, len(p.Slots))
+	values := make([][]byte, len(p.Slots))
+	for i, slot := range p.Slots {
+		if slot.Key != nil && crypto.Keccak256Hash(slot.Key[:]) != slot.Hash {
+			return false, fmt.Errorf("slot %d: key %x does not match hash %x", i, *slot.Key, slot.Hash)
+		}
+		value, err := rlp.EncodeToBytes(bytes.TrimLeft(slot.Value[:], "\x00"))
+		if err != nil {
+			return false, err
+		}
+		keys[i], values[i] = slot.Hash.Bytes(), value
+	}
+	last := p.Start.Bytes()
+	if len(keys) > 0 {
+		last = keys[len(keys)-1]
+	}
+	return trie.VerifyRangeProof(p.StorageHash, p.Start[:], last, keys, values, proofDatabase(p.StorageProof))
+}
+
+// proofDatabase collects proof nodes into a database keyed by their hash.
+func proofDatabase(proof []hexutil.Bytes) *ethdb.MemDatabase {
+	db := ethdb.NewMemDatabase()
+	for _, node := range proof {
+		db.Put(crypto.Keccak256(node), node)
+	}
+	return db
+}
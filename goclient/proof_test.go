@@ -0,0 +1,107 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package goclient
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/common/hexutil"
+	"github.com/zeus-fyi/gochain/v4/core/state"
+	"github.com/zeus-fyi/gochain/v4/ethdb"
+	"github.com/zeus-fyi/gochain/v4/rlp"
+)
+
+// storageRangeProof assembles a range proof like the eth_getStorageRangeProof
+// RPC does, returning it with the state root.
+func storageRangeProof(t *testing.T, addr common.Address, start common.Hash, limit int) (*StorageRangeProof, common.Hash) {
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(ethdb.NewMemDatabase()))
+	for i := int64(1); i <= 50; i++ {
+		statedb.SetState(addr, common.BigToHash(big.NewInt(i)), common.BigToHash(big.NewInt(i+1000)))
+	}
+	root, err := statedb.Commit(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accountProof, err := statedb.GetProof(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, values, proof, err := statedb.GetStorageRangeProof(addr, start, limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := &StorageRangeProof{
+		Address:     addr,
+		StorageHash: statedb.StorageTrie(addr).Hash(),
+		Start:       start,
+	}
+	for _, node := range accountProof {
+		result.AccountProof = append(result.AccountProof, hexutil.Bytes(node))
+	}
+	for _, node := range proof {
+		result.StorageProof = append(result.StorageProof, hexutil.Bytes(node))
+	}
+	for i, key := range keys {
+		var value []byte
+		if err := rlp.DecodeBytes(values[i], &value); err != nil {
+			t.Fatal(err)
+		}
+		result.Slots = append(result.Slots, StorageRangeSlot{Hash: common.BytesToHash(key), Value: common.BytesToHash(value)})
+	}
+	return result, root
+}
+
+func TestStorageRangeProofVerify(t *testing.T) {
+	addr := common.HexToAddress("0x01")
+
+	proof, root := storageRangeProof(t, addr, common.Hash{}, 20)
+	if err := proof.VerifyAccount(root); err != nil {
+		t.Fatalf("account proof rejected: %v", err)
+	}
+	more, err := proof.Verify()
+	if err != nil {
+		t.Fatalf("range proof rejected: %v", err)
+	}
+	if !more {
+		t.Error("partial range reported complete")
+	}
+	all, _ := storageRangeProof(t, addr, common.Hash{}, 100)
+	if more, err := all.Verify(); err != nil || more {
+		t.Errorf("complete range: more %v, err %v", more, err)
+	}
+	// A withheld slot must be detected
+	withheld := *proof
+	withheld.Slots = append(append([]StorageRangeSlot{}, proof.Slots[:5]...), proof.Slots[6:]...)
+	if _, err := withheld.Verify(); err == nil {
+		t.Error("range with withheld slot accepted")
+	}
+	// A modified value must be detected
+	modified := *proof
+	modified.Slots = append([]StorageRangeSlot{}, proof.Slots...)
+	modified.Slots[3].Value = common.Hash{0x01}
+	if _, err := modified.Verify(); err == nil {
+		t.Error("range with modified value accepted")
+	}
+	// A foreign storage hash must be rejected by the account proof
+	foreign := *proof
+	foreign.StorageHash = common.Hash{0x01}
+	if err := foreign.VerifyAccount(root); err == nil {
+		t.Error("foreign storage hash accepted")
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package graphql
+
+import (
+	"net/http"
+)
+
+// GraphiQL is an in-browser IDE for exploring GraphQL APIs, querying the
+// service mounted at /graphql.
+type GraphiQL struct{}
+
+func (h GraphiQL) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "only GET requests are supported", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html")
+	w.Write(graphiql)
+}
+
+var graphiql = []byte(`
+<!DOCTYPE html>
+<html>
+  <head>
+    <title>GoChain GraphQL</title>
+    <link href="https://unpkg.com/graphiql@0.12.0/graphiql.css" rel="stylesheet" />
+    <script src="https://unpkg.com/es6-promise@4.2.8/dist/es6-promise.auto.min.js"></script>
+    <script src="https://unpkg.com/whatwg-fetch@3.0.0/dist/fetch.umd.js"></script>
+    <script src="https://unpkg.com/react@16.8.6/umd/react.production.min.js"></script>
+    <script src="https://unpkg.com/react-dom@16.8.6/umd/react-dom.production.min.js"></script>
+    <script src="https://unpkg.com/graphiql@0.12.0/graphiql.min.js"></script>
+  </head>
+  <body style="width: 100%; height: 100%; margin: 0; overflow: hidden;">
+    <div id="graphiql" style="height: 100vh;">Loading...</div>
+    <script>
+      function graphQLFetcher(graphQLParams) {
+        return fetch("/graphql", {
+          method: "post",
+          body: JSON.stringify(graphQLParams),
+          credentials: "include",
+        }).then(function (response) {
+          return response.text();
+        }).then(function (responseBody) {
+          try {
+            return JSON.parse(responseBody);
+          } catch (error) {
+            return responseBody;
+          }
+        });
+      }
+      ReactDOM.render(
+        React.createElement(GraphiQL, {fetcher: graphQLFetcher}),
+        document.getElementById("graphiql")
+      );
+    </script>
+  </body>
+</html>
+`)
@@ -0,0 +1,1045 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package graphql provides a GraphQL interface to GoChain node data.
+package graphql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zeus-fyi/gochain/v4"
+	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/common/hexutil"
+	"github.com/zeus-fyi/gochain/v4/consensus/clique"
+	"github.com/zeus-fyi/gochain/v4/core/rawdb"
+	"github.com/zeus-fyi/gochain/v4/core/state"
+	"github.com/zeus-fyi/gochain/v4/core/types"
+	"github.com/zeus-fyi/gochain/v4/core/vm"
+	"github.com/zeus-fyi/gochain/v4/crypto"
+	"github.com/zeus-fyi/gochain/v4/eth/filters"
+	"github.com/zeus-fyi/gochain/v4/internal/ethapi"
+	"github.com/zeus-fyi/gochain/v4/rlp"
+	"github.com/zeus-fyi/gochain/v4/rpc"
+)
+
+var (
+	errTransactionNotFound = errors.New("transaction not found")
+	errStateNotFound       = errors.New("state not found")
+)
+
+// callTimeout bounds the execution of the local calls of queries.
+const callTimeout = 5 * time.Second
+
+// Backend is the access to the chain needed by the GraphQL service, provided
+// by both full and light clients.
+type Backend interface {
+	ethapi.Backend
+	filters.Backend
+}
+
+// Long is a 64 bit unsigned integer.
+type Long int64
+
+// ImplementsGraphQLType returns true if Long implements the provided GraphQL type.
+func (b Long) ImplementsGraphQLType(name string) bool { return name == "Long" }
+
+// UnmarshalGraphQL unmarshals the provided GraphQL query data, a hex or decimal
+// string or a number.
+func (b *Long) UnmarshalGraphQL(input interface{}) error {
+	var err error
+	switch input := input.(type) {
+	case string:
+		var value uint64
+		if strings.HasPrefix(input, "0x") {
+			value, err = hexutil.DecodeUint64(input)
+		} else {
+			value, err = strconv.ParseUint(input, 10, 63)
+		}
+		*b = Long(value)
+	case int32:
+		*b = Long(input)
+	case int64:
+		*b = Long(input)
+	case float64:
+		*b = Long(input)
+	default:
+		err = fmt.Errorf("unexpected type %T for Long", input)
+	}
+	return err
+}
+
+// blockNumberOrLatest returns the block number of an optional argument,
+// defaulting to the latest block.
+func blockNumberOrLatest(number *Long) rpc.BlockNumber {
+	if number == nil {
+		return rpc.LatestBlockNumber
+	}
+	return rpc.BlockNumber(*number)
+}
+
+// BlockNumberArgs are the arguments of the fields taking an optional block.
+type BlockNumberArgs struct {
+	Block *Long
+}
+
+// Account represents an Ethereum account at a particular block.
+type Account struct {
+	backend     Backend
+	address     common.Address
+	blockNumber rpc.BlockNumber
+}
+
+// getState fetches the state the account is looked up in.
+func (a *Account) getState(ctx context.Context) (*state.StateDB, error) {
+	state, _, err := a.backend.StateAndHeaderByNumber(ctx, a.blockNumber)
+	if state == nil && err == nil {
+		err = errStateNotFound
+	}
+	return state, err
+}
+
+func (a *Account) Address(ctx context.Context) (common.Address, error) {
+	return a.address, nil
+}
+
+func (a *Account) Balance(ctx context.Context) (hexutil.Big, error) {
+	state, err := a.getState(ctx)
+	if err != nil {
+		return hexutil.Big{}, err
+	}
+	balance, err := state.GetBalanceErr(a.address)
+	if err != nil {
+		return hexutil.Big{}, err
+	}
+	return hexutil.Big(*balance), nil
+}
+
+func (a *Account) TransactionCount(ctx context.Context) (Long, error) {
+	state, err := a.getState(ctx)
+	if err != nil {
+		return 0, err
+	}
+	nonce, err := state.GetNonceErr(a.address)
+	return Long(nonce), err
+}
+
+func (a *Account) Code(ctx context.Context) (hexutil.Bytes, error) {
+	state, err := a.getState(ctx)
+	if err != nil {
+		return nil, err
+	}
+	code, err := state.GetCodeErr(a.address)
+	return hexutil.Bytes(code), err
+}
+
+func (a *Account) Storage(ctx context.Context, args struct{ Slot common.Hash }) (common.Hash, error) {
+	state, err := a.getState(ctx)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return state.GetStateErr(a.address, args.Slot)
+}
+
+// Log represents an individual log message. All arguments are mandatory.
+type Log struct {
+	backend     Backend
+	transaction *Transaction
+	log         *types.Log
+}
+
+// newLogs wraps the logs of a query, sharing the transactions among them.
+func newLogs(backend Backend, logs []*types.Log) []*Log {
+	var (
+		ret = make([]*Log, 0, len(logs))
+		txs = make(map[common.Hash]*Transaction)
+	)
+	for _, log := range logs {
+		tx, ok := txs[log.TxHash]
+		if !ok {
+			tx = &Transaction{backend: backend, hash: log.TxHash}
+			txs[log.TxHash] = tx
+		}
+		ret = append(ret, &Log{backend: backend, transaction: tx, log: log})
+	}
+	return ret
+}
+
+func (l *Log) Transaction(ctx context.Context) *Transaction {
+	return l.transaction
+}
+
+func (l *Log) Account(ctx context.Context, args BlockNumberArgs) *Account {
+	return &Account{
+		backend:     l.backend,
+		address:     l.log.Address,
+		blockNumber: blockNumberOrLatest(args.Block),
+	}
+}
+
+func (l *Log) Index(ctx context.Context) int32 {
+	return int32(l.log.Index)
+}
+
+func (l *Log) Topics(ctx context.Context) []common.Hash {
+	return l.log.Topics
+}
+
+func (l *Log) Data(ctx context.Context) hexutil.Bytes {
+	return hexutil.Bytes(l.log.Data)
+}
+
+// Transaction represents an Ethereum transaction, resolved on first use when
+// only its hash is known.
+type Transaction struct {
+	backend Backend
+	hash    common.Hash
+
+	mu    sync.Mutex
+	tx    *types.Transaction
+	block *Block // Block including the transaction, nil while pending
+	index uint64
+}
+
+// resolve returns the internal transaction object, fetching it if needed.
+func (t *Transaction) resolve(ctx context.Context) (*types.Transaction, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.tx != nil {
+		return t.tx, nil
+	}
+	if tx, blockHash, _, index := rawdb.ReadTransaction(t.backend.ChainDb(), t.hash); tx != nil {
+		header, err := t.backend.HeaderByHash(ctx, blockHash)
+		if err != nil {
+			return nil, err
+		}
+		if header != nil {
+			t.block = newBlock(t.backend, header)
+		}
+		t.tx, t.index = tx, index
+		return tx, nil
+	}
+	if tx := t.backend.GetPoolTransaction(t.hash); tx != nil {
+		t.tx = tx
+		return tx, nil
+	}
+	return nil, errTransactionNotFound
+}
+
+// getReceipt returns the receipt of the transaction, nil while pending.
+func (t *Transaction) getReceipt(ctx context.Context) (*types.Receipt, error) {
+	if _, err := t.resolve(ctx); err != nil {
+		return nil, err
+	}
+	if t.block == nil {
+		return nil, nil
+	}
+	receipts, err := t.block.resolveReceipts(ctx)
+	if err != nil || uint64(len(receipts)) <= t.index {
+		return nil, err
+	}
+	return receipts[t.index], nil
+}
+
+func (t *Transaction) Hash(ctx context.Context) common.Hash {
+	return t.hash
+}
+
+func (t *Transaction) InputData(ctx context.Context) (hexutil.Bytes, error) {
+	tx, err := t.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return hexutil.Bytes(tx.Data()), nil
+}
+
+func (t *Transaction) Gas(ctx context.Context) (Long, error) {
+	tx, err := t.resolve(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return Long(tx.Gas()), nil
+}
+
+func (t *Transaction) GasPrice(ctx context.Context) (hexutil.Big, error) {
+	tx, err := t.resolve(ctx)
+	if err != nil {
+		return hexutil.Big{}, err
+	}
+	return hexutil.Big(*tx.GasPrice()), nil
+}
+
+func (t *Transaction) Value(ctx context.Context) (hexutil.Big, error) {
+	tx, err := t.resolve(ctx)
+	if err != nil {
+		return hexutil.Big{}, err
+	}
+	return hexutil.Big(*tx.Value()), nil
+}
+
+func (t *Transaction) Nonce(ctx context.Context) (Long, error) {
+	tx, err := t.resolve(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return Long(tx.Nonce()), nil
+}
+
+func (t *Transaction) To(ctx context.Context, args BlockNumberArgs) (*Account, error) {
+	tx, err := t.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	to := tx.To()
+	if to == nil {
+		return nil, nil
+	}
+	return &Account{
+		backend:     t.backend,
+		address:     *to,
+		blockNumber: blockNumberOrLatest(args.Block),
+	}, nil
+}
+
+func (t *Transaction) From(ctx context.Context, args BlockNumberArgs) (*Account, error) {
+	tx, err := t.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var signer types.Signer = types.FrontierSigner{}
+	if tx.Protected() {
+		signer = types.NewEIP155Signer(tx.ChainId())
+	}
+	from, err := types.Sender(signer, tx)
+	if err != nil {
+		return nil, err
+	}
+	return &Account{
+		backend:     t.backend,
+		address:     from,
+		blockNumber: blockNumberOrLatest(args.Block),
+	}, nil
+}
+
+func (t *Transaction) Block(ctx context.Context) (*Block, error) {
+	if _, err := t.resolve(ctx); err != nil {
+		return nil, err
+	}
+	return t.block, nil
+}
+
+func (t *Transaction) Index(ctx context.Context) (*int32, error) {
+	if _, err := t.resolve(ctx); err != nil {
+		return nil, err
+	}
+	if t.block == nil {
+		return nil, nil
+	}
+	index := int32(t.index)
+	return &index, nil
+}
+
+func (t *Transaction) Status(ctx context.Context) (*Long, error) {
+	receipt, err := t.getReceipt(ctx)
+	if err != nil || receipt == nil {
+		return nil, err
+	}
+	status := Long(receipt.Status)
+	return &status, nil
+}
+
+func (t *Transaction) GasUsed(ctx context.Context) (*Long, error) {
+	receipt, err := t.getReceipt(ctx)
+	if err != nil || receipt == nil {
+		return nil, err
+	}
+	used := Long(receipt.GasUsed)
+	return &used, nil
+}
+
+func (t *Transaction) CumulativeGasUsed(ctx context.Context) (*Long, error) {
+	receipt, err := t.getReceipt(ctx)
+	if err != nil || receipt == nil {
+		return nil, err
+	}
+	used := Long(receipt.CumulativeGasUsed)
+	return &used, nil
+}
+
+func (t *Transaction) CreatedContract(ctx context.Context, args BlockNumberArgs) (*Account, error) {
+	receipt, err := t.getReceipt(ctx)
+	if err != nil || receipt == nil || receipt.ContractAddress == (common.Address{}) {
+		return nil, err
+	}
+	return &Account{
+		backend:     t.backend,
+		address:     receipt.ContractAddress,
+		blockNumber: blockNumberOrLatest(args.Block),
+	}, nil
+}
+
+func (t *Transaction) Logs(ctx context.Context) (*[]*Log, error) {
+	receipt, err := t.getReceipt(ctx)
+	if err != nil || receipt == nil {
+		return nil, err
+	}
+	ret := make([]*Log, 0, len(receipt.Logs))
+	for _, log := range receipt.Logs {
+		ret = append(ret, &Log{backend: t.backend, transaction: t, log: log})
+	}
+	return &ret, nil
+}
+
+func (t *Transaction) R(ctx context.Context) (hexutil.Big, error) {
+	tx, err := t.resolve(ctx)
+	if err != nil {
+		return hexutil.Big{}, err
+	}
+	_, r, _ := tx.RawSignatureValues()
+	return hexutil.Big(*r), nil
+}
+
+func (t *Transaction) S(ctx context.Context) (hexutil.Big, error) {
+	tx, err := t.resolve(ctx)
+	if err != nil {
+		return hexutil.Big{}, err
+	}
+	_, _, s := tx.RawSignatureValues()
+	return hexutil.Big(*s), nil
+}
+
+func (t *Transaction) V(ctx context.Context) (hexutil.Big, error) {
+	tx, err := t.resolve(ctx)
+	if err != nil {
+		return hexutil.Big{}, err
+	}
+	v, _, _ := tx.RawSignatureValues()
+	return hexutil.Big(*v), nil
+}
+
+func (t *Transaction) Raw(ctx context.Context) (hexutil.Bytes, error) {
+	tx, err := t.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return rlp.EncodeToBytes(tx)
+}
+
+func (t *Transaction) RawReceipt(ctx context.Context) (hexutil.Bytes, error) {
+	receipt, err := t.getReceipt(ctx)
+	if err != nil || receipt == nil {
+		return hexutil.Bytes{}, err
+	}
+	return rlp.EncodeToBytes(receipt)
+}
+
+// Block represents an Ethereum block, whose body and receipts are fetched on
+// first use.
+type Block struct {
+	backend Backend
+	header  *types.Header
+	hash    common.Hash
+
+	mu       sync.Mutex
+	block    *types.Block
+	receipts types.Receipts
+}
+
+// newBlock wraps the header of a known block.
+func newBlock(backend Backend, header *types.Header) *Block {
+	return &Block{backend: backend, header: header, hash: header.Hash()}
+}
+
+// number returns the block number to look up state at.
+func (b *Block) number() rpc.BlockNumber {
+	return rpc.BlockNumber(b.header.Number.Int64())
+}
+
+// resolve returns the internal block object, nil if the body isn't available.
+func (b *Block) resolve(ctx context.Context) (*types.Block, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.block != nil {
+		return b.block, nil
+	}
+	block, err := b.backend.GetBlock(ctx, b.hash)
+	if err != nil {
+		return nil, err
+	}
+	b.block = block
+	return block, nil
+}
+
+// resolveReceipts returns the receipts of the block.
+func (b *Block) resolveReceipts(ctx context.Context) (types.Receipts, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.receipts != nil {
+		return b.receipts, nil
+	}
+	receipts, err := b.backend.GetReceipts(ctx, b.hash)
+	if err != nil {
+		return nil, err
+	}
+	b.receipts = receipts
+	return receipts, nil
+}
+
+func (b *Block) Number(ctx context.Context) Long {
+	return Long(b.header.Number.Uint64())
+}
+
+func (b *Block) Hash(ctx context.Context) common.Hash {
+	return b.hash
+}
+
+func (b *Block) GasLimit(ctx context.Context) Long {
+	return Long(b.header.GasLimit)
+}
+
+func (b *Block) GasUsed(ctx context.Context) Long {
+	return Long(b.header.GasUsed)
+}
+
+func (b *Block) Parent(ctx context.Context) (*Block, error) {
+	if b.header.Number.Sign() == 0 {
+		return nil, nil
+	}
+	header, err := b.backend.HeaderByHash(ctx, b.header.ParentHash)
+	if header == nil || err != nil {
+		return nil, err
+	}
+	return newBlock(b.backend, header), nil
+}
+
+func (b *Block) Difficulty(ctx context.Context) hexutil.Big {
+	return hexutil.Big(*b.header.Difficulty)
+}
+
+func (b *Block) Timestamp(ctx context.Context) Long {
+	return Long(b.header.Time.Uint64())
+}
+
+func (b *Block) Nonce(ctx context.Context) hexutil.Bytes {
+	return hexutil.Bytes(b.header.Nonce[:])
+}
+
+func (b *Block) MixHash(ctx context.Context) common.Hash {
+	return b.header.MixDigest
+}
+
+func (b *Block) TransactionsRoot(ctx context.Context) common.Hash {
+	return b.header.TxHash
+}
+
+func (b *Block) StateRoot(ctx context.Context) common.Hash {
+	return b.header.Root
+}
+
+func (b *Block) ReceiptsRoot(ctx context.Context) common.Hash {
+	return b.header.ReceiptHash
+}
+
+func (b *Block) OmmerHash(ctx context.Context) common.Hash {
+	return b.header.UncleHash
+}
+
+func (b *Block) OmmerCount(ctx context.Context) (*int32, error) {
+	block, err := b.resolve(ctx)
+	if err != nil || block == nil {
+		return nil, err
+	}
+	count := int32(len(block.Uncles()))
+	return &count, nil
+}
+
+func (b *Block) Ommers(ctx context.Context) (*[]*Block, error) {
+	block, err := b.resolve(ctx)
+	if err != nil || block == nil {
+		return nil, err
+	}
+	ret := make([]*Block, 0, len(block.Uncles()))
+	for _, uncle := range block.Uncles() {
+		ret = append(ret, newBlock(b.backend, uncle))
+	}
+	return &ret, nil
+}
+
+func (b *Block) OmmerAt(ctx context.Context, args struct{ Index int32 }) (*Block, error) {
+	block, err := b.resolve(ctx)
+	if err != nil || block == nil {
+		return nil, err
+	}
+	uncles := block.Uncles()
+	if args.Index < 0 || int(args.Index) >= len(uncles) {
+		return nil, nil
+	}
+	return newBlock(b.backend, uncles[args.Index]), nil
+}
+
+func (b *Block) ExtraData(ctx context.Context) hexutil.Bytes {
+	return hexutil.Bytes(b.header.Extra)
+}
+
+func (b *Block) LogsBloom(ctx context.Context) hexutil.Bytes {
+	return hexutil.Bytes(b.header.Bloom.Bytes())
+}
+
+func (b *Block) TotalDifficulty(ctx context.Context) (hexutil.Big, error) {
+	td := b.backend.GetTd(b.hash)
+	if td == nil {
+		return hexutil.Big{}, fmt.Errorf("total difficulty not found %x", b.hash)
+	}
+	return hexutil.Big(*td), nil
+}
+
+func (b *Block) Miner(ctx context.Context, args BlockNumberArgs) *Account {
+	return &Account{
+		backend:     b.backend,
+		address:     b.header.Coinbase,
+		blockNumber: blockNumberOrLatest(args.Block),
+	}
+}
+
+func (b *Block) TransactionCount(ctx context.Context) (*int32, error) {
+	block, err := b.resolve(ctx)
+	if err != nil || block == nil {
+		return nil, err
+	}
+	count := int32(len(block.Transactions()))
+	return &count, nil
+}
+
+func (b *Block) Transactions(ctx context.Context) (*[]*Transaction, error) {
+	block, err := b.resolve(ctx)
+	if err != nil || block == nil {
+		return nil, err
+	}
+	ret := make([]*Transaction, 0, len(block.Transactions()))
+	for i, tx := range block.Transactions() {
+		ret = append(ret, &Transaction{
+			backend: b.backend,
+			hash:    tx.Hash(),
+			tx:      tx,
+			block:   b,
+			index:   uint64(i),
+		})
+	}
+	return &ret, nil
+}
+
+func (b *Block) TransactionAt(ctx context.Context, args struct{ Index int32 }) (*Transaction, error) {
+	block, err := b.resolve(ctx)
+	if err != nil || block == nil {
+		return nil, err
+	}
+	txs := block.Transactions()
+	if args.Index < 0 || int(args.Index) >= len(txs) {
+		return nil, nil
+	}
+	tx := txs[args.Index]
+	return &Transaction{
+		backend: b.backend,
+		hash:    tx.Hash(),
+		tx:      tx,
+		block:   b,
+		index:   uint64(args.Index),
+	}, nil
+}
+
+// BlockFilterCriteria encapsulates criteria passed to a `logs` accessor inside
+// a block.
+type BlockFilterCriteria struct {
+	Addresses *[]common.Address // Restricts matches to events created by specific contracts
+	Topics    *[][]common.Hash  // Restricts matches to particular event topics
+}
+
+func (b *Block) Logs(ctx context.Context, args struct{ Filter BlockFilterCriteria }) ([]*Log, error) {
+	var addresses []common.Address
+	if args.Filter.Addresses != nil {
+		addresses = *args.Filter.Addresses
+	}
+	var topics [][]common.Hash
+	if args.Filter.Topics != nil {
+		topics = *args.Filter.Topics
+	}
+	logs, err := filters.NewBlockFilter(b.backend, b.hash, addresses, topics).Logs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return newLogs(b.backend, logs), nil
+}
+
+func (b *Block) Account(ctx context.Context, args struct{ Address common.Address }) *Account {
+	return &Account{
+		backend:     b.backend,
+		address:     args.Address,
+		blockNumber: b.number(),
+	}
+}
+
+func (b *Block) Call(ctx context.Context, args struct{ Data CallData }) (*CallResult, error) {
+	return call(ctx, b.backend, args.Data, b.number())
+}
+
+func (b *Block) EstimateGas(ctx context.Context, args struct{ Data CallData }) (Long, error) {
+	return estimateGas(ctx, b.backend, args.Data, b.number())
+}
+
+func (b *Block) Raw(ctx context.Context) (hexutil.Bytes, error) {
+	block, err := b.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, fmt.Errorf("block body not found %x", b.hash)
+	}
+	return rlp.EncodeToBytes(block)
+}
+
+func (b *Block) RawHeader(ctx context.Context) (hexutil.Bytes, error) {
+	return rlp.EncodeToBytes(b.header)
+}
+
+func (b *Block) Signers(ctx context.Context) []common.Address {
+	return b.header.Signers
+}
+
+func (b *Block) Voters(ctx context.Context) []common.Address {
+	return b.header.Voters
+}
+
+// Signer recovers the account that signed the block from its signature. The
+// genesis block isn't signed.
+func (b *Block) Signer(ctx context.Context) (*common.Address, error) {
+	if b.header.Number.Sign() == 0 || len(b.header.Signer) == 0 {
+		return nil, nil
+	}
+	pubkey, err := crypto.Ecrecover(clique.SealHash(b.header).Bytes(), b.header.Signer)
+	if err != nil {
+		return nil, err
+	}
+	signer := common.BytesToAddress(crypto.Keccak256(pubkey[1:])[12:])
+	return &signer, nil
+}
+
+// CallData encapsulates the arguments of a local call.
+type CallData struct {
+	From     *common.Address // The Ethereum address the call is from
+	To       *common.Address // The Ethereum address the call is to
+	Gas      *Long           // The amount of gas provided for the call
+	GasPrice *hexutil.Big    // The price of each unit of gas, in wei
+	Value    *hexutil.Big    // The value sent along with the call
+	Data     *hexutil.Bytes  // Any data sent with the call
+}
+
+// args converts the call data into the arguments of the RPC calls.
+func (c *CallData) args() ethapi.CallArgs {
+	args := ethapi.CallArgs{
+		From:     c.From,
+		To:       c.To,
+		GasPrice: c.GasPrice,
+		Value:    c.Value,
+		Data:     c.Data,
+	}
+	if c.Gas != nil {
+		gas := hexutil.Uint64(*c.Gas)
+		args.Gas = &gas
+	}
+	return args
+}
+
+// CallResult encapsulates the result of an invocation of the `call` accessor.
+type CallResult struct {
+	data    hexutil.Bytes // The return data from the call
+	gasUsed Long          // The amount of gas used
+	status  Long          // The return status of the call - 0 for failure or 1 for success.
+}
+
+func (c *CallResult) Data() hexutil.Bytes {
+	return c.data
+}
+
+func (c *CallResult) GasUsed() Long {
+	return c.gasUsed
+}
+
+func (c *CallResult) Status() Long {
+	return c.status
+}
+
+// call executes a local call at the state of the given block.
+func call(ctx context.Context, backend Backend, data CallData, number rpc.BlockNumber) (*CallResult, error) {
+	if err := rpc.Authorize(ctx, "eth_call"); err != nil {
+		return nil, err
+	}
+	result, gas, failed, err := ethapi.DoCall(ctx, backend, data.args(), number, vm.Config{}, callTimeout)
+	if err != nil {
+		return nil, err
+	}
+	status := Long(1)
+	if failed {
+		status = 0
+	}
+	return &CallResult{data: result, gasUsed: Long(gas), status: status}, nil
+}
+
+// estimateGas estimates the gas of a local call at the state of the given
+// block.
+func estimateGas(ctx context.Context, backend Backend, data CallData, number rpc.BlockNumber) (Long, error) {
+	if err := rpc.Authorize(ctx, "eth_estimateGas"); err != nil {
+		return 0, err
+	}
+	gas, err := ethapi.DoEstimateGas(ctx, backend, data.args(), number)
+	return Long(gas), err
+}
+
+// Pending represents the pending state.
+type Pending struct {
+	backend Backend
+}
+
+func (p *Pending) TransactionCount(ctx context.Context) int32 {
+	return int32(len(p.backend.GetPoolTransactions()))
+}
+
+func (p *Pending) Transactions(ctx context.Context) *[]*Transaction {
+	txs := p.backend.GetPoolTransactions()
+	ret := make([]*Transaction, 0, len(txs))
+	for _, tx := range txs {
+		ret = append(ret, &Transaction{backend: p.backend, hash: tx.Hash(), tx: tx})
+	}
+	return &ret
+}
+
+func (p *Pending) Account(ctx context.Context, args struct{ Address common.Address }) *Account {
+	return &Account{
+		backend:     p.backend,
+		address:     args.Address,
+		blockNumber: rpc.PendingBlockNumber,
+	}
+}
+
+func (p *Pending) Call(ctx context.Context, args struct{ Data CallData }) (*CallResult, error) {
+	return call(ctx, p.backend, args.Data, rpc.PendingBlockNumber)
+}
+
+func (p *Pending) EstimateGas(ctx context.Context, args struct{ Data CallData }) (Long, error) {
+	return estimateGas(ctx, p.backend, args.Data, rpc.PendingBlockNumber)
+}
+
+// Resolver is the top-level object in the GraphQL hierarchy. Its queries and
+// mutations, and the calls of blocks, are authorized like the equivalent
+// methods of the eth RPC namespace.
+type Resolver struct {
+	backend Backend
+	logs    filters.Config
+}
+
+func (r *Resolver) Block(ctx context.Context, args struct {
+	Number *Long
+	Hash   *common.Hash
+}) (*Block, error) {
+	var (
+		header *types.Header
+		err    error
+	)
+	if args.Hash != nil {
+		err = rpc.Authorize(ctx, "eth_getBlockByHash")
+	} else {
+		err = rpc.Authorize(ctx, "eth_getBlockByNumber")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if args.Hash != nil {
+		header, err = r.backend.HeaderByHash(ctx, *args.Hash)
+	} else {
+		header, err = r.backend.HeaderByNumber(ctx, blockNumberOrLatest(args.Number))
+	}
+	if header == nil || err != nil {
+		return nil, err
+	}
+	return newBlock(r.backend, header), nil
+}
+
+func (r *Resolver) Blocks(ctx context.Context, args struct {
+	From Long
+	To   *Long
+}) ([]*Block, error) {
+	if err := rpc.Authorize(ctx, "eth_getBlockByNumber"); err != nil {
+		return nil, err
+	}
+	var to rpc.BlockNumber
+	if args.To != nil {
+		to = rpc.BlockNumber(*args.To)
+	} else {
+		to = rpc.BlockNumber(r.backend.CurrentBlock().Number().Int64())
+	}
+	if to < rpc.BlockNumber(args.From) {
+		return []*Block{}, nil
+	}
+	if max := r.logs.MaxBlockRange; max > 0 && uint64(to)-uint64(args.From) >= max {
+		return nil, fmt.Errorf("query spans %d blocks, more than the limit of %d", uint64(to)-uint64(args.From)+1, max)
+	}
+	var ret []*Block
+	for i := rpc.BlockNumber(args.From); i <= to; i++ {
+		header, err := r.backend.HeaderByNumber(ctx, i)
+		if err != nil {
+			return nil, err
+		}
+		if header == nil {
+			break
+		}
+		ret = append(ret, newBlock(r.backend, header))
+	}
+	return ret, nil
+}
+
+func (r *Resolver) Pending(ctx context.Context) (*Pending, error) {
+	if err := rpc.Authorize(ctx, "eth_getBlockByNumber"); err != nil {
+		return nil, err
+	}
+	return &Pending{r.backend}, nil
+}
+
+func (r *Resolver) Transaction(ctx context.Context, args struct{ Hash common.Hash }) (*Transaction, error) {
+	if err := rpc.Authorize(ctx, "eth_getTransactionByHash"); err != nil {
+		return nil, err
+	}
+	tx := &Transaction{backend: r.backend, hash: args.Hash}
+	if _, err := tx.resolve(ctx); err != nil {
+		if err == errTransactionNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return tx, nil
+}
+
+func (r *Resolver) SendRawTransaction(ctx context.Context, args struct{ Data hexutil.Bytes }) (common.Hash, error) {
+	if err := rpc.Authorize(ctx, "eth_sendRawTransaction"); err != nil {
+		return common.Hash{}, err
+	}
+	tx := new(types.Transaction)
+	if err := rlp.DecodeBytes(args.Data, tx); err != nil {
+		return common.Hash{}, err
+	}
+	return ethapi.SubmitTransaction(ctx, r.backend, tx)
+}
+
+// FilterCriteria encapsulates the arguments to `logs` on the root resolver object.
+type FilterCriteria struct {
+	FromBlock *Long             // beginning of the queried range, nil means latest block
+	ToBlock   *Long             // end of the range, nil means latest block
+	Addresses *[]common.Address // restricts matches to events created by specific contracts
+	Topics    *[][]common.Hash  // restricts matches to particular event topics
+}
+
+func (r *Resolver) Logs(ctx context.Context, args struct{ Filter FilterCriteria }) ([]*Log, error) {
+	if err := rpc.Authorize(ctx, "eth_getLogs"); err != nil {
+		return nil, err
+	}
+	var crit filters.FilterCriteria
+	if args.Filter.FromBlock != nil {
+		crit.FromBlock = new(big.Int).SetInt64(int64(*args.Filter.FromBlock))
+	}
+	if args.Filter.ToBlock != nil {
+		crit.ToBlock = new(big.Int).SetInt64(int64(*args.Filter.ToBlock))
+	}
+	if args.Filter.Addresses != nil {
+		crit.Addresses = *args.Filter.Addresses
+	}
+	if args.Filter.Topics != nil {
+		crit.Topics = *args.Filter.Topics
+	}
+	logs, err := filters.GetLogs(ctx, r.backend, r.logs, crit)
+	if err != nil {
+		return nil, err
+	}
+	return newLogs(r.backend, logs), nil
+}
+
+func (r *Resolver) GasPrice(ctx context.Context) (hexutil.Big, error) {
+	if err := rpc.Authorize(ctx, "eth_gasPrice"); err != nil {
+		return hexutil.Big{}, err
+	}
+	price, err := r.backend.SuggestPrice(ctx)
+	if err != nil {
+		return hexutil.Big{}, err
+	}
+	return hexutil.Big(*price), nil
+}
+
+func (r *Resolver) ProtocolVersion(ctx context.Context) (int32, error) {
+	if err := rpc.Authorize(ctx, "eth_protocolVersion"); err != nil {
+		return 0, err
+	}
+	return int32(r.backend.ProtocolVersion()), nil
+}
+
+// SyncState represents the synchronisation status returned from the `syncing`
+// accessor.
+type SyncState struct {
+	progress gochain.SyncProgress
+}
+
+func (s *SyncState) StartingBlock() Long {
+	return Long(s.progress.StartingBlock)
+}
+
+func (s *SyncState) CurrentBlock() Long {
+	return Long(s.progress.CurrentBlock)
+}
+
+func (s *SyncState) HighestBlock() Long {
+	return Long(s.progress.HighestBlock)
+}
+
+func (s *SyncState) PulledStates() *Long {
+	ret := Long(s.progress.PulledStates)
+	return &ret
+}
+
+func (s *SyncState) KnownStates() *Long {
+	ret := Long(s.progress.KnownStates)
+	return &ret
+}
+
+// Syncing returns nil if the node is not currently syncing with the network,
+// or the progress of the synchronisation otherwise.
+func (r *Resolver) Syncing(ctx context.Context) (*SyncState, error) {
+	if err := rpc.Authorize(ctx, "eth_syncing"); err != nil {
+		return nil, err
+	}
+	progress := r.backend.Downloader().Progress()
+
+	// Return not syncing if the synchronisation already completed
+	if progress.CurrentBlock >= progress.HighestBlock {
+		return nil, nil
+	}
+	// Otherwise gather the block sync stats
+	return &SyncState{progress}, nil
+}
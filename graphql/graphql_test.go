@@ -0,0 +1,222 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/consensus/clique"
+	"github.com/zeus-fyi/gochain/v4/core"
+	"github.com/zeus-fyi/gochain/v4/core/types"
+	"github.com/zeus-fyi/gochain/v4/crypto"
+	"github.com/zeus-fyi/gochain/v4/eth"
+	"github.com/zeus-fyi/gochain/v4/eth/filters"
+	"github.com/zeus-fyi/gochain/v4/node"
+	"github.com/zeus-fyi/gochain/v4/p2p"
+)
+
+// testNodeConfig returns the configuration of a node serving HTTP on the
+// given port.
+func testNodeConfig(port int) *node.Config {
+	return &node.Config{
+		Name:     "graphql-test",
+		HTTPHost: "127.0.0.1",
+		HTTPPort: port,
+		P2P:      p2p.Config{MaxPeers: 0, NoDiscovery: true, ListenAddr: ":0"},
+	}
+}
+
+// newTestStack starts a node serving GraphQL over the chain of a developer
+// genesis funding and authorizing the given account.
+func newTestStack(t *testing.T, conf *node.Config, faucet common.Address) *node.Node {
+	stack, err := node.New(conf)
+	if err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+	ethConf := &eth.Config{Genesis: core.DeveloperGenesisBlock(15, faucet), Logs: filters.DefaultConfig}
+	var ethServ *eth.GoChain
+	if err := stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
+		var err error
+		ethServ, err = eth.New(ctx, ethConf)
+		return ethServ, err
+	}); err != nil {
+		t.Fatalf("failed to register GoChain service: %v", err)
+	}
+	if err := stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
+		return New(ethServ.ApiBackend, ethConf.Logs)
+	}); err != nil {
+		t.Fatalf("failed to register GraphQL service: %v", err)
+	}
+	if err := stack.Start(); err != nil {
+		t.Fatalf("failed to start node: %v", err)
+	}
+	return stack
+}
+
+// query posts a GraphQL query, returning the raw response.
+func query(t *testing.T, port int, q string) string {
+	t.Helper()
+	return queryWithKey(t, port, q, "")
+}
+
+// queryWithKey posts a GraphQL query authenticated with an API key, returning
+// the raw response.
+func queryWithKey(t *testing.T, port int, q string, key string) string {
+	t.Helper()
+	body, _ := json.Marshal(map[string]string{"query": q})
+	req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("http://127.0.0.1:%d/graphql", port), strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set("X-API-Key", key)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	defer resp.Body.Close()
+	res, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read response: %v", err)
+	}
+	return string(res)
+}
+
+func TestGraphQLService(t *testing.T) {
+	var (
+		port   = 9393
+		faucet = common.HexToAddress("0x00000000000000000000000000000000000fa0ce")
+		stack  = newTestStack(t, testNodeConfig(port), faucet)
+	)
+	defer stack.Stop()
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{
+			query: `{ block { number signers voters signer } }`,
+			want:  `{"data":{"block":{"number":0,"signers":["0x00000000000000000000000000000000000fa0ce"],"voters":["0x00000000000000000000000000000000000fa0ce"],"signer":null}}}`,
+		},
+		{
+			query: `{ block(number: 0) { account(address: "0x00000000000000000000000000000000000fa0ce") { balance transactionCount } } }`,
+			want:  `{"data":{"block":{"account":{"balance":"0x33b2e3c9fd0803ce8000000","transactionCount":0}}}}`,
+		},
+		{
+			query: `{ block(number: 1) { number } }`,
+			want:  `{"data":{"block":null}}`,
+		},
+		{
+			query: `{ transaction(hash: "0x0000000000000000000000000000000000000000000000000000000000000001") { hash } }`,
+			want:  `{"data":{"transaction":null}}`,
+		},
+		{
+			query: `{ blocks(from: 0) { number parent { number } } }`,
+			want:  `{"data":{"blocks":[{"number":0,"parent":null}]}}`,
+		},
+		{
+			query: `{ logs(filter: {fromBlock: 0, toBlock: 0}) { index } }`,
+			want:  `{"data":{"logs":[]}}`,
+		},
+	}
+	for i, tt := range tests {
+		if have := query(t, port, tt.query); have != tt.want {
+			t.Errorf("test %d: response mismatch\nhave %s\nwant %s", i, have, tt.want)
+		}
+	}
+	// The explorer is served next to the queries
+	resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/graphql/ui", port))
+	if err != nil {
+		t.Fatalf("explorer request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("explorer status mismatch: have %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+}
+
+// Tests that GraphQL operations are only answered if the caller may invoke the
+// equivalent RPC methods and the endpoint exposes their module.
+func TestGraphQLAuthorization(t *testing.T) {
+	var (
+		port   = 9394
+		faucet = common.HexToAddress("0x00000000000000000000000000000000000fa0ce")
+		conf   = testNodeConfig(port)
+	)
+	conf.RPCAuth = node.RPCAuthConfig{APIKeys: map[string][]string{
+		"reader": {"eth_getBlockByNumber"},
+		"full":   {"eth"},
+	}}
+	stack := newTestStack(t, conf, faucet)
+	defer stack.Stop()
+
+	tests := []struct {
+		key   string
+		query string
+		want  string
+	}{
+		{"reader", `{ block { number } }`, `{"data":{"block":{"number":0}}}`},
+		{"reader", `{ block { call(data: {to: "0x00000000000000000000000000000000000fa0ce"}) { status } } }`, "may not call eth_call"},
+		{"reader", `{ gasPrice }`, "may not call eth_gasPrice"},
+		{"reader", `mutation { sendRawTransaction(data: "0x00") }`, "may not call eth_sendRawTransaction"},
+		{"full", `{ block { call(data: {to: "0x00000000000000000000000000000000000fa0ce"}) { status } } }`, `{"data":{"block":{"call":{"status":1}}}}`},
+	}
+	for i, tt := range tests {
+		if have := queryWithKey(t, port, tt.query, tt.key); !strings.Contains(have, tt.want) {
+			t.Errorf("test %d: response %s does not contain %s", i, have, tt.want)
+		}
+	}
+	// Endpoints not exposing the eth module don't answer the queries either.
+	conf = testNodeConfig(port + 1)
+	conf.HTTPModules = []string{"net"}
+	stack = newTestStack(t, conf, faucet)
+	defer stack.Stop()
+
+	if have := query(t, port+1, `{ block { number } }`); !strings.Contains(have, "module eth not exposed") {
+		t.Errorf("response %s does not report the unexposed module", have)
+	}
+}
+
+func TestBlockSigner(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	header := &types.Header{
+		Number:     big.NewInt(1),
+		Difficulty: big.NewInt(1),
+		Time:       big.NewInt(1),
+		Extra:      make([]byte, 32),
+	}
+	sig, err := crypto.Sign(clique.SealHash(header).Bytes(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header.Signer = sig
+
+	signer, err := newBlock(nil, header).Signer(context.Background())
+	if err != nil {
+		t.Fatalf("failed to recover signer: %v", err)
+	}
+	if want := crypto.PubkeyToAddress(key.PublicKey); signer == nil || *signer != want {
+		t.Errorf("signer mismatch: have %v, want %x", signer, want)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package graphql
+
+import (
+	"net/http"
+
+	graphqlgo "github.com/graph-gophers/graphql-go"
+	"github.com/graph-gophers/graphql-go/relay"
+
+	"github.com/zeus-fyi/gochain/v4/eth/filters"
+	"github.com/zeus-fyi/gochain/v4/p2p"
+	"github.com/zeus-fyi/gochain/v4/rpc"
+)
+
+// Service encapsulates a GraphQL service, served on the HTTP RPC endpoint of
+// the node under /graphql, with a GraphiQL explorer under /graphql/ui.
+type Service struct {
+	handler http.Handler // The handler answering the queries
+}
+
+// New constructs a new GraphQL service answering queries from the backend, the
+// log queries being bounded like those of the RPC API.
+func New(backend Backend, logs filters.Config) (*Service, error) {
+	s, err := graphqlgo.ParseSchema(schema, &Resolver{backend: backend, logs: logs})
+	if err != nil {
+		return nil, err
+	}
+	return &Service{handler: &relay.Handler{Schema: s}}, nil
+}
+
+// Protocols returns the list of protocols exported by this service.
+func (s *Service) Protocols() []p2p.Protocol { return nil }
+
+// APIs returns the list of APIs exported by this service.
+func (s *Service) APIs() []rpc.API { return nil }
+
+// HTTPHandlers returns the handlers of the queries and of the explorer.
+func (s *Service) HTTPHandlers() map[string]http.Handler {
+	return map[string]http.Handler{
+		"/graphql":    s.handler,
+		"/graphql/ui": GraphiQL{},
+	}
+}
+
+// Start is called after all services have been constructed and the networking
+// layer was also initialized to spawn any goroutines required by the service.
+func (s *Service) Start(server *p2p.Server) error { return nil }
+
+// Stop terminates all goroutines belonging to this service, blocking until they
+// are all terminated.
+func (s *Service) Stop() error { return nil }
@@ -31,6 +31,7 @@ import (
 	"github.com/zeus-fyi/gochain/v4/log/term"
 	"github.com/zeus-fyi/gochain/v4/metrics"
 	"github.com/zeus-fyi/gochain/v4/metrics/exp"
+	"github.com/zeus-fyi/gochain/v4/metrics/prometheus"
 )
 
 var Memsize memsizeui.Handler
@@ -69,6 +70,10 @@ var (
 		Usage: "pprof HTTP server listening interface",
 		Value: "127.0.0.1",
 	}
+	prometheusFlag = cli.BoolFlag{
+		Name:  "metrics.prometheus",
+		Usage: "Serve metrics in the Prometheus text format at " + prometheus.Path + " on the pprof HTTP server",
+	}
 	memprofilerateFlag = cli.IntFlag{
 		Name:  "memprofilerate",
 		Usage: "Turn on memory profiling with the given rate",
@@ -99,7 +104,7 @@ var (
 // Flags holds all command-line flags required for debugging.
 var Flags = []cli.Flag{
 	verbosityFlag, vmoduleFlag, backtraceAtFlag, debugFlag,
-	pprofFlag, pprofAddrFlag, pprofPortFlag,
+	pprofFlag, pprofAddrFlag, pprofPortFlag, prometheusFlag,
 	memprofilerateFlag, cpuprofileFlag, traceFlag,
 	blockprofilerateFlag, mutexProfileFractionFlag,
 	stackdriverLogging,
@@ -148,6 +153,9 @@ func Setup(ctx *cli.Context) error {
 		runtime.SetBlockProfileRate(ctx.GlobalInt(blockprofilerateFlag.Name))
 		runtime.SetMutexProfileFraction(ctx.GlobalInt(mutexProfileFractionFlag.Name))
 
+		if ctx.GlobalBool(prometheusFlag.Name) {
+			http.Handle(prometheus.Path, prometheus.Handler(metrics.DefaultRegistry))
+		}
 		address := fmt.Sprintf("%s:%d", ctx.GlobalString(pprofAddrFlag.Name), ctx.GlobalInt(pprofPortFlag.Name))
 		StartPProf(address)
 	}
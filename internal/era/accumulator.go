@@ -0,0 +1,72 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package era
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/big"
+
+	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/crypto"
+)
+
+// accumulatorDepth is the depth of the accumulator tree, which has a leaf for
+// each of the MaxSize blocks of an archive.
+const accumulatorDepth = 13
+
+// ComputeAccumulator returns the accumulator root committing to the hashes and
+// total difficulties of the blocks of an archive.
+//
+// Each leaf is keccak256(hash || td), with td as a 32 byte big endian integer.
+// The leaves are merkleized into a binary keccak256 tree of MaxSize leaves,
+// padded with zero hashes, and the tree root is hashed together with the
+// number of blocks as a 32 byte big endian integer.
+func ComputeAccumulator(hashes []common.Hash, tds []*big.Int) (common.Hash, error) {
+	if len(hashes) != len(tds) {
+		return common.Hash{}, fmt.Errorf("accumulator: %d hashes but %d total difficulties", len(hashes), len(tds))
+	}
+	if len(hashes) > MaxSize {
+		return common.Hash{}, fmt.Errorf("accumulator: too many blocks (%d > %d)", len(hashes), MaxSize)
+	}
+	level := make([]common.Hash, len(hashes))
+	for i, hash := range hashes {
+		if tds[i].Sign() < 0 || tds[i].BitLen() > 256 {
+			return common.Hash{}, fmt.Errorf("accumulator: invalid total difficulty %v", tds[i])
+		}
+		level[i] = crypto.Keccak256Hash(hash[:], common.LeftPadBytes(tds[i].Bytes(), 32))
+	}
+	var zero common.Hash // Root of an empty subtree at the current depth
+	for depth := 0; depth < accumulatorDepth; depth++ {
+		next := make([]common.Hash, (len(level)+1)/2)
+		for i := range next {
+			right := zero
+			if 2*i+1 < len(level) {
+				right = level[2*i+1]
+			}
+			next[i] = crypto.Keccak256Hash(level[2*i][:], right[:])
+		}
+		level, zero = next, crypto.Keccak256Hash(zero[:], zero[:])
+	}
+	root := zero
+	if len(level) > 0 {
+		root = level[0]
+	}
+	var length [32]byte
+	binary.BigEndian.PutUint64(length[24:], uint64(len(hashes)))
+	return crypto.Keccak256Hash(root[:], length[:]), nil
+}
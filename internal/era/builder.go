@@ -0,0 +1,169 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package era
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/golang/snappy"
+	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/core/types"
+	"github.com/zeus-fyi/gochain/v4/rlp"
+)
+
+// Builder writes an archive of consecutive blocks to an underlying writer.
+// Blocks are added in ascending order and the archive is completed by
+// Finalize, which appends the accumulator and block index.
+type Builder struct {
+	w       entryWriter
+	written int64
+
+	start   uint64
+	parent  common.Hash
+	hashes  []common.Hash
+	tds     []*big.Int
+	offsets []int64
+
+	finalized bool
+}
+
+// NewBuilder creates a builder writing to w.
+func NewBuilder(w io.Writer) *Builder {
+	return &Builder{w: entryWriter{w: w}}
+}
+
+// Add appends a block with its receipts and total difficulty to the archive.
+func (b *Builder) Add(block *types.Block, receipts types.Receipts, td *big.Int) error {
+	if b.finalized {
+		return errors.New("era: archive already finalized")
+	}
+	if len(b.hashes) == MaxSize {
+		return fmt.Errorf("era: archive is full (%d blocks)", MaxSize)
+	}
+	if td.Sign() < 0 || td.BitLen() > 256 {
+		return fmt.Errorf("era: invalid total difficulty %v", td)
+	}
+	if len(b.hashes) == 0 {
+		b.start = block.NumberU64()
+		if _, err := b.write(TypeVersion, nil); err != nil {
+			return err
+		}
+	} else {
+		if want := b.start + uint64(len(b.hashes)); block.NumberU64() != want {
+			return fmt.Errorf("era: non contiguous block #%d, want #%d", block.NumberU64(), want)
+		}
+		if block.ParentHash() != b.parent {
+			return fmt.Errorf("era: block #%d [%x…] does not extend [%x…]", block.NumberU64(), block.Hash().Bytes()[:4], b.parent.Bytes()[:4])
+		}
+	}
+	header, err := rlp.EncodeToBytes(block.Header())
+	if err != nil {
+		return err
+	}
+	body, err := rlp.EncodeToBytes(block.Body())
+	if err != nil {
+		return err
+	}
+	receiptsRLP, err := rlp.EncodeToBytes(receipts)
+	if err != nil {
+		return err
+	}
+	offset := b.written
+	if _, err := b.write(TypeHeader, snappy.Encode(nil, header)); err != nil {
+		return err
+	}
+	if _, err := b.write(TypeBody, snappy.Encode(nil, body)); err != nil {
+		return err
+	}
+	if _, err := b.write(TypeReceipts, snappy.Encode(nil, receiptsRLP)); err != nil {
+		return err
+	}
+	if _, err := b.write(TypeTotalDifficulty, encodeTD(td)); err != nil {
+		return err
+	}
+	b.parent = block.Hash()
+	b.hashes = append(b.hashes, b.parent)
+	b.tds = append(b.tds, new(big.Int).Set(td))
+	b.offsets = append(b.offsets, offset)
+	return nil
+}
+
+// Finalize writes the accumulator and block index of the added blocks,
+// returning the accumulator root.
+func (b *Builder) Finalize() (common.Hash, error) {
+	if b.finalized {
+		return common.Hash{}, errors.New("era: archive already finalized")
+	}
+	if len(b.hashes) == 0 {
+		return common.Hash{}, errors.New("era: empty archive")
+	}
+	root, err := ComputeAccumulator(b.hashes, b.tds)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if _, err := b.write(TypeAccumulator, root[:]); err != nil {
+		return common.Hash{}, err
+	}
+	// The index offsets are relative to the index record, whose position is
+	// only known now that every preceding record has been written.
+	var (
+		count = len(b.offsets)
+		index = make([]byte, 8+8*count+8)
+	)
+	binary.LittleEndian.PutUint64(index, b.start)
+	for i, offset := range b.offsets {
+		binary.LittleEndian.PutUint64(index[8+8*i:], uint64(offset-b.written))
+	}
+	binary.LittleEndian.PutUint64(index[8+8*count:], uint64(count))
+	if _, err := b.write(TypeBlockIndex, index); err != nil {
+		return common.Hash{}, err
+	}
+	b.finalized = true
+	return root, nil
+}
+
+// write appends a record and tracks the number of bytes written so far.
+func (b *Builder) write(typ uint16, value []byte) (int, error) {
+	n, err := b.w.Write(typ, value)
+	b.written += int64(n)
+	return n, err
+}
+
+// encodeTD encodes a total difficulty as a 32 byte little endian integer.
+func encodeTD(td *big.Int) []byte {
+	enc := common.LeftPadBytes(td.Bytes(), 32)
+	for i, j := 0, len(enc)-1; i < j; i, j = i+1, j-1 {
+		enc[i], enc[j] = enc[j], enc[i]
+	}
+	return enc
+}
+
+// decodeTD decodes a 32 byte little endian total difficulty.
+func decodeTD(enc []byte) (*big.Int, error) {
+	if len(enc) != 32 {
+		return nil, fmt.Errorf("era: invalid total difficulty length %d", len(enc))
+	}
+	be := make([]byte, len(enc))
+	for i := range enc {
+		be[len(enc)-1-i] = enc[i]
+	}
+	return new(big.Int).SetBytes(be), nil
+}
@@ -0,0 +1,101 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package era
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// headerSize is the size of an e2store record header: a little endian uint16
+// type, a little endian uint32 value length and two reserved zero bytes.
+const headerSize = 8
+
+// Entry is a single typed record of an e2store file.
+type Entry struct {
+	Type  uint16
+	Value []byte
+}
+
+// entryWriter appends e2store records to an underlying writer.
+type entryWriter struct {
+	w io.Writer
+}
+
+// Write appends a record of the given type, returning the number of bytes
+// written including the record header.
+func (w *entryWriter) Write(typ uint16, value []byte) (int, error) {
+	if uint64(len(value)) > uint64(^uint32(0)) {
+		return 0, fmt.Errorf("e2store: record too large (%d bytes)", len(value))
+	}
+	var header [headerSize]byte
+	binary.LittleEndian.PutUint16(header[0:], typ)
+	binary.LittleEndian.PutUint32(header[2:], uint32(len(value)))
+	if n, err := w.w.Write(header[:]); err != nil {
+		return n, err
+	}
+	n, err := w.w.Write(value)
+	return headerSize + n, err
+}
+
+// entryReader reads e2store records at arbitrary offsets.
+type entryReader struct {
+	r io.ReaderAt
+}
+
+// readHeader reads the type and value length of the record at off.
+func (r *entryReader) readHeader(off int64) (uint16, uint32, error) {
+	var header [headerSize]byte
+	if _, err := r.r.ReadAt(header[:], off); err != nil {
+		return 0, 0, err
+	}
+	if header[6] != 0 || header[7] != 0 {
+		return 0, 0, errors.New("e2store: reserved bytes are non-zero")
+	}
+	return binary.LittleEndian.Uint16(header[0:]), binary.LittleEndian.Uint32(header[2:]), nil
+}
+
+// ReadAt reads the record at off, returning it with its total size including
+// the record header.
+func (r *entryReader) ReadAt(off int64) (*Entry, int64, error) {
+	typ, length, err := r.readHeader(off)
+	if err != nil {
+		return nil, 0, err
+	}
+	entry := &Entry{Type: typ, Value: make([]byte, length)}
+	if _, err := r.r.ReadAt(entry.Value, off+headerSize); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, 0, err
+	}
+	return entry, headerSize + int64(length), nil
+}
+
+// ReadTypeAt reads the record at off and checks that it has the wanted type.
+func (r *entryReader) ReadTypeAt(off int64, typ uint16) ([]byte, int64, error) {
+	entry, n, err := r.ReadAt(off)
+	if err != nil {
+		return nil, 0, err
+	}
+	if entry.Type != typ {
+		return nil, 0, fmt.Errorf("e2store: record at offset %d has type %#04x, want %#04x", off, entry.Type, typ)
+	}
+	return entry.Value, n, nil
+}
@@ -0,0 +1,88 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package era implements flat history archive files holding the headers,
+// bodies, receipts and total difficulties of up to MaxSize consecutive blocks.
+//
+// An archive is an e2store file, a sequence of typed records:
+//
+//	Version | (Header | Body | Receipts | TotalDifficulty)* | Accumulator | BlockIndex
+//
+// Headers, bodies and receipts are snappy compressed RLP, total difficulties
+// are 32 byte little endian integers. The trailing block index holds the
+// number of the first block, the offset of each block's header record relative
+// to the start of the index record and the block count, which allows random
+// access to any block by reading from the end of the file.
+package era
+
+import (
+	"fmt"
+	"math/big"
+	"path/filepath"
+	"sort"
+
+	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/params"
+)
+
+// Record types of an archive file.
+const (
+	TypeVersion         uint16 = 0x3265
+	TypeHeader          uint16 = 0x03
+	TypeBody            uint16 = 0x04
+	TypeReceipts        uint16 = 0x05
+	TypeTotalDifficulty uint16 = 0x06
+	TypeAccumulator     uint16 = 0x07
+	TypeBlockIndex      uint16 = 0x3266
+)
+
+// MaxSize is the maximum number of blocks in a single archive. Archives of a
+// directory start at multiples of MaxSize, so block n lives in epoch n/MaxSize.
+const MaxSize = 8192
+
+// Extension is the filename extension of archive files.
+const Extension = ".era1"
+
+// Filename returns the canonical name of an archive of the given network and
+// epoch, which embeds the first four bytes of its accumulator root.
+func Filename(network string, epoch uint64, root common.Hash) string {
+	return fmt.Sprintf("%s-%05d-%x%s", network, epoch, root[:4], Extension)
+}
+
+// NetworkName returns the network name archive filenames of a chain start
+// with.
+func NetworkName(chainID *big.Int) string {
+	switch {
+	case chainID == nil:
+		return "unknown"
+	case chainID.Cmp(big.NewInt(params.MainnetChainID)) == 0:
+		return "mainnet"
+	case chainID.Cmp(big.NewInt(params.TestnetChainID)) == 0:
+		return "testnet"
+	default:
+		return fmt.Sprintf("chain%v", chainID)
+	}
+}
+
+// ReadDir returns the archive files in dir in lexical, and thus epoch, order.
+func ReadDir(dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*"+Extension))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
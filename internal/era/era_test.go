@@ -0,0 +1,190 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package era
+
+import (
+	"bytes"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/consensus/clique"
+	"github.com/zeus-fyi/gochain/v4/core"
+	"github.com/zeus-fyi/gochain/v4/core/types"
+	"github.com/zeus-fyi/gochain/v4/core/vm"
+	"github.com/zeus-fyi/gochain/v4/crypto"
+	"github.com/zeus-fyi/gochain/v4/ethdb"
+	"github.com/zeus-fyi/gochain/v4/params"
+	"github.com/zeus-fyi/gochain/v4/rlp"
+)
+
+// newTestChain creates a chain of n blocks with a transfer in each.
+func newTestChain(t *testing.T, n int) *core.BlockChain {
+	var (
+		key, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr   = crypto.PubkeyToAddress(key.PublicKey)
+		db     = ethdb.NewMemDatabase()
+		gspec  = &core.Genesis{
+			Config:   params.TestChainConfig,
+			GasLimit: 3141592,
+			Alloc:    core.GenesisAlloc{addr: {Balance: big.NewInt(1000000000)}},
+		}
+		genesis = gspec.MustCommit(db)
+		engine  = clique.NewFaker()
+		signer  = types.NewEIP155Signer(gspec.Config.ChainId)
+	)
+	blocks, _ := core.GenerateChain(gspec.Config, genesis, engine, db, n, func(i int, gen *core.BlockGen) {
+		tx, _ := types.SignTx(types.NewTransaction(gen.TxNonce(addr), common.Address{byte(i + 1)}, big.NewInt(1), params.TxGas, nil, nil), signer, key)
+		gen.AddTx(tx)
+	})
+	diskdb := ethdb.NewMemDatabase()
+	gspec.MustCommit(diskdb)
+	chain, err := core.NewBlockChain(diskdb, nil, gspec.Config, engine, vm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	return chain
+}
+
+// Tests that exported archives give random access to the blocks, receipts and
+// total difficulties of the chain and pass verification.
+func TestExportRoundtrip(t *testing.T) {
+	chain := newTestChain(t, 16)
+	defer chain.Stop()
+
+	dir, err := os.MkdirTemp("", "era-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	paths, err := Export(chain, dir, "test", 0, 16)
+	if err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+	if len(paths) != 1 {
+		t.Fatalf("exported %d files, want 1", len(paths))
+	}
+	sums, err := ReadChecksums(dir)
+	if err != nil {
+		t.Fatalf("failed to read checksums: %v", err)
+	}
+	if err := VerifyChecksum(paths[0], sums); err != nil {
+		t.Fatalf("checksum verification failed: %v", err)
+	}
+	archive, err := Open(paths[0])
+	if err != nil {
+		t.Fatalf("failed to open archive: %v", err)
+	}
+	defer archive.Close()
+
+	if archive.Start() != 0 || archive.Count() != 17 {
+		t.Fatalf("archive range mismatch: have start %d count %d, want 0 and 17", archive.Start(), archive.Count())
+	}
+	root, err := archive.Verify()
+	if err != nil {
+		t.Fatalf("verification failed: %v", err)
+	}
+	if want := Filename("test", 0, root); filepath.Base(paths[0]) != want {
+		t.Errorf("filename mismatch: have %s, want %s", filepath.Base(paths[0]), want)
+	}
+	// Read the blocks back in reverse to exercise the index.
+	for nr := uint64(16); ; nr-- {
+		block, receipts, td, err := archive.GetBlockWithReceipts(nr)
+		if err != nil {
+			t.Fatalf("block %d: failed to read: %v", nr, err)
+		}
+		want := chain.GetBlockByNumber(nr)
+		if block.Hash() != want.Hash() {
+			t.Errorf("block %d: hash mismatch: have %x, want %x", nr, block.Hash(), want.Hash())
+		}
+		if td.Cmp(chain.GetTd(want.Hash(), nr)) != 0 {
+			t.Errorf("block %d: td mismatch: have %v, want %v", nr, td, chain.GetTd(want.Hash(), nr))
+		}
+		have, _ := rlp.EncodeToBytes(receipts)
+		exp, _ := rlp.EncodeToBytes(chain.GetReceiptsByHash(want.Hash()))
+		if !bytes.Equal(have, exp) {
+			t.Errorf("block %d: receipts mismatch", nr)
+		}
+		if nr == 0 {
+			break
+		}
+	}
+	if _, err := archive.GetBlockByNumber(17); err == nil {
+		t.Errorf("read block beyond archive")
+	}
+}
+
+// Tests that corrupted archives are rejected.
+func TestCorruptArchive(t *testing.T) {
+	chain := newTestChain(t, 4)
+	defer chain.Stop()
+
+	dir, err := os.MkdirTemp("", "era-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Rebuild the archive with a wrong total difficulty in the last block.
+	var buf bytes.Buffer
+	builder := NewBuilder(&buf)
+	for nr := uint64(0); nr <= 4; nr++ {
+		block := chain.GetBlockByNumber(nr)
+		td := chain.GetTd(block.Hash(), nr)
+		if nr == 4 {
+			td = new(big.Int).Add(td, common.Big1)
+		}
+		if err := builder.Add(block, chain.GetReceiptsByHash(block.Hash()), td); err != nil {
+			t.Fatalf("block %d: failed to add: %v", nr, err)
+		}
+	}
+	if _, err := builder.Finalize(); err != nil {
+		t.Fatalf("failed to finalize: %v", err)
+	}
+	path := filepath.Join(dir, "bad"+Extension)
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	archive, err := Open(path)
+	if err != nil {
+		t.Fatalf("failed to open archive: %v", err)
+	}
+	if _, err := archive.Verify(); err == nil {
+		t.Errorf("archive with wrong total difficulty verified")
+	}
+	archive.Close()
+
+	// Blocks out of order must not be accepted by the builder.
+	builder = NewBuilder(new(bytes.Buffer))
+	if err := builder.Add(chain.GetBlockByNumber(1), nil, common.Big1); err != nil {
+		t.Fatalf("failed to add first block: %v", err)
+	}
+	if err := builder.Add(chain.GetBlockByNumber(3), nil, common.Big1); err == nil {
+		t.Errorf("non contiguous block accepted")
+	}
+	// A file with a mismatching checksum must be rejected.
+	sums := map[string]string{filepath.Base(path): "00"}
+	if err := VerifyChecksum(path, sums); err == nil {
+		t.Errorf("checksum mismatch accepted")
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package era
+
+import (
+	"bufio"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/core/types"
+	"github.com/zeus-fyi/gochain/v4/log"
+)
+
+// Chain is the block source archives are exported from.
+type Chain interface {
+	GetBlockByNumber(number uint64) *types.Block
+	GetReceiptsByHash(hash common.Hash) types.Receipts
+	GetTd(hash common.Hash, number uint64) *big.Int
+}
+
+// Export writes the canonical blocks first to last into archives in dir, one
+// per epoch touched by the range, and records their digests in the checksums
+// file of dir. The paths of the written archives are returned.
+func Export(chain Chain, dir, network string, first, last uint64) ([]string, error) {
+	if first > last {
+		return nil, fmt.Errorf("export failed: first (%d) is greater than last (%d)", first, last)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	sums, err := ReadChecksums(dir)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		paths []string
+		start = time.Now()
+	)
+	for from := first; from <= last; {
+		epoch := from / MaxSize
+		to := (epoch+1)*MaxSize - 1
+		if to > last {
+			to = last
+		}
+		path, err := exportEpoch(chain, dir, network, epoch, from, to)
+		if err != nil {
+			return paths, err
+		}
+		sum, err := Checksum(path)
+		if err != nil {
+			return paths, err
+		}
+		sums[filepath.Base(path)] = sum
+		paths = append(paths, path)
+		log.Info("Exported history archive", "file", filepath.Base(path), "first", from, "last", to, "elapsed", common.PrettyDuration(time.Since(start)))
+
+		if to == last {
+			break
+		}
+		from = to + 1
+	}
+	return paths, WriteChecksums(dir, sums)
+}
+
+// exportEpoch writes blocks from to to of an epoch into a temporary file and
+// renames it after its accumulator root once complete.
+func exportEpoch(chain Chain, dir, network string, epoch, from, to uint64) (string, error) {
+	f, err := os.CreateTemp(dir, fmt.Sprintf("%s-%05d-*.tmp", network, epoch))
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	var (
+		w       = bufio.NewWriter(f)
+		builder = NewBuilder(w)
+	)
+	for nr := from; nr <= to; nr++ {
+		block := chain.GetBlockByNumber(nr)
+		if block == nil {
+			return "", fmt.Errorf("export failed on #%d: not found", nr)
+		}
+		receipts := chain.GetReceiptsByHash(block.Hash())
+		if receipts == nil && len(block.Transactions()) > 0 {
+			return "", fmt.Errorf("export failed on #%d: receipts not found", nr)
+		}
+		td := chain.GetTd(block.Hash(), nr)
+		if td == nil {
+			return "", fmt.Errorf("export failed on #%d: total difficulty not found", nr)
+		}
+		if err := builder.Add(block, receipts, td); err != nil {
+			return "", err
+		}
+	}
+	root, err := builder.Finalize()
+	if err != nil {
+		return "", err
+	}
+	if err := w.Flush(); err != nil {
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, Filename(network, epoch, root))
+	if err := os.Rename(f.Name(), path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
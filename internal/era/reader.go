@@ -0,0 +1,248 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package era
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+
+	"github.com/golang/snappy"
+	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/core/types"
+	"github.com/zeus-fyi/gochain/v4/rlp"
+)
+
+// ReadAtSeekCloser is the file interface an archive is read through.
+type ReadAtSeekCloser interface {
+	io.ReaderAt
+	io.Seeker
+	io.Closer
+}
+
+// Era is an open archive file supporting random access to its blocks.
+type Era struct {
+	f       ReadAtSeekCloser
+	r       entryReader
+	start   uint64
+	offsets []int64 // Absolute offsets of each block's header record
+	index   int64   // Absolute offset of the block index record
+}
+
+// Open opens the archive file at path.
+func Open(path string) (*Era, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	e, err := From(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return e, nil
+}
+
+// From reads the block index of an archive from f. The returned archive takes
+// ownership of f and closes it on Close.
+func From(f ReadAtSeekCloser) (*Era, error) {
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	e := &Era{f: f, r: entryReader{r: f}}
+	if version, _, err := e.r.ReadTypeAt(0, TypeVersion); err != nil {
+		return nil, err
+	} else if len(version) != 0 {
+		return nil, fmt.Errorf("era: unsupported version record of %d bytes", len(version))
+	}
+	// The block count is the trailing field of the index, which locates the
+	// rest of the index record.
+	var buf [8]byte
+	if size < headerSize+3*8 {
+		return nil, fmt.Errorf("era: file too short (%d bytes)", size)
+	}
+	if _, err := f.ReadAt(buf[:], size-8); err != nil {
+		return nil, err
+	}
+	count := binary.LittleEndian.Uint64(buf[:])
+	if count == 0 || count > MaxSize {
+		return nil, fmt.Errorf("era: invalid block count %d", count)
+	}
+	e.index = size - headerSize - int64(8+8*count+8)
+	if e.index < headerSize {
+		return nil, fmt.Errorf("era: block index of %d blocks exceeds file size", count)
+	}
+	index, _, err := e.r.ReadTypeAt(e.index, TypeBlockIndex)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(index)) != 8+8*count+8 {
+		return nil, fmt.Errorf("era: block index length %d, want %d", len(index), 8+8*count+8)
+	}
+	e.start = binary.LittleEndian.Uint64(index)
+	e.offsets = make([]int64, count)
+	for i := range e.offsets {
+		e.offsets[i] = e.index + int64(binary.LittleEndian.Uint64(index[8+8*i:]))
+		if e.offsets[i] < headerSize || e.offsets[i] >= e.index {
+			return nil, fmt.Errorf("era: block #%d offset %d out of range", e.start+uint64(i), e.offsets[i])
+		}
+	}
+	return e, nil
+}
+
+// Close closes the underlying file.
+func (e *Era) Close() error {
+	return e.f.Close()
+}
+
+// Start returns the number of the first block in the archive.
+func (e *Era) Start() uint64 {
+	return e.start
+}
+
+// Count returns the number of blocks in the archive.
+func (e *Era) Count() uint64 {
+	return uint64(len(e.offsets))
+}
+
+// Accumulator returns the accumulator root stored in the archive.
+func (e *Era) Accumulator() (common.Hash, error) {
+	// The accumulator record immediately precedes the index.
+	off := e.index - headerSize - common.HashLength
+	value, _, err := e.r.ReadTypeAt(off, TypeAccumulator)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if len(value) != common.HashLength {
+		return common.Hash{}, fmt.Errorf("era: invalid accumulator length %d", len(value))
+	}
+	return common.BytesToHash(value), nil
+}
+
+// GetBlockByNumber returns the block with the given number.
+func (e *Era) GetBlockByNumber(number uint64) (*types.Block, error) {
+	block, _, _, err := e.getBlock(number, false)
+	return block, err
+}
+
+// GetBlockWithReceipts returns the block with the given number along with its
+// receipts and total difficulty. Only the consensus fields of the receipts are
+// set, the rest must be derived from the block.
+func (e *Era) GetBlockWithReceipts(number uint64) (*types.Block, types.Receipts, *big.Int, error) {
+	return e.getBlock(number, true)
+}
+
+// GetHeaderByNumber returns the header of the block with the given number.
+func (e *Era) GetHeaderByNumber(number uint64) (*types.Header, error) {
+	off, err := e.offset(number)
+	if err != nil {
+		return nil, err
+	}
+	header := new(types.Header)
+	if _, err := e.readRecord(off, TypeHeader, header); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+// GetTD returns the total difficulty of the block with the given number.
+func (e *Era) GetTD(number uint64) (*big.Int, error) {
+	off, err := e.offset(number)
+	if err != nil {
+		return nil, err
+	}
+	// Skip the header, body and receipts records.
+	for _, typ := range []uint16{TypeHeader, TypeBody, TypeReceipts} {
+		_, n, err := e.r.ReadTypeAt(off, typ)
+		if err != nil {
+			return nil, err
+		}
+		off += n
+	}
+	value, _, err := e.r.ReadTypeAt(off, TypeTotalDifficulty)
+	if err != nil {
+		return nil, err
+	}
+	return decodeTD(value)
+}
+
+// getBlock reads the records of a block, optionally with receipts and TD.
+func (e *Era) getBlock(number uint64, full bool) (*types.Block, types.Receipts, *big.Int, error) {
+	off, err := e.offset(number)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var (
+		header = new(types.Header)
+		body   = new(types.Body)
+	)
+	n, err := e.readRecord(off, TypeHeader, header)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	off += n
+	if n, err = e.readRecord(off, TypeBody, body); err != nil {
+		return nil, nil, nil, err
+	}
+	off += n
+	block := types.NewBlockWithHeader(header).WithBody(body.Transactions, body.Uncles)
+	if !full {
+		return block, nil, nil, nil
+	}
+	var receipts types.Receipts
+	if n, err = e.readRecord(off, TypeReceipts, &receipts); err != nil {
+		return nil, nil, nil, err
+	}
+	off += n
+	value, _, err := e.r.ReadTypeAt(off, TypeTotalDifficulty)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	td, err := decodeTD(value)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return block, receipts, td, nil
+}
+
+// offset returns the position of the header record of a block.
+func (e *Era) offset(number uint64) (int64, error) {
+	if number < e.start || number-e.start >= uint64(len(e.offsets)) {
+		return 0, fmt.Errorf("era: block #%d not in archive [%d, %d]", number, e.start, e.start+uint64(len(e.offsets))-1)
+	}
+	return e.offsets[number-e.start], nil
+}
+
+// readRecord reads a snappy compressed RLP record of the given type into val,
+// returning the size of the record.
+func (e *Era) readRecord(off int64, typ uint16, val interface{}) (int64, error) {
+	value, n, err := e.r.ReadTypeAt(off, typ)
+	if err != nil {
+		return 0, err
+	}
+	blob, err := snappy.Decode(nil, value)
+	if err != nil {
+		return 0, fmt.Errorf("era: record at offset %d: %v", off, err)
+	}
+	if err := rlp.DecodeBytes(blob, val); err != nil {
+		return 0, fmt.Errorf("era: record at offset %d: %v", off, err)
+	}
+	return n, nil
+}
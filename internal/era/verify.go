@@ -0,0 +1,166 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package era
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/core/types"
+)
+
+// ChecksumsFile is the name of the file listing the sha256 digest of every
+// archive in a directory, in the format of sha256sum.
+const ChecksumsFile = "checksums.txt"
+
+// Verify checks that the blocks of the archive are linked, that their bodies
+// and receipts match the roots in their headers, that their total
+// difficulties accumulate their difficulties and that the stored accumulator
+// commits to them. The accumulator root is returned.
+func (e *Era) Verify() (common.Hash, error) {
+	var (
+		hashes = make([]common.Hash, 0, e.Count())
+		tds    = make([]*big.Int, 0, e.Count())
+		parent *types.Block
+		prevTD *big.Int
+	)
+	for number := e.start; number < e.start+e.Count(); number++ {
+		block, receipts, td, err := e.GetBlockWithReceipts(number)
+		if err != nil {
+			return common.Hash{}, err
+		}
+		if block.NumberU64() != number {
+			return common.Hash{}, fmt.Errorf("era: block #%d stored at position of #%d", block.NumberU64(), number)
+		}
+		if parent != nil && block.ParentHash() != parent.Hash() {
+			return common.Hash{}, fmt.Errorf("era: block #%d [%x…] does not extend [%x…]", number, block.Hash().Bytes()[:4], parent.Hash().Bytes()[:4])
+		}
+		if hash := types.DeriveSha(block.Transactions()); hash != block.TxHash() {
+			return common.Hash{}, fmt.Errorf("era: block #%d transaction root mismatch: have %x, want %x", number, hash, block.TxHash())
+		}
+		if hash := types.CalcUncleHash(block.Uncles()); hash != block.UncleHash() {
+			return common.Hash{}, fmt.Errorf("era: block #%d uncle root mismatch: have %x, want %x", number, hash, block.UncleHash())
+		}
+		if hash := types.DeriveSha(receipts); hash != block.ReceiptHash() {
+			return common.Hash{}, fmt.Errorf("era: block #%d receipt root mismatch: have %x, want %x", number, hash, block.ReceiptHash())
+		}
+		// The total difficulty of the first block depends on the blocks
+		// preceding the archive, which are unknown here.
+		if prevTD != nil {
+			if want := new(big.Int).Add(prevTD, block.Difficulty()); td.Cmp(want) != 0 {
+				return common.Hash{}, fmt.Errorf("era: block #%d total difficulty mismatch: have %v, want %v", number, td, want)
+			}
+		}
+		hashes = append(hashes, block.Hash())
+		tds = append(tds, td)
+		parent, prevTD = block, td
+	}
+	root, err := ComputeAccumulator(hashes, tds)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	stored, err := e.Accumulator()
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if root != stored {
+		return common.Hash{}, fmt.Errorf("era: accumulator mismatch: have %x, want %x", root, stored)
+	}
+	return root, nil
+}
+
+// ReadChecksums reads the checksums file of dir, mapping archive filenames to
+// their hex encoded sha256 digests. A missing file yields an empty map.
+func ReadChecksums(dir string) (map[string]string, error) {
+	sums := make(map[string]string)
+	f, err := os.Open(filepath.Join(dir, ChecksumsFile))
+	if os.IsNotExist(err) {
+		return sums, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: malformed checksum line", ChecksumsFile, line)
+		}
+		sums[fields[1]] = fields[0]
+	}
+	return sums, scanner.Err()
+}
+
+// WriteChecksums writes the checksums file of dir, sorted by filename.
+func WriteChecksums(dir string, sums map[string]string) error {
+	names := make([]string, 0, len(sums))
+	for name := range sums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&buf, "%s  %s\n", sums[name], name)
+	}
+	return os.WriteFile(filepath.Join(dir, ChecksumsFile), []byte(buf.String()), 0644)
+}
+
+// VerifyChecksum checks the sha256 digest of an archive against the checksums
+// of its directory. Archives without a listed checksum are accepted.
+func VerifyChecksum(path string, sums map[string]string) error {
+	want, ok := sums[filepath.Base(path)]
+	if !ok {
+		return nil
+	}
+	have, err := Checksum(path)
+	if err != nil {
+		return err
+	}
+	if have != want {
+		return fmt.Errorf("%s: checksum mismatch: have %s, want %s", filepath.Base(path), have, want)
+	}
+	return nil
+}
+
+// Checksum returns the hex encoded sha256 digest of a file.
+func Checksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
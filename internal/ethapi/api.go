@@ -47,6 +47,7 @@ import (
 	"github.com/zeus-fyi/gochain/v4/params"
 	"github.com/zeus-fyi/gochain/v4/rlp"
 	"github.com/zeus-fyi/gochain/v4/rpc"
+	"github.com/zeus-fyi/gochain/v4/trie"
 )
 
 // PublicEthereumAPI provides an API to access Ethereum related information.
@@ -176,6 +177,85 @@ func (s *PublicTxPoolAPI) Inspect(ctx context.Context) map[string]map[string]map
 	return content
 }
 
+// ContentFrom returns the pending and queued transactions of a single account.
+func (s *PublicTxPoolAPI) ContentFrom(ctx context.Context, addr common.Address) map[string]map[string]*RPCTransaction {
+	content := make(map[string]map[string]*RPCTransaction, 2)
+	pending, queue := s.b.TxPoolContentFrom(ctx, addr)
+
+	// Build the pending transactions
+	dump := make(map[string]*RPCTransaction, len(pending))
+	for _, tx := range pending {
+		dump[fmt.Sprintf("%d", tx.Nonce())] = newRPCPendingTransaction(tx)
+	}
+	content["pending"] = dump
+
+	// Build the queued transactions
+	dump = make(map[string]*RPCTransaction, len(queue))
+	for _, tx := range queue {
+		dump[fmt.Sprintf("%d", tx.Nonce())] = newRPCPendingTransaction(tx)
+	}
+	content["queued"] = dump
+
+	return content
+}
+
+// TxSimulationResult is the outcome of dry-running a raw transaction against
+// the transaction pool.
+type TxSimulationResult struct {
+	Hash         common.Hash    `json:"hash"`
+	From         common.Address `json:"from"`
+	Accepted     bool           `json:"accepted"`
+	Error        string         `json:"error,omitempty"`
+	Known        bool           `json:"known"`
+	Executable   bool           `json:"executable"`
+	PendingNonce hexutil.Uint64 `json:"pendingNonce"`
+	NonceGap     hexutil.Uint64 `json:"nonceGap"`
+	Replaces     *common.Hash   `json:"replaces,omitempty"`
+	ReplacePrice *hexutil.Big   `json:"replacePrice,omitempty"`
+	Position     *hexutil.Uint  `json:"position"`
+	GasAhead     hexutil.Uint64 `json:"gasAhead"`
+	NextBlock    bool           `json:"nextBlock"`
+}
+
+// Simulate runs the transaction pool's validation against a signed raw
+// transaction without submitting it, reporting the exact rejection reason, any
+// nonce gap, the price required to replace a pooled transaction and the
+// estimated position in the next block.
+func (s *PublicTxPoolAPI) Simulate(ctx context.Context, encodedTx hexutil.Bytes) (*TxSimulationResult, error) {
+	tx := new(types.Transaction)
+	if err := rlp.DecodeBytes(encodedTx, tx); err != nil {
+		return nil, err
+	}
+	sim, err := s.b.TxPoolSimulate(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	result := &TxSimulationResult{
+		Hash:         tx.Hash(),
+		From:         sim.From,
+		Accepted:     sim.Err == nil,
+		Known:        sim.Known,
+		Executable:   sim.Executable,
+		PendingNonce: hexutil.Uint64(sim.PendingNonce),
+		NonceGap:     hexutil.Uint64(sim.NonceGap),
+		GasAhead:     hexutil.Uint64(sim.GasAhead),
+		NextBlock:    sim.NextBlock,
+	}
+	if sim.Err != nil {
+		result.Error = sim.Err.Error()
+	}
+	if sim.Replaces != nil {
+		hash := sim.Replaces.Hash()
+		result.Replaces = &hash
+		result.ReplacePrice = (*hexutil.Big)(sim.ReplacePrice)
+	}
+	if sim.Position >= 0 {
+		position := hexutil.Uint(sim.Position)
+		result.Position = &position
+	}
+	return result, nil
+}
+
 // PublicAccountAPI provides an API to access accounts managed by this node.
 // It offers only methods that can retrieve accounts.
 type PublicAccountAPI struct {
@@ -600,18 +680,130 @@ func (s *PublicBlockChainAPI) GetProof(ctx context.Context, address common.Addre
 	}, nil
 }
 
+// maxStorageRangeSlots is the maximum number of slots returned by GetStorageRangeProof.
+const maxStorageRangeSlots = 1024
+
+// StorageRangeResult is the result of GetStorageRangeProof.
+type StorageRangeResult struct {
+	Address      common.Address     `json:"address"`
+	AccountProof []string           `json:"accountProof"`
+	StorageHash  common.Hash        `json:"storageHash"`
+	Start        common.Hash        `json:"start"`
+	Slots        []StorageRangeSlot `json:"slots"`
+	StorageProof []string           `json:"storageProof"`
+}
+
+// StorageRangeSlot is a slot of a storage range, keyed by the hash of its key.
+type StorageRangeSlot struct {
+	Hash  common.Hash  `json:"hash"`
+	Key   *common.Hash `json:"key"` // Preimage of the hash, if known
+	Value common.Hash  `json:"value"`
+}
+
+// GetStorageRangeProof returns up to limit consecutive storage slots of the
+// account, ordered by the hash of their keys from startKey onwards, with the
+// proof of the account and of both edges of the range. The proofs show the
+// slots to be exactly those of the storage trie within the range.
+func (s *PublicBlockChainAPI) GetStorageRangeProof(ctx context.Context, address common.Address, startKey common.Hash, limit int, blockNr rpc.BlockNumber) (*StorageRangeResult, error) {
+	ctx, span := trace.StartSpan(ctx, "PublicBlockChainAPI.GetStorageRangeProof")
+	defer span.End()
+	if limit <= 0 || limit > maxStorageRangeSlots {
+		limit = maxStorageRangeSlots
+	}
+	state, header, err := s.b.StateAndHeaderByNumber(ctx, blockNr)
+	if err != nil {
+		if _, ok := err.(*trie.MissingNodeError); ok && header != nil {
+			return nil, fmt.Errorf("state of block %d is not available, root %x may have been pruned", header.Number, header.Root)
+		}
+		return nil, err
+	}
+	if state == nil {
+		return nil, nil
+	}
+	accountProof, err := state.GetProof(address)
+	if err != nil {
+		return nil, err
+	}
+	result := &StorageRangeResult{
+		Address:      address,
+		AccountProof: common.ToHexArray(accountProof),
+		StorageHash:  types.EmptyRootHash,
+		Start:        startKey,
+		Slots:        []StorageRangeSlot{},
+		StorageProof: []string{},
+	}
+	storageTrie := state.StorageTrie(address)
+	if storageTrie == nil {
+		return result, nil
+	}
+	result.StorageHash = storageTrie.Hash()
+
+	keys, values, proof, err := state.GetStorageRangeProof(address, startKey, limit)
+	if err != nil {
+		return nil, err
+	}
+	for i, key := range keys {
+		_, content, _, err := rlp.Split(values[i])
+		if err != nil {
+			return nil, err
+		}
+		slot := StorageRangeSlot{Hash: common.BytesToHash(key), Value: common.BytesToHash(content)}
+		if preimage := storageTrie.GetKey(key); preimage != nil {
+			hash := common.BytesToHash(preimage)
+			slot.Key = &hash
+		}
+		result.Slots = append(result.Slots, slot)
+	}
+	result.StorageProof = common.ToHexArray(proof)
+	return result, nil
+}
+
+// GetHeaderByNumber returns the requested header, without the transactions and
+// uncles of its block. When blockNr is -1 the chain head is returned.
+func (s *PublicBlockChainAPI) GetHeaderByNumber(ctx context.Context, blockNr rpc.BlockNumber) (map[string]interface{}, error) {
+	ctx, span := trace.StartSpan(ctx, "PublicBlockChainAPI.GetHeaderByNumber")
+	defer span.End()
+	header, err := s.b.HeaderByNumber(ctx, blockNr)
+	if header != nil && err == nil {
+		response := s.rpcOutputHeader(header)
+		if blockNr == rpc.PendingBlockNumber {
+			// Pending headers need to nil out a few fields
+			for _, field := range []string{"hash", "nonce", "miner"} {
+				response[field] = nil
+			}
+		}
+		return response, nil
+	}
+	return nil, err
+}
+
+// GetHeaderByHash returns the requested header, without the transactions and
+// uncles of its block.
+func (s *PublicBlockChainAPI) GetHeaderByHash(ctx context.Context, blockHash common.Hash) (map[string]interface{}, error) {
+	ctx, span := trace.StartSpan(ctx, "PublicBlockChainAPI.GetHeaderByHash")
+	defer span.End()
+	header, err := s.b.HeaderByHash(ctx, blockHash)
+	if header != nil && err == nil {
+		return s.rpcOutputHeader(header), nil
+	}
+	return nil, err
+}
+
 // GetBlockByNumber returns the requested block. When blockNr is -1 the chain head is returned. When fullTx is true all
-// transactions in the block are returned in full detail, otherwise only the transaction hash is returned.
-func (s *PublicBlockChainAPI) GetBlockByNumber(ctx context.Context, blockNr rpc.BlockNumber, fullTx bool) (map[string]interface{}, error) {
+// transactions in the block are returned in full detail, otherwise only the transaction hash is returned. If fields
+// are given, only those fields of the block are returned.
+func (s *PublicBlockChainAPI) GetBlockByNumber(ctx context.Context, blockNr rpc.BlockNumber, fullTx bool, fields *[]string) (map[string]interface{}, error) {
 	ctx, span := trace.StartSpan(ctx, "PublicBlockChainAPI.GetBlockByNumber")
 	defer span.End()
 	block, err := s.b.BlockByNumber(ctx, blockNr)
 	if block != nil {
-		response, err := s.rpcOutputBlock(block, true, fullTx)
+		response, err := s.rpcOutputBlockFields(block, fullTx, fields)
 		if err == nil && blockNr == rpc.PendingBlockNumber {
 			// Pending blocks need to nil out a few fields
 			for _, field := range []string{"hash", "nonce", "miner"} {
-				response[field] = nil
+				if _, ok := response[field]; ok {
+					response[field] = nil
+				}
 			}
 		}
 		return response, err
@@ -620,13 +812,14 @@ func (s *PublicBlockChainAPI) GetBlockByNumber(ctx context.Context, blockNr rpc.
 }
 
 // GetBlockByHash returns the requested block. When fullTx is true all transactions in the block are returned in full
-// detail, otherwise only the transaction hash is returned.
-func (s *PublicBlockChainAPI) GetBlockByHash(ctx context.Context, blockHash common.Hash, fullTx bool) (map[string]interface{}, error) {
+// detail, otherwise only the transaction hash is returned. If fields are given, only those fields of the block are
+// returned.
+func (s *PublicBlockChainAPI) GetBlockByHash(ctx context.Context, blockHash common.Hash, fullTx bool, fields *[]string) (map[string]interface{}, error) {
 	ctx, span := trace.StartSpan(ctx, "PublicBlockChainAPI.GetBlockByHash")
 	defer span.End()
 	block, err := s.b.GetBlock(ctx, blockHash)
 	if block != nil {
-		return s.rpcOutputBlock(block, true, fullTx)
+		return s.rpcOutputBlockFields(block, fullTx, fields)
 	}
 	return nil, err
 }
@@ -751,7 +944,7 @@ func DoCall(ctx context.Context, b Backend, args CallArgs, blockNr rpc.BlockNumb
 	}
 
 	// Create new call message
-	msg := types.NewMessage(addr, args.To, 0, value, gas, gasPrice, data, false)
+	msg := types.NewMessage(addr, args.To, 0, value, gas, gasPrice, nil, nil, data, false)
 
 	// Setup context so it may be cancelled the call has completed
 	// or, in case of unmetered gas, setup a context with a timeout.
@@ -780,7 +973,12 @@ func DoCall(ctx context.Context, b Backend, args CallArgs, blockNr rpc.BlockNumb
 	// Setup the gas pool (also for unmetered requests)
 	// and apply the message.
 	gp := new(core.GasPool).AddGas(math.MaxUint64)
-	return core.ApplyMessage(evm, msg, gp)
+	res, gas, failed, err := core.ApplyMessage(evm, msg, gp)
+	if err == nil {
+		// Reads of historic states may fail, leaving the outcome meaningless.
+		err = state.Error()
+	}
+	return res, gas, failed, err
 }
 
 // Call executes the given transaction on the state for the given block number.
@@ -905,14 +1103,11 @@ func FormatLogs(logs []vm.StructLog) []StructLogRes {
 	return formatted
 }
 
-// RPCMarshalBlock converts the given block to the RPC output which depends on fullTx. If inclTx is true transactions are
-// returned. When fullTx is true the returned block contains full transaction details, otherwise it will only contain
-// transaction hashes.
-func RPCMarshalBlock(b *types.Block, inclTx bool, fullTx bool) (map[string]interface{}, error) {
-	head := b.Header() // copies the header once
-	fields := map[string]interface{}{
+// RPCMarshalHeader converts the given header to the RPC output.
+func RPCMarshalHeader(head *types.Header) map[string]interface{} {
+	return map[string]interface{}{
 		"number":           (*hexutil.Big)(head.Number),
-		"hash":             b.Hash(),
+		"hash":             head.Hash(),
 		"parentHash":       head.ParentHash,
 		"nonce":            head.Nonce,
 		"mixHash":          head.MixDigest,
@@ -925,42 +1120,70 @@ func RPCMarshalBlock(b *types.Block, inclTx bool, fullTx bool) (map[string]inter
 		"signers":          head.Signers,
 		"voters":           head.Voters,
 		"signer":           hexutil.Bytes(head.Signer),
-		"size":             hexutil.Uint64(b.Size()),
 		"gasLimit":         hexutil.Uint64(head.GasLimit),
 		"gasUsed":          hexutil.Uint64(head.GasUsed),
 		"timestamp":        (*hexutil.Big)(head.Time),
 		"transactionsRoot": head.TxHash,
 		"receiptsRoot":     head.ReceiptHash,
 	}
+}
+
+// RPCMarshalBlock converts the given block to the RPC output which depends on fullTx. If inclTx is true transactions are
+// returned. When fullTx is true the returned block contains full transaction details, otherwise it will only contain
+// transaction hashes.
+func RPCMarshalBlock(b *types.Block, inclTx bool, fullTx bool) (map[string]interface{}, error) {
+	fields := RPCMarshalHeader(b.Header())
+	fields["size"] = hexutil.Uint64(b.Size())
 
 	if inclTx {
-		formatTx := func(tx *types.Transaction) (interface{}, error) {
-			return tx.Hash(), nil
+		transactions, err := rpcMarshalTransactions(b, fullTx)
+		if err != nil {
+			return nil, err
 		}
-		if fullTx {
-			formatTx = func(tx *types.Transaction) (interface{}, error) {
-				return newRPCTransactionFromBlockHash(b, tx.Hash()), nil
-			}
+		fields["transactions"] = transactions
+	}
+	fields["uncles"] = rpcMarshalUncles(b)
+
+	return fields, nil
+}
+
+// rpcMarshalTransactions converts the transactions of the given block to the RPC
+// output, their hashes only unless fullTx is true.
+func rpcMarshalTransactions(b *types.Block, fullTx bool) ([]interface{}, error) {
+	formatTx := func(tx *types.Transaction) (interface{}, error) {
+		return tx.Hash(), nil
+	}
+	if fullTx {
+		formatTx = func(tx *types.Transaction) (interface{}, error) {
+			return newRPCTransactionFromBlockHash(b, tx.Hash()), nil
 		}
-		txs := b.Transactions()
-		transactions := make([]interface{}, len(txs))
-		var err error
-		for i, tx := range txs {
-			if transactions[i], err = formatTx(tx); err != nil {
-				return nil, err
-			}
+	}
+	txs := b.Transactions()
+	transactions := make([]interface{}, len(txs))
+	var err error
+	for i, tx := range txs {
+		if transactions[i], err = formatTx(tx); err != nil {
+			return nil, err
 		}
-		fields["transactions"] = transactions
 	}
+	return transactions, nil
+}
 
+// rpcMarshalUncles returns the hashes of the uncles of the given block.
+func rpcMarshalUncles(b *types.Block) []common.Hash {
 	uncles := b.Uncles()
 	uncleHashes := make([]common.Hash, len(uncles))
 	for i, uncle := range uncles {
 		uncleHashes[i] = uncle.Hash()
 	}
-	fields["uncles"] = uncleHashes
+	return uncleHashes
+}
 
-	return fields, nil
+// rpcOutputHeader uses the generalized output filler, then adds the total difficulty field.
+func (s *PublicBlockChainAPI) rpcOutputHeader(head *types.Header) map[string]interface{} {
+	fields := RPCMarshalHeader(head)
+	fields["totalDifficulty"] = (*hexutil.Big)(s.b.GetTd(head.Hash()))
+	return fields
 }
 
 // rpcOutputBlock uses the generalized output filler, then adds the total difficulty field, which requires
@@ -974,6 +1197,40 @@ func (s *PublicBlockChainAPI) rpcOutputBlock(b *types.Block, inclTx bool, fullTx
 	return fields, err
 }
 
+// rpcOutputBlockFields returns the given fields of the RPC output of the block,
+// or all of them if nil. Only the fields asked for are computed, so leaving out
+// the size, total difficulty and transactions saves their lookups.
+func (s *PublicBlockChainAPI) rpcOutputBlockFields(b *types.Block, fullTx bool, fields *[]string) (map[string]interface{}, error) {
+	if fields == nil {
+		return s.rpcOutputBlock(b, true, fullTx)
+	}
+	head := RPCMarshalHeader(b.Header())
+	response := make(map[string]interface{}, len(*fields))
+	for _, field := range *fields {
+		switch field {
+		case "size":
+			response[field] = hexutil.Uint64(b.Size())
+		case "totalDifficulty":
+			response[field] = (*hexutil.Big)(s.b.GetTd(b.Hash()))
+		case "transactions":
+			transactions, err := rpcMarshalTransactions(b, fullTx)
+			if err != nil {
+				return nil, err
+			}
+			response[field] = transactions
+		case "uncles":
+			response[field] = rpcMarshalUncles(b)
+		default:
+			value, ok := head[field]
+			if !ok {
+				return nil, fmt.Errorf("unknown block field %q", field)
+			}
+			response[field] = value
+		}
+	}
+	return response, nil
+}
+
 // RPCTransaction represents a transaction that will serialize to the RPC representation of a transaction
 type RPCTransaction struct {
 	BlockHash        common.Hash     `json:"blockHash"`
@@ -1367,6 +1624,27 @@ func (s *PublicTransactionPoolAPI) SendRawTransaction(ctx context.Context, encod
 	return SubmitTransaction(ctx, s.b, tx)
 }
 
+// SendPrivateTransaction will add the signed transaction to the transaction pool
+// without gossiping it to the network. It is only forwarded to the configured
+// private peers, and dropped if not included by maxBlock (if given).
+func (s *PublicTransactionPoolAPI) SendPrivateTransaction(ctx context.Context, encodedTx hexutil.Bytes, maxBlock *hexutil.Uint64) (common.Hash, error) {
+	tx := new(types.Transaction)
+	if err := rlp.DecodeBytes(encodedTx, tx); err != nil {
+		return common.Hash{}, err
+	}
+	var max uint64
+	if maxBlock != nil {
+		max = uint64(*maxBlock)
+	}
+	if err := s.b.SendPrivateTx(ctx, tx, max); err != nil {
+		return common.Hash{}, err
+	}
+	if log.Tracing() {
+		log.Trace("Submitted private transaction", "fullhash", tx.Hash().Hex(), "recipient", tx.To(), "maxBlock", max)
+	}
+	return tx.Hash(), nil
+}
+
 // Sign calculates an ECDSA signature for:
 // keccack256("\x19Ethereum Signed Message:\n" + len(message) + message).
 //
@@ -1490,6 +1768,49 @@ func (s *PublicTransactionPoolAPI) Resend(ctx context.Context, sendArgs SendTxAr
 	return common.Hash{}, fmt.Errorf("Transaction %#x not found", matchTx.Hash())
 }
 
+// CancelTransaction replaces a pooled transaction sent from an account managed
+// by this node with a zero-value transfer to itself, priced high enough to
+// satisfy the pool's replacement rules. Like SendTransaction, it signs with
+// the unlocked account of the sender.
+func (s *PublicTransactionPoolAPI) CancelTransaction(ctx context.Context, hash common.Hash) (common.Hash, error) {
+	tx := s.b.GetPoolTransaction(hash)
+	if tx == nil {
+		return common.Hash{}, fmt.Errorf("transaction %#x not found", hash)
+	}
+	var signer types.Signer = types.HomesteadSigner{}
+	if tx.Protected() {
+		signer = types.NewEIP155Signer(tx.ChainId())
+	}
+	from, err := types.Sender(signer, tx)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	// The pool knows the transaction, any other rejection means it can't be replaced
+	sim, err := s.b.TxPoolSimulate(ctx, tx)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if sim.Err != nil && !sim.Known {
+		return common.Hash{}, sim.Err
+	}
+	// Price the replacement at the suggested price or the required bump, whichever is higher
+	price, err := s.b.SuggestPrice(ctx)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if sim.ReplacePrice != nil && sim.ReplacePrice.Cmp(price) > 0 {
+		price = sim.ReplacePrice
+	}
+	if price.Cmp(tx.GasPrice()) <= 0 {
+		price = new(big.Int).Add(tx.GasPrice(), common.Big1)
+	}
+	signed, err := s.sign(from, types.NewTransaction(tx.Nonce(), from, new(big.Int), params.TxGas, price, nil))
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return SubmitTransaction(ctx, s.b, signed)
+}
+
 // PublicDebugAPI is the collection of Ethereum APIs exposed over the public
 // debugging endpoint.
 type PublicDebugAPI struct {
@@ -1515,6 +1836,87 @@ func (api *PublicDebugAPI) GetBlockRlp(ctx context.Context, number uint64) (stri
 	return fmt.Sprintf("%x", encoded), nil
 }
 
+// GetRawHeader retrieves the RLP encoding of a single header.
+func (api *PublicDebugAPI) GetRawHeader(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (hexutil.Bytes, error) {
+	header, err := api.headerByNumberOrHash(ctx, blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	return rlp.EncodeToBytes(header)
+}
+
+// GetRawBlock retrieves the RLP encoding of a single block.
+func (api *PublicDebugAPI) GetRawBlock(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (hexutil.Bytes, error) {
+	header, err := api.headerByNumberOrHash(ctx, blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	block, err := api.b.GetBlock(ctx, header.Hash())
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, fmt.Errorf("block %#x not found", header.Hash())
+	}
+	return rlp.EncodeToBytes(block)
+}
+
+// GetRawReceipts retrieves the consensus RLP encodings of the receipts of a
+// single block.
+func (api *PublicDebugAPI) GetRawReceipts(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) ([]hexutil.Bytes, error) {
+	header, err := api.headerByNumberOrHash(ctx, blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	receipts, err := api.b.GetReceipts(ctx, header.Hash())
+	if err != nil {
+		return nil, err
+	}
+	result := make([]hexutil.Bytes, len(receipts))
+	for i, receipt := range receipts {
+		if result[i], err = rlp.EncodeToBytes(receipt); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// headerByNumberOrHash retrieves the header of a block given by number or hash,
+// the latter being checked to be canonical if required.
+func (api *PublicDebugAPI) headerByNumberOrHash(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*types.Header, error) {
+	if number, ok := blockNrOrHash.Number(); ok {
+		header, err := api.b.HeaderByNumber(ctx, number)
+		if err != nil {
+			return nil, err
+		}
+		if header == nil {
+			return nil, fmt.Errorf("block #%d not found", number)
+		}
+		return header, nil
+	}
+	hash, ok := blockNrOrHash.Hash()
+	if !ok {
+		return nil, errors.New("invalid arguments; neither block nor hash specified")
+	}
+	header, err := api.b.HeaderByHash(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	if header == nil {
+		return nil, fmt.Errorf("block %#x not found", hash)
+	}
+	if blockNrOrHash.RequireCanonical {
+		canonical, err := api.b.HeaderByNumber(ctx, rpc.BlockNumber(header.Number.Int64()))
+		if err != nil {
+			return nil, err
+		}
+		if canonical == nil || canonical.Hash() != hash {
+			return nil, fmt.Errorf("hash %#x is not currently canonical", hash)
+		}
+	}
+	return header, nil
+}
+
 // PrintBlock retrieves a block and returns its pretty printed form.
 func (api *PublicDebugAPI) PrintBlock(ctx context.Context, number uint64) (string, error) {
 	block, _ := api.b.BlockByNumber(ctx, rpc.BlockNumber(number))
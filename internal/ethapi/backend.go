@@ -45,6 +45,7 @@ type Backend interface {
 	// BlockChain API
 	SetHead(number uint64)
 	HeaderByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*types.Header, error)
+	HeaderByHash(ctx context.Context, blockHash common.Hash) (*types.Header, error)
 	BlockByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*types.Block, error)
 	StateAndHeaderByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*state.StateDB, *types.Header, error)
 	GetBlock(ctx context.Context, blockHash common.Hash) (*types.Block, error)
@@ -60,11 +61,14 @@ type Backend interface {
 
 	// TxPool API
 	SendTx(ctx context.Context, signedTx *types.Transaction) error
+	SendPrivateTx(ctx context.Context, signedTx *types.Transaction, maxBlock uint64) error
 	GetPoolTransactions() types.Transactions
 	GetPoolTransaction(txHash common.Hash) *types.Transaction
 	GetPoolNonce(ctx context.Context, addr common.Address) (uint64, error)
 	Stats() (pending int, queued int)
 	TxPoolContent(context.Context) (map[common.Address]types.Transactions, map[common.Address]types.Transactions)
+	TxPoolContentFrom(ctx context.Context, addr common.Address) (types.Transactions, types.Transactions)
+	TxPoolSimulate(ctx context.Context, tx *types.Transaction) (*core.TxSimulation, error)
 	SubscribeNewTxsEvent(chan<- core.NewTxsEvent, string)
 	UnsubscribeNewTxsEvent(chan<- core.NewTxsEvent)
 
@@ -0,0 +1,182 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package otlp
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"time"
+
+	"go.opencensus.io/trace"
+)
+
+// The types below mirror the JSON mapping of the OTLP trace protobuf messages.
+// 64 bit integers are encoded as strings and IDs in hex, as the OTLP/HTTP
+// specification requires.
+
+type exportRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+type resourceSpans struct {
+	Resource   resource     `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scopeSpans struct {
+	Scope scope  `json:"scope"`
+	Spans []span `json:"spans"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type span struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	Events            []event    `json:"events,omitempty"`
+	Status            status     `json:"status"`
+}
+
+type event struct {
+	TimeUnixNano string     `json:"timeUnixNano"`
+	Name         string     `json:"name"`
+	Attributes   []keyValue `json:"attributes,omitempty"`
+}
+
+type status struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+// OTLP span kinds and status codes.
+const (
+	kindInternal = 1
+	kindServer   = 2
+	kindClient   = 3
+
+	statusOK    = 1
+	statusError = 2
+)
+
+// encodeSpans encodes a batch of spans as an OTLP/HTTP JSON export request.
+func encodeSpans(service string, batch []*trace.SpanData) ([]byte, error) {
+	spans := make([]span, len(batch))
+	for i, sd := range batch {
+		spans[i] = convertSpan(sd)
+	}
+	req := exportRequest{ResourceSpans: []resourceSpans{{
+		Resource:   resource{Attributes: []keyValue{stringAttribute("service.name", service)}},
+		ScopeSpans: []scopeSpans{{Scope: scope{Name: "github.com/zeus-fyi/gochain"}, Spans: spans}},
+	}}}
+	return json.Marshal(req)
+}
+
+// convertSpan converts an OpenCensus span into its OTLP representation.
+func convertSpan(sd *trace.SpanData) span {
+	s := span{
+		TraceID:           hex.EncodeToString(sd.TraceID[:]),
+		SpanID:            hex.EncodeToString(sd.SpanID[:]),
+		Name:              sd.Name,
+		StartTimeUnixNano: unixNano(sd.StartTime),
+		EndTimeUnixNano:   unixNano(sd.EndTime),
+		Attributes:        convertAttributes(sd.Attributes),
+		Status:            status{Code: statusOK},
+	}
+	if sd.ParentSpanID != (trace.SpanID{}) {
+		s.ParentSpanID = hex.EncodeToString(sd.ParentSpanID[:])
+	}
+	switch sd.SpanKind {
+	case trace.SpanKindServer:
+		s.Kind = kindServer
+	case trace.SpanKindClient:
+		s.Kind = kindClient
+	default:
+		s.Kind = kindInternal
+	}
+	if sd.Code != trace.StatusCodeOK {
+		s.Status = status{Code: statusError, Message: sd.Message}
+	}
+	for _, a := range sd.Annotations {
+		s.Events = append(s.Events, event{
+			TimeUnixNano: unixNano(a.Time),
+			Name:         a.Message,
+			Attributes:   convertAttributes(a.Attributes),
+		})
+	}
+	return s
+}
+
+// convertAttributes converts OpenCensus attributes, sorted by key.
+func convertAttributes(attrs map[string]interface{}) []keyValue {
+	if len(attrs) == 0 {
+		return nil
+	}
+	kvs := make([]keyValue, 0, len(attrs))
+	for key, value := range attrs {
+		kv := keyValue{Key: key}
+		switch v := value.(type) {
+		case string:
+			kv.Value.StringValue = &v
+		case bool:
+			kv.Value.BoolValue = &v
+		case int64:
+			s := strconv.FormatInt(v, 10)
+			kv.Value.IntValue = &s
+		case float64:
+			kv.Value.DoubleValue = &v
+		default:
+			continue
+		}
+		kvs = append(kvs, kv)
+	}
+	sort.Slice(kvs, func(i, j int) bool { return kvs[i].Key < kvs[j].Key })
+	return kvs
+}
+
+func stringAttribute(key, value string) keyValue {
+	return keyValue{Key: key, Value: anyValue{StringValue: &value}}
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
@@ -0,0 +1,233 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package otlp exports OpenCensus spans to an OpenTelemetry collector.
+//
+// Spans are batched and sent using the OTLP/HTTP protocol with JSON encoding,
+// which every OpenTelemetry collector accepts at <endpoint>/v1/traces without
+// pulling the OpenTelemetry SDK and its gRPC stack into the build.
+package otlp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zeus-fyi/gochain/v4/log"
+	"github.com/zeus-fyi/gochain/v4/metrics"
+	"go.opencensus.io/trace"
+)
+
+// TracesPath is the path of the OTLP/HTTP traces endpoint of a collector.
+const TracesPath = "/v1/traces"
+
+var (
+	exportedSpanMeter = metrics.NewRegisteredMeter("tracing/otlp/exported", nil)
+	droppedSpanMeter  = metrics.NewRegisteredMeter("tracing/otlp/dropped", nil)
+)
+
+// Options configures an Exporter.
+type Options struct {
+	// Endpoint is the base URL of the collector, e.g. http://localhost:4318.
+	Endpoint string
+
+	// ServiceName identifies the process in the exported resource.
+	ServiceName string
+
+	// Headers are added to every export request, e.g. for authentication.
+	Headers map[string]string
+
+	// BatchSize is the number of spans sent at once, 512 if zero.
+	BatchSize int
+
+	// FlushInterval is the longest spans are buffered, 5 seconds if zero.
+	FlushInterval time.Duration
+
+	// MaxQueue is the number of buffered spans beyond which new ones are
+	// dropped while the collector is unreachable, 8 batches if zero.
+	MaxQueue int
+}
+
+// Exporter is a trace.Exporter sending spans to an OTLP/HTTP collector.
+type Exporter struct {
+	opts   Options
+	url    string
+	client *http.Client
+
+	mu      sync.Mutex
+	pending []*trace.SpanData
+	flushCh chan chan struct{}
+	quit    chan struct{}
+	done    chan struct{}
+	stop    sync.Once
+}
+
+// NewExporter creates an exporter sending spans to the collector at
+// opts.Endpoint and starts its background sender.
+func NewExporter(opts Options) (*Exporter, error) {
+	u, err := url.Parse(opts.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTLP endpoint: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.New("invalid OTLP endpoint: need an http or https URL")
+	}
+	if opts.ServiceName == "" {
+		opts.ServiceName = "gochain"
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 512
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = 5 * time.Second
+	}
+	if opts.MaxQueue <= 0 {
+		opts.MaxQueue = 8 * opts.BatchSize
+	}
+	// Accept both the base URL and the full traces URL.
+	if !strings.HasSuffix(u.Path, TracesPath) {
+		u.Path = strings.TrimSuffix(u.Path, "/") + TracesPath
+	}
+	e := &Exporter{
+		opts:    opts,
+		url:     u.String(),
+		client:  &http.Client{Timeout: 10 * time.Second},
+		flushCh: make(chan chan struct{}),
+		quit:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go e.loop()
+	return e, nil
+}
+
+// ExportSpan implements trace.Exporter, queueing the span for sending.
+func (e *Exporter) ExportSpan(sd *trace.SpanData) {
+	e.mu.Lock()
+	if len(e.pending) >= e.opts.MaxQueue {
+		e.mu.Unlock()
+		droppedSpanMeter.Mark(1)
+		return
+	}
+	e.pending = append(e.pending, sd)
+	full := len(e.pending) >= e.opts.BatchSize
+	e.mu.Unlock()
+
+	if full {
+		select {
+		case e.flushCh <- nil:
+		default: // A send is in progress already.
+		}
+	}
+}
+
+// Flush sends all queued spans, waiting until done.
+func (e *Exporter) Flush() {
+	done := make(chan struct{})
+	select {
+	case e.flushCh <- done:
+		<-done
+	case <-e.done:
+	}
+}
+
+// Stop sends all queued spans and terminates the background sender.
+func (e *Exporter) Stop() {
+	e.stop.Do(func() {
+		close(e.quit)
+		<-e.done
+	})
+}
+
+// loop sends the queued spans in batches whenever enough have accumulated, a
+// flush is requested or the flush interval passed.
+func (e *Exporter) loop() {
+	defer close(e.done)
+
+	ticker := time.NewTicker(e.opts.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case done := <-e.flushCh:
+			e.send()
+			if done != nil {
+				close(done)
+			}
+		case <-ticker.C:
+			e.send()
+		case <-e.quit:
+			e.send()
+			return
+		}
+	}
+}
+
+// send posts all queued spans to the collector.
+func (e *Exporter) send() {
+	for {
+		e.mu.Lock()
+		n := len(e.pending)
+		if n > e.opts.BatchSize {
+			n = e.opts.BatchSize
+		}
+		batch := e.pending[:n:n]
+		e.pending = e.pending[n:]
+		e.mu.Unlock()
+
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.post(batch); err != nil {
+			droppedSpanMeter.Mark(int64(len(batch)))
+			log.Warn("Failed to export trace spans", "url", e.url, "spans", len(batch), "err", err)
+			return
+		}
+		exportedSpanMeter.Mark(int64(len(batch)))
+	}
+}
+
+// post sends a batch of spans in a single request.
+func (e *Exporter) post(batch []*trace.SpanData) error {
+	body, err := encodeSpans(e.opts.ServiceName, batch)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range e.opts.Headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("collector returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	return nil
+}
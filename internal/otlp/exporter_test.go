@@ -0,0 +1,135 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package otlp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opencensus.io/trace"
+)
+
+// testCollector is a stand-in for an OpenTelemetry collector, recording the
+// spans posted to it.
+type testCollector struct {
+	mu      sync.Mutex
+	spans   []span
+	service string
+	header  string
+}
+
+func (c *testCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != TracesPath || r.Header.Get("Content-Type") != "application/json" {
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+		return
+	}
+	var req exportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.header = r.Header.Get("X-Token")
+	for _, rs := range req.ResourceSpans {
+		for _, kv := range rs.Resource.Attributes {
+			if kv.Key == "service.name" && kv.Value.StringValue != nil {
+				c.service = *kv.Value.StringValue
+			}
+		}
+		for _, ss := range rs.ScopeSpans {
+			c.spans = append(c.spans, ss.Spans...)
+		}
+	}
+	w.Write([]byte("{}"))
+}
+
+func TestExporter(t *testing.T) {
+	collector := new(testCollector)
+	srv := httptest.NewServer(collector)
+	defer srv.Close()
+
+	exp, err := NewExporter(Options{
+		Endpoint:      srv.URL,
+		ServiceName:   "test",
+		Headers:       map[string]string{"X-Token": "secret"},
+		FlushInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exp.Stop()
+	trace.RegisterExporter(exp)
+	defer trace.UnregisterExporter(exp)
+
+	ctx, parent := trace.StartSpan(context.Background(), "parent", trace.WithSampler(trace.AlwaysSample()), trace.WithSpanKind(trace.SpanKindServer))
+	_, child := trace.StartSpan(ctx, "child")
+	child.AddAttributes(trace.StringAttribute("method", "eth_call"), trace.Int64Attribute("blocks", 3), trace.BoolAttribute("ok", false))
+	child.Annotate(nil, "checkpoint")
+	child.SetStatus(trace.Status{Code: trace.StatusCodeUnknown, Message: "failed"})
+	child.End()
+	parent.End()
+
+	exp.Flush()
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	if collector.service != "test" {
+		t.Errorf("service name mismatch: have %q, want test", collector.service)
+	}
+	if collector.header != "secret" {
+		t.Errorf("header mismatch: have %q, want secret", collector.header)
+	}
+	if len(collector.spans) != 2 {
+		t.Fatalf("span count mismatch: have %d, want 2", len(collector.spans))
+	}
+	c, p := collector.spans[0], collector.spans[1]
+	if c.Name != "child" || p.Name != "parent" {
+		t.Fatalf("span names mismatch: have %q, %q", c.Name, p.Name)
+	}
+	if c.TraceID != p.TraceID || len(c.TraceID) != 32 {
+		t.Errorf("trace ID mismatch: have %q, %q", c.TraceID, p.TraceID)
+	}
+	if c.ParentSpanID != p.SpanID || p.ParentSpanID != "" {
+		t.Errorf("parent mismatch: child parent %q, parent ID %q", c.ParentSpanID, p.SpanID)
+	}
+	if p.Kind != kindServer || c.Kind != kindInternal {
+		t.Errorf("kind mismatch: have parent %d, child %d", p.Kind, c.Kind)
+	}
+	if c.Status.Code != statusError || c.Status.Message != "failed" || p.Status.Code != statusOK {
+		t.Errorf("status mismatch: have child %+v, parent %+v", c.Status, p.Status)
+	}
+	if len(c.Attributes) != 3 || c.Attributes[0].Key != "blocks" || *c.Attributes[0].Value.IntValue != "3" {
+		t.Errorf("attributes mismatch: have %+v", c.Attributes)
+	}
+	if len(c.Events) != 1 || c.Events[0].Name != "checkpoint" {
+		t.Errorf("events mismatch: have %+v", c.Events)
+	}
+}
+
+func TestExporterInvalidEndpoint(t *testing.T) {
+	for _, endpoint := range []string{"", "localhost:4318", "grpc://localhost:4317"} {
+		if _, err := NewExporter(Options{Endpoint: endpoint}); err == nil {
+			t.Errorf("endpoint %q accepted", endpoint)
+		}
+	}
+}
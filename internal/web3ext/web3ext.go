@@ -140,11 +140,21 @@ web3._extend({
 			params: 1,
 			inputFormatter: [null]
 		}),
+		new web3._extend.Method({
+			name: 'exportHistory',
+			call: 'admin_exportHistory',
+			params: 3,
+			inputFormatter: [null, null, null]
+		}),
 		new web3._extend.Method({
 			name: 'importChain',
 			call: 'admin_importChain',
 			params: 1
 		}),
+		new web3._extend.Method({
+			name: 'reloadTxPoolDenyList',
+			call: 'admin_reloadTxPoolDenyList'
+		}),
 		new web3._extend.Method({
 			name: 'sleepBlocks',
 			call: 'admin_sleepBlocks',
@@ -202,6 +212,21 @@ web3._extend({
 			call: 'debug_getBlockRlp',
 			params: 1
 		}),
+		new web3._extend.Method({
+			name: 'getRawHeader',
+			call: 'debug_getRawHeader',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'getRawBlock',
+			call: 'debug_getRawBlock',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'getRawReceipts',
+			call: 'debug_getRawReceipts',
+			params: 1
+		}),
 		new web3._extend.Method({
 			name: 'setHead',
 			call: 'debug_setHead',
@@ -379,6 +404,18 @@ web3._extend({
 			call: 'debug_getBadBlocks',
 			params: 0,
 		}),
+		new web3._extend.Method({
+			name: 'executionWitness',
+			call: 'debug_executionWitness',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'stateDiff',
+			call: 'debug_stateDiff',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter]
+		}),
 		new web3._extend.Method({
 			name: 'storageRangeAt',
 			call: 'debug_storageRangeAt',
@@ -410,6 +447,17 @@ web3._extend({
 			call: 'eth_chainId',
 			params: 0
 		}),
+		new web3._extend.Method({
+			name: 'getHeaderByNumber',
+			call: 'eth_getHeaderByNumber',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'getHeaderByHash',
+			call: 'eth_getHeaderByHash',
+			params: 1
+		}),
 		new web3._extend.Method({
 			name: 'sign',
 			call: 'eth_sign',
@@ -422,6 +470,11 @@ web3._extend({
 			params: 3,
 			inputFormatter: [web3._extend.formatters.inputTransactionFormatter, web3._extend.utils.fromDecimal, web3._extend.utils.fromDecimal]
 		}),
+		new web3._extend.Method({
+			name: 'cancelTransaction',
+			call: 'eth_cancelTransaction',
+			params: 1
+		}),
 		new web3._extend.Method({
 			name: 'signTransaction',
 			call: 'eth_signTransaction',
@@ -434,6 +487,22 @@ web3._extend({
 			params: 1,
 			inputFormatter: [web3._extend.formatters.inputTransactionFormatter]
 		}),
+		new web3._extend.Method({
+			name: 'sendPrivateTransaction',
+			call: 'eth_sendPrivateTransaction',
+			params: 2
+		}),
+		new web3._extend.Method({
+			name: 'sendBundle',
+			call: 'eth_sendBundle',
+			params: 4,
+			inputFormatter: [null, null, null, null]
+		}),
+		new web3._extend.Method({
+			name: 'callBundle',
+			call: 'eth_callBundle',
+			params: 1
+		}),
 		new web3._extend.Method({
 			name: 'getRawTransaction',
 			call: 'eth_getRawTransactionByHash',
@@ -447,6 +516,12 @@ web3._extend({
 			params: 2,
 			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter, web3._extend.utils.toHex]
 		}),
+		new web3._extend.Method({
+			name: 'getLogsPaginated',
+			call: 'eth_getLogsPaginated',
+			params: 3,
+			inputFormatter: [null, null, web3._extend.utils.toHex]
+		}),
 	],
 	properties: [
 		new web3._extend.Property({
@@ -461,6 +536,10 @@ web3._extend({
 				return formatted;
 			}
 		}),
+		new web3._extend.Property({
+			name: 'logIndexStatus',
+			getter: 'eth_logIndexStatus'
+		}),
 	]
 });
 `
@@ -629,7 +708,19 @@ web3._extend({
 const TxPool_JS = `
 web3._extend({
 	property: 'txpool',
-	methods: [],
+	methods: [
+		new web3._extend.Method({
+			name: 'contentFrom',
+			call: 'txpool_contentFrom',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputAddressFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'simulate',
+			call: 'txpool_simulate',
+			params: 1
+		}),
+	],
 	properties:
 	[
 		new web3._extend.Property({
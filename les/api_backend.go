@@ -18,6 +18,7 @@ package les
 
 import (
 	"context"
+	"fmt"
 	"math/big"
 
 	"github.com/zeus-fyi/gochain/v4/accounts"
@@ -134,6 +135,10 @@ func (b *LesApiBackend) SendTx(ctx context.Context, signedTx *types.Transaction)
 	return b.eth.txPool.Add(ctx, signedTx)
 }
 
+func (b *LesApiBackend) SendPrivateTx(ctx context.Context, signedTx *types.Transaction, maxBlock uint64) error {
+	return fmt.Errorf("not supported")
+}
+
 func (b *LesApiBackend) RemoveTx(txHash common.Hash) {
 	b.eth.txPool.RemoveTx(txHash)
 }
@@ -158,6 +163,15 @@ func (b *LesApiBackend) TxPoolContent(ctx context.Context) (map[common.Address]t
 	return b.eth.txPool.Content(ctx)
 }
 
+func (b *LesApiBackend) TxPoolContentFrom(ctx context.Context, addr common.Address) (types.Transactions, types.Transactions) {
+	pending, queued := b.eth.txPool.Content(ctx)
+	return pending[addr], queued[addr]
+}
+
+func (b *LesApiBackend) TxPoolSimulate(ctx context.Context, tx *types.Transaction) (*core.TxSimulation, error) {
+	return nil, fmt.Errorf("not supported")
+}
+
 func (b *LesApiBackend) SubscribeNewTxsEvent(ch chan<- core.NewTxsEvent, name string) {
 	b.eth.txPool.SubscribeNewTxsEvent(ch, name)
 }
@@ -230,6 +244,11 @@ func (b *LesApiBackend) BloomStatus() (uint64, uint64) {
 	return light.BloomTrieFrequency, sections
 }
 
+// LogIndexStatus reports no log index, light clients don't build one.
+func (b *LesApiBackend) LogIndexStatus() (uint64, uint64) {
+	return 0, 0
+}
+
 func (b *LesApiBackend) ServiceFilter(ctx context.Context, session *bloombits.MatcherSession) {
 	for i := 0; i < bloomFilterThreads; i++ {
 		go session.Multiplex(bloomRetrievalBatch, bloomRetrievalWait, b.eth.bloomRequests)
@@ -208,7 +208,7 @@ func (s *LightGoChain) APIs() []rpc.API {
 		}, {
 			Namespace: "eth",
 			Version:   "1.0",
-			Service:   filters.NewPublicFilterAPI(s.ApiBackend, true),
+			Service:   filters.NewPublicFilterAPI(s.ApiBackend, true, s.config.Logs),
 			Public:    true,
 		}, {
 			Namespace: "net",
@@ -0,0 +1,106 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package prometheus
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"github.com/zeus-fyi/gochain/v4/metrics"
+)
+
+// quantiles are the quantiles reported for histograms and timers.
+var quantiles = []float64{0.5, 0.75, 0.95, 0.99, 0.999}
+
+// collector accumulates metrics in the Prometheus text exposition format.
+type collector struct {
+	buf bytes.Buffer
+}
+
+// add writes the metric of the given name, ignoring unsupported types.
+func (c *collector) add(name string, i interface{}) {
+	name = metricName(name)
+	switch m := i.(type) {
+	case metrics.Counter:
+		c.writeType(name, "counter")
+		c.writeValue(name, "", m.Count())
+	case metrics.Gauge:
+		c.writeType(name, "gauge")
+		c.writeValue(name, "", m.Value())
+	case metrics.GaugeFloat64:
+		c.writeType(name, "gauge")
+		c.writeValue(name, "", m.Value())
+	case metrics.Meter:
+		c.writeType(name, "counter")
+		c.writeValue(name, "", m.Snapshot().Count())
+	case metrics.Histogram:
+		h := m.Snapshot()
+		c.writeSummary(name, h.Percentiles(quantiles), h.Sum(), h.Count())
+	case metrics.Timer:
+		t := m.Snapshot()
+		c.writeSummary(name, t.Percentiles(quantiles), t.Sum(), t.Count())
+	case metrics.ResettingTimer:
+		t := m.Snapshot()
+		count := len(t.Values())
+		if count == 0 {
+			return
+		}
+		percentiles := make([]float64, len(quantiles))
+		for i, q := range quantiles {
+			percentiles[i] = q * 100
+		}
+		ps := make([]float64, len(quantiles))
+		for i, p := range t.Percentiles(percentiles) {
+			ps[i] = float64(p)
+		}
+		c.writeSummary(name, ps, t.Mean()*float64(count), count)
+	}
+}
+
+// writeSummary writes a summary with the given quantile values, sum and count.
+func (c *collector) writeSummary(name string, values []float64, sum, count interface{}) {
+	c.writeType(name, "summary")
+	for i, q := range quantiles {
+		c.writeValue(name, `{quantile="`+strconv.FormatFloat(q, 'f', -1, 64)+`"}`, values[i])
+	}
+	c.writeValue(name+"_sum", "", sum)
+	c.writeValue(name+"_count", "", count)
+}
+
+func (c *collector) writeType(name, typ string) {
+	fmt.Fprintf(&c.buf, "# TYPE %s %s\n", name, typ)
+}
+
+func (c *collector) writeValue(name, labels string, value interface{}) {
+	fmt.Fprintf(&c.buf, "%s%s %v\n", name, labels, value)
+}
+
+// metricName converts a registry name into a valid Prometheus metric name by
+// replacing the characters Prometheus doesn't allow with underscores.
+func metricName(name string) string {
+	out := []byte(name)
+	for i, b := range out {
+		switch {
+		case b >= 'a' && b <= 'z', b >= 'A' && b <= 'Z', b == '_', b == ':':
+		case b >= '0' && b <= '9' && i > 0:
+		default:
+			out[i] = '_'
+		}
+	}
+	return string(out)
+}
@@ -0,0 +1,60 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package prometheus exposes go-metrics in the Prometheus text format.
+//
+// Counters and meters are exported as Prometheus counters, gauges as gauges,
+// and histograms, timers and resetting timers as summaries with quantiles.
+// Names are converted by replacing characters Prometheus doesn't allow in
+// metric names, like the slashes of "chain/inserts", with underscores.
+package prometheus
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/zeus-fyi/gochain/v4/log"
+	"github.com/zeus-fyi/gochain/v4/metrics"
+)
+
+// Path is where the handler is conventionally served.
+const Path = "/debug/metrics/prometheus"
+
+// Handler returns an HTTP handler which serves the metrics of reg in the
+// Prometheus text exposition format.
+func Handler(reg metrics.Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Gather and sort the metric names for a stable output.
+		var names []string
+		reg.Each(func(name string, i interface{}) {
+			names = append(names, name)
+		})
+		sort.Strings(names)
+
+		var c collector
+		for _, name := range names {
+			if i := reg.Get(name); i != nil {
+				c.add(name, i)
+			}
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Header().Set("Content-Length", fmt.Sprint(c.buf.Len()))
+		if _, err := w.Write(c.buf.Bytes()); err != nil {
+			log.Debug("Failed to write Prometheus metrics", "err", err)
+		}
+	})
+}
@@ -0,0 +1,93 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package prometheus
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zeus-fyi/gochain/v4/metrics"
+)
+
+func init() {
+	metrics.Enabled = true
+}
+
+func TestHandler(t *testing.T) {
+	reg := metrics.NewRegistry()
+
+	metrics.NewRegisteredCounter("test/counter", reg).Inc(3)
+	metrics.NewRegisteredGauge("test/gauge", reg).Update(7)
+	metrics.NewRegisteredGaugeFloat64("test/gauge64", reg).Update(1.5)
+	metrics.NewRegisteredMeter("test/meter", reg).Mark(4)
+	histogram := metrics.NewRegisteredHistogram("test/histogram", reg, metrics.NewUniformSample(100))
+	for i := int64(1); i <= 4; i++ {
+		histogram.Update(i)
+	}
+	timer := metrics.NewRegisteredTimer("test/timer", reg)
+	timer.Update(time.Second)
+	metrics.NewRegisteredResettingTimer("test/resetting", reg).Update(2 * time.Millisecond)
+	metrics.NewRegisteredResettingTimer("test/resetting-empty", reg)
+	metrics.NewRegisteredMeter("rpc/calls/eth_call/success", reg).Mark(1)
+
+	rec := httptest.NewRecorder()
+	Handler(reg).ServeHTTP(rec, httptest.NewRequest("GET", Path, nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("content type mismatch: have %q", ct)
+	}
+	out := rec.Body.String()
+	for _, want := range []string{
+		"# TYPE test_counter counter\ntest_counter 3\n",
+		"# TYPE test_gauge gauge\ntest_gauge 7\n",
+		"# TYPE test_gauge64 gauge\ntest_gauge64 1.5\n",
+		"# TYPE test_meter counter\ntest_meter 4\n",
+		"# TYPE test_histogram summary\n",
+		"test_histogram{quantile=\"0.5\"} 2.5\n",
+		"test_histogram_sum 10\ntest_histogram_count 4\n",
+		"# TYPE test_timer summary\n",
+		"test_timer{quantile=\"0.99\"} 1e+09\n",
+		"test_timer_count 1\n",
+		"# TYPE test_resetting summary\n",
+		"test_resetting{quantile=\"0.5\"} 2e+06\n",
+		"test_resetting_count 1\n",
+		"# TYPE rpc_calls_eth_call_success counter\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output is missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "test_resetting_empty") {
+		t.Errorf("empty resetting timer exported:\n%s", out)
+	}
+}
+
+func TestMetricName(t *testing.T) {
+	tests := map[string]string{
+		"chain/inserts":       "chain_inserts",
+		"p2p/InboundTraffic":  "p2p_InboundTraffic",
+		"txpool/pending.nofn": "txpool_pending_nofn",
+		"1st":                 "_st",
+		"eth/db/chaindata/c":  "eth_db_chaindata_c",
+	}
+	for in, want := range tests {
+		if have := metricName(in); have != want {
+			t.Errorf("%q: name mismatch: have %q, want %q", in, have, want)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/core"
+	"github.com/zeus-fyi/gochain/v4/core/types"
+	"github.com/zeus-fyi/gochain/v4/core/vm"
+	"github.com/zeus-fyi/gochain/v4/crypto"
+	"github.com/zeus-fyi/gochain/v4/log"
+	"github.com/zeus-fyi/gochain/v4/metrics"
+)
+
+const (
+	// maxBundles is the maximum number of bundles queued for inclusion.
+	maxBundles = 256
+
+	// maxBundleTxs is the maximum number of transactions in a single bundle.
+	maxBundleTxs = 64
+
+	// maxBundleLookahead is how many blocks past the head a bundle may target.
+	maxBundleLookahead = 32
+)
+
+var (
+	errEmptyBundle      = errors.New("bundle has no transactions")
+	errBundleTooLarge   = fmt.Errorf("bundle exceeds %d transactions", maxBundleTxs)
+	errBundleTimestamps = errors.New("bundle max timestamp before min timestamp")
+	errBundlePoolFull   = errors.New("bundle pool full")
+	errBundleTooFar     = fmt.Errorf("bundle targets a block more than %d past the head", maxBundleLookahead)
+	errKnownBundle      = errors.New("known bundle")
+
+	bundleIncludedCounter  = metrics.NewRegisteredCounter("miner/bundle/included", nil)
+	bundleDiscardedCounter = metrics.NewRegisteredCounter("miner/bundle/discarded", nil)
+)
+
+// Bundle is a group of transactions, possibly from different accounts, which
+// must be included atomically and in order at the top of a block.
+type Bundle struct {
+	Txs          types.Transactions
+	BlockNumber  uint64 // Number of the block the bundle targets
+	MinTimestamp uint64 // Earliest block timestamp the bundle is valid for, 0 for none
+	MaxTimestamp uint64 // Latest block timestamp the bundle is valid for, 0 for none
+}
+
+// Hash returns the hash identifying the bundle, computed over its transactions.
+func (b *Bundle) Hash() common.Hash {
+	hashes := make([]byte, 0, len(b.Txs)*common.HashLength)
+	for _, tx := range b.Txs {
+		hashes = append(hashes, tx.Hash().Bytes()...)
+	}
+	return crypto.Keccak256Hash(hashes)
+}
+
+// value returns the fees offered by the bundle's transactions at their full gas
+// limits, by which bundles compete for a place in a full pool.
+func (b *Bundle) value() *big.Int {
+	value := new(big.Int)
+	for _, tx := range b.Txs {
+		value.Add(value, new(big.Int).Mul(tx.GasPrice(), new(big.Int).SetUint64(tx.Gas())))
+	}
+	return value
+}
+
+// validate checks the bundle for basic sanity, independent of chain state.
+func (b *Bundle) validate() error {
+	if len(b.Txs) == 0 {
+		return errEmptyBundle
+	}
+	if len(b.Txs) > maxBundleTxs {
+		return errBundleTooLarge
+	}
+	if b.MaxTimestamp != 0 && b.MaxTimestamp < b.MinTimestamp {
+		return errBundleTimestamps
+	}
+	return nil
+}
+
+// applicable reports whether the bundle may be included in a block with the
+// given number and timestamp.
+func (b *Bundle) applicable(number, timestamp uint64) bool {
+	if b.BlockNumber != number {
+		return false
+	}
+	if b.MinTimestamp != 0 && timestamp < b.MinTimestamp {
+		return false
+	}
+	if b.MaxTimestamp != 0 && timestamp > b.MaxTimestamp {
+		return false
+	}
+	return true
+}
+
+// BundleResult is the outcome of executing a bundle.
+type BundleResult struct {
+	Hash     common.Hash
+	GasUsed  uint64
+	Receipts []*types.Receipt // Receipts of the transactions executed, up to any failure
+	Err      error            // Reason the bundle can't be included, nil on success
+}
+
+// bundlePool holds the bundles awaiting inclusion, in arrival order.
+type bundlePool struct {
+	mu      sync.Mutex
+	bundles []*Bundle
+}
+
+// add queues a bundle for inclusion, given the number of the current head.
+// Bundles for blocks already mined are dropped first; if the pool is still full
+// the bundle offering the lowest value is evicted to make room, unless the new
+// one offers even less.
+func (p *bundlePool) add(bundle *Bundle, head uint64) error {
+	if bundle.BlockNumber <= head {
+		return fmt.Errorf("bundle targets block %d, already at %d", bundle.BlockNumber, head)
+	}
+	if bundle.BlockNumber > head+maxBundleLookahead {
+		return errBundleTooFar
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	hash := bundle.Hash()
+	for _, b := range p.bundles {
+		if b.Hash() == hash && b.BlockNumber == bundle.BlockNumber {
+			return errKnownBundle
+		}
+	}
+	p.prune(head + 1)
+	if len(p.bundles) >= maxBundles {
+		cheapest, value := 0, p.bundles[0].value()
+		for i, b := range p.bundles[1:] {
+			if v := b.value(); v.Cmp(value) < 0 {
+				cheapest, value = i+1, v
+			}
+		}
+		if bundle.value().Cmp(value) <= 0 {
+			return errBundlePoolFull
+		}
+		p.bundles = append(p.bundles[:cheapest], p.bundles[cheapest+1:]...)
+		bundleDiscardedCounter.Inc(1)
+	}
+	p.bundles = append(p.bundles, bundle)
+	return nil
+}
+
+// prune drops the bundles targeting blocks before number. The caller must hold
+// p.mu.
+func (p *bundlePool) prune(number uint64) {
+	keep := p.bundles[:0]
+	for _, b := range p.bundles {
+		if b.BlockNumber >= number {
+			keep = append(keep, b)
+		}
+	}
+	for i := len(keep); i < len(p.bundles); i++ {
+		p.bundles[i] = nil
+	}
+	p.bundles = keep
+}
+
+// applicable returns the bundles which may be included in a block with the
+// given number and timestamp, dropping all those targeting earlier blocks.
+func (p *bundlePool) applicable(number, timestamp uint64) []*Bundle {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.prune(number)
+
+	var found []*Bundle
+	for _, b := range p.bundles {
+		if b.applicable(number, timestamp) {
+			found = append(found, b)
+		}
+	}
+	return found
+}
+
+// remove discards a bundle.
+func (p *bundlePool) remove(bundle *Bundle) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, b := range p.bundles {
+		if b == bundle {
+			p.bundles = append(p.bundles[:i], p.bundles[i+1:]...)
+			return
+		}
+	}
+}
+
+// applyBundle executes the bundle's transactions in order on a copy of env's
+// state. Only if every transaction applies and succeeds is the copy adopted,
+// along with the consumed gas and the receipts; otherwise env is left untouched.
+func (w *worker) applyBundle(env *environment, coinbase common.Address, bundle *Bundle) *BundleResult {
+	var (
+		result  = &BundleResult{Hash: bundle.Hash()}
+		statedb = env.state.Copy()
+		gasPool = *env.gasPool
+		gasUsed = env.header.GasUsed
+		vmenv   = vm.NewEVM(core.NewEVMContextLite(env.header, w.chain, &coinbase), statedb, w.config, vm.Config{})
+	)
+	for i, tx := range bundle.Txs {
+		statedb.Prepare(tx.Hash(), common.Hash{}, env.tcount+i)
+
+		receipt, gas, err := core.ApplyTransaction(vmenv, w.config, &gasPool, statedb, env.header, tx, &gasUsed, env.signer)
+		if err != nil {
+			result.Err = fmt.Errorf("bundle transaction %d (%x) failed: %v", i, tx.Hash(), err)
+			return result
+		}
+		result.GasUsed += gas
+		result.Receipts = append(result.Receipts, receipt)
+
+		if receipt.Status == types.ReceiptStatusFailed {
+			result.Err = fmt.Errorf("bundle transaction %d (%x) reverted", i, tx.Hash())
+			return result
+		}
+	}
+	env.state = statedb
+	*env.gasPool = gasPool
+	env.header.GasUsed = gasUsed
+	env.txs = append(env.txs, bundle.Txs...)
+	env.receipts = append(env.receipts, result.Receipts...)
+	env.tcount += len(bundle.Txs)
+
+	return result
+}
+
+// commitBundles tries to include all bundles targeting the current block at its
+// top. Bundles which fail to apply are discarded.
+func (w *worker) commitBundles(coinbase common.Address) {
+	if w.current == nil {
+		return
+	}
+	if w.current.gasPool == nil {
+		w.current.gasPool = new(core.GasPool).AddGas(w.current.header.GasLimit)
+	}
+	header := w.current.header
+	var timestamp uint64
+	if header.Time != nil {
+		timestamp = header.Time.Uint64()
+	}
+	for _, bundle := range w.bundles.applicable(header.Number.Uint64(), timestamp) {
+		result := w.applyBundle(w.current, coinbase, bundle)
+		if result.Err != nil {
+			log.Debug("Discarding bundle", "hash", result.Hash, "number", header.Number, "err", result.Err)
+			w.bundles.remove(bundle)
+			bundleDiscardedCounter.Inc(1)
+			continue
+		}
+		log.Debug("Included bundle", "hash", result.Hash, "number", header.Number, "txs", len(bundle.Txs), "gas", result.GasUsed)
+		bundleIncludedCounter.Inc(1)
+	}
+}
+
+// callBundle simulates a bundle on top of the current head as if it were
+// included at the top of the next block, without affecting mining.
+func (w *worker) callBundle(bundle *Bundle) (*BundleResult, error) {
+	parent := w.chain.CurrentBlock()
+	statedb, err := w.chain.StateAt(parent.Root())
+	if err != nil {
+		return nil, err
+	}
+	w.mu.RLock()
+	coinbase := w.coinbase
+	w.mu.RUnlock()
+
+	num := parent.Number()
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     num.Add(num, common.Big1),
+		GasLimit:   core.CalcGasLimit(parent, w.gasFloor, w.gasCeil),
+		Time:       new(big.Int).Add(parent.Time(), common.Big1),
+		Difficulty: new(big.Int),
+		Coinbase:   coinbase,
+	}
+	if now := big.NewInt(time.Now().Unix()); now.Cmp(header.Time) > 0 {
+		header.Time = now
+	}
+	env := &environment{
+		signer:  types.NewEIP155Signer(w.config.ChainId),
+		state:   statedb,
+		header:  header,
+		gasPool: new(core.GasPool).AddGas(header.GasLimit),
+	}
+	return w.applyBundle(env, coinbase, bundle), nil
+}
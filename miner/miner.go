@@ -161,3 +161,21 @@ func (self *Miner) SetEtherbase(addr common.Address) {
 	self.coinbase = addr
 	self.worker.setEtherbase(addr)
 }
+
+// SendBundle queues a bundle of transactions to be included atomically at the
+// top of its target block. It is discarded if any transaction fails.
+func (self *Miner) SendBundle(bundle *Bundle) error {
+	if err := bundle.validate(); err != nil {
+		return err
+	}
+	return self.worker.bundles.add(bundle, self.eth.BlockChain().CurrentBlock().NumberU64())
+}
+
+// CallBundle simulates a bundle at the top of the block following the current
+// head, without queueing it for inclusion.
+func (self *Miner) CallBundle(bundle *Bundle) (*BundleResult, error) {
+	if err := bundle.validate(); err != nil {
+		return nil, err
+	}
+	return self.worker.callBundle(bundle)
+}
@@ -17,12 +17,15 @@
 package miner
 
 import (
+	"context"
 	"fmt"
 	"math/big"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"go.opencensus.io/trace"
+
 	"github.com/zeus-fyi/gochain/v4/common"
 	"github.com/zeus-fyi/gochain/v4/consensus"
 	"github.com/zeus-fyi/gochain/v4/consensus/clique"
@@ -146,6 +149,8 @@ type worker struct {
 	pendingMu    sync.RWMutex
 	pendingTasks map[common.Hash]*task
 
+	bundles *bundlePool // Bundles awaiting atomic inclusion at the top of a block
+
 	snapshotMu    sync.RWMutex // The lock used to protect the block snapshot and state snapshot
 	snapshotBlock *types.Block
 	snapshotState *state.StateDB
@@ -176,6 +181,7 @@ func newWorker(config *params.ChainConfig, engine consensus.Engine, eth Backend,
 		isLocalBlock:       isLocalBlock,
 		unconfirmed:        newUnconfirmedBlocks(eth.BlockChain(), miningLogAtDepth),
 		pendingTasks:       make(map[common.Hash]*task),
+		bundles:            new(bundlePool),
 		txsCh:              make(chan core.NewTxsEvent, txChanSize),
 		chainHeadCh:        make(chan core.ChainHeadEvent, chainHeadChanSize),
 		newWorkCh:          make(chan *newWorkReq),
@@ -616,6 +622,7 @@ func (w *worker) makeCurrent(parent *types.Block, header *types.Header) error {
 	if err != nil {
 		return err
 	}
+	w.chain.RecordState(state)
 	env := &environment{
 		signer: types.NewEIP155Signer(w.config.ChainId),
 		state:  state,
@@ -799,6 +806,9 @@ func (w *worker) commitTransactions(txs *types.TransactionsByPriceAndNonce, coin
 
 // commitNewWork generates several new sealing tasks based on the parent block.
 func (w *worker) commitNewWork(interrupt *int32, noempty bool, timestamp int64) {
+	_, span := trace.StartSpan(context.Background(), "worker.commitNewWork")
+	defer span.End()
+
 	w.mu.RLock()
 	defer w.mu.RUnlock()
 
@@ -851,11 +861,17 @@ func (w *worker) commitNewWork(interrupt *int32, noempty bool, timestamp int64)
 		// execution finished.
 		w.commit(false, false, tstart)
 	}
+	// Place any bundles targeting this block at its top.
+	w.commitBundles(w.coinbase)
 
 	// Fill the block with all available pending transactions.
 	pending := w.eth.TxPool().Pending()
 	// Short circuit if there is no available pending transactions
 	if len(pending) == 0 {
+		if w.current.tcount > 0 {
+			w.commit(true, true, tstart)
+			return
+		}
 		w.updateSnapshot()
 		return
 	}
@@ -365,3 +365,119 @@ func testAdjustInterval(t *testing.T, chainConfig *params.ChainConfig, engine co
 		t.Error("interval reset timeout")
 	}
 }
+
+func TestCallBundle(t *testing.T) {
+	w, _ := newTestWorker(t, cliqueChainConfig, clique.NewFaker(), 0)
+	defer w.close()
+
+	transfer := func(nonce uint64) *types.Transaction {
+		tx, _ := types.SignTx(types.NewTransaction(nonce, testUserAddress, big.NewInt(1000), params.TxGas, nil, nil), types.HomesteadSigner{}, testBankKey)
+		return tx
+	}
+	res, err := w.callBundle(&Bundle{Txs: types.Transactions{transfer(0), transfer(1)}})
+	if err != nil {
+		t.Fatalf("failed to call bundle: %v", err)
+	}
+	if res.Err != nil {
+		t.Fatalf("bundle failed: %v", res.Err)
+	}
+	if res.GasUsed != 2*params.TxGas {
+		t.Errorf("gas used mismatch: have %d, want %d", res.GasUsed, 2*params.TxGas)
+	}
+	if len(res.Receipts) != 2 {
+		t.Errorf("receipt count mismatch: have %d, want %d", len(res.Receipts), 2)
+	}
+	// A nonce gap must fail the whole bundle.
+	res, err = w.callBundle(&Bundle{Txs: types.Transactions{transfer(0), transfer(5)}})
+	if err != nil {
+		t.Fatalf("failed to call bundle: %v", err)
+	}
+	if res.Err == nil {
+		t.Fatalf("bundle with nonce gap succeeded")
+	}
+	if len(res.Receipts) != 1 {
+		t.Errorf("receipt count mismatch: have %d, want %d", len(res.Receipts), 1)
+	}
+}
+
+func TestBundlePool(t *testing.T) {
+	newBundle := func(number uint64, nonce uint64) *Bundle {
+		tx, _ := types.SignTx(types.NewTransaction(nonce, testUserAddress, big.NewInt(1000), params.TxGas, nil, nil), types.HomesteadSigner{}, testBankKey)
+		return &Bundle{Txs: types.Transactions{tx}, BlockNumber: number}
+	}
+	pool := new(bundlePool)
+	if err := pool.add(newBundle(1, 0), 0); err != nil {
+		t.Fatalf("failed to add bundle: %v", err)
+	}
+	if err := pool.add(newBundle(1, 0), 0); err != errKnownBundle {
+		t.Fatalf("duplicate bundle error mismatch: have %v, want %v", err, errKnownBundle)
+	}
+	if err := pool.add(newBundle(1, 1), 1); err == nil {
+		t.Fatalf("bundle for a mined block accepted")
+	}
+	if err := pool.add(newBundle(maxBundleLookahead+1, 1), 0); err != errBundleTooFar {
+		t.Fatalf("far future bundle error mismatch: have %v, want %v", err, errBundleTooFar)
+	}
+	timed := newBundle(2, 1)
+	timed.MinTimestamp, timed.MaxTimestamp = 100, 200
+	if err := pool.add(timed, 0); err != nil {
+		t.Fatalf("failed to add bundle: %v", err)
+	}
+	if found := pool.applicable(1, 0); len(found) != 1 {
+		t.Errorf("applicable bundle count mismatch: have %d, want %d", len(found), 1)
+	}
+	if found := pool.applicable(2, 50); len(found) != 0 {
+		t.Errorf("applicable bundle count mismatch: have %d, want %d", len(found), 0)
+	}
+	// The bundle for block 1 must have been pruned.
+	if len(pool.bundles) != 1 {
+		t.Errorf("pooled bundle count mismatch: have %d, want %d", len(pool.bundles), 1)
+	}
+	if found := pool.applicable(2, 150); len(found) != 1 {
+		t.Errorf("applicable bundle count mismatch: have %d, want %d", len(found), 1)
+	}
+	pool.remove(timed)
+	if len(pool.bundles) != 0 {
+		t.Errorf("pooled bundle count mismatch: have %d, want %d", len(pool.bundles), 0)
+	}
+}
+
+// Tests that a full bundle pool makes room by dropping expired bundles first,
+// then the lowest value ones.
+func TestBundlePoolEviction(t *testing.T) {
+	newBundle := func(number uint64, nonce uint64, price int64) *Bundle {
+		tx, _ := types.SignTx(types.NewTransaction(nonce, testUserAddress, big.NewInt(1000), params.TxGas, big.NewInt(price), nil), types.HomesteadSigner{}, testBankKey)
+		return &Bundle{Txs: types.Transactions{tx}, BlockNumber: number}
+	}
+	pool := new(bundlePool)
+	for i := 0; i < maxBundles; i++ {
+		if err := pool.add(newBundle(uint64(1+i%2), uint64(i), 10), 0); err != nil {
+			t.Fatalf("failed to add bundle %d: %v", i, err)
+		}
+	}
+	// Once block 1 is mined, its bundles make room for new ones.
+	if err := pool.add(newBundle(2, maxBundles, 1), 1); err != nil {
+		t.Fatalf("failed to add bundle after expiry: %v", err)
+	}
+	if len(pool.bundles) != maxBundles/2+1 {
+		t.Fatalf("pooled bundle count mismatch: have %d, want %d", len(pool.bundles), maxBundles/2+1)
+	}
+	for i := len(pool.bundles); i < maxBundles; i++ {
+		if err := pool.add(newBundle(3, uint64(maxBundles+i), 10), 1); err != nil {
+			t.Fatalf("failed to add bundle %d: %v", i, err)
+		}
+	}
+	// A full pool rejects bundles offering no more than its cheapest one, and
+	// evicts the cheapest one for those offering more.
+	if err := pool.add(newBundle(3, 2*maxBundles, 1), 1); err != errBundlePoolFull {
+		t.Fatalf("cheap bundle error mismatch: have %v, want %v", err, errBundlePoolFull)
+	}
+	if err := pool.add(newBundle(3, 2*maxBundles, 20), 1); err != nil {
+		t.Fatalf("failed to add valuable bundle: %v", err)
+	}
+	for _, b := range pool.bundles {
+		if b.value().Cmp(newBundle(2, 0, 1).value()) == 0 {
+			t.Fatalf("cheapest bundle not evicted")
+		}
+	}
+}
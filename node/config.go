@@ -25,6 +25,7 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/zeus-fyi/gochain/v4/accounts"
 	"github.com/zeus-fyi/gochain/v4/accounts/external"
@@ -166,6 +167,18 @@ type Config struct {
 	// private APIs to untrusted users is a major security risk.
 	WSExposeAll bool `toml:",omitempty"`
 
+	// RPCAuth configures the authentication and per-caller authorization of
+	// the HTTP and WebSocket RPC endpoints.
+	RPCAuth RPCAuthConfig `toml:",omitempty"`
+
+	// RPCLimits bounds the batch sizes, response sizes, call rates and
+	// execution times of the HTTP and WebSocket RPC endpoints.
+	RPCLimits rpc.Limits
+
+	// RPCSlowCallThreshold makes the HTTP, WebSocket and IPC endpoints log the
+	// method, parameters and duration of calls taking at least this long.
+	RPCSlowCallThreshold time.Duration `toml:",omitempty"`
+
 	// Logger is a custom logger to use with the p2p.Server.
 	Logger log.Logger `toml:",omitempty"`
 
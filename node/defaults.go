@@ -24,6 +24,7 @@ import (
 
 	"github.com/zeus-fyi/gochain/v4/p2p"
 	"github.com/zeus-fyi/gochain/v4/p2p/nat"
+	"github.com/zeus-fyi/gochain/v4/rpc"
 )
 
 const (
@@ -40,6 +41,10 @@ var DefaultConfig = Config{
 	HTTPModules: []string{"net", "web3"},
 	WSPort:      DefaultWSPort,
 	WSModules:   []string{"net", "web3"},
+	RPCLimits: rpc.Limits{
+		BatchItems:    1000,
+		ResponseBytes: 25 * 1024 * 1024,
+	},
 	P2P: p2p.Config{
 		ListenAddr: ":30303",
 		MaxPeers:   25,
@@ -20,6 +20,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"net/http"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -60,10 +61,11 @@ type Node struct {
 	ipcListener net.Listener // IPC RPC listener socket to serve API requests
 	ipcHandler  *rpc.Server  // IPC RPC request handler to process the API requests
 
-	httpEndpoint  string       // HTTP endpoint (interface + port) to listen at (empty = HTTP disabled)
-	httpWhitelist []string     // HTTP RPC modules to allow through this endpoint
-	httpListener  net.Listener // HTTP RPC listener socket to server API requests
-	httpHandler   *rpc.Server  // HTTP RPC request handler to process the API requests
+	httpEndpoint  string                  // HTTP endpoint (interface + port) to listen at (empty = HTTP disabled)
+	httpWhitelist []string                // HTTP RPC modules to allow through this endpoint
+	httpListener  net.Listener            // HTTP RPC listener socket to server API requests
+	httpHandler   *rpc.Server             // HTTP RPC request handler to process the API requests
+	httpServices  map[string]http.Handler // Handlers of the HTTP services mounted next to the RPC API, keyed by path
 
 	wsEndpoint string       // Websocket endpoint (interface + port) to listen at (empty = websocket disabled)
 	wsListener net.Listener // Websocket RPC listener socket to server API requests
@@ -261,6 +263,20 @@ func (n *Node) startRPC(services map[reflect.Type]Service) error {
 	for _, service := range services {
 		apis = append(apis, service.APIs()...)
 	}
+	// Gather the handlers to serve on the HTTP endpoint besides the APIs
+	handlers := make(map[string]http.Handler)
+	for _, service := range services {
+		if service, ok := service.(HTTPService); ok {
+			for path, handler := range service.HTTPHandlers() {
+				if _, exists := handlers[path]; exists {
+					return fmt.Errorf("duplicate HTTP handler for path %q", path)
+				}
+				handlers[path] = handler
+			}
+		}
+	}
+	n.httpServices = handlers
+
 	// Start the various API endpoints, terminating all in case of errors
 	if err := n.startInProc(apis); err != nil {
 		return err
@@ -320,6 +336,7 @@ func (n *Node) startIPC(apis []rpc.API) error {
 	if err != nil {
 		return err
 	}
+	handler.SetSlowCallThreshold(n.config.RPCSlowCallThreshold)
 	n.ipcListener = listener
 	n.ipcHandler = handler
 	n.log.Info("IPC endpoint opened", "url", n.ipcEndpoint)
@@ -350,14 +367,34 @@ func (n *Node) startHTTP(endpoint string, apis []rpc.API, modules []string, cors
 	}
 	// register apis and create handler stack
 	srv := rpc.NewServer()
+	srv.SetLimits(n.config.RPCLimits)
+	srv.SetSlowCallThreshold(n.config.RPCSlowCallThreshold)
 	err := RegisterApisFromWhitelist(apis, modules, srv, false)
 	if err != nil {
 		return err
 	}
-	handler := NewHTTPHandlerStack(srv, cors, vhosts, tracing)
+	var mux http.Handler = srv
+	if len(n.httpServices) > 0 {
+		paths := http.NewServeMux()
+		paths.Handle("/", srv)
+		for path, handler := range n.httpServices {
+			paths.Handle(path, newModuleHandler(modules, handler))
+		}
+		mux = paths
+	}
+	// Authenticate within the CORS and vhost handlers, so that rejections carry
+	// the CORS headers browsers need to see them.
+	if mux, err = newRPCAuthHandler(&n.config.RPCAuth, mux); err != nil {
+		return err
+	}
+	handler := NewHTTPHandlerStack(mux, cors, vhosts, tracing)
 	// wrap handler in websocket handler only if websocket port is the same as http rpc
 	if n.httpEndpoint == n.wsEndpoint {
-		handler = NewWebsocketUpgradeHandler(handler, srv.WebsocketHandler(wsOrigins))
+		ws, err := newRPCAuthHandler(&n.config.RPCAuth, srv.WebsocketHandler(wsOrigins))
+		if err != nil {
+			return err
+		}
+		handler = NewWebsocketUpgradeHandler(handler, ws)
 	}
 	listener, err := StartHTTPEndpoint(endpoint, timeouts, handler)
 	if err != nil {
@@ -365,10 +402,13 @@ func (n *Node) startHTTP(endpoint string, apis []rpc.API, modules []string, cors
 	}
 	n.log.Info("HTTP endpoint opened", "url", fmt.Sprintf("http://%v/", listener.Addr()),
 		"cors", strings.Join(cors, ","),
-		"vhosts", strings.Join(vhosts, ","))
+		"vhosts", strings.Join(vhosts, ","), "auth", n.config.RPCAuth.Enabled())
 	if n.httpEndpoint == n.wsEndpoint {
 		n.log.Info("WebSocket endpoint opened", "url", fmt.Sprintf("ws://%v", listener.Addr()))
 	}
+	for path := range n.httpServices {
+		n.log.Info("HTTP service mounted", "url", fmt.Sprintf("http://%v%s", listener.Addr(), path))
+	}
 	// All listeners booted successfully
 	n.httpEndpoint = endpoint
 	n.httpListener = listener
@@ -401,16 +441,20 @@ func (n *Node) startWS(endpoint string, apis []rpc.API, modules []string, wsOrig
 	}
 
 	srv := rpc.NewServer()
-	handler := srv.WebsocketHandler(wsOrigins)
-	err := RegisterApisFromWhitelist(apis, modules, srv, exposeAll)
+	srv.SetLimits(n.config.RPCLimits)
+	srv.SetSlowCallThreshold(n.config.RPCSlowCallThreshold)
+	handler, err := newRPCAuthHandler(&n.config.RPCAuth, srv.WebsocketHandler(wsOrigins))
 	if err != nil {
 		return err
 	}
+	if err := RegisterApisFromWhitelist(apis, modules, srv, exposeAll); err != nil {
+		return err
+	}
 	listener, err := startWSEndpoint(endpoint, handler)
 	if err != nil {
 		return err
 	}
-	n.log.Info("WebSocket endpoint opened", "url", fmt.Sprintf("ws://%s", listener.Addr()))
+	n.log.Info("WebSocket endpoint opened", "url", fmt.Sprintf("ws://%s", listener.Addr()), "auth", n.config.RPCAuth.Enabled())
 	// All listeners booted successfully
 	n.wsEndpoint = endpoint
 	n.wsListener = listener
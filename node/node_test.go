@@ -608,6 +608,54 @@ func TestWebsocketHTTPOnSamePort_HTTPRequest(t *testing.T) {
 	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
 }
 
+// httpTestService serves a fixed body next to the RPC APIs.
+type httpTestService struct{ NoopService }
+
+func (s *httpTestService) HTTPHandlers() map[string]http.Handler {
+	return map[string]http.Handler{
+		"/test": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("test service"))
+		}),
+	}
+}
+
+// Tests that the handlers of HTTP services are served on the HTTP RPC endpoint,
+// without shadowing the RPC APIs.
+func TestHTTPServiceHandlers(t *testing.T) {
+	conf := testNodeConfig()
+	conf.HTTPHost, conf.HTTPPort = "127.0.0.1", 7454
+	stack, err := New(conf)
+	if err != nil {
+		t.Fatalf("failed to create protocol stack: %v", err)
+	}
+	if err := stack.Register(func(*ServiceContext) (Service, error) { return new(httpTestService), nil }); err != nil {
+		t.Fatalf("failed to register service: %v", err)
+	}
+	if err := stack.Start(); err != nil {
+		t.Fatalf("failed to start node: %v", err)
+	}
+	defer stack.Stop()
+
+	resp, err := http.Get("http://127.0.0.1:7454/test")
+	if err != nil {
+		t.Fatalf("service request failed: %v", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "test service" {
+		t.Errorf("service response mismatch: have %q", body)
+	}
+	client, err := rpc.Dial("http://127.0.0.1:7454")
+	if err != nil {
+		t.Fatalf("failed to dial RPC endpoint: %v", err)
+	}
+	defer client.Close()
+	var modules map[string]string
+	if err := client.Call(&modules, "rpc_modules"); err != nil {
+		t.Errorf("RPC request failed: %v", err)
+	}
+}
+
 func startHTTP(t *testing.T) *Node {
 	conf := &Config{HTTPPort: 7453, WSPort: 7453}
 	node, err := New(conf)
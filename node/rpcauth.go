@@ -0,0 +1,306 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package node
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/zeus-fyi/gochain/v4/common"
+	"github.com/zeus-fyi/gochain/v4/log"
+	"github.com/zeus-fyi/gochain/v4/metrics"
+	"github.com/zeus-fyi/gochain/v4/rpc"
+)
+
+// jwtClockSkew is the tolerance applied to the time claims of bearer tokens.
+const jwtClockSkew = 5 * time.Second
+
+var (
+	rpcAuthRejectedMeter = metrics.NewRegisteredMeter("rpc/auth/rejected", nil)
+	rpcAuthAcceptedMeter = metrics.NewRegisteredMeter("rpc/auth/accepted", nil)
+)
+
+var (
+	errMissingCredentials = errors.New("missing credentials")
+	errUnknownAPIKey      = errors.New("unknown API key")
+)
+
+// RPCAuthConfig configures the authentication of callers of the HTTP and
+// WebSocket RPC endpoints. Every credential maps to the permissions of its
+// holder, a list of namespaces ("eth") and methods ("admin_peers") it may call,
+// where "*" permits everything. Calls outside of a caller's permissions are
+// denied even if the module is exposed by the endpoint.
+type RPCAuthConfig struct {
+	// JWTSecret is the path of a file holding the hex encoded secret HS256
+	// bearer tokens are signed with. Tokens restrict their holder through a
+	// "permissions" claim, tokens without one may call every exposed method.
+	JWTSecret string `toml:",omitempty"`
+
+	// APIKeys maps static API keys, sent in the X-API-Key header or the apikey
+	// query parameter, to the permissions of their holders.
+	APIKeys map[string][]string `toml:",omitempty"`
+
+	// Anonymous lists the permissions of callers without credentials. When
+	// authentication is enabled and it is empty, such callers are rejected.
+	Anonymous []string `toml:",omitempty"`
+}
+
+// Enabled reports whether any credentials are configured.
+func (c *RPCAuthConfig) Enabled() bool {
+	return c.JWTSecret != "" || len(c.APIKeys) > 0
+}
+
+// rpcPermissions is the set of namespaces and methods a caller may invoke. It
+// implements rpc.Authorizer.
+type rpcPermissions struct {
+	id         string // Identity of the caller, for logging
+	all        bool
+	namespaces map[string]bool
+	methods    map[string]bool
+}
+
+func newRPCPermissions(id string, allowed []string) *rpcPermissions {
+	p := &rpcPermissions{
+		id:         id,
+		namespaces: make(map[string]bool),
+		methods:    make(map[string]bool),
+	}
+	for _, entry := range allowed {
+		switch {
+		case entry == "*":
+			p.all = true
+		case strings.Contains(entry, "_"):
+			p.methods[entry] = true
+		case entry != "":
+			p.namespaces[entry] = true
+		}
+	}
+	return p
+}
+
+// Authorize implements rpc.Authorizer. The metadata namespace served by every
+// endpoint is always permitted.
+func (p *rpcPermissions) Authorize(method string) error {
+	namespace := rpcNamespace(method)
+	if p.all || namespace == rpc.MetadataApi || p.namespaces[namespace] || p.methods[method] {
+		return nil
+	}
+	return fmt.Errorf("%s may not call %s", p.id, method)
+}
+
+// rpcNamespace returns the namespace of an RPC method.
+func rpcNamespace(method string) string {
+	if i := strings.Index(method, "_"); i >= 0 {
+		return method[:i]
+	}
+	return method
+}
+
+// moduleAuthorizer restricts the methods a caller may invoke to the modules
+// exposed by an endpoint, on top of the caller's own permissions.
+type moduleAuthorizer struct {
+	modules map[string]bool // Exposed modules, empty if unrestricted
+	caller  rpc.Authorizer  // Permissions of the caller, nil if unrestricted
+}
+
+// Authorize implements rpc.Authorizer.
+func (a *moduleAuthorizer) Authorize(method string) error {
+	if namespace := rpcNamespace(method); len(a.modules) > 0 && !a.modules[namespace] {
+		return fmt.Errorf("module %s not exposed", namespace)
+	}
+	if a.caller != nil {
+		return a.caller.Authorize(method)
+	}
+	return nil
+}
+
+// newModuleHandler passes requests on to the handler of a service mounted on
+// the HTTP endpoint, restricted to the modules exposed by the endpoint. It lets
+// services offering RPC methods over other protocols honour the whitelist.
+func newModuleHandler(modules []string, next http.Handler) http.Handler {
+	whitelist := make(map[string]bool)
+	for _, module := range modules {
+		whitelist[module] = true
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := &moduleAuthorizer{modules: whitelist, caller: rpc.AuthorizerFromContext(r.Context())}
+		next.ServeHTTP(w, r.WithContext(rpc.WithAuthorizer(r.Context(), auth)))
+	})
+}
+
+// rpcAuthHandler authenticates RPC requests and installs the permissions of
+// their callers into the request context.
+type rpcAuthHandler struct {
+	secret    []byte                     // HS256 secret, nil disables bearer tokens
+	keys      map[string]*rpcPermissions // Permissions by API key
+	anonymous *rpcPermissions            // Permissions of callers without credentials, nil rejects them
+	next      http.Handler
+}
+
+// newRPCAuthHandler wraps next with the authentication configured by config,
+// or returns it unchanged if authentication is disabled.
+func newRPCAuthHandler(config *RPCAuthConfig, next http.Handler) (http.Handler, error) {
+	if !config.Enabled() {
+		return next, nil
+	}
+	h := &rpcAuthHandler{keys: make(map[string]*rpcPermissions), next: next}
+	if config.JWTSecret != "" {
+		blob, err := ioutil.ReadFile(config.JWTSecret)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWT secret: %v", err)
+		}
+		secret := common.FromHex(strings.TrimSpace(string(blob)))
+		if len(secret) < 32 {
+			return nil, fmt.Errorf("invalid JWT secret in %s: need at least 32 hex encoded bytes", config.JWTSecret)
+		}
+		h.secret = secret
+	}
+	for key, allowed := range config.APIKeys {
+		if key == "" {
+			return nil, errors.New("empty API key")
+		}
+		// Only log a prefix of the key, never the key itself.
+		id := "apikey " + key
+		if len(key) > 4 {
+			id = "apikey " + key[:4] + "…"
+		}
+		h.keys[key] = newRPCPermissions(id, allowed)
+	}
+	if len(config.Anonymous) > 0 {
+		h.anonymous = newRPCPermissions("anonymous", config.Anonymous)
+	}
+	return h, nil
+}
+
+// ServeHTTP authenticates the request, rejecting it if the credentials are
+// invalid, and passes it on with the permissions of its caller.
+func (h *rpcAuthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Let CORS preflight and empty health-check requests through, they carry
+	// no credentials and don't reach any method.
+	if r.Method == http.MethodOptions || r.Method == http.MethodGet && r.ContentLength == 0 && r.URL.RawQuery == "" && !isWebsocket(r) {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	perms, err := h.authenticate(r)
+	if err != nil {
+		rpcAuthRejectedMeter.Mark(1)
+		log.Warn("Rejected RPC request", "remote", r.RemoteAddr, "err", err)
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	rpcAuthAcceptedMeter.Mark(1)
+	h.next.ServeHTTP(w, r.WithContext(rpc.WithAuthorizer(r.Context(), perms)))
+}
+
+// authenticate returns the permissions of the caller of a request.
+func (h *rpcAuthHandler) authenticate(r *http.Request) (*rpcPermissions, error) {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		if h.secret == nil || !strings.HasPrefix(auth, "Bearer ") {
+			return nil, errors.New("unsupported authorization scheme")
+		}
+		return h.verifyToken(strings.TrimPrefix(auth, "Bearer "))
+	}
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		key = r.URL.Query().Get("apikey")
+	}
+	if key != "" {
+		for k, perms := range h.keys {
+			if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+				return perms, nil
+			}
+		}
+		return nil, errUnknownAPIKey
+	}
+	if h.anonymous == nil {
+		return nil, errMissingCredentials
+	}
+	return h.anonymous, nil
+}
+
+// jwtClaims are the claims of a bearer token checked by the handler.
+type jwtClaims struct {
+	Subject     string    `json:"sub"`
+	Expiry      *int64    `json:"exp"`
+	NotBefore   *int64    `json:"nbf"`
+	Permissions *[]string `json:"permissions"`
+}
+
+// verifyToken checks the signature and time claims of an HS256 signed JSON web
+// token, returning the permissions it grants.
+func (h *rpcAuthHandler) verifyToken(token string) (*rpcPermissions, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed token header: %v", err)
+	}
+	if header.Alg != "HS256" {
+		return nil, fmt.Errorf("unsupported token algorithm %q", header.Alg)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token signature: %v", err)
+	}
+	mac := hmac.New(sha256.New, h.secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return nil, errors.New("invalid token signature")
+	}
+	var claims jwtClaims
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed token claims: %v", err)
+	}
+	now := time.Now()
+	if claims.Expiry != nil && now.After(time.Unix(*claims.Expiry, 0).Add(jwtClockSkew)) {
+		return nil, errors.New("token expired")
+	}
+	if claims.NotBefore != nil && now.Add(jwtClockSkew).Before(time.Unix(*claims.NotBefore, 0)) {
+		return nil, errors.New("token not yet valid")
+	}
+	id := "token"
+	if claims.Subject != "" {
+		id = "token " + claims.Subject
+	}
+	if claims.Permissions == nil {
+		return newRPCPermissions(id, []string{"*"}), nil
+	}
+	return newRPCPermissions(id, *claims.Permissions), nil
+}
+
+// decodeJWTSegment decodes a base64url encoded JSON segment of a token.
+func decodeJWTSegment(seg string, v interface{}) error {
+	blob, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(blob, v)
+}
@@ -0,0 +1,200 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package node
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zeus-fyi/gochain/v4/rpc"
+)
+
+type authTestService struct{}
+
+func (authTestService) Echo(s string) string { return s }
+
+// signTestToken creates an HS256 signed token with the given claims.
+func signTestToken(secret []byte, claims map[string]interface{}) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	blob, _ := json.Marshal(claims)
+	payload := base64.RawURLEncoding.EncodeToString(blob)
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(header + "." + payload))
+	return header + "." + payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Tests that API keys, bearer tokens and anonymous callers are authenticated
+// and only allowed to call the namespaces and methods they were granted.
+func TestRPCAuthHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rpcauth-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	secretFile := filepath.Join(dir, "jwtsecret")
+	if err := ioutil.WriteFile(secretFile, []byte("0x3031323334353637383961626364656630313233343536373839616263646566\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	srv := rpc.NewServer()
+	srv.RegisterName("eth", authTestService{})
+	srv.RegisterName("admin", authTestService{})
+	defer srv.Stop()
+
+	handler, err := newRPCAuthHandler(&RPCAuthConfig{
+		JWTSecret: secretFile,
+		APIKeys:   map[string][]string{"trusted": {"eth", "admin"}, "peers": {"admin_echo"}},
+		Anonymous: []string{"eth"},
+	}, srv)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	now := time.Now().Unix()
+	tests := []struct {
+		name     string
+		header   string
+		value    string
+		method   string
+		status   int
+		response string
+	}{
+		{"anonymous allowed", "", "", "eth_echo", http.StatusOK, `"result":"x"`},
+		{"anonymous denied", "", "", "admin_echo", http.StatusOK, `"code":-32001`},
+		{"anonymous metadata", "", "", "rpc_modules", http.StatusOK, `"result":{`},
+		{"key allowed", "X-API-Key", "trusted", "admin_echo", http.StatusOK, `"result":"x"`},
+		{"key method allowed", "X-API-Key", "peers", "admin_echo", http.StatusOK, `"result":"x"`},
+		{"key method denied", "X-API-Key", "peers", "eth_echo", http.StatusOK, `"code":-32001`},
+		{"key unknown", "X-API-Key", "bogus", "eth_echo", http.StatusUnauthorized, "unknown API key"},
+		{"token unrestricted", "Authorization", "Bearer " + signTestToken(secret, map[string]interface{}{"exp": now + 60}), "admin_echo", http.StatusOK, `"result":"x"`},
+		{"token restricted", "Authorization", "Bearer " + signTestToken(secret, map[string]interface{}{"permissions": []string{"eth"}}), "admin_echo", http.StatusOK, `"code":-32001`},
+		{"token expired", "Authorization", "Bearer " + signTestToken(secret, map[string]interface{}{"exp": now - 60}), "eth_echo", http.StatusUnauthorized, "token expired"},
+		{"token forged", "Authorization", "Bearer " + signTestToken([]byte("forged"), map[string]interface{}{}), "eth_echo", http.StatusUnauthorized, "invalid token signature"},
+	}
+	for _, tt := range tests {
+		body := `{"jsonrpc":"2.0","id":1,"method":"` + tt.method + `","params":["x"]}`
+		if tt.method == "rpc_modules" {
+			body = `{"jsonrpc":"2.0","id":1,"method":"rpc_modules","params":[]}`
+		}
+		req, _ := http.NewRequest(http.MethodPost, ts.URL, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if tt.header != "" {
+			req.Header.Set(tt.header, tt.value)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: request failed: %v", tt.name, err)
+		}
+		blob, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: status mismatch: have %d, want %d", tt.name, resp.StatusCode, tt.status)
+		}
+		if !strings.Contains(string(blob), tt.response) {
+			t.Errorf("%s: response %q does not contain %q", tt.name, blob, tt.response)
+		}
+	}
+}
+
+// Tests that callers without credentials are rejected unless anonymous
+// permissions are configured.
+func TestRPCAuthHandlerNoAnonymous(t *testing.T) {
+	srv := rpc.NewServer()
+	defer srv.Stop()
+
+	handler, err := newRPCAuthHandler(&RPCAuthConfig{APIKeys: map[string][]string{"key": {"*"}}}, srv)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"rpc_modules"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status mismatch: have %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	// Key passed as a query parameter, as websocket clients in browsers do.
+	req = httptest.NewRequest(http.MethodPost, "/?apikey=key", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"rpc_modules"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("status mismatch: have %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+// Tests that authentication on the HTTP endpoint leaves CORS intact: preflight
+// requests, which never carry credentials, are answered and rejections carry
+// the CORS headers.
+func TestRPCAuthPreflight(t *testing.T) {
+	conf := testNodeConfig()
+	conf.HTTPHost, conf.HTTPPort = "127.0.0.1", 7455
+	conf.HTTPCors = []string{"*"}
+	conf.RPCAuth = RPCAuthConfig{APIKeys: map[string][]string{"key": {"*"}}}
+	stack, err := New(conf)
+	if err != nil {
+		t.Fatalf("failed to create protocol stack: %v", err)
+	}
+	if err := stack.Start(); err != nil {
+		t.Fatalf("failed to start node: %v", err)
+	}
+	defer stack.Stop()
+
+	req, _ := http.NewRequest(http.MethodOptions, "http://127.0.0.1:7455", nil)
+	req.Header.Set("Origin", "http://dapp.example")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	req.Header.Set("Access-Control-Request-Headers", "content-type, x-api-key")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("preflight request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("preflight status mismatch: have %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if resp.Header.Get("Access-Control-Allow-Origin") == "" {
+		t.Error("preflight response lacks CORS headers")
+	}
+	req, _ = http.NewRequest(http.MethodPost, "http://127.0.0.1:7455", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"rpc_modules"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Origin", "http://dapp.example")
+	if resp, err = http.DefaultClient.Do(req); err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("status mismatch: have %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+	if resp.Header.Get("Access-Control-Allow-Origin") == "" {
+		t.Error("rejection lacks CORS headers")
+	}
+}
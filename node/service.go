@@ -17,6 +17,7 @@
 package node
 
 import (
+	"net/http"
 	"reflect"
 
 	"github.com/zeus-fyi/gochain/v4/accounts"
@@ -103,3 +104,13 @@ type Service interface {
 	// are all terminated.
 	Stop() error
 }
+
+// HTTPService is a Service that also serves plain HTTP requests on the HTTP RPC
+// endpoint, next to the RPC APIs.
+type HTTPService interface {
+	Service
+
+	// HTTPHandlers retrieves the handlers the service wishes to serve, keyed
+	// by the URL path they are mounted at. All other paths go to the RPC APIs.
+	HTTPHandlers() map[string]http.Handler
+}
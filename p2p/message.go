@@ -41,6 +41,14 @@ const (
 	BlockBodiesMsg     = 0x06
 	NewBlockMsg        = 0x07
 
+	// Protocol messages belonging to eth/65
+	NewPooledTransactionHashesMsg = 0x08
+	GetPooledTransactionsMsg      = 0x09
+	PooledTransactionsMsg         = 0x0a
+
+	// GoChain extension belonging to eth/66
+	PrivateTxMsg = 0x0b
+
 	// Protocol messages belonging to eth/63
 	GetNodeDataMsg = 0x0d
 	NodeDataMsg    = 0x0e
@@ -67,6 +75,15 @@ func MsgCodeString(code uint64) string {
 	case NewBlockMsg:
 		return "NewBlock"
 
+	case NewPooledTransactionHashesMsg:
+		return "NewPooledTransactionHashes"
+	case GetPooledTransactionsMsg:
+		return "GetPooledTransactions"
+	case PooledTransactionsMsg:
+		return "PooledTransactions"
+	case PrivateTxMsg:
+		return "PrivateTx"
+
 	case GetNodeDataMsg:
 		return "GetNodeData"
 	case NodeDataMsg:
@@ -20,6 +20,7 @@ import (
 	"fmt"
 
 	"github.com/zeus-fyi/gochain/v4/p2p/discover"
+	"github.com/zeus-fyi/gochain/v4/p2p/enr"
 )
 
 // Protocol represents a P2P subprotocol implementation.
@@ -52,6 +53,11 @@ type Protocol struct {
 	// about a certain peer in the network. If an info retrieval function is set,
 	// but returns nil, it is assumed that the protocol handshake is still running.
 	PeerInfo func(id discover.NodeID) interface{}
+
+	// Attributes is an optional helper method to retrieve the protocol specific
+	// entries of the node record of the host. It is queried whenever the record
+	// is assembled, so the entries may follow the state of the protocol.
+	Attributes func() []enr.Entry
 }
 
 func (p Protocol) cap() Cap {
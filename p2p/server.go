@@ -18,7 +18,9 @@
 package p2p
 
 import (
+	"bytes"
 	"crypto/ecdsa"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"net"
@@ -30,8 +32,10 @@ import (
 	"github.com/zeus-fyi/gochain/v4/log"
 	"github.com/zeus-fyi/gochain/v4/p2p/discover"
 	"github.com/zeus-fyi/gochain/v4/p2p/discv5"
+	"github.com/zeus-fyi/gochain/v4/p2p/enr"
 	"github.com/zeus-fyi/gochain/v4/p2p/nat"
 	"github.com/zeus-fyi/gochain/v4/p2p/netutil"
+	"github.com/zeus-fyi/gochain/v4/rlp"
 )
 
 const (
@@ -155,6 +159,10 @@ type Server struct {
 	lock    sync.Mutex // protects running
 	running bool
 
+	recordLock    sync.Mutex  // protects record, recordEntries
+	record        *enr.Record // Last signed node record of the host
+	recordEntries []byte      // Encoded entries of record, to detect changes
+
 	ntab         discoverTable
 	listener     net.Listener
 	ourHandshake *protoHandshake
@@ -923,6 +931,7 @@ type NodeInfo struct {
 		Discovery int `json:"discovery"` // UDP listening port for discovery protocol
 		Listener  int `json:"listener"`  // TCP listening port for RLPx
 	} `json:"ports"`
+	ENR        string                 `json:"enr,omitempty"` // Node record of the host, in its text form
 	ListenAddr string                 `json:"listenAddr"`
 	Protocols  map[string]interface{} `json:"protocols"`
 }
@@ -943,6 +952,12 @@ func (srv *Server) NodeInfo() *NodeInfo {
 	info.Ports.Discovery = int(node.UDP)
 	info.Ports.Listener = int(node.TCP)
 
+	if record, err := srv.LocalRecord(); err == nil {
+		if enc, err := rlp.EncodeToBytes(record); err == nil {
+			info.ENR = "enr:" + base64.RawURLEncoding.EncodeToString(enc)
+		}
+	}
+
 	// Gather all the running protocol infos (only once per protocol type)
 	for _, proto := range srv.Protocols {
 		if _, ok := info.Protocols[proto.Name]; !ok {
@@ -956,6 +971,59 @@ func (srv *Server) NodeInfo() *NodeInfo {
 	return info
 }
 
+// LocalRecord returns the signed node record of the host, holding its address
+// and the entries of the running protocols. The record is only re-signed, with
+// a bumped sequence number, when its contents change.
+func (srv *Server) LocalRecord() (*enr.Record, error) {
+	if srv.PrivateKey == nil {
+		return nil, errors.New("server has no private key")
+	}
+	node := srv.Self()
+
+	var entries []enr.Entry
+	if ip := node.IP.To4(); ip != nil {
+		entries = append(entries, enr.IP4(ip))
+	} else if len(node.IP) == net.IPv6len {
+		entries = append(entries, enr.IP6(node.IP))
+	}
+	if node.TCP != 0 {
+		entries = append(entries, enr.WithEntry("tcp", node.TCP))
+	}
+	if node.UDP != 0 {
+		entries = append(entries, enr.WithEntry("udp", node.UDP))
+	}
+	for _, proto := range srv.Protocols {
+		if proto.Attributes != nil {
+			entries = append(entries, proto.Attributes()...)
+		}
+	}
+	enc, err := rlp.EncodeToBytes(entries)
+	if err != nil {
+		return nil, err
+	}
+	srv.recordLock.Lock()
+	defer srv.recordLock.Unlock()
+
+	if srv.record != nil && bytes.Equal(enc, srv.recordEntries) {
+		record := *srv.record
+		return &record, nil
+	}
+	record := new(enr.Record)
+	for _, entry := range entries {
+		record.Set(entry)
+	}
+	if srv.record != nil {
+		record.SetSeq(srv.record.Seq())
+	}
+	if err := record.Sign(srv.PrivateKey); err != nil {
+		return nil, err
+	}
+	srv.record, srv.recordEntries = record, enc
+
+	copied := *record
+	return &copied, nil
+}
+
 // PeersInfo returns an array of metadata objects describing connected peers.
 func (srv *Server) PeersInfo() []*PeerInfo {
 	// Gather all the generic and sub-protocol specific infos
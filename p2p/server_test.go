@@ -30,6 +30,7 @@ import (
 	"github.com/zeus-fyi/gochain/v4/crypto"
 	"github.com/zeus-fyi/gochain/v4/log"
 	"github.com/zeus-fyi/gochain/v4/p2p/discover"
+	"github.com/zeus-fyi/gochain/v4/p2p/enr"
 )
 
 func init() {
@@ -489,6 +490,39 @@ func (c *setupTransport) ReadMsg() (Msg, error) {
 	panic("ReadMsg called on setupTransport")
 }
 
+// Tests that the node record of the host holds the protocol attributes, and is
+// only re-signed when they change.
+func TestServerLocalRecord(t *testing.T) {
+	attr := uint(1)
+	srv := &Server{Config: Config{
+		PrivateKey: newkey(),
+		Protocols: []Protocol{{
+			Name:       "test",
+			Attributes: func() []enr.Entry { return []enr.Entry{enr.WithEntry("test", attr)} },
+		}},
+	}}
+	record, err := srv.LocalRecord()
+	if err != nil {
+		t.Fatalf("failed to create record: %v", err)
+	}
+	var have uint
+	if err := record.Load(enr.WithEntry("test", &have)); err != nil || have != 1 {
+		t.Fatalf("attribute mismatch: have %d (err %v), want 1", have, err)
+	}
+	seq := record.Seq()
+
+	if record, _ = srv.LocalRecord(); record.Seq() != seq {
+		t.Errorf("unchanged record re-signed: seq %d, want %d", record.Seq(), seq)
+	}
+	attr = 2
+	if record, _ = srv.LocalRecord(); record.Seq() != seq+1 {
+		t.Errorf("changed record sequence mismatch: seq %d, want %d", record.Seq(), seq+1)
+	}
+	if err := record.Load(enr.WithEntry("test", &have)); err != nil || have != 2 {
+		t.Errorf("attribute mismatch: have %d (err %v), want 2", have, err)
+	}
+}
+
 func newkey() *ecdsa.PrivateKey {
 	key, err := crypto.GenerateKey()
 	if err != nil {
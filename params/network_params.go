@@ -23,4 +23,8 @@ const (
 	// BloomBitsBlocks is the number of blocks a single bloom bit section vector
 	// contains on the server side.
 	BloomBitsBlocks uint64 = 4096
+
+	// LogIndexBlocks is the number of blocks a single section of the exact log
+	// index covers.
+	LogIndexBlocks uint64 = 1024
 )
@@ -0,0 +1,51 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import "context"
+
+// Authorizer decides which methods the caller behind a connection may invoke.
+// Transport middleware installs it into the request context with
+// WithAuthorizer, and the server consults it before every call.
+type Authorizer interface {
+	// Authorize returns a non-nil error if the method may not be called.
+	Authorize(method string) error
+}
+
+type authorizerKey struct{}
+
+// WithAuthorizer returns a copy of ctx carrying the authorizer of its caller.
+// Connections served with such a context only run the calls it authorizes.
+func WithAuthorizer(ctx context.Context, a Authorizer) context.Context {
+	return context.WithValue(ctx, authorizerKey{}, a)
+}
+
+// AuthorizerFromContext returns the authorizer installed into ctx, if any.
+func AuthorizerFromContext(ctx context.Context) Authorizer {
+	a, _ := ctx.Value(authorizerKey{}).(Authorizer)
+	return a
+}
+
+// Authorize checks a call of method against the authorizer installed into ctx,
+// permitting it if there is none. Handlers offering the methods of the server
+// over other protocols use it to apply the permissions of their callers.
+func Authorize(ctx context.Context, method string) error {
+	if a := AuthorizerFromContext(ctx); a != nil {
+		return a.Authorize(method)
+	}
+	return nil
+}
@@ -77,6 +77,7 @@ type Client struct {
 	idgen    func() ID // for subscriptions
 	isHTTP   bool
 	services *serviceRegistry
+	server   *Server // server a served connection belongs to, nil for dialed clients
 
 	idCounter uint32
 
@@ -111,7 +112,15 @@ type clientConn struct {
 
 func (c *Client) newClientConn(conn ServerCodec) *clientConn {
 	ctx := context.WithValue(context.Background(), clientContextKey{}, c)
+	if wc, ok := conn.(*websocketCodec); ok && wc.auth != nil {
+		ctx = WithAuthorizer(ctx, wc.auth)
+	}
 	handler := newHandler(ctx, conn, c.idgen, c.services)
+	if c.server != nil {
+		handler.server = c.server
+		handler.limits = c.server.limits
+		handler.transport = transportOf(conn)
+	}
 	return &clientConn{conn, handler}
 }
 
@@ -197,17 +206,18 @@ func newClient(initctx context.Context, connect reconnectFunc) (*Client, error)
 	if err != nil {
 		return nil, err
 	}
-	c := initClient(conn, randomIDGenerator(), new(serviceRegistry))
+	c := initClient(conn, randomIDGenerator(), new(serviceRegistry), nil)
 	c.reconnectFunc = connect
 	return c, nil
 }
 
-func initClient(conn ServerCodec, idgen func() ID, services *serviceRegistry) *Client {
+func initClient(conn ServerCodec, idgen func() ID, services *serviceRegistry, server *Server) *Client {
 	_, isHTTP := conn.(*httpConn)
 	c := &Client{
 		idgen:       idgen,
 		isHTTP:      isHTTP,
 		services:    services,
+		server:      server,
 		writeConn:   conn,
 		close:       make(chan struct{}),
 		closing:     make(chan struct{}),
@@ -16,7 +16,10 @@
 
 package rpc
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 var (
 	_ Error = new(methodNotFoundError)
@@ -25,6 +28,10 @@ var (
 	_ Error = new(invalidRequestError)
 	_ Error = new(invalidMessageError)
 	_ Error = new(invalidParamsError)
+	_ Error = new(unauthorizedError)
+	_ Error = new(rateLimitedError)
+	_ Error = new(responseTooLargeError)
+	_ Error = new(timeoutError)
 )
 
 const defaultErrorCode = -32000
@@ -45,6 +52,45 @@ func (e *subscriptionNotFoundError) Error() string {
 	return fmt.Sprintf("no %q subscription in %s namespace", e.subscription, e.namespace)
 }
 
+// method not permitted for the caller
+type unauthorizedError struct{ method string }
+
+func (e *unauthorizedError) ErrorCode() int { return -32001 }
+
+func (e *unauthorizedError) Error() string {
+	return fmt.Sprintf("the method %s is not authorized", e.method)
+}
+
+// caller exceeded the call rate permitted by the server
+type rateLimitedError struct{ method string }
+
+func (e *rateLimitedError) ErrorCode() int { return -32005 }
+
+func (e *rateLimitedError) Error() string {
+	return fmt.Sprintf("rate limit exceeded for %s", e.method)
+}
+
+// encoded result exceeds the response size limit of the server
+type responseTooLargeError struct{ limit int }
+
+func (e *responseTooLargeError) ErrorCode() int { return -32003 }
+
+func (e *responseTooLargeError) Error() string {
+	return fmt.Sprintf("response too large (limit %d bytes)", e.limit)
+}
+
+// method didn't return within the call timeout of the server
+type timeoutError struct {
+	method  string
+	timeout time.Duration
+}
+
+func (e *timeoutError) ErrorCode() int { return -32002 }
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("%s timed out after %v", e.method, e.timeout)
+}
+
 // Invalid JSON was received by the server.
 type parseError struct{ message string }
 
@@ -19,6 +19,7 @@ package rpc
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"reflect"
 	"strconv"
 	"strings"
@@ -26,8 +27,13 @@ import (
 	"time"
 
 	"github.com/zeus-fyi/gochain/v4/log"
+	"go.opencensus.io/trace"
 )
 
+// maxLoggedParams is the length beyond which call parameters are truncated in
+// the slow call log.
+const maxLoggedParams = 256
+
 // handler handles JSON-RPC messages. There is one handler per connection. Note that
 // handler is not safe for concurrent use. Message handling never blocks indefinitely
 // because RPCs are processed on background goroutines launched by handler.
@@ -60,6 +66,9 @@ type handler struct {
 	conn           jsonWriter                     // where responses will be sent
 	log            log.Logger
 	allowSubscribe bool
+	server         *Server  // server serving the connection, nil on the client side
+	limits         *limiter // server limits, nil if unlimited
+	transport      string   // transport of served connections, for metrics
 
 	subLock    sync.Mutex
 	serverSubs map[ID]*Subscription
@@ -68,6 +77,9 @@ type handler struct {
 type callProc struct {
 	ctx       context.Context
 	notifiers []*Notifier
+
+	resultBytes int  // size of the results answered so far
+	tooLarge    bool // whether a result was dropped for exceeding the size limit
 }
 
 func newHandler(connCtx context.Context, conn jsonWriter, idgen func() ID, reg *serviceRegistry) *handler {
@@ -101,6 +113,14 @@ func (h *handler) handleBatch(msgs []*jsonrpcMessage) {
 		return
 	}
 
+	if h.limits.batchTooLarge(len(msgs)) {
+		rpcTooLargeMeter.Mark(1)
+		h.log.Warn("Rejected RPC batch", "items", len(msgs), "limit", h.limits.BatchItems)
+		h.startCallProc(func(cp *callProc) {
+			h.conn.writeJSON(cp.ctx, errorMessage(&invalidRequestError{fmt.Sprintf("batch too large (%d > %d items)", len(msgs), h.limits.BatchItems)}))
+		})
+		return
+	}
 	// Handle non-call messages first:
 	calls := make([]*jsonrpcMessage, 0, len(msgs))
 	for _, msg := range msgs {
@@ -115,7 +135,16 @@ func (h *handler) handleBatch(msgs []*jsonrpcMessage) {
 	h.startCallProc(func(cp *callProc) {
 		answers := make([]*jsonrpcMessage, 0, len(msgs))
 		for _, msg := range calls {
+			// Once the results exceed the size limit, fail the rest of the
+			// batch without executing it.
+			if cp.tooLarge {
+				if msg.isCall() {
+					answers = append(answers, msg.errorResponse(&responseTooLargeError{h.limits.ResponseBytes}))
+				}
+				continue
+			}
 			if answer := h.handleCallMsg(cp, msg); answer != nil {
+				cp.resultBytes += len(answer.Result)
 				answers = append(answers, answer)
 			}
 		}
@@ -291,10 +320,12 @@ func (h *handler) handleCallMsg(ctx *callProc, msg *jsonrpcMessage) *jsonrpcMess
 	switch {
 	case msg.isNotification():
 		h.handleCall(ctx, msg)
+		h.logSlowCall(msg, time.Since(start))
 		h.log.Debug("Served "+msg.Method, "t", time.Since(start))
 		return nil
 	case msg.isCall():
 		resp := h.handleCall(ctx, msg)
+		h.logSlowCall(msg, time.Since(start))
 		var ctx []interface{}
 		ctx = append(ctx, "reqid", idForLog{msg.ID}, "t", time.Since(start))
 		if resp.Error != nil {
@@ -316,6 +347,18 @@ func (h *handler) handleCallMsg(ctx *callProc, msg *jsonrpcMessage) *jsonrpcMess
 
 // handleCall processes method calls.
 func (h *handler) handleCall(cp *callProc, msg *jsonrpcMessage) *jsonrpcMessage {
+	if auth := AuthorizerFromContext(cp.ctx); auth != nil {
+		if err := auth.Authorize(msg.Method); err != nil {
+			rpcDeniedMeter.Mark(1)
+			h.log.Warn("Denied RPC call", "method", msg.Method, "err", err)
+			return msg.errorResponse(&unauthorizedError{method: msg.Method})
+		}
+	}
+	if !h.limits.allow(h.conn.remoteAddr(), msg.Method) {
+		rpcRateLimitedMeter.Mark(1)
+		h.log.Debug("Rate limited RPC call", "method", msg.Method)
+		return msg.errorResponse(&rateLimitedError{method: msg.Method})
+	}
 	if msg.isSubscribe() {
 		return h.handleSubscribe(cp, msg)
 	}
@@ -333,7 +376,34 @@ func (h *handler) handleCall(cp *callProc, msg *jsonrpcMessage) *jsonrpcMessage
 		return msg.errorResponse(&invalidParamsError{err.Error()})
 	}
 	start := time.Now()
-	answer := h.runMethod(cp.ctx, msg, callb, args)
+	ctx := cp.ctx
+	timeout := h.limits.timeout(msg.Method)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	if g := rpcInflightGauges[h.transport]; g != nil {
+		g.Inc(1)
+		defer g.Dec(1)
+	}
+	ctx, span := trace.StartSpan(ctx, "rpc."+msg.Method)
+	var (
+		limit  = h.limits.responseLeft(cp.resultBytes)
+		answer *jsonrpcMessage
+	)
+	if timeout > 0 {
+		answer = h.runMethodTimeout(ctx, msg, callb, args, limit, timeout)
+	} else {
+		answer = h.runMethod(ctx, msg, callb, args, limit)
+	}
+	if answer.Error != nil && answer.Error.Code == (&responseTooLargeError{}).ErrorCode() {
+		cp.tooLarge = true
+	}
+	if answer.Error != nil {
+		span.SetStatus(trace.Status{Code: trace.StatusCodeUnknown, Message: answer.Error.Message})
+	}
+	span.End()
 
 	// Collect the statistics for RPC calls if metrics is enabled.
 	// We only care about pure rpc call. Filter out subscription.
@@ -350,6 +420,30 @@ func (h *handler) handleCall(cp *callProc, msg *jsonrpcMessage) *jsonrpcMessage
 	return answer
 }
 
+// logSlowCall logs calls which took longer than the slow call threshold of the
+// server.
+func (h *handler) logSlowCall(msg *jsonrpcMessage, elapsed time.Duration) {
+	threshold := h.server.slowCallThreshold()
+	if threshold == 0 || elapsed < threshold {
+		return
+	}
+	rpcSlowMeter.Mark(1)
+	h.log.Warn("Slow RPC call", "method", msg.Method, "params", sanitizeParams(msg), "t", elapsed)
+}
+
+// sanitizeParams returns the parameters of a call for logging. Parameters of
+// methods which may carry secrets are redacted and long ones are truncated.
+func sanitizeParams(msg *jsonrpcMessage) string {
+	if msg.namespace() == "personal" {
+		return "<redacted>"
+	}
+	params := string(msg.Params)
+	if len(params) > maxLoggedParams {
+		params = params[:maxLoggedParams] + "…"
+	}
+	return params
+}
+
 // handleSubscribe processes *_subscribe method calls.
 func (h *handler) handleSubscribe(cp *callProc, msg *jsonrpcMessage) *jsonrpcMessage {
 	if !h.allowSubscribe {
@@ -380,16 +474,50 @@ func (h *handler) handleSubscribe(cp *callProc, msg *jsonrpcMessage) *jsonrpcMes
 	cp.notifiers = append(cp.notifiers, n)
 	ctx := context.WithValue(cp.ctx, notifierKey{}, n)
 
-	return h.runMethod(ctx, msg, callb, args)
+	return h.runMethod(ctx, msg, callb, args, h.limits.responseLeft(cp.resultBytes))
 }
 
-// runMethod runs the Go callback for an RPC method.
-func (h *handler) runMethod(ctx context.Context, msg *jsonrpcMessage, callb *callback, args []reflect.Value) *jsonrpcMessage {
+// runMethod runs the Go callback for an RPC method. Its result is encoded into
+// at most limit bytes, unless negative, and dropped as soon as it exceeds them.
+func (h *handler) runMethod(ctx context.Context, msg *jsonrpcMessage, callb *callback, args []reflect.Value, limit int) *jsonrpcMessage {
 	result, err := callb.call(ctx, msg.Method, args)
 	if err != nil {
 		return msg.errorResponse(err)
 	}
-	return msg.response(result)
+	enc, err := encodeResult(result, limit)
+	if err == errResponseLimit {
+		rpcTooLargeMeter.Mark(1)
+		h.log.Warn("Dropped oversized RPC response", "method", msg.Method, "limit", h.limits.ResponseBytes)
+		return msg.errorResponse(&responseTooLargeError{h.limits.ResponseBytes})
+	}
+	if err != nil {
+		return msg.errorResponse(err)
+	}
+	return &jsonrpcMessage{Version: vsn, ID: msg.ID, Result: enc}
+}
+
+// runMethodTimeout runs the Go callback for an RPC method on its own goroutine
+// and answers with an error once ctx expires, even if the method ignores its
+// context and keeps running. The method is not stopped by the timeout answer:
+// it runs on in the background until it honours the cancelled context or
+// returns on its own, and its result is then discarded.
+func (h *handler) runMethodTimeout(ctx context.Context, msg *jsonrpcMessage, callb *callback, args []reflect.Value, limit int, timeout time.Duration) *jsonrpcMessage {
+	done := make(chan *jsonrpcMessage, 1)
+	go func() {
+		done <- h.runMethod(ctx, msg, callb, args, limit)
+	}()
+	select {
+	case answer := <-done:
+		if ctx.Err() != context.DeadlineExceeded {
+			return answer
+		}
+	case <-ctx.Done():
+		if ctx.Err() != context.DeadlineExceeded {
+			return msg.errorResponse(ctx.Err())
+		}
+	}
+	rpcTimeoutMeter.Mark(1)
+	return msg.errorResponse(&timeoutError{method: msg.Method, timeout: timeout})
 }
 
 // unsubscribe is the callback function for all *_unsubscribe calls.
@@ -26,8 +26,14 @@ func DialInProc(handler *Server) *Client {
 	initctx := context.Background()
 	c, _ := newClient(initctx, func(context.Context) (ServerCodec, error) {
 		p1, p2 := net.Pipe()
-		go handler.ServeCodec(NewCodec(p1), 0)
+		go handler.ServeCodec(inprocCodec{NewCodec(p1)}, 0)
 		return NewCodec(p2), nil
 	})
 	return c
 }
+
+// inprocCodec is the server side codec of an in-process connection, telling
+// it apart from IPC connections in metrics.
+type inprocCodec struct {
+	ServerCodec
+}
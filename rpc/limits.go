@@ -0,0 +1,242 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// errResponseLimit is returned when encoding a result exceeding the response
+// size limit.
+var errResponseLimit = errors.New("response size limit exceeded")
+
+var marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+// limiterPruneInterval is how often fully refilled token buckets are dropped.
+const limiterPruneInterval = time.Minute
+
+// Limits bounds the work a server performs for its callers. Zero values
+// disable the respective limit.
+type Limits struct {
+	// BatchItems is the maximum number of calls in a batch request.
+	BatchItems int `toml:",omitempty"`
+
+	// ResponseBytes is the maximum size of the results of a single call or of
+	// all calls in a batch. Calls exceeding it are answered with an error.
+	ResponseBytes int `toml:",omitempty"`
+
+	// RateLimit is the number of calls per second a client IP may make of
+	// each method, with up to RateBurst calls at once.
+	RateLimit float64 `toml:",omitempty"`
+	RateBurst int     `toml:",omitempty"`
+
+	// MethodRates overrides RateLimit for individual methods.
+	MethodRates map[string]float64 `toml:",omitempty"`
+
+	// MethodTimeouts bounds the execution time of individual methods.
+	MethodTimeouts map[string]time.Duration `toml:",omitempty"`
+}
+
+// tokenBucket is a rate limiter holding up to burst tokens, refilled at a
+// constant rate per second.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take refills the bucket for the time elapsed since its last use and tries to
+// consume a single token from it.
+func (b *tokenBucket) take(now time.Time, rate float64, burst int) bool {
+	b.tokens += now.Sub(b.last).Seconds() * rate
+	if b.tokens > float64(burst) {
+		b.tokens = float64(burst)
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// full reports whether the bucket would be full at the given time, in which
+// case it carries no information and may be dropped.
+func (b *tokenBucket) full(now time.Time, rate float64, burst int) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*rate >= float64(burst)
+}
+
+// rateKey identifies the token bucket of a client IP and method.
+type rateKey struct {
+	ip     string
+	method string
+}
+
+// limiter enforces the limits of a server across all of its connections.
+type limiter struct {
+	Limits
+
+	mu      sync.Mutex
+	buckets map[rateKey]*tokenBucket
+	pruned  time.Time
+}
+
+func newLimiter(limits Limits) *limiter {
+	if limits.RateBurst < 1 {
+		limits.RateBurst = 1
+	}
+	return &limiter{
+		Limits:  limits,
+		buckets: make(map[rateKey]*tokenBucket),
+		pruned:  time.Now(),
+	}
+}
+
+// allow reports whether the client at remote may call method now.
+func (l *limiter) allow(remote, method string) bool {
+	if l == nil {
+		return true
+	}
+	rate := l.RateLimit
+	if r, ok := l.MethodRates[method]; ok {
+		rate = r
+	}
+	if rate <= 0 {
+		return true
+	}
+	// Clients are limited by IP, whichever port they connect from.
+	ip := remote
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		ip = host
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.pruned) >= limiterPruneInterval {
+		l.prune(now)
+	}
+	key := rateKey{ip, method}
+	b := l.buckets[key]
+	if b == nil {
+		b = &tokenBucket{tokens: float64(l.RateBurst), last: now}
+		l.buckets[key] = b
+	}
+	return b.take(now, rate, l.RateBurst)
+}
+
+// prune drops the token buckets which have refilled completely. The caller
+// must hold l.mu.
+func (l *limiter) prune(now time.Time) {
+	for key, b := range l.buckets {
+		rate := l.RateLimit
+		if r, ok := l.MethodRates[key.method]; ok {
+			rate = r
+		}
+		if b.full(now, rate, l.RateBurst) {
+			delete(l.buckets, key)
+		}
+	}
+	l.pruned = now
+}
+
+// timeout returns the execution time limit of method, zero if unlimited.
+func (l *limiter) timeout(method string) time.Duration {
+	if l == nil {
+		return 0
+	}
+	return l.MethodTimeouts[method]
+}
+
+// batchTooLarge reports whether a batch of n calls exceeds the limits.
+func (l *limiter) batchTooLarge(n int) bool {
+	return l != nil && l.BatchItems > 0 && n > l.BatchItems
+}
+
+// responseLeft returns the number of bytes left for results once size bytes
+// were answered, negative if unlimited.
+func (l *limiter) responseLeft(size int) int {
+	if l == nil || l.ResponseBytes <= 0 {
+		return -1
+	}
+	if size > l.ResponseBytes {
+		return 0
+	}
+	return l.ResponseBytes - size
+}
+
+// limitedBuffer is a buffer failing writes beyond limit bytes.
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > b.limit {
+		return 0, errResponseLimit
+	}
+	return b.Buffer.Write(p)
+}
+
+// encodeResult encodes the result of a call as JSON into at most limit bytes,
+// unless negative. Slices are encoded element by element, so encoding stops
+// once an element exceeds the limit instead of after the whole result.
+func encodeResult(result interface{}, limit int) (json.RawMessage, error) {
+	if limit < 0 {
+		return json.Marshal(result)
+	}
+	buf := &limitedBuffer{limit: limit}
+	v := reflect.ValueOf(result)
+	if !v.IsValid() || v.Kind() != reflect.Slice || v.IsNil() || v.Type().Elem().Kind() == reflect.Uint8 ||
+		v.Type().Implements(marshalerType) || reflect.PtrTo(v.Type()).Implements(marshalerType) {
+		enc, err := json.Marshal(result)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := buf.Write(enc); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	if _, err := buf.Write([]byte{'['}); err != nil {
+		return nil, err
+	}
+	for i := 0; i < v.Len(); i++ {
+		if i > 0 {
+			if _, err := buf.Write([]byte{','}); err != nil {
+				return nil, err
+			}
+		}
+		// Encode through a pointer, as json.Marshal does for slice elements
+		enc, err := json.Marshal(v.Index(i).Addr().Interface())
+		if err != nil {
+			return nil, err
+		}
+		if _, err := buf.Write(enc); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := buf.Write([]byte{']'}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,187 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newLimitedTestServer starts an HTTP test server with the given limits and
+// returns a client connected to it.
+func newLimitedTestServer(t *testing.T, limits Limits) (*httptest.Server, *Client) {
+	server := newTestServer()
+	server.RegisterName("large", largeRespService{1000})
+	server.SetLimits(limits)
+	ts := httptest.NewServer(server)
+
+	client, err := DialHTTP(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ts, client
+}
+
+func TestLimitsBatchItems(t *testing.T) {
+	ts, client := newLimitedTestServer(t, Limits{BatchItems: 2})
+	defer ts.Close()
+	defer client.Close()
+
+	post := func(body string) string {
+		resp, err := http.Post(ts.URL, contentType, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		blob, _ := ioutil.ReadAll(resp.Body)
+		return string(blob)
+	}
+	call := `{"jsonrpc":"2.0","id":1,"method":"test_echo","params":["x",1]}`
+	if resp := post("[" + call + "," + call + "]"); strings.Contains(resp, "error") {
+		t.Errorf("batch within limit failed: %s", resp)
+	}
+	if resp := post("[" + call + "," + call + "," + call + "]"); !strings.Contains(resp, "batch too large") {
+		t.Errorf("oversized batch served: %s", resp)
+	}
+}
+
+func TestLimitsResponseBytes(t *testing.T) {
+	ts, client := newLimitedTestServer(t, Limits{ResponseBytes: 1500})
+	defer ts.Close()
+	defer client.Close()
+
+	var result string
+	if err := client.Call(&result, "large_largeResp"); err != nil {
+		t.Fatalf("response within limit failed: %v", err)
+	}
+	// Two responses of 1000 bytes exceed the limit as a batch.
+	batch := []BatchElem{
+		{Method: "large_largeResp", Result: new(string)},
+		{Method: "large_largeResp", Result: new(string)},
+		{Method: "large_largeResp", Result: new(string)},
+	}
+	if err := client.BatchCall(batch); err != nil {
+		t.Fatal(err)
+	}
+	if batch[0].Error != nil {
+		t.Errorf("first batch element failed: %v", batch[0].Error)
+	}
+	for i := 1; i < len(batch); i++ {
+		if batch[i].Error == nil || !strings.Contains(batch[i].Error.Error(), "response too large") {
+			t.Errorf("batch element %d: error mismatch: have %v", i, batch[i].Error)
+		}
+	}
+}
+
+func TestLimitsRate(t *testing.T) {
+	ts, client := newLimitedTestServer(t, Limits{
+		RateLimit:   0.001,
+		RateBurst:   2,
+		MethodRates: map[string]float64{"test_rets": 0},
+	})
+	defer ts.Close()
+	defer client.Close()
+
+	var result echoResult
+	for i := 0; i < 2; i++ {
+		if err := client.Call(&result, "test_echo", "x", 1); err != nil {
+			t.Fatalf("call %d within burst failed: %v", i, err)
+		}
+	}
+	err := client.Call(&result, "test_echo", "x", 1)
+	if err == nil || !strings.Contains(err.Error(), "rate limit exceeded") {
+		t.Fatalf("error mismatch: have %v, want rate limit exceeded", err)
+	}
+	// Other methods have their own buckets, and overrides lift the limit.
+	if err := client.Call(&result, "test_echoWithCtx", "x", 1); err != nil {
+		t.Errorf("call of other method failed: %v", err)
+	}
+	var rets string
+	for i := 0; i < 5; i++ {
+		if err := client.Call(&rets, "test_rets"); err != nil {
+			t.Fatalf("call %d of unlimited method failed: %v", i, err)
+		}
+	}
+}
+
+func TestLimitsMethodTimeout(t *testing.T) {
+	ts, client := newLimitedTestServer(t, Limits{
+		MethodTimeouts: map[string]time.Duration{"test_block": 50 * time.Millisecond},
+	})
+	defer ts.Close()
+	defer client.Close()
+
+	err := client.Call(nil, "test_block")
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("error mismatch: have %v, want timeout", err)
+	}
+}
+
+// Tests that calls are answered once their timeout expires, even if the method
+// ignores its context.
+func TestLimitsMethodTimeoutIgnored(t *testing.T) {
+	ts, client := newLimitedTestServer(t, Limits{
+		MethodTimeouts: map[string]time.Duration{"test_sleep": 50 * time.Millisecond},
+	})
+	defer ts.Close()
+	defer client.Close()
+
+	start := time.Now()
+	err := client.Call(nil, "test_sleep", 2*time.Second)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("error mismatch: have %v, want timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("timed out call answered after %v", elapsed)
+	}
+}
+
+// countedJSON counts how often it is encoded.
+type countedJSON struct{ count *int }
+
+func (c countedJSON) MarshalJSON() ([]byte, error) {
+	*c.count++
+	return []byte(`"0123456789"`), nil
+}
+
+// Tests that results are encoded up to the size limit only.
+func TestEncodeResultLimit(t *testing.T) {
+	var (
+		count  int
+		result = make([]countedJSON, 100)
+	)
+	for i := range result {
+		result[i] = countedJSON{&count}
+	}
+	want, _ := json.Marshal(result)
+	if have, err := encodeResult(result, len(want)); err != nil || !bytes.Equal(have, want) {
+		t.Fatalf("encoding within limit mismatch: have %s, %v, want %s", have, err, want)
+	}
+	count = 0
+	if _, err := encodeResult(result, 100); err != errResponseLimit {
+		t.Fatalf("error mismatch: have %v, want %v", err, errResponseLimit)
+	}
+	if count > 10 {
+		t.Errorf("encoded %d elements beyond the limit", count)
+	}
+}
@@ -27,6 +27,19 @@ var (
 	successfulRequestGauge = metrics.NewRegisteredGauge("rpc/success", nil)
 	failedReqeustGauge     = metrics.NewRegisteredGauge("rpc/failure", nil)
 	rpcServingTimer        = metrics.NewRegisteredTimer("rpc/duration/all", nil)
+	rpcDeniedMeter         = metrics.NewRegisteredMeter("rpc/denied", nil)
+	rpcRateLimitedMeter    = metrics.NewRegisteredMeter("rpc/ratelimited", nil)
+	rpcTooLargeMeter       = metrics.NewRegisteredMeter("rpc/toolarge", nil)
+	rpcTimeoutMeter        = metrics.NewRegisteredMeter("rpc/timeout", nil)
+	rpcSlowMeter           = metrics.NewRegisteredMeter("rpc/slow", nil)
+
+	// Calls in flight by the transport of the connection serving them.
+	rpcInflightGauges = map[string]metrics.Gauge{
+		"http":   metrics.NewRegisteredGauge("rpc/inflight/http", nil),
+		"ws":     metrics.NewRegisteredGauge("rpc/inflight/ws", nil),
+		"ipc":    metrics.NewRegisteredGauge("rpc/inflight/ipc", nil),
+		"inproc": metrics.NewRegisteredGauge("rpc/inflight/inproc", nil),
+	}
 )
 
 func newRPCServingTimer(method string, valid bool) metrics.Timer {
@@ -37,3 +50,15 @@ func newRPCServingTimer(method string, valid bool) metrics.Timer {
 	m := fmt.Sprintf("rpc/duration/%s/%s", method, flag)
 	return metrics.GetOrRegisterTimer(m, nil)
 }
+
+// transportOf returns the name of the transport a served connection uses.
+func transportOf(conn ServerCodec) string {
+	switch conn.(type) {
+	case *websocketCodec:
+		return "ws"
+	case inprocCodec:
+		return "inproc"
+	default:
+		return "ipc"
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zeus-fyi/gochain/v4/log"
+)
+
+func TestSlowCallLog(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		slow []*log.Record
+	)
+	root := log.Root().GetHandler()
+	defer log.Root().SetHandler(root)
+	log.Root().SetHandler(log.FuncHandler(func(r *log.Record) error {
+		if r.Msg == "Slow RPC call" {
+			mu.Lock()
+			slow = append(slow, r)
+			mu.Unlock()
+		}
+		return nil
+	}, nil))
+
+	server := newTestServer()
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	var result echoResult
+	if err := client.Call(&result, "test_echo", "x", 1); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	if len(slow) != 0 {
+		t.Errorf("call logged without threshold")
+	}
+	mu.Unlock()
+
+	server.SetSlowCallThreshold(time.Nanosecond)
+	if err := client.Call(&result, "test_echo", "x", 1); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(slow) != 1 {
+		t.Fatalf("slow call log mismatch: have %d records, want 1", len(slow))
+	}
+	ctx := make(map[string]interface{})
+	for i := 0; i+1 < len(slow[0].Ctx); i += 2 {
+		ctx[slow[0].Ctx[i].(string)] = slow[0].Ctx[i+1]
+	}
+	if ctx["method"] != "test_echo" {
+		t.Errorf("method mismatch: have %v, want test_echo", ctx["method"])
+	}
+	if params, _ := ctx["params"].(string); !strings.Contains(params, `"x"`) {
+		t.Errorf("params mismatch: have %v", ctx["params"])
+	}
+}
+
+func TestSanitizeParams(t *testing.T) {
+	long := json.RawMessage(`["` + strings.Repeat("a", 2*maxLoggedParams) + `"]`)
+	tests := []struct {
+		msg  *jsonrpcMessage
+		want string
+	}{
+		{&jsonrpcMessage{Method: "eth_getBalance", Params: json.RawMessage(`["0x01","latest"]`)}, `["0x01","latest"]`},
+		{&jsonrpcMessage{Method: "personal_unlockAccount", Params: json.RawMessage(`["0x01","secret"]`)}, "<redacted>"},
+		{&jsonrpcMessage{Method: "eth_sendRawTransaction", Params: long}, string(long[:maxLoggedParams]) + "…"},
+	}
+	for _, tt := range tests {
+		if have := sanitizeParams(tt.msg); have != tt.want {
+			t.Errorf("%s: params mismatch: have %q, want %q", tt.msg.Method, have, tt.want)
+		}
+	}
+}
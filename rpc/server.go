@@ -20,6 +20,7 @@ import (
 	"context"
 	"io"
 	"sync/atomic"
+	"time"
 
 	mapset "github.com/deckarep/golang-set"
 	"github.com/zeus-fyi/gochain/v4/log"
@@ -46,6 +47,8 @@ type Server struct {
 	idgen    func() ID
 	run      int32
 	codecs   mapset.Set
+	limits   *limiter
+	slowCall int64 // slow call log threshold in nanoseconds, accessed atomically
 }
 
 // NewServer creates a new server instance with no registered handlers.
@@ -66,6 +69,28 @@ func (s *Server) RegisterName(name string, receiver interface{}) error {
 	return s.services.registerName(name, receiver)
 }
 
+// SetLimits bounds the batch sizes, response sizes, call rates and execution
+// times of the calls served. It must be called before the server starts
+// serving connections.
+func (s *Server) SetLimits(limits Limits) {
+	s.limits = newLimiter(limits)
+}
+
+// SetSlowCallThreshold makes the server log the method, parameters and duration
+// of calls taking at least d. Zero disables the log. It may be called at any
+// time.
+func (s *Server) SetSlowCallThreshold(d time.Duration) {
+	atomic.StoreInt64(&s.slowCall, int64(d))
+}
+
+// slowCallThreshold returns the slow call log threshold, zero if disabled.
+func (s *Server) slowCallThreshold() time.Duration {
+	if s == nil {
+		return 0
+	}
+	return time.Duration(atomic.LoadInt64(&s.slowCall))
+}
+
 // ServeCodec reads incoming requests from codec, calls the appropriate callback and writes
 // the response back using the given codec. It will block until the codec is closed or the
 // server is stopped. In either case the codec is closed.
@@ -83,7 +108,7 @@ func (s *Server) ServeCodec(codec ServerCodec, options CodecOption) {
 	s.codecs.Add(codec)
 	defer s.codecs.Remove(codec)
 
-	c := initClient(codec, s.idgen, &s.services)
+	c := initClient(codec, s.idgen, &s.services, s)
 	<-codec.closed()
 	c.Close()
 }
@@ -99,6 +124,9 @@ func (s *Server) serveSingleRequest(ctx context.Context, codec ServerCodec) {
 
 	h := newHandler(ctx, codec, s.idgen, &s.services)
 	h.allowSubscribe = false
+	h.server = s
+	h.limits = s.limits
+	h.transport = "http"
 	defer h.close(io.EOF, nil)
 
 	reqs, batch, err := codec.readBatch()
@@ -60,6 +60,7 @@ func (s *Server) WebsocketHandler(allowedOrigins []string) http.Handler {
 			return
 		}
 		codec := newWebsocketCodec(conn)
+		codec.(*websocketCodec).auth = AuthorizerFromContext(r.Context())
 		s.ServeCodec(codec, 0)
 	})
 }
@@ -234,6 +235,7 @@ func wsClientHeaders(endpoint, origin string) (string, http.Header, error) {
 type websocketCodec struct {
 	*jsonCodec
 	conn *websocket.Conn
+	auth Authorizer // Authorizer of the upgrade request, applied to every call
 
 	wg        sync.WaitGroup
 	pingReset chan struct{}
@@ -18,10 +18,12 @@ package trie
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 
 	"github.com/zeus-fyi/gochain/v4/common"
 	"github.com/zeus-fyi/gochain/v4/crypto"
+	"github.com/zeus-fyi/gochain/v4/ethdb"
 	"github.com/zeus-fyi/gochain/v4/log"
 	"github.com/zeus-fyi/gochain/v4/rlp"
 )
@@ -117,7 +119,7 @@ func VerifyProof(rootHash common.Hash, key []byte, proofDb DatabaseReader) (valu
 		if err != nil {
 			return nil, i, fmt.Errorf("bad proof node %d: %v", i, err)
 		}
-		keyrest, cld := get(n, key)
+		keyrest, cld := get(n, key, true)
 		switch cld := cld.(type) {
 		case nil:
 			// The trie doesn't contain the key.
@@ -131,7 +133,353 @@ func VerifyProof(rootHash common.Hash, key []byte, proofDb DatabaseReader) (valu
 	}
 }
 
-func get(tn node, key []byte) ([]byte, node) {
+// proofToPath resolves the nodes of the proof on the path to key into the
+// given root, or into a fresh one if nil, leaving the nodes off the path as
+// hash nodes. It returns the root and the value at key, if present. Unless
+// allowNonExistent is set, the proof must prove the presence of key.
+func proofToPath(rootHash common.Hash, root node, key []byte, proofDb DatabaseReader, allowNonExistent bool) (node, []byte, error) {
+	resolveNode := func(hash common.Hash) (node, error) {
+		buf, _ := proofDb.Get(hash[:])
+		if buf == nil {
+			return nil, fmt.Errorf("proof node (hash %064x) missing", hash)
+		}
+		n, err := decodeNode(hash[:], buf, 0)
+		if err != nil {
+			return nil, fmt.Errorf("bad proof node %v", err)
+		}
+		return n, nil
+	}
+	// The root node must be included in the proof
+	if root == nil {
+		n, err := resolveNode(rootHash)
+		if err != nil {
+			return nil, nil, err
+		}
+		root = n
+	}
+	var (
+		err           error
+		child, parent node
+		keyrest       []byte
+		valnode       []byte
+	)
+	key, parent = keybytesToHex(key), root
+	for {
+		keyrest, child = get(parent, key, false)
+		switch cld := child.(type) {
+		case nil:
+			// The trie doesn't contain the key. All resolved nodes are
+			// proven nonetheless, which is enough to prove a range.
+			if allowNonExistent {
+				return root, nil, nil
+			}
+			return nil, nil, errors.New("the node is not contained in trie")
+		case *shortNode, *fullNode:
+			// Already resolved by a previous proof
+			key, parent = keyrest, child
+			continue
+		case hashNode:
+			if child, err = resolveNode(common.BytesToHash(cld)); err != nil {
+				return nil, nil, err
+			}
+		case valueNode:
+			valnode = cld
+		}
+		// Link the resolved child into its parent
+		switch pnode := parent.(type) {
+		case *shortNode:
+			pnode.Val = child
+		case *fullNode:
+			pnode.Children[key[0]] = child
+		default:
+			panic(fmt.Sprintf("%T: invalid node: %v", pnode, pnode))
+		}
+		if len(valnode) > 0 {
+			return root, valnode, nil
+		}
+		key, parent = keyrest, child
+	}
+}
+
+// unsetInternal removes all nodes strictly between the paths of the left and
+// right keys, which must both be resolved in the trie of n, so that they can
+// be filled back in from the leaves of the range. The nodes on the paths lose
+// their cached hashes. It reports whether the whole trie is within the range.
+func unsetInternal(n node, left []byte, right []byte) (bool, error) {
+	left, right = keybytesToHex(left), keybytesToHex(right)
+
+	// Step down to the fork point of the two paths, which is either a short
+	// node whose key doesn't match one of them, or a full node where they
+	// branch off, or either of them is missing.
+	var (
+		pos    = 0
+		parent node
+
+		// Comparison of the proven keys with the key of a short fork point
+		shortForkLeft, shortForkRight int
+	)
+findFork:
+	for {
+		switch rn := n.(type) {
+		case *shortNode:
+			rn.flags = nodeFlag{dirty: true}
+
+			if len(left)-pos < len(rn.Key) {
+				shortForkLeft = bytes.Compare(left[pos:], rn.Key)
+			} else {
+				shortForkLeft = bytes.Compare(left[pos:pos+len(rn.Key)], rn.Key)
+			}
+			if len(right)-pos < len(rn.Key) {
+				shortForkRight = bytes.Compare(right[pos:], rn.Key)
+			} else {
+				shortForkRight = bytes.Compare(right[pos:pos+len(rn.Key)], rn.Key)
+			}
+			if shortForkLeft != 0 || shortForkRight != 0 {
+				break findFork
+			}
+			parent = n
+			n, pos = rn.Val, pos+len(rn.Key)
+		case *fullNode:
+			rn.flags = nodeFlag{dirty: true}
+
+			leftnode, rightnode := rn.Children[left[pos]], rn.Children[right[pos]]
+			if leftnode == nil || rightnode == nil || left[pos] != right[pos] {
+				break findFork
+			}
+			parent = n
+			n, pos = rn.Children[left[pos]], pos+1
+		default:
+			panic(fmt.Sprintf("%T: invalid node: %v", n, n))
+		}
+	}
+	switch rn := n.(type) {
+	case *shortNode:
+		// Both keys on the same side of the short node leave an empty range
+		if shortForkLeft == -1 && shortForkRight == -1 {
+			return false, errEmptyRange
+		}
+		if shortForkLeft == 1 && shortForkRight == 1 {
+			return false, errEmptyRange
+		}
+		// The short node is entirely within the range
+		if shortForkLeft != 0 && shortForkRight != 0 {
+			if parent == nil {
+				return true, nil
+			}
+			parent.(*fullNode).Children[left[pos-1]] = nil
+			return false, nil
+		}
+		// Only one of the keys leaves the short node
+		if shortForkRight != 0 {
+			if _, ok := rn.Val.(valueNode); ok {
+				if parent == nil {
+					return true, nil
+				}
+				parent.(*fullNode).Children[left[pos-1]] = nil
+				return false, nil
+			}
+			return false, unset(rn, rn.Val, left[pos:], len(rn.Key), false)
+		}
+		if shortForkLeft != 0 {
+			if _, ok := rn.Val.(valueNode); ok {
+				if parent == nil {
+					return true, nil
+				}
+				parent.(*fullNode).Children[right[pos-1]] = nil
+				return false, nil
+			}
+			return false, unset(rn, rn.Val, right[pos:], len(rn.Key), true)
+		}
+		return false, nil
+	case *fullNode:
+		for i := left[pos] + 1; i < right[pos]; i++ {
+			rn.Children[i] = nil
+		}
+		if err := unset(rn, rn.Children[left[pos]], left[pos:], 1, false); err != nil {
+			return false, err
+		}
+		if err := unset(rn, rn.Children[right[pos]], right[pos:], 1, true); err != nil {
+			return false, err
+		}
+		return false, nil
+	default:
+		panic(fmt.Sprintf("%T: invalid node: %v", n, n))
+	}
+}
+
+// unset removes the children of child on one side of the path of key, to the
+// right of it if removeLeft is unset, and to the left otherwise. Leaves on
+// the path are removed too, as they are part of the range.
+func unset(parent node, child node, key []byte, pos int, removeLeft bool) error {
+	switch cld := child.(type) {
+	case *fullNode:
+		if removeLeft {
+			for i := 0; i < int(key[pos]); i++ {
+				cld.Children[i] = nil
+			}
+		} else {
+			for i := key[pos] + 1; i < 16; i++ {
+				cld.Children[i] = nil
+			}
+		}
+		cld.flags = nodeFlag{dirty: true}
+		return unset(cld, cld.Children[key[pos]], key, pos+1, removeLeft)
+	case *shortNode:
+		if len(key[pos:]) < len(cld.Key) || !bytes.Equal(cld.Key, key[pos:pos+len(cld.Key)]) {
+			// The path forks off here. The whole short node is within the
+			// range if it sorts on the removed side of the path.
+			if removeLeft {
+				if bytes.Compare(cld.Key, key[pos:]) < 0 {
+					parent.(*fullNode).Children[key[pos-1]] = nil
+				}
+			} else {
+				if bytes.Compare(cld.Key, key[pos:]) > 0 {
+					parent.(*fullNode).Children[key[pos-1]] = nil
+				}
+			}
+			return nil
+		}
+		if _, ok := cld.Val.(valueNode); ok {
+			parent.(*fullNode).Children[key[pos-1]] = nil
+			return nil
+		}
+		cld.flags = nodeFlag{dirty: true}
+		return unset(cld, cld.Val, key, pos+len(cld.Key), removeLeft)
+	case nil:
+		// A missing branch of the fork point
+		return nil
+	default:
+		panic(fmt.Sprintf("%T: invalid node: %v", child, child))
+	}
+}
+
+// hasRightElement reports whether the trie of node, which must be resolved on
+// the path of key, contains any key greater than key.
+func hasRightElement(node node, key []byte) bool {
+	pos, key := 0, keybytesToHex(key)
+	for node != nil {
+		switch rn := node.(type) {
+		case *fullNode:
+			for i := key[pos] + 1; i < 16; i++ {
+				if rn.Children[i] != nil {
+					return true
+				}
+			}
+			node, pos = rn.Children[key[pos]], pos+1
+		case *shortNode:
+			if len(key)-pos < len(rn.Key) || !bytes.Equal(rn.Key, key[pos:pos+len(rn.Key)]) {
+				return bytes.Compare(rn.Key, key[pos:]) > 0
+			}
+			node, pos = rn.Val, pos+len(rn.Key)
+		case valueNode:
+			return false
+		default:
+			panic(fmt.Sprintf("%T: invalid node: %v", node, node))
+		}
+	}
+	return false
+}
+
+var errEmptyRange = errors.New("empty range")
+
+// VerifyRangeProof checks that the sorted keys and values are all the leaves of
+// the trie with the given root hash between firstKey and lastKey, inclusive,
+// which must have the same length. The proof must contain the nodes on the
+// paths to both edge keys, which need not exist in the trie. If the proof is
+// nil, the keys must be all the leaves of the trie. With no keys, the proof
+// must show that no leaf follows firstKey. It reports whether the trie has
+// leaves beyond the range.
+func VerifyRangeProof(rootHash common.Hash, firstKey []byte, lastKey []byte, keys [][]byte, values [][]byte, proof DatabaseReader) (bool, error) {
+	if len(keys) != len(values) {
+		return false, fmt.Errorf("inconsistent proof data, keys: %d, values: %d", len(keys), len(values))
+	}
+	for i := 0; i < len(keys)-1; i++ {
+		if bytes.Compare(keys[i], keys[i+1]) >= 0 {
+			return false, errors.New("range is not monotonically increasing")
+		}
+	}
+	for _, value := range values {
+		if len(value) == 0 {
+			return false, errors.New("range contains deletion")
+		}
+	}
+	// Without proof the range must be the whole trie
+	if proof == nil {
+		tr, _ := New(common.Hash{}, NewDatabase(ethdb.NewMemDatabase()))
+		for i, key := range keys {
+			tr.Update(key, values[i])
+		}
+		if have := tr.Hash(); have != rootHash {
+			return false, fmt.Errorf("invalid proof, want hash %x, got %x", rootHash, have)
+		}
+		return false, nil
+	}
+	// An empty range must prove that nothing follows the first key
+	if len(keys) == 0 {
+		root, val, err := proofToPath(rootHash, nil, firstKey, proof, true)
+		if err != nil {
+			return false, err
+		}
+		if val != nil || hasRightElement(root, firstKey) {
+			return false, errors.New("more entries available")
+		}
+		return false, nil
+	}
+	if bytes.Compare(keys[0], firstKey) < 0 || bytes.Compare(keys[len(keys)-1], lastKey) > 0 {
+		return false, errors.New("keys out of range")
+	}
+	// A single leaf proven by both edges can't be split into two paths
+	if len(keys) == 1 && bytes.Equal(firstKey, lastKey) {
+		root, val, err := proofToPath(rootHash, nil, firstKey, proof, false)
+		if err != nil {
+			return false, err
+		}
+		if !bytes.Equal(firstKey, keys[0]) {
+			return false, errors.New("correct proof but invalid key")
+		}
+		if !bytes.Equal(val, values[0]) {
+			return false, errors.New("correct proof but invalid data")
+		}
+		return hasRightElement(root, firstKey), nil
+	}
+	if bytes.Compare(firstKey, lastKey) >= 0 {
+		return false, errors.New("invalid edge keys")
+	}
+	if len(firstKey) != len(lastKey) {
+		return false, errors.New("inconsistent edge keys")
+	}
+	// Resolve both edge paths into one trie, drop everything between them and
+	// rebuild it from the leaves, which must yield the same root.
+	root, _, err := proofToPath(rootHash, nil, firstKey, proof, true)
+	if err != nil {
+		return false, err
+	}
+	if root, _, err = proofToPath(rootHash, root, lastKey, proof, true); err != nil {
+		return false, err
+	}
+	empty, err := unsetInternal(root, firstKey, lastKey)
+	if err != nil {
+		return false, err
+	}
+	tr := &Trie{root: root, db: NewDatabase(ethdb.NewMemDatabase())}
+	if empty {
+		tr.root = nil
+	}
+	for i, key := range keys {
+		if err := tr.TryUpdate(key, values[i]); err != nil {
+			return false, err
+		}
+	}
+	if have := tr.Hash(); have != rootHash {
+		return false, fmt.Errorf("invalid proof, want hash %x, got %x", rootHash, have)
+	}
+	return hasRightElement(tr.root, lastKey), nil
+}
+
+// get returns the node at the end of key from tn, or the first hash node on
+// the way, with the remainder of the key. Unless skipResolved is set, it only
+// takes a single step.
+func get(tn node, key []byte, skipResolved bool) ([]byte, node) {
 	for {
 		switch n := tn.(type) {
 		case *shortNode:
@@ -140,9 +488,15 @@ func get(tn node, key []byte) ([]byte, node) {
 			}
 			tn = n.Val
 			key = key[len(n.Key):]
+			if !skipResolved {
+				return key, tn
+			}
 		case *fullNode:
 			tn = n.Children[key[0]]
 			key = key[1:]
+			if !skipResolved {
+				return key, tn
+			}
 		case hashNode:
 			return key, n
 		case nil:
@@ -20,6 +20,7 @@ import (
 	"bytes"
 	crand "crypto/rand"
 	mrand "math/rand"
+	"sort"
 	"testing"
 	"time"
 
@@ -144,6 +145,135 @@ func TestMissingKeyProof(t *testing.T) {
 }
 
 // mutateByte changes one byte in b.
+// sortedEntries returns the entries of a random trie sorted by key.
+func sortedEntries(vals map[string]*kv) []*kv {
+	var entries []*kv
+	for _, kv := range vals {
+		entries = append(entries, kv)
+	}
+	sort.Slice(entries, func(i, j int) bool { return bytes.Compare(entries[i].k, entries[j].k) < 0 })
+	return entries
+}
+
+// rangeProof returns the keys and values of entries and the proof of the
+// edge keys of the range.
+func rangeProof(trie *Trie, entries []*kv, first, last []byte) ([][]byte, [][]byte, *ethdb.MemDatabase) {
+	proof := ethdb.NewMemDatabase()
+	trie.Prove(first, 0, proof)
+	trie.Prove(last, 0, proof)
+
+	var keys, vals [][]byte
+	for _, kv := range entries {
+		keys = append(keys, kv.k)
+		vals = append(vals, kv.v)
+	}
+	return keys, vals, proof
+}
+
+func TestRangeProof(t *testing.T) {
+	trie, vals := randomTrie(4096)
+	entries := sortedEntries(vals)
+	root := trie.Hash()
+
+	for i := 0; i < 500; i++ {
+		start := mrand.Intn(len(entries))
+		end := start + mrand.Intn(len(entries)-start)
+		keys, values, proof := rangeProof(trie, entries[start:end+1], entries[start].k, entries[end].k)
+		more, err := VerifyRangeProof(root, entries[start].k, entries[end].k, keys, values, proof)
+		if err != nil {
+			t.Fatalf("range %d-%d: %v", start, end, err)
+		}
+		if more != (end < len(entries)-1) {
+			t.Fatalf("range %d-%d: more mismatch: have %v", start, end, more)
+		}
+	}
+}
+
+// Tests ranges whose edge keys don't exist in the trie.
+func TestRangeProofNonExistentEdges(t *testing.T) {
+	trie, vals := randomTrie(4096)
+	entries := sortedEntries(vals)
+	root := trie.Hash()
+
+	for i := 0; i < 500; i++ {
+		start := 1 + mrand.Intn(len(entries)-2)
+		end := start + mrand.Intn(len(entries)-1-start)
+
+		first := common.CopyBytes(entries[start].k)
+		for j := len(first) - 1; j >= 0; j-- {
+			if first[j]--; first[j] != 0xff {
+				break
+			}
+		}
+		last := common.CopyBytes(entries[end].k)
+		for j := len(last) - 1; j >= 0; j-- {
+			if last[j]++; last[j] != 0 {
+				break
+			}
+		}
+		if bytes.Equal(first, entries[start-1].k) || bytes.Equal(last, entries[end+1].k) {
+			continue // Consecutive keys leave no gap
+		}
+		keys, values, proof := rangeProof(trie, entries[start:end+1], first, last)
+		if _, err := VerifyRangeProof(root, first, last, keys, values, proof); err != nil {
+			t.Fatalf("range %d-%d: %v", start, end, err)
+		}
+	}
+	// The whole trie with no proof
+	keys, values, _ := rangeProof(trie, entries, entries[0].k, entries[0].k)
+	if more, err := VerifyRangeProof(root, nil, nil, keys, values, nil); err != nil || more {
+		t.Fatalf("full range: more %v, err %v", more, err)
+	}
+	// Nothing beyond the last entry
+	last := entries[len(entries)-1].k
+	after := common.CopyBytes(last)
+	after[len(after)-1]++
+	proof := ethdb.NewMemDatabase()
+	trie.Prove(after, 0, proof)
+	if _, err := VerifyRangeProof(root, after, nil, nil, nil, proof); err != nil {
+		t.Fatalf("empty tail range: %v", err)
+	}
+	proof = ethdb.NewMemDatabase()
+	trie.Prove(entries[10].k, 0, proof)
+	if _, err := VerifyRangeProof(root, entries[10].k, nil, nil, nil, proof); err == nil {
+		t.Fatal("empty range with following entries accepted")
+	}
+}
+
+// Tests that ranges missing, adding or altering entries are rejected.
+func TestBadRangeProof(t *testing.T) {
+	trie, vals := randomTrie(4096)
+	entries := sortedEntries(vals)
+	root := trie.Hash()
+
+	for i := 0; i < 500; i++ {
+		start := mrand.Intn(len(entries) - 3)
+		end := start + 2 + mrand.Intn(len(entries)-start-2)
+		keys, values, proof := rangeProof(trie, entries[start:end+1], entries[start].k, entries[end].k)
+
+		index := mrand.Intn(end - start + 1)
+		switch mrand.Intn(3) {
+		case 0:
+			// Drop an inner entry
+			if index == 0 || index == end-start {
+				index = 1
+			}
+			keys = append(keys[:index:index], keys[index+1:]...)
+			values = append(values[:index:index], values[index+1:]...)
+		case 1:
+			// Alter a value
+			values[index] = randBytes(20)
+		case 2:
+			// Swap two entries, breaking the order
+			j := (index + 1) % len(keys)
+			keys[index], keys[j] = keys[j], keys[index]
+		}
+		if _, err := VerifyRangeProof(root, entries[start].k, entries[end].k, keys, values, proof); err == nil {
+			t.Fatalf("range %d-%d: bad range accepted", start, end)
+		}
+	}
+}
+
 func mutateByte(b []byte) {
 	for r := mrand.Intn(len(b)); ; {
 		new := byte(mrand.Intn(255))
@@ -171,9 +171,16 @@ func (t *SecureTrie) Root() []byte {
 	return t.trie.Root()
 }
 
-// Copy returns a copy of SecureTrie.
+// SetRecorder sets the callback invoked for every node loaded from now on.
+func (t *SecureTrie) SetRecorder(r Recorder) {
+	t.trie.SetRecorder(r)
+}
+
+// Copy returns a copy of SecureTrie. The copy doesn't report loaded nodes to
+// the recorder of the original.
 func (t *SecureTrie) Copy() *SecureTrie {
 	other := *t
+	other.trie.recorder = nil
 	other.hashKeyCache = make(map[string][common.HashLength]byte, len(t.hashKeyCache))
 	for k, v := range t.hashKeyCache {
 		other.hashKeyCache[k] = v
@@ -59,6 +59,11 @@ func CacheUnloads() int64 {
 // between account and storage tries.
 type LeafCallback func(leaf []byte, parent common.Hash) error
 
+// Recorder is a callback type invoked with the hash and RLP encoding of every
+// node a trie loads from its database. It's used to collect the nodes accessed
+// while executing a block.
+type Recorder func(hash common.Hash, blob []byte)
+
 // Trie is a Merkle Patricia Trie.
 // The zero value is an empty trie with no database.
 // Use New to create a trie that sits on top of a database.
@@ -73,6 +78,8 @@ type Trie struct {
 	// new nodes are tagged with the current generation and unloaded
 	// when their generation is older than than cachegen-cachelimit.
 	cachegen, cachelimit uint16
+
+	recorder Recorder
 }
 
 // SetCacheLimit sets the number of 'cache generations' to keep.
@@ -81,6 +88,12 @@ func (t *Trie) SetCacheLimit(l uint16) {
 	t.cachelimit = l
 }
 
+// SetRecorder sets the callback invoked for every node loaded from now on.
+// Nodes loaded before, such as the root node, are not reported.
+func (t *Trie) SetRecorder(r Recorder) {
+	t.recorder = r
+}
+
 // newFlag returns the cache flag value for a newly created node.
 func (t *Trie) newFlag() nodeFlag {
 	return nodeFlag{dirty: true, gen: t.cachegen}
@@ -432,6 +445,11 @@ func (t *Trie) resolveHash(n hashNode, prefix []byte) (node, error) {
 
 	hash := common.BytesToHash(n)
 	if node := t.db.node(hash, t.cachegen); node != nil {
+		if t.recorder != nil {
+			if blob, err := t.db.Node(hash); err == nil {
+				t.recorder(hash, blob)
+			}
+		}
 		return node, nil
 	}
 	return nil, &MissingNodeError{NodeHash: hash, Path: prefix}